@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/accesslog"
+	"github.com/sirupsen/logrus"
+)
+
+type accessRecordKey struct{}
+
+// accessRecord collects what a request's access log line reports while it
+// is served. Hedged attempts report to it concurrently.
+type accessRecord struct {
+	mu     sync.Mutex
+	entry  accesslog.Entry
+	served bool // an attempt succeeded, so its target and usage are final
+}
+
+// accessRecordFrom returns the record of the request ctx belongs to, or
+// nil when it isn't access logged
+func accessRecordFrom(ctx context.Context) *accessRecord {
+	record, _ := ctx.Value(accessRecordKey{}).(*accessRecord)
+	return record
+}
+
+// setRequest notes the parsed request
+func (a *accessRecord) setRequest(llmReq *llmRequest) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entry.Tenant = llmReq.Tenant
+	a.entry.Model = llmReq.Model
+	a.entry.Stream = llmReq.Stream
+}
+
+// attempt notes one forward to target. Every attempt's cost counts; the
+// target and usage reported are the successful attempt's, else the last's.
+func (a *accessRecord) attempt(target *RouteTarget, usage tokenUsage, estimated bool, cost float64, err error) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entry.Attempts++
+	a.entry.Cost += cost
+	if a.served {
+		return
+	}
+	a.entry.Target = target.Name
+	a.entry.TargetType = target.Type
+	a.entry.Reason = target.Reason
+	a.entry.PromptTokens = usage.PromptTokens
+	a.entry.CompletionTokens = usage.CompletionTokens
+	a.entry.ReasoningTokens = usage.CompletionTokensDetails.ReasoningTokens
+	a.entry.TokensEstimated = estimated
+	if err != nil {
+		a.entry.Error = err.Error()
+		return
+	}
+	a.served = true
+	a.entry.Error = ""
+}
+
+// cached notes that a response cache answered
+func (a *accessRecord) cached(reason string) {
+	if a == nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entry.Target = "cache"
+	a.entry.TargetType = "cache"
+	a.entry.Reason = reason
+	a.served = true
+}
+
+// logAccess writes an access log line for every request next serves
+func (r *Router) logAccess(next http.Handler) http.Handler {
+	if r.accessLog == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		record := &accessRecord{}
+		aw := &accessWriter{ResponseWriter: w}
+		next.ServeHTTP(aw, req.WithContext(context.WithValue(req.Context(), accessRecordKey{}, record)))
+
+		record.mu.Lock()
+		entry := record.entry
+		record.mu.Unlock()
+		entry.Time = start.UTC()
+		entry.RequestID = requestIDFrom(req.Context())
+		entry.Method = req.Method
+		entry.Path = req.URL.Path
+		entry.Status = aw.status
+		if entry.Status == 0 {
+			entry.Status = http.StatusOK
+		}
+		entry.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+		entry.Bytes = aw.bytes
+		r.accessLog.Log(entry)
+	})
+}
+
+// logRequest logs a request's failure at level, or at debug level when its
+// access log line reports it anyway
+func logRequest(ctx context.Context, level logrus.Level, format string, args ...interface{}) {
+	if accessRecordFrom(ctx) != nil {
+		level = logrus.DebugLevel
+	}
+	logrus.WithContext(ctx).Logf(level, format, args...)
+}
+
+// accessWriter records the status and size of a response
+type accessWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (aw *accessWriter) WriteHeader(status int) {
+	if aw.status == 0 {
+		aw.status = status
+	}
+	aw.ResponseWriter.WriteHeader(status)
+}
+
+func (aw *accessWriter) Write(p []byte) (int, error) {
+	if aw.status == 0 {
+		aw.status = http.StatusOK
+	}
+	n, err := aw.ResponseWriter.Write(p)
+	aw.bytes += int64(n)
+	return n, err
+}
+
+func (aw *accessWriter) Flush() {
+	if flusher, ok := aw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (aw *accessWriter) Unwrap() http.ResponseWriter {
+	return aw.ResponseWriter
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/providers"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/usagestore"
+)
+
+// servedModel names the model that answered a request: the one it was sent
+// as, else the one the response names, else the provider's default
+func servedModel(target *RouteTarget, llmReq *llmRequest, tap *usageTap) string {
+	if target.Model != "" {
+		return target.Model
+	}
+	if llmReq.Model != "" {
+		return llmReq.Model
+	}
+	if model := tap.responseModel(); model != "" {
+		return model
+	}
+	if defaulter, ok := target.Provider.(providers.DefaultModeler); ok && defaulter.DefaultModel() != "" {
+		return defaulter.DefaultModel()
+	}
+	return "unknown"
+}
+
+// recordUsage queues a forwarded request's tokens and cost in the usage
+// store, when one is configured
+func (r *Router) recordUsage(target *RouteTarget, llmReq *llmRequest, usage tokenUsage, estimated bool, cost float64, status string, forwardStart time.Time) {
+	if r.usageStore == nil {
+		return
+	}
+
+	model := target.Model
+	if model == "" {
+		model = llmReq.Model
+	}
+	provider := ""
+	if target.Type == "cluster" {
+		for _, cluster := range r.clusterConfigs() {
+			if cluster.Name == target.Name {
+				provider = cluster.Provider
+				break
+			}
+		}
+	} else {
+		for _, providerConfig := range r.providerConfigs() {
+			if providerConfig.Name == target.Name {
+				provider = providerConfig.Type
+				break
+			}
+		}
+	}
+
+	outcome := "queued"
+	if !r.usageStore.Add(usagestore.Record{
+		Time:             forwardStart,
+		Tenant:           llmReq.Tenant,
+		Target:           target.Name,
+		TargetType:       target.Type,
+		Provider:         provider,
+		Model:            model,
+		Endpoint:         llmReq.Endpoint,
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+		Estimated:        estimated,
+		Cost:             cost,
+		Status:           status,
+		DurationMs:       time.Since(forwardStart).Milliseconds(),
+	}) {
+		outcome = "dropped"
+	}
+	r.metrics.usageRecords.WithLabelValues(outcome).Inc()
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// AdminConfig configures the operator API under /admin
+type AdminConfig struct {
+	Token          string             `yaml:"token"`          // bearer token; admin endpoints are disabled when empty
+	StateDir       string             `yaml:"stateDir"`       // where runtime state survives restarts
+	PrestopTimeout time.Duration      `yaml:"prestopTimeout"` // how long /admin/prestop waits for in-flight requests
+	DebugAddress   string             `yaml:"debugAddress"`   // listen address for pprof and expvar, e.g. 127.0.0.1:6060; empty disables
+	ConfigReload   ConfigReloadConfig `yaml:"configReload"`
+}
+
+// requireAdmin rejects requests without the admin bearer token
+func (r *Router) requireAdmin(next http.Handler) http.Handler {
+	token := r.config.Admin.Token
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		presented := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+		if token == "" || subtle.ConstantTimeCompare([]byte(presented), []byte(token)) != 1 {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// readOnlyGuard rejects state-changing requests while the kill switch holds
+// the router in read-only mode. The kill switch itself stays writable so
+// operators can release it, and draining for a deploy is always allowed.
+func (r *Router) readOnlyGuard(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != http.MethodGet && req.URL.Path != "/admin/killswitch" && req.URL.Path != "/admin/prestop" && r.killSwitch.State().ReadOnly {
+			http.Error(w, "Router is in read-only mode", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"hash/fnv"
+	"math"
+)
+
+// UserAffinityConfig pins requests carrying the OpenAI `user` field to one
+// cluster so a user's conversation keeps hitting the same prompt cache
+type UserAffinityConfig struct {
+	Enabled bool `yaml:"enabled"`
+}
+
+// userAffinityTarget picks a cluster for user by weighted rendezvous hashing.
+// Only the clusters a user was mapped to move when the cluster set changes.
+func (r *Router) userAffinityTarget(user string, targets []*RouteTarget) *RouteTarget {
+	if !r.config.Router.UserAffinity.Enabled || user == "" {
+		return nil
+	}
+
+	var chosen *RouteTarget
+	bestScore := math.Inf(-1)
+	for _, target := range targets {
+		if target.Type != "cluster" {
+			continue
+		}
+
+		h := fnv.New64a()
+		h.Write([]byte(user))
+		h.Write([]byte{0})
+		h.Write([]byte(target.Name))
+		point := (float64(h.Sum64()>>11) + 0.5) / (1 << 53) // uniform in (0,1)
+
+		weight := target.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		score := -weight / math.Log(point)
+		if score > bestScore {
+			bestScore = score
+			chosen = target
+		}
+	}
+	return chosen
+}
@@ -0,0 +1,689 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/providers"
+)
+
+// anthropicErrorTypes are Anthropic's error types by status; other 4xx
+// statuses are invalid_request_error and 5xx api_error
+var anthropicErrorTypes = map[int]string{
+	http.StatusUnauthorized:          "authentication_error",
+	http.StatusPaymentRequired:       "billing_error",
+	http.StatusForbidden:             "permission_error",
+	http.StatusNotFound:              "not_found_error",
+	http.StatusRequestEntityTooLarge: "request_too_large",
+	http.StatusTooManyRequests:       "rate_limit_error",
+	529:                              "overloaded_error",
+}
+
+// anthropicStopReasons are the Messages API's stop_reason by OpenAI
+// finish_reason; anything else ends the turn
+var anthropicStopReasons = map[string]string{
+	"length":         "max_tokens",
+	"tool_calls":     "tool_use",
+	"function_call":  "tool_use",
+	"content_filter": "refusal",
+}
+
+// messagesBodyKey carries a Messages API request's own body to
+// parseLLMRequest, under its chat completion conversion
+type messagesBodyKey struct{}
+
+// messagesRequest is a Messages API request as the client wrote it
+type messagesRequest struct {
+	body      []byte
+	converted []byte // the chat completion it was routed as
+}
+
+// messagesHandler serves Anthropic's Messages API, so clients on the
+// Anthropic SDK only change their base URL. The request is converted to a
+// chat completion and routed like one, to Claude or any other target, and
+// the answer is converted back. Claude targets are sent the request
+// unconverted instead, see nativeMessages.
+func (r *Router) messagesHandler(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeBodyError(w, err, "Failed to read request body")
+		return
+	}
+	req.Body.Close()
+
+	converted, err := convertAnthropicRequest(body)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Invalid request body: %v", err), http.StatusBadRequest)
+		return
+	}
+	req = req.WithContext(context.WithValue(req.Context(), messagesBodyKey{}, body))
+	req.Body = io.NopCloser(bytes.NewReader(converted))
+	req.ContentLength = int64(len(converted))
+
+	var requested struct {
+		Model string `json:"model"`
+	}
+	json.Unmarshal(body, &requested)
+	mw := &messagesWriter{ResponseWriter: w, model: requested.Model}
+	r.handleLLMRequest(mw, req, "/v1/chat/completions")
+	mw.finish()
+}
+
+// nativeMessages returns the forwarder and body that send target llmReq's
+// Messages API request as the client wrote it, with the model routing
+// chose, rather than its conversion. That is only done for providers
+// speaking the Messages API, and not once the router has rewritten the
+// converted request, say by compressing the prompt, or strips the tenant's
+// reasoning, which only reads chat completions. The forwarder is nil when
+// the conversion is sent.
+func (r *Router) nativeMessages(target *RouteTarget, llmReq *llmRequest) (providers.MessagesForwarder, []byte) {
+	native := llmReq.Messages
+	if native == nil || target.Type != "provider" || llmReq.Endpoint != "/v1/chat/completions" ||
+		!bytes.Equal(llmReq.Body, native.converted) || r.stripsReasoning(llmReq.Tenant) {
+		return nil, nil
+	}
+	forwarder, ok := target.Provider.(providers.MessagesForwarder)
+	if !ok {
+		return nil, nil
+	}
+	body := native.body
+	model := target.Model
+	if model == "" {
+		model = llmReq.Model
+	}
+	if model != "" && model != llmReq.RequestedModel {
+		body = withModel(body, model)
+	}
+	return forwarder, body
+}
+
+// anthropicCredentials lets Anthropic SDK clients authenticate with
+// x-api-key, which the router takes as a bearer token, and drops their
+// anthropic-version: Claude targets are sent the version they speak
+func anthropicCredentials(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if key := req.Header.Get("x-api-key"); key != "" {
+			if req.Header.Get("Authorization") == "" {
+				req.Header.Set("Authorization", "Bearer "+key)
+			}
+			req.Header.Del("x-api-key")
+		}
+		req.Header.Del("anthropic-version")
+		next.ServeHTTP(w, req)
+	})
+}
+
+// anthropicErrors rewrites the Messages API's error responses in
+// Anthropic's error schema, as openAIErrors does for /v1
+func anthropicErrors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ew := &errorWriter{ResponseWriter: w, rewrite: anthropicError}
+		next.ServeHTTP(ew, req)
+		ew.finish()
+	})
+}
+
+// anthropicError rewrites an error body as Anthropic's
+// {"type": "error", "error": {"type", "message"}}. Upstream types are kept
+// when they are Anthropic's, as Claude's are.
+func anthropicError(status int, body []byte) []byte {
+	var parsed struct {
+		Error struct {
+			Type    string `json:"type"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.Unmarshal(openAIError(status, body), &parsed)
+
+	errType := anthropicErrorType(status)
+	if isAnthropicErrorType(parsed.Error.Type) {
+		errType = parsed.Error.Type
+	}
+	rewritten, _ := json.Marshal(map[string]interface{}{
+		"type": "error",
+		"error": map[string]interface{}{
+			"type":    errType,
+			"message": parsed.Error.Message,
+		},
+	})
+	return rewritten
+}
+
+func isAnthropicErrorType(errType string) bool {
+	if errType == "invalid_request_error" || errType == "api_error" {
+		return true
+	}
+	for _, known := range anthropicErrorTypes {
+		if errType == known {
+			return true
+		}
+	}
+	return false
+}
+
+func anthropicErrorType(status int) string {
+	if errType, ok := anthropicErrorTypes[status]; ok {
+		return errType
+	}
+	if status >= 500 {
+		return "api_error"
+	}
+	return "invalid_request_error"
+}
+
+// convertAnthropicRequest converts a Messages API request to a chat
+// completions one. thinking is kept: Claude and Gemini take it, and
+// routing reads it as asking for reasoning.
+func convertAnthropicRequest(body []byte) ([]byte, error) {
+	var request map[string]interface{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, err
+	}
+
+	chat := map[string]interface{}{}
+	for _, name := range []string{"model", "max_tokens", "temperature", "top_p", "top_k", "stream", "thinking"} {
+		if value, ok := request[name]; ok {
+			chat[name] = value
+		}
+	}
+	if stop, ok := request["stop_sequences"]; ok {
+		chat["stop"] = stop
+	}
+	if metadata, ok := request["metadata"].(map[string]interface{}); ok {
+		if user, ok := metadata["user_id"].(string); ok {
+			chat["user"] = user
+		}
+	}
+	if stream, _ := request["stream"].(bool); stream {
+		// message_delta reports output tokens
+		chat["stream_options"] = map[string]interface{}{"include_usage": true}
+	}
+
+	var messages []interface{}
+	if system := anthropicText(request["system"]); system != "" {
+		messages = append(messages, map[string]interface{}{"role": "system", "content": system})
+	}
+	raw, _ := request["messages"].([]interface{})
+	for _, item := range raw {
+		if message, ok := item.(map[string]interface{}); ok {
+			messages = append(messages, convertAnthropicMessage(message)...)
+		}
+	}
+	chat["messages"] = messages
+
+	if tools := convertAnthropicTools(request["tools"]); len(tools) > 0 {
+		chat["tools"] = tools
+	}
+	if choice, ok := request["tool_choice"].(map[string]interface{}); ok {
+		switch choice["type"] {
+		case "auto", "none":
+			chat["tool_choice"] = choice["type"]
+		case "any":
+			chat["tool_choice"] = "required"
+		case "tool":
+			chat["tool_choice"] = map[string]interface{}{
+				"type":     "function",
+				"function": map[string]interface{}{"name": choice["name"]},
+			}
+		}
+		if disabled, _ := choice["disable_parallel_tool_use"].(bool); disabled {
+			chat["parallel_tool_calls"] = false
+		}
+	}
+
+	return json.Marshal(chat)
+}
+
+// convertAnthropicMessage converts one message to chat messages: tool
+// results become tool messages, answering the calls of the turn before,
+// and tool_use blocks the assistant's tool_calls. Thinking blocks are
+// Claude's own and aren't sent back.
+func convertAnthropicMessage(message map[string]interface{}) []interface{} {
+	role, _ := message["role"].(string)
+	blocks, ok := message["content"].([]interface{})
+	if !ok {
+		return []interface{}{map[string]interface{}{"role": role, "content": message["content"]}}
+	}
+
+	var converted, parts, toolCalls []interface{}
+	var text strings.Builder
+	images := false
+	for _, item := range blocks {
+		block, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch block["type"] {
+		case "text":
+			s, _ := block["text"].(string)
+			text.WriteString(s)
+			parts = append(parts, map[string]interface{}{"type": "text", "text": s})
+		case "image":
+			if url := anthropicImageURL(block["source"]); url != "" {
+				images = true
+				parts = append(parts, map[string]interface{}{"type": "image_url", "image_url": map[string]interface{}{"url": url}})
+			}
+		case "tool_use":
+			arguments, _ := json.Marshal(block["input"])
+			toolCalls = append(toolCalls, map[string]interface{}{
+				"id":       block["id"],
+				"type":     "function",
+				"function": map[string]interface{}{"name": block["name"], "arguments": string(arguments)},
+			})
+		case "tool_result":
+			converted = append(converted, map[string]interface{}{
+				"role":         "tool",
+				"tool_call_id": block["tool_use_id"],
+				"content":      anthropicText(block["content"]),
+			})
+		}
+	}
+
+	switch {
+	case role == "assistant":
+		reply := map[string]interface{}{"role": role, "content": text.String()}
+		if len(toolCalls) > 0 {
+			reply["tool_calls"] = toolCalls
+			if text.Len() == 0 {
+				reply["content"] = nil
+			}
+		}
+		converted = append(converted, reply)
+	case images:
+		converted = append(converted, map[string]interface{}{"role": role, "content": parts})
+	case len(parts) > 0:
+		converted = append(converted, map[string]interface{}{"role": role, "content": text.String()})
+	}
+	return converted
+}
+
+// anthropicText returns a system prompt or tool result, a string or a list
+// of text blocks, as one string
+func anthropicText(content interface{}) string {
+	switch content := content.(type) {
+	case string:
+		return content
+	case []interface{}:
+		var text strings.Builder
+		for _, item := range content {
+			if block, ok := item.(map[string]interface{}); ok && block["type"] == "text" {
+				s, _ := block["text"].(string)
+				text.WriteString(s)
+			}
+		}
+		return text.String()
+	}
+	return ""
+}
+
+// anthropicImageURL returns an image block's source as an image_url URL,
+// a data URL for base64 sources
+func anthropicImageURL(source interface{}) string {
+	s, _ := source.(map[string]interface{})
+	switch s["type"] {
+	case "base64":
+		mediaType, _ := s["media_type"].(string)
+		data, _ := s["data"].(string)
+		return "data:" + mediaType + ";base64," + data
+	case "url":
+		url, _ := s["url"].(string)
+		return url
+	}
+	return ""
+}
+
+// convertAnthropicTools converts custom tools to functions. Anthropic's
+// server tools, such as web search, only run on Claude and are dropped.
+func convertAnthropicTools(raw interface{}) []interface{} {
+	list, _ := raw.([]interface{})
+	var tools []interface{}
+	for _, item := range list {
+		tool, ok := item.(map[string]interface{})
+		if !ok || tool["input_schema"] == nil {
+			continue
+		}
+		function := map[string]interface{}{"name": tool["name"], "parameters": tool["input_schema"]}
+		if description, ok := tool["description"]; ok {
+			function["description"] = description
+		}
+		tools = append(tools, map[string]interface{}{"type": "function", "function": function})
+	}
+	return tools
+}
+
+// anthropicStopReason returns the stop_reason for a finish_reason
+func anthropicStopReason(finishReason string) string {
+	if reason, ok := anthropicStopReasons[finishReason]; ok {
+		return reason
+	}
+	return "end_turn"
+}
+
+// anthropicMessageID returns a message ID for a chat completion's, made
+// up for upstreams that send none
+func anthropicMessageID(id string) string {
+	if id == "" {
+		return fmt.Sprintf("msg_%d", time.Now().UnixNano())
+	}
+	return "msg_" + strings.TrimPrefix(id, "chatcmpl-")
+}
+
+// convertChatResponse converts a chat completion to a Messages API
+// message, of model if the completion names none. Bodies that aren't chat
+// completions are returned as they are.
+func convertChatResponse(body []byte, model string) []byte {
+	var response struct {
+		ID      string `json:"id"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Message struct {
+				Content          string `json:"content"`
+				ReasoningContent string `json:"reasoning_content"`
+				ToolCalls        []struct {
+					ID       string `json:"id"`
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"message"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if json.Unmarshal(body, &response) != nil || len(response.Choices) == 0 {
+		return body
+	}
+
+	if response.Model == "" {
+		response.Model = model
+	}
+	choice := response.Choices[0]
+	content := []interface{}{}
+	if choice.Message.ReasoningContent != "" {
+		content = append(content, map[string]interface{}{"type": "thinking", "thinking": choice.Message.ReasoningContent, "signature": ""})
+	}
+	if choice.Message.Content != "" {
+		content = append(content, map[string]interface{}{"type": "text", "text": choice.Message.Content})
+	}
+	for _, call := range choice.Message.ToolCalls {
+		input := json.RawMessage(call.Function.Arguments)
+		if !json.Valid(input) {
+			input = json.RawMessage("{}")
+		}
+		content = append(content, map[string]interface{}{"type": "tool_use", "id": call.ID, "name": call.Function.Name, "input": input})
+	}
+
+	message, _ := json.Marshal(map[string]interface{}{
+		"id":            anthropicMessageID(response.ID),
+		"type":          "message",
+		"role":          "assistant",
+		"model":         response.Model,
+		"content":       content,
+		"stop_reason":   anthropicStopReason(choice.FinishReason),
+		"stop_sequence": nil,
+		"usage": map[string]int{
+			"input_tokens":  response.Usage.PromptTokens,
+			"output_tokens": response.Usage.CompletionTokens,
+		},
+	})
+	return message
+}
+
+// messagesWriter converts the chat completions answering a Messages API
+// request back: whole responses once written, streams event by event.
+// Errors pass through to anthropicErrors.
+type messagesWriter struct {
+	http.ResponseWriter
+	model  string // requested, for responses that don't name theirs
+	status int
+	stream *messagesStream // set once a successful stream starts
+	body   bytes.Buffer
+}
+
+func (w *messagesWriter) WriteHeader(status int) {
+	if w.status != 0 {
+		return
+	}
+	w.status = status
+	if status >= 400 {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if strings.HasPrefix(w.Header().Get("Content-Type"), "text/event-stream") {
+		w.Header().Del("Content-Length")
+		w.stream = &messagesStream{w: w.ResponseWriter, model: w.model}
+		w.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (w *messagesWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	switch {
+	case w.status >= 400:
+		return w.ResponseWriter.Write(p)
+	case w.stream != nil:
+		w.stream.write(p)
+		return len(p), nil
+	}
+	return w.body.Write(p)
+}
+
+func (w *messagesWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && w.stream != nil {
+		f.Flush()
+	}
+}
+
+func (w *messagesWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes the held back response, converted, or ends the stream
+func (w *messagesWriter) finish() {
+	switch {
+	case w.status == 0 || w.status >= 400:
+	case w.stream != nil:
+		w.stream.close()
+	default:
+		w.Header().Del("Content-Length")
+		w.Header().Set("Content-Type", "application/json")
+		w.ResponseWriter.WriteHeader(w.status)
+		w.ResponseWriter.Write(convertChatResponse(w.body.Bytes(), w.model))
+	}
+}
+
+// messagesStream converts a chat completions event stream to the Messages
+// API's: message_start, a content block per text, thinking or tool call,
+// then message_delta with the stop reason and usage, and message_stop.
+// Streams already in Anthropic's events, as Claude's are passed on, go
+// through untouched.
+type messagesStream struct {
+	w       io.Writer
+	model   string
+	partial []byte // incomplete line
+	native  bool
+	started bool
+	done    bool
+
+	block        int    // index of the open content block, or of the next
+	blockType    string // type of the open block, empty if none
+	toolIndex    int    // tool call index of the open tool_use block
+	stopReason   string
+	inputTokens  int
+	outputTokens int
+}
+
+func (s *messagesStream) write(p []byte) {
+	if s.native {
+		s.w.Write(p)
+		return
+	}
+	s.partial = append(s.partial, p...)
+	for {
+		i := bytes.IndexByte(s.partial, '\n')
+		if i < 0 {
+			return
+		}
+		line := strings.TrimRight(string(s.partial[:i]), "\r")
+		s.partial = s.partial[i+1:]
+		if strings.HasPrefix(line, "event:") {
+			// Already in Anthropic's events
+			s.native = true
+			s.w.Write([]byte(line + "\n"))
+			s.w.Write(s.partial)
+			s.partial = nil
+			return
+		}
+		s.line(line)
+	}
+}
+
+// line converts one line of the chat completions stream
+func (s *messagesStream) line(line string) {
+	if strings.HasPrefix(line, ":") {
+		fmt.Fprintf(s.w, "%s\n\n", line) // keep-alive comment
+		return
+	}
+	data, ok := strings.CutPrefix(line, "data:")
+	if !ok || s.done {
+		return
+	}
+	data = strings.TrimSpace(data)
+	if data == "[DONE]" {
+		s.close()
+		return
+	}
+
+	var chunk struct {
+		ID      string `json:"id"`
+		Model   string `json:"model"`
+		Choices []struct {
+			Delta struct {
+				Content          string `json:"content"`
+				ReasoningContent string `json:"reasoning_content"`
+				ToolCalls        []struct {
+					Index    int    `json:"index"`
+					ID       string `json:"id"`
+					Function struct {
+						Name      string `json:"name"`
+						Arguments string `json:"arguments"`
+					} `json:"function"`
+				} `json:"tool_calls"`
+			} `json:"delta"`
+			FinishReason string `json:"finish_reason"`
+		} `json:"choices"`
+		Usage *struct {
+			PromptTokens     int `json:"prompt_tokens"`
+			CompletionTokens int `json:"completion_tokens"`
+		} `json:"usage"`
+	}
+	if json.Unmarshal([]byte(data), &chunk) != nil {
+		return
+	}
+	if !s.started {
+		s.started = true
+		if chunk.Model != "" {
+			s.model = chunk.Model
+		}
+		s.event("message_start", map[string]interface{}{
+			"message": map[string]interface{}{
+				"id":            anthropicMessageID(chunk.ID),
+				"type":          "message",
+				"role":          "assistant",
+				"model":         s.model,
+				"content":       []interface{}{},
+				"stop_reason":   nil,
+				"stop_sequence": nil,
+				"usage":         map[string]int{"input_tokens": 0, "output_tokens": 0},
+			},
+		})
+	}
+	if chunk.Usage != nil {
+		s.inputTokens = chunk.Usage.PromptTokens
+		s.outputTokens = chunk.Usage.CompletionTokens
+	}
+	if len(chunk.Choices) == 0 {
+		return
+	}
+
+	choice := chunk.Choices[0]
+	if choice.Delta.ReasoningContent != "" {
+		s.open("thinking", map[string]interface{}{"type": "thinking", "thinking": ""})
+		s.delta(map[string]interface{}{"type": "thinking_delta", "thinking": choice.Delta.ReasoningContent})
+	}
+	if choice.Delta.Content != "" {
+		s.open("text", map[string]interface{}{"type": "text", "text": ""})
+		s.delta(map[string]interface{}{"type": "text_delta", "text": choice.Delta.Content})
+	}
+	for _, call := range choice.Delta.ToolCalls {
+		if s.blockType != "tool_use" || call.Index != s.toolIndex {
+			s.closeBlock() // each call is a block of its own
+			s.toolIndex = call.Index
+			s.open("tool_use", map[string]interface{}{"type": "tool_use", "id": call.ID, "name": call.Function.Name, "input": map[string]interface{}{}})
+		}
+		if call.Function.Arguments != "" {
+			s.delta(map[string]interface{}{"type": "input_json_delta", "partial_json": call.Function.Arguments})
+		}
+	}
+	if choice.FinishReason != "" {
+		s.stopReason = anthropicStopReason(choice.FinishReason)
+	}
+}
+
+// open starts a content block of blockType unless one is open
+func (s *messagesStream) open(blockType string, block map[string]interface{}) {
+	if s.blockType == blockType {
+		return
+	}
+	s.closeBlock()
+	s.blockType = blockType
+	s.event("content_block_start", map[string]interface{}{"index": s.block, "content_block": block})
+}
+
+func (s *messagesStream) delta(delta map[string]interface{}) {
+	s.event("content_block_delta", map[string]interface{}{"index": s.block, "delta": delta})
+}
+
+func (s *messagesStream) closeBlock() {
+	if s.blockType == "" {
+		return
+	}
+	s.event("content_block_stop", map[string]interface{}{"index": s.block})
+	s.blockType = ""
+	s.block++
+}
+
+// close ends the message, once
+func (s *messagesStream) close() {
+	if s.native || s.done || !s.started {
+		return
+	}
+	s.done = true
+	s.closeBlock()
+	if s.stopReason == "" {
+		s.stopReason = "end_turn"
+	}
+	s.event("message_delta", map[string]interface{}{
+		"delta": map[string]interface{}{"stop_reason": s.stopReason, "stop_sequence": nil},
+		"usage": map[string]int{"input_tokens": s.inputTokens, "output_tokens": s.outputTokens},
+	})
+	s.event("message_stop", map[string]interface{}{})
+}
+
+// event writes one server-sent event, typed in both the event name and
+// the data as Anthropic's are
+func (s *messagesStream) event(eventType string, data map[string]interface{}) {
+	data["type"] = eventType
+	encoded, _ := json.Marshal(data)
+	fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", eventType, encoded)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// maxErrorBody caps the error body held back for rewriting
+const maxErrorBody = 64 << 10
+
+// errorTypes are OpenAI's error types by status; other 4xx statuses are
+// invalid_request_error and 5xx server_error
+var errorTypes = map[int]string{
+	http.StatusUnauthorized:    "authentication_error",
+	http.StatusPaymentRequired: "insufficient_quota",
+	http.StatusForbidden:       "permission_error",
+	http.StatusNotFound:        "not_found_error",
+	http.StatusConflict:        "conflict_error",
+	http.StatusTooManyRequests: "rate_limit_error",
+}
+
+// errorCodes are codes for errors that come without one
+var errorCodes = map[int]string{
+	http.StatusPaymentRequired: "insufficient_quota",
+	http.StatusTooManyRequests: "rate_limit_exceeded",
+}
+
+// openAIErrors rewrites the API's error responses in OpenAI's error
+// schema, whoever produced them: the router's plain-text errors, a
+// provider's JSON in its vendor's shape or a cluster engine's. Status and
+// headers such as Retry-After are kept, so SDKs retry as they would
+// against OpenAI.
+func openAIErrors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ew := &errorWriter{ResponseWriter: w, rewrite: openAIError}
+		next.ServeHTTP(ew, req)
+		ew.finish()
+	})
+}
+
+// errorWriter passes successful responses through and holds error
+// responses back until they can be rewritten
+type errorWriter struct {
+	http.ResponseWriter
+	rewrite func(status int, body []byte) []byte
+	status  int // error status held back, 0 if none
+	wrote   bool
+	body    bytes.Buffer
+}
+
+func (w *errorWriter) WriteHeader(status int) {
+	if w.wrote || w.status != 0 {
+		return
+	}
+	if status >= 400 {
+		w.status = status
+		return
+	}
+	w.wrote = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *errorWriter) Write(p []byte) (int, error) {
+	w.WriteHeader(http.StatusOK)
+	if w.status == 0 {
+		return w.ResponseWriter.Write(p)
+	}
+	if room := maxErrorBody - w.body.Len(); room > 0 {
+		if len(p) > room {
+			w.body.Write(p[:room])
+		} else {
+			w.body.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+func (w *errorWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok && w.status == 0 {
+		f.Flush()
+	}
+}
+
+func (w *errorWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// finish writes the held back error, rewritten
+func (w *errorWriter) finish() {
+	if w.status == 0 {
+		return
+	}
+	header := w.Header()
+	header.Set("Content-Type", "application/json")
+	header.Del("Content-Length")
+	header.Del("X-Content-Type-Options")
+	w.ResponseWriter.WriteHeader(w.status)
+	w.ResponseWriter.Write(w.rewrite(w.status, w.body.Bytes()))
+}
+
+// openAIError rewrites an error body as OpenAI's
+// {"error": {"message", "type", "param", "code"}}, keeping whatever of
+// those the body has
+func openAIError(status int, body []byte) []byte {
+	fields := map[string]interface{}{}
+	var parsed map[string]interface{}
+	if json.Unmarshal(body, &parsed) == nil {
+		switch e := parsed["error"].(type) {
+		case map[string]interface{}: // OpenAI, Claude, Gemini
+			fields = e
+		case string: // Ollama, TGI
+			fields["message"] = e
+			if errType, ok := parsed["error_type"].(string); ok {
+				fields["type"] = errType
+			}
+		default:
+			if message, ok := parsed["message"].(string); ok {
+				fields["message"] = message
+			} else if detail, ok := parsed["detail"].(string); ok { // FastAPI
+				fields["message"] = detail
+			}
+		}
+	}
+
+	if message, _ := fields["message"].(string); message == "" {
+		fields["message"] = strings.TrimSpace(string(body))
+		if fields["message"] == "" {
+			fields["message"] = http.StatusText(status)
+		}
+	}
+	if errType, _ := fields["type"].(string); errType == "" {
+		fields["type"] = errorType(status)
+	}
+	if _, ok := fields["code"].(string); !ok {
+		// Gemini puts a number in code and its name in status
+		if name, ok := fields["status"].(string); ok {
+			fields["code"] = strings.ToLower(name)
+		} else if code, ok := errorCodes[status]; ok {
+			fields["code"] = code
+		} else {
+			fields["code"] = nil
+		}
+		delete(fields, "status")
+	}
+	if _, ok := fields["param"]; !ok {
+		fields["param"] = nil
+	}
+
+	rewritten, _ := json.Marshal(map[string]interface{}{"error": fields})
+	return rewritten
+}
+
+func errorType(status int) string {
+	if errType, ok := errorTypes[status]; ok {
+		return errType
+	}
+	if status >= 500 {
+		return "server_error"
+	}
+	return "invalid_request_error"
+}
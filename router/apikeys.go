@@ -0,0 +1,199 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/auth"
+	"github.com/sirupsen/logrus"
+)
+
+const apiKeysFile = "api-keys.json"
+
+// apiKeyStore keeps the API keys issued through the admin API in the state
+// dir, by hash only, so they survive restarts
+type apiKeyStore struct {
+	path string
+	auth *auth.Authenticator
+
+	mu sync.Mutex
+}
+
+// newAPIKeyStore accepts again the keys issued before shutdown
+func newAPIKeyStore(stateDir string, authenticator *auth.Authenticator) *apiKeyStore {
+	s := &apiKeyStore{path: filepath.Join(stateDir, apiKeysFile), auth: authenticator}
+	var stored []auth.APIKeyInfo
+	if err := readStateFile(s.path, &stored); err != nil {
+		logrus.Warnf("Failed to restore API keys: %v", err)
+	}
+	for _, info := range stored {
+		if _, err := authenticator.AddAPIKey(info); err != nil {
+			logrus.Warnf("API key %s (%s) is also in the config file; the config file's tenant applies", info.ID, info.Name)
+		}
+	}
+	return s
+}
+
+// save persists the runtime keys; callers hold s.mu
+func (s *apiKeyStore) save() error {
+	stored := []auth.APIKeyInfo{}
+	for _, info := range s.auth.APIKeys() {
+		if info.Source == "admin" {
+			stored = append(stored, info)
+		}
+	}
+	return writeStateFile(s.path, stored)
+}
+
+// apiKeyRequest creates or updates a key. Key is left out to have one
+// generated.
+type apiKeyRequest struct {
+	Name   string `json:"name"`
+	Tenant string `json:"tenant"`
+	Key    string `json:"key,omitempty"`
+}
+
+// issuedAPIKey is the response to a creation, the only time the key is shown
+type issuedAPIKey struct {
+	auth.APIKeyInfo
+	Key string `json:"key"`
+}
+
+func writeAPIKeyJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// withoutHash keeps key hashes out of admin responses
+func withoutHash(info auth.APIKeyInfo) auth.APIKeyInfo {
+	info.Hash = ""
+	return info
+}
+
+// apiKeysHandler lists the accepted API keys, without the keys themselves
+func (r *Router) apiKeysHandler(w http.ResponseWriter, req *http.Request) {
+	keys := r.auth.APIKeys()
+	for i := range keys {
+		keys[i] = withoutHash(keys[i])
+	}
+	writeAPIKeyJSON(w, http.StatusOK, map[string]interface{}{
+		"enabled": r.config.Auth.APIKeys.Enabled,
+		"keys":    keys,
+	})
+}
+
+// createAPIKeyHandler issues a key for a tenant, or registers one the
+// caller supplies
+func (r *Router) createAPIKeyHandler(w http.ResponseWriter, req *http.Request) {
+	var body apiKeyRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 64<<10)).Decode(&body); err != nil {
+		http.Error(w, "Invalid API key request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Tenant == "" {
+		http.Error(w, "tenant is required", http.StatusBadRequest)
+		return
+	}
+	if body.Name == "" {
+		body.Name = body.Tenant
+	}
+	if body.Key == "" {
+		body.Key = auth.GenerateAPIKey()
+	} else if len(body.Key) < 16 {
+		http.Error(w, "key must be at least 16 characters", http.StatusBadRequest)
+		return
+	}
+
+	r.apiKeys.mu.Lock()
+	defer r.apiKeys.mu.Unlock()
+	now := time.Now().UTC()
+	info, err := r.auth.AddAPIKey(auth.APIKeyInfo{
+		Name:      body.Name,
+		Tenant:    body.Tenant,
+		CreatedAt: &now,
+		Hash:      auth.HashAPIKey(body.Key),
+	})
+	if errors.Is(err, auth.ErrAPIKeyExists) {
+		http.Error(w, "API key already exists", http.StatusConflict)
+		return
+	}
+	if err := r.apiKeys.save(); err != nil {
+		r.auth.RemoveAPIKey(info.ID)
+		logrus.Errorf("Failed to persist API key %s: %v", info.ID, err)
+		http.Error(w, "Failed to persist API key", http.StatusInternalServerError)
+		return
+	}
+
+	logrus.Infof("Issued API key %s (%s) for tenant %s", info.ID, info.Name, info.Tenant)
+	if !r.config.Auth.APIKeys.Enabled {
+		logrus.Warnf("API key %s will not be accepted until auth.apiKeys.enabled is set", info.ID)
+	}
+	writeAPIKeyJSON(w, http.StatusCreated, issuedAPIKey{APIKeyInfo: withoutHash(info), Key: body.Key})
+}
+
+// updateAPIKeyHandler renames a runtime key or moves it to another tenant
+func (r *Router) updateAPIKeyHandler(w http.ResponseWriter, req *http.Request) {
+	var body apiKeyRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 64<<10)).Decode(&body); err != nil {
+		http.Error(w, "Invalid API key request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if body.Key != "" {
+		http.Error(w, "a key cannot be changed; issue a new one and delete this one", http.StatusBadRequest)
+		return
+	}
+
+	id := mux.Vars(req)["id"]
+	r.apiKeys.mu.Lock()
+	defer r.apiKeys.mu.Unlock()
+	info, found, err := r.auth.UpdateAPIKey(id, body.Name, body.Tenant)
+	if !r.apiKeyFound(w, id, found, err) {
+		return
+	}
+	if err := r.apiKeys.save(); err != nil {
+		logrus.Errorf("Failed to persist API key %s: %v", id, err)
+		http.Error(w, "Failed to persist API key", http.StatusInternalServerError)
+		return
+	}
+
+	logrus.Infof("Updated API key %s (%s), tenant %s", info.ID, info.Name, info.Tenant)
+	writeAPIKeyJSON(w, http.StatusOK, withoutHash(info))
+}
+
+// deleteAPIKeyHandler revokes a runtime key
+func (r *Router) deleteAPIKeyHandler(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+	r.apiKeys.mu.Lock()
+	defer r.apiKeys.mu.Unlock()
+	found, err := r.auth.RemoveAPIKey(id)
+	if !r.apiKeyFound(w, id, found, err) {
+		return
+	}
+	if err := r.apiKeys.save(); err != nil {
+		logrus.Errorf("Failed to persist revocation of API key %s: %v", id, err)
+		http.Error(w, "Failed to persist API key revocation", http.StatusInternalServerError)
+		return
+	}
+
+	logrus.Warnf("Revoked API key %s", id)
+	writeAPIKeyJSON(w, http.StatusOK, map[string]string{"id": id, "status": "revoked"})
+}
+
+func (r *Router) apiKeyFound(w http.ResponseWriter, id string, found bool, err error) bool {
+	switch {
+	case !found:
+		http.Error(w, "Unknown API key "+id, http.StatusNotFound)
+		return false
+	case errors.Is(err, auth.ErrAPIKeyFromConfig):
+		http.Error(w, "API key "+id+" is defined in the config file; change it there", http.StatusConflict)
+		return false
+	}
+	return true
+}
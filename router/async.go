@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// callbackHeader makes a request asynchronous: the router answers 202 and
+	// POSTs the OpenAI-format result to this URL when it completes
+	callbackHeader  = "X-LLM-Router-Callback-URL"
+	jobIDHeader     = "X-LLM-Router-Job-ID"
+	jobStatusHeader = "X-LLM-Router-Status-Code"
+)
+
+// acceptAsync queues llmReq for background execution and delivers the
+// result to callbackURL
+func (r *Router) acceptAsync(w http.ResponseWriter, req *http.Request, llmReq *llmRequest, callbackURL string) {
+	if err := r.webhooks.ValidateURL(callbackURL); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if llmReq.Stream {
+		http.Error(w, "Streaming is not supported for async requests", http.StatusBadRequest)
+		return
+	}
+	select {
+	case r.asyncSlots <- struct{}{}:
+	default:
+		w.Header().Set("Retry-After", "1")
+		http.Error(w, "Too many async requests in flight, retry shortly", http.StatusServiceUnavailable)
+		return
+	}
+
+	idBytes := make([]byte, 8)
+	rand.Read(idBytes)
+	jobID := "job-" + hex.EncodeToString(idBytes)
+
+	// The job outlives the client connection but keeps its request ID
+	requestID := requestIDFrom(req.Context())
+	jobCtx, cancel := context.WithTimeout(withRequestID(context.Background(), requestID), r.webhooks.JobTimeout())
+	jobReq := req.Clone(jobCtx)
+	jobReq.Header.Del(callbackHeader)
+
+	// Jobs outlive their request, so they hold the drain open themselves
+	done := r.drain.begin()
+	go func() {
+		defer done()
+		defer cancel()
+		defer func() { <-r.asyncSlots }()
+
+		buf := newResponseBuffer()
+		r.serveLLMRequest(buf, jobReq, llmReq, time.Now())
+
+		status := buf.StatusCode()
+		if status == 0 {
+			status = http.StatusBadGateway
+		}
+		headers := map[string]string{
+			jobIDHeader:     jobID,
+			jobStatusHeader: strconv.Itoa(status),
+			requestIDHeader: requestID,
+		}
+		if err := r.webhooks.Deliver(callbackURL, headers, buf.Bytes()); err != nil {
+			logrus.WithContext(jobCtx).Errorf("Async job %s: %v", jobID, err)
+			r.metrics.webhookDeliveries.WithLabelValues("failed").Inc()
+			return
+		}
+		r.metrics.webhookDeliveries.WithLabelValues("delivered").Inc()
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set(jobIDHeader, jobID)
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"id":           jobID,
+		"object":       "router.async_job",
+		"status":       "accepted",
+		"callback_url": callbackURL,
+	})
+}
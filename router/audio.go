@@ -0,0 +1,248 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	transcriptionsEndpoint = "/v1/audio/transcriptions"
+	speechEndpoint         = "/v1/audio/speech"
+)
+
+// audioEndpoints are OpenAI's Whisper and TTS endpoints. Clusters only get
+// them when they list them under endpoints.
+var audioEndpoints = map[string]bool{
+	transcriptionsEndpoint: true,
+	speechEndpoint:         true,
+}
+
+// apiEndpoints are the endpoints a cluster may list and explain routes
+var apiEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+	transcriptionsEndpoint: true,
+	speechEndpoint:         true,
+}
+
+// speechCharsPerMinute turns text to be spoken into minutes, at about 150
+// words a minute
+const speechCharsPerMinute = 900
+
+// defaultAudioBytesPerSecond sizes uploads whose header doesn't give their
+// length, at 128 kbps as most compressed speech is
+const defaultAudioBytesPerSecond = 16000
+
+// audioRequest is what routing and the cost model know of an audio request
+type audioRequest struct {
+	Seconds  float64 // audio to transcribe, or estimated to be spoken
+	Boundary string  // multipart boundary of a transcription upload
+}
+
+// Minutes returns the audio length the request is priced by
+func (a *audioRequest) Minutes() float64 {
+	return a.Seconds / 60
+}
+
+func (r *Router) transcriptionsHandler(w http.ResponseWriter, req *http.Request) {
+	r.handleLLMRequest(w, req, transcriptionsEndpoint)
+}
+
+func (r *Router) speechHandler(w http.ResponseWriter, req *http.Request) {
+	r.handleLLMRequest(w, req, speechEndpoint)
+}
+
+// parseAudioRequest reads an audio request's length, and for transcription
+// uploads the form fields routing needs, which aren't JSON
+func parseAudioRequest(req *http.Request, llmReq *llmRequest) {
+	audio := &audioRequest{}
+	llmReq.Audio = audio
+
+	if llmReq.Endpoint == speechEndpoint {
+		var fields struct {
+			Input string `json:"input"`
+		}
+		json.Unmarshal(llmReq.Body, &fields)
+		audio.Seconds = float64(utf8.RuneCountInString(fields.Input)) / speechCharsPerMinute * 60
+		return
+	}
+
+	mediaType, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/form-data" || params["boundary"] == "" {
+		return
+	}
+	audio.Boundary = params["boundary"]
+	form := multipart.NewReader(bytes.NewReader(llmReq.Body), audio.Boundary)
+	for {
+		part, err := form.NextPart()
+		if err != nil {
+			return
+		}
+		value, _ := io.ReadAll(part)
+		switch part.FormName() {
+		case "model":
+			llmReq.Model = string(value)
+			llmReq.RequestedModel = llmReq.Model
+		case "stream":
+			llmReq.Stream = string(value) == "true"
+		case "file":
+			audio.Seconds = audioSeconds(value)
+		}
+	}
+}
+
+// audioSeconds returns how long an upload plays: exactly for WAV and FLAC,
+// whose headers say, and by size for compressed formats
+func audioSeconds(data []byte) float64 {
+	switch {
+	case len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		// Chunks follow the header; fmt gives the byte rate, data the size
+		byteRate := uint32(0)
+		for chunk := data[12:]; len(chunk) >= 8; {
+			id, size := string(chunk[:4]), binary.LittleEndian.Uint32(chunk[4:8])
+			body := chunk[8:]
+			switch {
+			case id == "fmt " && len(body) >= 12:
+				byteRate = binary.LittleEndian.Uint32(body[8:12])
+			case id == "data" && byteRate > 0:
+				// Streamed WAVs leave the size unset
+				if size == 0 || size == 0xffffffff || int64(size) > int64(len(body)) {
+					size = uint32(len(body))
+				}
+				return float64(size) / float64(byteRate)
+			}
+			if int64(size)+int64(size&1) >= int64(len(body)) {
+				break
+			}
+			chunk = body[size+size&1:]
+		}
+	case len(data) >= 26 && string(data[:4]) == "fLaC":
+		// STREAMINFO is the first metadata block, after its 4-byte header
+		info := data[8:]
+		sampleRate := uint64(info[10])<<12 | uint64(info[11])<<4 | uint64(info[12])>>4
+		samples := uint64(info[13]&0x0f)<<32 | uint64(binary.BigEndian.Uint32(info[14:18]))
+		if sampleRate > 0 && samples > 0 {
+			return float64(samples) / float64(sampleRate)
+		}
+	}
+	return float64(len(data)) / defaultAudioBytesPerSecond
+}
+
+// rewriteFormModel returns a multipart body with its model field set to
+// model, keeping the boundary so the request's Content-Type still holds
+func rewriteFormModel(body []byte, boundary, model string) ([]byte, error) {
+	var out bytes.Buffer
+	writer := multipart.NewWriter(&out)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return nil, err
+	}
+	form := multipart.NewReader(bytes.NewReader(body), boundary)
+	wroteModel := false
+	for {
+		part, err := form.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		header := make(textproto.MIMEHeader, len(part.Header))
+		for name, values := range part.Header {
+			header[name] = values
+		}
+		dest, err := writer.CreatePart(header)
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() == "model" {
+			io.WriteString(dest, model)
+			wroteModel = true
+		} else if _, err := io.Copy(dest, part); err != nil {
+			return nil, err
+		}
+	}
+	if !wroteModel {
+		writer.WriteField("model", model)
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// clusterServes reports whether a cluster listing endpoints serves
+// endpoint. Clusters listing none serve the LLM endpoints but not audio.
+func clusterServes(endpoints []string, endpoint string) bool {
+	if len(endpoints) == 0 {
+		return !audioEndpoints[endpoint]
+	}
+	for _, served := range endpoints {
+		if strings.TrimSuffix(served, "/") == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// audioPrice returns target's price per minute of audio for model. Clusters
+// are charged the compute time of a minute, taking no longer than the audio
+// plays; providers by their pricing table, if it has a per-minute price.
+func (r *Router) audioPrice(target *RouteTarget, model string) (float64, bool) {
+	if target.Type == "cluster" {
+		return r.costEngine.ComputeCost(target.Name, time.Minute), true
+	}
+	if target.Provider == nil {
+		return 0, false
+	}
+	pricing, ok := target.Provider.GetModelPricing()[model]
+	return pricing.PricePerMinute, ok && pricing.PricePerMinute > 0
+}
+
+// priceAudio costs audio requests' targets by the minute instead of the
+// token, so cost routing compares what the audio costs on each. Targets
+// without a per-minute price rank behind every priced one.
+func (r *Router) priceAudio(targets []*RouteTarget, llmReq *llmRequest) {
+	if llmReq.Audio == nil {
+		return
+	}
+	highest := 0.0
+	var unpriced []*RouteTarget
+	for _, target := range targets {
+		model := target.Model
+		if model == "" {
+			model = llmReq.Model
+		}
+		price, ok := r.audioPrice(target, model)
+		if !ok {
+			unpriced = append(unpriced, target)
+			continue
+		}
+		target.Cost = price
+		highest = max(highest, price)
+	}
+	if len(unpriced) < len(targets) {
+		for _, target := range unpriced {
+			target.Cost = highest * 2
+		}
+	}
+}
+
+// audioCost prices an audio request served by a provider, 0 if its model
+// has no per-minute price
+func (r *Router) audioCost(target *RouteTarget, model string, llmReq *llmRequest) float64 {
+	if target.Type != "provider" {
+		return 0
+	}
+	price, _ := r.audioPrice(target, model)
+	return price * llmReq.Audio.Minutes()
+}
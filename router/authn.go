@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/auth"
+	"github.com/sirupsen/logrus"
+)
+
+// TLSConfig serves the router over TLS. With a client CA, presented client
+// certificates are verified so auth.mtls can attribute callers; requests
+// without one are still accepted at the TLS layer for /health and /metrics.
+type TLSConfig struct {
+	CertFile     string `yaml:"certFile"`
+	KeyFile      string `yaml:"keyFile"`
+	ClientCAFile string `yaml:"clientCAFile"`
+}
+
+func serverTLSConfig(config TLSConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if config.ClientCAFile == "" {
+		return tlsConfig, nil
+	}
+
+	pem, err := os.ReadFile(config.ClientCAFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client CA: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", config.ClientCAFile)
+	}
+	tlsConfig.ClientCAs = pool
+	tlsConfig.ClientAuth = tls.VerifyClientCertIfGiven
+	return tlsConfig, nil
+}
+
+// authenticate resolves /v1 callers to tenants when auth is configured, and
+// demo sessions to the demo tenant whether or not it is. A consumed bearer
+// token or API key is removed so it is never forwarded upstream.
+func (r *Router) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id, err := r.demoIdentity(req)
+		if err != nil {
+			r.metrics.demoRequests.WithLabelValues("expired").Inc()
+			w.Header().Set("WWW-Authenticate", `Bearer realm="llm-router", error="invalid_token", error_description="demo session expired"`)
+			http.Error(w, "Demo session expired; refresh it or sign in again", http.StatusUnauthorized)
+			return
+		}
+		if id != nil {
+			if !r.admitDemo(w, id) {
+				return
+			}
+			req.Header.Del("Authorization")
+			r.metrics.demoRequests.WithLabelValues("admitted").Inc()
+			r.metrics.tenantRequests.WithLabelValues(id.Tenant, id.Method).Inc()
+			next.ServeHTTP(w, req.WithContext(auth.WithIdentity(req.Context(), id)))
+			return
+		}
+		if !r.auth.Enabled() {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		id, err = r.auth.Authenticate(req)
+		if err != nil {
+			challenge := `Bearer realm="llm-router"`
+			if !errors.Is(err, auth.ErrNoCredentials) {
+				challenge += `, error="invalid_token"`
+				logrus.Debugf("Rejected credentials from %s: %v", req.RemoteAddr, err)
+			}
+			w.Header().Set("WWW-Authenticate", challenge)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		req.Header.Del("Authorization")
+		req.Header.Del("X-API-Key")
+		r.metrics.tenantRequests.WithLabelValues(id.Tenant, id.Method).Inc()
+		next.ServeHTTP(w, req.WithContext(auth.WithIdentity(req.Context(), id)))
+	})
+}
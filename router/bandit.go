@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// banditStateFile keeps the bandit strategy's learned rewards in stateDir
+const banditStateFile = "bandit.json"
+
+// selectByBandit picks a target by Thompson sampling over the rewards
+// observed for each, so targets that look worse are still tried now and
+// then in case they have improved
+func (r *Router) selectByBandit(targets []*RouteTarget) *RouteTarget {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	names := make([]string, len(targets))
+	for i, target := range targets {
+		names[i] = target.Name
+	}
+	chosen := targets[r.bandit.Choose(names, r.strategies.Get().Bandit.ErrorPenalty)]
+
+	chosen.Reason = "bandit"
+	return chosen
+}
+
+// learnReward feeds a finished request to the bandit whatever the strategy,
+// so switching to it starts from what traffic has already shown. Streams
+// are left out as their duration says more about the response length than
+// the target, and demo traffic as it shouldn't steer production routing.
+func (r *Router) learnReward(target *RouteTarget, llmReq *llmRequest, ok bool, forwardStart time.Time, cost float64) {
+	if llmReq.Stream || llmReq.Demo {
+		return
+	}
+	config := r.strategies.Get().Bandit
+	reward := -(cost + config.LatencyWeight*time.Since(forwardStart).Seconds())
+	if !ok {
+		reward -= config.ErrorPenalty
+	}
+	r.bandit.Observe(target.Name, reward, config.Discount)
+}
+
+// banditHandler reports the reward learned for each target
+func (r *Router) banditHandler(w http.ResponseWriter, req *http.Request) {
+	config := r.strategies.Get().Bandit
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"active":  r.policy.get().RoutingStrategy == "bandit",
+		"config":  config,
+		"targets": r.bandit.Estimates(config.ErrorPenalty),
+	})
+}
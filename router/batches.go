@@ -0,0 +1,665 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/auth"
+	"github.com/sirupsen/logrus"
+)
+
+// BatchConfig runs OpenAI-style batches: JSONL files of requests uploaded
+// to /v1/files, run in the background by POST /v1/batches at the batch
+// priority through the cheapest targets, with results to download once
+// done. Uploads are bounded by server.maxRequestBytes, and what each
+// tenant keeps by maxFiles and maxFileBytes.
+type BatchConfig struct {
+	Concurrency     int           `yaml:"concurrency"`     // requests of all batches in flight at once, default 4
+	RoutingStrategy string        `yaml:"routingStrategy"` // strategy routing batch requests, default cost
+	MaxRequests     int           `yaml:"maxRequests"`     // requests per batch, default 50000
+	Retention       time.Duration `yaml:"retention"`       // files and finished batches are deleted this long after, default 720h
+	MaxFiles        int           `yaml:"maxFiles"`        // files a tenant keeps, batch results included, default 100
+	MaxFileBytes    int64         `yaml:"maxFileBytes"`    // bytes of them, default 1GiB
+}
+
+// errFileLimit is returned for an upload that would take its tenant past
+// router.batches.maxFiles or maxFileBytes
+var errFileLimit = errors.New("file storage limit reached")
+
+// batchEndpoints are the endpoints batch requests may go to
+var batchEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+}
+
+// Batch statuses, as OpenAI's
+const (
+	batchValidating = "validating"
+	batchFailed     = "failed"
+	batchInProgress = "in_progress"
+	batchFinalizing = "finalizing"
+	batchCompleted  = "completed"
+	batchExpired    = "expired"
+	batchCancelling = "cancelling"
+	batchCancelled  = "cancelled"
+)
+
+// batchFile is an uploaded input file or a batch's output or error file
+type batchFile struct {
+	ID        string `json:"id"`
+	Object    string `json:"object"`
+	Bytes     int64  `json:"bytes"`
+	CreatedAt int64  `json:"created_at"`
+	Filename  string `json:"filename"`
+	Purpose   string `json:"purpose"` // batch, batch_output
+}
+
+// batchObject is a batch as the API shows it
+type batchObject struct {
+	ID               string            `json:"id"`
+	Object           string            `json:"object"`
+	Endpoint         string            `json:"endpoint"`
+	Errors           *batchErrors      `json:"errors"`
+	InputFileID      string            `json:"input_file_id"`
+	CompletionWindow string            `json:"completion_window"`
+	Status           string            `json:"status"`
+	OutputFileID     string            `json:"output_file_id,omitempty"`
+	ErrorFileID      string            `json:"error_file_id,omitempty"`
+	CreatedAt        int64             `json:"created_at"`
+	InProgressAt     int64             `json:"in_progress_at,omitempty"`
+	ExpiresAt        int64             `json:"expires_at"`
+	FinalizingAt     int64             `json:"finalizing_at,omitempty"`
+	CompletedAt      int64             `json:"completed_at,omitempty"`
+	FailedAt         int64             `json:"failed_at,omitempty"`
+	ExpiredAt        int64             `json:"expired_at,omitempty"`
+	CancellingAt     int64             `json:"cancelling_at,omitempty"`
+	CancelledAt      int64             `json:"cancelled_at,omitempty"`
+	RequestCounts    batchCounts       `json:"request_counts"`
+	Metadata         map[string]string `json:"metadata,omitempty"`
+}
+
+type batchCounts struct {
+	Total     int `json:"total"`
+	Completed int `json:"completed"`
+	Failed    int `json:"failed"`
+}
+
+// batchErrors lists why a batch failed validation
+type batchErrors struct {
+	Object string       `json:"object"`
+	Data   []batchError `json:"data"`
+}
+
+type batchError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Line    int    `json:"line,omitempty"`
+}
+
+// storedFile and storedBatch are what batchStore persists: the API object
+// and who may see it
+type storedFile struct {
+	batchFile
+	Tenant string `json:"tenant,omitempty"`
+}
+
+type storedBatch struct {
+	batchObject
+	Identity *auth.Identity `json:"identity,omitempty"` // creator, whose tenant the requests are charged to
+	Output   string         `json:"output"`             // result file IDs, allocated once the batch starts
+	Failures string         `json:"failures"`
+}
+
+// finished reports whether the batch has reached a final status
+func (b *storedBatch) finished() bool {
+	switch b.Status {
+	case batchFailed, batchCompleted, batchExpired, batchCancelled:
+		return true
+	}
+	return false
+}
+
+// endedAt returns when a finished batch ended
+func (b *storedBatch) endedAt() int64 {
+	for _, at := range []int64{b.CompletedAt, b.FailedAt, b.ExpiredAt, b.CancelledAt} {
+		if at != 0 {
+			return at
+		}
+	}
+	return b.CreatedAt
+}
+
+// batchStore keeps batch files, batches and their results under
+// stateDir/batches, so batches survive a restart and resume where they
+// were
+type batchStore struct {
+	dir      string
+	wake     chan struct{} // nudges the dispatcher when a batch is created or cancelled
+	maxFiles int           // per tenant, see BatchConfig
+	maxBytes int64
+
+	mu      sync.Mutex
+	files   map[string]*storedFile
+	batches map[string]*storedBatch
+	running map[string]bool // batches a runner is working on
+	dirty   bool            // request counts changed since the index was saved
+}
+
+// batchIndex is the persisted index of files and batches
+type batchIndex struct {
+	Files   map[string]*storedFile  `json:"files"`
+	Batches map[string]*storedBatch `json:"batches"`
+}
+
+func newBatchStore(stateDir string, config BatchConfig) *batchStore {
+	s := &batchStore{
+		dir:      filepath.Join(stateDir, "batches"),
+		wake:     make(chan struct{}, 1),
+		maxFiles: config.MaxFiles,
+		maxBytes: config.MaxFileBytes,
+		files:    make(map[string]*storedFile),
+		batches:  make(map[string]*storedBatch),
+		running:  make(map[string]bool),
+	}
+	index := batchIndex{Files: s.files, Batches: s.batches}
+	if err := readStateFile(s.indexPath(), &index); err != nil {
+		logrus.Warnf("Failed to read batches: %v", err)
+	}
+	if index.Files != nil {
+		s.files = index.Files
+	}
+	if index.Batches != nil {
+		s.batches = index.Batches
+	}
+	return s
+}
+
+func (s *batchStore) indexPath() string {
+	return filepath.Join(s.dir, "index.json")
+}
+
+// contentPath is where a file's content is kept
+func (s *batchStore) contentPath(id string) string {
+	return filepath.Join(s.dir, id+".jsonl")
+}
+
+func (s *batchStore) saveLocked() {
+	s.dirty = false
+	if err := writeStateFile(s.indexPath(), batchIndex{Files: s.files, Batches: s.batches}); err != nil {
+		logrus.Warnf("Failed to persist batches: %v", err)
+	}
+}
+
+// nudge wakes the dispatcher without waiting for it
+func (s *batchStore) nudge() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// addFile stores an uploaded file, within the tenant's limits
+func (s *batchStore) addFile(tenant, filename, purpose string, content io.Reader) (batchFile, error) {
+	s.mu.Lock()
+	room, err := s.roomLocked(tenant, 0)
+	s.mu.Unlock()
+	if err != nil {
+		return batchFile{}, err
+	}
+
+	file := batchFile{
+		ID:        randomID("file-"),
+		Object:    "file",
+		CreatedAt: time.Now().Unix(),
+		Filename:  filename,
+		Purpose:   purpose,
+	}
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return file, fmt.Errorf("failed to create batch dir: %w", err)
+	}
+	out, err := os.OpenFile(s.contentPath(file.ID), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return file, err
+	}
+	// A byte past the room left is enough to know the file doesn't fit
+	file.Bytes, err = io.Copy(out, io.LimitReader(content, room+1))
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(s.contentPath(file.ID))
+		return file, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// Checked again, as other uploads may have been stored meanwhile
+	if _, err := s.roomLocked(tenant, file.Bytes); err != nil {
+		os.Remove(s.contentPath(file.ID))
+		return batchFile{}, err
+	}
+	s.files[file.ID] = &storedFile{batchFile: file, Tenant: tenant}
+	s.saveLocked()
+	return file, nil
+}
+
+// roomLocked returns the bytes tenant may still store, or errFileLimit if
+// another file of size won't fit; callers hold s.mu
+func (s *batchStore) roomLocked(tenant string, size int64) (int64, error) {
+	files, used := 0, int64(0)
+	for _, file := range s.files {
+		if file.Tenant == tenant {
+			files++
+			used += file.Bytes
+		}
+	}
+	if files >= s.maxFiles {
+		return 0, fmt.Errorf("%w: %d files are kept, the most allowed; delete some first", errFileLimit, files)
+	}
+	if used+size > s.maxBytes {
+		return 0, fmt.Errorf("%w: files may take at most %d bytes; delete some first", errFileLimit, s.maxBytes)
+	}
+	return s.maxBytes - used - size, nil
+}
+
+// file returns a tenant's file
+func (s *batchStore) file(tenant, id string) (batchFile, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[id]
+	if !ok || file.Tenant != tenant {
+		return batchFile{}, false
+	}
+	return file.batchFile, true
+}
+
+// listFiles returns a tenant's files, newest first
+func (s *batchStore) listFiles(tenant string) []batchFile {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files := []batchFile{}
+	for _, file := range s.files {
+		if file.Tenant == tenant {
+			files = append(files, file.batchFile)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].CreatedAt != files[j].CreatedAt {
+			return files[i].CreatedAt > files[j].CreatedAt
+		}
+		return files[i].ID > files[j].ID
+	})
+	return files
+}
+
+// deleteFile removes a tenant's file unless an unfinished batch reads it,
+// naming that batch
+func (s *batchStore) deleteFile(tenant, id string) (found bool, usedBy string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	file, ok := s.files[id]
+	if !ok || file.Tenant != tenant {
+		return false, ""
+	}
+	for _, batch := range s.batches {
+		if batch.InputFileID == id && !batch.finished() {
+			return true, batch.ID
+		}
+	}
+	s.removeFileLocked(id)
+	s.saveLocked()
+	return true, ""
+}
+
+func (s *batchStore) removeFileLocked(id string) {
+	delete(s.files, id)
+	if err := os.Remove(s.contentPath(id)); err != nil && !os.IsNotExist(err) {
+		logrus.Warnf("Failed to delete batch file %s: %v", id, err)
+	}
+}
+
+// addBatch creates a batch, to be validated and run by the dispatcher
+func (s *batchStore) addBatch(id *auth.Identity, inputFileID, endpoint, window string, metadata map[string]string) batchObject {
+	duration, _ := time.ParseDuration(window)
+	now := time.Now()
+	batch := &storedBatch{
+		batchObject: batchObject{
+			ID:               randomID("batch_"),
+			Object:           "batch",
+			Endpoint:         endpoint,
+			InputFileID:      inputFileID,
+			CompletionWindow: window,
+			Status:           batchValidating,
+			CreatedAt:        now.Unix(),
+			ExpiresAt:        now.Add(duration).Unix(),
+			Metadata:         metadata,
+		},
+		Identity: id,
+	}
+
+	s.mu.Lock()
+	s.batches[batch.ID] = batch
+	s.saveLocked()
+	s.mu.Unlock()
+	s.nudge()
+	return batch.batchObject
+}
+
+// batch returns a tenant's batch
+func (s *batchStore) batch(tenant, id string) (batchObject, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, ok := s.batches[id]
+	if !ok || batchTenant(batch) != tenant {
+		return batchObject{}, false
+	}
+	return batch.batchObject, true
+}
+
+// listBatches returns a tenant's batches, newest first
+func (s *batchStore) listBatches(tenant string) []batchObject {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batches := []batchObject{}
+	for _, batch := range s.batches {
+		if batchTenant(batch) == tenant {
+			batches = append(batches, batch.batchObject)
+		}
+	}
+	sort.Slice(batches, func(i, j int) bool {
+		if batches[i].CreatedAt != batches[j].CreatedAt {
+			return batches[i].CreatedAt > batches[j].CreatedAt
+		}
+		return batches[i].ID > batches[j].ID
+	})
+	return batches
+}
+
+// cancel moves an unfinished batch to cancelling; its runner cancels it
+// once the requests in flight are done
+func (s *batchStore) cancel(tenant, id string) (batchObject, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, ok := s.batches[id]
+	if !ok || batchTenant(batch) != tenant {
+		return batchObject{}, false, nil
+	}
+	if batch.finished() {
+		return batch.batchObject, true, fmt.Errorf("batch %s is already %s", id, batch.Status)
+	}
+	if batch.Status != batchCancelling {
+		batch.Status = batchCancelling
+		batch.CancellingAt = time.Now().Unix()
+		s.saveLocked()
+	}
+	s.nudge()
+	return batch.batchObject, true, nil
+}
+
+// sweep deletes finished batches and files older than retention, except
+// files an unfinished batch reads, and saves request counts
+func (s *batchStore) sweep(retention time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	cutoff := time.Now().Add(-retention).Unix()
+	changed := s.dirty
+	inUse := make(map[string]bool)
+	for id, batch := range s.batches {
+		switch {
+		case !batch.finished():
+			inUse[batch.InputFileID] = true
+		case batch.endedAt() < cutoff:
+			delete(s.batches, id)
+			changed = true
+		}
+	}
+	for id, file := range s.files {
+		if file.CreatedAt < cutoff && !inUse[id] {
+			s.removeFileLocked(id)
+			changed = true
+		}
+	}
+	if changed {
+		s.saveLocked()
+	}
+}
+
+func batchTenant(batch *storedBatch) string {
+	if batch.Identity == nil {
+		return ""
+	}
+	return batch.Identity.Tenant
+}
+
+func randomID(prefix string) string {
+	idBytes := make([]byte, 12)
+	rand.Read(idBytes)
+	return prefix + hex.EncodeToString(idBytes)
+}
+
+// requestTenant returns the authenticated tenant, empty for anonymous
+// callers
+func requestTenant(req *http.Request) string {
+	if id := auth.FromContext(req.Context()); id != nil {
+		return id.Tenant
+	}
+	return ""
+}
+
+// requireTenant refuses callers without a tenant, anonymous ones included,
+// from endpoints scoped to the caller's tenant: they would all share one,
+// seeing each other's batch files, or see every tenant's spend in a
+// report. Demo sessions are refused too, since every visitor shares the
+// demo tenant. Operators get the whole reports under /admin.
+func requireTenant(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if id := auth.FromContext(req.Context()); id == nil || id.Tenant == "" || id.Method == "demo" {
+			http.Error(w, "Only available to callers authenticated as a tenant", http.StatusForbidden)
+			return
+		}
+		next(w, req)
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// uploadFileHandler stores a JSONL file of batch requests, uploaded as
+// multipart form data with purpose=batch
+func (r *Router) uploadFileHandler(w http.ResponseWriter, req *http.Request) {
+	if err := req.ParseMultipartForm(32 << 20); err != nil {
+		writeBodyError(w, err, "Request must be multipart form data with a file")
+		return
+	}
+	defer req.MultipartForm.RemoveAll()
+	if purpose := req.FormValue("purpose"); purpose != "batch" {
+		http.Error(w, fmt.Sprintf("Unsupported purpose %q: files are only stored for batch", purpose), http.StatusBadRequest)
+		return
+	}
+	content, header, err := req.FormFile("file")
+	if err != nil {
+		http.Error(w, "Missing file", http.StatusBadRequest)
+		return
+	}
+	defer content.Close()
+
+	file, err := r.batches.addFile(requestTenant(req), header.Filename, "batch", content)
+	if errors.Is(err, errFileLimit) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if err != nil {
+		logrus.Errorf("Failed to store batch file: %v", err)
+		http.Error(w, "Failed to store file", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, file)
+}
+
+func (r *Router) listFilesHandler(w http.ResponseWriter, req *http.Request) {
+	writeJSON(w, map[string]interface{}{"object": "list", "data": r.batches.listFiles(requestTenant(req))})
+}
+
+func (r *Router) fileHandler(w http.ResponseWriter, req *http.Request) {
+	file, ok := r.batches.file(requestTenant(req), mux.Vars(req)["id"])
+	if !ok {
+		http.Error(w, "No such file", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, file)
+}
+
+// fileContentHandler downloads a file, such as a batch's results
+func (r *Router) fileContentHandler(w http.ResponseWriter, req *http.Request) {
+	file, ok := r.batches.file(requestTenant(req), mux.Vars(req)["id"])
+	if !ok {
+		http.Error(w, "No such file", http.StatusNotFound)
+		return
+	}
+	content, err := os.Open(r.batches.contentPath(file.ID))
+	if err != nil {
+		logrus.Errorf("Failed to read batch file %s: %v", file.ID, err)
+		http.Error(w, "Failed to read file", http.StatusInternalServerError)
+		return
+	}
+	defer content.Close()
+	w.Header().Set("Content-Type", "application/jsonl")
+	w.Header().Set("Content-Length", strconv.FormatInt(file.Bytes, 10))
+	io.Copy(w, content)
+}
+
+func (r *Router) deleteFileHandler(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+	found, usedBy := r.batches.deleteFile(requestTenant(req), id)
+	if !found {
+		http.Error(w, "No such file", http.StatusNotFound)
+		return
+	}
+	if usedBy != "" {
+		http.Error(w, fmt.Sprintf("File %s is the input of batch %s, which hasn't finished", id, usedBy), http.StatusConflict)
+		return
+	}
+	writeJSON(w, map[string]interface{}{"id": id, "object": "file", "deleted": true})
+}
+
+// createBatchHandler starts a batch over an uploaded file. Its requests
+// are checked before any is sent; a batch with invalid lines fails whole.
+func (r *Router) createBatchHandler(w http.ResponseWriter, req *http.Request) {
+	var body struct {
+		InputFileID      string            `json:"input_file_id"`
+		Endpoint         string            `json:"endpoint"`
+		CompletionWindow string            `json:"completion_window"`
+		Metadata         map[string]string `json:"metadata"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		writeBodyError(w, err, "Request body must be a JSON batch")
+		return
+	}
+	if !batchEndpoints[body.Endpoint] {
+		http.Error(w, fmt.Sprintf("Unsupported endpoint %q: batches run /v1/chat/completions, /v1/completions or /v1/embeddings", body.Endpoint), http.StatusBadRequest)
+		return
+	}
+	if window, err := time.ParseDuration(body.CompletionWindow); err != nil || window <= 0 {
+		http.Error(w, fmt.Sprintf("Invalid completion_window %q: it must be a duration such as 24h", body.CompletionWindow), http.StatusBadRequest)
+		return
+	}
+	file, ok := r.batches.file(requestTenant(req), body.InputFileID)
+	if !ok || file.Purpose != "batch" {
+		http.Error(w, fmt.Sprintf("No batch input file %s", body.InputFileID), http.StatusNotFound)
+		return
+	}
+
+	writeJSON(w, r.batches.addBatch(auth.FromContext(req.Context()), file.ID, body.Endpoint, body.CompletionWindow, body.Metadata))
+}
+
+// listBatchesHandler pages through a tenant's batches, newest first, by
+// ?limit (default 20, at most 100) and ?after, a batch ID
+func (r *Router) listBatchesHandler(w http.ResponseWriter, req *http.Request) {
+	limit := 20
+	if raw := req.URL.Query().Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 1 || n > 100 {
+			http.Error(w, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+	batches := r.batches.listBatches(requestTenant(req))
+	if after := req.URL.Query().Get("after"); after != "" {
+		for i, batch := range batches {
+			if batch.ID == after {
+				batches = batches[i+1:]
+				break
+			}
+		}
+	}
+	hasMore := len(batches) > limit
+	if hasMore {
+		batches = batches[:limit]
+	}
+
+	page := map[string]interface{}{"object": "list", "data": batches, "has_more": hasMore}
+	if len(batches) > 0 {
+		page["first_id"] = batches[0].ID
+		page["last_id"] = batches[len(batches)-1].ID
+	}
+	writeJSON(w, page)
+}
+
+func (r *Router) batchHandler(w http.ResponseWriter, req *http.Request) {
+	batch, ok := r.batches.batch(requestTenant(req), mux.Vars(req)["id"])
+	if !ok {
+		http.Error(w, "No such batch", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, batch)
+}
+
+// cancelBatchHandler cancels a batch. Requests in flight finish and their
+// results are kept; the rest are never sent.
+func (r *Router) cancelBatchHandler(w http.ResponseWriter, req *http.Request) {
+	batch, ok, err := r.batches.cancel(requestTenant(req), mux.Vars(req)["id"])
+	if !ok {
+		http.Error(w, "No such batch", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	writeJSON(w, batch)
+}
+
+// readBatchLines reads a JSONL file line by line, lines up to limit bytes
+func readBatchLines(path string, limit int, line func(n int, text []byte) bool) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 64<<10), limit)
+	for n := 1; scanner.Scan(); n++ {
+		if text := bytes.TrimSpace(scanner.Bytes()); len(text) > 0 && !line(n, text) {
+			break
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,492 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/auth"
+	"github.com/sirupsen/logrus"
+)
+
+// batchPollInterval is how often the dispatcher looks for batches to run
+// when nothing wakes it sooner
+const batchPollInterval = 5 * time.Second
+
+// maxBatchAttempts bounds how often a request shed with 429 or 503 is sent
+const maxBatchAttempts = 5
+
+// maxBatchLine caps one line of a batch input file
+const maxBatchLine = 32 << 20
+
+// maxBatchErrors caps the validation errors reported for a failed batch
+const maxBatchErrors = 100
+
+type batchContextKey struct{}
+
+// isBatchRequest reports whether ctx is a request of a batch
+func isBatchRequest(ctx context.Context) bool {
+	batch, _ := ctx.Value(batchContextKey{}).(bool)
+	return batch
+}
+
+// batchLine is one request of a batch input file
+type batchLine struct {
+	CustomID string          `json:"custom_id"`
+	Method   string          `json:"method"`
+	URL      string          `json:"url"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// batchResult is one line of a batch's output or error file
+type batchResult struct {
+	ID       string         `json:"id"`
+	CustomID string         `json:"custom_id"`
+	Response *batchResponse `json:"response"`
+	Error    *batchError    `json:"error"`
+}
+
+type batchResponse struct {
+	StatusCode int             `json:"status_code"`
+	RequestID  string          `json:"request_id"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// processBatches is the batch dispatcher: it starts a runner for each
+// batch that isn't finished or already running, including those a restart
+// interrupted, and deletes what retention has run out for
+func (r *Router) processBatches(ctx context.Context, beat func()) {
+	ticker := time.NewTicker(batchPollInterval)
+	defer ticker.Stop()
+
+	for {
+		if !r.drain.draining.Load() {
+			for _, id := range r.batches.claim() {
+				go r.runBatch(ctx, id)
+			}
+		}
+		r.batches.sweep(r.config.Router.Batches.Retention)
+		beat()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-r.batches.wake:
+		}
+	}
+}
+
+// runBatch validates a batch's input, then sends the requests that have no
+// result yet, router.batches.concurrency at a time across batches. It
+// stops when the batch is cancelled or expires, and leaves the batch
+// in_progress for the next runner when the router drains.
+func (r *Router) runBatch(ctx context.Context, id string) {
+	defer r.batches.release(id)
+	job, ok := r.batches.snapshot(id)
+	if !ok {
+		return
+	}
+	log := logrus.WithField("batch", id)
+
+	lines, errs := r.readBatchInput(job)
+	if job.Output == "" {
+		// Not started yet: a batch runs only if all of its input is valid
+		switch {
+		case job.Status == batchCancelling:
+			r.finishBatch(id, batchCancelled)
+			return
+		case len(errs) > 0:
+			log.Infof("Batch failed validation: %s", errs[0].Message)
+			r.batches.update(id, func(b *storedBatch) {
+				b.Status = batchFailed
+				b.FailedAt = time.Now().Unix()
+				b.Errors = &batchErrors{Object: "list", Data: errs}
+			})
+			return
+		case !r.batches.start(id, len(lines)):
+			r.finishBatch(id, batchCancelled)
+			return
+		}
+		job, _ = r.batches.snapshot(id)
+	} else if len(errs) > 0 {
+		// The input was valid when the batch started; it can only be gone
+		log.Errorf("Batch input %s unreadable: %s", job.InputFileID, errs[0].Message)
+		r.finishBatch(id, batchFailed)
+		return
+	}
+
+	done, err := r.batches.resultIDs(job)
+	if err != nil {
+		log.Errorf("Failed to read batch results: %v", err)
+		return
+	}
+	output, err := os.OpenFile(r.batches.contentPath(job.Output), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		log.Errorf("Failed to open batch output: %v", err)
+		return
+	}
+	defer output.Close()
+	failures, err := os.OpenFile(r.batches.contentPath(job.Failures), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		log.Errorf("Failed to open batch errors: %v", err)
+		return
+	}
+	defer failures.Close()
+
+	var mu sync.Mutex
+	record := func(result batchResult, failed bool) {
+		line, _ := json.Marshal(result)
+		mu.Lock()
+		defer mu.Unlock()
+		file := output
+		if failed {
+			file = failures
+		}
+		if _, err := file.Write(append(line, '\n')); err != nil {
+			log.Errorf("Failed to write batch result %s: %v", result.CustomID, err)
+			return
+		}
+		done[result.CustomID] = true
+		r.batches.count(id, failed)
+	}
+
+	var wg sync.WaitGroup
+	final := batchCompleted
+	expires := time.Unix(job.ExpiresAt, 0)
+send:
+	for _, line := range lines {
+		mu.Lock()
+		sent := done[line.CustomID]
+		mu.Unlock()
+		if sent {
+			continue
+		}
+		switch {
+		case ctx.Err() != nil || r.drain.draining.Load():
+			final = ""
+		case r.batches.cancelling(id):
+			final = batchCancelled
+		case time.Now().After(expires):
+			final = batchExpired
+		}
+		if final != batchCompleted {
+			break send
+		}
+
+		select {
+		case r.batchSlots <- struct{}{}:
+		case <-ctx.Done():
+			final = ""
+			break send
+		}
+		wg.Add(1)
+		go func(line batchLine) {
+			defer wg.Done()
+			result, failed := r.sendBatchRequest(ctx, job, line)
+			<-r.batchSlots
+			// A request cut short by shutdown is resent by the next runner
+			if ctx.Err() == nil {
+				record(result, failed)
+			}
+		}(line)
+	}
+	wg.Wait()
+
+	switch final {
+	case "":
+		return
+	case batchExpired:
+		for _, line := range lines {
+			if !done[line.CustomID] {
+				record(batchResult{
+					ID:       randomID("batch_req_"),
+					CustomID: line.CustomID,
+					Error:    &batchError{Code: "batch_expired", Message: "This request could not be executed before the completion window expired."},
+				}, true)
+			}
+		}
+	case batchCompleted:
+		r.batches.update(id, func(b *storedBatch) {
+			b.Status = batchFinalizing
+			b.FinalizingAt = time.Now().Unix()
+		})
+	}
+	r.finishBatch(id, final)
+}
+
+// finishBatch gives a batch its final status and publishes its result
+// files
+func (r *Router) finishBatch(id, status string) {
+	r.batches.finish(id, status)
+	logrus.WithField("batch", id).Infof("Batch %s", status)
+}
+
+// readBatchInput reads a batch's requests, or why the batch can't run
+func (r *Router) readBatchInput(job *storedBatch) ([]batchLine, []batchError) {
+	var lines []batchLine
+	var errs []batchError
+	fail := func(n int, code, format string, args ...interface{}) bool {
+		errs = append(errs, batchError{Code: code, Message: fmt.Sprintf(format, args...), Line: n})
+		return len(errs) < maxBatchErrors
+	}
+
+	seen := make(map[string]bool)
+	limit := r.config.Router.Batches.MaxRequests
+	err := readBatchLines(r.batches.contentPath(job.InputFileID), maxBatchLine, func(n int, text []byte) bool {
+		var line batchLine
+		if err := json.Unmarshal(text, &line); err != nil {
+			return fail(n, "invalid_json_line", "Line %d is not a JSON request: %v", n, err)
+		}
+		var body map[string]interface{}
+		switch {
+		case line.CustomID == "":
+			return fail(n, "missing_custom_id", "Line %d has no custom_id", n)
+		case seen[line.CustomID]:
+			return fail(n, "duplicate_custom_id", "Line %d repeats custom_id %q", n, line.CustomID)
+		case line.Method != http.MethodPost:
+			return fail(n, "invalid_method", "Line %d has method %q; batch requests are POST", n, line.Method)
+		case line.URL != job.Endpoint:
+			return fail(n, "mismatched_endpoint", "Line %d is for %q, not the batch's endpoint %s", n, line.URL, job.Endpoint)
+		case json.Unmarshal(line.Body, &body) != nil || body == nil:
+			return fail(n, "invalid_body", "Line %d has no JSON object body", n)
+		case body["stream"] == true:
+			return fail(n, "invalid_body", "Line %d asks for a stream, which batches can't return", n)
+		case len(lines) == limit:
+			return fail(n, "too_many_requests", "Batches hold at most %d requests", limit)
+		}
+		seen[line.CustomID] = true
+		lines = append(lines, line)
+		return true
+	})
+	if err != nil {
+		errs = append(errs, batchError{Code: "invalid_file", Message: fmt.Sprintf("Failed to read input file: %v", err)})
+	}
+	if len(lines) == 0 && len(errs) == 0 {
+		errs = append(errs, batchError{Code: "empty_file", Message: "The input file has no requests"})
+	}
+	return lines, errs
+}
+
+// sendBatchRequest runs one request through the API as its creator would
+// send it at the batch priority, retrying while the router sheds it
+func (r *Router) sendBatchRequest(ctx context.Context, job *storedBatch, line batchLine) (batchResult, bool) {
+	handler := openAIErrors(r.limitConcurrency(func(w http.ResponseWriter, req *http.Request) {
+		r.handleLLMRequest(w, req, job.Endpoint)
+	}))
+
+	requestID := newRequestID()
+	reqCtx := context.WithValue(withRequestID(ctx, requestID), batchContextKey{}, true)
+	if job.Identity != nil {
+		reqCtx = auth.WithIdentity(reqCtx, job.Identity)
+	}
+
+	var buf *responseBuffer
+	for attempt := 1; ; attempt++ {
+		req, _ := http.NewRequestWithContext(reqCtx, http.MethodPost, job.Endpoint, bytes.NewReader(line.Body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(priorityHeader, "batch")
+		buf = newResponseBuffer()
+		handler.ServeHTTP(buf, req)
+
+		status := buf.StatusCode()
+		if status != http.StatusTooManyRequests && status != http.StatusServiceUnavailable || attempt == maxBatchAttempts {
+			break
+		}
+		wait := time.Duration(1<<attempt) * time.Second
+		if seconds, err := strconv.Atoi(buf.Header().Get("Retry-After")); err == nil && time.Duration(seconds)*time.Second > wait {
+			wait = time.Duration(seconds) * time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return batchResult{}, true
+		case <-time.After(wait):
+		}
+	}
+
+	status := buf.StatusCode()
+	if status == 0 {
+		status = http.StatusBadGateway
+	}
+	body := json.RawMessage(buf.Bytes())
+	if !json.Valid(body) {
+		body, _ = json.Marshal(string(buf.Bytes()))
+	}
+	return batchResult{
+		ID:       randomID("batch_req_"),
+		CustomID: line.CustomID,
+		Response: &batchResponse{StatusCode: status, RequestID: requestID, Body: body},
+	}, status >= 400
+}
+
+// claim marks the batches that need a runner as running and returns them
+func (s *batchStore) claim() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ids []string
+	for id, batch := range s.batches {
+		if !batch.finished() && !s.running[id] {
+			s.running[id] = true
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// release ends a runner's claim
+func (s *batchStore) release(id string) {
+	s.mu.Lock()
+	delete(s.running, id)
+	s.mu.Unlock()
+}
+
+// snapshot returns a copy of a batch
+func (s *batchStore) snapshot(id string) (*storedBatch, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, ok := s.batches[id]
+	if !ok {
+		return nil, false
+	}
+	copied := *batch
+	return &copied, true
+}
+
+// update changes a batch and saves the index
+func (s *batchStore) update(id string, change func(*storedBatch)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if batch, ok := s.batches[id]; ok {
+		change(batch)
+		s.saveLocked()
+	}
+}
+
+// start moves a validated batch to in_progress and allocates its result
+// files, unless it was cancelled while validating
+func (s *batchStore) start(id string, total int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, ok := s.batches[id]
+	if !ok || batch.Status != batchValidating {
+		return false
+	}
+	batch.Status = batchInProgress
+	batch.InProgressAt = time.Now().Unix()
+	batch.RequestCounts = batchCounts{Total: total}
+	batch.Output = randomID("file-")
+	batch.Failures = randomID("file-")
+	s.saveLocked()
+	return true
+}
+
+func (s *batchStore) cancelling(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, ok := s.batches[id]
+	return !ok || batch.Status == batchCancelling
+}
+
+// count records a request's result; counts are saved by the next sweep
+func (s *batchStore) count(id string, failed bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if batch, ok := s.batches[id]; ok {
+		if failed {
+			batch.RequestCounts.Failed++
+		} else {
+			batch.RequestCounts.Completed++
+		}
+		s.dirty = true
+	}
+}
+
+// resultIDs returns the custom_ids a batch has results for and corrects
+// its counts to them, so a resumed batch carries on where it stopped
+func (s *batchStore) resultIDs(job *storedBatch) (map[string]bool, error) {
+	done := make(map[string]bool)
+	counts := make([]int, 2)
+	for i, file := range []string{job.Output, job.Failures} {
+		err := readBatchLines(s.contentPath(file), maxBatchLine, func(n int, text []byte) bool {
+			var result batchResult
+			if json.Unmarshal(text, &result) == nil {
+				done[result.CustomID] = true
+				counts[i]++
+			}
+			return true
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if batch, ok := s.batches[job.ID]; ok {
+		batch.RequestCounts.Completed, batch.RequestCounts.Failed = counts[0], counts[1]
+	}
+	return done, nil
+}
+
+// finish gives a batch its final status, publishing its output and error
+// files if they have results
+func (s *batchStore) finish(id, status string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	batch, ok := s.batches[id]
+	if !ok {
+		return
+	}
+	now := time.Now().Unix()
+	batch.Status = status
+	switch status {
+	case batchCompleted:
+		batch.CompletedAt = now
+	case batchFailed:
+		batch.FailedAt = now
+	case batchExpired:
+		batch.ExpiredAt = now
+	case batchCancelled:
+		batch.CancelledAt = now
+	}
+
+	publish := func(fileID, name string) string {
+		if fileID == "" {
+			return ""
+		}
+		info, err := os.Stat(s.contentPath(fileID))
+		if err != nil || info.Size() == 0 {
+			os.Remove(s.contentPath(fileID))
+			return ""
+		}
+		s.files[fileID] = &storedFile{
+			batchFile: batchFile{
+				ID:        fileID,
+				Object:    "file",
+				Bytes:     info.Size(),
+				CreatedAt: now,
+				Filename:  fmt.Sprintf("%s_%s.jsonl", id, name),
+				Purpose:   "batch_output",
+			},
+			Tenant: batchTenant(batch),
+		}
+		return fileID
+	}
+	batch.OutputFileID = publish(batch.Output, "output")
+	batch.ErrorFileID = publish(batch.Failures, "error")
+	s.saveLocked()
+}
+
+// flush saves the index before shutdown
+func (s *batchStore) flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dirty = false
+	return writeStateFile(s.indexPath(), batchIndex{Files: s.files, Batches: s.batches})
+}
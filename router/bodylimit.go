@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// uploadPaths take audio uploads, bounded by server.maxUploadBytes instead
+var uploadPaths = map[string]bool{
+	"/v1/audio/transcriptions": true,
+}
+
+// filesPath takes batch input files, bounded by router.batches.maxFileBytes,
+// the most a tenant may store
+const filesPath = "/v1/files"
+
+// limitRequestBodies caps every request body at server.maxRequestBytes, or
+// server.maxUploadBytes for uploads and router.batches.maxFileBytes for
+// files. Bodies declared larger are refused before any of them is read;
+// others fail with *http.MaxBytesError once they cross the limit.
+func (r *Router) limitRequestBodies(next http.Handler) http.Handler {
+	server := r.config.Server
+	files := r.config.Router.Batches.MaxFileBytes
+	if server.MaxRequestBytes <= 0 && server.MaxUploadBytes <= 0 && files <= 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		limit := server.MaxRequestBytes
+		if uploadPaths[req.URL.Path] {
+			limit = server.MaxUploadBytes
+		} else if req.URL.Path == filesPath {
+			limit = files
+		}
+		if limit <= 0 {
+			next.ServeHTTP(w, req)
+			return
+		}
+		if req.ContentLength > limit {
+			refuseBody(w, req, limit)
+			return
+		}
+		req.Body = http.MaxBytesReader(w, req.Body, limit)
+		next.ServeHTTP(w, req)
+	})
+}
+
+// refuseBody answers a body declared over the limit. It is refused before
+// the API's routes are reached, so the error is put in their schema here.
+func refuseBody(w http.ResponseWriter, req *http.Request, limit int64) {
+	var refuse http.Handler = http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		writeBodyTooLarge(w, limit)
+	})
+	switch {
+	case strings.HasPrefix(req.URL.Path, "/v1/"):
+		refuse = openAIErrors(refuse)
+	case strings.HasPrefix(req.URL.Path, "/anthropic/v1/"):
+		refuse = anthropicErrors(refuse)
+	}
+	refuse.ServeHTTP(w, req)
+}
+
+// writeBodyError answers a failed body read: 413 when the body was over
+// the limit, otherwise 400 with message. It returns the status written.
+func writeBodyError(w http.ResponseWriter, err error, message string) int {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeBodyTooLarge(w, tooLarge.Limit)
+		return http.StatusRequestEntityTooLarge
+	}
+	http.Error(w, message, http.StatusBadRequest)
+	return http.StatusBadRequest
+}
+
+func writeBodyTooLarge(w http.ResponseWriter, limit int64) {
+	// The rest of the body is never read, so the connection can't be reused
+	w.Header().Set("Connection", "close")
+	http.Error(w, fmt.Sprintf("Request body exceeds the %d byte limit", limit), http.StatusRequestEntityTooLarge)
+}
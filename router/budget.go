@@ -0,0 +1,91 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/budget"
+	"github.com/sirupsen/logrus"
+)
+
+// externalSpendFile keeps external spend in stateDir across restarts
+const externalSpendFile = "external-spend.json"
+
+// BudgetAlertConfig announces when external spend crosses fractions of
+// monthlyAPIBudget. Alerts are always logged, and POSTed (signed like
+// async callbacks) when a webhook URL is set.
+type BudgetAlertConfig struct {
+	WebhookURL string    `yaml:"webhookURL"`
+	Thresholds []float64 `yaml:"thresholds"` // fractions of the budget, default [1.0]
+}
+
+// recordExternalSpend charges a provider response's usage to the monthly
+// budget and returns its cost. Demo traffic is priced but not charged.
+func (r *Router) recordExternalSpend(target *RouteTarget, llmReq *llmRequest, usage tokenUsage) float64 {
+	model := target.Model
+	if model == "" {
+		model = llmReq.Model
+	}
+	cost := usageCost(target, model, usage)
+	if llmReq.Audio != nil {
+		cost = r.audioCost(target, model, llmReq)
+	}
+	if cost == 0 {
+		return 0
+	}
+	if llmReq.Demo {
+		return cost
+	}
+	crossed := r.budget.Record(cost)
+	if len(crossed) == 0 {
+		return cost
+	}
+
+	// Save now so a crash doesn't repeat the alert
+	status := r.budget.Status()
+	if err := writeStateFile(filepath.Join(r.config.Admin.StateDir, externalSpendFile), r.budget.State()); err != nil {
+		logrus.Warnf("Failed to persist external spend: %v", err)
+	}
+	for _, threshold := range crossed {
+		go r.sendBudgetAlert(threshold, status)
+	}
+	return cost
+}
+
+// sendBudgetAlert reports a crossed threshold. The text field lets chat
+// incoming webhooks display it as is.
+func (r *Router) sendBudgetAlert(threshold float64, status budget.Status) {
+	text := fmt.Sprintf("External spend of $%.2f has reached %.0f%% of the $%.2f monthly budget for %s",
+		status.MonthSpend, threshold*100, status.MonthlyBudget, status.Month)
+	if status.Exhausted {
+		text += "; external providers are no longer routed to"
+	}
+	logrus.Warn(text)
+
+	url := r.config.Router.BudgetAlerts.WebhookURL
+	if url == "" {
+		return
+	}
+	body, _ := json.Marshal(map[string]interface{}{
+		"event":              "external_budget.threshold",
+		"text":               text,
+		"threshold":          threshold,
+		"month":              status.Month,
+		"month_spend_usd":    status.MonthSpend,
+		"monthly_budget_usd": status.MonthlyBudget,
+		"exhausted":          status.Exhausted,
+		"timestamp":          time.Now().Format(time.RFC3339),
+	})
+	if err := r.webhooks.Notify(url, nil, body); err != nil {
+		logrus.Errorf("Budget alert: %v", err)
+	}
+}
+
+// budgetHandler reports month-to-date external spend and budget pacing
+func (r *Router) budgetHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.budget.Status())
+}
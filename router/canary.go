@@ -0,0 +1,256 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// CanaryConfig sends a share of traffic to a new target and rolls it back
+// automatically when its error rate exceeds a threshold
+type CanaryConfig struct {
+	Enabled      bool    `yaml:"enabled"`
+	Target       string  `yaml:"target"`       // cluster or provider under test
+	Baseline     string  `yaml:"baseline"`     // target compared against, default every other target
+	Percent      float64 `yaml:"percent"`      // share of eligible requests sent to the canary
+	MinRequests  int     `yaml:"minRequests"`  // canary requests before rollback is considered, default 20
+	MaxErrorRate float64 `yaml:"maxErrorRate"` // canary error rate that triggers rollback, default 0.05
+}
+
+// CohortStats summarises one side of the comparison
+type CohortStats struct {
+	Requests      int     `json:"requests"`
+	Errors        int     `json:"errors"`
+	ErrorRate     float64 `json:"error_rate"`
+	MeanLatencyMs float64 `json:"mean_latency_ms"`
+}
+
+type cohort struct {
+	requests  int
+	errors    int
+	latencyMs float64 // sum over successful requests
+}
+
+func (c cohort) stats() CohortStats {
+	stats := CohortStats{Requests: c.requests, Errors: c.errors}
+	if c.requests > 0 {
+		stats.ErrorRate = float64(c.errors) / float64(c.requests)
+	}
+	if ok := c.requests - c.errors; ok > 0 {
+		stats.MeanLatencyMs = c.latencyMs / float64(ok)
+	}
+	return stats
+}
+
+// canaryRollback is the persisted rollback, so a restart doesn't resume a
+// canary that already failed
+type canaryRollback struct {
+	Target string    `json:"target"`
+	Reason string    `json:"reason"`
+	At     time.Time `json:"at"`
+}
+
+// CanaryStatus reports the canary and its comparison with the baseline
+type CanaryStatus struct {
+	Target     string          `json:"target"`
+	Baseline   string          `json:"baseline,omitempty"`
+	Percent    float64         `json:"percent"`
+	State      string          `json:"state"` // "active" or "rolled_back"
+	Canary     CohortStats     `json:"canary"`
+	Comparison CohortStats     `json:"baseline_stats"`
+	RolledBack *canaryRollback `json:"rolled_back,omitempty"`
+}
+
+type canary struct {
+	config   CanaryConfig
+	path     string
+	onRecord func(group, status string)
+
+	mu         sync.Mutex
+	canary     cohort
+	baseline   cohort
+	rolledBack *canaryRollback
+}
+
+func newCanary(config CanaryConfig, stateDir string, onRecord func(group, status string)) *canary {
+	c := &canary{config: config, path: filepath.Join(stateDir, "canary.json"), onRecord: onRecord}
+	if !config.Enabled {
+		return c
+	}
+
+	var rollback canaryRollback
+	if err := readStateFile(c.path, &rollback); err != nil {
+		logrus.Warnf("Failed to read canary state: %v", err)
+	}
+	if rollback.Target == config.Target {
+		c.rolledBack = &rollback
+		logrus.Warnf("Canary %s stays rolled back since %s: %s", rollback.Target, rollback.At.Format(time.RFC3339), rollback.Reason)
+	}
+	return c
+}
+
+func (c *canary) active() bool {
+	return c.config.Enabled && c.rolledBack == nil
+}
+
+// split decides whether a request goes to the canary: it returns just the
+// canary, or the targets without it. Rolled back canaries only get traffic
+// nothing else can serve.
+func (c *canary) split(targets []*RouteTarget) []*RouteTarget {
+	if !c.config.Enabled {
+		return targets
+	}
+	c.mu.Lock()
+	active := c.active()
+	c.mu.Unlock()
+
+	var canaryTarget *RouteTarget
+	others := make([]*RouteTarget, 0, len(targets))
+	for _, target := range targets {
+		if target.Name == c.config.Target {
+			canaryTarget = target
+		} else {
+			others = append(others, target)
+		}
+	}
+	if canaryTarget != nil && active && rand.Float64()*100 < c.config.Percent {
+		return []*RouteTarget{canaryTarget}
+	}
+	if len(others) == 0 && canaryTarget != nil {
+		// Never fail a request the canary could serve
+		return []*RouteTarget{canaryTarget}
+	}
+	return others
+}
+
+// record counts a forwarded request's outcome for the canary or baseline
+// and rolls the canary back once its error rate is over the threshold
+func (c *canary) record(target string, success bool, latency time.Duration) {
+	if !c.config.Enabled {
+		return
+	}
+	var name string
+	switch {
+	case target == c.config.Target:
+		name = "canary"
+	case c.config.Baseline == "" || target == c.config.Baseline:
+		name = "baseline"
+	default:
+		return
+	}
+
+	status := "success"
+	if !success {
+		status = "error"
+	}
+	c.onRecord(name, status)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts := &c.baseline
+	if name == "canary" {
+		counts = &c.canary
+	}
+	counts.requests++
+	if success {
+		counts.latencyMs += float64(latency.Milliseconds())
+	} else {
+		counts.errors++
+	}
+
+	if name != "canary" || !c.active() || c.canary.requests < c.config.MinRequests {
+		return
+	}
+	stats, base := c.canary.stats(), c.baseline.stats()
+	if stats.ErrorRate <= c.config.MaxErrorRate {
+		return
+	}
+	c.rollback(fmt.Sprintf("error rate %.1f%% over %d requests exceeds %.1f%% (baseline %.1f%%)",
+		stats.ErrorRate*100, stats.Requests, c.config.MaxErrorRate*100, base.ErrorRate*100))
+}
+
+// rollback stops canary traffic (lock must be held)
+func (c *canary) rollback(reason string) {
+	c.rolledBack = &canaryRollback{Target: c.config.Target, Reason: reason, At: time.Now()}
+	if err := writeStateFile(c.path, c.rolledBack); err != nil {
+		logrus.Errorf("Failed to persist canary rollback: %v", err)
+	}
+	logrus.Warnf("Canary %s rolled back: %s", c.config.Target, reason)
+}
+
+// resume clears a rollback and starts a fresh comparison
+func (c *canary) resume() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := writeStateFile(c.path, canaryRollback{}); err != nil {
+		return err
+	}
+	c.rolledBack = nil
+	c.canary, c.baseline = cohort{}, cohort{}
+	logrus.Infof("Canary %s resumed at %.1f%%", c.config.Target, c.config.Percent)
+	return nil
+}
+
+func (c *canary) status() CanaryStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	status := CanaryStatus{
+		Target:     c.config.Target,
+		Baseline:   c.config.Baseline,
+		Percent:    c.config.Percent,
+		State:      "active",
+		Canary:     c.canary.stats(),
+		Comparison: c.baseline.stats(),
+		RolledBack: c.rolledBack,
+	}
+	if c.rolledBack != nil {
+		status.State = "rolled_back"
+	}
+	return status
+}
+
+// canaryHandler reports the canary comparison
+func (r *Router) canaryHandler(w http.ResponseWriter, req *http.Request) {
+	if !r.config.Router.Canary.Enabled {
+		http.Error(w, "No canary configured", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.canary.status())
+}
+
+// resumeCanaryHandler clears a rollback and restarts the comparison
+func (r *Router) resumeCanaryHandler(w http.ResponseWriter, req *http.Request) {
+	if !r.config.Router.Canary.Enabled {
+		http.Error(w, "No canary configured", http.StatusNotFound)
+		return
+	}
+	if err := r.canary.resume(); err != nil {
+		http.Error(w, fmt.Sprintf("Failed to resume canary: %v", err), http.StatusInternalServerError)
+		return
+	}
+	r.canaryHandler(w, req)
+}
+
+// rollbackCanaryHandler rolls the canary back by hand
+func (r *Router) rollbackCanaryHandler(w http.ResponseWriter, req *http.Request) {
+	if !r.config.Router.Canary.Enabled {
+		http.Error(w, "No canary configured", http.StatusNotFound)
+		return
+	}
+	r.canary.mu.Lock()
+	if r.canary.rolledBack == nil {
+		r.canary.rollback("rolled back by operator")
+	}
+	r.canary.mu.Unlock()
+	r.canaryHandler(w, req)
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/capability"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+// capabilityStore keeps probed capability records by target, persisted so
+// a restart doesn't probe every target again
+type capabilityStore struct {
+	path string
+
+	mu      sync.Mutex
+	records map[string]*capability.Record
+	probing map[string]bool
+}
+
+func newCapabilityStore(stateDir string, enabled bool) *capabilityStore {
+	s := &capabilityStore{
+		path:    filepath.Join(stateDir, "capabilities.json"),
+		records: make(map[string]*capability.Record),
+		probing: make(map[string]bool),
+	}
+	// With probing disabled, records left by earlier runs are stale
+	if !enabled {
+		return s
+	}
+	if err := readStateFile(s.path, &s.records); err != nil {
+		logrus.Warnf("Failed to read target capabilities: %v", err)
+	}
+	return s
+}
+
+// get returns a target's record, nil until it has been probed
+func (s *capabilityStore) get(name string) *capability.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records[name]
+}
+
+func (s *capabilityStore) set(name string, record capability.Record) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records[name] = &record
+	delete(s.probing, name)
+	if err := writeStateFile(s.path, s.records); err != nil {
+		logrus.Warnf("Failed to persist target capabilities: %v", err)
+	}
+}
+
+// release ends a probe that found nothing to record, so the target is
+// claimed again
+func (s *capabilityStore) release(name string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.probing, name)
+}
+
+// claim marks a target as being probed unless it is already, or its
+// record is still fresh
+func (s *capabilityStore) claim(name string, refresh time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.probing[name] {
+		return false
+	}
+	if record, ok := s.records[name]; ok && time.Since(record.ProbedAt) < refresh {
+		return false
+	}
+	s.probing[name] = true
+	return true
+}
+
+func (s *capabilityStore) snapshot() map[string]capability.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	records := make(map[string]capability.Record, len(s.records))
+	for name, record := range s.records {
+		records[name] = *record
+	}
+	return records
+}
+
+// probeCapabilities probes every available target that has no fresh
+// record after each health check interval, so targets are probed as soon
+// as they are registered and healthy. Probes run apart from the loop: a
+// context window search can take minutes.
+func (r *Router) probeCapabilities(ctx context.Context, beat func()) {
+	ticker := time.NewTicker(r.healthChecker.Interval())
+	defer ticker.Stop()
+
+	config := r.config.Router.CapabilityProbes
+	for {
+		for _, target := range r.liveTargets(ctx) {
+			if target.Type == "provider" && !config.Providers {
+				continue
+			}
+			if !r.capabilities.claim(target.Name, config.RefreshInterval) {
+				continue
+			}
+			go r.probeTarget(ctx, target)
+		}
+		beat()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Router) probeTarget(ctx context.Context, target *RouteTarget) {
+	model := ""
+	if target.Type == "provider" {
+		for _, providerConfig := range r.providerConfigs() {
+			if providerConfig.Name == target.Name {
+				model = providerConfig.DefaultModel
+			}
+		}
+	} else if len(target.Models) > 0 {
+		model = target.Models[0]
+	}
+
+	logrus.Infof("Probing capabilities of %s", target.Name)
+	record, err := capability.Probe(ctx, r.config.Router.CapabilityProbes, model, func(ctx context.Context, endpoint string, body []byte) (capability.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(body))
+		if err != nil {
+			return capability.Response{}, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		llmReq := &llmRequest{Endpoint: endpoint, Body: body, Model: model, RequestedModel: model, Choices: 1, Exclude: map[string]bool{}}
+
+		buf := newResponseBuffer()
+		err = r.forwardToTarget(ctx, buf, req, target, llmReq)
+		return capability.Response{Status: buf.StatusCode(), Header: buf.Header(), Body: buf.Bytes()}, err
+	})
+	if err != nil {
+		// Tried again next cycle; an earlier record stands meanwhile
+		logrus.Warnf("Capability probe of %s was inconclusive, retrying: %v", target.Name, err)
+		r.capabilities.release(target.Name)
+		return
+	}
+	r.capabilities.set(target.Name, record)
+
+	logrus.Infof("Probed %s: endpoints %v, streaming %t, tools %t, context window %d",
+		target.Name, record.Endpoints, record.Streaming, record.Tools, record.ContextWindow)
+	for _, endpoint := range capability.Endpoints {
+		r.metrics.targetCapabilities.WithLabelValues(target.Name, endpoint).Set(boolGauge(record.Supports(endpoint)))
+	}
+	r.metrics.targetCapabilities.WithLabelValues(target.Name, "streaming").Set(boolGauge(record.Streaming))
+	r.metrics.targetCapabilities.WithLabelValues(target.Name, "tools").Set(boolGauge(record.Tools))
+	r.metrics.targetCapabilities.WithLabelValues(target.Name, "context_window").Set(float64(record.ContextWindow))
+}
+
+func boolGauge(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// filterByCapabilities drops probed targets that can't serve the request's
+// endpoint, streaming or tools. Unprobed targets are kept, and if no target
+// is left the filter is skipped rather than failing the request.
+func (r *Router) filterByCapabilities(targets []*RouteTarget, llmReq *llmRequest) []*RouteTarget {
+	probedEndpoint := false
+	for _, endpoint := range capability.Endpoints {
+		probedEndpoint = probedEndpoint || endpoint == llmReq.Endpoint
+	}
+
+	capable := targets[:0:0]
+	for _, target := range targets {
+		record := r.capabilities.get(target.Name)
+		if record != nil && ((probedEndpoint && !record.Supports(llmReq.Endpoint)) ||
+			(llmReq.Stream && !record.Streaming) || (llmReq.Tools && !record.Tools)) {
+			continue
+		}
+		capable = append(capable, target)
+	}
+	if len(capable) == 0 {
+		logrus.Debugf("No probed target is capable of this %s request, ignoring capabilities", llmReq.Endpoint)
+		return targets
+	}
+	return capable
+}
+
+// servesEndpoint reports whether target has an API for endpoint. Clusters
+// serve the endpoints they list; providers may advertise a subset.
+func servesEndpoint(target *RouteTarget, endpoint string) bool {
+	if target.Type == "cluster" {
+		return clusterServes(target.Endpoints, endpoint)
+	}
+	supporter, ok := target.Provider.(providers.EndpointSupporter)
+	return !ok || supporter.SupportsEndpoint(endpoint)
+}
+
+// filterByEndpoint drops providers without an API for the request's
+// endpoint, such as Claude for embeddings. Unlike probed capabilities this
+// is never skipped: such a provider can only fail the request.
+func (r *Router) filterByEndpoint(targets []*RouteTarget, llmReq *llmRequest) ([]*RouteTarget, error) {
+	kept := targets[:0:0]
+	for _, target := range targets {
+		if servesEndpoint(target, llmReq.Endpoint) {
+			kept = append(kept, target)
+		}
+	}
+	if len(kept) == 0 && len(targets) > 0 {
+		return nil, fmt.Errorf("no healthy target serves %s", llmReq.Endpoint)
+	}
+	return kept, nil
+}
+
+// capabilitiesHandler lists the probed capability records
+func (r *Router) capabilitiesHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.capabilities.snapshot())
+}
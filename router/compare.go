@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/tokenizer"
+)
+
+// compareRequest is the body of POST /debug/compare
+type compareRequest struct {
+	Targets  []string        `json:"targets"`  // exactly two target names
+	Endpoint string          `json:"endpoint"` // default /v1/chat/completions
+	Request  json.RawMessage `json:"request"`  // OpenAI-format request sent to both
+}
+
+// compareResult is one target's side of a comparison
+type compareResult struct {
+	Target           string          `json:"target"`
+	Type             string          `json:"type"`
+	Model            string          `json:"model,omitempty"`
+	Status           int             `json:"status"`
+	LatencyMs        int64           `json:"latency_ms"`
+	PromptTokens     int             `json:"prompt_tokens"`
+	CompletionTokens int             `json:"completion_tokens"`
+	TokensEstimated  bool            `json:"tokens_estimated,omitempty"` // no usage block in the response
+	CostUSD          float64         `json:"cost_usd"`
+	Text             string          `json:"text"`
+	Response         json.RawMessage `json:"response,omitempty"`
+	Error            string          `json:"error,omitempty"`
+}
+
+// compareHandler sends one request to two named targets concurrently and
+// returns both responses with token, latency and cost stats and a line diff
+// of their generated text. Requests are sent non-streaming and bypass
+// routing, stickiness and metrics.
+func (r *Router) compareHandler(w http.ResponseWriter, req *http.Request) {
+	var compareReq compareRequest
+	if err := json.NewDecoder(req.Body).Decode(&compareReq); err != nil {
+		writeBodyError(w, err, "Invalid request")
+		return
+	}
+	if len(compareReq.Targets) != 2 {
+		http.Error(w, "Exactly two targets are required", http.StatusBadRequest)
+		return
+	}
+	if compareReq.Endpoint == "" {
+		compareReq.Endpoint = "/v1/chat/completions"
+	}
+	// Only endpoints that are safe to send twice can be compared
+	if !hedgeableEndpoints[compareReq.Endpoint] {
+		http.Error(w, fmt.Sprintf("Unsupported endpoint %s", compareReq.Endpoint), http.StatusBadRequest)
+		return
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(compareReq.Request, &fields); err != nil {
+		http.Error(w, "request must be a JSON object", http.StatusBadRequest)
+		return
+	}
+	delete(fields, "stream")
+	body, _ := json.Marshal(fields)
+
+	llmReq := parseLLMRequest(req, compareReq.Endpoint, body)
+	r.applyModelAliases(llmReq)
+
+	live := make(map[string]*RouteTarget)
+	for _, target := range r.liveTargets(req.Context()) {
+		live[target.Name] = target
+	}
+	targets := make([]*RouteTarget, 2)
+	for i, name := range compareReq.Targets {
+		target, ok := live[name]
+		if !ok {
+			http.Error(w, fmt.Sprintf("Target %s is not available", name), http.StatusConflict)
+			return
+		}
+		r.filterByModel([]*RouteTarget{target}, llmReq.Model)
+		targets[i] = target
+	}
+
+	results := make([]compareResult, 2)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target *RouteTarget) {
+			defer wg.Done()
+			results[i] = r.compareOne(req, target, llmReq)
+		}(i, target)
+	}
+	wg.Wait()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"endpoint": compareReq.Endpoint,
+		"results":  results,
+		"diff":     lineDiff(results[0].Text, results[1].Text),
+	})
+}
+
+func (r *Router) compareOne(req *http.Request, target *RouteTarget, llmReq *llmRequest) compareResult {
+	result := compareResult{Target: target.Name, Type: target.Type, Model: target.Model}
+	if result.Model == "" {
+		result.Model = llmReq.Model
+	}
+
+	// The admin token must not reach upstreams
+	upstreamReq := req.Clone(req.Context())
+	upstreamReq.Header.Del("Authorization")
+
+	buf := newResponseBuffer()
+	start := time.Now()
+	err := r.forwardToTarget(req.Context(), buf, upstreamReq, target, llmReq)
+	result.LatencyMs = time.Since(start).Milliseconds()
+	result.Status = buf.StatusCode()
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	var parsed struct {
+		Choices []struct {
+			Text    string `json:"text"`
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+		Usage *tokenUsage `json:"usage"`
+	}
+	if json.Valid(buf.Bytes()) {
+		result.Response = append(json.RawMessage(nil), buf.Bytes()...)
+		json.Unmarshal(buf.Bytes(), &parsed)
+	} else if buf.Bytes() != nil {
+		result.Text = string(buf.Bytes())
+	}
+
+	var texts []string
+	for _, choice := range parsed.Choices {
+		texts = append(texts, choice.Message.Content+choice.Text)
+	}
+	if len(texts) > 0 {
+		result.Text = strings.Join(texts, "\n")
+	}
+
+	var usage tokenUsage
+	if parsed.Usage != nil {
+		usage = *parsed.Usage
+	} else {
+		usage.PromptTokens = llmReq.promptTokens()
+		usage.CompletionTokens = tokenizer.Count(result.Model, result.Text)
+		result.TokensEstimated = true
+	}
+	result.PromptTokens = usage.PromptTokens
+	result.CompletionTokens = usage.CompletionTokens
+	result.CostUSD = usageCost(target, result.Model, usage)
+	return result
+}
+
+// lineDiff renders a unified-style diff of two texts: lines only in a are
+// prefixed "-", lines only in b "+", shared lines " "
+func lineDiff(a, b string) string {
+	left, right := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	// Longest common subsequence table, filled from the end
+	lcs := make([][]int, len(left)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(right)+1)
+	}
+	for i := len(left) - 1; i >= 0; i-- {
+		for j := len(right) - 1; j >= 0; j-- {
+			if left[i] == right[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var out strings.Builder
+	i, j := 0, 0
+	for i < len(left) || j < len(right) {
+		switch {
+		case i < len(left) && j < len(right) && left[i] == right[j]:
+			out.WriteString("  " + left[i] + "\n")
+			i++
+			j++
+		case j == len(right) || (i < len(left) && lcs[i+1][j] >= lcs[i][j+1]):
+			out.WriteString("- " + left[i] + "\n")
+			i++
+		default:
+			out.WriteString("+ " + right[j] + "\n")
+			j++
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/compress"
+	"github.com/sirupsen/logrus"
+)
+
+// compressionHeader reports the compression decision to clients; clients may
+// send it with the value "off" to opt out
+const compressionHeader = "X-LLM-Router-Compression"
+
+// applyPromptCompression prunes long chat prompts before routing so routing
+// and forwarding both see the compressed size
+func (r *Router) applyPromptCompression(w http.ResponseWriter, req *http.Request, llmReq *llmRequest) {
+	cfg := r.config.Router.PromptCompression
+	if !cfg.Enabled || !strings.HasSuffix(llmReq.Endpoint, "/chat/completions") {
+		return
+	}
+	if strings.EqualFold(req.Header.Get(compressionHeader), "off") {
+		return
+	}
+
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(llmReq.Body, &requestData); err != nil {
+		return
+	}
+	messages, ok := requestData["messages"].([]interface{})
+	if !ok || compress.CountTokens(messages) <= cfg.ThresholdTokens {
+		return
+	}
+
+	result := compress.Messages(messages, cfg)
+	if result.TokensSaved() <= 0 {
+		w.Header().Set(compressionHeader, "skipped")
+		r.metrics.promptCompressions.WithLabelValues("skipped").Inc()
+		return
+	}
+
+	rewritten, err := json.Marshal(requestData)
+	if err != nil {
+		logrus.Warnf("Failed to encode compressed prompt: %v", err)
+		return
+	}
+	llmReq.Body = rewritten
+
+	w.Header().Set(compressionHeader, fmt.Sprintf("applied; original_tokens=%d; compressed_tokens=%d",
+		result.OriginalTokens, result.CompressedTokens))
+	r.metrics.promptCompressions.WithLabelValues("applied").Inc()
+	r.metrics.compressionTokensSaved.Add(float64(result.TokensSaved()))
+	logrus.Debugf("Compressed prompt from ~%d to ~%d tokens", result.OriginalTokens, result.CompressedTokens)
+}
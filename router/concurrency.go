@@ -0,0 +1,269 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/auth"
+)
+
+// ConcurrencyConfig caps the LLM requests the router works on at once.
+// Requests beyond the cap wait in a bounded queue; beyond that they are
+// shed at once, before their bodies are read, so a spike costs a 503
+// rather than memory.
+type ConcurrencyConfig struct {
+	MaxInFlight  int            `yaml:"maxInFlight"`  // 0 leaves concurrency unlimited and priorities unapplied
+	MaxQueue     int            `yaml:"maxQueue"`     // requests waiting for a slot, default maxInFlight, negative queues none
+	QueueTimeout time.Duration  `yaml:"queueTimeout"` // longest wait for a slot, default 5s
+	Priorities   PriorityConfig `yaml:"priorities"`
+}
+
+// PriorityConfig shares freed slots between priority classes while
+// requests queue: each waiting class gets slots in proportion to its
+// weight, and within a class the tenants take turns, so one tenant's
+// backlog delays only its own requests. Requests only queue for slots
+// under a cap, so priorities take effect only when maxInFlight is set.
+type PriorityConfig struct {
+	Weights map[string]float64 `yaml:"weights"` // class -> weight, default premium 8, standard 4, batch 1
+	Default string             `yaml:"default"` // class of tenants not listed, default standard
+	Tenants map[string]string  `yaml:"tenants"` // tenant -> class
+}
+
+// priorityClasses are the classes, highest first
+var priorityClasses = []string{"premium", "standard", "batch"}
+
+var defaultPriorityWeights = map[string]float64{"premium": 8, "standard": 4, "batch": 1}
+
+// priorityHeader lets a caller lower its request's class, e.g. to batch
+// for bulk jobs; a class above the tenant's own is ignored
+const priorityHeader = "X-LLM-Router-Priority"
+
+func priorityRank(class string) int {
+	for i, name := range priorityClasses {
+		if name == class {
+			return i
+		}
+	}
+	return -1
+}
+
+// requestPriority picks req's class from its tenant and priorityHeader
+func (a *admission) requestPriority(req *http.Request) string {
+	class := a.config.Priorities.Default
+	if id := auth.FromContext(req.Context()); id != nil {
+		if tenantClass, ok := a.config.Priorities.Tenants[id.Tenant]; ok {
+			class = tenantClass
+		}
+	}
+	if asked := strings.ToLower(req.Header.Get(priorityHeader)); priorityRank(asked) > priorityRank(class) {
+		class = asked
+	}
+	return class
+}
+
+// admission hands out in-flight slots. Freed slots are handed straight to
+// the next waiter the fair queue picks, so arrivals can't overtake it.
+type admission struct {
+	config ConcurrencyConfig
+
+	mu       sync.Mutex
+	inFlight int
+	queued   int
+	classes  map[string]*priorityQueue
+}
+
+// priorityQueue is one class's waiters by tenant. pass is the class's
+// stride scheduling position: the waiting class with the lowest pass is
+// served next and advances by 1/weight.
+type priorityQueue struct {
+	weight  float64
+	pass    float64
+	tenants map[string][]*slotWaiter
+	order   []string // tenants with waiters, in turn order
+}
+
+type slotWaiter struct {
+	ready   chan struct{}
+	granted bool
+}
+
+func newAdmission(config ConcurrencyConfig) *admission {
+	a := &admission{config: config, classes: make(map[string]*priorityQueue)}
+	for _, class := range priorityClasses {
+		a.classes[class] = &priorityQueue{weight: config.Priorities.Weights[class], tenants: make(map[string][]*slotWaiter)}
+	}
+	return a
+}
+
+// limitConcurrency admits LLM requests to next within the in-flight cap
+func (r *Router) limitConcurrency(next http.HandlerFunc) http.HandlerFunc {
+	a := r.admission
+	if a.config.MaxInFlight <= 0 {
+		return next
+	}
+	return func(w http.ResponseWriter, req *http.Request) {
+		class := a.requestPriority(req)
+		if !r.queueForSlot(w, req, class) {
+			return
+		}
+		defer func() {
+			inFlight, queued := a.release()
+			r.metrics.inFlightRequests.Set(float64(inFlight))
+			r.metrics.queuedRequests.Set(float64(queued))
+		}()
+		next(w, req)
+	}
+}
+
+// queueForSlot takes an in-flight slot, waiting in the fair queue when
+// none is free, and sheds the request when the queue is full or the wait
+// runs out
+func (r *Router) queueForSlot(w http.ResponseWriter, req *http.Request, class string) bool {
+	a := r.admission
+	a.mu.Lock()
+	if a.inFlight < a.config.MaxInFlight && a.queued == 0 {
+		a.inFlight++
+		r.metrics.inFlightRequests.Set(float64(a.inFlight))
+		a.mu.Unlock()
+		r.metrics.queueWait.WithLabelValues(class).Observe(0)
+		return true
+	}
+	if a.queued >= a.config.MaxQueue {
+		a.mu.Unlock()
+		r.shed(w, req, "queue_full")
+		return false
+	}
+	tenant := ""
+	if id := auth.FromContext(req.Context()); id != nil {
+		tenant = id.Tenant
+	}
+	waiter := &slotWaiter{ready: make(chan struct{})}
+	a.enqueue(class, tenant, waiter)
+	r.metrics.queuedRequests.Set(float64(a.queued))
+	a.mu.Unlock()
+
+	start := time.Now()
+	timer := time.NewTimer(a.config.QueueTimeout)
+	defer timer.Stop()
+	reason := ""
+	select {
+	case <-waiter.ready:
+		r.metrics.queueWait.WithLabelValues(class).Observe(time.Since(start).Seconds())
+		return true
+	case <-timer.C:
+		reason = "queue_timeout"
+	case <-req.Context().Done():
+		reason = "cancelled"
+	}
+
+	a.mu.Lock()
+	if waiter.granted {
+		// The slot arrived as the wait ended; it is ours to use
+		a.mu.Unlock()
+		r.metrics.queueWait.WithLabelValues(class).Observe(time.Since(start).Seconds())
+		return true
+	}
+	a.dequeue(class, tenant, waiter)
+	r.metrics.queuedRequests.Set(float64(a.queued))
+	a.mu.Unlock()
+
+	if reason == "cancelled" {
+		r.metrics.shedRequests.WithLabelValues("cancelled").Inc()
+	} else {
+		r.shed(w, req, reason)
+	}
+	return false
+}
+
+// enqueue adds a waiter; callers hold a.mu
+func (a *admission) enqueue(class, tenant string, waiter *slotWaiter) {
+	q := a.classes[class]
+	if len(q.order) == 0 {
+		// A class that was idle rejoins level with the furthest behind of
+		// those waiting, so it can't bank turns while nothing of it waits
+		behind := -1.0
+		for _, other := range a.classes {
+			if len(other.order) > 0 && (behind < 0 || other.pass < behind) {
+				behind = other.pass
+			}
+		}
+		if behind > q.pass {
+			q.pass = behind
+		}
+	}
+	if len(q.tenants[tenant]) == 0 {
+		q.order = append(q.order, tenant)
+	}
+	q.tenants[tenant] = append(q.tenants[tenant], waiter)
+	a.queued++
+}
+
+// dequeue removes a waiter that gave up; callers hold a.mu
+func (a *admission) dequeue(class, tenant string, waiter *slotWaiter) {
+	q := a.classes[class]
+	waiters := q.tenants[tenant]
+	for i, w := range waiters {
+		if w == waiter {
+			q.tenants[tenant] = append(waiters[:i:i], waiters[i+1:]...)
+			a.queued--
+			break
+		}
+	}
+	if len(q.tenants[tenant]) == 0 {
+		q.dropTenant(tenant)
+	}
+}
+
+func (q *priorityQueue) dropTenant(tenant string) {
+	delete(q.tenants, tenant)
+	for i, name := range q.order {
+		if name == tenant {
+			q.order = append(q.order[:i:i], q.order[i+1:]...)
+			return
+		}
+	}
+}
+
+// release frees a slot, handing it to the next waiter if there is one,
+// and returns the requests in flight and queued
+func (a *admission) release() (int, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var next *priorityQueue
+	for _, class := range priorityClasses {
+		q := a.classes[class]
+		if len(q.order) > 0 && (next == nil || q.pass < next.pass) {
+			next = q
+		}
+	}
+	if next == nil {
+		a.inFlight--
+		return a.inFlight, a.queued
+	}
+
+	next.pass += 1 / next.weight
+	tenant := next.order[0]
+	waiter := next.tenants[tenant][0]
+	next.tenants[tenant] = next.tenants[tenant][1:]
+	next.order = next.order[1:]
+	if len(next.tenants[tenant]) > 0 {
+		next.order = append(next.order, tenant)
+	} else {
+		delete(next.tenants, tenant)
+	}
+	a.queued--
+	waiter.granted = true
+	close(waiter.ready)
+	return a.inFlight, a.queued
+}
+
+// shed turns a request away as overloaded
+func (r *Router) shed(w http.ResponseWriter, req *http.Request, reason string) {
+	r.metrics.shedRequests.WithLabelValues(reason).Inc()
+	r.unparsedRequestCounter("503", req).Inc()
+	w.Header().Set("Retry-After", "1")
+	http.Error(w, "Router is overloaded, retry shortly", http.StatusServiceUnavailable)
+}
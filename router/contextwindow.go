@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// contextWindowError rejects a request too long for every available target
+type contextWindowError struct {
+	tokens int // estimated prompt tokens plus max_tokens
+	window int // largest window among the targets that were too small
+}
+
+func (e *contextWindowError) Error() string {
+	return fmt.Sprintf("This model's maximum context length is %d tokens, however you requested about %d tokens. Please reduce the length of the messages or max_tokens.", e.window, e.tokens)
+}
+
+// contextWindow returns the tokens target accepts for model, 0 if unknown.
+// A probed window is trusted over configuration and pricing tables.
+func (r *Router) contextWindow(target *RouteTarget, model string) int {
+	if record := r.capabilities.get(target.Name); record != nil && record.ContextWindow > 0 {
+		return record.ContextWindow
+	}
+	if target.Type == "provider" {
+		if target.Model != "" {
+			model = target.Model
+		}
+		return target.Provider.GetModelPricing()[model].ContextWindow
+	}
+	for _, cluster := range r.clusterConfigs() {
+		if cluster.Name == target.Name {
+			return cluster.ContextWindow
+		}
+	}
+	return 0
+}
+
+// requestedTokens estimates the window a request needs: its prompt plus
+// room for max_tokens of output
+func requestedTokens(llmReq *llmRequest) int {
+	return llmReq.promptTokens() + llmReq.MaxTokens
+}
+
+// filterByContextWindow drops targets whose known context window can't fit
+// the request, so it is rerouted rather than failed upstream. Targets with
+// an unknown window are kept.
+func (r *Router) filterByContextWindow(targets []*RouteTarget, llmReq *llmRequest) ([]*RouteTarget, error) {
+	tokens := requestedTokens(llmReq)
+	fits := targets[:0:0]
+	largest := 0
+	for _, target := range targets {
+		window := r.contextWindow(target, llmReq.Model)
+		if window == 0 || tokens <= window {
+			fits = append(fits, target)
+		} else if window > largest {
+			largest = window
+		}
+	}
+	if len(fits) == 0 && largest > 0 {
+		return nil, &contextWindowError{tokens: tokens, window: largest}
+	}
+	return fits, nil
+}
+
+// writeContextWindowError answers like OpenAI does for an oversized request
+func writeContextWindowError(w http.ResponseWriter, err *contextWindowError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": err.Error(),
+			"type":    "invalid_request_error",
+			"param":   "messages",
+			"code":    "context_length_exceeded",
+		},
+	})
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+// CooldownConfig bounds how long a provider that answered 429 is left out
+// of selection
+type CooldownConfig struct {
+	Default time.Duration `yaml:"default"` // when the response doesn't say, default 10s
+	Max     time.Duration `yaml:"max"`     // longest honoured, default 5m
+}
+
+// coolDown keeps a provider that answered 429 out of selection for as long
+// as its response asks, within router.rateLimitCooldown
+func (r *Router) coolDown(ctx context.Context, target *RouteTarget, header http.Header) {
+	config := r.config.Router.RateLimitCooldown
+	wait, ok := providers.RetryAfter(header, time.Now())
+	if !ok {
+		wait = config.Default
+	}
+	if wait > config.Max {
+		wait = config.Max
+	}
+	if wait <= 0 {
+		return
+	}
+	r.providerManager.CoolDown(target.Name, time.Now().Add(wait))
+	r.metrics.providerCooldowns.WithLabelValues(target.Name).Inc()
+	logrus.WithContext(ctx).Warnf("Provider %s is rate limiting; skipping it for %s", target.Name, wait.Round(time.Millisecond))
+}
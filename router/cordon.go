@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/health"
+	"github.com/sirupsen/logrus"
+)
+
+const cordonsFile = "cordons.json"
+
+// clusterCordons keeps the clusters cordoned through the admin API in the
+// state dir, so they stay out of rotation across restarts, and counts each
+// cluster's in-flight requests so a drain knows when it is done
+type clusterCordons struct {
+	path    string
+	checker *health.Checker
+
+	mu       sync.Mutex
+	reasons  map[string]string // cordoned cluster -> reason
+	inFlight map[string]int
+}
+
+// newClusterCordons cordons again the clusters that were at shutdown
+func newClusterCordons(stateDir string, checker *health.Checker) *clusterCordons {
+	c := &clusterCordons{
+		path:     filepath.Join(stateDir, cordonsFile),
+		checker:  checker,
+		reasons:  make(map[string]string),
+		inFlight: make(map[string]int),
+	}
+	if err := readStateFile(c.path, &c.reasons); err != nil {
+		logrus.Warnf("Failed to restore cluster cordons: %v", err)
+	}
+	for name, reason := range c.reasons {
+		if checker.Cordon(name, reason) {
+			logrus.Warnf("Cluster %s is cordoned: %s", name, reason)
+		}
+	}
+	return c
+}
+
+// set cordons or uncordons a cluster and persists the change
+func (c *clusterCordons) set(name, reason string, cordoned bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cordoned {
+		c.checker.Cordon(name, reason)
+		c.reasons[name] = reason
+	} else {
+		c.checker.Uncordon(name)
+		delete(c.reasons, name)
+	}
+	return writeStateFile(c.path, c.reasons)
+}
+
+// reason returns why a cluster is cordoned, if it is
+func (c *clusterCordons) reason(name string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	reason, ok := c.reasons[name]
+	return reason, ok
+}
+
+// begin marks a request to a cluster in flight; the returned func marks it done
+func (c *clusterCordons) begin(name string) func() {
+	c.mu.Lock()
+	c.inFlight[name]++
+	c.mu.Unlock()
+	return func() {
+		c.mu.Lock()
+		c.inFlight[name]--
+		c.mu.Unlock()
+	}
+}
+
+func (c *clusterCordons) active(name string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.inFlight[name]
+}
+
+// clusterState is the admin API's view of one cluster
+type clusterState struct {
+	Cluster  string `json:"cluster"`
+	Cordoned bool   `json:"cordoned"`
+	Reason   string `json:"reason,omitempty"`
+	Healthy  bool   `json:"healthy"`
+	InFlight int    `json:"in_flight"`
+	Status   string `json:"status,omitempty"` // outcome of a drain or removal
+}
+
+// lifecycleCluster returns the cluster named in the path, answering 404
+// when the health checker doesn't know it
+func (r *Router) lifecycleCluster(w http.ResponseWriter, req *http.Request) (string, health.ClusterMetrics, bool) {
+	name := mux.Vars(req)["name"]
+	metrics, ok := r.healthChecker.GetClusterMetrics(name)
+	if !ok {
+		http.Error(w, "Unknown cluster "+name, http.StatusNotFound)
+	}
+	return name, metrics, ok
+}
+
+func (r *Router) writeClusterState(w http.ResponseWriter, code int, name, status string) {
+	metrics, _ := r.healthChecker.GetClusterMetrics(name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(clusterState{
+		Cluster:  name,
+		Cordoned: metrics.Cordoned,
+		Reason:   metrics.CordonReason,
+		Healthy:  metrics.Healthy,
+		InFlight: r.cordons.active(name),
+		Status:   status,
+	})
+}
+
+// cordonClusterHandler stops routing new requests to a cluster; those in
+// flight finish. ?reason= is logged and reported.
+func (r *Router) cordonClusterHandler(w http.ResponseWriter, req *http.Request) {
+	name, _, ok := r.lifecycleCluster(w, req)
+	if !ok {
+		return
+	}
+	if !r.cordon(w, name, req.URL.Query().Get("reason")) {
+		return
+	}
+	r.writeClusterState(w, http.StatusOK, name, "")
+}
+
+func (r *Router) cordon(w http.ResponseWriter, name, reason string) bool {
+	if reason == "" {
+		reason = "cordoned by admin"
+	}
+	if err := r.cordons.set(name, reason, true); err != nil {
+		logrus.Errorf("Failed to persist cordon of %s: %v", name, err)
+		http.Error(w, "Failed to persist cordon", http.StatusInternalServerError)
+		return false
+	}
+	logrus.Warnf("Cluster %s cordoned: %s", name, reason)
+	return true
+}
+
+// uncordonClusterHandler returns a cluster to rotation once it is healthy
+func (r *Router) uncordonClusterHandler(w http.ResponseWriter, req *http.Request) {
+	name, _, ok := r.lifecycleCluster(w, req)
+	if !ok {
+		return
+	}
+	if err := r.cordons.set(name, "", false); err != nil {
+		logrus.Errorf("Failed to persist uncordon of %s: %v", name, err)
+		http.Error(w, "Failed to persist uncordon", http.StatusInternalServerError)
+		return
+	}
+	logrus.Infof("Cluster %s uncordoned", name)
+	r.writeClusterState(w, http.StatusOK, name, "")
+}
+
+// drainClusterHandler cordons a cluster and waits, up to ?timeout (default
+// admin.prestopTimeout), for its in-flight requests to finish. It answers
+// 504 if some are still running, and the cluster stays cordoned either way.
+func (r *Router) drainClusterHandler(w http.ResponseWriter, req *http.Request) {
+	name, _, ok := r.lifecycleCluster(w, req)
+	if !ok {
+		return
+	}
+	timeout := r.config.Admin.PrestopTimeout
+	if raw := req.URL.Query().Get("timeout"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = parsed
+	}
+	reason := req.URL.Query().Get("reason")
+	if reason == "" {
+		reason = "drained by admin"
+	}
+	if !r.cordon(w, name, reason) {
+		return
+	}
+
+	deadline := time.Now().Add(timeout)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for r.cordons.active(name) > 0 {
+		if time.Now().After(deadline) {
+			logrus.Warnf("Drain of cluster %s timed out with %d requests in flight", name, r.cordons.active(name))
+			r.writeClusterState(w, http.StatusGatewayTimeout, name, "deadline_exceeded")
+			return
+		}
+		select {
+		case <-req.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+	r.writeClusterState(w, http.StatusOK, name, "drained")
+}
+
+// removeClusterHandler takes a cluster out of health checking and routing
+// until restart; remove it from the config file to make that permanent
+func (r *Router) removeClusterHandler(w http.ResponseWriter, req *http.Request) {
+	name, metrics, ok := r.lifecycleCluster(w, req)
+	if !ok {
+		return
+	}
+	if metrics.Cordoned {
+		if err := r.cordons.set(name, "", false); err != nil {
+			logrus.Warnf("Failed to clear cordon of removed cluster %s: %v", name, err)
+		}
+	}
+	r.removeCluster(name)
+	logrus.Warnf("Cluster %s removed from rotation until restart", name)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(clusterState{
+		Cluster:  name,
+		InFlight: r.cordons.active(name),
+		Status:   "removed",
+	})
+}
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/tokenizer"
+	"github.com/sirupsen/logrus"
+)
+
+// maxCostHeader carries a per-request cost ceiling in USD; the body may
+// instead carry a top-level "max_cost" extension, stripped before forwarding
+const maxCostHeader = "X-LLM-Router-Max-Cost"
+
+// CostCeilingConfig tunes per-request cost ceiling enforcement
+type CostCeilingConfig struct {
+	DefaultMaxTokens int     `yaml:"defaultMaxTokens"` // assumed output length when max_tokens is unset
+	StreamStopRatio  float64 `yaml:"streamStopRatio"`  // stop a stream once this fraction of the ceiling is spent
+}
+
+var errCostCeilingExceeded = errors.New("estimated cost exceeds max_cost on every target")
+
+// parseMaxCost reads the cost ceiling from the header or the body extension,
+// removing the extension so upstreams don't reject the unknown field
+func parseMaxCost(req *http.Request, llmReq *llmRequest) {
+	if header := req.Header.Get(maxCostHeader); header != "" {
+		if maxCost, err := strconv.ParseFloat(header, 64); err == nil && maxCost > 0 {
+			llmReq.MaxCost = maxCost
+		}
+	}
+
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(llmReq.Body, &requestData); err != nil {
+		return
+	}
+	extension, ok := requestData["max_cost"]
+	if !ok {
+		return
+	}
+	if maxCost, ok := extension.(float64); ok && maxCost > 0 && llmReq.MaxCost == 0 {
+		llmReq.MaxCost = maxCost
+	}
+	delete(requestData, "max_cost")
+	if rewritten, err := json.Marshal(requestData); err == nil {
+		llmReq.Body = rewritten
+	}
+}
+
+// targetPricing returns a target's $/1K input and output token prices for model
+func targetPricing(target *RouteTarget, model string) (input, output float64) {
+	if target.Type == "provider" {
+		if pricing, ok := target.Provider.GetModelPricing()[model]; ok {
+			return pricing.InputPricePer1K, pricing.OutputPricePer1K
+		}
+	}
+	return target.Cost, target.Cost
+}
+
+// usageCost prices the tokens a request used on target. Reasoning tokens
+// are part of the completion but some models bill them at their own rate.
+func usageCost(target *RouteTarget, model string, usage tokenUsage) float64 {
+	inputPrice, outputPrice := targetPricing(target, model)
+	reasoningPrice := outputPrice
+	if target.Type == "provider" {
+		if pricing, ok := target.Provider.GetModelPricing()[model]; ok && pricing.ReasoningPricePer1K > 0 {
+			reasoningPrice = pricing.ReasoningPricePer1K
+		}
+	}
+	reasoning := min(usage.CompletionTokensDetails.ReasoningTokens, usage.CompletionTokens)
+	return float64(usage.PromptTokens)/1000*inputPrice +
+		float64(usage.CompletionTokens-reasoning)/1000*outputPrice +
+		float64(reasoning)/1000*reasoningPrice
+}
+
+// estimateCost prices the request on target before it is sent
+func (r *Router) estimateCost(target *RouteTarget, llmReq *llmRequest) (inputCost, totalCost float64) {
+	model := target.Model
+	if model == "" {
+		model = llmReq.Model
+	}
+	if llmReq.Audio != nil {
+		price, _ := r.audioPrice(target, model)
+		cost := price * llmReq.Audio.Minutes()
+		return cost, cost
+	}
+	inputPrice, outputPrice := targetPricing(target, model)
+
+	// Each of n choices is an output of its own
+	outputTokens := llmReq.MaxTokens
+	if outputTokens == 0 {
+		outputTokens = r.config.Router.CostCeiling.DefaultMaxTokens
+	}
+	outputTokens *= llmReq.Choices
+	inputCost = float64(llmReq.promptTokens()) / 1000 * inputPrice
+	return inputCost, inputCost + float64(outputTokens)/1000*outputPrice
+}
+
+// filterByCostCeiling drops targets whose estimated cost exceeds the ceiling
+func (r *Router) filterByCostCeiling(targets []*RouteTarget, llmReq *llmRequest) ([]*RouteTarget, error) {
+	if llmReq.MaxCost <= 0 {
+		return targets, nil
+	}
+
+	var affordable []*RouteTarget
+	for _, target := range targets {
+		if _, estimate := r.estimateCost(target, llmReq); estimate <= llmReq.MaxCost {
+			affordable = append(affordable, target)
+		}
+	}
+	if len(affordable) == 0 {
+		if llmReq.trace == nil {
+			r.metrics.costCeilings.WithLabelValues("rejected").Inc()
+		}
+		return nil, fmt.Errorf("%w ($%.6f)", errCostCeilingExceeded, llmReq.MaxCost)
+	}
+	return affordable, nil
+}
+
+// ceilingWriter watches a streamed completion and ends it gracefully, with
+// finish_reason "length", once output spend nears the remaining budget
+type ceilingWriter struct {
+	http.ResponseWriter
+	budget      float64 // USD available for output tokens
+	outputPrice float64 // $/1K output tokens
+	stopRatio   float64
+	onStop      func()
+	model       string
+
+	partial   []byte
+	estimated int // completion tokens counted from the streamed content
+	tokens    int // completion tokens reported by a usage chunk, if any
+	stopped   bool
+}
+
+var errStreamCostCeiling = errors.New("stream stopped at cost ceiling")
+
+func (r *Router) newCeilingWriter(w http.ResponseWriter, target *RouteTarget, llmReq *llmRequest, onStop func()) *ceilingWriter {
+	model := target.Model
+	if model == "" {
+		model = llmReq.Model
+	}
+	_, outputPrice := targetPricing(target, model)
+	inputCost, _ := r.estimateCost(target, llmReq)
+
+	return &ceilingWriter{
+		ResponseWriter: w,
+		budget:         llmReq.MaxCost - inputCost,
+		outputPrice:    outputPrice,
+		stopRatio:      r.config.Router.CostCeiling.StreamStopRatio,
+		onStop:         onStop,
+		model:          model,
+	}
+}
+
+func (cw *ceilingWriter) Write(p []byte) (int, error) {
+	if cw.stopped {
+		return 0, errStreamCostCeiling
+	}
+	n, err := cw.ResponseWriter.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	cw.observe(p)
+	if cw.spent() < cw.budget*cw.stopRatio {
+		return n, nil
+	}
+
+	cw.stopped = true
+	fmt.Fprintf(cw.ResponseWriter, "data: %s\n\ndata: [DONE]\n\n",
+		`{"object":"chat.completion.chunk","choices":[{"index":0,"delta":{},"finish_reason":"length"}]}`)
+	cw.Flush()
+	logrus.Infof("Stopped stream at cost ceiling after ~$%.6f of output", cw.spent())
+	if cw.onStop != nil {
+		cw.onStop()
+	}
+	return n, errStreamCostCeiling
+}
+
+func (cw *ceilingWriter) Flush() {
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// observe accumulates streamed content from complete SSE lines
+func (cw *ceilingWriter) observe(p []byte) {
+	cw.partial = append(cw.partial, p...)
+	end := bytes.LastIndexByte(cw.partial, '\n')
+	if end < 0 {
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(cw.partial[:end]))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := bytes.CutPrefix(scanner.Bytes(), []byte("data: "))
+		if !ok {
+			continue
+		}
+		var chunk struct {
+			Choices []struct {
+				Text  string `json:"text"`
+				Delta struct {
+					Content string `json:"content"`
+				} `json:"delta"`
+			} `json:"choices"`
+			Usage *struct {
+				CompletionTokens int `json:"completion_tokens"`
+			} `json:"usage"`
+		}
+		if json.Unmarshal(data, &chunk) != nil {
+			continue
+		}
+		for _, choice := range chunk.Choices {
+			cw.estimated += tokenizer.Count(cw.model, choice.Delta.Content+choice.Text)
+		}
+		if chunk.Usage != nil {
+			cw.tokens = chunk.Usage.CompletionTokens
+		}
+	}
+	cw.partial = append(cw.partial[:0], cw.partial[end+1:]...)
+}
+
+func (cw *ceilingWriter) spent() float64 {
+	tokens := cw.tokens
+	if cw.estimated > tokens {
+		tokens = cw.estimated
+	}
+	return float64(tokens) / 1000 * cw.outputPrice
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strconv"
+)
+
+// Response cost headers. Streams carry all but the target as trailers,
+// since their cost is only known once they end.
+const (
+	targetHeader           = "X-LLM-Router-Target"
+	costHeader             = "X-LLM-Router-Cost-USD"
+	promptTokensHeader     = "X-LLM-Router-Prompt-Tokens"
+	completionTokensHeader = "X-LLM-Router-Completion-Tokens"
+	reasoningTokensHeader  = "X-LLM-Router-Reasoning-Tokens"
+	tokensEstimatedHeader  = "X-LLM-Router-Tokens-Estimated"
+)
+
+// decisionHeader tells callers how their request was routed, with the
+// labels of llm_router_routing_decisions_total
+const decisionHeader = "X-LLM-Router-Decision"
+
+// decisionSummary formats target's routing decision for decisionHeader
+func decisionSummary(target *RouteTarget) string {
+	return "target=" + target.Name + "; type=" + target.Type + "; reason=" + target.Reason
+}
+
+// ResponseCostConfig tells callers what each response cost, so they can
+// attribute spend per request without querying the usage store
+type ResponseCostConfig struct {
+	Enabled   bool `yaml:"enabled"`
+	BodyField bool `yaml:"bodyField"` // also add "x_llm_router" to whole JSON responses
+}
+
+// responseCost is what one response cost
+type responseCost struct {
+	Target           string  `json:"target"`
+	Cost             float64 `json:"cost_usd"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	ReasoningTokens  int     `json:"reasoning_tokens,omitempty"`
+	Estimated        bool    `json:"estimated"` // tokens estimated from lengths, not reported by the target
+}
+
+// costReporter holds back whole responses until their cost is known, then
+// writes them with cost headers. Streams pass straight through and get
+// trailers instead.
+type costReporter struct {
+	w         http.ResponseWriter
+	stream    bool
+	bodyField bool
+	status    int
+	buf       bytes.Buffer
+}
+
+func newCostReporter(w http.ResponseWriter, stream, bodyField bool) *costReporter {
+	return &costReporter{w: w, stream: stream, bodyField: bodyField}
+}
+
+func (c *costReporter) Header() http.Header {
+	return c.w.Header()
+}
+
+func (c *costReporter) WriteHeader(status int) {
+	if c.status != 0 {
+		return
+	}
+	c.status = status
+	if c.stream {
+		c.w.WriteHeader(status)
+	}
+}
+
+func (c *costReporter) Write(p []byte) (int, error) {
+	if c.status == 0 {
+		c.WriteHeader(http.StatusOK)
+	}
+	if c.stream {
+		return c.w.Write(p)
+	}
+	return c.buf.Write(p)
+}
+
+func (c *costReporter) Flush() {
+	if !c.stream {
+		return
+	}
+	if flusher, ok := c.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// finish reports cost on successful responses and writes any held back
+// response
+func (c *costReporter) finish(cost responseCost) {
+	if c.status >= 200 && c.status < 300 {
+		prefix := ""
+		if c.stream {
+			prefix = http.TrailerPrefix
+		}
+		header := c.w.Header()
+		header.Set(prefix+costHeader, strconv.FormatFloat(cost.Cost, 'f', -1, 64))
+		header.Set(prefix+promptTokensHeader, strconv.Itoa(cost.PromptTokens))
+		header.Set(prefix+completionTokensHeader, strconv.Itoa(cost.CompletionTokens))
+		if cost.ReasoningTokens > 0 {
+			header.Set(prefix+reasoningTokensHeader, strconv.Itoa(cost.ReasoningTokens))
+		}
+		header.Set(prefix+tokensEstimatedHeader, strconv.FormatBool(cost.Estimated))
+		if c.bodyField && !c.stream {
+			c.addBodyField(cost)
+		}
+	}
+	if c.stream || c.status == 0 {
+		return
+	}
+	c.w.WriteHeader(c.status)
+	c.w.Write(c.buf.Bytes())
+}
+
+// addBodyField adds the cost to a JSON object body as "x_llm_router",
+// leaving the rest of the body as the target wrote it
+func (c *costReporter) addBodyField(cost responseCost) {
+	body := bytes.TrimSpace(c.buf.Bytes())
+	if len(body) < 2 || body[0] != '{' || body[len(body)-1] != '}' || !json.Valid(body) {
+		return
+	}
+	field, _ := json.Marshal(cost)
+	var annotated bytes.Buffer
+	annotated.Write(body[:len(body)-1])
+	if len(bytes.TrimSpace(body[1:len(body)-1])) > 0 {
+		annotated.WriteByte(',')
+	}
+	annotated.WriteString(`"x_llm_router":`)
+	annotated.Write(field)
+	annotated.WriteByte('}')
+	c.buf = annotated
+	c.w.Header().Del("Content-Length")
+}
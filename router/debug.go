@@ -0,0 +1,47 @@
+package main
+
+import (
+	"expvar"
+	"net/http"
+	"net/http/pprof"
+	"runtime"
+
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	expvar.Publish("goroutines", expvar.Func(func() interface{} {
+		return runtime.NumGoroutine()
+	}))
+}
+
+// debugServer serves net/http/pprof under /debug/pprof/ and expvar at
+// /debug/vars on admin.debugAddress, apart from the API port so it can be
+// bound to a private interface. It is nil when no address is set.
+func (r *Router) debugServer() *http.Server {
+	if r.config.Admin.DebugAddress == "" {
+		return nil
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	// No write timeout: CPU profiles and traces stream for ?seconds
+	srv := &http.Server{
+		Addr:              r.config.Admin.DebugAddress,
+		Handler:           mux,
+		ReadHeaderTimeout: r.config.Server.ReadTimeout,
+	}
+	go func() {
+		logrus.Infof("Serving pprof and expvar on %s", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logrus.Errorf("Debug server failed: %v", err)
+		}
+	}()
+	return srv
+}
@@ -0,0 +1,400 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/auth"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/tokenizer"
+)
+
+// demoSessionIssuer is the iss of demo session tokens
+const demoSessionIssuer = "llm-router/demo"
+
+// demoSessionKeyFile keeps the generated session signing key in stateDir
+const demoSessionKeyFile = "demo-session-key.json"
+
+// errDemoSessionExpired is a demo session token past its expiry
+var errDemoSessionExpired = errors.New("demo session expired")
+
+// mockTargetName names the built-in target that answers sandboxed demo
+// traffic without calling any backend
+const mockTargetName = "demo-mock"
+
+// SandboxConfig confines demo sessions to targets that can't touch
+// production capacity or spend
+type SandboxConfig struct {
+	Targets []string `yaml:"targets"` // clusters or providers demo sessions may use
+	Mock    bool     `yaml:"mock"`    // answer with canned responses when no sandbox target is available; default when targets is empty
+}
+
+// demoSessions issues and checks the signed, expiring session tokens
+// /api/auth hands to demo visitors
+type demoSessions struct {
+	key     []byte
+	timeout time.Duration
+}
+
+// newDemoSessions signs with config's signingKey, or a key generated once
+// and kept in stateDir so sessions outlive restarts
+func newDemoSessions(config DemoConfig, stateDir string) (*demoSessions, error) {
+	sessions := &demoSessions{key: []byte(config.SigningKey), timeout: config.SessionTimeout}
+	if len(sessions.key) > 0 {
+		return sessions, nil
+	}
+
+	path := filepath.Join(stateDir, demoSessionKeyFile)
+	var stored struct {
+		Key []byte `json:"key"`
+	}
+	if err := readStateFile(path, &stored); err != nil {
+		return nil, fmt.Errorf("failed to read demo session key: %w", err)
+	}
+	if len(stored.Key) == 0 {
+		stored.Key = make([]byte, 32)
+		if _, err := rand.Read(stored.Key); err != nil {
+			return nil, err
+		}
+		if err := writeStateFile(path, stored); err != nil {
+			return nil, fmt.Errorf("failed to write demo session key: %w", err)
+		}
+	}
+	sessions.key = stored.Key
+	return sessions, nil
+}
+
+// newDemoSessionID names a new session, so refreshed tokens can be told
+// apart from new sign-ins
+func newDemoSessionID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+// issue returns a token for session valid for the session timeout
+func (s *demoSessions) issue(session string) (string, time.Time, error) {
+	now := time.Now()
+	expires := now.Add(s.timeout)
+	token, err := auth.SignHS256(auth.Claims{
+		"iss": demoSessionIssuer,
+		"sub": session,
+		"iat": now.Unix(),
+		"exp": expires.Unix(),
+	}, s.key)
+	return token, expires, err
+}
+
+// verify returns the session a token carries. It returns "" without error
+// for tokens that aren't demo sessions, which other methods may accept.
+func (s *demoSessions) verify(token string) (string, error) {
+	claims, err := auth.Verify(token, func(alg, kid string) (interface{}, error) {
+		if alg != "HS256" {
+			return nil, fmt.Errorf("unexpected algorithm %s", alg)
+		}
+		return s.key, nil
+	})
+	switch {
+	case errors.Is(err, auth.ErrExpired):
+		return "", errDemoSessionExpired // only our key signs it
+	case err != nil || claims.String("iss") != demoSessionIssuer:
+		return "", nil
+	}
+	return claims.String("sub"), nil
+}
+
+// demoIdentity returns the identity of a demo session, or nil when the
+// request doesn't carry one
+func (r *Router) demoIdentity(req *http.Request) (*auth.Identity, error) {
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if r.demoSessions == nil || !ok {
+		return nil, nil
+	}
+	session, err := r.demoSessions.verify(token)
+	if session == "" {
+		return nil, err
+	}
+	return &auth.Identity{Tenant: r.config.Demo.Tenant, Subject: clientIP(req), Method: "demo"}, nil
+}
+
+// writeDemoSession answers /api/auth and /api/auth/refresh with a token
+// for session
+func (r *Router) writeDemoSession(w http.ResponseWriter, session string) {
+	token, expires, err := r.demoSessions.issue(session)
+	if err != nil {
+		http.Error(w, "Failed to issue session", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":    true,
+		"token":      token,
+		"expires_at": expires.UTC().Format(time.RFC3339),
+		"expires_in": int(r.demoSessions.timeout.Seconds()),
+	})
+}
+
+// refreshSessionHandler exchanges a demo session token that hasn't expired
+// for one valid for another session timeout
+func (r *Router) refreshSessionHandler(w http.ResponseWriter, req *http.Request) {
+	token, _ := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	session, err := r.demoSessions.verify(token)
+	if session == "" {
+		message := "Invalid session"
+		if err != nil {
+			message = "Session expired; sign in again"
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="llm-router", error="invalid_token"`)
+		http.Error(w, message, http.StatusUnauthorized)
+		return
+	}
+	r.writeDemoSession(w, session)
+}
+
+// demoLimiter counts demo requests per client IP in one-minute windows
+type demoLimiter struct {
+	mu      sync.Mutex
+	limit   int
+	windows map[string]*demoWindow
+}
+
+type demoWindow struct {
+	start time.Time
+	count int
+}
+
+func newDemoLimiter(limit int) *demoLimiter {
+	return &demoLimiter{limit: limit, windows: make(map[string]*demoWindow)}
+}
+
+// allow counts a request from ip, returning how long to wait when it is
+// over the limit
+func (l *demoLimiter) allow(ip string) (time.Duration, bool) {
+	if l.limit <= 0 {
+		return 0, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	window := l.windows[ip]
+	if window == nil || now.Sub(window.start) >= time.Minute {
+		// Drop finished windows now and then so the map stays small
+		if len(l.windows) > 10000 {
+			for key, w := range l.windows {
+				if now.Sub(w.start) >= time.Minute {
+					delete(l.windows, key)
+				}
+			}
+		}
+		window = &demoWindow{start: now}
+		l.windows[ip] = window
+	}
+	if window.count >= l.limit {
+		return window.start.Add(time.Minute).Sub(now), false
+	}
+	window.count++
+	return 0, true
+}
+
+// demoWindowState is a client's current window as snapshotted
+type demoWindowState struct {
+	Start time.Time `json:"start"`
+	Count int       `json:"count"`
+}
+
+// state returns the windows that haven't finished
+func (l *demoLimiter) state() map[string]demoWindowState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	state := make(map[string]demoWindowState)
+	for ip, window := range l.windows {
+		if now.Sub(window.start) < time.Minute {
+			state[ip] = demoWindowState{Start: window.start, Count: window.count}
+		}
+	}
+	return state
+}
+
+// restore reloads windows saved by state
+func (l *demoLimiter) restore(state map[string]demoWindowState) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for ip, saved := range state {
+		if now.Sub(saved.Start) < time.Minute {
+			l.windows[ip] = &demoWindow{start: saved.Start, count: saved.Count}
+		}
+	}
+}
+
+// admitDemo applies demo.rateLimitPerIP, answering 429 when exceeded
+func (r *Router) admitDemo(w http.ResponseWriter, id *auth.Identity) bool {
+	wait, ok := r.demoLimiter.allow(id.Subject)
+	if ok {
+		return true
+	}
+	r.metrics.demoRequests.WithLabelValues("rate_limited").Inc()
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	http.Error(w, "Demo rate limit exceeded", http.StatusTooManyRequests)
+	return false
+}
+
+// sandboxTargets keeps the targets demo sessions may use
+func (r *Router) sandboxTargets(targets []*RouteTarget) []*RouteTarget {
+	allowed := make(map[string]bool, len(r.config.Demo.Sandbox.Targets))
+	for _, name := range r.config.Demo.Sandbox.Targets {
+		allowed[name] = true
+	}
+	var sandboxed []*RouteTarget
+	for _, target := range targets {
+		if allowed[target.Name] {
+			sandboxed = append(sandboxed, target)
+		}
+	}
+	return sandboxed
+}
+
+// inSandbox reports whether a demo session may use target
+func (r *Router) inSandbox(name string) bool {
+	for _, allowed := range r.config.Demo.Sandbox.Targets {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// mockTarget is the built-in demo target
+func mockTarget() *RouteTarget {
+	return &RouteTarget{Name: mockTargetName, Type: "mock", Weight: 1}
+}
+
+// serveMock answers a demo request in the shape of an OpenAI response, with
+// usage counted from the prompt so the demo still shows token accounting
+func serveMock(w http.ResponseWriter, llmReq *llmRequest) error {
+	model := llmReq.Model
+	if model == "" {
+		model = "demo"
+	}
+	id := fmt.Sprintf("demo-%d", time.Now().UnixNano())
+	created := time.Now().Unix()
+	promptTokens := llmReq.promptTokens()
+	w.Header().Set("X-LLM-Router-Sandbox", "mock")
+
+	if llmReq.Endpoint == "/v1/embeddings" {
+		return writeMockEmbeddings(w, llmReq, model, promptTokens)
+	}
+
+	text := "This is a sandboxed demo response. Demo sessions are answered by the router itself, so no backend capacity or budget is used."
+	completionTokens := tokenizer.Count(model, text)
+	usage := map[string]int{"prompt_tokens": promptTokens, "completion_tokens": completionTokens, "total_tokens": promptTokens + completionTokens}
+
+	if llmReq.Stream {
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		flusher, _ := w.(http.Flusher)
+		words := strings.Fields(text)
+		for i, word := range words {
+			if i > 0 {
+				word = " " + word
+			}
+			chunk := mockChunk(llmReq.Endpoint, id, model, created, word, nil)
+			if _, err := fmt.Fprintf(w, "data: %s\n\n", chunk); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		finish := "stop"
+		fmt.Fprintf(w, "data: %s\n\n", mockChunk(llmReq.Endpoint, id, model, created, "", &finish))
+		_, err := fmt.Fprint(w, "data: [DONE]\n\n")
+		return err
+	}
+
+	response := map[string]interface{}{
+		"id":      id,
+		"created": created,
+		"model":   model,
+		"usage":   usage,
+	}
+	if llmReq.Endpoint == "/v1/completions" {
+		response["object"] = "text_completion"
+		response["choices"] = []map[string]interface{}{{"index": 0, "text": text, "finish_reason": "stop"}}
+	} else {
+		response["object"] = "chat.completion"
+		response["choices"] = []map[string]interface{}{{
+			"index":         0,
+			"message":       map[string]string{"role": "assistant", "content": text},
+			"finish_reason": "stop",
+		}}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(response)
+}
+
+// mockChunk renders one streamed chunk of a mock response
+func mockChunk(endpoint, id, model string, created int64, text string, finish *string) []byte {
+	choice := map[string]interface{}{"index": 0, "finish_reason": finish}
+	object := "chat.completion.chunk"
+	if endpoint == "/v1/completions" {
+		object = "text_completion"
+		choice["text"] = text
+	} else {
+		delta := map[string]string{}
+		if text != "" {
+			delta["content"] = text
+		}
+		choice["delta"] = delta
+	}
+	chunk, _ := json.Marshal(map[string]interface{}{
+		"id": id, "object": object, "created": created, "model": model,
+		"choices": []interface{}{choice},
+	})
+	return chunk
+}
+
+// writeMockEmbeddings returns a deterministic unit vector derived from the
+// request body, so equal inputs embed equally
+func writeMockEmbeddings(w http.ResponseWriter, llmReq *llmRequest, model string, promptTokens int) error {
+	dims := llmReq.Dims
+	if dims <= 0 {
+		dims = 256
+	}
+	sum := sha256.Sum256(llmReq.Body)
+	seed := binary.BigEndian.Uint64(sum[:8])
+	vector := make([]float64, dims)
+	norm := 0.0
+	for i := range vector {
+		seed = seed*6364136223846793005 + 1442695040888963407
+		vector[i] = float64(int64(seed>>11))/float64(1<<52) - 1
+		norm += vector[i] * vector[i]
+	}
+	for i := range vector {
+		vector[i] /= math.Sqrt(norm)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(map[string]interface{}{
+		"object": "list",
+		"model":  model,
+		"data":   []map[string]interface{}{{"object": "embedding", "index": 0, "embedding": vector}},
+		"usage":  map[string]int{"prompt_tokens": promptTokens, "total_tokens": promptTokens},
+	})
+}
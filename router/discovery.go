@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/discovery"
+	"github.com/sirupsen/logrus"
+)
+
+// DiscoveryConfig reads clusters from Consul or etcd. Discovered clusters
+// take their settings from cluster, the registry supplying name, endpoint
+// and any of engine, costPerHour, weight, region, provider and
+// contextWindow.
+type DiscoveryConfig struct {
+	discovery.Config `yaml:",inline"`
+	Cluster          ClusterConfig `yaml:"cluster"` // name and endpoint are ignored
+}
+
+// discoveredClusters tracks which clusters discovery registered, so it
+// only ever removes its own
+type discoveredClusters struct {
+	mu       sync.Mutex
+	clusters map[string]ClusterConfig
+	clashes  map[string]bool // names also used by the config file or admin API
+}
+
+// watchDiscovery runs the discovery watch, registering its clusters
+func (r *Router) watchDiscovery(ctx context.Context, beat func()) {
+	r.discovery.Run(ctx, beat, r.applyDiscovered)
+}
+
+// applyDiscovered brings the registered clusters in line with the
+// registry's. Requests in flight to a removed cluster finish.
+func (r *Router) applyDiscovered(targets []discovery.Target) {
+	r.discovered.mu.Lock()
+	defer r.discovered.mu.Unlock()
+
+	seen := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		seen[target.Name] = true
+		cluster := r.discoveredCluster(target)
+		previous, known := r.discovered.clusters[target.Name]
+		switch {
+		case !known:
+			if err := r.addCluster(cluster); err != nil {
+				if !r.discovered.clashes[target.Name] {
+					logrus.Warnf("Not registering discovered cluster %s: %v", target.Name, err)
+					r.discovered.clashes[target.Name] = true
+				}
+				continue
+			}
+			delete(r.discovered.clashes, target.Name)
+			r.discovered.clusters[target.Name] = cluster
+			logrus.Infof("Discovered cluster %s (%s)", target.Name, target.Endpoint)
+		case !reflect.DeepEqual(previous, cluster):
+			if err := r.replaceCluster(cluster); err != nil {
+				logrus.Warnf("Failed to update discovered cluster %s: %v", target.Name, err)
+				continue
+			}
+			if cluster.Weight != previous.Weight {
+				r.policy.setWeight(cluster.Name, cluster.Weight)
+			}
+			r.discovered.clusters[target.Name] = cluster
+			logrus.Infof("Discovered cluster %s changed", target.Name)
+		}
+	}
+	for name := range r.discovered.clusters {
+		if !seen[name] {
+			r.removeCluster(name)
+			delete(r.discovered.clusters, name)
+			logrus.Infof("Discovered cluster %s is gone", name)
+		}
+	}
+	for name := range r.discovered.clashes {
+		if !seen[name] {
+			delete(r.discovered.clashes, name)
+		}
+	}
+}
+
+// discoveredCluster fills in the cluster template for a target
+func (r *Router) discoveredCluster(target discovery.Target) ClusterConfig {
+	cluster := r.config.Discovery.Cluster
+	cluster.Name = target.Name
+	cluster.Endpoint = target.Endpoint
+	cluster.SpotPrice = nil
+
+	meta := func(key string, set func(string) error) {
+		if value, ok := target.Meta[key]; ok {
+			if err := set(value); err != nil {
+				logrus.Warnf("Ignoring %s %q of discovered cluster %s: %v", key, value, target.Name, err)
+			}
+		}
+	}
+	number := func(v *float64) func(string) error {
+		return func(value string) (err error) {
+			*v, err = strconv.ParseFloat(value, 64)
+			return err
+		}
+	}
+	meta("engine", func(value string) error { cluster.Engine = value; return nil })
+	meta("region", func(value string) error { cluster.Region = value; return nil })
+	meta("provider", func(value string) error { cluster.Provider = value; return nil })
+	meta("costPerHour", number(&cluster.CostPerHour))
+	meta("weight", number(&cluster.Weight))
+	meta("contextWindow", func(value string) (err error) {
+		cluster.ContextWindow, err = strconv.Atoi(value)
+		return err
+	})
+	return cluster
+}
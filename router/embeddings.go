@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// reduceDimensions takes over `dimensions` for embeddings requests to targets
+// whose model doesn't support it: the parameter is removed from body, and the
+// returned writer shortens the full-size vectors instead. It returns nil when
+// the target handles the request as is.
+func (r *Router) reduceDimensions(w http.ResponseWriter, target *RouteTarget, llmReq *llmRequest, body *[]byte) *reductionWriter {
+	if llmReq.Endpoint != "/v1/embeddings" || llmReq.Dims <= 0 {
+		return nil
+	}
+	model := target.Model
+	if model == "" {
+		model = llmReq.Model
+	}
+	if !r.reducer.Applies(model) {
+		return nil
+	}
+
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(*body, &requestData); err != nil {
+		return nil
+	}
+	delete(requestData, "dimensions")
+	rewritten, err := json.Marshal(requestData)
+	if err != nil {
+		return nil
+	}
+	*body = rewritten
+	return &reductionWriter{w: w, router: r, target: target.Name, model: model, dims: llmReq.Dims}
+}
+
+// reductionWriter buffers an embeddings response and writes it reduced to
+// the requested dimensions. Error responses, and responses that can't be
+// reduced, are passed through unchanged.
+type reductionWriter struct {
+	w      http.ResponseWriter
+	router *Router
+	target string
+	model  string
+	dims   int
+	status int
+	buf    []byte
+}
+
+func (rw *reductionWriter) Header() http.Header {
+	return rw.w.Header()
+}
+
+func (rw *reductionWriter) WriteHeader(status int) {
+	// Reduced vectors change the body length
+	rw.w.Header().Del("Content-Length")
+	rw.status = status
+	rw.w.WriteHeader(status)
+}
+
+func (rw *reductionWriter) Write(p []byte) (int, error) {
+	if rw.status == 0 {
+		rw.WriteHeader(http.StatusOK)
+	}
+	rw.buf = append(rw.buf, p...)
+	return len(p), nil
+}
+
+// Close writes the buffered response
+func (rw *reductionWriter) Close() {
+	if rw.status < 200 || rw.status >= 300 {
+		rw.w.Write(rw.buf)
+		return
+	}
+	method := rw.router.reducer.Method()
+	reduced, info, err := rw.router.reducer.Reduce(rw.buf, rw.model, rw.dims)
+	if err != nil {
+		logrus.Warnf("Failed to reduce embeddings from %s to %d dimensions: %v", rw.target, rw.dims, err)
+		rw.router.metrics.embeddingReductions.WithLabelValues(method, "error").Inc()
+		rw.w.Write(rw.buf)
+		return
+	}
+	logrus.Debugf("Reduced embeddings from %s from %d to %d dimensions (%s)", rw.target, info.OriginalDimensions, info.Dimensions, info.Method)
+	rw.router.metrics.embeddingReductions.WithLabelValues(method, "reduced").Inc()
+	rw.w.Write(reduced)
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+)
+
+// EmbeddingsPoolConfig routes /v1/embeddings apart from chat and
+// completions: to its own targets, such as a CPU cluster or a cheap
+// provider, under its own strategy
+type EmbeddingsPoolConfig struct {
+	Targets         []string `yaml:"targets" json:"targets"`                           // targets serving embeddings; empty routes them like any request
+	RoutingStrategy string   `yaml:"routingStrategy" json:"routingStrategy,omitempty"` // default router.routingStrategy
+	Dedicated       bool     `yaml:"dedicated" json:"dedicated,omitempty"`             // other endpoints never use the pool's targets
+}
+
+func (p EmbeddingsPoolConfig) includes(name string) bool {
+	for _, target := range p.Targets {
+		if target == name {
+			return true
+		}
+	}
+	return false
+}
+
+// allows reports whether the pool lets target name serve endpoint
+func (p EmbeddingsPoolConfig) allows(endpoint, name string) bool {
+	if len(p.Targets) == 0 {
+		return true
+	}
+	if endpoint == "/v1/embeddings" {
+		return p.includes(name)
+	}
+	return !p.Dedicated || !p.includes(name)
+}
+
+// poolAllows reports whether the embeddings pool lets the target serve
+// llmReq
+func (r *Router) poolAllows(llmReq *llmRequest, name string) bool {
+	return r.policy.get().Embeddings.allows(llmReq.Endpoint, name)
+}
+
+// filterByEndpointPool keeps embeddings requests on the embeddings pool
+// and, when the pool is dedicated, other requests off it
+func (r *Router) filterByEndpointPool(targets []*RouteTarget, llmReq *llmRequest) ([]*RouteTarget, error) {
+	pool := r.policy.get().Embeddings
+	if len(pool.Targets) == 0 || (llmReq.Endpoint != "/v1/embeddings" && !pool.Dedicated) {
+		return targets, nil
+	}
+	var kept []*RouteTarget
+	for _, target := range targets {
+		if pool.allows(llmReq.Endpoint, target.Name) {
+			kept = append(kept, target)
+		}
+	}
+	if len(kept) == 0 && len(targets) > 0 && llmReq.Endpoint == "/v1/embeddings" {
+		return nil, fmt.Errorf("no target in the embeddings pool is available")
+	}
+	return kept, nil
+}
+
+// routingStrategy returns the strategy that selects llmReq's target
+func (r *Router) routingStrategy(llmReq *llmRequest) string {
+	if llmReq.Batch {
+		return r.config.Router.Batches.RoutingStrategy
+	}
+	policy := r.policy.get()
+	if pool := policy.Embeddings; llmReq.Endpoint == "/v1/embeddings" && len(pool.Targets) > 0 && pool.RoutingStrategy != "" {
+		return pool.RoutingStrategy
+	}
+	return policy.RoutingStrategy
+}
+
+// validateEmbeddingsPool checks that the pool names configured targets and
+// a known strategy
+func validateEmbeddingsPool(pool EmbeddingsPoolConfig, configured func(string) bool) error {
+	for _, name := range pool.Targets {
+		if !configured(name) {
+			return fmt.Errorf("embeddings.targets names %s, which is not a configured target", name)
+		}
+	}
+	if pool.RoutingStrategy != "" && !routingStrategies[pool.RoutingStrategy] {
+		return fmt.Errorf("unknown embeddings.routingStrategy %q", pool.RoutingStrategy)
+	}
+	return nil
+}
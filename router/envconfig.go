@@ -0,0 +1,151 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// envOverridePrefix starts the names of variables that override config
+// fields, e.g. ROUTER_SERVER_PORT for server.port
+const envOverridePrefix = "ROUTER_"
+
+// envReference matches ${VAR} and ${VAR:-default} in config values
+var envReference = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces ${VAR} references in every value of a YAML document
+// with the variable, or the :-default when it's unset or empty, and
+// returns the variables referenced. Keys are left alone, and so is a bare
+// $, which patterns and templates use.
+func expandEnv(node *yaml.Node) map[string]bool {
+	referenced := make(map[string]bool)
+	var walk func(node *yaml.Node)
+	walk = func(node *yaml.Node) {
+		switch node.Kind {
+		case yaml.ScalarNode:
+			if !strings.Contains(node.Value, "${") {
+				return
+			}
+			node.Value = envReference.ReplaceAllStringFunc(node.Value, func(reference string) string {
+				match := envReference.FindStringSubmatch(reference)
+				referenced[match[1]] = true
+				if value := os.Getenv(match[1]); value != "" || match[2] == "" {
+					return value
+				}
+				return match[3]
+			})
+			// Unquoted values are typed by what they expand to, so
+			// port: ${PORT} reads as a number
+			if node.Style&(yaml.SingleQuotedStyle|yaml.DoubleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+				node.Tag = ""
+			}
+		case yaml.MappingNode:
+			for i := 1; i < len(node.Content); i += 2 {
+				walk(node.Content[i])
+			}
+		default:
+			for _, child := range node.Content {
+				walk(child)
+			}
+		}
+	}
+	walk(node)
+	return referenced
+}
+
+// applyEnvOverrides sets config fields from ROUTER_* variables named by the
+// field's path in upper snake case: ROUTER_ROUTER_MAX_LATENCY_MS for
+// router.maxLatencyMs, ROUTER_CLUSTERS_0_SHARED_SECRET for
+// clusters[0].sharedSecret. Values are YAML, so durations, lists and
+// whole sections read as they would in the file. It returns the variables
+// that name no field.
+func applyEnvOverrides(config *Config, referenced map[string]bool) ([]string, error) {
+	used := make(map[string]bool)
+	if err := overrideFields(reflect.ValueOf(config).Elem(), strings.TrimSuffix(envOverridePrefix, "_"), used); err != nil {
+		return nil, err
+	}
+
+	var unknown []string
+	for _, entry := range os.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		if strings.HasPrefix(name, envOverridePrefix) && !used[name] && !referenced[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown, nil
+}
+
+func overrideFields(v reflect.Value, name string, used map[string]bool) error {
+	if value, ok := os.LookupEnv(name); ok && name+"_" != envOverridePrefix {
+		used[name] = true
+		if value == "" {
+			v.Set(reflect.Zero(v.Type()))
+		} else if err := yaml.Unmarshal([]byte(value), v.Addr().Interface()); err != nil {
+			return fmt.Errorf("invalid %s: %w", name, err)
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return overrideFields(v.Elem(), name, used)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := overrideFields(v.Index(i), name+"_"+strconv.Itoa(i), used); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			key, options, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			fieldName := name + "_" + envName(key)
+			switch {
+			case key == "-":
+				continue
+			case strings.Contains(options, "inline"):
+				fieldName = name
+			case key == "":
+				fieldName = name + "_" + strings.ToUpper(field.Name)
+			}
+			if err := overrideFields(v.Field(i), fieldName, used); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// envName converts a YAML key to upper snake case, keeping acronyms
+// together: monthlyAPIBudget becomes MONTHLY_API_BUDGET
+func envName(key string) string {
+	runes := []rune(key)
+	var name strings.Builder
+	for i, r := range runes {
+		if r == '-' {
+			r = '_'
+		}
+		if i > 0 && unicode.IsUpper(r) {
+			previous := runes[i-1]
+			nextLower := i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if unicode.IsLower(previous) || unicode.IsDigit(previous) || (unicode.IsUpper(previous) && nextLower) {
+				name.WriteByte('_')
+			}
+		}
+		name.WriteRune(unicode.ToUpper(r))
+	}
+	return name.String()
+}
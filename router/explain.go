@@ -0,0 +1,255 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// routeTrace records why each target was or wasn't chosen for an
+// explained request. Only /v1/router/explain sets one.
+type routeTrace struct {
+	candidates []*RouteTarget    // live targets routing started from
+	remaining  []*RouteTarget    // candidates left after the filters so far
+	excluded   map[string]string // target -> filter or condition that ruled it out
+	chosen     *RouteTarget
+}
+
+type routeTraceKey struct{}
+
+func withRouteTrace(ctx context.Context, trace *routeTrace) context.Context {
+	return context.WithValue(ctx, routeTraceKey{}, trace)
+}
+
+// routeTraceFrom returns the trace of the request being routed with ctx,
+// nil unless it is being explained
+func routeTraceFrom(ctx context.Context) *routeTrace {
+	trace, _ := ctx.Value(routeTraceKey{}).(*routeTrace)
+	return trace
+}
+
+// skip notes why name was ruled out, keeping the first reason given
+func (t *routeTrace) skip(name, reason string) {
+	if t == nil {
+		return
+	}
+	if _, ok := t.excluded[name]; !ok {
+		t.excluded[name] = reason
+	}
+}
+
+// skipMissing notes reason for the targets of before not in after
+func (t *routeTrace) skipMissing(before, after []*RouteTarget, reason string) {
+	if t == nil {
+		return
+	}
+	kept := make(map[string]bool, len(after))
+	for _, target := range after {
+		kept[target.Name] = true
+	}
+	for _, target := range before {
+		if !kept[target.Name] {
+			t.skip(target.Name, reason)
+		}
+	}
+}
+
+// start records the live targets. Filters reuse their input's backing
+// array, so the trace keeps copies.
+func (t *routeTrace) start(targets []*RouteTarget) {
+	if t == nil {
+		return
+	}
+	t.candidates = append([]*RouteTarget(nil), targets...)
+	t.remaining = append([]*RouteTarget(nil), targets...)
+}
+
+// keep records the targets left after the named filter
+func (t *routeTrace) keep(filter string, targets []*RouteTarget) {
+	if t == nil {
+		return
+	}
+	t.skipMissing(t.remaining, targets, filter)
+	t.remaining = append([]*RouteTarget(nil), targets...)
+}
+
+// explanation is the response of POST /v1/router/explain
+type explanation struct {
+	Endpoint       string            `json:"endpoint"`
+	Model          string            `json:"model,omitempty"` // after aliases
+	RequestedModel string            `json:"requested_model,omitempty"`
+	Tenant         string            `json:"tenant,omitempty"`
+	PromptTokens   int               `json:"prompt_tokens"`
+	MaxCost        float64           `json:"max_cost_usd,omitempty"`
+	Strategy       string            `json:"strategy"`
+	Chosen         string            `json:"chosen,omitempty"`
+	Decision       string            `json:"decision,omitempty"`   // as in llm_router_routing_decisions_total
+	Randomized     bool              `json:"randomized,omitempty"` // the choice is sampled and may differ per request
+	Error          string            `json:"error,omitempty"`      // why the request would be rejected
+	Candidates     []explainedTarget `json:"candidates"`
+}
+
+// explainedTarget is one target as routing saw it
+type explainedTarget struct {
+	Name          string   `json:"name"`
+	Type          string   `json:"type"`
+	Healthy       bool     `json:"healthy"`
+	Eligible      bool     `json:"eligible"`              // passed every filter
+	ExcludedBy    string   `json:"excluded_by,omitempty"` // filter or condition that ruled it out
+	Chosen        bool     `json:"chosen,omitempty"`
+	Model         string   `json:"model,omitempty"` // model it would be sent
+	Substitute    string   `json:"substitute,omitempty"`
+	CostPer1K     float64  `json:"cost_per_1k"`
+	EstimatedCost float64  `json:"estimated_cost_usd"`
+	LatencyP95Ms  float64  `json:"latency_p95_ms"`
+	LatencyEWMAMs float64  `json:"latency_ewma_ms,omitempty"`
+	QueueDepth    int      `json:"queue_depth"`
+	Weight        float64  `json:"weight"`
+	Score         *float64 `json:"score,omitempty"` // score strategy only, lower wins
+}
+
+// explainHandler routes a request body the way the endpoint in ?endpoint
+// (default /v1/chat/completions) would, without forwarding it, and
+// returns every target with the figures routing weighed, what ruled it
+// out and which target the strategy would pick. Nothing is recorded: no
+// decision metrics, stickiness or quota.
+func (r *Router) explainHandler(w http.ResponseWriter, req *http.Request) {
+	endpoint := req.URL.Query().Get("endpoint")
+	if endpoint == "" {
+		endpoint = "/v1/chat/completions"
+	}
+	if !apiEndpoints[endpoint] {
+		http.Error(w, fmt.Sprintf("Unsupported endpoint %s", endpoint), http.StatusBadRequest)
+		return
+	}
+
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeBodyError(w, err, "Failed to read request body")
+		return
+	}
+	if !json.Valid(body) {
+		http.Error(w, "Request body must be JSON", http.StatusBadRequest)
+		return
+	}
+
+	llmReq := parseLLMRequest(req, endpoint, body)
+	r.applyModelAliases(llmReq)
+	parseMaxCost(req, llmReq)
+	trace := &routeTrace{excluded: make(map[string]string)}
+	llmReq.trace = trace
+
+	strategy := r.routingStrategy(llmReq)
+	result := explanation{
+		Endpoint:       endpoint,
+		Model:          llmReq.Model,
+		RequestedModel: llmReq.RequestedModel,
+		Tenant:         llmReq.Tenant,
+		PromptTokens:   llmReq.promptTokens(),
+		MaxCost:        llmReq.MaxCost,
+		Strategy:       strategy,
+		Randomized:     strategy == "weighted" || strategy == "bandit" || r.config.Router.Canary.Enabled,
+	}
+	if _, err := r.selectTarget(req.Context(), llmReq); err != nil {
+		// A filter that rules out every target rejects the request
+		result.Error = err.Error()
+		trace.keep("rejected", nil)
+	}
+	if trace.chosen != nil {
+		result.Chosen = trace.chosen.Name
+		result.Decision = trace.chosen.Reason
+	}
+	result.Candidates = r.explainTargets(trace, llmReq, strategy)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// explainTargets lists the live targets routing considered, then the
+// configured ones it never saw, eligible targets first
+func (r *Router) explainTargets(trace *routeTrace, llmReq *llmRequest, strategy string) []explainedTarget {
+	eligible := make(map[string]bool, len(trace.remaining))
+	for _, target := range trace.remaining {
+		eligible[target.Name] = true
+	}
+	scores := make(map[string]float64)
+	if strategy == "score" && len(trace.remaining) > 0 {
+		for i, score := range r.targetScores(trace.remaining) {
+			scores[trace.remaining[i].Name] = score
+		}
+	}
+
+	var explained []explainedTarget
+	seen := make(map[string]bool)
+	for _, target := range trace.candidates {
+		seen[target.Name] = true
+		_, estimate := r.estimateCost(target, llmReq)
+		entry := explainedTarget{
+			Name:          target.Name,
+			Type:          target.Type,
+			Healthy:       target.IsHealthy,
+			Eligible:      eligible[target.Name],
+			ExcludedBy:    trace.excluded[target.Name],
+			Chosen:        trace.chosen == target,
+			Model:         target.Model,
+			Substitute:    target.Substitute,
+			CostPer1K:     target.Cost,
+			EstimatedCost: estimate,
+			LatencyP95Ms:  target.LatencyP95,
+			LatencyEWMAMs: target.LatencyEWMA,
+			QueueDepth:    target.QueueDepth,
+			Weight:        target.Weight,
+		}
+		if entry.Eligible {
+			entry.ExcludedBy = ""
+		}
+		if score, ok := scores[target.Name]; ok {
+			entry.Score = &score
+		}
+		explained = append(explained, entry)
+	}
+
+	// Targets ruled out before routing began
+	unseen := func(name, targetType string, shadow, enabled bool) {
+		if seen[name] {
+			return
+		}
+		reason, ok := trace.excluded[name]
+		healthy := reason != "unhealthy" && !strings.HasPrefix(reason, "latency")
+		switch {
+		case !enabled:
+			reason = "disabled"
+		case shadow:
+			reason = "shadow"
+		case !ok:
+			reason, healthy = "unhealthy", false
+			if metrics, _ := r.healthChecker.GetClusterMetrics(name); metrics.Cordoned {
+				reason, healthy = "cordoned", metrics.Healthy
+			}
+		}
+		explained = append(explained, explainedTarget{
+			Name:       name,
+			Type:       targetType,
+			Healthy:    healthy,
+			ExcludedBy: reason,
+		})
+	}
+	for _, cluster := range r.clusterConfigs() {
+		unseen(cluster.Name, "cluster", cluster.Shadow, true)
+	}
+	for _, providerConfig := range r.providerConfigs() {
+		unseen(providerConfig.Name, "provider", providerConfig.Shadow, providerConfig.Enabled)
+	}
+
+	sort.SliceStable(explained, func(i, j int) bool {
+		if explained[i].Eligible != explained[j].Eligible {
+			return explained[i].Eligible
+		}
+		return explained[i].Name < explained[j].Name
+	})
+	return explained
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/extension"
+	"github.com/sirupsen/logrus"
+)
+
+// applyRequestFilters runs extension request filters, writing the rejection
+// and returning false if one refuses the request. Filter failures fail open.
+func (r *Router) applyRequestFilters(w http.ResponseWriter, req *http.Request, llmReq *llmRequest) bool {
+	if !r.extensions.FiltersRequests() || !json.Valid(llmReq.Body) {
+		return true
+	}
+
+	headers := make(map[string]string, len(req.Header))
+	for name := range req.Header {
+		if name != "Authorization" {
+			headers[name] = req.Header.Get(name)
+		}
+	}
+
+	decision, err := r.extensions.FilterRequest(req.Context(), extension.RequestInput{
+		Endpoint: llmReq.Endpoint,
+		Model:    llmReq.Model,
+		Headers:  headers,
+		Body:     llmReq.Body,
+	})
+	if err != nil {
+		logrus.Warnf("Request filter failed, continuing: %v", err)
+		r.metrics.extensionCalls.WithLabelValues("filter_request", "error").Inc()
+		return true
+	}
+
+	if decision.Action == "reject" {
+		status := decision.Status
+		if status < 400 || status > 499 {
+			status = http.StatusForbidden
+		}
+		message := decision.Message
+		if message == "" {
+			message = "Request rejected by filter"
+		}
+		http.Error(w, message, status)
+		r.metrics.extensionCalls.WithLabelValues("filter_request", "rejected").Inc()
+		r.requestCounter("none", "filtered", llmReq).Inc()
+		return false
+	}
+
+	if len(decision.Body) > 0 {
+		llmReq.Body = decision.Body
+	}
+	r.metrics.extensionCalls.WithLabelValues("filter_request", "ok").Inc()
+	return true
+}
+
+// serveLLMRequest routes the request, passing non-streaming responses
+// through extension response filters when any are loaded
+func (r *Router) serveLLMRequest(w http.ResponseWriter, req *http.Request, llmReq *llmRequest, start time.Time) {
+	if !r.extensions.FiltersResponses() || llmReq.Stream {
+		r.routeLLMRequest(w, req, llmReq, start)
+		return
+	}
+
+	buf := newResponseBuffer()
+	r.routeLLMRequest(buf, req, llmReq, start)
+
+	if json.Valid(buf.Bytes()) {
+		body, err := r.extensions.FilterResponse(req.Context(), extension.ResponseInput{
+			Endpoint: llmReq.Endpoint,
+			Model:    llmReq.Model,
+			Status:   buf.StatusCode(),
+			Body:     buf.Bytes(),
+		})
+		if err != nil {
+			logrus.Warnf("Response filter failed, returning unfiltered response: %v", err)
+			r.metrics.extensionCalls.WithLabelValues("filter_response", "error").Inc()
+		} else {
+			buf.SetBody(body)
+			r.metrics.extensionCalls.WithLabelValues("filter_response", "ok").Inc()
+		}
+	}
+	buf.writeTo(w)
+}
+
+// selectByExtension picks the target a scoring extension ranks lowest,
+// falling back to the hybrid strategy if scoring fails
+func (r *Router) selectByExtension(ctx context.Context, model string, targets []*RouteTarget) *RouteTarget {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	input := extension.ScoreInput{Model: model}
+	for _, target := range targets {
+		input.Targets = append(input.Targets, extension.Candidate{
+			Name:       target.Name,
+			Type:       target.Type,
+			Cost:       target.Cost,
+			LatencyMs:  target.latency(),
+			QueueDepth: target.QueueDepth,
+		})
+	}
+
+	scores, err := r.extensions.Score(ctx, input)
+	if err != nil {
+		logrus.Warnf("Scoring extension failed, using hybrid: %v", err)
+		r.metrics.extensionCalls.WithLabelValues("score", "error").Inc()
+		return r.selectHybrid(targets)
+	}
+	r.metrics.extensionCalls.WithLabelValues("score", "ok").Inc()
+
+	var chosen *RouteTarget
+	best := math.Inf(1)
+	for _, target := range targets {
+		if score, ok := scores[target.Name]; ok && score < best {
+			best = score
+			chosen = target
+		}
+	}
+	if chosen == nil {
+		return r.selectHybrid(targets)
+	}
+
+	chosen.Reason = "extension"
+	return chosen
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// failoverWriter holds back an upstream response until its status is known.
+// Success statuses pass straight through to the client; 5xx and 429
+// responses are captured instead so the request can be replayed against
+// another target.
+type failoverWriter struct {
+	w         http.ResponseWriter
+	header    http.Header
+	committed bool // the client has received a status line
+	failed    bool // the upstream answered 5xx or 429
+	failure   *responseBuffer
+}
+
+func newFailoverWriter(w http.ResponseWriter) *failoverWriter {
+	return &failoverWriter{w: w, header: make(http.Header)}
+}
+
+// Header is held back until the status is known; once committed it is the
+// client's, so values set after the body become trailers
+func (fw *failoverWriter) Header() http.Header {
+	if fw.committed {
+		return fw.w.Header()
+	}
+	return fw.header
+}
+
+func (fw *failoverWriter) WriteHeader(status int) {
+	if fw.committed || fw.failed {
+		return
+	}
+
+	if status >= 500 || status == http.StatusTooManyRequests {
+		fw.failed = true
+		fw.failure = newResponseBuffer()
+		for name, values := range fw.header {
+			fw.failure.Header()[name] = values
+		}
+		fw.failure.WriteHeader(status)
+		return
+	}
+
+	for name, values := range fw.header {
+		fw.w.Header()[name] = values
+	}
+	fw.committed = true
+	fw.w.WriteHeader(status)
+}
+
+func (fw *failoverWriter) Write(p []byte) (int, error) {
+	if !fw.committed && !fw.failed {
+		fw.WriteHeader(http.StatusOK)
+	}
+	if fw.failed {
+		return fw.failure.Write(p)
+	}
+	return fw.w.Write(p)
+}
+
+func (fw *failoverWriter) Flush() {
+	if !fw.committed {
+		return
+	}
+	if flusher, ok := fw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// nextFallback returns the first healthy target after failed in
+// router.fallbackOrder that hasn't been tried yet, claimed with
+// claimTarget. Targets outside the chain fail over to its head.
+func (r *Router) nextFallback(ctx context.Context, llmReq *llmRequest, failed string) (*RouteTarget, func(), bool) {
+	chain := r.policy.get().FallbackOrder
+	if len(chain) == 0 {
+		return nil, nil, false
+	}
+
+	rest := chain
+	for i, name := range chain {
+		if name == failed {
+			rest = chain[i+1:]
+			break
+		}
+	}
+
+	live := make(map[string]*RouteTarget)
+	for _, target := range r.getAllTargets(ctx) {
+		live[target.Name] = target
+	}
+
+	for _, name := range rest {
+		target, healthy := live[name]
+		if !healthy || !r.canTakeOver(target, llmReq) {
+			continue
+		}
+
+		if release, ok := r.claimTarget(target, llmReq); ok {
+			return target, release, true
+		}
+		logrus.WithContext(ctx).Debugf("Skipping fallback %s: cluster group at capacity, circuit open or rate limited", name)
+	}
+	return nil, nil, false
+}
+
+// canTakeOver reports whether a target may take over a request another
+// target didn't serve: it is in the sandbox for demo sessions, allowed for
+// the tenant and pool, serves the endpoint and model, and fits the cost
+// ceiling, context window, images and parameters as selection would have
+// required
+func (r *Router) canTakeOver(target *RouteTarget, llmReq *llmRequest) bool {
+	if llmReq.Exclude[target.Name] || (llmReq.Demo && !r.inSandbox(target.Name)) || !r.tenantAllows(llmReq, target.Name, target.Type) || !r.poolAllows(llmReq, target.Name) || !servesEndpoint(target, llmReq.Endpoint) {
+		return false
+	}
+
+	candidates := []*RouteTarget{target}
+	if _, ok := r.filterByModel(candidates, llmReq.Model); !ok && r.config.Router.StrictModelRouting {
+		return false
+	}
+	if target.Substitute != "" && !r.substitutionAllowed(llmReq) {
+		return false
+	}
+	if _, estimate := r.estimateCost(target, llmReq); llmReq.MaxCost > 0 && estimate > llmReq.MaxCost {
+		return false
+	}
+	if fits, _ := r.filterByContextWindow(candidates, llmReq); len(fits) == 0 {
+		return false
+	}
+	if seeing, _ := r.filterByVision(candidates, llmReq); len(seeing) == 0 {
+		return false
+	}
+	honoring, _ := r.filterByParameters(candidates, llmReq)
+	return len(honoring) > 0
+}
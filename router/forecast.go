@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/auth"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/usagestore"
+	"github.com/sirupsen/logrus"
+)
+
+// targetForecast projects one target's spend to the end of the month
+type targetForecast struct {
+	Target     string  `json:"target"`
+	TargetType string  `json:"target_type"` // "cluster" or "provider"
+	Provider   string  `json:"provider"`
+	Spent      float64 `json:"spent_usd"`      // this month so far
+	DailyRate  float64 `json:"daily_rate_usd"` // over the run rate window
+	Projected  float64 `json:"projected_usd"`  // spent plus the rate for the rest of the month
+}
+
+// budgetForecast compares projected spend with a monthly budget
+type budgetForecast struct {
+	Name       string   `json:"name"` // "external", or a cluster group
+	Budget     float64  `json:"monthly_budget_usd"`
+	Spent      float64  `json:"spent_usd"`
+	Projected  float64  `json:"projected_usd"`
+	WillExceed bool     `json:"will_exceed"`
+	ExceedsOn  string   `json:"exceeds_on,omitempty"` // UTC date the run rate reaches the budget
+	Targets    []string `json:"targets"`
+}
+
+// forecastHandler projects end-of-month spend per target from the usage
+// store: month-to-date spend plus the daily run rate over the last ?days
+// whole UTC days and today (default 7, shortened when the store holds
+// less) for the days left.
+// Projections are checked against the external budget and cluster group
+// budgets. ?tenant narrows the forecast to one tenant, checked against its
+// quota instead; tenant callers only see their own, and under /v1 only
+// tenant callers are served, see requireTenant.
+func (r *Router) forecastHandler(w http.ResponseWriter, req *http.Request) {
+	if r.usageStore == nil {
+		http.Error(w, "Usage store is not enabled", http.StatusNotFound)
+		return
+	}
+
+	params := req.URL.Query()
+	days := 7
+	if raw := params.Get("days"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 || parsed > 90 {
+			http.Error(w, "Invalid days: expected 1 to 90", http.StatusBadRequest)
+			return
+		}
+		days = parsed
+	}
+	tenant := params.Get("tenant")
+	if id := auth.FromContext(req.Context()); id != nil && id.Tenant != "" {
+		if tenant != "" && tenant != id.Tenant {
+			http.Error(w, "Usage of other tenants is not visible to this caller", http.StatusForbidden)
+			return
+		}
+		tenant = id.Tenant
+	}
+
+	now := time.Now().UTC()
+	monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	monthEnd := monthStart.AddDate(0, 1, 0)
+	// Whole UTC days, so the window lines up with the day groups
+	windowStart := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, -days)
+
+	summaries, err := r.usageStore.Aggregate(req.Context(), usagestore.Query{
+		From: monthStart, To: now, Tenant: tenant, GroupBy: []string{"target", "target_type", "provider"},
+	})
+	if err == nil {
+		var window []usagestore.Summary
+		window, err = r.usageStore.Aggregate(req.Context(), usagestore.Query{
+			From: windowStart, To: now, Tenant: tenant, GroupBy: []string{"target", "target_type", "provider", "day"},
+		})
+		summaries = append(summaries, window...)
+	}
+	if err != nil {
+		logrus.Errorf("Failed to query usage: %v", err)
+		http.Error(w, "Failed to query usage", http.StatusInternalServerError)
+		return
+	}
+
+	byTarget := make(map[string]*targetForecast)
+	windowCost := make(map[string]float64)
+	firstDay := ""
+	for _, summary := range summaries {
+		target := summary.Group["target"]
+		forecast := byTarget[target]
+		if forecast == nil {
+			forecast = &targetForecast{Target: target, TargetType: summary.Group["target_type"], Provider: summary.Group["provider"]}
+			byTarget[target] = forecast
+		}
+		if day, ok := summary.Group["day"]; ok {
+			windowCost[target] += summary.Cost
+			if firstDay == "" || day < firstDay {
+				firstDay = day
+			}
+		} else {
+			forecast.Spent += summary.Cost
+		}
+	}
+
+	// A store younger than the window has no history to spread over
+	if first, err := time.Parse("2006-01-02", firstDay); err == nil && first.After(windowStart) {
+		windowStart = first
+	}
+	windowDays := now.Sub(windowStart).Hours() / 24
+	remainingDays := monthEnd.Sub(now).Hours() / 24
+
+	forecasts := make([]*targetForecast, 0, len(byTarget))
+	var totals targetForecast
+	for target, forecast := range byTarget {
+		if windowDays > 0 {
+			forecast.DailyRate = windowCost[target] / windowDays
+		}
+		forecast.Projected = forecast.Spent + forecast.DailyRate*remainingDays
+		totals.Spent += forecast.Spent
+		totals.DailyRate += forecast.DailyRate
+		totals.Projected += forecast.Projected
+		forecasts = append(forecasts, forecast)
+	}
+	sort.Slice(forecasts, func(i, j int) bool { return forecasts[i].Projected > forecasts[j].Projected })
+
+	// Budgets cover a set of targets
+	compare := func(name string, budget float64, member func(*targetForecast) bool) *budgetForecast {
+		result := &budgetForecast{Name: name, Budget: budget, Targets: []string{}}
+		rate := 0.0
+		for _, forecast := range forecasts {
+			if member(forecast) {
+				result.Spent += forecast.Spent
+				result.Projected += forecast.Projected
+				rate += forecast.DailyRate
+				result.Targets = append(result.Targets, forecast.Target)
+			}
+		}
+		result.WillExceed = result.Projected > budget
+		if result.WillExceed {
+			at := now
+			if result.Spent < budget {
+				at = now.Add(time.Duration((budget - result.Spent) / rate * float64(24*time.Hour)))
+			}
+			result.ExceedsOn = at.Format("2006-01-02")
+		}
+		return result
+	}
+	budgets := []*budgetForecast{}
+	if tenant != "" {
+		if status, ok := r.quotas.Status()[tenant]; ok && status.MonthlyBudget > 0 {
+			budgets = append(budgets, compare("tenant:"+tenant, status.MonthlyBudget, func(*targetForecast) bool { return true }))
+		}
+	} else {
+		if status := r.budget.Status(); status.MonthlyBudget > 0 {
+			budgets = append(budgets, compare("external", status.MonthlyBudget, func(f *targetForecast) bool {
+				return f.TargetType == "provider"
+			}))
+		}
+		for _, group := range r.groups.Status() {
+			if group.MonthlyBudget <= 0 {
+				continue
+			}
+			members := make(map[string]bool, len(group.Clusters))
+			for _, cluster := range group.Clusters {
+				members[cluster] = true
+			}
+			budgets = append(budgets, compare(group.Name, group.MonthlyBudget, func(f *targetForecast) bool {
+				return members[f.Target]
+			}))
+		}
+	}
+
+	report := map[string]interface{}{
+		"month":          monthStart.Format("2006-01"),
+		"as_of":          now,
+		"window_days":    math.Round(windowDays*100) / 100,
+		"remaining_days": math.Round(remainingDays*100) / 100,
+		"targets":        forecasts,
+		"totals":         map[string]float64{"spent_usd": totals.Spent, "daily_rate_usd": totals.DailyRate, "projected_usd": totals.Projected},
+		"budgets":        budgets,
+	}
+	if tenant != "" {
+		report["tenant"] = tenant
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/glossary"
+)
+
+// glossaryWriter restores glossary replacements in a target's response.
+// Whole bodies are restored once complete; streams are restored per SSE
+// event, holding back text that may be a replacement split across chunks.
+type glossaryWriter struct {
+	w      http.ResponseWriter
+	sub    *glossary.Substitution
+	stream bool
+	buf    []byte           // the whole body, or an unterminated SSE line
+	held   map[int]heldText // per choice index
+}
+
+type heldText struct {
+	key  string // "content" in chat deltas, "text" in completions
+	text string
+}
+
+func newGlossaryWriter(w http.ResponseWriter, sub *glossary.Substitution, stream bool) *glossaryWriter {
+	return &glossaryWriter{w: w, sub: sub, stream: stream, held: make(map[int]heldText)}
+}
+
+func (g *glossaryWriter) Header() http.Header {
+	return g.w.Header()
+}
+
+func (g *glossaryWriter) WriteHeader(status int) {
+	// Restored terms change the body length
+	g.w.Header().Del("Content-Length")
+	g.w.WriteHeader(status)
+}
+
+func (g *glossaryWriter) Write(p []byte) (int, error) {
+	g.buf = append(g.buf, p...)
+	if !g.stream {
+		return len(p), nil
+	}
+	for {
+		i := bytes.IndexByte(g.buf, '\n')
+		if i < 0 {
+			break
+		}
+		g.writeLine(g.buf[:i])
+		g.buf = g.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (g *glossaryWriter) Flush() {
+	if flusher, ok := g.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close writes whatever is still buffered
+func (g *glossaryWriter) Close() {
+	if !g.stream {
+		g.w.Write(g.sub.RestoreJSON(g.buf))
+		return
+	}
+	if len(g.buf) > 0 {
+		g.writeLine(g.buf)
+		g.buf = nil
+	}
+	g.writeHeld()
+}
+
+func (g *glossaryWriter) writeLine(line []byte) {
+	payload, ok := bytes.CutPrefix(line, []byte("data:"))
+	payload = bytes.TrimSpace(payload)
+	if !ok {
+		g.w.Write(append(line, '\n'))
+		return
+	}
+	if string(payload) == "[DONE]" {
+		g.writeHeld()
+		g.w.Write(append(line, '\n'))
+		return
+	}
+
+	var chunk map[string]interface{}
+	if err := json.Unmarshal(payload, &chunk); err != nil {
+		g.w.Write(append(line, '\n'))
+		return
+	}
+	choices, _ := chunk["choices"].([]interface{})
+	for _, item := range choices {
+		choice, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		index, _ := choice["index"].(float64)
+		field, key := choice, "text"
+		if delta, ok := choice["delta"].(map[string]interface{}); ok {
+			field, key = delta, "content"
+		}
+		text, isText := field[key].(string)
+		held := g.held[int(index)]
+		if !isText && held.text == "" {
+			continue
+		}
+
+		restored, rest := g.sub.RestoreText(held.text + text)
+		if choice["finish_reason"] != nil {
+			restored, rest = restored+rest, ""
+		}
+		field[key] = restored
+		g.held[int(index)] = heldText{key: key, text: rest}
+	}
+
+	encoded, err := json.Marshal(chunk)
+	if err != nil {
+		g.w.Write(append(line, '\n'))
+		return
+	}
+	g.w.Write(append(append([]byte("data: "), encoded...), '\n'))
+}
+
+// writeHeld emits text still held back when a stream ends without a
+// finishing chunk
+func (g *glossaryWriter) writeHeld() {
+	for index, held := range g.held {
+		if held.text == "" {
+			continue
+		}
+		choice := map[string]interface{}{"index": index}
+		if held.key == "content" {
+			choice["delta"] = map[string]string{"content": held.text}
+		} else {
+			choice["text"] = held.text
+		}
+		encoded, _ := json.Marshal(map[string]interface{}{"choices": []interface{}{choice}})
+		g.w.Write(append(append([]byte("data: "), encoded...), '\n', '\n'))
+		g.held[index] = heldText{}
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// hedgeableEndpoints are safe to send twice: they only generate output
+var hedgeableEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+	"/v1/embeddings":       true,
+}
+
+// hedgeable reports whether a request may be hedged. Streams are excluded
+// because their first bytes commit the response to one target, and batch
+// requests because nobody waits on their latency.
+func (r *Router) hedgeable(llmReq *llmRequest) bool {
+	return r.strategies.Get().Hedging.Enabled && !llmReq.Stream && !llmReq.Batch && hedgeableEndpoints[llmReq.Endpoint]
+}
+
+// hedgeResult is one racer's buffered outcome
+type hedgeResult struct {
+	target *RouteTarget
+	fw     *failoverWriter
+	buf    *responseBuffer
+	err    error
+}
+
+// forwardHedged sends the request to target and, each time the hedging delay
+// passes without a response, to another selected target, up to maxHedges
+// extra copies. The first success is written to fw and the rest are
+// cancelled. If every racer fails, the last failure is written to fw. It
+// returns the target whose response was written.
+func (r *Router) forwardHedged(ctx context.Context, fw *failoverWriter, req *http.Request, target *RouteTarget, release func(), llmReq *llmRequest, start time.Time) (*RouteTarget, error) {
+	config := r.strategies.Get().Hedging
+
+	raceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult)
+	race := func(target *RouteTarget, release func()) {
+		buf := newResponseBuffer()
+		racerFW := newFailoverWriter(buf)
+		err := r.forwardAttempt(raceCtx, racerFW, req.WithContext(raceCtx), target, llmReq, start)
+		release()
+		results <- hedgeResult{target: target, fw: racerFW, buf: buf, err: err}
+	}
+
+	delay := time.Duration(config.Delay)
+	if config.DelayFromP95 && target.LatencyP95 > 0 {
+		delay = time.Duration(target.LatencyP95 * float64(time.Millisecond))
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	primary := target.Name
+	go race(target, release)
+	running, hedges := 1, 0
+	var last hedgeResult
+
+	for running > 0 {
+		select {
+		case <-timer.C:
+			if hedges >= config.MaxHedges {
+				continue
+			}
+			llmReq.Exclude[target.Name] = true
+			hedge, hedgeRelease, err := r.selectAndClaim(ctx, llmReq)
+			if err != nil {
+				logrus.WithContext(ctx).Debugf("No target to hedge %s with: %v", target.Name, err)
+				continue
+			}
+			hedges++
+			running++
+			logrus.WithContext(ctx).Debugf("Hedging request to %s after %v with %s", target.Name, delay, hedge.Name)
+			r.metrics.hedges.WithLabelValues("sent").Inc()
+			r.decide(hedge, "hedge")
+			target = hedge
+			go race(hedge, hedgeRelease)
+			timer.Reset(delay)
+
+		case result := <-results:
+			running--
+			if result.err == nil && !result.fw.failed {
+				cancel()
+				// Drain the cancelled racers so their goroutines can exit
+				go func(n int) {
+					for ; n > 0; n-- {
+						<-results
+					}
+				}(running)
+				if hedges > 0 {
+					outcome := "primary_won"
+					if result.target.Name != primary {
+						outcome = "hedge_won"
+					}
+					r.metrics.hedges.WithLabelValues(outcome).Inc()
+				}
+				result.buf.writeTo(fw)
+				return result.target, nil
+			}
+			// A primary that fails before the delay leaves the race to failover
+			llmReq.Exclude[result.target.Name] = true
+			last = result
+		}
+	}
+
+	if last.fw.failed {
+		last.fw.failure.writeTo(fw)
+	}
+	return last.target, last.err
+}
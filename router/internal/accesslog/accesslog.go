@@ -0,0 +1,100 @@
+// Package accesslog writes one JSON line per request served, to stdout, a
+// file or syslog
+package accesslog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Config chooses where the access log goes
+type Config struct {
+	Sink   string       `yaml:"sink"` // "stdout" (default), "file", "syslog" or "none"
+	Path   string       `yaml:"path"` // file sink, appended to
+	Syslog SyslogConfig `yaml:"syslog"`
+}
+
+// SyslogConfig addresses a syslog daemon; an empty address uses the local one
+type SyslogConfig struct {
+	Network string `yaml:"network"` // "udp", "tcp" or "unix"; empty for the local daemon
+	Address string `yaml:"address"`
+	Tag     string `yaml:"tag"` // default "llm-router"
+}
+
+// Entry is one request's line
+type Entry struct {
+	Time             time.Time `json:"time"`
+	RequestID        string    `json:"request_id,omitempty"`
+	Method           string    `json:"method"`
+	Path             string    `json:"path"`
+	Status           int       `json:"status"`
+	LatencyMs        float64   `json:"latency_ms"`
+	Bytes            int64     `json:"bytes"`
+	Tenant           string    `json:"tenant,omitempty"`
+	Model            string    `json:"model,omitempty"`
+	Stream           bool      `json:"stream,omitempty"`
+	Target           string    `json:"target,omitempty"`
+	TargetType       string    `json:"target_type,omitempty"`
+	Reason           string    `json:"reason,omitempty"` // routing decision that chose the target
+	Attempts         int       `json:"attempts,omitempty"`
+	PromptTokens     int       `json:"prompt_tokens,omitempty"`
+	CompletionTokens int       `json:"completion_tokens,omitempty"`
+	ReasoningTokens  int       `json:"reasoning_tokens,omitempty"`
+	TokensEstimated  bool      `json:"tokens_estimated,omitempty"`
+	Cost             float64   `json:"cost_usd"`
+	Error            string    `json:"error,omitempty"` // last upstream failure
+}
+
+// Logger writes entries to the configured sink
+type Logger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// New opens the sink, or returns nil when access logging is off
+func New(config Config) (*Logger, error) {
+	switch config.Sink {
+	case "none":
+		return nil, nil
+	case "", "stdout":
+		return &Logger{w: os.Stdout}, nil
+	case "file":
+		if config.Path == "" {
+			return nil, fmt.Errorf("file sink needs a path")
+		}
+		f, err := os.OpenFile(config.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		return &Logger{w: f}, nil
+	case "syslog":
+		tag := config.Syslog.Tag
+		if tag == "" {
+			tag = "llm-router"
+		}
+		w, err := dialSyslog(config.Syslog.Network, config.Syslog.Address, tag)
+		if err != nil {
+			return nil, fmt.Errorf("syslog: %w", err)
+		}
+		return &Logger{w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown sink %q, expected stdout, file, syslog or none", config.Sink)
+	}
+}
+
+// Log writes entry as one line. Failures are dropped: a full disk or an
+// unreachable syslog must not fail requests.
+func (l *Logger) Log(entry Entry) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return
+	}
+	line = append(line, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.w.Write(line)
+}
@@ -0,0 +1,12 @@
+//go:build !windows && !plan9
+
+package accesslog
+
+import (
+	"io"
+	"log/syslog"
+)
+
+func dialSyslog(network, address, tag string) (io.Writer, error) {
+	return syslog.Dial(network, address, syslog.LOG_INFO|syslog.LOG_LOCAL0, tag)
+}
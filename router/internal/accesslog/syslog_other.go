@@ -0,0 +1,12 @@
+//go:build windows || plan9
+
+package accesslog
+
+import (
+	"errors"
+	"io"
+)
+
+func dialSyslog(network, address, tag string) (io.Writer, error) {
+	return nil, errors.New("not supported on this platform")
+}
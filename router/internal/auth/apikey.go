@@ -0,0 +1,171 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// APIKeysConfig admits callers presenting a static key, as a bearer token
+// or in X-API-Key. Keys can also be issued at runtime through the admin API.
+type APIKeysConfig struct {
+	Enabled bool     `yaml:"enabled"`
+	Keys    []APIKey `yaml:"keys"`
+}
+
+// APIKey maps a key to the tenant its callers belong to
+type APIKey struct {
+	Name   string `yaml:"name"` // shown in logs and the admin API, default the tenant
+	Key    string `yaml:"key"`  // e.g. ${ANALYTICS_API_KEY} or a secret reference
+	Tenant string `yaml:"tenant"`
+}
+
+// APIKeyInfo describes a key without revealing it
+type APIKeyInfo struct {
+	ID        string     `json:"id"` // stable, derived from the key's hash
+	Name      string     `json:"name"`
+	Tenant    string     `json:"tenant"`
+	Source    string     `json:"source"` // "config" or "admin"
+	CreatedAt *time.Time `json:"created_at,omitempty"`
+	Hash      string     `json:"hash,omitempty"` // SHA-256 of the key, hex; kept out of admin responses
+}
+
+// apiKeyPrefix marks keys GenerateAPIKey issues, so leaked ones are easy
+// to scan for
+const apiKeyPrefix = "lr-"
+
+var (
+	// ErrAPIKeyExists is returned when adding a key already in use
+	ErrAPIKeyExists = errors.New("api key already exists")
+	// ErrAPIKeyFromConfig is returned when changing a key the config file defines
+	ErrAPIKeyFromConfig = errors.New("api key is defined in the config file")
+)
+
+// apiKeys holds the accepted keys by hash
+type apiKeys struct {
+	mu     sync.RWMutex
+	byHash map[string]*APIKeyInfo
+}
+
+func newAPIKeys(config APIKeysConfig) *apiKeys {
+	keys := &apiKeys{byHash: make(map[string]*APIKeyInfo)}
+	for _, key := range config.Keys {
+		if key.Key == "" {
+			continue
+		}
+		name := key.Name
+		if name == "" {
+			name = key.Tenant
+		}
+		hash := HashAPIKey(key.Key)
+		keys.byHash[hash] = &APIKeyInfo{ID: hash[:16], Name: name, Tenant: key.Tenant, Source: "config", Hash: hash}
+	}
+	return keys
+}
+
+// HashAPIKey is how keys are stored and looked up
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// GenerateAPIKey returns a new random key
+func GenerateAPIKey() string {
+	b := make([]byte, 24)
+	rand.Read(b)
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(b)
+}
+
+func apiKeyFrom(req *http.Request) (string, bool) {
+	if key := strings.TrimSpace(req.Header.Get("X-API-Key")); key != "" {
+		return key, true
+	}
+	return bearerToken(req)
+}
+
+func (k *apiKeys) lookup(key string) (*Identity, bool) {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	info, ok := k.byHash[HashAPIKey(key)]
+	if !ok {
+		return nil, false
+	}
+	return &Identity{Tenant: info.Tenant, Subject: info.Name, Method: "apikey"}, true
+}
+
+// AddAPIKey accepts a key issued at runtime. info.Hash must be set; the
+// ID is derived from it.
+func (a *Authenticator) AddAPIKey(info APIKeyInfo) (APIKeyInfo, error) {
+	a.apiKeys.mu.Lock()
+	defer a.apiKeys.mu.Unlock()
+	if _, ok := a.apiKeys.byHash[info.Hash]; ok {
+		return APIKeyInfo{}, ErrAPIKeyExists
+	}
+	info.ID = info.Hash[:16]
+	info.Source = "admin"
+	a.apiKeys.byHash[info.Hash] = &info
+	return info, nil
+}
+
+// UpdateAPIKey changes a runtime key's name and tenant
+func (a *Authenticator) UpdateAPIKey(id, name, tenant string) (APIKeyInfo, bool, error) {
+	a.apiKeys.mu.Lock()
+	defer a.apiKeys.mu.Unlock()
+	for _, info := range a.apiKeys.byHash {
+		if info.ID != id {
+			continue
+		}
+		if info.Source == "config" {
+			return APIKeyInfo{}, true, ErrAPIKeyFromConfig
+		}
+		if name != "" {
+			info.Name = name
+		}
+		if tenant != "" {
+			info.Tenant = tenant
+		}
+		return *info, true, nil
+	}
+	return APIKeyInfo{}, false, nil
+}
+
+// RemoveAPIKey stops accepting a runtime key
+func (a *Authenticator) RemoveAPIKey(id string) (bool, error) {
+	a.apiKeys.mu.Lock()
+	defer a.apiKeys.mu.Unlock()
+	for hash, info := range a.apiKeys.byHash {
+		if info.ID != id {
+			continue
+		}
+		if info.Source == "config" {
+			return true, ErrAPIKeyFromConfig
+		}
+		delete(a.apiKeys.byHash, hash)
+		return true, nil
+	}
+	return false, nil
+}
+
+// APIKeys lists the accepted keys, config ones first, then by name
+func (a *Authenticator) APIKeys() []APIKeyInfo {
+	a.apiKeys.mu.RLock()
+	defer a.apiKeys.mu.RUnlock()
+	keys := make([]APIKeyInfo, 0, len(a.apiKeys.byHash))
+	for _, info := range a.apiKeys.byHash {
+		keys = append(keys, *info)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Source != keys[j].Source {
+			return keys[i].Source == "config"
+		}
+		return keys[i].Name < keys[j].Name
+	})
+	return keys
+}
@@ -0,0 +1,256 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Config selects how /v1 callers authenticate. With no method
+// configured the API is open, as it always has been.
+type Config struct {
+	OIDC    OIDCConfig    `yaml:"oidc"`
+	MTLS    MTLSConfig    `yaml:"mtls"`
+	APIKeys APIKeysConfig `yaml:"apiKeys"`
+}
+
+// OIDCConfig validates OAuth2 client-credential access tokens
+type OIDCConfig struct {
+	Enabled        bool              `yaml:"enabled"`
+	Issuer         string            `yaml:"issuer"`         // required "iss"
+	Audience       string            `yaml:"audience"`       // required "aud", skipped if empty
+	JWKSURL        string            `yaml:"jwksURL"`        // default: discovered from the issuer
+	JWKSCacheTTL   time.Duration     `yaml:"jwksCacheTTL"`   // default 1h
+	TenantClaim    string            `yaml:"tenantClaim"`    // default: client_id, then azp, then sub
+	RequiredScopes []string          `yaml:"requiredScopes"` // all must appear in "scope" or "scp"
+	Tenants        map[string]string `yaml:"tenants"`        // claim value -> tenant, only listed clients are admitted
+}
+
+// MTLSConfig attributes callers presenting a verified client certificate.
+// The certificate is verified by the server's TLS listener.
+type MTLSConfig struct {
+	Enabled    bool              `yaml:"enabled"`
+	TenantFrom string            `yaml:"tenantFrom"` // cn (default), o, ou, dns, uri or email
+	Tenants    map[string]string `yaml:"tenants"`    // subject value -> tenant, only listed subjects are admitted
+}
+
+// Identity is an authenticated caller
+type Identity struct {
+	Tenant  string `json:"tenant"`
+	Subject string `json:"subject"`
+	Method  string `json:"method"` // "oidc", "mtls", "apikey", or "demo" for router demo sessions
+}
+
+type contextKey struct{}
+
+// WithIdentity attaches an identity to a request context
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request's identity, or nil for anonymous requests
+func FromContext(ctx context.Context) *Identity {
+	id, _ := ctx.Value(contextKey{}).(*Identity)
+	return id
+}
+
+// ErrNoCredentials is returned when a request carries no bearer token, API
+// key or client certificate
+var ErrNoCredentials = errors.New("no credentials")
+
+// Authenticator resolves callers to tenants
+type Authenticator struct {
+	config  Config
+	apiKeys *apiKeys
+
+	mu   sync.Mutex
+	keys *keySet
+}
+
+// New creates an authenticator, applying defaults
+func New(config Config) *Authenticator {
+	if config.OIDC.JWKSCacheTTL == 0 {
+		config.OIDC.JWKSCacheTTL = time.Hour
+	}
+	if config.MTLS.TenantFrom == "" {
+		config.MTLS.TenantFrom = "cn"
+	}
+	return &Authenticator{config: config, apiKeys: newAPIKeys(config.APIKeys)}
+}
+
+// Enabled reports whether any method is configured
+func (a *Authenticator) Enabled() bool {
+	return a.config.OIDC.Enabled || a.config.MTLS.Enabled || a.config.APIKeys.Enabled
+}
+
+// Authenticate checks a request's API key or bearer token, then its client
+// certificate. A bearer token that is not a known key is tried as an OIDC
+// access token.
+func (a *Authenticator) Authenticate(req *http.Request) (*Identity, error) {
+	if a.config.APIKeys.Enabled {
+		if key, ok := apiKeyFrom(req); ok {
+			if id, ok := a.apiKeys.lookup(key); ok {
+				return id, nil
+			}
+			if _, bearer := bearerToken(req); !bearer || !a.config.OIDC.Enabled {
+				return nil, errors.New("unknown api key")
+			}
+		}
+	}
+	if a.config.OIDC.Enabled {
+		if token, ok := bearerToken(req); ok {
+			return a.verifyToken(req.Context(), token)
+		}
+	}
+	if a.config.MTLS.Enabled && req.TLS != nil && len(req.TLS.VerifiedChains) > 0 {
+		return a.verifyCert(req.TLS.VerifiedChains[0][0])
+	}
+	return nil, ErrNoCredentials
+}
+
+func bearerToken(req *http.Request) (string, bool) {
+	header := req.Header.Get("Authorization")
+	if len(header) > 7 && strings.EqualFold(header[:7], "Bearer ") {
+		return strings.TrimSpace(header[7:]), true
+	}
+	return "", false
+}
+
+func (a *Authenticator) verifyToken(ctx context.Context, token string) (*Identity, error) {
+	config := a.config.OIDC
+
+	claims, err := Verify(token, func(alg, kid string) (interface{}, error) {
+		if strings.HasPrefix(alg, "HS") {
+			return nil, fmt.Errorf("algorithm %s is not accepted for access tokens", alg)
+		}
+		keys, err := a.keySet(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return keys.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.String("iss") != config.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", claims.String("iss"))
+	}
+	if _, ok := claims["exp"]; !ok {
+		return nil, errors.New("token has no expiry")
+	}
+	if config.Audience != "" && !contains(claims.Strings("aud"), config.Audience) {
+		return nil, fmt.Errorf("token is not issued for audience %s", config.Audience)
+	}
+	scopes := append(claims.Strings("scope"), claims.Strings("scp")...)
+	for _, scope := range config.RequiredScopes {
+		if !contains(scopes, scope) {
+			return nil, fmt.Errorf("token is missing scope %s", scope)
+		}
+	}
+
+	subject := tenantClaim(claims, config.TenantClaim)
+	if subject == "" {
+		return nil, errors.New("token has no tenant claim")
+	}
+	tenant, err := mapTenant(config.Tenants, subject)
+	if err != nil {
+		return nil, err
+	}
+	return &Identity{Tenant: tenant, Subject: subject, Method: "oidc"}, nil
+}
+
+// keySet resolves the JWKS URL on first use, so an unreachable identity
+// provider does not stop the router from starting
+func (a *Authenticator) keySet(ctx context.Context) (*keySet, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.keys != nil {
+		return a.keys, nil
+	}
+	url := a.config.OIDC.JWKSURL
+	if url == "" {
+		var err error
+		if url, err = discoverJWKS(ctx, a.config.OIDC.Issuer); err != nil {
+			return nil, err
+		}
+	}
+	a.keys = newKeySet(url, a.config.OIDC.JWKSCacheTTL)
+	return a.keys, nil
+}
+
+func tenantClaim(claims Claims, name string) string {
+	if name != "" {
+		return claims.String(name)
+	}
+	for _, name := range []string{"client_id", "azp", "sub"} {
+		if value := claims.String(name); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func (a *Authenticator) verifyCert(cert *x509.Certificate) (*Identity, error) {
+	var values []string
+	switch a.config.MTLS.TenantFrom {
+	case "cn":
+		values = []string{cert.Subject.CommonName}
+	case "o":
+		values = cert.Subject.Organization
+	case "ou":
+		values = cert.Subject.OrganizationalUnit
+	case "dns":
+		values = cert.DNSNames
+	case "email":
+		values = cert.EmailAddresses
+	case "uri":
+		for _, uri := range cert.URIs {
+			values = append(values, uri.String())
+		}
+	default:
+		return nil, fmt.Errorf("unknown tenantFrom %q", a.config.MTLS.TenantFrom)
+	}
+
+	var lastErr error = fmt.Errorf("certificate has no %s", a.config.MTLS.TenantFrom)
+	for _, subject := range values {
+		if subject == "" {
+			continue
+		}
+		tenant, err := mapTenant(a.config.MTLS.Tenants, subject)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return &Identity{Tenant: tenant, Subject: subject, Method: "mtls"}, nil
+	}
+	return nil, lastErr
+}
+
+// mapTenant looks a subject up in an explicit mapping; without one the
+// subject itself is the tenant
+func mapTenant(tenants map[string]string, subject string) (string, error) {
+	if len(tenants) == 0 {
+		return subject, nil
+	}
+	tenant, ok := tenants[subject]
+	if !ok {
+		return "", fmt.Errorf("%s is not mapped to a tenant", subject)
+	}
+	return tenant, nil
+}
+
+func contains(values []string, want string) bool {
+	for _, v := range values {
+		if v == want {
+			return true
+		}
+	}
+	return false
+}
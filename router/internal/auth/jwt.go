@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Claims are the decoded JWT payload
+type Claims map[string]interface{}
+
+// String returns a string claim, or "" if absent or not a string
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns a claim that may be a single string, a space-separated
+// string (OAuth2 "scope") or an array of strings
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+func (c Claims) time(name string) (time.Time, bool) {
+	n, ok := c[name].(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(n), 0), true
+}
+
+// header is the JOSE header
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Typ string `json:"typ"`
+}
+
+// KeyFunc returns the verification key for a token's header: *rsa.PublicKey,
+// *ecdsa.PublicKey, or []byte for HMAC
+type KeyFunc func(alg, kid string) (interface{}, error)
+
+// leeway tolerates clock skew when checking exp and nbf
+const leeway = 30 * time.Second
+
+var errMalformed = errors.New("malformed token")
+
+// ErrExpired is returned for a correctly signed token past its exp
+var ErrExpired = errors.New("token expired")
+
+// Verify checks a compact JWS signature and the exp/nbf claims, returning
+// the claims. The "none" algorithm is never accepted.
+func Verify(token string, keyFunc KeyFunc) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errMalformed
+	}
+
+	var h header
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, errMalformed
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errMalformed
+	}
+
+	key, err := keyFunc(h.Alg, h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := verifySignature(h.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errMalformed
+	}
+
+	now := time.Now()
+	if exp, ok := claims.time("exp"); ok && now.After(exp.Add(leeway)) {
+		return nil, ErrExpired
+	}
+	if nbf, ok := claims.time("nbf"); ok && now.Add(leeway).Before(nbf) {
+		return nil, errors.New("token not yet valid")
+	}
+	return claims, nil
+}
+
+// SignHS256 issues a compact HS256 JWT for claims
+func SignHS256(claims Claims, secret []byte) (string, error) {
+	headerJSON, _ := json.Marshal(header{Alg: "HS256", Typ: "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signing := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signing))
+	return signing + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func hashFor(alg string) (crypto.Hash, func() hash.Hash, error) {
+	switch alg[2:] {
+	case "256":
+		return crypto.SHA256, sha256.New, nil
+	case "384":
+		return crypto.SHA384, sha512.New384, nil
+	case "512":
+		return crypto.SHA512, sha512.New, nil
+	}
+	return 0, nil, fmt.Errorf("unsupported algorithm %s", alg)
+}
+
+func verifySignature(alg string, key interface{}, signing, signature []byte) error {
+	if len(alg) != 5 {
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	hashID, newHash, err := hashFor(alg)
+	if err != nil {
+		return err
+	}
+
+	switch alg[:2] {
+	case "HS":
+		secret, ok := key.([]byte)
+		if !ok {
+			return fmt.Errorf("key type does not match %s", alg)
+		}
+		mac := hmac.New(newHash, secret)
+		mac.Write(signing)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return errors.New("invalid signature")
+		}
+		return nil
+
+	case "RS", "PS":
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type does not match %s", alg)
+		}
+		digest := newHash()
+		digest.Write(signing)
+		if alg[0] == 'P' {
+			err = rsa.VerifyPSS(pub, hashID, digest.Sum(nil), signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		} else {
+			err = rsa.VerifyPKCS1v15(pub, hashID, digest.Sum(nil), signature)
+		}
+		if err != nil {
+			return errors.New("invalid signature")
+		}
+		return nil
+
+	case "ES":
+		pub, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key type does not match %s", alg)
+		}
+		size := (pub.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature")
+		}
+		digest := newHash()
+		digest.Write(signing)
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(pub, digest.Sum(nil), r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %q", alg)
+}
@@ -0,0 +1,136 @@
+// Package bandit learns which targets pay off best from observed rewards,
+// choosing between them by Thompson sampling
+package bandit
+
+import (
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Arm is what has been learned about one target. Observations are
+// discounted so the estimate follows a target whose behavior drifts.
+type Arm struct {
+	Weight     float64   `json:"weight"`      // discounted number of observations
+	Sum        float64   `json:"sum"`         // discounted sum of rewards
+	SumSquares float64   `json:"sum_squares"` // discounted sum of squared rewards
+	Pulls      int64     `json:"pulls"`       // undiscounted number of observations
+	Updated    time.Time `json:"updated"`
+}
+
+// Estimate is an arm's posterior, for inspection
+type Estimate struct {
+	Mean    float64   `json:"mean_reward"`
+	StdDev  float64   `json:"std_dev"` // uncertainty of the mean
+	Weight  float64   `json:"weight"`
+	Pulls   int64     `json:"pulls"`
+	Updated time.Time `json:"updated"`
+}
+
+// Bandit holds one arm per target
+type Bandit struct {
+	mu   sync.Mutex
+	arms map[string]*Arm
+}
+
+// New creates a bandit that knows nothing yet
+func New() *Bandit {
+	return &Bandit{arms: make(map[string]*Arm)}
+}
+
+// Observe adds a reward for target, first discounting earlier observations
+// by discount in (0, 1]
+func (b *Bandit) Observe(target string, reward, discount float64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	arm := b.arms[target]
+	if arm == nil {
+		arm = &Arm{}
+		b.arms[target] = arm
+	}
+	arm.Weight = arm.Weight*discount + 1
+	arm.Sum = arm.Sum*discount + reward
+	arm.SumSquares = arm.SumSquares*discount + reward*reward
+	arm.Pulls++
+	arm.Updated = time.Now()
+}
+
+// Choose samples each target's mean reward from its posterior and returns
+// the index of the highest sample. Targets never observed are tried first.
+// priorStdDev is the reward spread assumed before observations accumulate.
+func (b *Bandit) Choose(targets []string, priorStdDev float64) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	best, bestSample := -1, math.Inf(-1)
+	var untried []int
+	for i, target := range targets {
+		arm := b.arms[target]
+		if arm == nil || arm.Weight == 0 {
+			untried = append(untried, i)
+			continue
+		}
+		mean, stdDev := posterior(arm, priorStdDev)
+		if sample := mean + rand.NormFloat64()*stdDev; sample > bestSample {
+			best, bestSample = i, sample
+		}
+	}
+	if len(untried) > 0 {
+		return untried[rand.Intn(len(untried))]
+	}
+	return best
+}
+
+// posterior returns the mean reward and the uncertainty of that mean. The
+// prior counts as one observation of priorStdDev spread, so a target seen
+// a few times with identical rewards still gets explored.
+func posterior(arm *Arm, priorStdDev float64) (float64, float64) {
+	mean := arm.Sum / arm.Weight
+	variance := math.Max(arm.SumSquares-arm.Sum*mean, 0)
+	variance = (variance + priorStdDev*priorStdDev) / (arm.Weight + 1)
+	return mean, math.Sqrt(variance / arm.Weight)
+}
+
+// Estimates returns every arm's posterior
+func (b *Bandit) Estimates(priorStdDev float64) map[string]Estimate {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	estimates := make(map[string]Estimate, len(b.arms))
+	for target, arm := range b.arms {
+		if arm.Weight == 0 {
+			continue
+		}
+		mean, stdDev := posterior(arm, priorStdDev)
+		estimates[target] = Estimate{Mean: mean, StdDev: stdDev, Weight: arm.Weight, Pulls: arm.Pulls, Updated: arm.Updated}
+	}
+	return estimates
+}
+
+// State returns the arms so learning can outlive the process
+func (b *Bandit) State() map[string]Arm {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	state := make(map[string]Arm, len(b.arms))
+	for target, arm := range b.arms {
+		state[target] = *arm
+	}
+	return state
+}
+
+// Restore reloads arms saved by State
+func (b *Bandit) Restore(state map[string]Arm) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for target, arm := range state {
+		if arm.Weight <= 0 || math.IsNaN(arm.Sum) || math.IsNaN(arm.SumSquares) {
+			continue
+		}
+		copied := arm
+		b.arms[target] = &copied
+	}
+}
@@ -0,0 +1,168 @@
+package breaker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Breaker states
+const (
+	Closed   = "closed"    // requests flow, consecutive failures are counted
+	Open     = "open"      // the target is skipped until the cool-down ends
+	HalfOpen = "half_open" // one probe request decides whether to close again
+)
+
+// Config tunes the per-target circuit breakers
+type Config struct {
+	FailureThreshold int           `yaml:"failureThreshold"` // consecutive failures that open a breaker, negative disables
+	Cooldown         time.Duration `yaml:"cooldown"`         // how long an open breaker skips its target
+}
+
+// Status reports one target's breaker
+type Status struct {
+	State    string    `json:"state"`
+	Failures int       `json:"consecutive_failures"`
+	OpenedAt time.Time `json:"opened_at"`
+}
+
+type breaker struct {
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool // a half-open probe is in flight
+}
+
+// Set holds a breaker per target, created on first use
+type Set struct {
+	config   Config
+	onChange func(target, state string)
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+// New creates a breaker set. onChange, if set, is called on every state change.
+func New(config Config, onChange func(target, state string)) *Set {
+	return &Set{
+		config:   config,
+		onChange: onChange,
+		breakers: make(map[string]*breaker),
+	}
+}
+
+func (s *Set) get(target string) *breaker {
+	b, ok := s.breakers[target]
+	if !ok {
+		b = &breaker{state: Closed}
+		s.breakers[target] = b
+	}
+	return b
+}
+
+// transition changes state (lock must be held)
+func (s *Set) transition(target string, b *breaker, state string) {
+	if b.state == state {
+		return
+	}
+	b.state = state
+	if state == Open {
+		b.openedAt = time.Now()
+		logrus.Warnf("Circuit breaker for %s opened after %d consecutive failures", target, b.failures)
+	} else {
+		logrus.Infof("Circuit breaker for %s is %s", target, state)
+	}
+	if s.onChange != nil {
+		s.onChange(target, state)
+	}
+}
+
+func (s *Set) coolingDown(b *breaker) bool {
+	return b.state == Open && time.Since(b.openedAt) < s.config.Cooldown
+}
+
+// Available reports whether target may be offered for selection: its breaker
+// is closed, or its cool-down has ended and no probe is in flight
+func (s *Set) Available(target string) bool {
+	if s.config.FailureThreshold < 0 {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.get(target)
+	return b.state == Closed || (!s.coolingDown(b) && !b.probing)
+}
+
+// Acquire claims permission to send a request to target. Past the cool-down
+// the first caller becomes the half-open probe; others are refused until it
+// reports. A successful Acquire must be followed by Record or Release.
+func (s *Set) Acquire(target string) bool {
+	if s.config.FailureThreshold < 0 {
+		return true
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.get(target)
+	if b.state == Closed {
+		return true
+	}
+	if s.coolingDown(b) || b.probing {
+		return false
+	}
+	s.transition(target, b, HalfOpen)
+	b.probing = true
+	return true
+}
+
+// Record reports a request's outcome. Failures are 5xx responses, timeouts
+// and connection errors.
+func (s *Set) Record(target string, success bool) {
+	if s.config.FailureThreshold < 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.get(target)
+	wasProbe := b.probing
+	b.probing = false
+
+	switch {
+	case success:
+		b.failures = 0
+		s.transition(target, b, Closed)
+	case b.state == HalfOpen && wasProbe:
+		s.transition(target, b, Open)
+	case b.state == Closed:
+		b.failures++
+		if b.failures >= s.config.FailureThreshold {
+			s.transition(target, b, Open)
+		}
+	}
+}
+
+// Release gives back an Acquire whose request was never judged, such as one
+// cancelled by the client
+func (s *Set) Release(target string) {
+	if s.config.FailureThreshold < 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.get(target).probing = false
+}
+
+// Status returns every known breaker
+func (s *Set) Status() map[string]Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := make(map[string]Status, len(s.breakers))
+	for target, b := range s.breakers {
+		status[target] = Status{State: b.state, Failures: b.failures, OpenedAt: b.openedAt}
+	}
+	return status
+}
@@ -0,0 +1,222 @@
+package budget
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// PacingConfig spreads the monthly external budget across the month so it
+// can't be spent in the first week. Each slice is allotted what remains of
+// the budget divided by the slices left, so under- and overspend are
+// re-spread over the rest of the month.
+type PacingConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Slice   string `yaml:"slice"` // "day" (default) or "hour"
+}
+
+// Status reports month-to-date external spend and the current slice
+type Status struct {
+	Month         string       `json:"month"`
+	MonthlyBudget float64      `json:"monthly_budget_usd"`
+	MonthSpend    float64      `json:"month_spend_usd"`
+	Exhausted     bool         `json:"exhausted"`
+	Pacing        *SliceStatus `json:"pacing,omitempty"`
+}
+
+// SliceStatus describes the current pacing slice
+type SliceStatus struct {
+	Slice      string    `json:"slice"`
+	Start      time.Time `json:"start"`
+	End        time.Time `json:"end"`
+	Allowance  float64   `json:"allowance_usd"`
+	Spend      float64   `json:"spend_usd"`
+	Restricted bool      `json:"restricted"`
+}
+
+// State is the ledger as persisted across restarts
+type State struct {
+	Month      string    `json:"month"`
+	Spend      float64   `json:"spend_usd"`
+	SliceStart time.Time `json:"slice_start"`
+	SliceSpend float64   `json:"slice_spend_usd"`
+	Allowance  float64   `json:"allowance_usd"`
+	Alerted    []float64 `json:"alerted,omitempty"`
+}
+
+// Ledger tracks external provider spend against the monthly budget
+type Ledger struct {
+	budget     float64
+	pacing     PacingConfig
+	thresholds []float64
+	now        func() time.Time
+
+	mu         sync.Mutex
+	month      string
+	spend      float64
+	sliceStart time.Time
+	sliceSpend float64
+	allowance  float64
+	alerted    []float64 // thresholds already crossed this month
+}
+
+// New creates a ledger for monthlyBudget USD; a zero budget is unlimited.
+// thresholds are fractions of the budget that Record reports crossing.
+func New(monthlyBudget float64, pacing PacingConfig, thresholds []float64) (*Ledger, error) {
+	for _, threshold := range thresholds {
+		if threshold <= 0 {
+			return nil, fmt.Errorf("alert threshold %v must be positive", threshold)
+		}
+	}
+	switch pacing.Slice {
+	case "":
+		pacing.Slice = "day"
+	case "day", "hour":
+	default:
+		return nil, fmt.Errorf("unknown pacing slice %q", pacing.Slice)
+	}
+	l := &Ledger{budget: monthlyBudget, pacing: pacing, thresholds: thresholds, now: time.Now}
+	l.rollover()
+	return l, nil
+}
+
+func (l *Ledger) sliceLength() time.Duration {
+	if l.pacing.Slice == "hour" {
+		return time.Hour
+	}
+	return 24 * time.Hour
+}
+
+// rollover resets spend for a new month and allots a new slice's allowance
+// (lock must be held)
+func (l *Ledger) rollover() {
+	now := l.now().UTC()
+	if month := now.Format("2006-01"); l.month != month {
+		l.month = month
+		l.spend = 0
+		l.sliceStart = time.Time{}
+		l.alerted = nil
+	}
+
+	start := now.Truncate(l.sliceLength())
+	if start.Equal(l.sliceStart) {
+		return
+	}
+	monthEnd := time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+	remaining := int(monthEnd.Sub(start) / l.sliceLength())
+	if remaining < 1 {
+		remaining = 1
+	}
+	l.sliceStart = start
+	l.sliceSpend = 0
+	l.allowance = 0
+	if left := l.budget - l.spend; left > 0 {
+		l.allowance = left / float64(remaining)
+	}
+}
+
+// Record adds usd of external spend, returning the alert thresholds it
+// crossed for the first time this month
+func (l *Ledger) Record(usd float64) []float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rollover()
+	l.spend += usd
+	l.sliceSpend += usd
+
+	if l.budget <= 0 {
+		return nil
+	}
+	var crossed []float64
+	for _, threshold := range l.thresholds {
+		if l.spend >= threshold*l.budget && !l.hasAlerted(threshold) {
+			l.alerted = append(l.alerted, threshold)
+			crossed = append(crossed, threshold)
+		}
+	}
+	return crossed
+}
+
+func (l *Ledger) hasAlerted(threshold float64) bool {
+	for _, alerted := range l.alerted {
+		if alerted == threshold {
+			return true
+		}
+	}
+	return false
+}
+
+// Allowed reports whether external providers may take new requests: not
+// once the monthly budget is exhausted, nor while a paced slice is spent
+func (l *Ledger) Allowed() (bool, string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rollover()
+	if l.budget > 0 && l.spend >= l.budget {
+		return false, fmt.Sprintf("monthly external budget of $%.2f exhausted ($%.2f spent)", l.budget, l.spend)
+	}
+	if l.pacing.Enabled && l.budget > 0 && l.sliceSpend >= l.allowance {
+		return false, fmt.Sprintf("%s budget slice of $%.2f spent until %s",
+			l.pacing.Slice, l.allowance, l.sliceStart.Add(l.sliceLength()).Format(time.RFC3339))
+	}
+	return true, ""
+}
+
+// Status returns the month's spend and, when pacing, the current slice
+func (l *Ledger) Status() Status {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rollover()
+	status := Status{Month: l.month, MonthlyBudget: l.budget, MonthSpend: l.spend, Exhausted: l.budget > 0 && l.spend >= l.budget}
+	if l.pacing.Enabled && l.budget > 0 {
+		status.Pacing = &SliceStatus{
+			Slice:      l.pacing.Slice,
+			Start:      l.sliceStart,
+			End:        l.sliceStart.Add(l.sliceLength()),
+			Allowance:  l.allowance,
+			Spend:      l.sliceSpend,
+			Restricted: l.sliceSpend >= l.allowance,
+		}
+	}
+	return status
+}
+
+// State returns the ledger so it can outlive the process
+func (l *Ledger) State() State {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rollover()
+	return State{
+		Month:      l.month,
+		Spend:      l.spend,
+		SliceStart: l.sliceStart,
+		SliceSpend: l.sliceSpend,
+		Allowance:  l.allowance,
+		Alerted:    append([]float64(nil), l.alerted...),
+	}
+}
+
+// Restore reloads state saved by State. State from another month is
+// ignored, and a slice that has since ended is replaced.
+func (l *Ledger) Restore(state State) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if state.Month != l.month {
+		return
+	}
+	l.spend = state.Spend
+	l.alerted = state.Alerted
+	if state.SliceStart.Equal(l.sliceStart) {
+		l.sliceSpend = state.SliceSpend
+		l.allowance = state.Allowance
+		return
+	}
+	// Re-spread with the restored spend
+	l.sliceStart = time.Time{}
+	l.rollover()
+}
@@ -0,0 +1,191 @@
+// Package capability discovers what a target can actually do by sending it
+// small requests, rather than trusting what its configuration claims
+package capability
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// Config controls capability probing of newly registered targets
+type Config struct {
+	Enabled          bool          `yaml:"enabled"`
+	Providers        bool          `yaml:"providers"`        // also probe external providers; every probe is a billed request
+	MaxContextTokens int           `yaml:"maxContextTokens"` // largest prompt tried when searching for the context window, default 32768
+	Resolution       int           `yaml:"resolution"`       // the search stops within this many tokens, default 512
+	Timeout          time.Duration `yaml:"timeout"`          // per probe request, default 60s
+	RefreshInterval  time.Duration `yaml:"refreshInterval"`  // records older than this are probed again, default 24h
+}
+
+// Endpoints probed, in the order they are tried
+var Endpoints = []string{"/v1/chat/completions", "/v1/completions", "/v1/embeddings"}
+
+// Record is what a probe found a target supports
+type Record struct {
+	Endpoints     []string  `json:"endpoints"`
+	Streaming     bool      `json:"streaming"`
+	Tools         bool      `json:"tools"`
+	ContextWindow int       `json:"context_window,omitempty"` // 0 if it exceeds maxContextTokens or couldn't be measured
+	Model         string    `json:"model,omitempty"`          // model the probes were sent with
+	ProbedAt      time.Time `json:"probed_at"`
+}
+
+// Supports reports whether the target answered on endpoint
+func (r *Record) Supports(endpoint string) bool {
+	for _, e := range r.Endpoints {
+		if e == endpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// Response is what a probe request returned
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// Sender delivers a probe request body to endpoint on the target
+type Sender func(ctx context.Context, endpoint string, body []byte) (Response, error)
+
+// inconclusive reports whether a probe's outcome says nothing of what the
+// target supports: it failed to get an answer, or the target was
+// overloaded or broken at the time rather than saying it can't
+func inconclusive(resp Response, err error) bool {
+	return err != nil || resp.Status == 0 || resp.Status >= 500 ||
+		resp.Status == http.StatusTooManyRequests || resp.Status == http.StatusRequestTimeout
+}
+
+// Probe runs every capability check against one target with model. If any
+// probe is inconclusive the checks stop and an error is returned instead
+// of a record, which would otherwise deny the target what it couldn't be
+// asked.
+func Probe(ctx context.Context, config Config, model string, send Sender) (Record, error) {
+	record := Record{Model: model, ProbedAt: time.Now()}
+	var failure error
+	call := func(endpoint string, request map[string]interface{}) (Response, bool) {
+		if failure != nil {
+			return Response{}, false
+		}
+		if model != "" {
+			request["model"] = model
+		}
+		body, _ := json.Marshal(request)
+		probeCtx, cancel := context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+		resp, err := send(probeCtx, endpoint, body)
+		if inconclusive(resp, err) {
+			if err == nil {
+				err = fmt.Errorf("status %d", resp.Status)
+			}
+			failure = fmt.Errorf("probe of %s: %w", endpoint, err)
+			return resp, false
+		}
+		return resp, resp.Status >= 200 && resp.Status < 300
+	}
+
+	requests := map[string]func() map[string]interface{}{
+		"/v1/chat/completions": func() map[string]interface{} {
+			return map[string]interface{}{"messages": []map[string]string{{"role": "user", "content": "ping"}}, "max_tokens": 1}
+		},
+		"/v1/completions": func() map[string]interface{} {
+			return map[string]interface{}{"prompt": "ping", "max_tokens": 1}
+		},
+		"/v1/embeddings": func() map[string]interface{} {
+			return map[string]interface{}{"input": "ping"}
+		},
+	}
+	for _, endpoint := range Endpoints {
+		if _, ok := call(endpoint, requests[endpoint]()); ok {
+			record.Endpoints = append(record.Endpoints, endpoint)
+		}
+	}
+	if !record.Supports("/v1/chat/completions") {
+		if record.Supports("/v1/completions") {
+			record.ContextWindow = searchContext(config, func(prompt string) bool {
+				_, ok := call("/v1/completions", map[string]interface{}{"prompt": prompt, "max_tokens": 1})
+				return ok
+			})
+		}
+		return record, failure
+	}
+
+	stream := requests["/v1/chat/completions"]()
+	stream["stream"] = true
+	if resp, ok := call("/v1/chat/completions", stream); ok {
+		record.Streaming = strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") ||
+			strings.HasPrefix(strings.TrimSpace(string(resp.Body)), "data:")
+	}
+
+	tools := requests["/v1/chat/completions"]()
+	tools["messages"] = []map[string]string{{"role": "user", "content": "What time is it?"}}
+	tools["max_tokens"] = 64
+	tools["tools"] = []map[string]interface{}{{
+		"type": "function",
+		"function": map[string]interface{}{
+			"name":        "get_time",
+			"description": "Returns the current time",
+			"parameters":  map[string]interface{}{"type": "object", "properties": map[string]interface{}{}},
+		},
+	}}
+	tools["tool_choice"] = map[string]interface{}{"type": "function", "function": map[string]string{"name": "get_time"}}
+	if resp, ok := call("/v1/chat/completions", tools); ok {
+		record.Tools = hasToolCall(resp.Body)
+	}
+
+	record.ContextWindow = searchContext(config, func(prompt string) bool {
+		_, ok := call("/v1/chat/completions", map[string]interface{}{
+			"messages":   []map[string]string{{"role": "user", "content": prompt}},
+			"max_tokens": 1,
+		})
+		return ok
+	})
+	return record, failure
+}
+
+// searchContext binary-searches the longest prompt accepted, in tokens as
+// the router estimates them (four characters each). It returns 0 when even
+// maxContextTokens is accepted.
+func searchContext(config Config, accepts func(prompt string) bool) int {
+	prompt := func(tokens int) string {
+		return strings.Repeat(" the", tokens)
+	}
+	if accepts(prompt(config.MaxContextTokens)) {
+		return 0
+	}
+	lo, hi := 0, config.MaxContextTokens
+	for hi-lo > config.Resolution {
+		mid := (lo + hi) / 2
+		if accepts(prompt(mid)) {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return lo
+}
+
+func hasToolCall(body []byte) bool {
+	var response struct {
+		Choices []struct {
+			Message struct {
+				ToolCalls []json.RawMessage `json:"tool_calls"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if json.Unmarshal(body, &response) != nil {
+		return false
+	}
+	for _, choice := range response.Choices {
+		if len(choice.Message.ToolCalls) > 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package compress
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/tokenizer"
+)
+
+// Config controls prompt compression
+type Config struct {
+	Enabled         bool    `yaml:"enabled"`
+	ThresholdTokens int     `yaml:"thresholdTokens"` // Compress prompts estimated above this size
+	TargetRatio     float64 `yaml:"targetRatio"`     // Aim for this fraction of the original size
+	PreserveRecent  int     `yaml:"preserveRecent"`  // Trailing messages never touched
+}
+
+// Result describes what compression did to a conversation
+type Result struct {
+	OriginalTokens   int
+	CompressedTokens int
+}
+
+// TokensSaved returns the estimated number of tokens removed
+func (r Result) TokensSaved() int {
+	return r.OriginalTokens - r.CompressedTokens
+}
+
+// EstimateTokens counts text's tokens with the default encoding
+func EstimateTokens(text string) int {
+	return tokenizer.Count("", text)
+}
+
+// fillerWords carry little information and are dropped from older turns,
+// in the spirit of LLMLingua's low-perplexity token pruning
+var fillerWords = map[string]bool{
+	"a": true, "an": true, "the": true, "very": true, "really": true,
+	"just": true, "quite": true, "basically": true, "actually": true,
+	"simply": true, "literally": true, "that": true, "so": true,
+	"um": true, "uh": true, "like": true, "please": true, "kindly": true,
+}
+
+// Messages compresses an OpenAI-style messages array in place, leaving
+// system messages and the last PreserveRecent messages untouched. Older
+// messages are pruned in stages until the target size is reached:
+// whitespace collapsing, removal of repeated lines, filler word removal and
+// finally middle truncation of the longest messages.
+func Messages(messages []interface{}, cfg Config) Result {
+	result := Result{OriginalTokens: countTokens(messages)}
+	result.CompressedTokens = result.OriginalTokens
+
+	ratio := cfg.TargetRatio
+	if ratio <= 0 || ratio >= 1 {
+		ratio = 0.5
+	}
+	target := int(float64(result.OriginalTokens) * ratio)
+
+	// Indexes of messages eligible for compression, oldest first
+	var eligible []int
+	for i, msg := range messages {
+		if i >= len(messages)-cfg.PreserveRecent {
+			break
+		}
+		m, ok := msg.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if role, _ := m["role"].(string); role == "system" {
+			continue
+		}
+		if _, ok := m["content"].(string); ok {
+			eligible = append(eligible, i)
+		}
+	}
+	if len(eligible) == 0 {
+		return result
+	}
+
+	stages := []func(string, map[string]bool) string{
+		collapseWhitespace,
+		dropRepeatedLines,
+		dropFillerWords,
+	}
+
+	seen := make(map[string]bool)
+	for _, stage := range stages {
+		for _, i := range eligible {
+			m := messages[i].(map[string]interface{})
+			m["content"] = stage(m["content"].(string), seen)
+		}
+		result.CompressedTokens = countTokens(messages)
+		if result.CompressedTokens <= target {
+			return result
+		}
+	}
+
+	// Still too large: truncate the middle of eligible messages, oldest first
+	for _, i := range eligible {
+		excess := result.CompressedTokens - target
+		if excess <= 0 {
+			break
+		}
+		m := messages[i].(map[string]interface{})
+		m["content"] = truncateMiddle(m["content"].(string), excess*4)
+		result.CompressedTokens = countTokens(messages)
+	}
+
+	return result
+}
+
+// CountTokens estimates the tokens in an OpenAI-style messages array
+func CountTokens(messages []interface{}) int {
+	return countTokens(messages)
+}
+
+func countTokens(messages []interface{}) int {
+	total := 0
+	for _, msg := range messages {
+		if m, ok := msg.(map[string]interface{}); ok {
+			if content, ok := m["content"].(string); ok {
+				total += EstimateTokens(content)
+			}
+		}
+	}
+	return total
+}
+
+func collapseWhitespace(text string, _ map[string]bool) string {
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	blank := false
+	for _, line := range lines {
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" {
+			if blank {
+				continue
+			}
+			blank = true
+		} else {
+			blank = false
+		}
+		kept = append(kept, line)
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
+
+// dropRepeatedLines removes lines already seen earlier in the conversation,
+// which is common when tools or clients resend the same context
+func dropRepeatedLines(text string, seen map[string]bool) string {
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		key := strings.ToLower(strings.TrimSpace(line))
+		if len(key) > 20 {
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+		}
+		kept = append(kept, line)
+	}
+	return strings.Join(kept, "\n")
+}
+
+func dropFillerWords(text string, _ map[string]bool) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		words := strings.Fields(line)
+		kept := words[:0]
+		for _, word := range words {
+			// Only drop bare lowercase fillers so punctuation and sentence starts survive
+			if fillerWords[word] && strings.TrimFunc(word, unicode.IsPunct) == word {
+				continue
+			}
+			kept = append(kept, word)
+		}
+		lines[i] = strings.Join(kept, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+// truncateMiddle removes about cut characters from the middle of text,
+// keeping the beginning and end where instructions and conclusions live
+func truncateMiddle(text string, cut int) string {
+	const marker = " [...] "
+	runes := []rune(text)
+	keep := len(runes) - cut - len(marker)
+	if keep < 80 {
+		keep = 80
+	}
+	if keep >= len(runes) {
+		return text
+	}
+	head := keep / 2
+	tail := keep - head
+	return string(runes[:head]) + marker + string(runes[len(runes)-tail:])
+}
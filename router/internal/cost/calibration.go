@@ -0,0 +1,118 @@
+package cost
+
+import (
+	"time"
+)
+
+// CalibrationConfig bounds automatic per-cluster overhead calibration
+type CalibrationConfig struct {
+	Enabled   bool          `yaml:"enabled"`
+	Interval  time.Duration `yaml:"interval"`  // how often factors are recomputed, default 10m
+	MinFactor float64       `yaml:"minFactor"` // lowest calibrated overhead factor, default 1.0
+	MaxFactor float64       `yaml:"maxFactor"` // highest calibrated overhead factor, default 3.0
+	MinTokens int           `yaml:"minTokens"` // output tokens needed in a window to calibrate, default 10000
+}
+
+// Calibration reports one cluster's latest calibration
+type Calibration struct {
+	OverheadFactor float64 `json:"overhead_factor"`
+	PredictedTPS   float64 `json:"predicted_tokens_per_sec"` // throughput reported by the cluster
+	ObservedTPS    float64 `json:"observed_tokens_per_sec"`  // output tokens over busy time
+	Drift          float64 `json:"drift"`                    // observed cost over predicted cost, minus 1
+}
+
+// load accumulates observed throughput between calibrations. Time counts
+// as busy while at least one request is in flight, so concurrent requests
+// measure aggregate throughput rather than per-request speed.
+type load struct {
+	inFlight  int
+	busySince time.Time
+	busy      time.Duration
+	tokens    int
+}
+
+// BeginRequest marks a request in flight on a cluster
+func (e *Engine) BeginRequest(clusterName string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cluster, exists := e.clusters[clusterName]
+	if !exists {
+		return
+	}
+	if cluster.load.inFlight == 0 {
+		cluster.load.busySince = time.Now()
+	}
+	cluster.load.inFlight++
+}
+
+// EndRequest marks a request finished, crediting the output tokens it produced
+func (e *Engine) EndRequest(clusterName string, outputTokens int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	cluster, exists := e.clusters[clusterName]
+	if !exists || cluster.load.inFlight == 0 {
+		return
+	}
+	cluster.load.tokens += outputTokens
+	cluster.load.inFlight--
+	if cluster.load.inFlight == 0 {
+		cluster.load.busy += time.Since(cluster.load.busySince)
+	}
+}
+
+// Calibrate compares each cluster's reported throughput with the throughput
+// observed since the last call and moves its overhead factor halfway towards
+// the factor that would have priced the observed load, within the bounds.
+// Clusters with fewer than MinTokens observed keep their factor.
+func (e *Engine) Calibrate(config CalibrationConfig) map[string]Calibration {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := time.Now()
+	results := make(map[string]Calibration)
+	for name, cluster := range e.clusters {
+		l := &cluster.load
+		busy := l.busy
+		if l.inFlight > 0 {
+			busy += now.Sub(l.busySince)
+		}
+		tokens := l.tokens
+
+		if tokens < config.MinTokens || busy <= 0 || cluster.LastTokensPerSec <= 0 {
+			continue
+		}
+		// Start the next window
+		l.busy, l.tokens, l.busySince = 0, 0, now
+
+		observed := float64(tokens) / busy.Seconds()
+		ratio := cluster.LastTokensPerSec / observed
+
+		target := e.overheadFactor * ratio
+		if target < config.MinFactor {
+			target = config.MinFactor
+		}
+		if target > config.MaxFactor {
+			target = config.MaxFactor
+		}
+		cluster.OverheadFactor = (e.factor(cluster) + target) / 2
+
+		results[name] = Calibration{
+			OverheadFactor: cluster.OverheadFactor,
+			PredictedTPS:   cluster.LastTokensPerSec,
+			ObservedTPS:    observed,
+			Drift:          ratio - 1,
+		}
+	}
+	return results
+}
+
+// factor returns a cluster's calibrated overhead factor, or the configured
+// one before calibration (lock must be held)
+func (e *Engine) factor(cluster *ClusterCost) float64 {
+	if cluster.OverheadFactor > 0 {
+		return cluster.OverheadFactor
+	}
+	return e.overheadFactor
+}
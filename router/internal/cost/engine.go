@@ -19,6 +19,9 @@ type ClusterCost struct {
 	LastTokensPerSec float64
 	LastUpdate       time.Time
 	HistoricalCosts  []float64
+	OverheadFactor   float64 // calibrated from observed throughput, 0 until calibrated
+
+	load load
 }
 
 // NewEngine creates a new cost calculation engine
@@ -57,7 +60,7 @@ func (e *Engine) CalculateCostPer1KTokens(clusterName string, tokensPerSecond fl
 	
 	// Calculate cost per 1K tokens
 	tokensPerHour := tokensPerSecond * 3600
-	costPer1KTokens := (cluster.CostPerHour / tokensPerHour) * e.overheadFactor * 1000
+	costPer1KTokens := (cluster.CostPerHour / tokensPerHour) * e.factor(cluster) * 1000
 	
 	// Update tracking data
 	cluster.LastTokensPerSec = tokensPerSecond
@@ -129,6 +132,7 @@ func (e *Engine) GetAllClusterCosts() map[string]ClusterCostInfo {
 		info := ClusterCostInfo{
 			CostPerHour:      cluster.CostPerHour,
 			LastTokensPerSec: cluster.LastTokensPerSec,
+			OverheadFactor:   e.factor(cluster),
 			LastUpdate:       cluster.LastUpdate,
 		}
 		
@@ -152,6 +156,7 @@ type ClusterCostInfo struct {
 	LastTokensPerSec float64   `json:"last_tokens_per_sec"`
 	LastCostPer1K    float64   `json:"last_cost_per_1k"`
 	AvgCostPer1K     float64   `json:"avg_cost_per_1k"`
+	OverheadFactor   float64   `json:"overhead_factor"`
 	LastUpdate       time.Time `json:"last_update"`
 }
 
@@ -174,3 +179,17 @@ func (e *Engine) getAverageCostUnsafe(cluster *ClusterCost, lastN int) (float64,
 	
 	return sum / float64(lastN), true
 }
+
+// ComputeCost returns the compute spend of occupying a cluster for duration,
+// including the overhead factor
+func (e *Engine) ComputeCost(clusterName string, duration time.Duration) float64 {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	cluster, exists := e.clusters[clusterName]
+	if !exists {
+		return 0
+	}
+
+	return cluster.CostPerHour * e.overheadFactor * duration.Hours()
+}
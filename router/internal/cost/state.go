@@ -0,0 +1,55 @@
+package cost
+
+import (
+	"time"
+)
+
+// ClusterState is what a cluster has learned from observed throughput
+type ClusterState struct {
+	LastTokensPerSec float64   `json:"last_tokens_per_sec"`
+	LastUpdate       time.Time `json:"last_update"`
+	HistoricalCosts  []float64 `json:"historical_costs"`
+	OverheadFactor   float64   `json:"overhead_factor"` // 0 until calibrated
+}
+
+// State returns every cluster's learned throughput so it can outlive the
+// process. Hourly costs aren't included; they come from config or spot
+// prices.
+func (e *Engine) State() map[string]ClusterState {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	state := make(map[string]ClusterState, len(e.clusters))
+	for name, cluster := range e.clusters {
+		state[name] = ClusterState{
+			LastTokensPerSec: cluster.LastTokensPerSec,
+			LastUpdate:       cluster.LastUpdate,
+			HistoricalCosts:  append([]float64(nil), cluster.HistoricalCosts...),
+			OverheadFactor:   cluster.OverheadFactor,
+		}
+	}
+	return state
+}
+
+// Restore reloads throughput saved by State. Unknown clusters are ignored.
+func (e *Engine) Restore(state map[string]ClusterState) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	for name, saved := range state {
+		cluster, exists := e.clusters[name]
+		if !exists {
+			continue
+		}
+		costs := saved.HistoricalCosts
+		if len(costs) > 100 {
+			costs = costs[len(costs)-100:]
+		}
+		cluster.LastTokensPerSec = saved.LastTokensPerSec
+		cluster.LastUpdate = saved.LastUpdate
+		cluster.HistoricalCosts = append(make([]float64, 0, 100), costs...)
+		if saved.OverheadFactor > 0 {
+			cluster.OverheadFactor = saved.OverheadFactor
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package discovery
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// consulBackend lists a service's passing instances with blocking queries,
+// which return as soon as the catalog index moves past the last one seen
+type consulBackend struct {
+	config Config
+	client *http.Client
+	index  uint64
+}
+
+type consulEntry struct {
+	Node struct {
+		Address string `json:"Address"`
+	} `json:"Node"`
+	Service struct {
+		ID      string            `json:"ID"`
+		Address string            `json:"Address"`
+		Port    int               `json:"Port"`
+		Meta    map[string]string `json:"Meta"`
+	} `json:"Service"`
+}
+
+func (b *consulBackend) watch(ctx context.Context, wait time.Duration) ([]Target, error) {
+	query := url.Values{"passing": {"true"}, "wait": {wait.String()}}
+	if b.index > 0 {
+		query.Set("index", strconv.FormatUint(b.index, 10))
+	}
+	if b.config.Tag != "" {
+		query.Set("tag", b.config.Tag)
+	}
+	if b.config.Datacenter != "" {
+		query.Set("dc", b.config.Datacenter)
+	}
+	endpoint := b.config.Address + "/v1/health/service/" + url.PathEscape(b.config.Service) + "?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if b.config.Token != "" {
+		req.Header.Set("X-Consul-Token", b.config.Token)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("consul returned %d: %s", resp.StatusCode, body)
+	}
+	var entries []consulEntry
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("invalid consul response: %w", err)
+	}
+
+	// An index that goes backwards means the catalog was reset
+	index, _ := strconv.ParseUint(resp.Header.Get("X-Consul-Index"), 10, 64)
+	if index < b.index {
+		index = 0
+	}
+	b.index = index
+
+	targets := make([]Target, 0, len(entries))
+	for _, entry := range entries {
+		address := entry.Service.Address
+		if address == "" {
+			address = entry.Node.Address
+		}
+		scheme := entry.Service.Meta["scheme"]
+		if scheme == "" {
+			scheme = "http"
+		}
+		targets = append(targets, Target{
+			Name:     entry.Service.ID,
+			Endpoint: scheme + "://" + net.JoinHostPort(address, strconv.Itoa(entry.Service.Port)),
+			Meta:     entry.Service.Meta,
+		})
+	}
+	return targets, nil
+}
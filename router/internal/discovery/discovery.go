@@ -0,0 +1,159 @@
+// Package discovery reads cluster targets from a service registry, Consul's
+// catalog or etcd keys, for self-hosted fleets that run outside Kubernetes
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config selects a registry and what to read from it
+type Config struct {
+	Backend  string        `yaml:"backend"`  // "consul" or "etcd"; empty disables discovery
+	Address  string        `yaml:"address"`  // API base URL, default http://127.0.0.1:8500 (consul) or http://127.0.0.1:2379 (etcd)
+	Interval time.Duration `yaml:"interval"` // longest a watch waits before listing again, default 1m
+
+	// Consul lists the passing instances of a catalog service
+	Service    string `yaml:"service"`
+	Tag        string `yaml:"tag"`        // only instances with this tag
+	Datacenter string `yaml:"datacenter"` // default the agent's
+	Token      string `yaml:"token"`      // ACL token, sent as X-Consul-Token
+
+	// etcd reads one target per key under prefix through the v3 JSON gateway
+	Prefix   string `yaml:"prefix"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// Target is one discovered cluster. Meta carries registry-supplied
+// settings such as engine or costPerHour.
+type Target struct {
+	Name     string            `json:"name"`
+	Endpoint string            `json:"endpoint"`
+	Meta     map[string]string `json:"meta,omitempty"`
+}
+
+// Status is the outcome of the last sync with the registry
+type Status struct {
+	Backend  string    `json:"backend"`
+	Targets  int       `json:"targets"`
+	Synced   time.Time `json:"synced"`          // last successful listing
+	Error    string    `json:"error,omitempty"` // last failure; the previous targets stay in effect
+	Failures int       `json:"consecutive_failures,omitempty"`
+}
+
+// backend lists the registry's targets, blocking until they may have
+// changed since the last call or wait passes
+type backend interface {
+	watch(ctx context.Context, wait time.Duration) ([]Target, error)
+}
+
+// Watcher keeps a backend's targets current
+type Watcher struct {
+	config  Config
+	backend backend
+
+	mu      sync.Mutex
+	status  Status
+	current []Target
+}
+
+// New creates a watcher for config's backend. It returns nil when
+// discovery is disabled.
+func New(config Config) (*Watcher, error) {
+	if config.Backend == "" {
+		return nil, nil
+	}
+	if config.Interval == 0 {
+		config.Interval = time.Minute
+	}
+
+	// Blocking reads outlast the interval by the registry's jitter
+	client := &http.Client{Timeout: config.Interval + 30*time.Second}
+	var b backend
+	switch config.Backend {
+	case "consul":
+		if config.Service == "" {
+			return nil, fmt.Errorf("consul discovery needs service")
+		}
+		if config.Address == "" {
+			config.Address = "http://127.0.0.1:8500"
+		}
+		b = &consulBackend{config: config, client: client}
+	case "etcd":
+		if config.Prefix == "" {
+			return nil, fmt.Errorf("etcd discovery needs prefix")
+		}
+		if config.Address == "" {
+			config.Address = "http://127.0.0.1:2379"
+		}
+		b = &etcdBackend{config: config, client: client}
+	default:
+		return nil, fmt.Errorf("unknown discovery backend %q", config.Backend)
+	}
+	return &Watcher{config: config, backend: b, status: Status{Backend: config.Backend}}, nil
+}
+
+// Interval is how often Run beats at the latest
+func (w *Watcher) Interval() time.Duration {
+	return w.config.Interval
+}
+
+// Run watches the registry until ctx is done, calling apply with every
+// target whenever the set changes. Failed reads keep the previous targets
+// and are retried with backoff.
+func (w *Watcher) Run(ctx context.Context, beat func(), apply func([]Target)) {
+	beat()
+	for {
+		targets, err := w.backend.watch(ctx, w.config.Interval)
+		if ctx.Err() != nil {
+			return
+		}
+
+		w.mu.Lock()
+		if err != nil {
+			w.status.Error = err.Error()
+			w.status.Failures++
+			failures := w.status.Failures
+			kept := len(w.current)
+			w.mu.Unlock()
+			logrus.Warnf("Failed to read %s discovery, keeping %d discovered clusters: %v", w.config.Backend, kept, err)
+			beat()
+
+			backoff := time.Duration(failures) * time.Second
+			if backoff > w.config.Interval {
+				backoff = w.config.Interval
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		sort.Slice(targets, func(i, j int) bool { return targets[i].Name < targets[j].Name })
+		changed := !reflect.DeepEqual(targets, w.current)
+		w.current = targets
+		w.status = Status{Backend: w.config.Backend, Targets: len(targets), Synced: time.Now()}
+		w.mu.Unlock()
+
+		if changed {
+			apply(targets)
+		}
+		beat()
+	}
+}
+
+// Status reports the last sync
+func (w *Watcher) Status() Status {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status
+}
@@ -0,0 +1,211 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// etcdBackend reads the keys under a prefix through etcd's v3 JSON gateway.
+// Each key is a cluster named by the rest of the key, its value either the
+// endpoint URL or a JSON object with endpoint and the cluster's settings:
+//
+//	/llm-router/clusters/gpu-1 = {"endpoint": "http://10.0.0.5:8080", "engine": "vllm", "costPerHour": 1.2}
+type etcdBackend struct {
+	config   Config
+	client   *http.Client
+	revision int64
+}
+
+type etcdRange struct {
+	Header struct {
+		Revision string `json:"revision"`
+	} `json:"header"`
+	Kvs []struct {
+		Key   string `json:"key"`
+		Value string `json:"value"`
+	} `json:"kvs"`
+}
+
+type etcdWatchResponse struct {
+	Result struct {
+		Events   []json.RawMessage `json:"events"`
+		Canceled bool              `json:"canceled"`
+	} `json:"result"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// watch waits, after the first listing, for a change under the prefix or
+// for wait to pass, then lists the prefix again
+func (b *etcdBackend) watch(ctx context.Context, wait time.Duration) ([]Target, error) {
+	token, err := b.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if b.revision > 0 {
+		if err := b.waitForChange(ctx, token, wait); err != nil {
+			return nil, err
+		}
+	}
+
+	var listing etcdRange
+	err = b.post(ctx, "/v3/kv/range", token, map[string]string{
+		"key":       encodeKey(b.config.Prefix),
+		"range_end": encodeKey(prefixEnd(b.config.Prefix)),
+	}, &listing)
+	if err != nil {
+		return nil, err
+	}
+	b.revision, _ = strconv.ParseInt(listing.Header.Revision, 10, 64)
+
+	targets := make([]Target, 0, len(listing.Kvs))
+	for _, kv := range listing.Kvs {
+		key, _ := base64.StdEncoding.DecodeString(kv.Key)
+		value, _ := base64.StdEncoding.DecodeString(kv.Value)
+		name := strings.Trim(strings.TrimPrefix(string(key), b.config.Prefix), "/")
+		target, err := parseEtcdTarget(name, value)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", key, err)
+		}
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+func parseEtcdTarget(name string, value []byte) (Target, error) {
+	value = bytes.TrimSpace(value)
+	if len(value) == 0 || value[0] != '{' {
+		return Target{Name: name, Endpoint: string(value)}, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(value, &fields); err != nil {
+		return Target{}, err
+	}
+	target := Target{Name: name, Meta: make(map[string]string)}
+	for field, v := range fields {
+		text := fmt.Sprint(v)
+		if field == "endpoint" {
+			target.Endpoint = text
+		} else {
+			target.Meta[field] = text
+		}
+	}
+	return target, nil
+}
+
+// waitForChange returns once a key under the prefix changes after the last
+// listing, the watch is cancelled (e.g. compacted) or wait passes
+func (b *etcdBackend) waitForChange(ctx context.Context, token string, wait time.Duration) error {
+	watchCtx, cancel := context.WithTimeout(ctx, wait)
+	defer cancel()
+
+	body, _ := json.Marshal(map[string]map[string]string{"create_request": {
+		"key":            encodeKey(b.config.Prefix),
+		"range_end":      encodeKey(prefixEnd(b.config.Prefix)),
+		"start_revision": strconv.FormatInt(b.revision+1, 10),
+	}})
+	resp, err := b.request(watchCtx, "/v3/watch", token, body)
+	if err != nil {
+		if watchCtx.Err() != nil && ctx.Err() == nil {
+			return nil
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var message etcdWatchResponse
+		if err := decoder.Decode(&message); err != nil {
+			if watchCtx.Err() != nil && ctx.Err() == nil {
+				return nil // nothing changed within wait
+			}
+			return fmt.Errorf("etcd watch: %w", err)
+		}
+		if message.Error != nil {
+			return fmt.Errorf("etcd watch: %s", message.Error.Message)
+		}
+		if len(message.Result.Events) > 0 || message.Result.Canceled {
+			return nil
+		}
+	}
+}
+
+// authenticate exchanges the configured credentials for a token, or
+// returns "" without them
+func (b *etcdBackend) authenticate(ctx context.Context) (string, error) {
+	if b.config.Username == "" {
+		return "", nil
+	}
+	var auth struct {
+		Token string `json:"token"`
+	}
+	err := b.post(ctx, "/v3/auth/authenticate", "", map[string]string{
+		"name":     b.config.Username,
+		"password": b.config.Password,
+	}, &auth)
+	if err != nil {
+		return "", fmt.Errorf("etcd authentication: %w", err)
+	}
+	return auth.Token, nil
+}
+
+func (b *etcdBackend) post(ctx context.Context, path, token string, request, response interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	resp, err := b.request(ctx, path, token, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+func (b *etcdBackend) request(ctx context.Context, path, token string, body []byte) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, b.config.Address+path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, errors.New("etcd returned " + resp.Status + ": " + string(message))
+	}
+	return resp, nil
+}
+
+func encodeKey(key string) string {
+	return base64.StdEncoding.EncodeToString([]byte(key))
+}
+
+// prefixEnd is the range end covering every key that starts with prefix
+func prefixEnd(prefix string) string {
+	end := []byte(prefix)
+	for i := len(end) - 1; i >= 0; i-- {
+		if end[i] < 0xff {
+			end[i]++
+			return string(end[:i+1])
+		}
+	}
+	return "\x00"
+}
@@ -0,0 +1,68 @@
+// Package egress keeps requests to client-supplied URLs off the router's own
+// network: loopback, private ranges, and link-local addresses such as the
+// cloud metadata service at 169.254.169.254.
+package egress
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrBlocked is returned for a destination that isn't a public address
+var ErrBlocked = errors.New("destination is not a public address")
+
+// sharedAddressSpace is carrier-grade NAT space, private in all but name
+var sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// Public reports whether ip is reachable on the internet rather than only
+// from the router's own network
+func Public(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() ||
+		sharedAddressSpace.Contains(ip))
+}
+
+// CheckHost rejects a URL host that is plainly not public, an IP literal
+// or localhost, before anything is dialled. Names are checked again by
+// Transport once resolved.
+func CheckHost(host string) error {
+	if strings.EqualFold(host, "localhost") || strings.HasSuffix(strings.ToLower(host), ".localhost") {
+		return fmt.Errorf("%w: %s", ErrBlocked, host)
+	}
+	if ip := net.ParseIP(host); ip != nil && !Public(ip) {
+		return fmt.Errorf("%w: %s", ErrBlocked, host)
+	}
+	return nil
+}
+
+// Transport returns an HTTP transport that only connects to public
+// addresses. The check is made on the address dialled, after DNS
+// resolution, so a name can't be re-pointed at a private address once it
+// has been validated. Proxies aren't used, as they would do the dialling.
+func Transport() *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   checkDial,
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return transport
+}
+
+func checkDial(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); ip == nil || !Public(ip) {
+		return fmt.Errorf("%w: %s", ErrBlocked, host)
+	}
+	return nil
+}
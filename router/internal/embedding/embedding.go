@@ -0,0 +1,209 @@
+// Package embedding shortens embedding vectors for backends that ignore
+// the OpenAI `dimensions` parameter, so clients get the size they asked for
+// wherever the request was routed
+package embedding
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+)
+
+// Config enables server-side dimensionality reduction
+type Config struct {
+	Enabled      bool              `yaml:"enabled"`
+	Method       string            `yaml:"method"`       // "truncate" (Matryoshka, default) or "pca"
+	NativeModels []string          `yaml:"nativeModels"` // models that honour dimensions themselves, default text-embedding-3-small/large
+	Projections  map[string]string `yaml:"projections"`  // model -> PCA projection file, required for "pca"
+}
+
+// Projection is a stored PCA projection: vectors are centred on Mean and
+// multiplied by the leading rows of Components, one row per output dimension
+type Projection struct {
+	Mean       []float64   `json:"mean"`
+	Components [][]float64 `json:"components"`
+}
+
+// Info describes a reduction, as recorded in the response's usage block
+type Info struct {
+	Method             string `json:"method"`
+	OriginalDimensions int    `json:"original_dimensions"`
+	Dimensions         int    `json:"dimensions"`
+}
+
+// Reducer applies the configured reduction
+type Reducer struct {
+	config      Config
+	native      map[string]bool
+	projections map[string]*Projection
+}
+
+// New loads the configured projections, returning nil when disabled
+func New(config Config) (*Reducer, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	if config.Method == "" {
+		config.Method = "truncate"
+	}
+	if config.Method != "truncate" && config.Method != "pca" {
+		return nil, fmt.Errorf("unknown reduction method %q", config.Method)
+	}
+	if config.NativeModels == nil {
+		config.NativeModels = []string{"text-embedding-3-small", "text-embedding-3-large"}
+	}
+
+	r := &Reducer{config: config, native: make(map[string]bool), projections: make(map[string]*Projection)}
+	for _, model := range config.NativeModels {
+		r.native[model] = true
+	}
+	for model, path := range config.Projections {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("projection for %s: %w", model, err)
+		}
+		var projection Projection
+		if err := json.Unmarshal(data, &projection); err != nil {
+			return nil, fmt.Errorf("projection for %s: %w", model, err)
+		}
+		for _, row := range projection.Components {
+			if len(row) != len(projection.Mean) {
+				return nil, fmt.Errorf("projection for %s: component rows must match the mean's %d dimensions", model, len(projection.Mean))
+			}
+		}
+		r.projections[model] = &projection
+	}
+	return r, nil
+}
+
+// Applies reports whether a request for model must be reduced here rather
+// than passing dimensions on to the backend
+func (r *Reducer) Applies(model string) bool {
+	return r != nil && !r.native[model]
+}
+
+// Method returns the configured reduction method
+func (r *Reducer) Method() string {
+	return r.config.Method
+}
+
+// Reduce shortens every embedding in an OpenAI embeddings response to dims,
+// float arrays and base64 alike, and notes the reduction under usage
+func (r *Reducer) Reduce(body []byte, model string, dims int) ([]byte, Info, error) {
+	var response map[string]interface{}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, Info{}, err
+	}
+	data, _ := response["data"].([]interface{})
+
+	info := Info{Method: r.config.Method, Dimensions: dims}
+	for _, item := range data {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		vector, encoded, err := decode(entry["embedding"])
+		if err != nil {
+			return nil, Info{}, err
+		}
+		if dims >= len(vector) {
+			return nil, Info{}, fmt.Errorf("%d dimensions requested from %d dimension embeddings", dims, len(vector))
+		}
+		info.OriginalDimensions = len(vector)
+
+		reduced, err := r.reduce(vector, model, dims)
+		if err != nil {
+			return nil, Info{}, err
+		}
+		entry["embedding"] = encode(reduced, encoded)
+	}
+
+	usage, _ := response["usage"].(map[string]interface{})
+	if usage == nil {
+		usage = make(map[string]interface{})
+		response["usage"] = usage
+	}
+	usage["dimension_reduction"] = info
+
+	rewritten, err := json.Marshal(response)
+	return rewritten, info, err
+}
+
+func (r *Reducer) reduce(vector []float64, model string, dims int) ([]float64, error) {
+	var reduced []float64
+	switch r.config.Method {
+	case "pca":
+		projection, ok := r.projections[model]
+		if !ok {
+			return nil, fmt.Errorf("no projection for model %s", model)
+		}
+		if len(vector) != len(projection.Mean) || dims > len(projection.Components) {
+			return nil, fmt.Errorf("projection for %s maps %d to at most %d dimensions", model, len(projection.Mean), len(projection.Components))
+		}
+		reduced = make([]float64, dims)
+		for i, row := range projection.Components[:dims] {
+			for j, v := range vector {
+				reduced[i] += row[j] * (v - projection.Mean[j])
+			}
+		}
+	default:
+		// Matryoshka embeddings front-load information, so a prefix is a
+		// usable shorter embedding once renormalized
+		reduced = append([]float64(nil), vector[:dims]...)
+	}
+	return normalize(reduced), nil
+}
+
+func normalize(vector []float64) []float64 {
+	var norm float64
+	for _, v := range vector {
+		norm += v * v
+	}
+	if norm = math.Sqrt(norm); norm > 0 {
+		for i := range vector {
+			vector[i] /= norm
+		}
+	}
+	return vector
+}
+
+// decode reads a float array or a base64 string of little-endian float32s
+func decode(value interface{}) ([]float64, bool, error) {
+	switch v := value.(type) {
+	case []interface{}:
+		vector := make([]float64, len(v))
+		for i, x := range v {
+			f, ok := x.(float64)
+			if !ok {
+				return nil, false, fmt.Errorf("embedding holds a non-number")
+			}
+			vector[i] = f
+		}
+		return vector, false, nil
+	case string:
+		raw, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(raw)%4 != 0 {
+			return nil, true, fmt.Errorf("invalid base64 embedding")
+		}
+		vector := make([]float64, len(raw)/4)
+		for i := range vector {
+			vector[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(raw[i*4:])))
+		}
+		return vector, true, nil
+	}
+	return nil, false, fmt.Errorf("unexpected embedding type %T", value)
+}
+
+func encode(vector []float64, asBase64 bool) interface{} {
+	if !asBase64 {
+		return vector
+	}
+	raw := make([]byte, 4*len(vector))
+	for i, v := range vector {
+		binary.LittleEndian.PutUint32(raw[i*4:], math.Float32bits(float32(v)))
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
@@ -0,0 +1,145 @@
+package engine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Model list response formats
+const (
+	FormatOpenAI = "openai" // {"data": [{"id": "..."}]}
+	FormatOllama = "ollama" // {"models": [{"name": "..."}]}
+)
+
+// Cluster metrics sources
+const (
+	MetricsStats   = "stats"   // Ad-hoc JSON from StatsPath
+	MetricsVLLM    = "vllm"    // vLLM's Prometheus exposition at MetricsPath
+	MetricsLocalAI = "localai" // LocalAI's Prometheus exposition at MetricsPath, latency only
+)
+
+// Default is the engine assumed when a cluster does not specify one
+const Default = "llamacpp"
+
+// Profile describes the HTTP conventions of a self-hosted OpenAI-compatible server
+type Profile struct {
+	Name          string
+	HealthPath    string // Liveness/readiness endpoint
+	ModelsPath    string // Model listing endpoint
+	ModelsFormat  string // FormatOpenAI or FormatOllama
+	AuthHeader    string // Header carrying the API key, empty if the server has no auth
+	AuthPrefix    string // Prefix prepended to the API key (e.g. "Bearer ")
+	MetricsPath   string // Prometheus endpoint, empty if not exposed
+	StatsPath     string // JSON stats endpoint, empty if not exposed
+	MetricsFormat string // MetricsStats or MetricsVLLM
+}
+
+var profiles = map[string]Profile{
+	"llamacpp": {
+		Name:         "llamacpp",
+		HealthPath:   "/health",
+		ModelsPath:   "/v1/models",
+		ModelsFormat: FormatOpenAI,
+		AuthHeader:   "Authorization",
+		AuthPrefix:   "Bearer ",
+		MetricsPath:  "/metrics",
+		StatsPath:    "/stats",
+	},
+	"vllm": {
+		Name:          "vllm",
+		HealthPath:    "/health",
+		ModelsPath:    "/v1/models",
+		ModelsFormat:  FormatOpenAI,
+		AuthHeader:    "Authorization",
+		AuthPrefix:    "Bearer ",
+		MetricsPath:   "/metrics",
+		MetricsFormat: MetricsVLLM,
+	},
+	"litellm": {
+		Name:         "litellm",
+		HealthPath:   "/health/liveliness", // /health fans out to every backend, too slow for probing
+		ModelsPath:   "/v1/models",
+		ModelsFormat: FormatOpenAI,
+		AuthHeader:   "Authorization",
+		AuthPrefix:   "Bearer ",
+	},
+	"localai": {
+		Name:          "localai",
+		HealthPath:    "/readyz",
+		ModelsPath:    "/v1/models",
+		ModelsFormat:  FormatOpenAI,
+		AuthHeader:    "Authorization",
+		AuthPrefix:    "Bearer ",
+		MetricsPath:   "/metrics",
+		MetricsFormat: MetricsLocalAI,
+	},
+	"ollama": {
+		Name:         "ollama",
+		HealthPath:   "/api/version",
+		ModelsPath:   "/api/tags",
+		ModelsFormat: FormatOllama,
+	},
+}
+
+// Lookup returns the profile for the named engine; an empty name resolves to Default
+func Lookup(name string) (Profile, bool) {
+	if name == "" {
+		name = Default
+	}
+	profile, exists := profiles[name]
+	return profile, exists
+}
+
+// Names returns the names of all known engines
+func Names() []string {
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	return names
+}
+
+// AuthHeaderValue returns the header name and value used to present apiKey to the server
+func (p Profile) AuthHeaderValue(apiKey string) (string, string, bool) {
+	if p.AuthHeader == "" || apiKey == "" {
+		return "", "", false
+	}
+	return p.AuthHeader, p.AuthPrefix + apiKey, true
+}
+
+// ParseModels extracts model identifiers from a model listing response
+func ParseModels(format string, body io.Reader) ([]string, error) {
+	var models []string
+
+	switch format {
+	case FormatOllama:
+		var resp struct {
+			Models []struct {
+				Name string `json:"name"`
+			} `json:"models"`
+		}
+		if err := json.NewDecoder(body).Decode(&resp); err != nil {
+			return nil, fmt.Errorf("failed to decode model list: %w", err)
+		}
+		for _, m := range resp.Models {
+			models = append(models, m.Name)
+		}
+	case FormatOpenAI, "":
+		var resp struct {
+			Data []struct {
+				ID string `json:"id"`
+			} `json:"data"`
+		}
+		if err := json.NewDecoder(body).Decode(&resp); err != nil {
+			return nil, fmt.Errorf("failed to decode model list: %w", err)
+		}
+		for _, m := range resp.Data {
+			models = append(models, m.ID)
+		}
+	default:
+		return nil, fmt.Errorf("unknown model list format: %s", format)
+	}
+
+	return models, nil
+}
@@ -0,0 +1,367 @@
+// Package extension runs operator-supplied WebAssembly modules as request
+// filters, response filters and scoring functions.
+//
+// ABI version 1. A module must export:
+//
+//	memory
+//	abi_version() -> i32                 returns 1
+//	alloc(size i32) -> i32               returns a buffer the router writes input into
+//
+// and any of the hooks below. Each hook receives a JSON document written at
+// (ptr, len) and returns its JSON result packed as (ptr << 32 | len):
+//
+//	filter_request(ptr, len i32) -> i64  RequestInput  -> RequestDecision
+//	filter_response(ptr, len i32) -> i64 ResponseInput -> ResponseDecision
+//	score(ptr, len i32) -> i64           ScoreInput    -> ScoreResult
+//
+// An optional dealloc(ptr, len i32) is called to release input and output
+// buffers. Modules get WASI with no filesystem, network, environment or
+// arguments; memory and per-call time are capped by Config.
+package extension
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/tetratelabs/wazero"
+	"github.com/tetratelabs/wazero/api"
+	"github.com/tetratelabs/wazero/imports/wasi_snapshot_preview1"
+)
+
+// ABIVersion is the extension ABI implemented by this router
+const ABIVersion = 1
+
+const (
+	hookFilterRequest  = "filter_request"
+	hookFilterResponse = "filter_response"
+	hookScore          = "score"
+)
+
+// Config describes one extension module
+type Config struct {
+	Name          string        `yaml:"name"`
+	Path          string        `yaml:"path"`          // .wasm file
+	MemoryLimitMB int           `yaml:"memoryLimitMB"` // default 16
+	Timeout       time.Duration `yaml:"timeout"`       // per hook call, default 50ms
+	Instances     int           `yaml:"instances"`     // concurrent calls, default 4
+}
+
+// RequestInput is passed to filter_request
+type RequestInput struct {
+	Endpoint string            `json:"endpoint"`
+	Model    string            `json:"model"`
+	Headers  map[string]string `json:"headers"`
+	Body     json.RawMessage   `json:"body"`
+}
+
+// RequestDecision is returned by filter_request. An empty action continues.
+type RequestDecision struct {
+	Action  string          `json:"action"` // "continue" or "reject"
+	Status  int             `json:"status,omitempty"`
+	Message string          `json:"message,omitempty"`
+	Body    json.RawMessage `json:"body,omitempty"` // replacement request body
+}
+
+// ResponseInput is passed to filter_response for non-streaming responses
+type ResponseInput struct {
+	Endpoint string          `json:"endpoint"`
+	Model    string          `json:"model"`
+	Status   int             `json:"status"`
+	Body     json.RawMessage `json:"body"`
+}
+
+// ResponseDecision is returned by filter_response
+type ResponseDecision struct {
+	Body json.RawMessage `json:"body,omitempty"` // replacement response body
+}
+
+// Candidate describes a routing target offered to score
+type Candidate struct {
+	Name       string  `json:"name"`
+	Type       string  `json:"type"`
+	Cost       float64 `json:"cost_per_1k_tokens"`
+	LatencyMs  float64 `json:"latency_ms"`
+	QueueDepth int     `json:"queue_depth"`
+}
+
+// ScoreInput is passed to score
+type ScoreInput struct {
+	Model   string      `json:"model"`
+	Targets []Candidate `json:"targets"`
+}
+
+// ScoreResult is returned by score; the lowest score wins and unscored
+// targets are not chosen
+type ScoreResult struct {
+	Scores map[string]float64 `json:"scores"`
+}
+
+// extension is a compiled module with a pool of instances
+type extension struct {
+	config   Config
+	runtime  wazero.Runtime
+	compiled wazero.CompiledModule
+	hooks    map[string]bool
+	pool     chan api.Module
+}
+
+func load(ctx context.Context, cfg Config) (*extension, error) {
+	if cfg.MemoryLimitMB == 0 {
+		cfg.MemoryLimitMB = 16
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = 50 * time.Millisecond
+	}
+	if cfg.Instances == 0 {
+		cfg.Instances = 4
+	}
+
+	wasm, err := os.ReadFile(cfg.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	runtimeConfig := wazero.NewRuntimeConfig().
+		WithMemoryLimitPages(uint32(cfg.MemoryLimitMB * 16)). // 64KiB pages
+		WithCloseOnContextDone(true)
+	runtime := wazero.NewRuntimeWithConfig(ctx, runtimeConfig)
+	if _, err := wasi_snapshot_preview1.Instantiate(ctx, runtime); err != nil {
+		runtime.Close(ctx)
+		return nil, err
+	}
+
+	compiled, err := runtime.CompileModule(ctx, wasm)
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("failed to compile: %w", err)
+	}
+
+	ext := &extension{
+		config:   cfg,
+		runtime:  runtime,
+		compiled: compiled,
+		hooks:    make(map[string]bool),
+		pool:     make(chan api.Module, cfg.Instances),
+	}
+	exports := compiled.ExportedFunctions()
+	for _, required := range []string{"abi_version", "alloc"} {
+		if _, ok := exports[required]; !ok {
+			runtime.Close(ctx)
+			return nil, fmt.Errorf("missing required export %s", required)
+		}
+	}
+	for _, hook := range []string{hookFilterRequest, hookFilterResponse, hookScore} {
+		ext.hooks[hook] = exports[hook] != nil
+	}
+
+	for i := 0; i < cfg.Instances; i++ {
+		mod, err := ext.instantiate(ctx)
+		if err != nil {
+			runtime.Close(ctx)
+			return nil, err
+		}
+		ext.pool <- mod
+	}
+
+	// Every instance comes from the same binary, so checking one suffices
+	mod := <-ext.pool
+	results, err := mod.ExportedFunction("abi_version").Call(ctx)
+	ext.pool <- mod
+	if err != nil {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("abi_version failed: %w", err)
+	}
+	if version := int(int32(results[0])); version != ABIVersion {
+		runtime.Close(ctx)
+		return nil, fmt.Errorf("module implements ABI %d, router supports %d", version, ABIVersion)
+	}
+
+	return ext, nil
+}
+
+func (e *extension) instantiate(ctx context.Context) (api.Module, error) {
+	// No mounts, env or args: the module sees an empty WASI world. Reactor
+	// modules are initialized; command modules' main is never run.
+	moduleConfig := wazero.NewModuleConfig().
+		WithName("").
+		WithStartFunctions("_initialize")
+	return e.runtime.InstantiateModule(ctx, e.compiled, moduleConfig)
+}
+
+// call runs hook with input on a pooled instance under the time limit
+func (e *extension) call(ctx context.Context, hook string, input, output interface{}) error {
+	payload, err := json.Marshal(input)
+	if err != nil {
+		return err
+	}
+
+	mod := <-e.pool
+	callCtx, cancel := context.WithTimeout(ctx, e.config.Timeout)
+	defer cancel()
+
+	result, err := invoke(callCtx, mod, hook, payload)
+	if mod.IsClosed() || err != nil {
+		// A trapped or timed-out instance may be corrupt; replace it
+		mod.Close(context.Background())
+		if fresh, instErr := e.instantiate(context.Background()); instErr == nil {
+			mod = fresh
+		} else {
+			logrus.Errorf("Extension %s: failed to replace instance: %v", e.config.Name, instErr)
+		}
+	}
+	e.pool <- mod
+
+	if err != nil {
+		return fmt.Errorf("extension %s %s: %w", e.config.Name, hook, err)
+	}
+	if err := json.Unmarshal(result, output); err != nil {
+		return fmt.Errorf("extension %s %s returned invalid JSON: %w", e.config.Name, hook, err)
+	}
+	return nil
+}
+
+func invoke(ctx context.Context, mod api.Module, hook string, payload []byte) ([]byte, error) {
+	alloc := mod.ExportedFunction("alloc")
+	dealloc := mod.ExportedFunction("dealloc")
+
+	results, err := alloc.Call(ctx, uint64(len(payload)))
+	if err != nil {
+		return nil, err
+	}
+	inPtr := uint32(results[0])
+	if !mod.Memory().Write(inPtr, payload) {
+		return nil, fmt.Errorf("alloc returned out-of-range buffer")
+	}
+
+	results, err = mod.ExportedFunction(hook).Call(ctx, uint64(inPtr), uint64(len(payload)))
+	if err != nil {
+		return nil, err
+	}
+	outPtr, outLen := uint32(results[0]>>32), uint32(results[0])
+	output, ok := mod.Memory().Read(outPtr, outLen)
+	if !ok {
+		return nil, fmt.Errorf("result out of range")
+	}
+	// Copy out before the module can reuse its memory
+	output = append([]byte(nil), output...)
+
+	if dealloc != nil {
+		dealloc.Call(ctx, uint64(inPtr), uint64(len(payload)))
+		dealloc.Call(ctx, uint64(outPtr), uint64(outLen))
+	}
+	return output, nil
+}
+
+// Manager runs loaded extensions in configuration order
+type Manager struct {
+	extensions []*extension
+}
+
+// Load compiles and instantiates the configured extensions
+func Load(ctx context.Context, configs []Config) (*Manager, error) {
+	m := &Manager{}
+	for _, cfg := range configs {
+		ext, err := load(ctx, cfg)
+		if err != nil {
+			m.Close(ctx)
+			return nil, fmt.Errorf("extension %s: %w", cfg.Name, err)
+		}
+		logrus.Infof("Loaded extension %s (request=%t response=%t score=%t)", cfg.Name,
+			ext.hooks[hookFilterRequest], ext.hooks[hookFilterResponse], ext.hooks[hookScore])
+		m.extensions = append(m.extensions, ext)
+	}
+	return m, nil
+}
+
+// Close releases all extension runtimes
+func (m *Manager) Close(ctx context.Context) {
+	for _, ext := range m.extensions {
+		ext.runtime.Close(ctx)
+	}
+}
+
+func (m *Manager) has(hook string) bool {
+	for _, ext := range m.extensions {
+		if ext.hooks[hook] {
+			return true
+		}
+	}
+	return false
+}
+
+// FiltersRequests reports whether any extension filters requests
+func (m *Manager) FiltersRequests() bool {
+	return m.has(hookFilterRequest)
+}
+
+// FiltersResponses reports whether any extension filters responses
+func (m *Manager) FiltersResponses() bool {
+	return m.has(hookFilterResponse)
+}
+
+// Scores reports whether any extension provides a scoring function
+func (m *Manager) Scores() bool {
+	return m.has(hookScore)
+}
+
+// FilterRequest passes the request through each request filter in turn,
+// stopping at the first rejection. Replacement bodies are handed on.
+func (m *Manager) FilterRequest(ctx context.Context, input RequestInput) (RequestDecision, error) {
+	decision := RequestDecision{Action: "continue"}
+	for _, ext := range m.extensions {
+		if !ext.hooks[hookFilterRequest] {
+			continue
+		}
+
+		var result RequestDecision
+		if err := ext.call(ctx, hookFilterRequest, input, &result); err != nil {
+			return decision, err
+		}
+		if result.Action == "reject" {
+			return result, nil
+		}
+		if len(result.Body) > 0 {
+			input.Body = result.Body
+			decision.Body = result.Body
+		}
+	}
+	return decision, nil
+}
+
+// FilterResponse passes a buffered response body through each response filter
+func (m *Manager) FilterResponse(ctx context.Context, input ResponseInput) ([]byte, error) {
+	for _, ext := range m.extensions {
+		if !ext.hooks[hookFilterResponse] {
+			continue
+		}
+
+		var result ResponseDecision
+		if err := ext.call(ctx, hookFilterResponse, input, &result); err != nil {
+			return input.Body, err
+		}
+		if len(result.Body) > 0 {
+			input.Body = result.Body
+		}
+	}
+	return input.Body, nil
+}
+
+// Score asks the first scoring extension to rank the candidates
+func (m *Manager) Score(ctx context.Context, input ScoreInput) (map[string]float64, error) {
+	for _, ext := range m.extensions {
+		if !ext.hooks[hookScore] {
+			continue
+		}
+
+		var result ScoreResult
+		if err := ext.call(ctx, hookScore, input, &result); err != nil {
+			return nil, err
+		}
+		return result.Scores, nil
+	}
+	return nil, fmt.Errorf("no scoring extension loaded")
+}
@@ -20,14 +20,22 @@ import (
 type Forwarder struct {
 	mu          sync.RWMutex
 	hmacSecrets map[string]string
+	apiKeys     map[string]apiKeyAuth
 	tlsConfigs  map[string]*tls.Config
 	httpClient  *http.Client
 }
 
+// apiKeyAuth is a static credential header presented to a cluster
+type apiKeyAuth struct {
+	header string
+	value  string
+}
+
 // NewForwarder creates a new request forwarder
 func NewForwarder() *Forwarder {
 	return &Forwarder{
 		hmacSecrets: make(map[string]string),
+		apiKeys:     make(map[string]apiKeyAuth),
 		tlsConfigs:  make(map[string]*tls.Config),
 		httpClient: &http.Client{
 			Timeout: 120 * time.Second, // Long timeout for LLM generation
@@ -47,6 +55,22 @@ func (f *Forwarder) SetHMACAuth(clusterName, sharedSecret string) {
 	f.hmacSecrets[clusterName] = sharedSecret
 }
 
+// SetAPIKeyAuth configures a static credential header for a cluster (e.g. a LiteLLM master key)
+func (f *Forwarder) SetAPIKeyAuth(clusterName, header, value string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.apiKeys[clusterName] = apiKeyAuth{header: header, value: value}
+}
+
+// ClearAuth removes every credential configured for a cluster
+func (f *Forwarder) ClearAuth(clusterName string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.hmacSecrets, clusterName)
+	delete(f.apiKeys, clusterName)
+	delete(f.tlsConfigs, clusterName)
+}
+
 // SetMTLSAuth configures mTLS authentication for a cluster
 func (f *Forwarder) SetMTLSAuth(clusterName, certFile, keyFile string) error {
 	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
@@ -76,7 +100,7 @@ func (f *Forwarder) Forward(w http.ResponseWriter, r *http.Request, clusterName,
 	defer r.Body.Close()
 	
 	// Create new request
-	req, err := http.NewRequest(r.Method, targetURL, io.NopCloser(bytes.NewBuffer(body)))
+	req, err := http.NewRequestWithContext(r.Context(), r.Method, targetURL, io.NopCloser(bytes.NewBuffer(body)))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -129,6 +153,11 @@ func (f *Forwarder) addAuthentication(req *http.Request, clusterName string, bod
 	if secret, exists := f.hmacSecrets[clusterName]; exists {
 		f.addHMACAuth(req, secret, body)
 	}
+
+	// Check for API key authentication, replacing any client-supplied credential
+	if auth, exists := f.apiKeys[clusterName]; exists {
+		req.Header.Set(auth.header, auth.value)
+	}
 	
 	// mTLS is handled by the HTTP client configuration
 }
@@ -0,0 +1,264 @@
+package glossary
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Rule scopes
+const (
+	ScopeAll      = "all"      // every target
+	ScopeExternal = "external" // external providers only
+)
+
+// Rule substitutes one term
+type Rule struct {
+	Term       string `yaml:"term"`
+	Replace    string `yaml:"replace"`    // default: a placeholder when restoring, else required
+	Scope      string `yaml:"scope"`      // "all" (default) or "external"
+	Restore    bool   `yaml:"restore"`    // map the replacement back to the term in responses
+	IgnoreCase bool   `yaml:"ignoreCase"` // match the term case-insensitively
+}
+
+// Config holds glossary rules applied to every caller and per tenant
+type Config struct {
+	Enabled bool              `yaml:"enabled"`
+	Rules   []Rule            `yaml:"rules"`
+	Tenants map[string][]Rule `yaml:"tenants"` // added to the global rules for callers of that tenant
+}
+
+type compiledRule struct {
+	pattern  *regexp.Regexp
+	replace  string
+	external bool
+	restore  bool
+	term     string
+}
+
+// Glossary compiles the configured rules
+type Glossary struct {
+	global  []compiledRule
+	tenants map[string][]compiledRule
+
+	mu    sync.Mutex
+	cache map[string]*Substitution
+}
+
+// New compiles a glossary, or returns nil when disabled
+func New(config Config) (*Glossary, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+
+	placeholders := 0
+	compile := func(rules []Rule, owner string) ([]compiledRule, error) {
+		var compiled []compiledRule
+		for _, rule := range rules {
+			if rule.Term == "" {
+				return nil, fmt.Errorf("%s: rule without a term", owner)
+			}
+			if rule.Scope != "" && rule.Scope != ScopeAll && rule.Scope != ScopeExternal {
+				return nil, fmt.Errorf("%s: unknown scope %q for %q", owner, rule.Scope, rule.Term)
+			}
+			replace := rule.Replace
+			if replace == "" {
+				if !rule.Restore {
+					return nil, fmt.Errorf("%s: %q needs a replacement or restore", owner, rule.Term)
+				}
+				placeholders++
+				replace = fmt.Sprintf("TERM_%04d", placeholders)
+			}
+
+			expr := regexp.QuoteMeta(rule.Term)
+			if isWordChar(rule.Term[0]) {
+				expr = `\b` + expr
+			}
+			if isWordChar(rule.Term[len(rule.Term)-1]) {
+				expr += `\b`
+			}
+			if rule.IgnoreCase {
+				expr = "(?i)" + expr
+			}
+			compiled = append(compiled, compiledRule{
+				pattern:  regexp.MustCompile(expr),
+				replace:  replace,
+				external: rule.Scope == ScopeExternal,
+				restore:  rule.Restore,
+				term:     rule.Term,
+			})
+		}
+		return compiled, nil
+	}
+
+	global, err := compile(config.Rules, "glossary")
+	if err != nil {
+		return nil, err
+	}
+	g := &Glossary{
+		global:  global,
+		tenants: make(map[string][]compiledRule),
+		cache:   make(map[string]*Substitution),
+	}
+	for tenant, rules := range config.Tenants {
+		compiled, err := compile(rules, "glossary tenant "+tenant)
+		if err != nil {
+			return nil, err
+		}
+		g.tenants[tenant] = compiled
+	}
+	return g, nil
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// For returns the substitution for a tenant's request to an external or
+// self-hosted target, or nil if no rule applies
+func (g *Glossary) For(tenant string, external bool) *Substitution {
+	if g == nil {
+		return nil
+	}
+	key := fmt.Sprintf("%s\x00%t", tenant, external)
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if sub, ok := g.cache[key]; ok {
+		return sub
+	}
+
+	var rules []compiledRule
+	for _, rule := range append(append([]compiledRule(nil), g.global...), g.tenants[tenant]...) {
+		if !rule.external || external {
+			rules = append(rules, rule)
+		}
+	}
+	var sub *Substitution
+	if len(rules) > 0 {
+		sub = newSubstitution(rules)
+	}
+	g.cache[key] = sub
+	return sub
+}
+
+// Substitution rewrites request text and restores it in responses
+type Substitution struct {
+	rules        []compiledRule
+	restorer     *strings.Replacer // replacement -> term in decoded text
+	jsonRestorer *strings.Replacer // the same, JSON-escaped, for raw bodies
+	placeholders []string
+}
+
+func newSubstitution(rules []compiledRule) *Substitution {
+	var pairs, jsonPairs []string
+	var placeholders []string
+	for _, rule := range rules {
+		if !rule.restore {
+			continue
+		}
+		pairs = append(pairs, rule.replace, rule.term)
+		jsonPairs = append(jsonPairs, jsonEscape(rule.replace), jsonEscape(rule.term))
+		placeholders = append(placeholders, rule.replace)
+	}
+	sub := &Substitution{rules: rules, placeholders: placeholders}
+	if len(pairs) > 0 {
+		sub.restorer = strings.NewReplacer(pairs...)
+		sub.jsonRestorer = strings.NewReplacer(jsonPairs...)
+	}
+	return sub
+}
+
+func jsonEscape(s string) string {
+	var b strings.Builder
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	enc.Encode(s)
+	out := strings.TrimSpace(b.String())
+	return out[1 : len(out)-1]
+}
+
+// Restores reports whether responses need restoring
+func (s *Substitution) Restores() bool {
+	return s.restorer != nil
+}
+
+// skippedKeys hold identifiers rather than text
+var skippedKeys = map[string]bool{"model": true, "role": true, "tool_call_id": true, "type": true}
+
+// Rewrite applies the rules to every text value of a JSON request body.
+// Bodies that aren't JSON are returned unchanged.
+func (s *Substitution) Rewrite(body []byte) ([]byte, int) {
+	var data interface{}
+	if err := json.Unmarshal(body, &data); err != nil {
+		return body, 0
+	}
+	count := 0
+	data = s.walk(data, &count)
+	if count == 0 {
+		return body, 0
+	}
+	rewritten, err := json.Marshal(data)
+	if err != nil {
+		return body, 0
+	}
+	return rewritten, count
+}
+
+func (s *Substitution) walk(v interface{}, count *int) interface{} {
+	switch v := v.(type) {
+	case string:
+		return s.rewriteText(v, count)
+	case []interface{}:
+		for i, item := range v {
+			v[i] = s.walk(item, count)
+		}
+	case map[string]interface{}:
+		for key, item := range v {
+			if !skippedKeys[key] {
+				v[key] = s.walk(item, count)
+			}
+		}
+	}
+	return v
+}
+
+func (s *Substitution) rewriteText(text string, count *int) string {
+	for _, rule := range s.rules {
+		text = rule.pattern.ReplaceAllStringFunc(text, func(string) string {
+			*count++
+			return rule.replace
+		})
+	}
+	return text
+}
+
+// RestoreJSON maps replacements back to terms in a raw JSON body
+func (s *Substitution) RestoreJSON(body []byte) []byte {
+	if s.jsonRestorer == nil {
+		return body
+	}
+	return []byte(s.jsonRestorer.Replace(string(body)))
+}
+
+// RestoreText maps replacements back to terms in streamed text. The tail
+// that could be the start of a split replacement is returned separately
+// to be prepended to the next chunk.
+func (s *Substitution) RestoreText(text string) (restored, held string) {
+	if s.restorer == nil {
+		return text, ""
+	}
+	text = s.restorer.Replace(text)
+	hold := 0
+	for _, placeholder := range s.placeholders {
+		for n := len(placeholder) - 1; n > hold; n-- {
+			if strings.HasSuffix(text, placeholder[:n]) {
+				hold = n
+				break
+			}
+		}
+	}
+	return text[:len(text)-hold], text[len(text)-hold:]
+}
@@ -0,0 +1,218 @@
+package groups
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Config defines a named group of clusters with aggregate policies
+type Config struct {
+	Name           string   `yaml:"name"`
+	Clusters       []string `yaml:"clusters"`
+	MaxConcurrency int      `yaml:"maxConcurrency"` // Combined in-flight limit, 0 = unlimited
+	MonthlyBudget  float64  `yaml:"monthlyBudget"`  // Combined monthly spend limit in USD, 0 = unlimited
+	Weight         float64  `yaml:"weight"`         // Share of traffic in weighted routing, split across members
+}
+
+// Status reports a group's current usage
+type Status struct {
+	Name           string   `json:"name"`
+	Clusters       []string `json:"clusters"`
+	InFlight       int      `json:"in_flight"`
+	MaxConcurrency int      `json:"max_concurrency"`
+	MonthSpend     float64  `json:"month_spend_usd"`
+	MonthlyBudget  float64  `json:"monthly_budget_usd"`
+	Weight         float64  `json:"weight"`
+}
+
+type group struct {
+	config   Config
+	inFlight int
+	spend    float64
+	month    string
+}
+
+// Manager enforces group policies for member clusters
+type Manager struct {
+	mu       sync.Mutex
+	groups   map[string]*group
+	memberOf map[string][]*group // cluster name -> groups
+}
+
+// NewManager creates a manager for the configured groups
+func NewManager(configs []Config) (*Manager, error) {
+	m := &Manager{
+		groups:   make(map[string]*group),
+		memberOf: make(map[string][]*group),
+	}
+
+	for _, cfg := range configs {
+		if cfg.Name == "" {
+			return nil, fmt.Errorf("cluster group without a name")
+		}
+		if _, exists := m.groups[cfg.Name]; exists {
+			return nil, fmt.Errorf("duplicate cluster group: %s", cfg.Name)
+		}
+
+		g := &group{config: cfg, month: currentMonth()}
+		m.groups[cfg.Name] = g
+		for _, cluster := range cfg.Clusters {
+			m.memberOf[cluster] = append(m.memberOf[cluster], g)
+		}
+	}
+
+	return m, nil
+}
+
+func currentMonth() string {
+	return time.Now().UTC().Format("2006-01")
+}
+
+// rollover resets spend at the start of a new month (lock must be held)
+func (g *group) rollover() {
+	if month := currentMonth(); g.month != month {
+		g.month = month
+		g.spend = 0
+	}
+}
+
+// Allowed reports whether a cluster may receive a new request under the
+// policies of every group it belongs to
+func (m *Manager) Allowed(cluster string) (bool, string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, g := range m.memberOf[cluster] {
+		g.rollover()
+		if g.config.MaxConcurrency > 0 && g.inFlight >= g.config.MaxConcurrency {
+			return false, fmt.Sprintf("group %s at concurrency limit", g.config.Name)
+		}
+		if g.config.MonthlyBudget > 0 && g.spend >= g.config.MonthlyBudget {
+			return false, fmt.Sprintf("group %s monthly budget exhausted", g.config.Name)
+		}
+	}
+	return true, ""
+}
+
+// TryAcquire reserves a concurrency slot in every group the cluster belongs
+// to. The returned release function must be called when the request ends.
+func (m *Manager) TryAcquire(cluster string) (func(), bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	member := m.memberOf[cluster]
+	for _, g := range member {
+		if g.config.MaxConcurrency > 0 && g.inFlight >= g.config.MaxConcurrency {
+			return nil, false
+		}
+	}
+	for _, g := range member {
+		g.inFlight++
+	}
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			m.mu.Lock()
+			defer m.mu.Unlock()
+			for _, g := range member {
+				g.inFlight--
+			}
+		})
+	}, true
+}
+
+// RecordSpend attributes spend to every group the cluster belongs to
+func (m *Manager) RecordSpend(cluster string, usd float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, g := range m.memberOf[cluster] {
+		g.rollover()
+		g.spend += usd
+	}
+}
+
+// Spend is a group's recorded spend for a month
+type Spend struct {
+	Month string  `json:"month"`
+	USD   float64 `json:"usd"`
+}
+
+// Spend returns every group's spend so it can outlive the process
+func (m *Manager) Spend() map[string]Spend {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	spend := make(map[string]Spend, len(m.groups))
+	for name, g := range m.groups {
+		g.rollover()
+		spend[name] = Spend{Month: g.month, USD: g.spend}
+	}
+	return spend
+}
+
+// RestoreSpend reloads spend saved by Spend. Entries for other months or
+// unknown groups are ignored.
+func (m *Manager) RestoreSpend(spend map[string]Spend) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for name, saved := range spend {
+		if g, ok := m.groups[name]; ok && saved.Month == currentMonth() {
+			g.month = saved.Month
+			g.spend = saved.USD
+		}
+	}
+}
+
+// Weight returns a cluster's weighted-routing weight derived from its groups:
+// each group's weight is split evenly across its members. Ungrouped clusters
+// and groups without a weight return ok=false.
+func (m *Manager) Weight(cluster string) (float64, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	weight, found := 0.0, false
+	for _, g := range m.memberOf[cluster] {
+		if g.config.Weight > 0 && len(g.config.Clusters) > 0 {
+			weight += g.config.Weight / float64(len(g.config.Clusters))
+			found = true
+		}
+	}
+	return weight, found
+}
+
+// Groups returns the names of groups the cluster belongs to
+func (m *Manager) Groups(cluster string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var names []string
+	for _, g := range m.memberOf[cluster] {
+		names = append(names, g.config.Name)
+	}
+	return names
+}
+
+// Status returns the usage of every group
+func (m *Manager) Status() []Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	statuses := make([]Status, 0, len(m.groups))
+	for _, g := range m.groups {
+		g.rollover()
+		statuses = append(statuses, Status{
+			Name:           g.config.Name,
+			Clusters:       g.config.Clusters,
+			InFlight:       g.inFlight,
+			MaxConcurrency: g.config.MaxConcurrency,
+			MonthSpend:     g.spend,
+			MonthlyBudget:  g.config.MonthlyBudget,
+			Weight:         g.config.Weight,
+		})
+	}
+	return statuses
+}
@@ -1,12 +1,16 @@
 package health
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"net/http"
+	"sort"
 	"sync"
 	"time"
 
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/engine"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/httpcache"
 	"github.com/sirupsen/logrus"
 )
 
@@ -20,49 +24,323 @@ type ClusterMetrics struct {
 	TokensPerSecond  float64   `json:"tokens_per_second"`
 	ErrorCount       int       `json:"error_count"`
 	ConsecutiveError int       `json:"consecutive_errors"`
+	ConsecutiveOK    int       `json:"consecutive_successes"`
 	Endpoint         string    `json:"endpoint"`
+	Engine           string    `json:"engine"`
+	Models           []string  `json:"models,omitempty"`
+	Cordoned         bool      `json:"cordoned,omitempty"` // out of rotation until uncordoned, whatever its health
+	CordonReason     string    `json:"cordon_reason,omitempty"`
 }
 
-// Checker monitors cluster health and collects metrics
+// ClusterOptions holds per-cluster probing settings
+type ClusterOptions struct {
+	Profile engine.Profile // HTTP conventions of the cluster's server software
+	APIKey  string         // Presented using the profile's auth header, if any
+	Timeout time.Duration  // per-request health check timeout, default 10s
+}
+
+type clusterTarget struct {
+	metrics *ClusterMetrics
+	options ClusterOptions
+	checked bool // a check has completed; the first success needs no recovery streak
+}
+
+// ProviderStatus is the cached result of an external provider health check
+// and, when probing is enabled, of its synthetic completion probes
+type ProviderStatus struct {
+	Healthy          bool      `json:"healthy"`
+	LastCheck        time.Time `json:"last_check"`
+	ResponseTime     float64   `json:"response_time_ms"`
+	Error            string    `json:"error,omitempty"`
+	LatencyP95       float64   `json:"latency_p95_ms,omitempty"`
+	ProbeErrorRate   float64   `json:"probe_error_rate"`
+	ProbeSamples     int       `json:"probe_samples"`
+	ConsecutiveError int       `json:"consecutive_probe_errors"`
+}
+
+// probeWindow is how many recent probes latency and error rate cover
+const probeWindow = 20
+
+type probeSample struct {
+	latencyMs float64
+	ok        bool
+}
+
+type providerTarget struct {
+	check    func(context.Context) error
+	probe    func(context.Context) error
+	samples  []probeSample
+	status   ProviderStatus
+	checking bool // a synchronous refresh is in flight
+}
+
+// Checker monitors cluster and external provider health and collects metrics
 type Checker struct {
 	mu                   sync.RWMutex
-	clusters             map[string]*ClusterMetrics
+	clusters             map[string]*clusterTarget
+	providers            map[string]*providerTarget
+	providerTTL          time.Duration
 	checkInterval        time.Duration
 	httpClient           *http.Client
 	maxConsecutiveErrors int
+	recoveryThreshold    int
+
+	scrapeMu    sync.Mutex
+	vllmSamples map[string]*vllmSample // keyed by endpoint, LocalAI's too
+
+	catalogCache *httpcache.Cache // model inventories; nil fetches uncached
 }
 
 // NewChecker creates a new health checker
 func NewChecker(checkInterval time.Duration) *Checker {
 	return &Checker{
-		clusters:             make(map[string]*ClusterMetrics),
+		clusters:             make(map[string]*clusterTarget),
+		providers:            make(map[string]*providerTarget),
+		providerTTL:          2 * checkInterval,
 		checkInterval:        checkInterval,
 		maxConsecutiveErrors: 3,
+		recoveryThreshold:    1,
+		vllmSamples:          make(map[string]*vllmSample),
 		httpClient: &http.Client{
 			Timeout: 10 * time.Second,
 		},
 	}
 }
 
-// AddCluster adds a cluster to be monitored
-func (c *Checker) AddCluster(name, endpoint string) {
+// SetCatalogCache routes model inventory lookups through cache
+func (c *Checker) SetCatalogCache(cache *httpcache.Cache) {
+	c.catalogCache = cache
+}
+
+// SetThresholds sets how many consecutive failed checks mark a target
+// unhealthy and how many consecutive successes bring an unhealthy cluster
+// back. Values below 1 keep the defaults of 3 and 1.
+func (c *Checker) SetThresholds(maxConsecutiveErrors, recoveryThreshold int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if maxConsecutiveErrors > 0 {
+		c.maxConsecutiveErrors = maxConsecutiveErrors
+	}
+	if recoveryThreshold > 0 {
+		c.recoveryThreshold = recoveryThreshold
+	}
+}
+
+// SetProviderHealthTTL sets how long a provider health result is served
+// before a lookup refreshes it (default twice the check interval)
+func (c *Checker) SetProviderHealthTTL(ttl time.Duration) {
+	c.providerTTL = ttl
+}
+
+// AddProvider adds an external provider whose check runs on the health
+// loop, so routing never waits on a provider API round trip
+func (c *Checker) AddProvider(name string, check func(context.Context) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.providers[name] = &providerTarget{check: check}
+}
+
+// RemoveProvider stops checking a provider
+func (c *Checker) RemoveProvider(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.providers[name]; !exists {
+		return false
+	}
+	delete(c.providers, name)
+	return true
+}
+
+// SetProviderProbe adds a synthetic request run after each successful
+// health check of the provider, timing a real completion
+func (c *Checker) SetProviderProbe(name string, probe func(context.Context) error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if provider, exists := c.providers[name]; exists {
+		provider.probe = probe
+	}
+}
+
+// ProviderLatencyP95 returns the p95 latency of a provider's recent
+// successful probes, if any
+func (c *Checker) ProviderLatencyP95(name string) (float64, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	provider, exists := c.providers[name]
+	if !exists || provider.status.LatencyP95 == 0 {
+		return 0, false
+	}
+	return provider.status.LatencyP95, true
+}
+
+// ProviderHealthy returns a provider's cached health. Like clusters,
+// providers failing several probes in a row are unhealthy. Results older than
+// the TTL, or missing because the loop hasn't run yet, are refreshed
+// synchronously unless a refresh is already running, in which case the
+// stale result is served.
+func (c *Checker) ProviderHealthy(ctx context.Context, name string) bool {
+	c.mu.Lock()
+	provider, exists := c.providers[name]
+	if !exists {
+		c.mu.Unlock()
+		return false
+	}
+	if time.Since(provider.status.LastCheck) <= c.providerTTL || provider.checking {
+		healthy := provider.status.Healthy && provider.status.ConsecutiveError < c.maxConsecutiveErrors
+		c.mu.Unlock()
+		return healthy
+	}
+	provider.checking = true
+	c.mu.Unlock()
+
+	// The result is shared, so a caller giving up mustn't cache a failure
+	status := c.checkProvider(context.WithoutCancel(ctx), name, provider)
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return status.Healthy && status.ConsecutiveError < c.maxConsecutiveErrors
+}
+
+// GetProviderStatus returns the cached health of every provider
+func (c *Checker) GetProviderStatus() map[string]ProviderStatus {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	status := make(map[string]ProviderStatus, len(c.providers))
+	for name, provider := range c.providers {
+		status[name] = provider.status
+	}
+	return status
+}
+
+func (c *Checker) checkAllProviders(ctx context.Context) {
+	c.mu.RLock()
+	providers := make(map[string]*providerTarget, len(c.providers))
+	for name, provider := range c.providers {
+		providers[name] = provider
+	}
+	c.mu.RUnlock()
+
+	var wg sync.WaitGroup
+	for name, provider := range providers {
+		wg.Add(1)
+		go func(name string, provider *providerTarget) {
+			defer wg.Done()
+			status := c.checkProvider(ctx, name, provider)
+			if provider.probe != nil {
+				c.probeProvider(ctx, name, provider, status.Healthy)
+			}
+		}(name, provider)
+	}
+	wg.Wait()
+}
+
+func (c *Checker) checkProvider(ctx context.Context, name string, provider *providerTarget) ProviderStatus {
+	checkCtx, cancel := context.WithTimeout(ctx, c.httpClient.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := provider.check(checkCtx)
+	responseTime := float64(time.Since(start).Nanoseconds()) / 1e6
+	if err != nil {
+		logrus.Debugf("Provider %s health check failed: %v", name, err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	provider.status.Healthy = err == nil
+	provider.status.LastCheck = time.Now()
+	provider.status.ResponseTime = responseTime
+	provider.status.Error = ""
+	if err != nil {
+		provider.status.Error = err.Error()
+	}
+	provider.checking = false
+	return provider.status
+}
+
+// probeProvider runs the provider's synthetic request and folds the result
+// into its latency and error rate. Unhealthy providers aren't sent a probe
+// but count a failed one, so availability reflects the outage.
+func (c *Checker) probeProvider(ctx context.Context, name string, provider *providerTarget, healthy bool) {
+	sample := probeSample{}
+	if healthy {
+		probeCtx, cancel := context.WithTimeout(ctx, c.httpClient.Timeout)
+		start := time.Now()
+		err := provider.probe(probeCtx)
+		cancel()
+		sample = probeSample{latencyMs: float64(time.Since(start).Nanoseconds()) / 1e6, ok: err == nil}
+		if err != nil {
+			logrus.Warnf("Provider %s probe failed: %v", name, err)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	provider.samples = append(provider.samples, sample)
+	if len(provider.samples) > probeWindow {
+		provider.samples = provider.samples[1:]
+	}
+
+	var latencies []float64
+	failures := 0
+	for _, s := range provider.samples {
+		if s.ok {
+			latencies = append(latencies, s.latencyMs)
+		} else {
+			failures++
+		}
+	}
+	if sample.ok {
+		provider.status.ConsecutiveError = 0
+	} else {
+		provider.status.ConsecutiveError++
+	}
+	provider.status.ProbeSamples = len(provider.samples)
+	provider.status.ProbeErrorRate = float64(failures) / float64(len(provider.samples))
+	provider.status.LatencyP95 = 0
+	if len(latencies) > 0 {
+		sort.Float64s(latencies)
+		provider.status.LatencyP95 = latencies[(len(latencies)*95-1)/100]
+	}
+}
+
+// AddCluster adds a cluster to be monitored. Re-adding one at the same
+// endpoint, e.g. with rotated credentials, keeps its health.
+func (c *Checker) AddCluster(name, endpoint string, opts ClusterOptions) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.clusters[name] = &ClusterMetrics{
-		Healthy:   false,
-		Endpoint:  endpoint,
-		LastCheck: time.Now(),
+	if opts.Profile.Name == "" {
+		opts.Profile, _ = engine.Lookup(engine.Default)
+	}
+
+	if existing, ok := c.clusters[name]; ok && existing.metrics.Endpoint == endpoint {
+		existing.metrics.Engine = opts.Profile.Name
+		existing.options = opts
+		return
+	}
+	c.clusters[name] = &clusterTarget{
+		metrics: &ClusterMetrics{
+			Healthy:   false,
+			Endpoint:  endpoint,
+			Engine:    opts.Profile.Name,
+			LastCheck: time.Now(),
+		},
+		options: opts,
 	}
 }
 
-// Start begins the health checking loop
-func (c *Checker) Start(ctx context.Context) {
+// Start begins the health checking loop, calling beat after every round
+func (c *Checker) Start(ctx context.Context, beat func()) {
 	ticker := time.NewTicker(c.checkInterval)
 	defer ticker.Stop()
 
 	// Initial check
 	c.checkAllClusters()
+	c.checkAllProviders(ctx)
+	beat()
 
 	for {
 		select {
@@ -70,19 +348,26 @@ func (c *Checker) Start(ctx context.Context) {
 			return
 		case <-ticker.C:
 			c.checkAllClusters()
+			c.checkAllProviders(ctx)
+			beat()
 		}
 	}
 }
 
+// Interval returns the configured health check interval
+func (c *Checker) Interval() time.Duration {
+	return c.checkInterval
+}
+
 // GetHealthyMetrics returns metrics for only healthy clusters
 func (c *Checker) GetHealthyMetrics() map[string]ClusterMetrics {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
 	healthy := make(map[string]ClusterMetrics)
-	for name, metrics := range c.clusters {
-		if metrics.Healthy {
-			healthy[name] = *metrics
+	for name, cluster := range c.clusters {
+		if cluster.metrics.Healthy && !cluster.metrics.Cordoned {
+			healthy[name] = *cluster.metrics
 		}
 	}
 
@@ -95,8 +380,8 @@ func (c *Checker) GetAllMetrics() map[string]ClusterMetrics {
 	defer c.mu.RUnlock()
 
 	all := make(map[string]ClusterMetrics)
-	for name, metrics := range c.clusters {
-		all[name] = *metrics
+	for name, cluster := range c.clusters {
+		all[name] = *cluster.metrics
 	}
 
 	return all
@@ -107,12 +392,12 @@ func (c *Checker) GetClusterMetrics(name string) (ClusterMetrics, bool) {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	metrics, exists := c.clusters[name]
+	cluster, exists := c.clusters[name]
 	if !exists {
 		return ClusterMetrics{}, false
 	}
 
-	return *metrics, true
+	return *cluster.metrics, true
 }
 
 func (c *Checker) checkAllClusters() {
@@ -142,44 +427,96 @@ func (c *Checker) checkCluster(name string) {
 		c.mu.RUnlock()
 		return
 	}
-	endpoint := cluster.Endpoint
+	endpoint := cluster.metrics.Endpoint
+	opts := cluster.options
 	c.mu.RUnlock()
 
 	start := time.Now()
-	healthy, queueDepth, tokensPerSec, latencyP95 := c.performHealthCheck(endpoint)
+	healthy, queueDepth, tokensPerSec, latencyP95 := c.performHealthCheck(endpoint, opts)
 	responseTime := float64(time.Since(start).Nanoseconds()) / 1e6 // Convert to milliseconds
 
+	var models []string
+	if healthy {
+		models = c.getModels(endpoint, opts)
+	}
+
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	cluster = c.clusters[name] // Re-get after acquiring write lock
-	cluster.LastCheck = time.Now()
-	cluster.ResponseTime = responseTime
-	cluster.LatencyP95 = latencyP95
-	cluster.QueueDepth = queueDepth
-	cluster.TokensPerSecond = tokensPerSec
+	cluster, exists = c.clusters[name] // Re-get after acquiring write lock
+	if !exists {
+		return
+	}
+	metrics := cluster.metrics
+	metrics.LastCheck = time.Now()
+	metrics.ResponseTime = responseTime
+	metrics.LatencyP95 = latencyP95
+	metrics.QueueDepth = queueDepth
+	metrics.TokensPerSecond = tokensPerSec
+	if models != nil {
+		metrics.Models = models
+	}
+
+	firstCheck := !cluster.checked
+	cluster.checked = true
 
 	if healthy {
-		cluster.Healthy = true
-		cluster.ConsecutiveError = 0
+		metrics.ConsecutiveError = 0
+		metrics.ConsecutiveOK++
+		if !metrics.Healthy && (firstCheck || metrics.ConsecutiveOK >= c.recoveryThreshold) {
+			metrics.Healthy = true
+			if !firstCheck {
+				logrus.Infof("Cluster %s recovered after %d consecutive successful checks", name, metrics.ConsecutiveOK)
+			}
+		}
 		logrus.Debugf("Cluster %s is healthy (response: %.2fms, tps: %.2f, queue: %d)",
 			name, responseTime, tokensPerSec, queueDepth)
 	} else {
-		cluster.ErrorCount++
-		cluster.ConsecutiveError++
+		metrics.ErrorCount++
+		metrics.ConsecutiveError++
+		metrics.ConsecutiveOK = 0
 
-		if cluster.ConsecutiveError >= c.maxConsecutiveErrors {
-			cluster.Healthy = false
+		if metrics.ConsecutiveError >= c.maxConsecutiveErrors {
+			metrics.Healthy = false
 			logrus.Warnf("Cluster %s marked unhealthy after %d consecutive errors",
-				name, cluster.ConsecutiveError)
+				name, metrics.ConsecutiveError)
 		}
 	}
 }
 
-func (c *Checker) performHealthCheck(endpoint string) (healthy bool, queueDepth int, tokensPerSec, latencyP95 float64) {
+// newRequest builds a GET against the cluster, presenting its API key if configured
+func (c *Checker) newRequest(url string, opts ClusterOptions) (*http.Request, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if header, value, ok := opts.Profile.AuthHeaderValue(opts.APIKey); ok {
+		req.Header.Set(header, value)
+	}
+	return req, nil
+}
+
+// get issues a GET against the cluster
+func (c *Checker) get(url string, opts ClusterOptions) (*http.Response, error) {
+	req, err := c.newRequest(url, opts)
+	if err != nil {
+		return nil, err
+	}
+	return c.client(opts).Do(req)
+}
+
+// client returns an HTTP client honouring the cluster's health timeout
+func (c *Checker) client(opts ClusterOptions) *http.Client {
+	if opts.Timeout <= 0 {
+		return c.httpClient
+	}
+	return &http.Client{Timeout: opts.Timeout}
+}
+
+func (c *Checker) performHealthCheck(endpoint string, opts ClusterOptions) (healthy bool, queueDepth int, tokensPerSec, latencyP95 float64) {
 	// Check basic health endpoint
-	healthURL := endpoint + "/health"
-	resp, err := c.httpClient.Get(healthURL)
+	healthURL := endpoint + opts.Profile.HealthPath
+	resp, err := c.get(healthURL, opts)
 	if err != nil {
 		logrus.Debugf("Health check failed for %s: %v", endpoint, err)
 		return false, 0, 0, 0
@@ -192,33 +529,72 @@ func (c *Checker) performHealthCheck(endpoint string) (healthy bool, queueDepth
 	}
 
 	// Try to get metrics if available
-	queueDepth, tokensPerSec, latencyP95 = c.getMetrics(endpoint)
+	queueDepth, tokensPerSec, latencyP95 = c.getMetrics(endpoint, opts)
 
 	return true, queueDepth, tokensPerSec, latencyP95
 }
 
-func (c *Checker) getMetrics(endpoint string) (queueDepth int, tokensPerSec, latencyP95 float64) {
+// getModels fetches the cluster's model inventory, returning nil if it can't be listed
+func (c *Checker) getModels(endpoint string, opts ClusterOptions) []string {
+	if opts.Profile.ModelsPath == "" {
+		return nil
+	}
+
+	req, err := c.newRequest(endpoint+opts.Profile.ModelsPath, opts)
+	if err != nil {
+		return nil
+	}
+	resp, err := c.catalogCache.Get(c.client(opts), req)
+	if err != nil {
+		return nil
+	}
+
+	models, err := engine.ParseModels(opts.Profile.ModelsFormat, bytes.NewReader(resp.Body))
+	if err != nil {
+		logrus.Debugf("Failed to parse model list from %s: %v", endpoint, err)
+		return nil
+	}
+	if models == nil {
+		models = []string{}
+	}
+	return models
+}
+
+func (c *Checker) getMetrics(endpoint string, opts ClusterOptions) (queueDepth int, tokensPerSec, latencyP95 float64) {
 	// Default values
 	queueDepth = 0
 	tokensPerSec = 10.0 // Conservative default
 	latencyP95 = 1000.0 // Default 1 second
 
-	// Try to get actual metrics from the endpoint
-	metricsURL := endpoint + "/metrics"
-	resp, err := c.httpClient.Get(metricsURL)
-	if err != nil {
-		return // Use defaults
+	switch opts.Profile.MetricsFormat {
+	case engine.MetricsVLLM:
+		return c.scrapeVLLM(endpoint, opts, queueDepth, tokensPerSec, latencyP95)
+	case engine.MetricsLocalAI:
+		return c.scrapeLocalAI(endpoint, opts, queueDepth, tokensPerSec, latencyP95)
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return // Use defaults
+	// Gateways without a stats endpoint keep the defaults
+	if opts.Profile.StatsPath == "" {
+		return
+	}
+
+	// Try to get actual metrics from the endpoint
+	if opts.Profile.MetricsPath != "" {
+		resp, err := c.get(endpoint+opts.Profile.MetricsPath, opts)
+		if err != nil {
+			return // Use defaults
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return // Use defaults
+		}
 	}
 
 	// Try to parse metrics (this would be prometheus format typically)
 	// For now, we'll try a simple JSON endpoint if available
-	statsURL := endpoint + "/stats"
-	statsResp, err := c.httpClient.Get(statsURL)
+	statsURL := endpoint + opts.Profile.StatsPath
+	statsResp, err := c.get(statsURL, opts)
 	if err != nil {
 		return // Use defaults
 	}
@@ -247,15 +623,79 @@ func (c *Checker) getMetrics(endpoint string) (queueDepth int, tokensPerSec, lat
 	return queueDepth, tokensPerSec, latencyP95
 }
 
+// scrapeVLLM reads queue depth, throughput and time-to-first-token from vLLM's
+// Prometheus endpoint, falling back to the supplied defaults on failure
+func (c *Checker) scrapeVLLM(endpoint string, opts ClusterOptions, queueDepth int, tokensPerSec, latencyP95 float64) (int, float64, float64) {
+	resp, err := c.get(endpoint+opts.Profile.MetricsPath, opts)
+	if err != nil {
+		return queueDepth, tokensPerSec, latencyP95
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return queueDepth, tokensPerSec, latencyP95
+	}
+
+	c.scrapeMu.Lock()
+	defer c.scrapeMu.Unlock()
+
+	sample, waiting, err := parseVLLMMetrics(resp.Body, c.vllmSamples[endpoint], time.Now())
+	if err != nil {
+		logrus.Debugf("Failed to scrape vLLM metrics from %s: %v", endpoint, err)
+		return queueDepth, tokensPerSec, latencyP95
+	}
+	c.vllmSamples[endpoint] = sample
+
+	queueDepth = waiting
+	if sample.tokensPerSec > 0 {
+		tokensPerSec = sample.tokensPerSec
+	}
+	if sample.latencyP95 > 0 {
+		latencyP95 = sample.latencyP95
+	}
+
+	return queueDepth, tokensPerSec, latencyP95
+}
+
+// scrapeLocalAI reads p95 completion latency from LocalAI's Prometheus
+// endpoint, keeping the supplied defaults for what it doesn't report
+func (c *Checker) scrapeLocalAI(endpoint string, opts ClusterOptions, queueDepth int, tokensPerSec, latencyP95 float64) (int, float64, float64) {
+	resp, err := c.get(endpoint+opts.Profile.MetricsPath, opts)
+	if err != nil {
+		return queueDepth, tokensPerSec, latencyP95
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return queueDepth, tokensPerSec, latencyP95
+	}
+
+	c.scrapeMu.Lock()
+	defer c.scrapeMu.Unlock()
+
+	sample, err := parseLocalAIMetrics(resp.Body, c.vllmSamples[endpoint], time.Now())
+	if err != nil {
+		logrus.Debugf("Failed to scrape LocalAI metrics from %s: %v", endpoint, err)
+		return queueDepth, tokensPerSec, latencyP95
+	}
+	c.vllmSamples[endpoint] = sample
+
+	if sample.latencyP95 > 0 {
+		latencyP95 = sample.latencyP95
+	}
+	return queueDepth, tokensPerSec, latencyP95
+}
+
 // MarkUnhealthy manually marks a cluster as unhealthy
 func (c *Checker) MarkUnhealthy(name string, reason string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
 	if cluster, exists := c.clusters[name]; exists {
-		cluster.Healthy = false
-		cluster.ErrorCount++
-		cluster.ConsecutiveError++
+		cluster.metrics.Healthy = false
+		cluster.metrics.ErrorCount++
+		cluster.metrics.ConsecutiveError++
+		cluster.metrics.ConsecutiveOK = 0
 		logrus.Warnf("Cluster %s manually marked unhealthy: %s", name, reason)
 	}
 }
@@ -266,8 +706,57 @@ func (c *Checker) ForceHealthy(name string) {
 	defer c.mu.Unlock()
 
 	if cluster, exists := c.clusters[name]; exists {
-		cluster.Healthy = true
-		cluster.ConsecutiveError = 0
+		cluster.metrics.Healthy = true
+		cluster.metrics.ConsecutiveError = 0
 		logrus.Infof("Cluster %s manually marked healthy", name)
 	}
 }
+
+// Cordon takes a cluster out of rotation until Uncordon. Unlike
+// MarkUnhealthy it outlasts health checks, which carry on so the
+// cluster's health is known when it returns.
+func (c *Checker) Cordon(name string, reason string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cluster, exists := c.clusters[name]
+	if !exists {
+		return false
+	}
+	cluster.metrics.Cordoned = true
+	cluster.metrics.CordonReason = reason
+	return true
+}
+
+// Uncordon returns a cordoned cluster to rotation if it is healthy
+func (c *Checker) Uncordon(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cluster, exists := c.clusters[name]
+	if !exists {
+		return false
+	}
+	cluster.metrics.Cordoned = false
+	cluster.metrics.CordonReason = ""
+	return true
+}
+
+// RemoveCluster stops checking a cluster and routing to it
+func (c *Checker) RemoveCluster(name string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exists := c.clusters[name]; !exists {
+		return false
+	}
+	delete(c.clusters, name)
+	return true
+}
+
+// CheckNow synchronously checks every cluster and provider, bypassing the
+// ticker
+func (c *Checker) CheckNow(ctx context.Context) {
+	c.checkAllClusters()
+	c.checkAllProviders(ctx)
+}
@@ -0,0 +1,64 @@
+package health
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// localAIAPICalls is LocalAI's histogram of API call durations in seconds,
+// labelled with the request path
+const localAIAPICalls = "api_call"
+
+// parseLocalAIMetrics derives p95 latency of completion requests from
+// LocalAI's Prometheus exposition. LocalAI reports no queue depth or token
+// counts, so throughput is left to the caller's default. The sample is kept
+// in vLLM's shape so quantiles are taken over the check interval alike.
+func parseLocalAIMetrics(body io.Reader, prev *vllmSample, now time.Time) (*vllmSample, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse LocalAI metrics: %w", err)
+	}
+
+	sample := &vllmSample{
+		at:          now,
+		ttftBuckets: make(map[float64]float64),
+	}
+	if family, ok := families[localAIAPICalls]; ok {
+		for _, m := range family.GetMetric() {
+			if !completionPath(m.GetLabel()) {
+				continue
+			}
+			h := m.GetHistogram()
+			sample.ttftCount += float64(h.GetSampleCount())
+			for _, b := range h.GetBucket() {
+				sample.ttftBuckets[b.GetUpperBound()] += float64(b.GetCumulativeCount())
+			}
+		}
+	}
+
+	// An idle server keeps its last latency
+	if prev != nil {
+		sample.latencyP95 = prev.latencyP95
+	}
+	if p95, ok := histogramQuantile(0.95, sample, prev); ok {
+		sample.latencyP95 = p95 * 1000 // seconds to milliseconds
+	}
+	return sample, nil
+}
+
+// completionPath reports whether a series is for chat or legacy completions,
+// whose latency is what routing weighs
+func completionPath(labels []*dto.LabelPair) bool {
+	for _, label := range labels {
+		if label.GetName() == "path" {
+			return strings.HasSuffix(label.GetValue(), "/completions")
+		}
+	}
+	return false
+}
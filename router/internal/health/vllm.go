@@ -0,0 +1,133 @@
+package health
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/prometheus/common/expfmt"
+)
+
+// vLLM metric names
+const (
+	vllmRequestsWaiting  = "vllm:num_requests_waiting"
+	vllmTimeToFirstToken = "vllm:time_to_first_token_seconds"
+	vllmGenerationTokens = "vllm:generation_tokens_total"
+)
+
+// vllmSample is the previous scrape of a vLLM server, used to turn cumulative
+// counters and histograms into rates over the last check interval
+type vllmSample struct {
+	at               time.Time
+	generationTokens float64
+	ttftBuckets      map[float64]float64 // upper bound -> cumulative count
+	ttftCount        float64
+	tokensPerSec     float64
+	latencyP95       float64
+}
+
+// parseVLLMMetrics derives queue depth, throughput and p95 time-to-first-token
+// from vLLM's Prometheus exposition. Series for multiple models are summed.
+func parseVLLMMetrics(body io.Reader, prev *vllmSample, now time.Time) (*vllmSample, int, error) {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to parse vLLM metrics: %w", err)
+	}
+
+	sample := &vllmSample{
+		at:          now,
+		ttftBuckets: make(map[float64]float64),
+	}
+
+	queueDepth := 0
+	if family, ok := families[vllmRequestsWaiting]; ok {
+		for _, m := range family.GetMetric() {
+			queueDepth += int(m.GetGauge().GetValue())
+		}
+	}
+
+	if family, ok := families[vllmGenerationTokens]; ok {
+		for _, m := range family.GetMetric() {
+			sample.generationTokens += m.GetCounter().GetValue()
+		}
+	}
+
+	if family, ok := families[vllmTimeToFirstToken]; ok {
+		for _, m := range family.GetMetric() {
+			h := m.GetHistogram()
+			sample.ttftCount += float64(h.GetSampleCount())
+			for _, b := range h.GetBucket() {
+				sample.ttftBuckets[b.GetUpperBound()] += float64(b.GetCumulativeCount())
+			}
+		}
+	}
+
+	// Carry forward last known values so an idle server keeps a sensible
+	// throughput and latency instead of looking infinitely expensive
+	if prev != nil {
+		sample.tokensPerSec = prev.tokensPerSec
+		sample.latencyP95 = prev.latencyP95
+
+		elapsed := now.Sub(prev.at).Seconds()
+		if generated := sample.generationTokens - prev.generationTokens; elapsed > 0 && generated > 0 {
+			sample.tokensPerSec = generated / elapsed
+		}
+	}
+
+	if p95, ok := histogramQuantile(0.95, sample, prev); ok {
+		sample.latencyP95 = p95 * 1000 // seconds to milliseconds
+	}
+
+	return sample, queueDepth, nil
+}
+
+// histogramQuantile estimates a quantile from the TTFT buckets observed since
+// the previous scrape (or since server start on the first scrape)
+func histogramQuantile(q float64, cur, prev *vllmSample) (float64, bool) {
+	total := cur.ttftCount
+	buckets := make(map[float64]float64, len(cur.ttftBuckets))
+	for bound, count := range cur.ttftBuckets {
+		buckets[bound] = count
+	}
+
+	// A counter reset (server restart) makes deltas negative; use cumulative data then
+	if prev != nil && prev.ttftCount <= cur.ttftCount {
+		total -= prev.ttftCount
+		for bound := range buckets {
+			buckets[bound] -= prev.ttftBuckets[bound]
+		}
+	}
+
+	if total <= 0 || len(buckets) == 0 {
+		return 0, false
+	}
+
+	bounds := make([]float64, 0, len(buckets))
+	for bound := range buckets {
+		bounds = append(bounds, bound)
+	}
+	sort.Float64s(bounds)
+
+	rank := q * total
+	lowerBound, lowerCount := 0.0, 0.0
+	for _, bound := range bounds {
+		count := buckets[bound]
+		if count >= rank {
+			if math.IsInf(bound, 1) {
+				// Quantile falls in the overflow bucket, report the largest finite bound
+				return lowerBound, true
+			}
+			if count == lowerCount {
+				return bound, true
+			}
+			// Linear interpolation within the bucket, as PromQL does
+			return lowerBound + (bound-lowerBound)*(rank-lowerCount)/(count-lowerCount), true
+		}
+		lowerBound, lowerCount = bound, count
+	}
+
+	return lowerBound, true
+}
@@ -0,0 +1,321 @@
+// Package history keeps a per-target time series of routed requests,
+// latency, errors, cost and health transitions for dashboards
+package history
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Config controls how finely and how long history is kept
+type Config struct {
+	Bucket    time.Duration `yaml:"bucket"`    // resolution of the series, default 5m
+	Retention time.Duration `yaml:"retention"` // default 7d
+}
+
+// latencyBounds are the upper bounds, in ms, of the latency histogram
+// each bucket keeps; percentiles are interpolated within them
+var latencyBounds = []float64{10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000, 60000, 120000}
+
+// Bucket is one interval of a target's series
+type Bucket struct {
+	Start    time.Time `json:"start"`
+	Requests int       `json:"requests"`
+	Errors   int       `json:"errors"`
+	Cost     float64   `json:"cost_usd"`
+	Latency  []int     `json:"latency"` // counts per latencyBounds entry, then one over the last
+}
+
+// Transition is a change in a target's health or circuit breaker state
+type Transition struct {
+	At    time.Time `json:"at"`
+	Kind  string    `json:"kind"`  // "health" or "circuit"
+	State string    `json:"state"` // healthy/unhealthy, or closed/open/half_open
+}
+
+// Point is an aggregated interval of a History
+type Point struct {
+	Start     time.Time `json:"start"`
+	Requests  int       `json:"requests"`
+	Errors    int       `json:"errors"`
+	ErrorRate float64   `json:"error_rate"`
+	Cost      float64   `json:"cost_usd"`
+	P50       float64   `json:"latency_p50_ms"`
+	P90       float64   `json:"latency_p90_ms"`
+	P99       float64   `json:"latency_p99_ms"`
+}
+
+// History is a target's series over a window
+type History struct {
+	Target      string       `json:"target"`
+	From        time.Time    `json:"from"`
+	To          time.Time    `json:"to"`
+	Step        string       `json:"step"`
+	Points      []Point      `json:"points"`
+	Transitions []Transition `json:"transitions"`
+	Totals      Point        `json:"totals"`
+}
+
+// State is the store as persisted across restarts
+type State struct {
+	Buckets     map[string][]*Bucket    `json:"buckets"`
+	Transitions map[string][]Transition `json:"transitions"`
+}
+
+// Store records target history in memory
+type Store struct {
+	config Config
+	now    func() time.Time
+
+	mu          sync.Mutex
+	buckets     map[string][]*Bucket // per target, oldest first
+	transitions map[string][]Transition
+	health      map[string]bool // last health seen per target
+}
+
+// New creates a store, applying defaults
+func New(config Config) *Store {
+	if config.Bucket <= 0 {
+		config.Bucket = 5 * time.Minute
+	}
+	if config.Retention <= 0 {
+		config.Retention = 7 * 24 * time.Hour
+	}
+	return &Store{
+		config:      config,
+		now:         time.Now,
+		buckets:     make(map[string][]*Bucket),
+		transitions: make(map[string][]Transition),
+		health:      make(map[string]bool),
+	}
+}
+
+// Retention returns how far back history is kept
+func (s *Store) Retention() time.Duration {
+	return s.config.Retention
+}
+
+// Record adds a routed request to target's current bucket
+func (s *Store) Record(target string, ok bool, latency time.Duration, cost float64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	start := now.Truncate(s.config.Bucket)
+	series := s.buckets[target]
+	if len(series) == 0 || !series[len(series)-1].Start.Equal(start) {
+		series = append(s.prune(series, now), &Bucket{Start: start, Latency: make([]int, len(latencyBounds)+1)})
+		s.buckets[target] = series
+	}
+	b := series[len(series)-1]
+	b.Requests++
+	if !ok {
+		b.Errors++
+	}
+	b.Cost += cost
+	ms := float64(latency) / float64(time.Millisecond)
+	b.Latency[sort.SearchFloat64s(latencyBounds, ms)]++
+}
+
+// Health notes target's current health, recording a transition when it
+// differs from the last one seen
+func (s *Store) Health(target string, healthy bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if last, seen := s.health[target]; seen && last == healthy {
+		return
+	}
+	s.health[target] = healthy
+	state := "unhealthy"
+	if healthy {
+		state = "healthy"
+	}
+	s.transition(target, "health", state)
+}
+
+// Circuit records a circuit breaker state change for target
+func (s *Store) Circuit(target, state string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.transition(target, "circuit", state)
+}
+
+// transition appends an event (lock must be held)
+func (s *Store) transition(target, kind, state string) {
+	now := s.now()
+	events := s.transitions[target]
+	cutoff := now.Add(-s.config.Retention)
+	for len(events) > 0 && events[0].At.Before(cutoff) {
+		events = events[1:]
+	}
+	s.transitions[target] = append(events, Transition{At: now, Kind: kind, State: state})
+}
+
+// prune drops buckets older than the retention
+func (s *Store) prune(series []*Bucket, now time.Time) []*Bucket {
+	cutoff := now.Add(-s.config.Retention)
+	for len(series) > 0 && series[0].Start.Before(cutoff) {
+		series = series[1:]
+	}
+	return series
+}
+
+// Query returns target's history over the last window, aggregated into
+// steps of at least one bucket. Intervals without requests are included.
+func (s *Store) Query(target string, window, step time.Duration) History {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if window <= 0 || window > s.config.Retention {
+		window = s.config.Retention
+	}
+	if step < s.config.Bucket {
+		step = s.config.Bucket
+	}
+	step = step.Truncate(s.config.Bucket)
+
+	now := s.now()
+	from := now.Add(-window).Truncate(step)
+	history := History{
+		Target:      target,
+		From:        from,
+		To:          now,
+		Step:        step.String(),
+		Points:      []Point{},
+		Transitions: []Transition{},
+	}
+
+	totals := &Bucket{Latency: make([]int, len(latencyBounds)+1)}
+	var steps []*Bucket
+	for start := from; !start.After(now); start = start.Add(step) {
+		steps = append(steps, &Bucket{Start: start, Latency: make([]int, len(latencyBounds)+1)})
+	}
+	for _, b := range s.buckets[target] {
+		if b.Start.Before(from) {
+			continue
+		}
+		i := int(b.Start.Sub(from) / step)
+		if i >= len(steps) {
+			continue
+		}
+		merge(steps[i], b)
+		merge(totals, b)
+	}
+	for _, b := range steps {
+		history.Points = append(history.Points, point(b))
+	}
+	history.Totals = point(totals)
+	history.Totals.Start = from
+
+	for _, t := range s.transitions[target] {
+		if !t.At.Before(from) {
+			history.Transitions = append(history.Transitions, t)
+		}
+	}
+	return history
+}
+
+func merge(into, b *Bucket) {
+	into.Requests += b.Requests
+	into.Errors += b.Errors
+	into.Cost += b.Cost
+	for i, n := range b.Latency {
+		if i < len(into.Latency) {
+			into.Latency[i] += n
+		}
+	}
+}
+
+func point(b *Bucket) Point {
+	p := Point{Start: b.Start, Requests: b.Requests, Errors: b.Errors, Cost: b.Cost}
+	if b.Requests > 0 {
+		p.ErrorRate = float64(b.Errors) / float64(b.Requests)
+		p.P50 = percentile(b.Latency, 0.50)
+		p.P90 = percentile(b.Latency, 0.90)
+		p.P99 = percentile(b.Latency, 0.99)
+	}
+	return p
+}
+
+// percentile interpolates the q quantile from histogram counts. Latencies
+// past the last bound are reported as that bound.
+func percentile(counts []int, q float64) float64 {
+	total := 0
+	for _, n := range counts {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+	rank := q * float64(total)
+	seen := 0.0
+	for i, n := range counts {
+		if n == 0 {
+			continue
+		}
+		if seen+float64(n) >= rank {
+			if i >= len(latencyBounds) {
+				return latencyBounds[len(latencyBounds)-1]
+			}
+			lower := 0.0
+			if i > 0 {
+				lower = latencyBounds[i-1]
+			}
+			return lower + (latencyBounds[i]-lower)*(rank-seen)/float64(n)
+		}
+		seen += float64(n)
+	}
+	return latencyBounds[len(latencyBounds)-1]
+}
+
+// State returns the store so it can outlive the process
+func (s *Store) State() State {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := State{Buckets: make(map[string][]*Bucket), Transitions: make(map[string][]Transition)}
+	now := s.now()
+	for target, series := range s.buckets {
+		s.buckets[target] = s.prune(series, now)
+		for _, b := range s.buckets[target] {
+			copied := *b
+			copied.Latency = append([]int(nil), b.Latency...)
+			state.Buckets[target] = append(state.Buckets[target], &copied)
+		}
+	}
+	for target, events := range s.transitions {
+		state.Transitions[target] = append([]Transition(nil), events...)
+	}
+	return state
+}
+
+// Restore reloads history saved by State
+func (s *Store) Restore(state State) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for target, series := range state.Buckets {
+		for _, b := range series {
+			if len(b.Latency) != len(latencyBounds)+1 {
+				b.Latency = make([]int, len(latencyBounds)+1)
+			}
+		}
+		s.buckets[target] = s.prune(series, now)
+	}
+	for target, events := range state.Transitions {
+		s.transitions[target] = events
+		if len(events) == 0 {
+			continue
+		}
+		// Carry the last health over so a restart isn't a transition
+		for i := len(events) - 1; i >= 0; i-- {
+			if events[i].Kind == "health" {
+				s.health[target] = events[i].State == "healthy"
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,219 @@
+package httpcache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Response is a catalog document served from the network or the cache
+type Response struct {
+	Body   []byte
+	Cached bool // served from the cache, fresh or revalidated
+	Stale  bool // upstream was unreachable and a stored copy was used
+}
+
+type entry struct {
+	URL          string    `json:"url"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Expires      time.Time `json:"expires"`
+	Body         []byte    `json:"body"`
+}
+
+// Cache stores GET responses for slow-changing catalogs such as model lists,
+// revalidating with ETag/If-Modified-Since and honoring Cache-Control and
+// Expires. Entries are mirrored to disk when a directory is configured so a
+// restart without upstream connectivity keeps the last known catalog.
+// A nil *Cache fetches without caching.
+type Cache struct {
+	mu      sync.Mutex
+	dir     string
+	entries map[string]*entry
+}
+
+// New creates a cache persisting to dir; an empty dir keeps entries in memory only
+func New(dir string) *Cache {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			logrus.Warnf("Catalog cache disabled on disk: %v", err)
+			dir = ""
+		}
+	}
+	return &Cache{dir: dir, entries: make(map[string]*entry)}
+}
+
+// Get performs req through the cache. Upstream failures fall back to a
+// stored copy, flagged Stale, when one exists.
+func (c *Cache) Get(client *http.Client, req *http.Request) (*Response, error) {
+	if c == nil {
+		return fetch(client, req)
+	}
+
+	key := req.URL.String()
+	cached := c.lookup(key)
+	if cached != nil && time.Now().Before(cached.Expires) {
+		return &Response{Body: cached.Body, Cached: true}, nil
+	}
+
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return c.stale(cached, err)
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && cached != nil:
+		revalidated := *cached
+		revalidated.Expires = expiry(resp.Header)
+		c.store(key, &revalidated)
+		return &Response{Body: cached.Body, Cached: true}, nil
+
+	case resp.StatusCode == http.StatusOK:
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return c.stale(cached, err)
+		}
+		if !noStore(resp.Header) {
+			c.store(key, &entry{
+				URL:          key,
+				ETag:         resp.Header.Get("ETag"),
+				LastModified: resp.Header.Get("Last-Modified"),
+				Expires:      expiry(resp.Header),
+				Body:         body,
+			})
+		}
+		return &Response{Body: body}, nil
+
+	case resp.StatusCode >= 500:
+		return c.stale(cached, fmt.Errorf("status %d", resp.StatusCode))
+
+	default:
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+}
+
+func fetch(client *http.Client, req *http.Request) (*Response, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Response{Body: body}, nil
+}
+
+func (c *Cache) stale(cached *entry, err error) (*Response, error) {
+	if cached == nil {
+		return nil, err
+	}
+	logrus.Debugf("Serving stale catalog for %s: %v", cached.URL, err)
+	return &Response{Body: cached.Body, Cached: true, Stale: true}, nil
+}
+
+func (c *Cache) lookup(key string) *entry {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if cached, exists := c.entries[key]; exists {
+		return cached
+	}
+	if c.dir == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil
+	}
+	var loaded entry
+	if err := json.Unmarshal(data, &loaded); err != nil || loaded.URL != key {
+		return nil
+	}
+	c.entries[key] = &loaded
+	return &loaded
+}
+
+func (c *Cache) store(key string, e *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.entries[key] = e
+	if c.dir == "" {
+		return
+	}
+
+	data, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	path := c.path(key)
+	if err := os.WriteFile(path+".tmp", data, 0o600); err == nil {
+		err = os.Rename(path+".tmp", path)
+	}
+	if err != nil {
+		logrus.Warnf("Failed to persist catalog cache for %s: %v", key, err)
+	}
+}
+
+func (c *Cache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(c.dir, hex.EncodeToString(sum[:16])+".json")
+}
+
+// expiry derives freshness from Cache-Control max-age, then Expires.
+// Without either the entry must be revalidated on every use.
+func expiry(header http.Header) time.Time {
+	now := time.Now()
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(strings.ToLower(directive))
+		if directive == "no-cache" {
+			return now
+		}
+		if value, ok := strings.CutPrefix(directive, "max-age="); ok {
+			if seconds, err := strconv.Atoi(value); err == nil {
+				return now.Add(time.Duration(seconds) * time.Second)
+			}
+		}
+	}
+	if expires, err := http.ParseTime(header.Get("Expires")); err == nil {
+		return expires
+	}
+	return now
+}
+
+func noStore(header http.Header) bool {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		if strings.TrimSpace(strings.ToLower(directive)) == "no-store" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,345 @@
+package mirror
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/objstore"
+	"github.com/sirupsen/logrus"
+)
+
+// Config enables mirroring of sampled self-hosted traffic into a dataset.
+// Only the listed clusters are mirrored; external provider traffic never is.
+type Config struct {
+	Enabled        bool            `yaml:"enabled"`
+	Clusters       []string        `yaml:"clusters"`       // clusters whose traffic is mirrored
+	SampleRate     float64         `yaml:"sampleRate"`     // share of requests recorded, default 0.01
+	Storage        objstore.Config `yaml:"storage"`        // where JSONL batches are written
+	BatchSize      int             `yaml:"batchSize"`      // records per object, default 500
+	FlushInterval  time.Duration   `yaml:"flushInterval"`  // partial batches are written this often, default 5m
+	MaxRecordBytes int             `yaml:"maxRecordBytes"` // larger responses are skipped, default 256KiB
+	Redaction      RedactionConfig `yaml:"redaction"`
+}
+
+// Record is one served request as captured from the wire
+type Record struct {
+	Cluster  string
+	Endpoint string
+	Tenant   string
+	Request  []byte
+	Response []byte
+	Stream   bool
+}
+
+// Message is a chat message in the fine-tuning schema
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Metadata describes where an example came from
+type Metadata struct {
+	Cluster   string    `json:"cluster"`
+	Model     string    `json:"model,omitempty"`
+	Tenant    string    `json:"tenant,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Example is one JSONL line: chat examples carry messages, completions
+// carry prompt and completion
+type Example struct {
+	Messages   []Message `json:"messages,omitempty"`
+	Prompt     string    `json:"prompt,omitempty"`
+	Completion string    `json:"completion,omitempty"`
+	Metadata   Metadata  `json:"metadata"`
+}
+
+// Mirror samples, redacts and batches examples per cluster
+type Mirror struct {
+	config   Config
+	store    objstore.Store
+	redact   redactor
+	clusters map[string]bool
+
+	mu      sync.Mutex
+	batches map[string][][]byte
+	seq     int
+}
+
+// New creates a mirror, or returns nil when disabled
+func New(config Config) (*Mirror, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	if len(config.Clusters) == 0 {
+		return nil, fmt.Errorf("mirroring needs at least one cluster")
+	}
+	if config.SampleRate == 0 {
+		config.SampleRate = 0.01
+	}
+	if config.BatchSize == 0 {
+		config.BatchSize = 500
+	}
+	if config.FlushInterval == 0 {
+		config.FlushInterval = 5 * time.Minute
+	}
+	if config.MaxRecordBytes == 0 {
+		config.MaxRecordBytes = 256 << 10
+	}
+
+	store, err := objstore.New(config.Storage)
+	if err != nil {
+		return nil, err
+	}
+	redact, err := newRedactor(config.Redaction)
+	if err != nil {
+		return nil, err
+	}
+	clusters := make(map[string]bool, len(config.Clusters))
+	for _, name := range config.Clusters {
+		clusters[name] = true
+	}
+	return &Mirror{
+		config:   config,
+		store:    store,
+		redact:   redact,
+		clusters: clusters,
+		batches:  make(map[string][][]byte),
+	}, nil
+}
+
+// Sample decides whether a request to cluster is recorded
+func (m *Mirror) Sample(cluster string) bool {
+	return m != nil && m.clusters[cluster] && rand.Float64() < m.config.SampleRate
+}
+
+// MaxRecordBytes bounds how much of a response is captured
+func (m *Mirror) MaxRecordBytes() int {
+	return m.config.MaxRecordBytes
+}
+
+// Interval is how often partial batches are flushed
+func (m *Mirror) Interval() time.Duration {
+	return m.config.FlushInterval
+}
+
+// Add converts a record into a redacted example and queues it, reporting
+// false when the exchange can't be expressed in the dataset schema
+func (m *Mirror) Add(rec Record) bool {
+	example, ok := m.example(rec)
+	if !ok {
+		return false
+	}
+	line, err := json.Marshal(example)
+	if err != nil {
+		return false
+	}
+
+	m.mu.Lock()
+	batch := append(m.batches[rec.Cluster], line)
+	// Drop the oldest examples rather than grow without bound while the
+	// store is failing
+	if limit := 10 * m.config.BatchSize; len(batch) > limit {
+		batch = batch[len(batch)-limit:]
+	}
+	m.batches[rec.Cluster] = batch
+	full := len(batch) >= m.config.BatchSize
+	m.mu.Unlock()
+
+	if full {
+		go func() {
+			if err := m.flushCluster(context.Background(), rec.Cluster); err != nil {
+				logrus.Warnf("Failed to write mirrored examples for %s: %v", rec.Cluster, err)
+			}
+		}()
+	}
+	return true
+}
+
+func (m *Mirror) example(rec Record) (Example, bool) {
+	var request struct {
+		Model    string            `json:"model"`
+		Messages []json.RawMessage `json:"messages"`
+		Prompt   interface{}       `json:"prompt"`
+	}
+	if err := json.Unmarshal(rec.Request, &request); err != nil {
+		return Example{}, false
+	}
+	example := Example{Metadata: Metadata{
+		Cluster:   rec.Cluster,
+		Model:     request.Model,
+		Tenant:    rec.Tenant,
+		Timestamp: time.Now().UTC(),
+	}}
+
+	completion, ok := responseText(rec.Response, rec.Stream)
+	if !ok {
+		return Example{}, false
+	}
+	completion = m.redact.apply(completion)
+
+	switch {
+	case strings.HasSuffix(rec.Endpoint, "/chat/completions"):
+		for _, raw := range request.Messages {
+			var msg struct {
+				Role    string          `json:"role"`
+				Content json.RawMessage `json:"content"`
+			}
+			if json.Unmarshal(raw, &msg) != nil {
+				return Example{}, false
+			}
+			example.Messages = append(example.Messages, Message{Role: msg.Role, Content: m.redact.apply(contentText(msg.Content))})
+		}
+		example.Messages = append(example.Messages, Message{Role: "assistant", Content: completion})
+	case strings.HasSuffix(rec.Endpoint, "/completions"):
+		prompt, ok := request.Prompt.(string)
+		if !ok {
+			return Example{}, false
+		}
+		example.Prompt = m.redact.apply(prompt)
+		example.Completion = completion
+	default:
+		return Example{}, false
+	}
+	return example, true
+}
+
+// contentText flattens string or multi-part message content to its text
+func contentText(raw json.RawMessage) string {
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	json.Unmarshal(raw, &parts)
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// responseText extracts the first choice's text from a JSON response or
+// assembles it from SSE deltas
+func responseText(body []byte, stream bool) (string, bool) {
+	type choice struct {
+		Index   int    `json:"index"`
+		Text    string `json:"text"`
+		Message struct {
+			Content string `json:"content"`
+		} `json:"message"`
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+	}
+	var chunk struct {
+		Choices []choice `json:"choices"`
+	}
+
+	if !stream {
+		if json.Unmarshal(body, &chunk) != nil || len(chunk.Choices) == 0 {
+			return "", false
+		}
+		c := chunk.Choices[0]
+		if c.Message.Content != "" {
+			return c.Message.Content, true
+		}
+		return c.Text, c.Text != ""
+	}
+
+	var text strings.Builder
+	scanner := bufio.NewScanner(bytes.NewReader(body))
+	scanner.Buffer(make([]byte, 0, 4096), len(body)+1)
+	for scanner.Scan() {
+		data, ok := bytes.CutPrefix(scanner.Bytes(), []byte("data:"))
+		if !ok {
+			continue
+		}
+		chunk.Choices = nil
+		if json.Unmarshal(bytes.TrimSpace(data), &chunk) != nil {
+			continue
+		}
+		for _, c := range chunk.Choices {
+			if c.Index == 0 {
+				text.WriteString(c.Delta.Content + c.Text)
+			}
+		}
+	}
+	return text.String(), text.Len() > 0
+}
+
+// Start flushes partial batches every interval until ctx is done; the
+// final flush happens on drain
+func (m *Mirror) Start(ctx context.Context, beat func()) {
+	ticker := time.NewTicker(m.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := m.Flush(ctx); err != nil {
+				logrus.Warnf("Failed to write mirrored examples: %v", err)
+			}
+			beat()
+		}
+	}
+}
+
+// Flush writes every queued example
+func (m *Mirror) Flush(ctx context.Context) error {
+	m.mu.Lock()
+	clusters := make([]string, 0, len(m.batches))
+	for cluster := range m.batches {
+		clusters = append(clusters, cluster)
+	}
+	m.mu.Unlock()
+
+	var firstErr error
+	for _, cluster := range clusters {
+		if err := m.flushCluster(ctx, cluster); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// flushCluster writes one cluster's queue as a JSONL object, requeueing
+// the examples if the write fails
+func (m *Mirror) flushCluster(ctx context.Context, cluster string) error {
+	m.mu.Lock()
+	batch := m.batches[cluster]
+	delete(m.batches, cluster)
+	m.seq++
+	seq := m.seq
+	m.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	now := time.Now().UTC()
+	key := fmt.Sprintf("%s/%s/%s-%04d.jsonl", cluster, now.Format("2006/01/02"), now.Format("20060102T150405Z"), seq)
+	body := append(bytes.Join(batch, []byte("\n")), '\n')
+	if err := m.store.Put(ctx, key, body, "application/x-ndjson"); err != nil {
+		m.mu.Lock()
+		m.batches[cluster] = append(batch, m.batches[cluster]...)
+		m.mu.Unlock()
+		return err
+	}
+	logrus.Debugf("Mirrored %d examples to %s/%s", len(batch), m.store, key)
+	return nil
+}
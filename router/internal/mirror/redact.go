@@ -0,0 +1,64 @@
+package mirror
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// RedactionConfig selects what is scrubbed from mirrored text
+type RedactionConfig struct {
+	Builtins []string `yaml:"builtins"` // email, phone, card, ssn, ip; default all
+	Patterns []string `yaml:"patterns"` // extra regular expressions, replaced with [REDACTED]
+}
+
+var builtinPatterns = map[string]*regexp.Regexp{
+	"email": regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`),
+	"card":  regexp.MustCompile(`\b(?:\d[ -]?){12,18}\d\b`),
+	"ssn":   regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`),
+	"phone": regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?\(?\b\d{3}\)?[ .-]?\d{3}[ .-]?\d{4}\b`),
+	"ip":    regexp.MustCompile(`\b(?:\d{1,3}\.){3}\d{1,3}\b`),
+}
+
+// builtinOrder applies longer digit runs first so a card number isn't
+// half-matched as a phone number
+var builtinOrder = []string{"email", "card", "ssn", "phone", "ip"}
+
+type redaction struct {
+	pattern *regexp.Regexp
+	label   string
+}
+
+type redactor []redaction
+
+func newRedactor(config RedactionConfig) (redactor, error) {
+	enabled := make(map[string]bool)
+	for _, name := range config.Builtins {
+		if _, ok := builtinPatterns[name]; !ok {
+			return nil, fmt.Errorf("unknown redaction %q", name)
+		}
+		enabled[name] = true
+	}
+
+	var r redactor
+	for _, name := range builtinOrder {
+		if len(config.Builtins) == 0 || enabled[name] {
+			r = append(r, redaction{builtinPatterns[name], "[" + strings.ToUpper(name) + "]"})
+		}
+	}
+	for _, expr := range config.Patterns {
+		pattern, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid redaction pattern %q: %w", expr, err)
+		}
+		r = append(r, redaction{pattern, "[REDACTED]"})
+	}
+	return r, nil
+}
+
+func (r redactor) apply(text string) string {
+	for _, rule := range r {
+		text = rule.pattern.ReplaceAllString(text, rule.label)
+	}
+	return text
+}
@@ -0,0 +1,152 @@
+package objstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/sigv4"
+)
+
+// Config locates a bucket and prefix. URLs are s3://bucket/prefix,
+// gs://bucket/prefix (GCS's S3-compatible XML API with HMAC keys) or
+// file:///dir for a local or mounted directory.
+type Config struct {
+	URL             string `yaml:"url"`
+	Region          string `yaml:"region"`          // default us-east-1, "auto" for gs://
+	Endpoint        string `yaml:"endpoint"`        // S3-compatible endpoint, e.g. http://minio:9000 (path-style)
+	AccessKeyID     string `yaml:"accessKeyID"`     // default $AWS_ACCESS_KEY_ID
+	SecretAccessKey string `yaml:"secretAccessKey"` // default $AWS_SECRET_ACCESS_KEY
+}
+
+// Store writes objects
+type Store interface {
+	Put(ctx context.Context, key string, body []byte, contentType string) error
+	String() string
+}
+
+// New opens the store a config names
+func New(config Config) (Store, error) {
+	u, err := url.Parse(config.URL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid storage url: %w", err)
+	}
+	prefix := strings.Trim(u.Path, "/")
+
+	switch u.Scheme {
+	case "file":
+		return &fileStore{dir: u.Path}, nil
+	case "s3", "gs":
+		if u.Host == "" {
+			return nil, fmt.Errorf("storage url %s has no bucket", config.URL)
+		}
+		creds := sigv4.FromEnv()
+		if config.AccessKeyID != "" {
+			creds = sigv4.Credentials{
+				AccessKeyID:     config.AccessKeyID,
+				SecretAccessKey: config.SecretAccessKey,
+			}
+		}
+		store := &s3Store{
+			scheme: u.Scheme,
+			bucket: u.Host,
+			prefix: prefix,
+			region: config.Region,
+			creds:  creds,
+			client: &http.Client{Timeout: time.Minute},
+		}
+		switch {
+		case config.Endpoint != "":
+			store.endpoint = strings.TrimSuffix(config.Endpoint, "/")
+		case u.Scheme == "gs":
+			store.endpoint = "https://storage.googleapis.com"
+		}
+		if store.region == "" {
+			store.region = "us-east-1"
+			if u.Scheme == "gs" {
+				store.region = "auto"
+			}
+		}
+		if store.creds.AccessKeyID == "" {
+			return nil, fmt.Errorf("no credentials for %s", config.URL)
+		}
+		return store, nil
+	}
+	return nil, fmt.Errorf("unsupported storage scheme %q", u.Scheme)
+}
+
+// fileStore writes objects below a directory
+type fileStore struct {
+	dir string
+}
+
+func (s *fileStore) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s *fileStore) String() string {
+	return "file://" + s.dir
+}
+
+// s3Store PUTs objects with SigV4-signed requests. Without an endpoint it
+// uses AWS virtual-hosted addressing; with one, path-style.
+type s3Store struct {
+	scheme   string
+	bucket   string
+	prefix   string
+	region   string
+	endpoint string
+	creds    sigv4.Credentials
+	client   *http.Client
+}
+
+func (s *s3Store) objectURL(key string) string {
+	if s.prefix != "" {
+		key = s.prefix + "/" + key
+	}
+	escaped := (&url.URL{Path: "/" + key}).EscapedPath()
+	if s.endpoint != "" {
+		return s.endpoint + "/" + s.bucket + escaped
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com%s", s.bucket, s.region, escaped)
+}
+
+func (s *s3Store) Put(ctx context.Context, key string, body []byte, contentType string) error {
+	req, err := http.NewRequestWithContext(ctx, "PUT", s.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	sigv4.Sign(req, body, s.creds, s.region, "s3", time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("PUT %s returned status %d: %s", key, resp.StatusCode, strings.TrimSpace(string(detail)))
+	}
+	return nil
+}
+
+func (s *s3Store) String() string {
+	return s.scheme + "://" + s.bucket + "/" + s.prefix
+}
@@ -0,0 +1,324 @@
+// Package parquet writes flat Parquet files: required columns of scalar
+// types, one row group, PLAIN encoded and uncompressed. That is enough for
+// warehouse loaders (Athena, BigQuery, Spark) to read exports without a
+// schema of their own.
+package parquet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Type is a column's logical type
+type Type int
+
+const (
+	Boolean   Type = iota
+	Int64          // int or int64
+	Double         // float64
+	String         // UTF-8
+	Timestamp      // time.Time, stored as milliseconds since the epoch UTC
+)
+
+// Column names and types one column
+type Column struct {
+	Name string
+	Type Type
+}
+
+// Physical types, encodings and converted types from parquet.thrift
+const (
+	physicalBoolean   = 0
+	physicalInt64     = 2
+	physicalDouble    = 5
+	physicalByteArray = 6
+
+	encodingPlain = 0
+	encodingRLE   = 3
+
+	convertedUTF8            = 0
+	convertedTimestampMillis = 9
+)
+
+var magic = []byte("PAR1")
+
+// Writer buffers rows column by column
+type Writer struct {
+	columns []Column
+	data    []bytes.Buffer
+	bools   [][]bool
+	rows    int
+}
+
+// NewWriter starts a file with the given columns
+func NewWriter(columns ...Column) *Writer {
+	return &Writer{
+		columns: columns,
+		data:    make([]bytes.Buffer, len(columns)),
+		bools:   make([][]bool, len(columns)),
+	}
+}
+
+// Append adds a row, one value per column in column order
+func (w *Writer) Append(values ...interface{}) error {
+	if len(values) != len(w.columns) {
+		return fmt.Errorf("row has %d values for %d columns", len(values), len(w.columns))
+	}
+	// Check the whole row first so a bad value leaves no partial row behind
+	for i, value := range values {
+		if !accepts(w.columns[i].Type, value) {
+			return fmt.Errorf("column %s cannot hold %T", w.columns[i].Name, value)
+		}
+	}
+
+	var scratch [8]byte
+	for i, value := range values {
+		buf := &w.data[i]
+		switch v := value.(type) {
+		case bool:
+			w.bools[i] = append(w.bools[i], v)
+		case int:
+			binary.LittleEndian.PutUint64(scratch[:], uint64(v))
+			buf.Write(scratch[:])
+		case int64:
+			binary.LittleEndian.PutUint64(scratch[:], uint64(v))
+			buf.Write(scratch[:])
+		case float64:
+			binary.LittleEndian.PutUint64(scratch[:], math.Float64bits(v))
+			buf.Write(scratch[:])
+		case string:
+			binary.LittleEndian.PutUint32(scratch[:4], uint32(len(v)))
+			buf.Write(scratch[:4])
+			buf.WriteString(v)
+		case time.Time:
+			binary.LittleEndian.PutUint64(scratch[:], uint64(v.UnixMilli()))
+			buf.Write(scratch[:])
+		}
+	}
+	w.rows++
+	return nil
+}
+
+func accepts(t Type, value interface{}) bool {
+	switch value.(type) {
+	case bool:
+		return t == Boolean
+	case int, int64:
+		return t == Int64
+	case float64:
+		return t == Double
+	case string:
+		return t == String
+	case time.Time:
+		return t == Timestamp
+	}
+	return false
+}
+
+// Rows is the number of rows appended so far
+func (w *Writer) Rows() int {
+	return w.rows
+}
+
+// Bytes returns the complete file
+func (w *Writer) Bytes() []byte {
+	var file bytes.Buffer
+	file.Write(magic)
+
+	chunks := make([]columnChunk, len(w.columns))
+	var total int64
+	for i, column := range w.columns {
+		values := w.data[i].Bytes()
+		if column.Type == Boolean {
+			values = packBools(w.bools[i])
+		}
+
+		var header compactWriter
+		header.fieldI32(1, 0) // type: DATA_PAGE
+		header.fieldI32(2, int32(len(values)))
+		header.fieldI32(3, int32(len(values)))
+		header.fieldStruct(5) // data_page_header
+		header.fieldI32(1, int32(w.rows))
+		header.fieldI32(2, encodingPlain)
+		header.fieldI32(3, encodingRLE)
+		header.fieldI32(4, encodingRLE)
+		header.endStruct()
+		header.endStruct()
+
+		chunks[i] = columnChunk{offset: int64(file.Len()), size: int64(header.buf.Len() + len(values))}
+		file.Write(header.buf.Bytes())
+		file.Write(values)
+		total += chunks[i].size
+	}
+
+	var meta compactWriter
+	meta.fieldI32(1, 1) // version
+	meta.fieldList(2, compactStruct, len(w.columns)+1)
+	meta.beginStruct() // root
+	meta.fieldBinary(4, "schema")
+	meta.fieldI32(5, int32(len(w.columns)))
+	meta.endStruct()
+	for _, column := range w.columns {
+		meta.beginStruct()
+		meta.fieldI32(1, physicalType(column.Type))
+		meta.fieldI32(3, 0) // repetition_type: REQUIRED
+		meta.fieldBinary(4, column.Name)
+		switch column.Type {
+		case String:
+			meta.fieldI32(6, convertedUTF8)
+		case Timestamp:
+			meta.fieldI32(6, convertedTimestampMillis)
+		}
+		meta.endStruct()
+	}
+	meta.fieldI64(3, int64(w.rows))
+	meta.fieldList(4, compactStruct, 1)
+	meta.beginStruct() // row group
+	meta.fieldList(1, compactStruct, len(w.columns))
+	for i, column := range w.columns {
+		meta.beginStruct()
+		meta.fieldI64(2, chunks[i].offset) // file_offset
+		meta.fieldStruct(3)                // meta_data
+		meta.fieldI32(1, physicalType(column.Type))
+		meta.fieldList(2, compactI32, 2)
+		meta.writeVarint(zigzag(encodingPlain))
+		meta.writeVarint(zigzag(encodingRLE))
+		meta.fieldList(3, compactBinary, 1)
+		meta.writeVarint(uint64(len(column.Name)))
+		meta.buf.WriteString(column.Name)
+		meta.fieldI32(4, 0) // codec: UNCOMPRESSED
+		meta.fieldI64(5, int64(w.rows))
+		meta.fieldI64(6, chunks[i].size)
+		meta.fieldI64(7, chunks[i].size)
+		meta.fieldI64(9, chunks[i].offset) // data_page_offset
+		meta.endStruct()
+		meta.endStruct()
+	}
+	meta.fieldI64(2, total)
+	meta.fieldI64(3, int64(w.rows))
+	meta.endStruct()
+	meta.fieldBinary(6, "multi-cloud-llm-router")
+	meta.endStruct()
+
+	file.Write(meta.buf.Bytes())
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(meta.buf.Len()))
+	file.Write(length[:])
+	file.Write(magic)
+	return file.Bytes()
+}
+
+type columnChunk struct {
+	offset int64
+	size   int64
+}
+
+func physicalType(t Type) int32 {
+	switch t {
+	case Boolean:
+		return physicalBoolean
+	case Double:
+		return physicalDouble
+	case String:
+		return physicalByteArray
+	}
+	return physicalInt64
+}
+
+// packBools bit-packs booleans least significant bit first, as PLAIN does
+func packBools(values []bool) []byte {
+	packed := make([]byte, (len(values)+7)/8)
+	for i, v := range values {
+		if v {
+			packed[i/8] |= 1 << (i % 8)
+		}
+	}
+	return packed
+}
+
+// Thrift compact protocol element types
+const (
+	compactI32    = 5
+	compactI64    = 6
+	compactBinary = 8
+	compactList   = 9
+	compactStruct = 12
+)
+
+// compactWriter encodes the Thrift compact protocol structs of the footer
+// and page headers. Field ids are written as deltas from the previous
+// field of the same struct.
+type compactWriter struct {
+	buf    bytes.Buffer
+	last   int16
+	nested []int16
+}
+
+func (c *compactWriter) fieldHeader(id int16, fieldType byte) {
+	if delta := id - c.last; delta > 0 && delta <= 15 {
+		c.buf.WriteByte(byte(delta)<<4 | fieldType)
+	} else {
+		c.buf.WriteByte(fieldType)
+		c.writeVarint(zigzag(int64(id)))
+	}
+	c.last = id
+}
+
+func (c *compactWriter) fieldI32(id int16, v int32) {
+	c.fieldHeader(id, compactI32)
+	c.writeVarint(zigzag(int64(v)))
+}
+
+func (c *compactWriter) fieldI64(id int16, v int64) {
+	c.fieldHeader(id, compactI64)
+	c.writeVarint(zigzag(v))
+}
+
+func (c *compactWriter) fieldBinary(id int16, v string) {
+	c.fieldHeader(id, compactBinary)
+	c.writeVarint(uint64(len(v)))
+	c.buf.WriteString(v)
+}
+
+// fieldList writes a list header; the caller writes the elements
+func (c *compactWriter) fieldList(id int16, elemType byte, size int) {
+	c.fieldHeader(id, compactList)
+	if size < 15 {
+		c.buf.WriteByte(byte(size)<<4 | elemType)
+		return
+	}
+	c.buf.WriteByte(0xf0 | elemType)
+	c.writeVarint(uint64(size))
+}
+
+func (c *compactWriter) fieldStruct(id int16) {
+	c.fieldHeader(id, compactStruct)
+	c.beginStruct()
+}
+
+// beginStruct starts a nested struct, or a struct list element
+func (c *compactWriter) beginStruct() {
+	c.nested = append(c.nested, c.last)
+	c.last = 0
+}
+
+// endStruct writes the stop field closing the current struct
+func (c *compactWriter) endStruct() {
+	c.buf.WriteByte(0)
+	if n := len(c.nested); n > 0 {
+		c.last = c.nested[n-1]
+		c.nested = c.nested[:n-1]
+	}
+}
+
+func (c *compactWriter) writeVarint(v uint64) {
+	var scratch [binary.MaxVarintLen64]byte
+	c.buf.Write(scratch[:binary.PutUvarint(scratch[:], v)])
+}
+
+func zigzag(v int64) uint64 {
+	return uint64(v<<1) ^ uint64(v>>63)
+}
@@ -0,0 +1,111 @@
+package providers
+
+import "encoding/json"
+
+// maxChoices is the most choices (n) a request may ask of a provider that
+// doesn't produce several natively, as many as Gemini's candidateCount
+// allows
+const maxChoices = 8
+
+// choiceCount returns the choices a request asks for, n, 1 by default
+func choiceCount(requestData map[string]interface{}) int {
+	if n, ok := requestData["n"].(float64); ok && n > 1 {
+		return int(n)
+	}
+	return 1
+}
+
+// unsupportedChoices returns "n" when a request asks for more choices than
+// limit, or for several while streaming, and "best_of" when it sets it:
+// best_of picks by log probability, which the converters don't get
+func unsupportedChoices(requestData map[string]interface{}, limit int) string {
+	if parameterSet(requestData, "best_of") {
+		return "best_of"
+	}
+	n := choiceCount(requestData)
+	stream, _ := requestData["stream"].(bool)
+	if n > limit || (n > 1 && stream) {
+		return "n"
+	}
+	return ""
+}
+
+// mergeChoices combines OpenAI responses into one holding all their
+// choices, numbered in order. Usage is summed, since each response's
+// prompt was billed.
+func mergeChoices(bodies [][]byte) []byte {
+	var merged map[string]interface{}
+	var choices []interface{}
+	usage := map[string]int{}
+	reasoning := 0
+	for _, body := range bodies {
+		var response struct {
+			Choices []map[string]interface{} `json:"choices"`
+			Usage   *struct {
+				PromptTokens            int `json:"prompt_tokens"`
+				CompletionTokens        int `json:"completion_tokens"`
+				TotalTokens             int `json:"total_tokens"`
+				CompletionTokensDetails struct {
+					ReasoningTokens int `json:"reasoning_tokens"`
+				} `json:"completion_tokens_details"`
+			} `json:"usage"`
+		}
+		if json.Unmarshal(body, &response) != nil {
+			continue
+		}
+		if merged == nil {
+			json.Unmarshal(body, &merged)
+		}
+		for _, choice := range response.Choices {
+			choice["index"] = len(choices)
+			choices = append(choices, choice)
+		}
+		if response.Usage != nil {
+			usage["prompt_tokens"] += response.Usage.PromptTokens
+			usage["completion_tokens"] += response.Usage.CompletionTokens
+			usage["total_tokens"] += response.Usage.TotalTokens
+			reasoning += response.Usage.CompletionTokensDetails.ReasoningTokens
+		}
+	}
+	if merged == nil {
+		return bodies[0]
+	}
+
+	merged["choices"] = choices
+	if len(usage) > 0 {
+		summed := map[string]interface{}{}
+		for name, tokens := range usage {
+			summed[name] = tokens
+		}
+		if reasoning > 0 {
+			summed["completion_tokens_details"] = map[string]int{"reasoning_tokens": reasoning}
+		}
+		merged["usage"] = summed
+	}
+	body, _ := json.Marshal(merged)
+	return body
+}
+
+// withCompletedUsage adds the summed usage of the completed responses to a
+// failed call's error body, so the spend of a partly failed fan-out is still
+// charged. A body that isn't a JSON object, or none, is answered as an
+// error with message.
+func withCompletedUsage(body []byte, message string, completed [][]byte) []byte {
+	var merged struct {
+		Usage json.RawMessage `json:"usage"`
+	}
+	json.Unmarshal(mergeChoices(completed), &merged)
+
+	var response map[string]interface{}
+	if json.Unmarshal(body, &response) != nil || response == nil {
+		if message == "" {
+			message = string(body)
+		}
+		response = map[string]interface{}{"error": map[string]interface{}{"message": message, "type": "api_error"}}
+	}
+	if len(merged.Usage) > 0 {
+		response["usage"] = merged.Usage
+	}
+	out, _ := json.Marshal(response)
+	return out
+}
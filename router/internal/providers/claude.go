@@ -8,11 +8,17 @@ import (
 	"io"
 	"net/http"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/tokenizer"
 	"github.com/sirupsen/logrus"
 )
 
+// claudeMaxTemperature is the hottest temperature Claude takes; OpenAI's
+// go up to 2
+const claudeMaxTemperature = 1.0
+
 // ClaudeProvider implements the Provider interface for Anthropic Claude
 type ClaudeProvider struct {
 	config     ProviderConfig
@@ -33,6 +39,12 @@ func NewClaudeProvider(config ProviderConfig) *ClaudeProvider {
 			Timeout: 120 * time.Second,
 		},
 		pricing: map[string]ModelPricing{
+			"claude-3-7-sonnet-20250219": {
+				InputPricePer1K:  0.003,
+				OutputPricePer1K: 0.015,
+				MaxTokens:        64000,
+				ContextWindow:    200000,
+			},
 			"claude-3-5-sonnet-20241022": {
 				InputPricePer1K:  0.003,
 				OutputPricePer1K: 0.015,
@@ -69,6 +81,11 @@ func (p *ClaudeProvider) Name() string {
 	return p.config.Name
 }
 
+// DefaultModel is the model sent when the request names none
+func (p *ClaudeProvider) DefaultModel() string {
+	return p.config.DefaultModel
+}
+
 func (p *ClaudeProvider) Health(ctx context.Context) error {
 	// Claude doesn't have a simple health endpoint, so we'll make a minimal request
 	reqBody := map[string]interface{}{
@@ -117,24 +134,100 @@ func (p *ClaudeProvider) Forward(ctx context.Context, w http.ResponseWriter, r *
 
 	// Parse and potentially modify the request for Claude's format
 	var requestData map[string]interface{}
+	var output claudeOutput
 	if err := json.Unmarshal(body, &requestData); err != nil {
 		logrus.Warnf("Failed to parse request JSON, forwarding as-is: %v", err)
 	} else {
+		// Claude only has a chat API, so legacy completions are asked as
+		// a chat and answered as text_completion
+		var completion *legacyCompletion
+		if isLegacyCompletion(endpoint) {
+			completion = completionToChat(requestData)
+		}
+
 		// Convert OpenAI format to Claude format if needed
-		body = p.convertToClaudeFormat(requestData)
+		body, output = p.convertToClaudeFormat(requestData)
+		output.completion = completion
 	}
 
-	// Create target URL - Claude uses /v1/messages for chat completions
+	// Create target URL - Claude uses /v1/messages for chat and legacy completions
 	targetURL := p.config.BaseURL + "/v1/messages"
-	if strings.Contains(endpoint, "completions") && !strings.Contains(endpoint, "chat") {
-		// For non-chat completions, we'll need to convert format
-		targetURL = p.config.BaseURL + "/v1/messages"
+
+	// Claude answers with one choice, so n of them take n requests
+	if n := choiceCount(requestData); n > 1 {
+		return p.forwardChoices(ctx, w, r, targetURL, body, output, n)
+	}
+
+	req, err := p.newRequest(ctx, r, targetURL, body)
+	if err != nil {
+		return err
 	}
 
-	// Create new request
+	// Make request
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to forward to Claude: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// For streaming responses, we might need to convert back to OpenAI format
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read Claude response: %w", err)
+	}
+
+	// Errors are passed on as Claude wrote them, the router rewriting them
+	// as OpenAI's
+	if resp.StatusCode >= 400 {
+		return p.writeResponse(w, resp, responseBody)
+	}
+
+	// Convert Claude response back to OpenAI format if needed
+	return p.writeResponse(w, resp, p.convertFromClaudeFormat(responseBody, output))
+}
+
+// ForwardMessages implements MessagesForwarder: the Messages API request
+// is sent as it is, so what the chat completions format has no place for,
+// such as cache_control, documents, server tools and signed thinking
+// blocks, reaches Claude, and Claude's response is passed back unconverted
+func (p *ClaudeProvider) ForwardMessages(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+	defer r.Body.Close()
+
+	var requestData map[string]interface{}
+	if json.Unmarshal(body, &requestData) == nil {
+		if model, _ := requestData["model"].(string); model == "" && p.config.DefaultModel != "" {
+			requestData["model"] = p.config.DefaultModel
+			body, _ = json.Marshal(requestData)
+		}
+	}
+
+	req, err := p.newRequest(ctx, r, p.config.BaseURL+"/v1/messages", body)
+	if err != nil {
+		return err
+	}
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to forward to Claude: %w", err)
+	}
+	defer resp.Body.Close()
+
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read Claude response: %w", err)
+	}
+	return p.writeResponse(w, resp, responseBody)
+}
+
+// newRequest builds the request to Claude, passing on the client's headers
+// but not its credentials
+func (p *ClaudeProvider) newRequest(ctx context.Context, r *http.Request, targetURL string, body []byte) (*http.Request, error) {
 	req, err := http.NewRequestWithContext(ctx, "POST", targetURL, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set Claude-specific headers
@@ -151,43 +244,97 @@ func (p *ClaudeProvider) Forward(ctx context.Context, w http.ResponseWriter, r *
 			req.Header.Add(name, value)
 		}
 	}
+	return req, nil
+}
 
-	// Make request
-	resp, err := p.httpClient.Do(req)
-	if err != nil {
-		return fmt.Errorf("failed to forward to Claude: %w", err)
-	}
-	defer resp.Body.Close()
-
+// writeResponse answers with Claude's status and headers and the converted
+// body
+func (p *ClaudeProvider) writeResponse(w http.ResponseWriter, resp *http.Response, convertedBody []byte) error {
 	// Copy response headers
 	for name, values := range resp.Header {
 		for _, value := range values {
 			w.Header().Add(name, value)
 		}
 	}
+	w.Header().Del("Content-Length") // the converted body's length differs
 
 	// Set status code
 	w.WriteHeader(resp.StatusCode)
 
-	// For streaming responses, we might need to convert back to OpenAI format
-	responseBody, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read Claude response: %w", err)
-	}
-
-	// Convert Claude response back to OpenAI format if needed
-	convertedBody := p.convertFromClaudeFormat(responseBody)
-	
-	_, err = w.Write(convertedBody)
-	if err != nil {
+	if _, err := w.Write(convertedBody); err != nil {
 		logrus.Errorf("Error writing Claude response: %v", err)
 		return err
 	}
-
 	return nil
 }
 
-func (p *ClaudeProvider) convertToClaudeFormat(requestData map[string]interface{}) []byte {
+// forwardChoices sends the request n times at once and answers with every
+// reply as one response's choices. The first failed reply is answered
+// instead, with the usage of those that completed.
+func (p *ClaudeProvider) forwardChoices(ctx context.Context, w http.ResponseWriter, r *http.Request, targetURL string, body []byte, output claudeOutput, n int) error {
+	type reply struct {
+		resp *http.Response
+		body []byte
+		err  error
+	}
+	replies := make([]reply, n)
+	var wg sync.WaitGroup
+	for i := range replies {
+		wg.Add(1)
+		go func(reply *reply) {
+			defer wg.Done()
+			req, err := p.newRequest(ctx, r, targetURL, body)
+			if err != nil {
+				reply.err = err
+				return
+			}
+			resp, err := p.httpClient.Do(req)
+			if err != nil {
+				reply.err = fmt.Errorf("failed to forward to Claude: %w", err)
+				return
+			}
+			defer resp.Body.Close()
+			reply.resp = resp
+			if reply.body, err = io.ReadAll(resp.Body); err != nil {
+				reply.err = fmt.Errorf("failed to read Claude response: %w", err)
+			}
+		}(&replies[i])
+	}
+	wg.Wait()
+
+	converted := make([][]byte, 0, n)
+	var failed *reply
+	for i := range replies {
+		if reply := &replies[i]; reply.err != nil || reply.resp.StatusCode != http.StatusOK {
+			if failed == nil {
+				failed = reply
+			}
+			continue
+		}
+		converted = append(converted, p.convertFromClaudeFormat(replies[i].body, output))
+	}
+	if failed == nil {
+		return p.writeResponse(w, replies[0].resp, mergeChoices(converted))
+	}
+	if len(converted) == 0 {
+		if failed.err != nil {
+			return failed.err
+		}
+		return p.writeResponse(w, failed.resp, failed.body)
+	}
+
+	// The replies that did complete were billed, so the failure answered
+	// carries their usage to be charged
+	if failed.err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadGateway)
+		_, err := w.Write(withCompletedUsage(nil, failed.err.Error(), converted))
+		return err
+	}
+	return p.writeResponse(w, failed.resp, withCompletedUsage(failed.body, "", converted))
+}
+
+func (p *ClaudeProvider) convertToClaudeFormat(requestData map[string]interface{}) ([]byte, claudeOutput) {
 	claudeRequest := make(map[string]interface{})
 
 	// Set model
@@ -200,33 +347,94 @@ func (p *ClaudeProvider) convertToClaudeFormat(requestData map[string]interface{
 	}
 
 	// Set max_tokens
-	if maxTokens, ok := requestData["max_tokens"].(float64); ok {
+	if maxTokens, ok := maxOutputTokens(requestData); ok {
 		claudeRequest["max_tokens"] = int(maxTokens)
 	} else {
 		claudeRequest["max_tokens"] = 4096
 	}
 
-	// Convert messages format
+	// Convert messages format, tool calls and results included; system
+	// messages go in Claude's system prompt
 	if messages, ok := requestData["messages"].([]interface{}); ok {
-		claudeRequest["messages"] = messages
+		system, rest := splitSystemPrompt(messages)
+		if system != "" {
+			claudeRequest["system"] = system
+		}
+		claudeRequest["messages"] = convertMessagesToClaude(rest)
+	}
+	if tools, ok := requestData["tools"].([]interface{}); ok && len(tools) > 0 {
+		claudeRequest["tools"] = convertToolsToClaude(tools)
+		if choice := convertToolChoiceToClaude(requestData["tool_choice"], requestData["parallel_tool_calls"]); choice != nil {
+			claudeRequest["tool_choice"] = choice
+		}
+	}
+
+	// Extended thinking, asked for with a thinking block or reasoning_effort,
+	// spends its budget out of max_tokens and rejects sampling parameters
+	thinking := false
+	if budget := reasoningBudget(requestData); budget > 0 && IsReasoningModel(claudeRequest["model"].(string)) {
+		if budget < 1024 {
+			budget = 1024 // the smallest budget Claude accepts
+		}
+		if maxTokens := claudeRequest["max_tokens"].(int); maxTokens <= budget {
+			claudeRequest["max_tokens"] = budget + maxTokens
+		}
+		claudeRequest["thinking"] = map[string]interface{}{"type": "enabled", "budget_tokens": budget}
+		thinking = true
 	}
 
-	// Handle other parameters
-	if temp, ok := requestData["temperature"]; ok {
+	// Handle other parameters. Requests hotter than claudeMaxTemperature
+	// never get here, see UnsupportedParameter.
+	if temp, ok := requestData["temperature"]; ok && !thinking {
 		claudeRequest["temperature"] = temp
 	}
-	if topP, ok := requestData["top_p"]; ok {
+	if topP, ok := requestData["top_p"]; ok && !thinking {
 		claudeRequest["top_p"] = topP
 	}
+	if topK, ok := requestData["top_k"]; ok && !thinking {
+		claudeRequest["top_k"] = topK
+	}
+	if stop := stopSequences(requestData); stop != nil {
+		claudeRequest["stop_sequences"] = stop
+	}
+	if user, ok := requestData["user"].(string); ok && user != "" {
+		claudeRequest["metadata"] = map[string]interface{}{"user_id": user}
+	}
 	if stream, ok := requestData["stream"]; ok {
 		claudeRequest["stream"] = stream
 	}
 
+	// Claude has no JSON mode, so structured output is asked for otherwise
+	var output claudeOutput
+	if format := parseResponseFormat(requestData); format.JSON() {
+		output = applyClaudeResponseFormat(claudeRequest, format, thinking)
+	}
+
 	body, _ := json.Marshal(claudeRequest)
-	return body
+	return body, output
+}
+
+// SupportsEndpoint implements EndpointSupporter: Claude has no embeddings
+// API, so it serves chat and legacy completions only
+func (p *ClaudeProvider) SupportsEndpoint(endpoint string) bool {
+	return strings.HasSuffix(endpoint, "/completions")
+}
+
+// UnsupportedParameter implements ParameterChecker
+func (p *ClaudeProvider) UnsupportedParameter(requestData map[string]interface{}) string {
+	if param := unsupportedChoices(requestData, maxChoices); param != "" {
+		return param
+	}
+	if param := unsupportedCompletion(requestData); param != "" {
+		return param
+	}
+	if temp, ok := requestData["temperature"].(float64); ok && temp > claudeMaxTemperature {
+		return "temperature"
+	}
+	return unsupportedParameter(requestData, claudeUnsupportedParameters)
 }
 
-func (p *ClaudeProvider) convertFromClaudeFormat(claudeResponse []byte) []byte {
+func (p *ClaudeProvider) convertFromClaudeFormat(claudeResponse []byte, output claudeOutput) []byte {
 	// Parse Claude response
 	var claudeData map[string]interface{}
 	if err := json.Unmarshal(claudeResponse, &claudeData); err != nil {
@@ -235,6 +443,25 @@ func (p *ClaudeProvider) convertFromClaudeFormat(claudeResponse []byte) []byte {
 	}
 
 	// Convert to OpenAI format
+	content, thinking := extractClaudeContent(claudeData)
+	message := map[string]interface{}{
+		"role":    "assistant",
+		"content": content,
+	}
+	if thinking != "" {
+		message["reasoning_content"] = thinking
+	}
+	if toolCalls := extractClaudeToolCalls(claudeData); len(toolCalls) > 0 {
+		message["tool_calls"] = toolCalls
+		if content == "" {
+			message["content"] = nil
+		}
+	}
+	output.apply(message)
+	finishReason := claudeFinishReason(claudeData["stop_reason"])
+	if output.tool != "" && message["tool_calls"] == nil {
+		finishReason = "stop" // the forced tool call was the answer
+	}
 	openaiResponse := map[string]interface{}{
 		"id":      fmt.Sprintf("chatcmpl-%d", time.Now().Unix()),
 		"object":  "chat.completion",
@@ -242,34 +469,60 @@ func (p *ClaudeProvider) convertFromClaudeFormat(claudeResponse []byte) []byte {
 		"model":   claudeData["model"],
 		"choices": []map[string]interface{}{
 			{
-				"index": 0,
-				"message": map[string]interface{}{
-					"role":    "assistant",
-					"content": extractClaudeContent(claudeData),
-				},
-				"finish_reason": "stop",
+				"index":         0,
+				"message":       message,
+				"finish_reason": finishReason,
 			},
 		},
 	}
 
-	// Add usage information if available
+	// Add usage information if available, named as OpenAI does. Claude
+	// counts thinking in output_tokens without breaking it out, so the
+	// reasoning share is counted from the thinking text.
 	if usage, ok := claudeData["usage"].(map[string]interface{}); ok {
-		openaiResponse["usage"] = usage
+		inputTokens, _ := usage["input_tokens"].(float64)
+		outputTokens, _ := usage["output_tokens"].(float64)
+		converted := map[string]interface{}{
+			"prompt_tokens":     int(inputTokens),
+			"completion_tokens": int(outputTokens),
+			"total_tokens":      int(inputTokens + outputTokens),
+		}
+		if thinking != "" {
+			model, _ := claudeData["model"].(string)
+			reasoningTokens := tokenizer.Count(model, thinking)
+			if reasoningTokens > int(outputTokens) {
+				reasoningTokens = int(outputTokens)
+			}
+			converted["completion_tokens_details"] = map[string]int{"reasoning_tokens": reasoningTokens}
+		}
+		openaiResponse["usage"] = converted
 	}
 
 	body, _ := json.Marshal(openaiResponse)
-	return body
+	return output.completion.response(body)
 }
 
-func extractClaudeContent(claudeData map[string]interface{}) string {
-	if content, ok := claudeData["content"].([]interface{}); ok && len(content) > 0 {
-		if item, ok := content[0].(map[string]interface{}); ok {
-			if text, ok := item["text"].(string); ok {
-				return text
+// extractClaudeContent joins a response's text blocks and, separately, its
+// thinking blocks
+func extractClaudeContent(claudeData map[string]interface{}) (text, thinking string) {
+	content, _ := claudeData["content"].([]interface{})
+	for _, block := range content {
+		item, ok := block.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		switch item["type"] {
+		case "thinking":
+			if t, ok := item["thinking"].(string); ok {
+				thinking += t
+			}
+		case "text", nil:
+			if t, ok := item["text"].(string); ok {
+				text += t
 			}
 		}
 	}
-	return ""
+	return text, thinking
 }
 
 func (p *ClaudeProvider) CalculateCost(inputTokens, outputTokens int) float64 {
@@ -278,10 +531,11 @@ func (p *ClaudeProvider) CalculateCost(inputTokens, outputTokens int) float64 {
 		model = "claude-3-haiku-20240307" // cheapest fallback
 	}
 
-	pricing, exists := p.pricing[model]
+	table := p.GetModelPricing()
+	pricing, exists := table[model]
 	if !exists {
 		// Use haiku pricing as default
-		pricing = p.pricing["claude-3-haiku-20240307"]
+		pricing = table["claude-3-haiku-20240307"]
 	}
 
 	inputCost := float64(inputTokens) * pricing.InputPricePer1K / 1000.0
@@ -291,5 +545,5 @@ func (p *ClaudeProvider) CalculateCost(inputTokens, outputTokens int) float64 {
 }
 
 func (p *ClaudeProvider) GetModelPricing() map[string]ModelPricing {
-	return p.pricing
+	return WithOverrides(p.config.Name, p.pricing)
 }
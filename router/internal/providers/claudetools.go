@@ -0,0 +1,202 @@
+package providers
+
+import (
+	"encoding/json"
+)
+
+// convertToolsToClaude turns OpenAI function tools into Claude tools.
+// Tools of other types have no Claude equivalent and are dropped.
+func convertToolsToClaude(tools []interface{}) []interface{} {
+	converted := make([]interface{}, 0, len(tools))
+	for _, tool := range tools {
+		item, _ := tool.(map[string]interface{})
+		function, ok := item["function"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		schema, ok := function["parameters"].(map[string]interface{})
+		if !ok {
+			schema = map[string]interface{}{"type": "object", "properties": map[string]interface{}{}}
+		}
+		claudeTool := map[string]interface{}{
+			"name":         function["name"],
+			"input_schema": schema,
+		}
+		if description, ok := function["description"].(string); ok && description != "" {
+			claudeTool["description"] = description
+		}
+		converted = append(converted, claudeTool)
+	}
+	return converted
+}
+
+// convertToolChoiceToClaude maps tool_choice and parallel_tool_calls onto
+// Claude's tool_choice, or returns nil to leave Claude's default (auto)
+func convertToolChoiceToClaude(toolChoice, parallelToolCalls interface{}) map[string]interface{} {
+	var choice map[string]interface{}
+	switch value := toolChoice.(type) {
+	case string:
+		switch value {
+		case "auto":
+			choice = map[string]interface{}{"type": "auto"}
+		case "required":
+			choice = map[string]interface{}{"type": "any"}
+		case "none":
+			return map[string]interface{}{"type": "none"}
+		}
+	case map[string]interface{}:
+		if function, ok := value["function"].(map[string]interface{}); ok {
+			choice = map[string]interface{}{"type": "tool", "name": function["name"]}
+		}
+	}
+
+	if parallel, ok := parallelToolCalls.(bool); ok && !parallel {
+		if choice == nil {
+			choice = map[string]interface{}{"type": "auto"}
+		}
+		choice["disable_parallel_tool_use"] = true
+	}
+	return choice
+}
+
+// convertMessagesToClaude rewrites the parts of an OpenAI conversation
+// Claude shapes differently as Claude content blocks: an assistant's
+// tool_calls become tool_use blocks, tool messages become tool_result
+// blocks of a user turn, consecutive results sharing one turn as Claude
+// requires, and image_url parts become image blocks. Other messages are
+// left as they are.
+func convertMessagesToClaude(messages []interface{}) []interface{} {
+	converted := make([]interface{}, 0, len(messages))
+	var results []interface{} // tool_result blocks of the user turn being built
+	flush := func() {
+		if len(results) > 0 {
+			converted = append(converted, map[string]interface{}{"role": "user", "content": results})
+			results = nil
+		}
+	}
+
+	for _, raw := range messages {
+		message, ok := raw.(map[string]interface{})
+		if !ok {
+			flush()
+			converted = append(converted, raw)
+			continue
+		}
+		switch message["role"] {
+		case "tool":
+			result := map[string]interface{}{
+				"type":        "tool_result",
+				"tool_use_id": message["tool_call_id"],
+			}
+			if content := message["content"]; content != nil {
+				result["content"] = content
+				if parts, ok := content.([]interface{}); ok {
+					result["content"] = claudeContentParts(parts)
+				}
+			}
+			results = append(results, result)
+		case "assistant":
+			flush()
+			calls, _ := message["tool_calls"].([]interface{})
+			if len(calls) == 0 {
+				converted = append(converted, withClaudeContent(message))
+				continue
+			}
+			converted = append(converted, map[string]interface{}{
+				"role":    "assistant",
+				"content": append(contentBlocks(message["content"]), toolUseBlocks(calls)...),
+			})
+		default:
+			flush()
+			converted = append(converted, withClaudeContent(message))
+		}
+	}
+	flush()
+	return converted
+}
+
+// withClaudeContent returns message with content parts converted to
+// Claude content blocks
+func withClaudeContent(message map[string]interface{}) map[string]interface{} {
+	parts, ok := message["content"].([]interface{})
+	if !ok {
+		return message
+	}
+	converted := make(map[string]interface{}, len(message))
+	for key, value := range message {
+		converted[key] = value
+	}
+	converted["content"] = claudeContentParts(parts)
+	return converted
+}
+
+// contentBlocks returns OpenAI message content as Claude content blocks
+func contentBlocks(content interface{}) []interface{} {
+	switch value := content.(type) {
+	case string:
+		if value != "" {
+			return []interface{}{map[string]interface{}{"type": "text", "text": value}}
+		}
+	case []interface{}:
+		return claudeContentParts(value)
+	}
+	return nil
+}
+
+// toolUseBlocks turns OpenAI tool_calls into tool_use blocks. Arguments
+// that aren't a JSON object are sent as an empty input.
+func toolUseBlocks(calls []interface{}) []interface{} {
+	blocks := make([]interface{}, 0, len(calls))
+	for _, raw := range calls {
+		call, _ := raw.(map[string]interface{})
+		function, _ := call["function"].(map[string]interface{})
+		input := map[string]interface{}{}
+		if arguments, ok := function["arguments"].(string); ok && arguments != "" {
+			json.Unmarshal([]byte(arguments), &input)
+		}
+		if input == nil {
+			input = map[string]interface{}{} // arguments were "null"
+		}
+		blocks = append(blocks, map[string]interface{}{
+			"type":  "tool_use",
+			"id":    call["id"],
+			"name":  function["name"],
+			"input": input,
+		})
+	}
+	return blocks
+}
+
+// extractClaudeToolCalls returns a response's tool_use blocks as OpenAI
+// tool_calls
+func extractClaudeToolCalls(claudeData map[string]interface{}) []map[string]interface{} {
+	content, _ := claudeData["content"].([]interface{})
+	var calls []map[string]interface{}
+	for _, block := range content {
+		item, ok := block.(map[string]interface{})
+		if !ok || item["type"] != "tool_use" {
+			continue
+		}
+		arguments, _ := json.Marshal(item["input"])
+		calls = append(calls, map[string]interface{}{
+			"id":   item["id"],
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":      item["name"],
+				"arguments": string(arguments),
+			},
+		})
+	}
+	return calls
+}
+
+// claudeFinishReason maps Claude's stop_reason onto OpenAI's finish_reason
+func claudeFinishReason(stopReason interface{}) string {
+	switch stopReason {
+	case "tool_use":
+		return "tool_calls"
+	case "max_tokens":
+		return "length"
+	}
+	return "stop"
+}
@@ -0,0 +1,94 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// legacyCompletion is a /v1/completions request served as a chat by a
+// provider that only has a chat API
+type legacyCompletion struct {
+	echo string // prompt put back in front of each text when echo is set
+}
+
+// isLegacyCompletion reports whether endpoint is /v1/completions
+func isLegacyCompletion(endpoint string) bool {
+	return strings.HasSuffix(endpoint, "/completions") && !strings.HasSuffix(endpoint, "/chat/completions")
+}
+
+// completionPrompt returns a completions request's prompt, a string or a
+// list holding one
+func completionPrompt(requestData map[string]interface{}) (string, bool) {
+	switch prompt := requestData["prompt"].(type) {
+	case string:
+		return prompt, true
+	case []interface{}:
+		if len(prompt) == 1 {
+			text, ok := prompt[0].(string)
+			return text, ok
+		}
+	}
+	return "", false
+}
+
+// unsupportedCompletion returns the completions parameter a chat API
+// can't honor: a prompt of several texts or of tokens, or suffix
+func unsupportedCompletion(requestData map[string]interface{}) string {
+	if _, ok := requestData["prompt"]; ok {
+		if _, ok := completionPrompt(requestData); !ok {
+			return "prompt"
+		}
+	}
+	if suffix, _ := requestData["suffix"].(string); suffix != "" {
+		return "suffix"
+	}
+	return ""
+}
+
+// completionToChat rewrites a completions request in place as a chat
+// request with the prompt as its one user message
+func completionToChat(requestData map[string]interface{}) *legacyCompletion {
+	prompt, _ := completionPrompt(requestData)
+	completion := &legacyCompletion{}
+	if echo, _ := requestData["echo"].(bool); echo {
+		completion.echo = prompt
+	}
+	for _, name := range []string{"prompt", "echo", "suffix", "best_of"} {
+		delete(requestData, name)
+	}
+	requestData["messages"] = []interface{}{map[string]interface{}{"role": "user", "content": prompt}}
+	return completion
+}
+
+// response rewrites a chat.completion as a text_completion. Error
+// responses aren't chat completions and are returned as they are, as is
+// everything when c is nil, for chat requests.
+func (c *legacyCompletion) response(body []byte) []byte {
+	if c == nil {
+		return body
+	}
+	var chat map[string]interface{}
+	if json.Unmarshal(body, &chat) != nil || chat["object"] != "chat.completion" {
+		return body
+	}
+	choices, _ := chat["choices"].([]interface{})
+	converted := make([]interface{}, 0, len(choices))
+	for _, raw := range choices {
+		choice, _ := raw.(map[string]interface{})
+		message, _ := choice["message"].(map[string]interface{})
+		text, _ := message["content"].(string)
+		converted = append(converted, map[string]interface{}{
+			"index":         choice["index"],
+			"text":          c.echo + text,
+			"logprobs":      nil,
+			"finish_reason": choice["finish_reason"],
+		})
+	}
+	chat["id"] = fmt.Sprintf("cmpl-%d", time.Now().Unix())
+	chat["object"] = "text_completion"
+	chat["choices"] = converted
+	rewritten, _ := json.Marshal(chat)
+	return rewritten
+}
@@ -0,0 +1,123 @@
+package providers
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CoolDown keeps a rate-limited provider out of selection until until. An
+// earlier until than one already set is ignored.
+func (pm *ProviderManager) CoolDown(name string, until time.Time) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	if until.After(pm.cooldowns[name]) {
+		pm.cooldowns[name] = until
+	}
+}
+
+// CoolingDown reports whether a provider is cooling down, and until when
+func (pm *ProviderManager) CoolingDown(name string) (time.Time, bool) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	until, ok := pm.cooldowns[name]
+	return until, ok && time.Now().Before(until)
+}
+
+// Cooldowns returns the providers cooling down now and until when
+func (pm *ProviderManager) Cooldowns() map[string]time.Time {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	now := time.Now()
+	active := make(map[string]time.Time)
+	for name, until := range pm.cooldowns {
+		if now.Before(until) {
+			active[name] = until
+		} else {
+			delete(pm.cooldowns, name)
+		}
+	}
+	return active
+}
+
+// RetryAfter reads how long a provider that answered 429 asks to be left
+// alone: Retry-After (seconds or an HTTP date), retry-after-ms, OpenAI's
+// x-ratelimit-reset-* durations, Anthropic's anthropic-ratelimit-*-reset
+// timestamps or RateLimit-Reset seconds. Of several reset headers, those
+// whose remaining count is 0 are the ones that matter; if none says so,
+// the longest is taken.
+func RetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	if ms, err := strconv.ParseFloat(header.Get("Retry-After-Ms"), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond)), true
+	}
+	if value := strings.TrimSpace(header.Get("Retry-After")); value != "" {
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds >= 0 {
+			return time.Duration(seconds * float64(time.Second)), true
+		}
+		if at, err := http.ParseTime(value); err == nil {
+			return clampWait(at.Sub(now)), true
+		}
+	}
+
+	var exhausted, longest time.Duration
+	found, anyExhausted := false, false
+	for _, limit := range []string{"requests", "tokens", "input-tokens", "output-tokens"} {
+		wait, ok := resetWait(header, limit, now)
+		if !ok {
+			continue
+		}
+		found = true
+		if wait > longest {
+			longest = wait
+		}
+		if remaining(header, limit) == "0" {
+			anyExhausted = true
+			if wait > exhausted {
+				exhausted = wait
+			}
+		}
+	}
+	if anyExhausted {
+		return exhausted, true
+	}
+	if found {
+		return longest, true
+	}
+
+	if seconds, err := strconv.ParseFloat(header.Get("RateLimit-Reset"), 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds * float64(time.Second)), true
+	}
+	return 0, false
+}
+
+// resetWait reads when one limit resets, as OpenAI ("6m0s", "20ms") or
+// Anthropic (RFC 3339) report it
+func resetWait(header http.Header, limit string, now time.Time) (time.Duration, bool) {
+	if value := header.Get("X-Ratelimit-Reset-" + limit); value != "" {
+		if wait, err := time.ParseDuration(value); err == nil {
+			return clampWait(wait), true
+		}
+		if seconds, err := strconv.ParseFloat(value, 64); err == nil {
+			return clampWait(time.Duration(seconds * float64(time.Second))), true
+		}
+	}
+	if value := header.Get("Anthropic-Ratelimit-" + limit + "-Reset"); value != "" {
+		if at, err := time.Parse(time.RFC3339, value); err == nil {
+			return clampWait(at.Sub(now)), true
+		}
+	}
+	return 0, false
+}
+
+func remaining(header http.Header, limit string) string {
+	if value := header.Get("X-Ratelimit-Remaining-" + limit); value != "" {
+		return value
+	}
+	return header.Get("Anthropic-Ratelimit-" + limit + "-Remaining")
+}
+
+func clampWait(wait time.Duration) time.Duration {
+	return time.Duration(math.Max(0, float64(wait)))
+}
@@ -13,9 +13,10 @@ import (
 
 // GeminiProvider implements the Provider interface for Google Gemini
 type GeminiProvider struct {
-	config     ProviderConfig
-	httpClient *http.Client
-	pricing    map[string]ModelPricing
+	config      ProviderConfig
+	httpClient  *http.Client
+	imageClient *http.Client // downloads linked images, nil unless fetchImageURLs
+	pricing     map[string]ModelPricing
 }
 
 // NewGeminiProvider creates a new Gemini provider
@@ -31,6 +32,13 @@ func NewGeminiProvider(config ProviderConfig) *GeminiProvider {
 			Timeout: 120 * time.Second,
 		},
 		pricing: map[string]ModelPricing{
+			"gemini-2.5-flash-preview-04-17": {
+				InputPricePer1K:     0.00015,
+				OutputPricePer1K:    0.0006,
+				ReasoningPricePer1K: 0.0035, // thinking output is billed higher
+				MaxTokens:           65536,
+				ContextWindow:       1048576,
+			},
 			"gemini-1.5-pro": {
 				InputPricePer1K:  0.0035,
 				OutputPricePer1K: 0.0105,
@@ -49,11 +57,19 @@ func NewGeminiProvider(config ProviderConfig) *GeminiProvider {
 				MaxTokens:        2048,
 				ContextWindow:    30720, // ~30K tokens
 			},
+			"text-embedding-004": {
+				InputPricePer1K:  0.0, // free of charge on the Gemini API
+				OutputPricePer1K: 0.0,
+				ContextWindow:    2048,
+			},
 		},
 	}
 
 	// Override base URL in config
 	provider.config.BaseURL = baseURL
+	if config.FetchImageURLs {
+		provider.imageClient = newImageClient()
+	}
 	return provider
 }
 
@@ -61,6 +77,11 @@ func (p *GeminiProvider) Name() string {
 	return p.config.Name
 }
 
+// DefaultModel is the model sent when the request names none
+func (p *GeminiProvider) DefaultModel() string {
+	return p.config.DefaultModel
+}
+
 func (p *GeminiProvider) Health(ctx context.Context) error {
 	// Use the models list endpoint for health check
 	url := fmt.Sprintf("%s/v1/models?key=%s", p.config.BaseURL, p.config.APIKey)
@@ -97,6 +118,28 @@ func (p *GeminiProvider) Forward(ctx context.Context, w http.ResponseWriter, r *
 		return fmt.Errorf("failed to parse request JSON: %w", err)
 	}
 
+	// Embeddings have their own API
+	if isEmbeddings(endpoint) {
+		return p.forwardEmbeddings(ctx, w, r, requestData)
+	}
+
+	// Gemini only takes images inline, so linked ones are downloaded when
+	// that is allowed
+	if p.imageClient != nil {
+		if err := inlineImageURLs(ctx, p.imageClient, requestData); err != nil {
+			return err
+		}
+	} else if linksImages(requestData) {
+		return fmt.Errorf("Gemini takes images as data: URLs; set fetchImageURLs to download linked ones")
+	}
+
+	// Gemini only has a chat API, so legacy completions are asked as a
+	// chat and answered as text_completion
+	var completion *legacyCompletion
+	if isLegacyCompletion(endpoint) {
+		completion = completionToChat(requestData)
+	}
+
 	// Convert to Gemini format
 	geminiBody, model := p.convertToGeminiFormat(requestData)
 
@@ -110,10 +153,33 @@ func (p *GeminiProvider) Forward(ctx context.Context, w http.ResponseWriter, r *
 			p.config.BaseURL, model, p.config.APIKey)
 	}
 
-	// Create new request
-	req, err := http.NewRequestWithContext(ctx, "POST", targetURL, bytes.NewReader(geminiBody))
+	req, err := p.newRequest(ctx, r, targetURL, geminiBody)
+	if err != nil {
+		return err
+	}
+
+	// Make request
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to forward to Gemini: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Handle streaming response differently
+	if strings.Contains(targetURL, "streamGenerateContent") {
+		return p.handleStreamingResponse(w, resp, model, completion)
+	}
+
+	// Handle regular response
+	return p.handleRegularResponse(w, resp, model, completion)
+}
+
+// newRequest builds the request to Gemini, passing on the client's headers
+// but not its credentials
+func (p *GeminiProvider) newRequest(ctx context.Context, r *http.Request, targetURL string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", targetURL, bytes.NewReader(body))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	// Set headers
@@ -128,21 +194,48 @@ func (p *GeminiProvider) Forward(ctx context.Context, w http.ResponseWriter, r *
 			req.Header.Add(name, value)
 		}
 	}
+	return req, nil
+}
 
-	// Make request
+// forwardEmbeddings sends an embeddings request to embedContent and
+// answers with OpenAI's embeddings list
+func (p *GeminiProvider) forwardEmbeddings(ctx context.Context, w http.ResponseWriter, r *http.Request, requestData map[string]interface{}) error {
+	inputs, _ := embeddingInputs(requestData)
+	model := geminiEmbeddingModelFor(requestData)
+	body, method := convertToGeminiEmbeddings(requestData, model, inputs)
+	targetURL := fmt.Sprintf("%s/v1/models/%s:%s?key=%s", p.config.BaseURL, model, method, p.config.APIKey)
+
+	req, err := p.newRequest(ctx, r, targetURL, body)
+	if err != nil {
+		return err
+	}
 	resp, err := p.httpClient.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to forward to Gemini: %w", err)
 	}
 	defer resp.Body.Close()
 
-	// Handle streaming response differently
-	if strings.Contains(targetURL, "streamGenerateContent") {
-		return p.handleStreamingResponse(w, resp, model)
+	responseBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read Gemini response: %w", err)
+	}
+	// Errors are passed on as Gemini wrote them, the router rewriting them
+	// as OpenAI's
+	if resp.StatusCode < 400 {
+		format, _ := requestData["encoding_format"].(string)
+		responseBody = convertFromGeminiEmbeddings(responseBody, model, inputs, format == "base64")
 	}
 
-	// Handle regular response
-	return p.handleRegularResponse(w, resp, model)
+	for name, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	w.Header().Del("Content-Length") // the converted body's length differs
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(resp.StatusCode)
+	_, err = w.Write(responseBody)
+	return err
 }
 
 func (p *GeminiProvider) convertToGeminiFormat(requestData map[string]interface{}) ([]byte, string) {
@@ -159,9 +252,20 @@ func (p *GeminiProvider) convertToGeminiFormat(requestData map[string]interface{
 		model = "gemini-pro"
 	}
 
-	// Convert messages to Gemini contents format
+	// Convert messages to Gemini contents format, system messages apart
+	var system string
 	if messages, ok := requestData["messages"].([]interface{}); ok {
+		system, messages = splitSystemPrompt(messages)
 		var parts []map[string]interface{}
+		// Tool results answering one turn's calls go back in one turn
+		callNames := map[string]interface{}{}
+		var results []map[string]interface{}
+		flushResults := func() {
+			if len(results) > 0 {
+				parts = append(parts, map[string]interface{}{"role": "user", "parts": results})
+				results = nil
+			}
+		}
 		
 		for _, msg := range messages {
 			if msgMap, ok := msg.(map[string]interface{}); ok {
@@ -169,11 +273,24 @@ func (p *GeminiProvider) convertToGeminiFormat(requestData map[string]interface{
 				if r, ok := msgMap["role"].(string); ok {
 					if r == "assistant" {
 						role = "model"
-					} else if r == "system" {
-						// System messages need special handling in Gemini
+					} else if r == "tool" || r == "function" {
+						results = append(results, functionResponsePart(msgMap, callNames))
 						continue
 					}
 				}
+				flushResults()
+
+				if calls, ok := msgMap["tool_calls"].([]interface{}); ok && len(calls) > 0 && role == "model" {
+					var callParts []map[string]interface{}
+					if text := textContent(msgMap["content"]); text != "" {
+						callParts = append(callParts, map[string]interface{}{"text": text})
+					}
+					parts = append(parts, map[string]interface{}{
+						"role":  role,
+						"parts": append(callParts, functionCallParts(calls, callNames)...),
+					})
+					continue
+				}
 
 				if content, ok := msgMap["content"].(string); ok {
 					part := map[string]interface{}{
@@ -183,13 +300,29 @@ func (p *GeminiProvider) convertToGeminiFormat(requestData map[string]interface{
 						},
 					}
 					parts = append(parts, part)
+				} else if content, ok := msgMap["content"].([]interface{}); ok {
+					// Text and image parts
+					parts = append(parts, map[string]interface{}{
+						"role":  role,
+						"parts": geminiContentParts(content),
+					})
 				}
 			}
 		}
+		flushResults()
 		
 		geminiRequest["contents"] = parts
 	}
 
+	if tools, ok := requestData["tools"].([]interface{}); ok {
+		if geminiTools := convertToolsToGemini(tools); geminiTools != nil {
+			geminiRequest["tools"] = geminiTools
+			if toolConfig := convertToolChoiceToGemini(requestData["tool_choice"]); toolConfig != nil {
+				geminiRequest["toolConfig"] = toolConfig
+			}
+		}
+	}
+
 	// Handle generation config
 	generationConfig := make(map[string]interface{})
 	
@@ -199,9 +332,38 @@ func (p *GeminiProvider) convertToGeminiFormat(requestData map[string]interface{
 	if topP, ok := requestData["top_p"]; ok {
 		generationConfig["topP"] = topP
 	}
-	if maxTokens, ok := requestData["max_tokens"]; ok {
+	if maxTokens, ok := maxOutputTokens(requestData); ok {
 		generationConfig["maxOutputTokens"] = maxTokens
 	}
+	if topK, ok := requestData["top_k"]; ok {
+		generationConfig["topK"] = topK
+	}
+	if stop := stopSequences(requestData); stop != nil {
+		generationConfig["stopSequences"] = stop
+	}
+	if penalty, ok := requestData["presence_penalty"]; ok && parameterSet(requestData, "presence_penalty") {
+		generationConfig["presencePenalty"] = penalty
+	}
+	if penalty, ok := requestData["frequency_penalty"]; ok && parameterSet(requestData, "frequency_penalty") {
+		generationConfig["frequencyPenalty"] = penalty
+	}
+	if seed, ok := requestData["seed"]; ok && seed != nil {
+		generationConfig["seed"] = seed
+	}
+	if n := choiceCount(requestData); n > 1 {
+		generationConfig["candidateCount"] = n
+	}
+	if budget := reasoningBudget(requestData); budget > 0 && IsReasoningModel(model) {
+		generationConfig["thinkingConfig"] = map[string]interface{}{"thinkingBudget": budget}
+	}
+	if format := parseResponseFormat(requestData); format.JSON() {
+		if instruction := applyGeminiResponseFormat(geminiRequest, generationConfig, format); instruction != "" {
+			system = strings.TrimPrefix(system+"\n\n"+instruction, "\n\n")
+		}
+	}
+	if system != "" {
+		setGeminiSystemPrompt(geminiRequest, model, system)
+	}
 
 	if len(generationConfig) > 0 {
 		geminiRequest["generationConfig"] = generationConfig
@@ -211,15 +373,42 @@ func (p *GeminiProvider) convertToGeminiFormat(requestData map[string]interface{
 	return body, model
 }
 
-func (p *GeminiProvider) handleRegularResponse(w http.ResponseWriter, resp *http.Response, model string) error {
+// SupportsEndpoint implements EndpointSupporter: chat and legacy
+// completions go to generateContent and embeddings to embedContent
+func (p *GeminiProvider) SupportsEndpoint(endpoint string) bool {
+	return strings.HasSuffix(endpoint, "/completions") || isEmbeddings(endpoint)
+}
+
+// UnsupportedParameter implements ParameterChecker
+func (p *GeminiProvider) UnsupportedParameter(requestData map[string]interface{}) string {
+	if param := unsupportedChoices(requestData, maxChoices); param != "" {
+		return param
+	}
+	if param := unsupportedCompletion(requestData); param != "" {
+		return param
+	}
+	if param := unsupportedEmbeddings(requestData); param != "" {
+		return param
+	}
+	if p.imageClient == nil && linksImages(requestData) {
+		return "image_url"
+	}
+	return unsupportedParameter(requestData, geminiUnsupportedParameters)
+}
+
+func (p *GeminiProvider) handleRegularResponse(w http.ResponseWriter, resp *http.Response, model string, completion *legacyCompletion) error {
 	// Read Gemini response
 	responseBody, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return fmt.Errorf("failed to read Gemini response: %w", err)
 	}
 
-	// Convert to OpenAI format
-	openaiResponse := p.convertFromGeminiFormat(responseBody, model)
+	// Convert to OpenAI format; errors are passed on as Gemini wrote them,
+	// the router rewriting them as OpenAI's
+	openaiResponse := responseBody
+	if resp.StatusCode < 400 {
+		openaiResponse = completion.response(p.convertFromGeminiFormat(responseBody, model))
+	}
 
 	// Copy response headers
 	for name, values := range resp.Header {
@@ -227,6 +416,7 @@ func (p *GeminiProvider) handleRegularResponse(w http.ResponseWriter, resp *http
 			w.Header().Add(name, value)
 		}
 	}
+	w.Header().Del("Content-Length") // the converted body's length differs
 
 	// Set content type
 	w.Header().Set("Content-Type", "application/json")
@@ -236,7 +426,11 @@ func (p *GeminiProvider) handleRegularResponse(w http.ResponseWriter, resp *http
 	return err
 }
 
-func (p *GeminiProvider) handleStreamingResponse(w http.ResponseWriter, resp *http.Response, model string) error {
+func (p *GeminiProvider) handleStreamingResponse(w http.ResponseWriter, resp *http.Response, model string, completion *legacyCompletion) error {
+	if resp.StatusCode >= 400 {
+		return p.handleRegularResponse(w, resp, model, completion)
+	}
+
 	// For streaming, we need to parse each chunk and convert format
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
@@ -251,7 +445,7 @@ func (p *GeminiProvider) handleStreamingResponse(w http.ResponseWriter, resp *ht
 	}
 
 	// Convert and write as SSE format
-	openaiResponse := p.convertFromGeminiFormat(responseBody, model)
+	openaiResponse := completion.response(p.convertFromGeminiFormat(responseBody, model))
 	
 	// Write as server-sent event
 	fmt.Fprintf(w, "data: %s\n\n", string(openaiResponse))
@@ -275,22 +469,36 @@ func (p *GeminiProvider) convertFromGeminiFormat(geminiResponse []byte, model st
 		return body
 	}
 
-	// Convert to OpenAI format
+	// Convert to OpenAI format, a choice per candidate
+	candidates := geminiCandidates(geminiData)
+	if len(candidates) == 0 {
+		candidates = []map[string]interface{}{{}} // blocked prompts have none
+	}
+	choices := make([]map[string]interface{}, 0, len(candidates))
+	for i, candidate := range candidates {
+		message := map[string]interface{}{
+			"role":    "assistant",
+			"content": p.extractGeminiContent(candidate),
+		}
+		toolCalls := extractGeminiToolCalls(candidate)
+		if len(toolCalls) > 0 {
+			message["tool_calls"] = toolCalls
+			if message["content"] == "" {
+				message["content"] = nil
+			}
+		}
+		choices = append(choices, map[string]interface{}{
+			"index":         i,
+			"message":       message,
+			"finish_reason": geminiFinishReason(candidate, len(toolCalls) > 0),
+		})
+	}
 	openaiResponse := map[string]interface{}{
 		"id":      fmt.Sprintf("chatcmpl-%d", time.Now().Unix()),
 		"object":  "chat.completion",
 		"created": time.Now().Unix(),
 		"model":   model,
-		"choices": []map[string]interface{}{
-			{
-				"index": 0,
-				"message": map[string]interface{}{
-					"role":    "assistant",
-					"content": p.extractGeminiContent(geminiData),
-				},
-				"finish_reason": "stop",
-			},
-		},
+		"choices": choices,
 	}
 
 	// Add usage information if available
@@ -302,6 +510,12 @@ func (p *GeminiProvider) convertFromGeminiFormat(geminiResponse []byte, model st
 		if completionTokens, ok := usageMetadata["candidatesTokenCount"]; ok {
 			usage["completion_tokens"] = completionTokens
 		}
+		// Thoughts are billed as output but reported apart from candidates
+		if thoughts, ok := usageMetadata["thoughtsTokenCount"].(float64); ok && thoughts > 0 {
+			candidates, _ := usageMetadata["candidatesTokenCount"].(float64)
+			usage["completion_tokens"] = candidates + thoughts
+			usage["completion_tokens_details"] = map[string]interface{}{"reasoning_tokens": thoughts}
+		}
 		if totalTokens, ok := usageMetadata["totalTokenCount"]; ok {
 			usage["total_tokens"] = totalTokens
 		}
@@ -314,21 +528,15 @@ func (p *GeminiProvider) convertFromGeminiFormat(geminiResponse []byte, model st
 	return body
 }
 
-func (p *GeminiProvider) extractGeminiContent(geminiData map[string]interface{}) string {
-	if candidates, ok := geminiData["candidates"].([]interface{}); ok && len(candidates) > 0 {
-		if candidate, ok := candidates[0].(map[string]interface{}); ok {
-			if content, ok := candidate["content"].(map[string]interface{}); ok {
-				if parts, ok := content["parts"].([]interface{}); ok && len(parts) > 0 {
-					if part, ok := parts[0].(map[string]interface{}); ok {
-						if text, ok := part["text"].(string); ok {
-							return text
-						}
-					}
-				}
-			}
+// extractGeminiContent joins a candidate's text parts
+func (p *GeminiProvider) extractGeminiContent(candidate map[string]interface{}) string {
+	var text string
+	for _, part := range geminiParts(candidate) {
+		if s, ok := part["text"].(string); ok {
+			text += s
 		}
 	}
-	return ""
+	return text
 }
 
 func (p *GeminiProvider) CalculateCost(inputTokens, outputTokens int) float64 {
@@ -337,10 +545,11 @@ func (p *GeminiProvider) CalculateCost(inputTokens, outputTokens int) float64 {
 		model = "gemini-pro" // fallback
 	}
 
-	pricing, exists := p.pricing[model]
+	table := p.GetModelPricing()
+	pricing, exists := table[model]
 	if !exists {
 		// Use gemini-pro pricing as default
-		pricing = p.pricing["gemini-pro"]
+		pricing = table["gemini-pro"]
 	}
 
 	inputCost := float64(inputTokens) * pricing.InputPricePer1K / 1000.0
@@ -350,5 +559,5 @@ func (p *GeminiProvider) CalculateCost(inputTokens, outputTokens int) float64 {
 }
 
 func (p *GeminiProvider) GetModelPricing() map[string]ModelPricing {
-	return p.pricing
+	return WithOverrides(p.config.Name, p.pricing)
 }
@@ -0,0 +1,150 @@
+package providers
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"strings"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/tokenizer"
+)
+
+// geminiEmbeddingModel embeds requests naming a model that isn't one of
+// Gemini's embedding models, such as OpenAI's text-embedding-3-small
+const geminiEmbeddingModel = "text-embedding-004"
+
+// maxGeminiEmbeddingInputs is the most texts batchEmbedContents takes
+const maxGeminiEmbeddingInputs = 100
+
+// isEmbeddings reports whether endpoint is /v1/embeddings
+func isEmbeddings(endpoint string) bool {
+	return strings.HasSuffix(endpoint, "/embeddings")
+}
+
+// embeddingInputs returns an embeddings request's input, a string or a
+// list of them, as a list. Token arrays aren't texts and fail it.
+func embeddingInputs(requestData map[string]interface{}) ([]string, bool) {
+	switch input := requestData["input"].(type) {
+	case string:
+		return []string{input}, true
+	case []interface{}:
+		texts := make([]string, 0, len(input))
+		for _, item := range input {
+			text, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			texts = append(texts, text)
+		}
+		return texts, len(texts) > 0
+	}
+	return nil, false
+}
+
+// unsupportedEmbeddings returns the embeddings parameter Gemini can't
+// honor: an input of tokens or of more texts than one batch takes, or an
+// encoding_format other than float and base64
+func unsupportedEmbeddings(requestData map[string]interface{}) string {
+	if _, ok := requestData["input"]; ok {
+		if inputs, ok := embeddingInputs(requestData); !ok || len(inputs) > maxGeminiEmbeddingInputs {
+			return "input"
+		}
+	}
+	if format, ok := requestData["encoding_format"].(string); ok && format != "float" && format != "base64" {
+		return "encoding_format"
+	}
+	return ""
+}
+
+// geminiEmbeddingModelFor returns the Gemini model to embed with: the one
+// requested if it's an embedding model and not OpenAI's
+func geminiEmbeddingModelFor(requestData map[string]interface{}) string {
+	model, _ := requestData["model"].(string)
+	openAI := strings.HasPrefix(model, "text-embedding-3") || model == "text-embedding-ada-002"
+	if !strings.Contains(model, "embedding") || openAI {
+		return geminiEmbeddingModel
+	}
+	return model
+}
+
+// convertToGeminiEmbeddings converts an embeddings request to an
+// embedContent one, or batchEmbedContents for several texts, returning the
+// body and the method to call
+func convertToGeminiEmbeddings(requestData map[string]interface{}, model string, inputs []string) ([]byte, string) {
+	embedRequest := func(text string) map[string]interface{} {
+		request := map[string]interface{}{
+			"model":   "models/" + model,
+			"content": map[string]interface{}{"parts": []interface{}{map[string]interface{}{"text": text}}},
+		}
+		if dimensions, ok := requestData["dimensions"].(float64); ok && dimensions > 0 {
+			request["outputDimensionality"] = int(dimensions)
+		}
+		return request
+	}
+
+	if len(inputs) == 1 {
+		body, _ := json.Marshal(embedRequest(inputs[0]))
+		return body, "embedContent"
+	}
+	requests := make([]interface{}, 0, len(inputs))
+	for _, text := range inputs {
+		requests = append(requests, embedRequest(text))
+	}
+	body, _ := json.Marshal(map[string]interface{}{"requests": requests})
+	return body, "batchEmbedContents"
+}
+
+// convertFromGeminiEmbeddings converts an embedContent or
+// batchEmbedContents response to OpenAI's embeddings list. Gemini doesn't
+// report usage, so the inputs are counted.
+func convertFromGeminiEmbeddings(geminiResponse []byte, model string, inputs []string, encodeBase64 bool) []byte {
+	var response struct {
+		Embedding  *struct{ Values []float64 }  `json:"embedding"`
+		Embeddings []struct{ Values []float64 } `json:"embeddings"`
+	}
+	if err := json.Unmarshal(geminiResponse, &response); err != nil {
+		return geminiResponse
+	}
+	if response.Embedding != nil {
+		response.Embeddings = append(response.Embeddings, *response.Embedding)
+	}
+
+	data := make([]interface{}, 0, len(response.Embeddings))
+	for i, embedding := range response.Embeddings {
+		var vector interface{} = embedding.Values
+		if encodeBase64 {
+			vector = encodeEmbedding(embedding.Values)
+		}
+		data = append(data, map[string]interface{}{
+			"object":    "embedding",
+			"index":     i,
+			"embedding": vector,
+		})
+	}
+	tokens := 0
+	for _, text := range inputs {
+		tokens += tokenizer.Count(model, text)
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"object": "list",
+		"data":   data,
+		"model":  model,
+		"usage": map[string]int{
+			"prompt_tokens": tokens,
+			"total_tokens":  tokens,
+		},
+	})
+	return body
+}
+
+// encodeEmbedding encodes a vector as OpenAI's base64 encoding_format does:
+// little-endian float32s
+func encodeEmbedding(values []float64) string {
+	raw := make([]byte, 4*len(values))
+	for i, value := range values {
+		binary.LittleEndian.PutUint32(raw[4*i:], math.Float32bits(float32(value)))
+	}
+	return base64.StdEncoding.EncodeToString(raw)
+}
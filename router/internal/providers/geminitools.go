@@ -0,0 +1,238 @@
+package providers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// geminiUnsupportedSchemaKeys are JSON Schema keywords Gemini's OpenAPI
+// subset rejects; clients routinely send them
+var geminiUnsupportedSchemaKeys = []string{"additionalProperties", "$schema", "strict"}
+
+// convertToolsToGemini turns OpenAI function tools into one Gemini tool of
+// functionDeclarations, or nil when none are functions
+func convertToolsToGemini(tools []interface{}) []interface{} {
+	var declarations []interface{}
+	for _, tool := range tools {
+		item, _ := tool.(map[string]interface{})
+		function, ok := item["function"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		declaration := map[string]interface{}{"name": function["name"]}
+		if description, ok := function["description"].(string); ok && description != "" {
+			declaration["description"] = description
+		}
+		// Gemini rejects an object schema without properties
+		if schema, ok := geminiSchema(function["parameters"]).(map[string]interface{}); ok && !emptyObjectSchema(schema) {
+			declaration["parameters"] = schema
+		}
+		declarations = append(declarations, declaration)
+	}
+	if len(declarations) == 0 {
+		return nil
+	}
+	return []interface{}{map[string]interface{}{"functionDeclarations": declarations}}
+}
+
+// geminiSchema copies a JSON schema without the keywords Gemini rejects
+func geminiSchema(schema interface{}) interface{} {
+	switch value := schema.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(value))
+		for key, item := range value {
+			copied[key] = geminiSchema(item)
+		}
+		for _, key := range geminiUnsupportedSchemaKeys {
+			delete(copied, key)
+		}
+		// Property names aren't keywords, whatever they're called
+		if properties, ok := value["properties"].(map[string]interface{}); ok {
+			named := make(map[string]interface{}, len(properties))
+			for name, property := range properties {
+				named[name] = geminiSchema(property)
+			}
+			copied["properties"] = named
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(value))
+		for i, item := range value {
+			copied[i] = geminiSchema(item)
+		}
+		return copied
+	}
+	return schema
+}
+
+func emptyObjectSchema(schema map[string]interface{}) bool {
+	properties, _ := schema["properties"].(map[string]interface{})
+	return schema["type"] == "object" && len(properties) == 0
+}
+
+// convertToolChoiceToGemini maps tool_choice onto Gemini's toolConfig, or
+// returns nil to leave Gemini's default (AUTO)
+func convertToolChoiceToGemini(toolChoice interface{}) map[string]interface{} {
+	config := map[string]interface{}{}
+	switch value := toolChoice.(type) {
+	case string:
+		switch value {
+		case "auto":
+			config["mode"] = "AUTO"
+		case "required":
+			config["mode"] = "ANY"
+		case "none":
+			config["mode"] = "NONE"
+		default:
+			return nil
+		}
+	case map[string]interface{}:
+		function, ok := value["function"].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		config["mode"] = "ANY"
+		config["allowedFunctionNames"] = []interface{}{function["name"]}
+	default:
+		return nil
+	}
+	return map[string]interface{}{"functionCallingConfig": config}
+}
+
+// functionCallParts turns an assistant's OpenAI tool_calls into Gemini
+// functionCall parts, recording each call's name under its id so the
+// results can name the function as Gemini requires
+func functionCallParts(calls []interface{}, names map[string]interface{}) []map[string]interface{} {
+	parts := make([]map[string]interface{}, 0, len(calls))
+	for _, raw := range calls {
+		call, _ := raw.(map[string]interface{})
+		function, _ := call["function"].(map[string]interface{})
+		args := map[string]interface{}{}
+		if arguments, ok := function["arguments"].(string); ok && arguments != "" {
+			json.Unmarshal([]byte(arguments), &args)
+		}
+		if args == nil {
+			args = map[string]interface{}{} // arguments were "null"
+		}
+		if id, ok := call["id"].(string); ok {
+			names[id] = function["name"]
+		}
+		parts = append(parts, map[string]interface{}{
+			"functionCall": map[string]interface{}{"name": function["name"], "args": args},
+		})
+	}
+	return parts
+}
+
+// functionResponsePart turns a tool message into a Gemini functionResponse
+// part. Gemini wants the response as an object, so results that aren't a
+// JSON object are wrapped in one.
+func functionResponsePart(message map[string]interface{}, names map[string]interface{}) map[string]interface{} {
+	var response map[string]interface{}
+	content := textContent(message["content"])
+	if json.Unmarshal([]byte(content), &response) != nil || response == nil {
+		response = map[string]interface{}{"content": content}
+	}
+	id, _ := message["tool_call_id"].(string)
+	name, ok := names[id]
+	if !ok {
+		name = message["name"] // legacy function messages carry the name
+	}
+	return map[string]interface{}{
+		"functionResponse": map[string]interface{}{"name": name, "response": response},
+	}
+}
+
+// extractGeminiToolCalls returns a candidate's functionCall parts as
+// OpenAI tool_calls. Gemini doesn't identify calls, so ids are made up
+// from their position.
+func extractGeminiToolCalls(candidate map[string]interface{}) []map[string]interface{} {
+	var calls []map[string]interface{}
+	for _, part := range geminiParts(candidate) {
+		call, ok := part["functionCall"].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		args := call["args"]
+		if args == nil {
+			args = map[string]interface{}{}
+		}
+		arguments, _ := json.Marshal(args)
+		calls = append(calls, map[string]interface{}{
+			"id":   fmt.Sprintf("call_%d", len(calls)),
+			"type": "function",
+			"function": map[string]interface{}{
+				"name":      call["name"],
+				"arguments": string(arguments),
+			},
+		})
+	}
+	return calls
+}
+
+// geminiCandidates returns a response's candidates
+func geminiCandidates(geminiData map[string]interface{}) []map[string]interface{} {
+	raw, _ := geminiData["candidates"].([]interface{})
+	candidates := make([]map[string]interface{}, 0, len(raw))
+	for _, item := range raw {
+		if candidate, ok := item.(map[string]interface{}); ok {
+			candidates = append(candidates, candidate)
+		}
+	}
+	return candidates
+}
+
+// geminiParts returns a candidate's content parts
+func geminiParts(candidate map[string]interface{}) []map[string]interface{} {
+	content, _ := candidate["content"].(map[string]interface{})
+	raw, _ := content["parts"].([]interface{})
+	parts := make([]map[string]interface{}, 0, len(raw))
+	for _, item := range raw {
+		if part, ok := item.(map[string]interface{}); ok {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// geminiFinishReason maps a candidate's finishReason onto OpenAI's
+// finish_reason; Gemini reports STOP for function calls too
+func geminiFinishReason(candidate map[string]interface{}, toolCalls bool) string {
+	if toolCalls {
+		return "tool_calls"
+	}
+	if candidate["finishReason"] == "MAX_TOKENS" {
+		return "length"
+	}
+	return "stop"
+}
+
+// geminiLegacyModels predate systemInstruction
+var geminiLegacyModels = []string{"gemini-pro", "gemini-1.0"}
+
+// setGeminiSystemPrompt gives Gemini the system prompt as systemInstruction,
+// or on models too old for it, ahead of the first user turn
+func setGeminiSystemPrompt(geminiRequest map[string]interface{}, model, system string) {
+	legacy := false
+	for _, prefix := range geminiLegacyModels {
+		legacy = legacy || strings.HasPrefix(model, prefix)
+	}
+	if !legacy {
+		geminiRequest["systemInstruction"] = map[string]interface{}{
+			"parts": []map[string]interface{}{{"text": system}},
+		}
+		return
+	}
+
+	contents, _ := geminiRequest["contents"].([]map[string]interface{})
+	instruction := map[string]interface{}{"text": system}
+	for _, content := range contents {
+		if content["role"] == "user" {
+			parts, _ := content["parts"].([]map[string]interface{})
+			content["parts"] = append([]map[string]interface{}{instruction}, parts...)
+			return
+		}
+	}
+	geminiRequest["contents"] = append([]map[string]interface{}{{"role": "user", "parts": []map[string]interface{}{instruction}}}, contents...)
+}
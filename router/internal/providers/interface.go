@@ -3,6 +3,10 @@ package providers
 import (
 	"context"
 	"net/http"
+	"sync"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/httpcache"
 )
 
 // Provider represents an external LLM provider
@@ -23,24 +27,71 @@ type Provider interface {
 	GetModelPricing() map[string]ModelPricing
 }
 
+// CatalogCacher is implemented by providers whose model or pricing catalog
+// lookups can go through the shared, disk-backed catalog cache
+type CatalogCacher interface {
+	SetCatalogCache(cache *httpcache.Cache)
+}
+
+// ModelLister is implemented by providers that can discover their models at runtime
+type ModelLister interface {
+	// ListModels returns the identifiers of models currently available
+	ListModels(ctx context.Context) ([]string, error)
+}
+
+// DefaultModeler is implemented by providers that fill in a model when the
+// request names none
+type DefaultModeler interface {
+	DefaultModel() string
+}
+
+// EndpointSupporter is implemented by providers that serve only some of
+// the OpenAI endpoints, such as Claude, which has no embeddings API.
+// Providers that don't implement it are sent every endpoint.
+type EndpointSupporter interface {
+	SupportsEndpoint(endpoint string) bool
+}
+
+// MessagesForwarder is implemented by providers that speak Anthropic's
+// Messages API, such as Claude, so requests made in it can be forwarded as
+// they were written instead of converted to a chat completion and back.
+// The response is the provider's own, in the Messages API's format.
+type MessagesForwarder interface {
+	ForwardMessages(ctx context.Context, w http.ResponseWriter, r *http.Request) error
+}
+
 // ModelPricing represents pricing information for a model
 type ModelPricing struct {
-	InputPricePer1K  float64 // Price per 1K input tokens
-	OutputPricePer1K float64 // Price per 1K output tokens
-	MaxTokens        int     // Maximum tokens supported
-	ContextWindow    int     // Context window size
+	InputPricePer1K     float64   // Price per 1K input tokens
+	OutputPricePer1K    float64   // Price per 1K output tokens
+	ReasoningPricePer1K float64   // Price per 1K reasoning tokens, 0 when billed as output
+	PricePerMinute      float64   // Price per minute of audio, for transcription and speech models
+	MaxTokens           int       // Maximum tokens supported
+	ContextWindow       int       // Context window size
+	UpdatedAt           time.Time // when the price was last checked, zero for the built-in tables
 }
 
+// BuiltinPricingDate is when the built-in pricing tables were last checked
+// against the providers' published prices
+var BuiltinPricingDate = time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)
+
 // ProviderConfig represents configuration for an external provider
 type ProviderConfig struct {
 	Name         string            `yaml:"name"`
-	Type         string            `yaml:"type"` // "openai", "claude", "gemini"
+	Type         string            `yaml:"type"` // "openai", "claude", "gemini", "ollama"
 	APIKey       string            `yaml:"apiKey"`
 	BaseURL      string            `yaml:"baseURL,omitempty"`
 	DefaultModel string            `yaml:"defaultModel"`
 	Enabled      bool              `yaml:"enabled"`
 	RateLimit    RateLimitConfig   `yaml:"rateLimit"`
 	Models       map[string]string `yaml:"models,omitempty"` // endpoint mapping
+	ModelAliases map[string]string `yaml:"modelAliases,omitempty"` // requested model -> model sent to this provider
+	Shadow       bool              `yaml:"shadow,omitempty"`       // receives copies of live traffic but never serves clients
+	// FetchImageURLs lets providers that only take images inline (Gemini)
+	// download a request's image_url links. Otherwise they are only sent
+	// data: URLs, and requests linking images go to providers that fetch
+	// images themselves.
+	FetchImageURLs bool `yaml:"fetchImageURLs,omitempty"`
 }
 
 // RateLimitConfig represents rate limiting configuration
@@ -61,36 +112,59 @@ type RequestMetadata struct {
 
 // ProviderManager manages multiple external providers
 type ProviderManager struct {
+	mu        sync.RWMutex
 	providers map[string]Provider
+	cooldowns map[string]time.Time // rate-limited provider -> when it may be used again
 }
 
 // NewProviderManager creates a new provider manager
 func NewProviderManager() *ProviderManager {
 	return &ProviderManager{
 		providers: make(map[string]Provider),
+		cooldowns: make(map[string]time.Time),
 	}
 }
 
 // RegisterProvider registers a new provider
 func (pm *ProviderManager) RegisterProvider(provider Provider) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
 	pm.providers[provider.Name()] = provider
 }
 
+// UnregisterProvider removes a provider, reporting whether it was registered
+func (pm *ProviderManager) UnregisterProvider(name string) bool {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+	_, exists := pm.providers[name]
+	delete(pm.providers, name)
+	return exists
+}
+
 // GetProvider returns a provider by name
 func (pm *ProviderManager) GetProvider(name string) (Provider, bool) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 	provider, exists := pm.providers[name]
 	return provider, exists
 }
 
-// GetAllProviders returns all registered providers
+// GetAllProviders returns all registered providers. Providers can be
+// registered at runtime, so the map is a copy.
 func (pm *ProviderManager) GetAllProviders() map[string]Provider {
-	return pm.providers
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+	all := make(map[string]Provider, len(pm.providers))
+	for name, provider := range pm.providers {
+		all[name] = provider
+	}
+	return all
 }
 
 // GetHealthyProviders returns only healthy providers
 func (pm *ProviderManager) GetHealthyProviders(ctx context.Context) map[string]Provider {
 	healthy := make(map[string]Provider)
-	for name, provider := range pm.providers {
+	for name, provider := range pm.GetAllProviders() {
 		if err := provider.Health(ctx); err == nil {
 			healthy[name] = provider
 		}
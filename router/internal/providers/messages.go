@@ -0,0 +1,40 @@
+package providers
+
+import "strings"
+
+// textContent returns message content as text, joining text parts
+func textContent(content interface{}) string {
+	switch value := content.(type) {
+	case string:
+		return value
+	case []interface{}:
+		var text string
+		for _, raw := range value {
+			if part, ok := raw.(map[string]interface{}); ok {
+				if s, ok := part["text"].(string); ok {
+					text += s
+				}
+			}
+		}
+		return text
+	}
+	return ""
+}
+
+// splitSystemPrompt lifts system (and developer) messages out of an OpenAI
+// conversation, for providers taking the system prompt apart from it
+func splitSystemPrompt(messages []interface{}) (string, []interface{}) {
+	var system []string
+	rest := make([]interface{}, 0, len(messages))
+	for _, raw := range messages {
+		message, _ := raw.(map[string]interface{})
+		if role := message["role"]; role == "system" || role == "developer" {
+			if text := textContent(message["content"]); text != "" {
+				system = append(system, text)
+			}
+			continue
+		}
+		rest = append(rest, raw)
+	}
+	return strings.Join(system, "\n\n"), rest
+}
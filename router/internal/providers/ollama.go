@@ -0,0 +1,399 @@
+package providers
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/engine"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/httpcache"
+	"github.com/sirupsen/logrus"
+)
+
+// OllamaProvider implements the Provider interface for self-hosted Ollama nodes
+type OllamaProvider struct {
+	config     ProviderConfig
+	httpClient *http.Client
+
+	mu      sync.RWMutex
+	pricing map[string]ModelPricing
+
+	catalogCache *httpcache.Cache
+}
+
+// NewOllamaProvider creates a new Ollama provider
+func NewOllamaProvider(config ProviderConfig) *OllamaProvider {
+	baseURL := config.BaseURL
+	if baseURL == "" {
+		baseURL = "http://localhost:11434"
+	}
+
+	provider := &OllamaProvider{
+		config: config,
+		httpClient: &http.Client{
+			Timeout: 300 * time.Second, // CPU-only home-lab nodes can be slow
+		},
+		pricing: map[string]ModelPricing{},
+	}
+
+	// Seed the default model so the provider is routable before discovery runs
+	if config.DefaultModel != "" {
+		provider.pricing[config.DefaultModel] = ModelPricing{}
+	}
+
+	// Override base URL in config
+	provider.config.BaseURL = strings.TrimSuffix(baseURL, "/")
+	return provider
+}
+
+func (p *OllamaProvider) Name() string {
+	return p.config.Name
+}
+
+func (p *OllamaProvider) SetCatalogCache(cache *httpcache.Cache) {
+	p.catalogCache = cache
+}
+
+func (p *OllamaProvider) Health(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.config.BaseURL+"/api/version", nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("Ollama health check failed with status %d", resp.StatusCode)
+	}
+
+	// Refresh discovered models alongside the health check
+	_, err = p.ListModels(ctx)
+	return err
+}
+
+// ListModels queries the node for locally pulled models and refreshes the pricing map
+func (p *OllamaProvider) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", p.config.BaseURL+"/api/tags", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.catalogCache.Get(p.httpClient, req)
+	if err != nil {
+		return nil, fmt.Errorf("Ollama model listing failed: %w", err)
+	}
+
+	models, err := engine.ParseModels(engine.FormatOllama, bytes.NewReader(resp.Body))
+	if err != nil {
+		return nil, err
+	}
+
+	// Local models are free to run; only the node's hardware costs money
+	pricing := make(map[string]ModelPricing, len(models))
+	for _, model := range models {
+		pricing[model] = ModelPricing{}
+	}
+
+	p.mu.Lock()
+	p.pricing = pricing
+	p.mu.Unlock()
+
+	return models, nil
+}
+
+func (p *OllamaProvider) Forward(ctx context.Context, w http.ResponseWriter, r *http.Request, endpoint string) error {
+	// Read request body
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+	defer r.Body.Close()
+
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		return fmt.Errorf("failed to parse request JSON: %w", err)
+	}
+
+	var ollamaPath string
+	var chat bool
+	switch {
+	case strings.HasSuffix(endpoint, "/chat/completions"):
+		ollamaPath, chat = "/api/chat", true
+	case strings.HasSuffix(endpoint, "/completions"):
+		ollamaPath = "/api/generate"
+	default:
+		http.Error(w, fmt.Sprintf("Endpoint %s not supported by Ollama provider", endpoint), http.StatusNotFound)
+		return fmt.Errorf("unsupported endpoint for Ollama: %s", endpoint)
+	}
+
+	ollamaBody, model, stream := p.convertToOllamaFormat(requestData, chat)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", p.config.BaseURL+ollamaPath, bytes.NewReader(ollamaBody))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if requestID := r.Header.Get("X-Request-ID"); requestID != "" {
+		req.Header.Set("X-Request-ID", requestID)
+	}
+
+	resp, err := p.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to forward to Ollama: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		// Pass upstream errors (e.g. model not pulled) through untouched
+		responseBody, _ := io.ReadAll(resp.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.StatusCode)
+		_, err = w.Write(responseBody)
+		return err
+	}
+
+	if stream {
+		return p.handleStreamingResponse(w, resp, model, chat)
+	}
+	return p.handleRegularResponse(w, resp, model, chat)
+}
+
+func (p *OllamaProvider) convertToOllamaFormat(requestData map[string]interface{}, chat bool) ([]byte, string, bool) {
+	model := p.config.DefaultModel
+	if m, ok := requestData["model"].(string); ok && m != "" {
+		model = m
+	}
+
+	stream, _ := requestData["stream"].(bool)
+
+	ollamaRequest := map[string]interface{}{
+		"model":  model,
+		"stream": stream,
+	}
+
+	if chat {
+		if messages, ok := requestData["messages"]; ok {
+			ollamaRequest["messages"] = messages
+		}
+	} else if prompt, ok := requestData["prompt"]; ok {
+		ollamaRequest["prompt"] = prompt
+	}
+
+	// Sampling parameters live under "options" in Ollama
+	options := make(map[string]interface{})
+	if temp, ok := requestData["temperature"]; ok {
+		options["temperature"] = temp
+	}
+	if topP, ok := requestData["top_p"]; ok {
+		options["top_p"] = topP
+	}
+	if maxTokens, ok := requestData["max_tokens"]; ok {
+		options["num_predict"] = maxTokens
+	}
+	if stop, ok := requestData["stop"]; ok {
+		options["stop"] = stop
+	}
+	if seed, ok := requestData["seed"]; ok {
+		options["seed"] = seed
+	}
+	if len(options) > 0 {
+		ollamaRequest["options"] = options
+	}
+
+	body, _ := json.Marshal(ollamaRequest)
+	return body, model, stream
+}
+
+// ollamaResponse covers both /api/chat and /api/generate replies and stream chunks
+type ollamaResponse struct {
+	Model   string `json:"model"`
+	Message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"message"`
+	Response        string `json:"response"`
+	Done            bool   `json:"done"`
+	DoneReason      string `json:"done_reason"`
+	PromptEvalCount int    `json:"prompt_eval_count"`
+	EvalCount       int    `json:"eval_count"`
+}
+
+func (o *ollamaResponse) text() string {
+	if o.Message.Content != "" {
+		return o.Message.Content
+	}
+	return o.Response
+}
+
+func (o *ollamaResponse) finishReason() string {
+	if o.DoneReason == "length" {
+		return "length"
+	}
+	return "stop"
+}
+
+func (o *ollamaResponse) usage() map[string]interface{} {
+	return map[string]interface{}{
+		"prompt_tokens":     o.PromptEvalCount,
+		"completion_tokens": o.EvalCount,
+		"total_tokens":      o.PromptEvalCount + o.EvalCount,
+	}
+}
+
+// SupportsEndpoint implements EndpointSupporter: Forward converts chat and
+// legacy completions to Ollama's API, and nothing else
+func (p *OllamaProvider) SupportsEndpoint(endpoint string) bool {
+	return strings.HasSuffix(endpoint, "/completions")
+}
+
+// UnsupportedParameter implements ParameterChecker. Ollama answers with
+// one choice only.
+func (p *OllamaProvider) UnsupportedParameter(requestData map[string]interface{}) string {
+	if param := unsupportedChoices(requestData, 1); param != "" {
+		return param
+	}
+	return unsupportedParameter(requestData, ollamaUnsupportedParameters)
+}
+
+func (p *OllamaProvider) handleRegularResponse(w http.ResponseWriter, resp *http.Response, model string, chat bool) error {
+	var ollamaData ollamaResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ollamaData); err != nil {
+		return fmt.Errorf("failed to read Ollama response: %w", err)
+	}
+
+	id := fmt.Sprintf("chatcmpl-%d", time.Now().Unix())
+	var openaiResponse map[string]interface{}
+	if chat {
+		openaiResponse = map[string]interface{}{
+			"id":      id,
+			"object":  "chat.completion",
+			"created": time.Now().Unix(),
+			"model":   model,
+			"choices": []map[string]interface{}{
+				{
+					"index": 0,
+					"message": map[string]interface{}{
+						"role":    "assistant",
+						"content": ollamaData.text(),
+					},
+					"finish_reason": ollamaData.finishReason(),
+				},
+			},
+			"usage": ollamaData.usage(),
+		}
+	} else {
+		openaiResponse = map[string]interface{}{
+			"id":      fmt.Sprintf("cmpl-%d", time.Now().Unix()),
+			"object":  "text_completion",
+			"created": time.Now().Unix(),
+			"model":   model,
+			"choices": []map[string]interface{}{
+				{
+					"index":         0,
+					"text":          ollamaData.text(),
+					"finish_reason": ollamaData.finishReason(),
+				},
+			},
+			"usage": ollamaData.usage(),
+		}
+	}
+
+	body, _ := json.Marshal(openaiResponse)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, err := w.Write(body)
+	return err
+}
+
+func (p *OllamaProvider) handleStreamingResponse(w http.ResponseWriter, resp *http.Response, model string, chat bool) error {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	flusher, _ := w.(http.Flusher)
+	id := fmt.Sprintf("chatcmpl-%d", time.Now().Unix())
+	object := "chat.completion.chunk"
+	if !chat {
+		object = "text_completion"
+	}
+
+	// Ollama streams newline-delimited JSON objects
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		var chunk ollamaResponse
+		if err := json.Unmarshal(line, &chunk); err != nil {
+			logrus.Warnf("Skipping malformed Ollama stream chunk: %v", err)
+			continue
+		}
+
+		choice := map[string]interface{}{"index": 0, "finish_reason": nil}
+		if chat {
+			choice["delta"] = map[string]interface{}{"content": chunk.text()}
+		} else {
+			choice["text"] = chunk.text()
+		}
+
+		openaiChunk := map[string]interface{}{
+			"id":      id,
+			"object":  object,
+			"created": time.Now().Unix(),
+			"model":   model,
+			"choices": []map[string]interface{}{choice},
+		}
+		if chunk.Done {
+			choice["finish_reason"] = chunk.finishReason()
+			openaiChunk["usage"] = chunk.usage()
+		}
+
+		data, _ := json.Marshal(openaiChunk)
+		if _, err := fmt.Fprintf(w, "data: %s\n\n", data); err != nil {
+			return err
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read Ollama stream: %w", err)
+	}
+
+	fmt.Fprintf(w, "data: [DONE]\n\n")
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return nil
+}
+
+func (p *OllamaProvider) CalculateCost(inputTokens, outputTokens int) float64 {
+	// Self-hosted inference has no per-token charge
+	return 0
+}
+
+func (p *OllamaProvider) GetModelPricing() map[string]ModelPricing {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	pricing := make(map[string]ModelPricing, len(p.pricing))
+	for model, modelPricing := range p.pricing {
+		pricing[model] = modelPricing
+	}
+	return WithOverrides(p.config.Name, pricing)
+}
@@ -10,6 +10,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/tokenizer"
 	"github.com/sirupsen/logrus"
 )
 
@@ -57,6 +58,32 @@ func NewOpenAIProvider(config ProviderConfig) *OpenAIProvider {
 				MaxTokens:        16384,
 				ContextWindow:    16385,
 			},
+			"o1": {
+				InputPricePer1K:  0.015,
+				OutputPricePer1K: 0.06,
+				MaxTokens:        100000,
+				ContextWindow:    200000,
+			},
+			"o1-mini": {
+				InputPricePer1K:  0.0011,
+				OutputPricePer1K: 0.0044,
+				MaxTokens:        65536,
+				ContextWindow:    128000,
+			},
+			"o3-mini": {
+				InputPricePer1K:  0.0011,
+				OutputPricePer1K: 0.0044,
+				MaxTokens:        100000,
+				ContextWindow:    200000,
+			},
+			// Audio models are priced by the minute. Speech is billed by
+			// the character; its prices assume 900 characters a minute.
+			"whisper-1":              {PricePerMinute: 0.006},
+			"gpt-4o-transcribe":      {PricePerMinute: 0.006},
+			"gpt-4o-mini-transcribe": {PricePerMinute: 0.003},
+			"tts-1":                  {PricePerMinute: 0.0135}, // $15 per 1M characters
+			"tts-1-hd":               {PricePerMinute: 0.027},  // $30 per 1M characters
+			"gpt-4o-mini-tts":        {PricePerMinute: 0.015},
 		},
 	}
 
@@ -69,6 +96,11 @@ func (p *OpenAIProvider) Name() string {
 	return p.config.Name
 }
 
+// DefaultModel is the model sent when the request names none
+func (p *OpenAIProvider) DefaultModel() string {
+	return p.config.DefaultModel
+}
+
 func (p *OpenAIProvider) Health(ctx context.Context) error {
 	req, err := http.NewRequestWithContext(ctx, "GET", p.config.BaseURL+"/v1/models", nil)
 	if err != nil {
@@ -99,14 +131,25 @@ func (p *OpenAIProvider) Forward(ctx context.Context, w http.ResponseWriter, r *
 	}
 	defer r.Body.Close()
 
-	// Parse the request to potentially modify model selection
+	// Parse the request to potentially modify model selection. Audio
+	// uploads are multipart forms and go as they are.
+	multipart := strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/")
 	var requestData map[string]interface{}
 	if err := json.Unmarshal(body, &requestData); err != nil {
-		logrus.Warnf("Failed to parse request JSON, forwarding as-is: %v", err)
+		if !multipart {
+			logrus.Warnf("Failed to parse request JSON, forwarding as-is: %v", err)
+		}
 	} else {
 		// Ensure model is set to default if not specified
-		if _, hasModel := requestData["model"]; !hasModel && p.config.DefaultModel != "" {
+		modified := false
+		if _, hasModel := requestData["model"]; !hasModel && p.config.DefaultModel != "" && !isAudio(endpoint) {
 			requestData["model"] = p.config.DefaultModel
+			modified = true
+		}
+		if adaptReasoningParams(requestData) {
+			modified = true
+		}
+		if modified {
 			if modifiedBody, err := json.Marshal(requestData); err == nil {
 				body = modifiedBody
 			}
@@ -139,7 +182,9 @@ func (p *OpenAIProvider) Forward(ctx context.Context, w http.ResponseWriter, r *
 	// Add OpenAI authentication
 	req.Header.Set("Authorization", "Bearer "+p.config.APIKey)
 	req.Header.Set("User-Agent", "multi-cloud-llm-router/1.0")
-	req.Header.Set("Content-Type", "application/json")
+	if !multipart {
+		req.Header.Set("Content-Type", "application/json")
+	}
 
 	// Make request
 	resp, err := p.httpClient.Do(req)
@@ -168,16 +213,62 @@ func (p *OpenAIProvider) Forward(ctx context.Context, w http.ResponseWriter, r *
 	return nil
 }
 
+// isAudio reports whether endpoint is one of the /v1/audio endpoints, whose
+// models are never the chat default
+func isAudio(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "/v1/audio/")
+}
+
+// adaptReasoningParams rewrites a request for OpenAI's reasoning models,
+// which take max_completion_tokens and reject sampling parameters, and drops
+// the reasoning parameters other models would reject. An Anthropic-style
+// thinking budget becomes the nearest reasoning_effort. It reports whether
+// requestData changed.
+func adaptReasoningParams(requestData map[string]interface{}) bool {
+	model, _ := requestData["model"].(string)
+	_, hasThinking := requestData["thinking"]
+	_, hasEffort := requestData["reasoning_effort"]
+	if !IsReasoningModel(model) {
+		delete(requestData, "thinking")
+		delete(requestData, "reasoning_effort")
+		return hasThinking || hasEffort
+	}
+
+	changed := false
+	if hasThinking {
+		if budget := reasoningBudget(requestData); budget > 0 && !hasEffort {
+			requestData["reasoning_effort"] = reasoningEffort(budget)
+		}
+		delete(requestData, "thinking")
+		changed = true
+	}
+	if maxTokens, ok := requestData["max_tokens"]; ok {
+		if _, ok := requestData["max_completion_tokens"]; !ok {
+			requestData["max_completion_tokens"] = maxTokens
+		}
+		delete(requestData, "max_tokens")
+		changed = true
+	}
+	for _, param := range []string{"temperature", "top_p", "presence_penalty", "frequency_penalty"} {
+		if _, ok := requestData[param]; ok {
+			delete(requestData, param)
+			changed = true
+		}
+	}
+	return changed
+}
+
 func (p *OpenAIProvider) CalculateCost(inputTokens, outputTokens int) float64 {
 	model := p.config.DefaultModel
 	if model == "" {
 		model = "gpt-3.5-turbo" // fallback
 	}
 
-	pricing, exists := p.pricing[model]
+	table := p.GetModelPricing()
+	pricing, exists := table[model]
 	if !exists {
 		// Use gpt-3.5-turbo pricing as default
-		pricing = p.pricing["gpt-3.5-turbo"]
+		pricing = table["gpt-3.5-turbo"]
 	}
 
 	inputCost := float64(inputTokens) * pricing.InputPricePer1K / 1000.0
@@ -187,12 +278,11 @@ func (p *OpenAIProvider) CalculateCost(inputTokens, outputTokens int) float64 {
 }
 
 func (p *OpenAIProvider) GetModelPricing() map[string]ModelPricing {
-	return p.pricing
+	return WithOverrides(p.config.Name, p.pricing)
 }
 
-// EstimateTokensFromText provides a rough estimation of tokens
-// This is a simplified estimation - in production you'd want to use tiktoken
+// EstimateTokensFromText counts text's tokens with the encoding OpenAI's
+// chat models use
 func (p *OpenAIProvider) EstimateTokensFromText(text string) int {
-	// Rough estimation: ~1 token per 4 characters for English text
-	return len(text) / 4
+	return tokenizer.Count("gpt-3.5-turbo", text)
 }
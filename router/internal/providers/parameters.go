@@ -0,0 +1,79 @@
+package providers
+
+// ParameterChecker is implemented by providers whose converters can't
+// honor every OpenAI parameter, so the router can send requests using one
+// elsewhere
+type ParameterChecker interface {
+	// UnsupportedParameter returns the first parameter the request sets
+	// that the provider can't honor, empty if there is none
+	UnsupportedParameter(requestData map[string]interface{}) string
+}
+
+// parameterDefaults are values that leave a parameter without effect, so
+// requests sending them explicitly still go anywhere
+var parameterDefaults = map[string]interface{}{
+	"presence_penalty":  0.0,
+	"frequency_penalty": 0.0,
+	"logprobs":          false,
+	"top_logprobs":      0.0,
+	"n":                 1.0,
+	"best_of":           1.0,
+}
+
+// Parameters the Claude, Gemini and Ollama APIs have no equivalent for
+var (
+	claudeUnsupportedParameters = []string{"presence_penalty", "frequency_penalty", "seed", "logit_bias", "logprobs", "top_logprobs"}
+	geminiUnsupportedParameters = []string{"logit_bias", "logprobs", "top_logprobs"}
+	ollamaUnsupportedParameters = []string{"logit_bias", "logprobs", "top_logprobs"}
+)
+
+// parameterSet reports whether a request sets name to a value with an
+// effect
+func parameterSet(requestData map[string]interface{}, name string) bool {
+	value, ok := requestData[name]
+	if !ok || value == nil {
+		return false
+	}
+	if unset, ok := parameterDefaults[name]; ok && value == unset {
+		return false
+	}
+	if object, ok := value.(map[string]interface{}); ok && len(object) == 0 {
+		return false // logit_bias: {}
+	}
+	return true
+}
+
+// unsupportedParameter returns the first of unsupported the request sets
+func unsupportedParameter(requestData map[string]interface{}, unsupported []string) string {
+	for _, name := range unsupported {
+		if parameterSet(requestData, name) {
+			return name
+		}
+	}
+	return ""
+}
+
+// maxOutputTokens returns the output limit a request sets, by
+// max_completion_tokens, which replaced max_tokens, or max_tokens
+func maxOutputTokens(requestData map[string]interface{}) (float64, bool) {
+	if tokens, ok := requestData["max_completion_tokens"].(float64); ok {
+		return tokens, true
+	}
+	tokens, ok := requestData["max_tokens"].(float64)
+	return tokens, ok
+}
+
+// stopSequences returns `stop`, a string or a list of them, as a list
+func stopSequences(requestData map[string]interface{}) []interface{} {
+	switch stop := requestData["stop"].(type) {
+	case string:
+		if stop != "" {
+			return []interface{}{stop}
+		}
+	case []interface{}:
+		if len(stop) > 0 {
+			return stop
+		}
+	}
+	return nil
+}
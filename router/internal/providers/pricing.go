@@ -0,0 +1,71 @@
+package providers
+
+import (
+	"sync"
+	"time"
+)
+
+// PriceOverride replaces parts of a model's pricing, or prices a model the
+// built-in table doesn't know. Unset fields keep the built-in value.
+type PriceOverride struct {
+	InputPricePer1K     *float64  `yaml:"input"`
+	OutputPricePer1K    *float64  `yaml:"output"`
+	ReasoningPricePer1K *float64  `yaml:"reasoning"`
+	PricePerMinute      *float64  `yaml:"perMinute"`
+	MaxTokens           int       `yaml:"maxTokens"`
+	ContextWindow       int       `yaml:"contextWindow"`
+	UpdatedAt           time.Time `yaml:"checked"` // when the price was checked
+}
+
+var (
+	overridesMu sync.RWMutex
+	overrides   = make(map[string]map[string]PriceOverride) // provider name -> model -> override
+)
+
+// SetPricingOverrides replaces the overrides applied over every provider's
+// pricing table, keyed by provider name and then model
+func SetPricingOverrides(byProvider map[string]map[string]PriceOverride) {
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	overrides = byProvider
+}
+
+// WithOverrides returns base with the overrides for provider applied,
+// leaving base untouched. Providers call it from GetModelPricing.
+func WithOverrides(provider string, base map[string]ModelPricing) map[string]ModelPricing {
+	overridesMu.RLock()
+	defer overridesMu.RUnlock()
+
+	models := overrides[provider]
+	if len(models) == 0 {
+		return base
+	}
+	pricing := make(map[string]ModelPricing, len(base)+len(models))
+	for model, modelPricing := range base {
+		pricing[model] = modelPricing
+	}
+	for model, override := range models {
+		modelPricing := pricing[model]
+		if override.InputPricePer1K != nil {
+			modelPricing.InputPricePer1K = *override.InputPricePer1K
+		}
+		if override.OutputPricePer1K != nil {
+			modelPricing.OutputPricePer1K = *override.OutputPricePer1K
+		}
+		if override.ReasoningPricePer1K != nil {
+			modelPricing.ReasoningPricePer1K = *override.ReasoningPricePer1K
+		}
+		if override.PricePerMinute != nil {
+			modelPricing.PricePerMinute = *override.PricePerMinute
+		}
+		if override.MaxTokens > 0 {
+			modelPricing.MaxTokens = override.MaxTokens
+		}
+		if override.ContextWindow > 0 {
+			modelPricing.ContextWindow = override.ContextWindow
+		}
+		modelPricing.UpdatedAt = override.UpdatedAt
+		pricing[model] = modelPricing
+	}
+	return pricing
+}
@@ -0,0 +1,63 @@
+package providers
+
+import "strings"
+
+// reasoningPrefixes are model families that think before answering
+var reasoningPrefixes = []string{
+	"o1", "o3", "o4", "gpt-5",
+	"claude-3-7-sonnet", "claude-sonnet-4", "claude-opus-4",
+	"gemini-2.5",
+	"deepseek-r1", "qwq",
+}
+
+// IsReasoningModel reports whether model is a known reasoning model
+func IsReasoningModel(model string) bool {
+	model = strings.ToLower(model)
+	if i := strings.LastIndexByte(model, '/'); i >= 0 {
+		model = model[i+1:]
+	}
+	for _, prefix := range reasoningPrefixes {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Thinking budgets standing in for OpenAI's reasoning_effort on providers
+// that take a token budget instead
+var reasoningBudgets = map[string]int{
+	"minimal": 1024,
+	"low":     2048,
+	"medium":  8192,
+	"high":    24576,
+}
+
+// reasoningBudget returns the thinking budget a request asks for, from an
+// Anthropic-style thinking block or reasoning_effort, and 0 if neither is set
+func reasoningBudget(requestData map[string]interface{}) int {
+	if thinking, ok := requestData["thinking"].(map[string]interface{}); ok {
+		if thinking["type"] == "disabled" {
+			return 0
+		}
+		if budget, ok := thinking["budget_tokens"].(float64); ok {
+			return int(budget)
+		}
+	}
+	if effort, ok := requestData["reasoning_effort"].(string); ok {
+		return reasoningBudgets[effort]
+	}
+	return 0
+}
+
+// reasoningEffort maps a thinking budget back onto the nearest effort level
+func reasoningEffort(budget int) string {
+	switch {
+	case budget <= reasoningBudgets["low"]:
+		return "low"
+	case budget <= reasoningBudgets["medium"]:
+		return "medium"
+	default:
+		return "high"
+	}
+}
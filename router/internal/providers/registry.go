@@ -0,0 +1,81 @@
+package providers
+
+import (
+	"fmt"
+	"plugin"
+	"sort"
+	"sync"
+)
+
+// Factory constructs a provider from its configuration
+type Factory func(config ProviderConfig) (Provider, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[string]Factory)
+)
+
+func init() {
+	Register("openai", func(config ProviderConfig) (Provider, error) {
+		return NewOpenAIProvider(config), nil
+	})
+	Register("claude", func(config ProviderConfig) (Provider, error) {
+		return NewClaudeProvider(config), nil
+	})
+	Register("gemini", func(config ProviderConfig) (Provider, error) {
+		return NewGeminiProvider(config), nil
+	})
+	Register("ollama", func(config ProviderConfig) (Provider, error) {
+		return NewOllamaProvider(config), nil
+	})
+}
+
+// Register makes a provider type available to New. It panics if the type is
+// registered twice, so conflicting plugins are caught at startup.
+func Register(providerType string, factory Factory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if factory == nil {
+		panic("providers: Register factory is nil for " + providerType)
+	}
+	if _, exists := registry[providerType]; exists {
+		panic("providers: Register called twice for " + providerType)
+	}
+	registry[providerType] = factory
+}
+
+// New constructs a provider using the factory registered for config.Type
+func New(config ProviderConfig) (Provider, error) {
+	registryMu.RLock()
+	factory, exists := registry[config.Type]
+	registryMu.RUnlock()
+
+	if !exists {
+		return nil, fmt.Errorf("unknown provider type: %s", config.Type)
+	}
+	return factory(config)
+}
+
+// RegisteredTypes returns the sorted list of registered provider types
+func RegisteredTypes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	types := make([]string, 0, len(registry))
+	for providerType := range registry {
+		types = append(types, providerType)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// LoadPlugin opens a Go plugin built with -buildmode=plugin against this
+// module. The plugin registers its providers from an init function by calling
+// Register. Plugins require a cgo-enabled build on Linux or macOS.
+func LoadPlugin(path string) error {
+	if _, err := plugin.Open(path); err != nil {
+		return fmt.Errorf("failed to load provider plugin %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,134 @@
+package providers
+
+import (
+	"encoding/json"
+)
+
+// responseFormat is the structured output a request's response_format
+// asks for
+type responseFormat struct {
+	Type   string                 // "json_object" or "json_schema", empty for text
+	Name   string                 // json_schema's name, if any
+	Schema map[string]interface{} // json_schema's schema, if any
+}
+
+func parseResponseFormat(requestData map[string]interface{}) responseFormat {
+	raw, _ := requestData["response_format"].(map[string]interface{})
+	format := responseFormat{}
+	switch raw["type"] {
+	case "json_object":
+		format.Type = "json_object"
+	case "json_schema":
+		format.Type = "json_schema"
+		spec, _ := raw["json_schema"].(map[string]interface{})
+		format.Name, _ = spec["name"].(string)
+		format.Schema, _ = spec["schema"].(map[string]interface{})
+	}
+	return format
+}
+
+// JSON reports whether the response is to be JSON
+func (f responseFormat) JSON() bool {
+	return f.Type != ""
+}
+
+// instruction is the prompt scaffolding standing in for JSON mode on
+// providers that can't be set to it
+func (f responseFormat) instruction() string {
+	instruction := "Respond only with a valid JSON object, without prose or code fences."
+	if f.Schema != nil {
+		schema, _ := json.Marshal(f.Schema)
+		instruction = "Respond only with a valid JSON object matching this JSON schema, without prose or code fences:\n" + string(schema)
+	}
+	return instruction
+}
+
+// claudeJSONTool names the tool a JSON schema is forced through on Claude
+// when the schema has no name of its own
+const claudeJSONTool = "json_response"
+
+// claudeOutput records how convertToClaudeFormat asked for structured
+// output, and Forward for a legacy completion, so the response can be
+// converted back
+type claudeOutput struct {
+	tool       string            // forced tool whose input is the response, see claudeJSONTool
+	prefill    string            // assistant turn the response continues
+	completion *legacyCompletion // set for /v1/completions requests
+}
+
+// applyClaudeResponseFormat asks Claude for the JSON response_format
+// wants. A schema is forced as the only tool's input, which Claude
+// validates against it; otherwise the system prompt asks for JSON and the
+// answer is begun with "{". Requests with tools or extended thinking, which
+// neither combines with, get the instruction alone.
+func applyClaudeResponseFormat(claudeRequest map[string]interface{}, format responseFormat, thinking bool) claudeOutput {
+	_, tools := claudeRequest["tools"]
+	if format.Schema != nil && !tools && !thinking {
+		name := format.Name
+		if name == "" {
+			name = claudeJSONTool
+		}
+		claudeRequest["tools"] = []interface{}{map[string]interface{}{
+			"name":         name,
+			"description":  "Respond with a JSON object matching this schema",
+			"input_schema": format.Schema,
+		}}
+		claudeRequest["tool_choice"] = map[string]interface{}{"type": "tool", "name": name}
+		return claudeOutput{tool: name}
+	}
+
+	system, _ := claudeRequest["system"].(string)
+	if system != "" {
+		system += "\n\n"
+	}
+	claudeRequest["system"] = system + format.instruction()
+
+	messages, _ := claudeRequest["messages"].([]interface{})
+	if tools || thinking || len(messages) == 0 || lastRole(messages) == "assistant" {
+		return claudeOutput{}
+	}
+	claudeRequest["messages"] = append(messages, map[string]interface{}{"role": "assistant", "content": "{"})
+	return claudeOutput{prefill: "{"}
+}
+
+func lastRole(messages []interface{}) interface{} {
+	last, _ := messages[len(messages)-1].(map[string]interface{})
+	return last["role"]
+}
+
+// apply rewrites a converted response's message as the client asked for
+// it: a forced tool's input becomes the content, and a prefill is put
+// back in front of it
+func (o claudeOutput) apply(message map[string]interface{}) {
+	if o.prefill != "" {
+		content, _ := message["content"].(string)
+		message["content"] = o.prefill + content
+	}
+	if o.tool == "" {
+		return
+	}
+	calls, _ := message["tool_calls"].([]map[string]interface{})
+	for _, call := range calls {
+		function, _ := call["function"].(map[string]interface{})
+		if function["name"] == o.tool {
+			message["content"] = function["arguments"]
+			delete(message, "tool_calls")
+			return
+		}
+	}
+}
+
+// applyGeminiResponseFormat sets Gemini's JSON mode, constrained to the
+// schema when there is one. Gemini can't combine JSON mode with function
+// calling, so for requests with tools it returns the instruction to add to
+// the system prompt instead.
+func applyGeminiResponseFormat(geminiRequest, generationConfig map[string]interface{}, format responseFormat) string {
+	if _, tools := geminiRequest["tools"]; tools {
+		return format.instruction()
+	}
+	generationConfig["responseMimeType"] = "application/json"
+	if format.Schema != nil {
+		generationConfig["responseSchema"] = geminiSchema(format.Schema)
+	}
+	return ""
+}
@@ -0,0 +1,218 @@
+package providers
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/egress"
+)
+
+// visionPrefixes are model families that accept images
+var visionPrefixes = []string{
+	"gpt-4o", "gpt-4.1", "gpt-4-turbo", "gpt-4-vision", "gpt-5", "o1", "o3", "o4",
+	"claude-3", "claude-sonnet-4", "claude-opus-4",
+	"gemini-1.5", "gemini-2", "gemini-pro-vision",
+	"llava", "bakllava", "pixtral", "gemma-3", "gemma3", "minicpm-v", "moondream",
+}
+
+// visionMarkers name vision variants of open model families wherever they
+// appear, as in llama-3.2-11b-vision-instruct or qwen2.5-vl-7b
+var visionMarkers = []string{"vision", "-vl"}
+
+// IsVisionModel reports whether model is known to accept images
+func IsVisionModel(model string) bool {
+	model = strings.ToLower(model)
+	if i := strings.LastIndexByte(model, '/'); i >= 0 {
+		model = model[i+1:]
+	}
+	for _, prefix := range visionPrefixes {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	for _, marker := range visionMarkers {
+		if strings.Contains(model, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// maxInlineImageBytes caps an image downloaded to be sent inline, the most
+// Gemini takes in one request
+const maxInlineImageBytes = 20 << 20
+
+// imageURL returns the URL of an OpenAI image_url content part
+func imageURL(part map[string]interface{}) (string, bool) {
+	if part["type"] != "image_url" {
+		return "", false
+	}
+	switch value := part["image_url"].(type) {
+	case string:
+		return value, true
+	case map[string]interface{}:
+		url, ok := value["url"].(string)
+		return url, ok
+	}
+	return "", false
+}
+
+// parseDataURL splits a base64 data URL into its media type and data
+func parseDataURL(url string) (mediaType, data string, ok bool) {
+	rest, ok := strings.CutPrefix(url, "data:")
+	if !ok {
+		return "", "", false
+	}
+	header, data, ok := strings.Cut(rest, ",")
+	if !ok {
+		return "", "", false
+	}
+	mediaType, ok = strings.CutSuffix(header, ";base64")
+	return mediaType, data, ok
+}
+
+// claudeImageBlock turns an image URL into a Claude image block; data
+// URLs are sent as base64 and others for Claude to fetch
+func claudeImageBlock(url string) map[string]interface{} {
+	if mediaType, data, ok := parseDataURL(url); ok {
+		return map[string]interface{}{
+			"type":   "image",
+			"source": map[string]interface{}{"type": "base64", "media_type": mediaType, "data": data},
+		}
+	}
+	return map[string]interface{}{
+		"type":   "image",
+		"source": map[string]interface{}{"type": "url", "url": url},
+	}
+}
+
+// claudeContentParts converts OpenAI content parts to Claude content
+// blocks. Text parts already have Claude's shape.
+func claudeContentParts(parts []interface{}) []interface{} {
+	converted := make([]interface{}, 0, len(parts))
+	for _, raw := range parts {
+		part, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if url, ok := imageURL(part); ok {
+			converted = append(converted, claudeImageBlock(url))
+			continue
+		}
+		converted = append(converted, part)
+	}
+	return converted
+}
+
+// geminiContentParts converts OpenAI content parts to Gemini parts.
+// Images must already be data URLs, see inlineImageURLs.
+func geminiContentParts(parts []interface{}) []map[string]interface{} {
+	converted := make([]map[string]interface{}, 0, len(parts))
+	for _, raw := range parts {
+		part, ok := raw.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if text, ok := part["text"].(string); ok {
+			converted = append(converted, map[string]interface{}{"text": text})
+		} else if url, ok := imageURL(part); ok {
+			if mediaType, data, ok := parseDataURL(url); ok {
+				converted = append(converted, map[string]interface{}{
+					"inline_data": map[string]interface{}{"mime_type": mediaType, "data": data},
+				})
+			}
+		}
+	}
+	return converted
+}
+
+// linksImages reports whether a chat request has images by http(s) URL
+// rather than inline
+func linksImages(requestData map[string]interface{}) bool {
+	linked := false
+	eachImagePart(requestData, func(part map[string]interface{}, url string) {
+		linked = linked || isRemoteURL(url)
+	})
+	return linked
+}
+
+// eachImagePart calls fn with each image_url content part of a chat
+// request and its URL
+func eachImagePart(requestData map[string]interface{}, fn func(part map[string]interface{}, url string)) {
+	messages, _ := requestData["messages"].([]interface{})
+	for _, rawMessage := range messages {
+		message, _ := rawMessage.(map[string]interface{})
+		parts, _ := message["content"].([]interface{})
+		for _, rawPart := range parts {
+			part, _ := rawPart.(map[string]interface{})
+			if url, ok := imageURL(part); ok {
+				fn(part, url)
+			}
+		}
+	}
+}
+
+func isRemoteURL(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
+
+// newImageClient returns the client linked images are downloaded with.
+// The URLs are the client's, so it only connects to public addresses.
+func newImageClient() *http.Client {
+	return &http.Client{Timeout: 30 * time.Second, Transport: egress.Transport()}
+}
+
+// inlineImageURLs downloads the images a request links to and rewrites
+// their URLs as data URLs, for providers that only take images inline
+func inlineImageURLs(ctx context.Context, client *http.Client, requestData map[string]interface{}) error {
+	var err error
+	eachImagePart(requestData, func(part map[string]interface{}, url string) {
+		if err != nil || !isRemoteURL(url) {
+			return
+		}
+		var dataURL string
+		if dataURL, err = downloadImage(ctx, client, url); err == nil {
+			part["image_url"] = map[string]interface{}{"url": dataURL}
+		}
+	})
+	return err
+}
+
+// downloadImage fetches an image as a data URL. Anything not served as an
+// image is refused, so the body of some other page never reaches the model.
+func downloadImage(ctx context.Context, client *http.Client, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("invalid image URL: %w", err)
+	}
+	if err := egress.CheckHost(req.URL.Hostname()); err != nil {
+		return "", fmt.Errorf("image URL %s: %w", url, err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download image: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download image %s: status %d", url, resp.StatusCode)
+	}
+	mediaType, _, _ := strings.Cut(resp.Header.Get("Content-Type"), ";")
+	mediaType = strings.TrimSpace(mediaType)
+	if !strings.HasPrefix(mediaType, "image/") {
+		return "", fmt.Errorf("image URL %s is not an image: Content-Type %q", url, resp.Header.Get("Content-Type"))
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxInlineImageBytes+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to download image: %w", err)
+	}
+	if len(data) > maxInlineImageBytes {
+		return "", fmt.Errorf("image %s is larger than %d bytes", url, maxInlineImageBytes)
+	}
+	return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data), nil
+}
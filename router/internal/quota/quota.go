@@ -0,0 +1,168 @@
+// Package quota enforces per-tenant spend budgets and request quotas
+package quota
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limits caps one tenant's usage; zero values are unlimited. Months and days
+// are calendar periods in UTC.
+type Limits struct {
+	MonthlyBudget float64 `yaml:"monthlyBudget"` // USD across clusters and providers
+	DailyRequests int     `yaml:"dailyRequests"`
+}
+
+// Limit names, as reported in ExceededError
+const (
+	LimitMonthlyBudget = "monthly_budget"
+	LimitDailyRequests = "daily_requests"
+)
+
+// ExceededError rejects a request from a tenant past one of its limits
+type ExceededError struct {
+	Tenant  string
+	Limit   string
+	Used    float64
+	Max     float64
+	ResetAt time.Time
+}
+
+func (e *ExceededError) Error() string {
+	if e.Limit == LimitMonthlyBudget {
+		return fmt.Sprintf("tenant %s has spent $%.2f of its $%.2f monthly budget", e.Tenant, e.Used, e.Max)
+	}
+	return fmt.Sprintf("tenant %s has made %.0f of its %.0f daily requests", e.Tenant, e.Used, e.Max)
+}
+
+// Usage is one tenant's consumption in the current periods
+type Usage struct {
+	Month    string  `json:"month"`
+	Spend    float64 `json:"spend_usd"`
+	Day      string  `json:"day"`
+	Requests int     `json:"requests"`
+}
+
+// Status reports a tenant's usage against its limits
+type Status struct {
+	Usage
+	MonthlyBudget float64 `json:"monthly_budget_usd,omitempty"`
+	DailyRequests int     `json:"daily_requests,omitempty"`
+}
+
+// Tracker counts usage for tenants with limits
+type Tracker struct {
+	limits map[string]Limits
+	now    func() time.Time
+
+	mu    sync.Mutex
+	usage map[string]*Usage
+}
+
+// New creates a tracker for the configured tenants
+func New(limits map[string]Limits) (*Tracker, error) {
+	for tenant, l := range limits {
+		if l.MonthlyBudget < 0 || l.DailyRequests < 0 {
+			return nil, fmt.Errorf("tenant %s: limits must not be negative", tenant)
+		}
+	}
+	return &Tracker{limits: limits, now: time.Now, usage: make(map[string]*Usage)}, nil
+}
+
+// current returns the tenant's usage, reset for new periods (lock must be held)
+func (t *Tracker) current(tenant string) *Usage {
+	now := t.now().UTC()
+	month, day := now.Format("2006-01"), now.Format("2006-01-02")
+	u, ok := t.usage[tenant]
+	if !ok {
+		u = &Usage{}
+		t.usage[tenant] = u
+	}
+	if u.Month != month {
+		u.Month = month
+		u.Spend = 0
+	}
+	if u.Day != day {
+		u.Day = day
+		u.Requests = 0
+	}
+	return u
+}
+
+// Admit counts a request against the tenant's daily quota, or returns an
+// *ExceededError without counting it if either limit is used up. Tenants
+// without limits are always admitted.
+func (t *Tracker) Admit(tenant string) error {
+	l, ok := t.limits[tenant]
+	if !ok {
+		return nil
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	u := t.current(tenant)
+	now := t.now().UTC()
+	if l.MonthlyBudget > 0 && u.Spend >= l.MonthlyBudget {
+		return &ExceededError{
+			Tenant: tenant, Limit: LimitMonthlyBudget, Used: u.Spend, Max: l.MonthlyBudget,
+			ResetAt: time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC),
+		}
+	}
+	if l.DailyRequests > 0 && u.Requests >= l.DailyRequests {
+		return &ExceededError{
+			Tenant: tenant, Limit: LimitDailyRequests, Used: float64(u.Requests), Max: float64(l.DailyRequests),
+			ResetAt: now.Truncate(24 * time.Hour).Add(24 * time.Hour),
+		}
+	}
+	u.Requests++
+	return nil
+}
+
+// Charge adds usd of spend to the tenant's month
+func (t *Tracker) Charge(tenant string, usd float64) {
+	if _, ok := t.limits[tenant]; !ok || usd <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.current(tenant).Spend += usd
+}
+
+// Status reports every tenant with limits
+func (t *Tracker) Status() map[string]Status {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	status := make(map[string]Status, len(t.limits))
+	for tenant, l := range t.limits {
+		status[tenant] = Status{Usage: *t.current(tenant), MonthlyBudget: l.MonthlyBudget, DailyRequests: l.DailyRequests}
+	}
+	return status
+}
+
+// State returns usage so it can outlive the process
+func (t *Tracker) State() map[string]Usage {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	state := make(map[string]Usage, len(t.usage))
+	for tenant := range t.usage {
+		state[tenant] = *t.current(tenant)
+	}
+	return state
+}
+
+// Restore reloads usage saved by State. Periods that have since ended are
+// reset on first use.
+func (t *Tracker) Restore(state map[string]Usage) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for tenant, u := range state {
+		if _, ok := t.limits[tenant]; ok {
+			restored := u
+			t.usage[tenant] = &restored
+		}
+	}
+}
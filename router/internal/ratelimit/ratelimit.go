@@ -0,0 +1,168 @@
+// Package ratelimit keeps the router within each external provider's
+// request and token quotas, using a token bucket per provider per quota
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limits are one provider's quotas; zero leaves a quota unlimited
+type Limits struct {
+	RequestsPerMinute int
+	TokensPerMinute   int
+	Burst             float64 // bucket size as a multiple of a minute's quota, default 1
+}
+
+// Status reports one provider's remaining quota
+type Status struct {
+	RequestsPerMinute int      `json:"requests_per_minute,omitempty"`
+	RequestsAvailable *float64 `json:"requests_available,omitempty"`
+	TokensPerMinute   int      `json:"tokens_per_minute,omitempty"`
+	TokensAvailable   *float64 `json:"tokens_available,omitempty"` // negative while paying back tokens used beyond a reservation
+	Limited           int64    `json:"limited_total"`              // requests turned away since startup
+}
+
+// bucket refills at rate per second up to capacity; a zero rate never limits
+type bucket struct {
+	rate     float64
+	capacity float64
+	level    float64
+}
+
+func newBucket(perMinute int, burst float64) bucket {
+	capacity := float64(perMinute) * burst
+	return bucket{rate: float64(perMinute) / 60, capacity: capacity, level: capacity}
+}
+
+func (b *bucket) refill(elapsed time.Duration) {
+	b.level = math.Min(b.capacity, b.level+b.rate*elapsed.Seconds())
+}
+
+// wait is how long until n can be taken. More than the bucket holds is
+// allowed once it is full, leaving it in debt.
+func (b *bucket) wait(n float64) time.Duration {
+	if b.rate == 0 {
+		return 0
+	}
+	need := math.Min(n, b.capacity)
+	if b.level >= need {
+		return 0
+	}
+	return time.Duration((need - b.level) / b.rate * float64(time.Second))
+}
+
+type limiter struct {
+	limits   Limits
+	requests bucket
+	tokens   bucket
+	updated  time.Time
+	limited  int64
+}
+
+func (l *limiter) refill(now time.Time) {
+	elapsed := now.Sub(l.updated)
+	l.updated = now
+	l.requests.refill(elapsed)
+	l.tokens.refill(elapsed)
+}
+
+// Set holds a limiter per rate-limited provider
+type Set struct {
+	mu       sync.Mutex
+	limiters map[string]*limiter
+}
+
+// New creates limiters for the providers with any quota set
+func New(limits map[string]Limits) *Set {
+	s := &Set{limiters: make(map[string]*limiter)}
+	for name, l := range limits {
+		s.Set(name, l)
+	}
+	return s
+}
+
+// Set replaces provider's quotas, for providers registered at runtime.
+// Zero limits remove them.
+func (s *Set) Set(provider string, l Limits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l.RequestsPerMinute <= 0 && l.TokensPerMinute <= 0 {
+		delete(s.limiters, provider)
+		return
+	}
+	if l.Burst < 1 {
+		l.Burst = 1
+	}
+	s.limiters[provider] = &limiter{
+		limits:   l,
+		requests: newBucket(l.RequestsPerMinute, l.Burst),
+		tokens:   newBucket(l.TokensPerMinute, l.Burst),
+		updated:  time.Now(),
+	}
+}
+
+// Take reserves one request and tokens against provider's quotas. When a
+// quota is spent nothing is taken and the wait until both would allow it
+// is returned.
+func (s *Set) Take(provider string, tokens int) (time.Duration, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.limiters[provider]
+	if !ok {
+		return 0, true
+	}
+	l.refill(time.Now())
+
+	wait := l.requests.wait(1)
+	if tokensWait := l.tokens.wait(float64(tokens)); tokensWait > wait {
+		wait = tokensWait
+	}
+	if wait > 0 {
+		l.limited++
+		return wait, false
+	}
+	l.requests.level--
+	if l.tokens.rate > 0 {
+		l.tokens.level -= float64(tokens)
+	}
+	return 0, true
+}
+
+// Settle replaces a reservation made with Take by the tokens the provider
+// reported, returning what was over-reserved or charging what was under
+func (s *Set) Settle(provider string, reserved, used int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.limiters[provider]
+	if !ok || l.tokens.rate == 0 {
+		return
+	}
+	l.refill(time.Now())
+	l.tokens.level = math.Min(l.tokens.capacity, l.tokens.level+float64(reserved-used))
+}
+
+// Status reports every rate-limited provider
+func (s *Set) Status() map[string]Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	status := make(map[string]Status, len(s.limiters))
+	for name, l := range s.limiters {
+		l.refill(now)
+		st := Status{Limited: l.limited}
+		if l.requests.rate > 0 {
+			available := math.Floor(l.requests.level)
+			st.RequestsPerMinute = l.limits.RequestsPerMinute
+			st.RequestsAvailable = &available
+		}
+		if l.tokens.rate > 0 {
+			available := math.Floor(l.tokens.level)
+			st.TokensPerMinute = l.limits.TokensPerMinute
+			st.TokensAvailable = &available
+		}
+		status[name] = st
+	}
+	return status
+}
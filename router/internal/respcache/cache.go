@@ -0,0 +1,168 @@
+// Package respcache keeps whole LLM responses in memory, least recently
+// used first out, so identical requests can be answered without an
+// upstream call
+package respcache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// Config bounds the cache. Entries expire after TTL and the least recently
+// used are evicted past MaxEntries or MaxBytes.
+type Config struct {
+	Enabled       bool          `yaml:"enabled"`
+	TTL           time.Duration `yaml:"ttl"`           // default 1h
+	MaxEntries    int           `yaml:"maxEntries"`    // default 1000
+	MaxBytes      int64         `yaml:"maxBytes"`      // across entries, default 64MiB
+	MaxEntryBytes int           `yaml:"maxEntryBytes"` // larger responses aren't cached, default 1MiB
+	Shared        bool          `yaml:"shared"`        // tenants share entries; by default each tenant has its own
+}
+
+// Response is a cached response
+type Response struct {
+	ContentType string
+	Body        []byte
+	Stored      time.Time
+}
+
+type item struct {
+	key      string
+	response *Response
+}
+
+// Stats reports the cache's size and effectiveness since start
+type Stats struct {
+	Entries   int   `json:"entries"`
+	Bytes     int64 `json:"bytes"`
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Evictions int64 `json:"evictions"`
+}
+
+// Cache is safe for concurrent use. A nil *Cache caches nothing.
+type Cache struct {
+	config Config
+
+	mu    sync.Mutex
+	order *list.List // front is most recently used
+	items map[string]*list.Element
+	stats Stats
+}
+
+// New creates a cache, or returns nil when it is disabled
+func New(config Config) *Cache {
+	if !config.Enabled {
+		return nil
+	}
+	return &Cache{config: config, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+// Shared reports whether tenants share entries
+func (c *Cache) Shared() bool {
+	return c != nil && c.config.Shared
+}
+
+// Get returns the unexpired response stored under key
+func (c *Cache) Get(key string) (*Response, bool) {
+	if c == nil {
+		return nil, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	element, ok := c.items[key]
+	if ok && time.Since(element.Value.(*item).response.Stored) > c.config.TTL {
+		c.remove(element)
+		ok = false
+	}
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	c.stats.Hits++
+	c.order.MoveToFront(element)
+	return element.Value.(*item).response, true
+}
+
+// Fits reports whether a response of size bytes may be cached
+func (c *Cache) Fits(size int) bool {
+	return c != nil && size <= c.config.MaxEntryBytes
+}
+
+// Put stores response under key, evicting the least recently used entries
+// to make room
+func (c *Cache) Put(key string, response *Response) {
+	if !c.Fits(len(response.Body)) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if element, ok := c.items[key]; ok {
+		c.remove(element)
+	}
+	c.items[key] = c.order.PushFront(&item{key: key, response: response})
+	c.stats.Bytes += int64(len(response.Body))
+	for c.order.Len() > c.config.MaxEntries || c.stats.Bytes > c.config.MaxBytes {
+		c.remove(c.order.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Purge empties the cache, returning how many entries it held
+func (c *Cache) Purge() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := c.order.Len()
+	c.order.Init()
+	c.items = make(map[string]*list.Element)
+	c.stats.Bytes = 0
+	return n
+}
+
+// Stats returns the cache's counters
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.order.Len()
+	return stats
+}
+
+// remove drops an entry; callers hold c.mu
+func (c *Cache) remove(element *list.Element) {
+	entry := element.Value.(*item)
+	c.order.Remove(element)
+	delete(c.items, entry.key)
+	c.stats.Bytes -= int64(len(entry.response.Body))
+}
+
+// Key identifies a request by its JSON body, normalized so key order and
+// whitespace don't matter, with ignore's top-level fields left out, and by
+// scope (endpoint, tenant)
+func Key(body []byte, ignore []string, scope ...string) (string, bool) {
+	var request map[string]interface{}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return "", false
+	}
+	for _, field := range ignore {
+		delete(request, field)
+	}
+	normalized, err := json.Marshal(request) // map keys are sorted
+	if err != nil {
+		return "", false
+	}
+	hash := sha256.New()
+	for _, part := range scope {
+		hash.Write([]byte(part))
+		hash.Write([]byte{0})
+	}
+	hash.Write(normalized)
+	return hex.EncodeToString(hash.Sum(nil)), true
+}
@@ -0,0 +1,279 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"strings"
+)
+
+// Validate checks a JSON document against a JSON Schema.
+// It supports the subset used by OpenAI structured outputs: type, properties,
+// required, additionalProperties, items, enum, const, anyOf, oneOf, allOf,
+// numeric bounds and string/array length limits.
+func Validate(document string, schema map[string]interface{}) error {
+	var value interface{}
+	if err := json.Unmarshal([]byte(document), &value); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return validateValue(value, schema, "$")
+}
+
+func validateValue(value interface{}, schema map[string]interface{}, path string) error {
+	if len(schema) == 0 {
+		return nil
+	}
+
+	if t, ok := schema["type"]; ok {
+		if err := checkType(value, t, path); err != nil {
+			return err
+		}
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, candidate := range enum {
+			if equal(value, candidate) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s: value not in enum", path)
+		}
+	}
+
+	if c, ok := schema["const"]; ok && !equal(value, c) {
+		return fmt.Errorf("%s: value does not match const", path)
+	}
+
+	if all, ok := schema["allOf"].([]interface{}); ok {
+		for _, sub := range all {
+			if err := validateValue(value, asSchema(sub), path); err != nil {
+				return err
+			}
+		}
+	}
+
+	if anyOf, ok := schema["anyOf"].([]interface{}); ok && !matchesAny(value, anyOf, path) {
+		return fmt.Errorf("%s: value does not match any schema in anyOf", path)
+	}
+
+	if oneOf, ok := schema["oneOf"].([]interface{}); ok {
+		matches := 0
+		for _, sub := range oneOf {
+			if validateValue(value, asSchema(sub), path) == nil {
+				matches++
+			}
+		}
+		if matches != 1 {
+			return fmt.Errorf("%s: value matches %d schemas in oneOf, expected exactly 1", path, matches)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return validateObject(v, schema, path)
+	case []interface{}:
+		return validateArray(v, schema, path)
+	case string:
+		return validateString(v, schema, path)
+	case float64:
+		return validateNumber(v, schema, path)
+	}
+
+	return nil
+}
+
+func validateObject(obj map[string]interface{}, schema map[string]interface{}, path string) error {
+	properties, _ := schema["properties"].(map[string]interface{})
+
+	if required, ok := schema["required"].([]interface{}); ok {
+		for _, r := range required {
+			name, _ := r.(string)
+			if _, exists := obj[name]; !exists {
+				return fmt.Errorf("%s: missing required property %q", path, name)
+			}
+		}
+	}
+
+	for name, propValue := range obj {
+		propSchema, defined := properties[name]
+		if defined {
+			if err := validateValue(propValue, asSchema(propSchema), path+"."+name); err != nil {
+				return err
+			}
+			continue
+		}
+
+		switch additional := schema["additionalProperties"].(type) {
+		case bool:
+			if !additional {
+				return fmt.Errorf("%s: unexpected property %q", path, name)
+			}
+		case map[string]interface{}:
+			if err := validateValue(propValue, additional, path+"."+name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateArray(arr []interface{}, schema map[string]interface{}, path string) error {
+	if min, ok := number(schema["minItems"]); ok && float64(len(arr)) < min {
+		return fmt.Errorf("%s: expected at least %v items", path, min)
+	}
+	if max, ok := number(schema["maxItems"]); ok && float64(len(arr)) > max {
+		return fmt.Errorf("%s: expected at most %v items", path, max)
+	}
+
+	if items, ok := schema["items"].(map[string]interface{}); ok {
+		for i, item := range arr {
+			if err := validateValue(item, items, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func validateString(s string, schema map[string]interface{}, path string) error {
+	length := float64(len([]rune(s)))
+	if min, ok := number(schema["minLength"]); ok && length < min {
+		return fmt.Errorf("%s: string shorter than %v", path, min)
+	}
+	if max, ok := number(schema["maxLength"]); ok && length > max {
+		return fmt.Errorf("%s: string longer than %v", path, max)
+	}
+	if pattern, ok := schema["pattern"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err == nil && !re.MatchString(s) {
+			return fmt.Errorf("%s: string does not match pattern %q", path, pattern)
+		}
+	}
+	return nil
+}
+
+func validateNumber(n float64, schema map[string]interface{}, path string) error {
+	if min, ok := number(schema["minimum"]); ok && n < min {
+		return fmt.Errorf("%s: %v is below minimum %v", path, n, min)
+	}
+	if max, ok := number(schema["maximum"]); ok && n > max {
+		return fmt.Errorf("%s: %v is above maximum %v", path, n, max)
+	}
+	if min, ok := number(schema["exclusiveMinimum"]); ok && n <= min {
+		return fmt.Errorf("%s: %v is not above %v", path, n, min)
+	}
+	if max, ok := number(schema["exclusiveMaximum"]); ok && n >= max {
+		return fmt.Errorf("%s: %v is not below %v", path, n, max)
+	}
+	return nil
+}
+
+func checkType(value interface{}, t interface{}, path string) error {
+	switch typ := t.(type) {
+	case string:
+		if !isType(value, typ) {
+			return fmt.Errorf("%s: expected %s", path, typ)
+		}
+	case []interface{}:
+		for _, candidate := range typ {
+			if name, ok := candidate.(string); ok && isType(value, name) {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: value does not match any allowed type", path)
+	}
+	return nil
+}
+
+func isType(value interface{}, typ string) bool {
+	switch typ {
+	case "object":
+		_, ok := value.(map[string]interface{})
+		return ok
+	case "array":
+		_, ok := value.([]interface{})
+		return ok
+	case "string":
+		_, ok := value.(string)
+		return ok
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "boolean":
+		_, ok := value.(bool)
+		return ok
+	case "null":
+		return value == nil
+	}
+	return true // Unknown types are not enforced
+}
+
+func matchesAny(value interface{}, schemas []interface{}, path string) bool {
+	for _, sub := range schemas {
+		if validateValue(value, asSchema(sub), path) == nil {
+			return true
+		}
+	}
+	return false
+}
+
+func asSchema(v interface{}) map[string]interface{} {
+	m, _ := v.(map[string]interface{})
+	return m
+}
+
+func number(v interface{}) (float64, bool) {
+	n, ok := v.(float64)
+	return n, ok
+}
+
+func equal(a, b interface{}) bool {
+	aj, errA := json.Marshal(a)
+	bj, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(aj) == string(bj)
+}
+
+// Repair attempts to recover a JSON document from typical small-model output
+// defects: markdown code fences, leading/trailing prose, and trailing commas.
+// It returns the repaired document and whether anything changed.
+func Repair(document string) (string, bool) {
+	repaired := strings.TrimSpace(document)
+
+	// Strip ```json ... ``` fences
+	if strings.HasPrefix(repaired, "```") {
+		repaired = strings.TrimPrefix(repaired, "```")
+		if newline := strings.Index(repaired, "\n"); newline >= 0 {
+			repaired = repaired[newline+1:]
+		}
+		repaired = strings.TrimSuffix(strings.TrimSpace(repaired), "```")
+	}
+
+	// Cut surrounding prose down to the outermost object or array
+	start := strings.IndexAny(repaired, "{[")
+	if start >= 0 {
+		closer := "}"
+		if repaired[start] == '[' {
+			closer = "]"
+		}
+		if end := strings.LastIndex(repaired, closer); end > start {
+			repaired = repaired[start : end+1]
+		}
+	}
+
+	// Drop trailing commas before closing brackets
+	repaired = trailingComma.ReplaceAllString(repaired, "$1")
+
+	repaired = strings.TrimSpace(repaired)
+	return repaired, repaired != strings.TrimSpace(document)
+}
+
+var trailingComma = regexp.MustCompile(`,\s*([}\]])`)
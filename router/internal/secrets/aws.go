@@ -0,0 +1,105 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/sigv4"
+)
+
+// AWSConfig reads references of the form awssm://<secret>#<key> from AWS
+// Secrets Manager. The secret is a name or ARN; key picks a field of a
+// JSON secret and is left out to take the whole value.
+type AWSConfig struct {
+	Region          string `yaml:"region"`          // default $AWS_REGION; an ARN's own region wins
+	Endpoint        string `yaml:"endpoint"`        // e.g. a VPC endpoint, default the regional one
+	AccessKeyID     string `yaml:"accessKeyID"`     // default $AWS_ACCESS_KEY_ID
+	SecretAccessKey string `yaml:"secretAccessKey"` // default $AWS_SECRET_ACCESS_KEY
+}
+
+type awsBackend struct {
+	config AWSConfig
+	client *http.Client
+	creds  sigv4.Credentials
+}
+
+func newAWSBackend(config AWSConfig) *awsBackend {
+	if config.Region == "" {
+		config.Region = os.Getenv("AWS_REGION")
+	}
+	creds := sigv4.FromEnv()
+	if config.AccessKeyID != "" {
+		creds = sigv4.Credentials{AccessKeyID: config.AccessKeyID, SecretAccessKey: config.SecretAccessKey}
+	}
+	return &awsBackend{config: config, client: &http.Client{Timeout: 10 * time.Second}, creds: creds}
+}
+
+func (b *awsBackend) fetch(ctx context.Context, reference string) (string, error) {
+	id, key, _ := strings.Cut(reference, "#")
+	if id == "" {
+		return "", fmt.Errorf("want awssm://<secret>#<key>")
+	}
+	if b.creds.AccessKeyID == "" {
+		return "", fmt.Errorf("no AWS credentials; set secrets.aws.accessKeyID or AWS_ACCESS_KEY_ID")
+	}
+
+	// arn:aws:secretsmanager:<region>:<account>:secret:<name>
+	region := b.config.Region
+	if parts := strings.Split(id, ":"); len(parts) > 3 && parts[0] == "arn" {
+		region = parts[3]
+	}
+	if region == "" {
+		return "", fmt.Errorf("no region; set secrets.aws.region or AWS_REGION, or use the secret's ARN")
+	}
+	endpoint := b.config.Endpoint
+	if endpoint == "" {
+		endpoint = "https://secretsmanager." + region + ".amazonaws.com"
+	}
+
+	body, _ := json.Marshal(map[string]string{"SecretId": id})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	sigv4.Sign(req, body, b.creds, region, "secretsmanager", time.Now())
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Type    string `json:"__type"`
+			Message string `json:"message"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&failure)
+		return "", fmt.Errorf("secrets manager returned %d: %s %s", resp.StatusCode, failure.Type, failure.Message)
+	}
+	var secret struct {
+		SecretString string `json:"SecretString"`
+		SecretBinary string `json:"SecretBinary"` // base64
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("invalid secrets manager response: %w", err)
+	}
+	value := secret.SecretString
+	if value == "" && secret.SecretBinary != "" {
+		decoded, err := base64.StdEncoding.DecodeString(secret.SecretBinary)
+		if err != nil {
+			return "", fmt.Errorf("invalid SecretBinary: %w", err)
+		}
+		value = string(decoded)
+	}
+	return jsonField(value, key)
+}
@@ -0,0 +1,198 @@
+package secrets
+
+import (
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// GCPConfig reads references of the form gcpsm://<secret>#<key> from GCP
+// Secret Manager. The secret is projects/<project>/secrets/<name>, with
+// /versions/<version> to pin one, or just a name in project; key picks a
+// field of a JSON secret and is left out to take the whole value.
+type GCPConfig struct {
+	Project         string `yaml:"project"`         // for secrets given by name
+	CredentialsFile string `yaml:"credentialsFile"` // service account key, default $GOOGLE_APPLICATION_CREDENTIALS, then the metadata server
+	Endpoint        string `yaml:"endpoint"`        // default https://secretmanager.googleapis.com
+}
+
+const (
+	gcpMetadataToken = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+	gcpScope         = "https://www.googleapis.com/auth/cloud-platform"
+)
+
+type gcpBackend struct {
+	config GCPConfig
+	client *http.Client
+	token  string
+}
+
+func newGCPBackend(config GCPConfig) *gcpBackend {
+	if config.CredentialsFile == "" {
+		config.CredentialsFile = os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://secretmanager.googleapis.com"
+	}
+	return &gcpBackend{config: config, client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (b *gcpBackend) fetch(ctx context.Context, reference string) (string, error) {
+	name, key, _ := strings.Cut(reference, "#")
+	if !strings.HasPrefix(name, "projects/") {
+		if b.config.Project == "" || name == "" {
+			return "", fmt.Errorf("want gcpsm://projects/<project>/secrets/<name>#<key>, or set secrets.gcp.project")
+		}
+		name = "projects/" + b.config.Project + "/secrets/" + name
+	}
+	if !strings.Contains(name, "/versions/") {
+		name += "/versions/latest"
+	}
+
+	if b.token == "" {
+		token, err := b.authenticate(ctx)
+		if err != nil {
+			return "", fmt.Errorf("authentication: %w", err)
+		}
+		b.token = token
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.config.Endpoint+"/v1/"+name+":access", nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bearer "+b.token)
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error struct {
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&failure)
+		return "", fmt.Errorf("secret manager returned %d: %s", resp.StatusCode, failure.Error.Message)
+	}
+	var version struct {
+		Payload struct {
+			Data string `json:"data"` // base64
+		} `json:"payload"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&version); err != nil {
+		return "", fmt.Errorf("invalid secret manager response: %w", err)
+	}
+	value, err := base64.StdEncoding.DecodeString(version.Payload.Data)
+	if err != nil {
+		return "", fmt.Errorf("invalid secret payload: %w", err)
+	}
+	return jsonField(string(value), key)
+}
+
+// authenticate gets an access token for the service account key, or from
+// the metadata server on GCE, GKE and Cloud Run
+func (b *gcpBackend) authenticate(ctx context.Context) (string, error) {
+	var req *http.Request
+	var err error
+	if b.config.CredentialsFile != "" {
+		req, err = b.serviceAccountRequest(ctx)
+	} else {
+		req, err = http.NewRequestWithContext(ctx, http.MethodGet, gcpMetadataToken, nil)
+		if err == nil {
+			req.Header.Set("Metadata-Flavor", "Google")
+		}
+	}
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return "", fmt.Errorf("token request returned %d: %s", resp.StatusCode, message)
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("token response has no access_token")
+	}
+	return token.AccessToken, nil
+}
+
+// serviceAccountRequest exchanges a JWT signed with the service account's
+// key for an access token
+func (b *gcpBackend) serviceAccountRequest(ctx context.Context) (*http.Request, error) {
+	data, err := os.ReadFile(b.config.CredentialsFile)
+	if err != nil {
+		return nil, err
+	}
+	var key struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("invalid credentials file: %w", err)
+	}
+	if key.TokenURI == "" {
+		key.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil {
+		return nil, fmt.Errorf("credentials file has no private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %w", err)
+	}
+	privateKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("private key is not RSA")
+	}
+
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss": key.ClientEmail, "scope": gcpScope, "aud": key.TokenURI,
+		"iat": now.Unix(), "exp": now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(nil, privateKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, key.TokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return req, nil
+}
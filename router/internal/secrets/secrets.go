@@ -0,0 +1,114 @@
+// Package secrets resolves config values that name a secret in an external
+// store, such as vault:kv/llm-router#openai or awssm://llm-router#openai,
+// so credentials needn't sit in the config file
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Config selects the secret stores references can name
+type Config struct {
+	RefreshInterval time.Duration `yaml:"refreshInterval"` // how often referenced secrets are fetched again, default 5m
+	Vault           VaultConfig   `yaml:"vault"`
+	AWS             AWSConfig     `yaml:"aws"` // Secrets Manager, awssm://
+	GCP             GCPConfig     `yaml:"gcp"` // Secret Manager, gcpsm://
+}
+
+// backend fetches the secret a reference names, without its scheme
+type backend interface {
+	fetch(ctx context.Context, reference string) (string, error)
+}
+
+// schemes are the reference prefixes, one per store
+var schemes = []string{"vault:", "awssm://", "gcpsm://"}
+
+// IsReference reports whether value names a secret rather than being one
+func IsReference(value string) bool {
+	for _, scheme := range schemes {
+		if strings.HasPrefix(value, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolver fetches referenced secrets. Each one keeps what it has fetched,
+// so create one per pass over the config to see rotated values.
+type Resolver struct {
+	backends map[string]backend
+	values   map[string]string
+}
+
+// New creates a resolver for the configured stores. The cloud ones need
+// no configuration where their credentials are in the environment.
+func New(config Config) (*Resolver, error) {
+	r := &Resolver{
+		backends: map[string]backend{
+			"awssm://": newAWSBackend(config.AWS),
+			"gcpsm://": newGCPBackend(config.GCP),
+		},
+		values: make(map[string]string),
+	}
+	if config.Vault.Address != "" {
+		vault, err := newVaultBackend(config.Vault)
+		if err != nil {
+			return nil, fmt.Errorf("vault: %w", err)
+		}
+		r.backends["vault:"] = vault
+	}
+	return r, nil
+}
+
+// Resolve returns the secret reference names
+func (r *Resolver) Resolve(ctx context.Context, reference string) (string, error) {
+	if value, ok := r.values[reference]; ok {
+		return value, nil
+	}
+	for _, scheme := range schemes {
+		if !strings.HasPrefix(reference, scheme) {
+			continue
+		}
+		b, ok := r.backends[scheme]
+		if !ok {
+			return "", fmt.Errorf("%s names %s, which is not configured under secrets", reference, strings.TrimSuffix(scheme, ":"))
+		}
+		value, err := b.fetch(ctx, strings.TrimPrefix(reference, scheme))
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", reference, err)
+		}
+		r.values[reference] = value
+		return value, nil
+	}
+	return "", fmt.Errorf("%s is not a secret reference", reference)
+}
+
+// Resolved is how many distinct references the resolver has fetched
+func (r *Resolver) Resolved() int {
+	return len(r.values)
+}
+
+// jsonField returns key of a secret holding a JSON object, or the whole
+// secret when key is empty
+func jsonField(secret, key string) (string, error) {
+	if key == "" {
+		return secret, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("#%s needs a JSON object secret: %w", key, err)
+	}
+	value, ok := fields[key]
+	if !ok {
+		return "", fmt.Errorf("no key %q in the secret", key)
+	}
+	if text, ok := value.(string); ok {
+		return text, nil
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded), nil
+}
@@ -0,0 +1,253 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// VaultConfig reads references of the form vault:<mount>/<path>#<field>
+// from a Vault KV secrets engine
+type VaultConfig struct {
+	Address   string `yaml:"address"`   // e.g. https://vault.internal:8200; empty disables vault references
+	Namespace string `yaml:"namespace"` // Vault Enterprise namespace
+	KVVersion int    `yaml:"kvVersion"` // 1 or 2, default 2
+	CAFile    string `yaml:"caFile"`    // CA bundle for the server's certificate, default the system pool
+
+	Auth      string `yaml:"auth"`      // "token" (default), "kubernetes" or "approle"
+	AuthMount string `yaml:"authMount"` // default the method's name
+	Token     string `yaml:"token"`     // token auth; renewed on every refresh when renewable
+	Role      string `yaml:"role"`      // kubernetes auth role
+	JWTFile   string `yaml:"jwtFile"`   // kubernetes service account token, default the pod's
+	RoleID    string `yaml:"roleID"`    // approle credentials
+	SecretID  string `yaml:"secretID"`
+}
+
+const serviceAccountTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+type vaultBackend struct {
+	config VaultConfig
+	client *http.Client
+	token  string
+	fields map[string]map[string]interface{} // secret path -> its fields
+}
+
+func newVaultBackend(config VaultConfig) (*vaultBackend, error) {
+	if config.KVVersion == 0 {
+		config.KVVersion = 2
+	}
+	if config.KVVersion != 1 && config.KVVersion != 2 {
+		return nil, fmt.Errorf("kvVersion must be 1 or 2")
+	}
+	if config.Auth == "" {
+		config.Auth = "token"
+	}
+	if config.AuthMount == "" {
+		config.AuthMount = config.Auth
+	}
+	switch config.Auth {
+	case "token":
+		if config.Token == "" {
+			return nil, fmt.Errorf("token auth needs token")
+		}
+	case "kubernetes":
+		if config.Role == "" {
+			return nil, fmt.Errorf("kubernetes auth needs role")
+		}
+		if config.JWTFile == "" {
+			config.JWTFile = serviceAccountTokenFile
+		}
+	case "approle":
+		if config.RoleID == "" {
+			return nil, fmt.Errorf("approle auth needs roleID")
+		}
+	default:
+		return nil, fmt.Errorf("unknown auth %q", config.Auth)
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", config.CAFile)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: pool}
+	}
+	return &vaultBackend{
+		config: config,
+		client: &http.Client{Timeout: 10 * time.Second, Transport: transport},
+		fields: make(map[string]map[string]interface{}),
+	}, nil
+}
+
+// fetch reads <mount>/<path>#<field>. The field may be left out of a
+// secret with only one.
+func (b *vaultBackend) fetch(ctx context.Context, reference string) (string, error) {
+	path, field, _ := strings.Cut(reference, "#")
+	mount, rest, _ := strings.Cut(path, "/")
+	if mount == "" || rest == "" {
+		return "", fmt.Errorf("want vault:<mount>/<path>#<field>")
+	}
+
+	fields, ok := b.fields[path]
+	if !ok {
+		if b.token == "" {
+			token, err := b.authenticate(ctx)
+			if err != nil {
+				return "", fmt.Errorf("authentication: %w", err)
+			}
+			b.token = token
+		}
+		var err error
+		if fields, err = b.read(ctx, mount, rest); err != nil {
+			return "", err
+		}
+		b.fields[path] = fields
+	}
+
+	if field == "" && len(fields) == 1 {
+		for only := range fields {
+			field = only
+		}
+	}
+	value, ok := fields[field]
+	if !ok {
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("no field %q; the secret has %s", field, strings.Join(names, ", "))
+	}
+	if text, ok := value.(string); ok {
+		return text, nil
+	}
+	encoded, _ := json.Marshal(value)
+	return string(encoded), nil
+}
+
+func (b *vaultBackend) read(ctx context.Context, mount, path string) (map[string]interface{}, error) {
+	if b.config.KVVersion == 1 {
+		var secret struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		err := b.request(ctx, http.MethodGet, "/v1/"+mount+"/"+path, nil, &secret)
+		return secret.Data, err
+	}
+	var secret struct {
+		Data struct {
+			Data map[string]interface{} `json:"data"`
+		} `json:"data"`
+	}
+	err := b.request(ctx, http.MethodGet, "/v1/"+mount+"/data/"+path, nil, &secret)
+	if err == nil && secret.Data.Data == nil {
+		err = fmt.Errorf("%s/%s is deleted", mount, path) // the latest version was soft-deleted
+	}
+	return secret.Data.Data, err
+}
+
+// authenticate returns a token for the configured auth method, renewing a
+// configured token so it outlives the router's use of it
+func (b *vaultBackend) authenticate(ctx context.Context) (string, error) {
+	var login map[string]string
+	switch b.config.Auth {
+	case "token":
+		b.token = b.config.Token
+		b.renewToken(ctx)
+		return b.config.Token, nil
+	case "kubernetes":
+		jwt, err := os.ReadFile(b.config.JWTFile)
+		if err != nil {
+			return "", err
+		}
+		login = map[string]string{"role": b.config.Role, "jwt": strings.TrimSpace(string(jwt))}
+	case "approle":
+		login = map[string]string{"role_id": b.config.RoleID, "secret_id": b.config.SecretID}
+	}
+
+	var response struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	if err := b.request(ctx, http.MethodPost, "/v1/auth/"+b.config.AuthMount+"/login", login, &response); err != nil {
+		return "", err
+	}
+	if response.Auth.ClientToken == "" {
+		return "", fmt.Errorf("login returned no token")
+	}
+	return response.Auth.ClientToken, nil
+}
+
+func (b *vaultBackend) renewToken(ctx context.Context) {
+	var lookup struct {
+		Data struct {
+			Renewable bool `json:"renewable"`
+		} `json:"data"`
+	}
+	if err := b.request(ctx, http.MethodGet, "/v1/auth/token/lookup-self", nil, &lookup); err != nil {
+		logrus.Warnf("Failed to look up the vault token: %v", err)
+		return
+	}
+	if !lookup.Data.Renewable {
+		return
+	}
+	if err := b.request(ctx, http.MethodPost, "/v1/auth/token/renew-self", map[string]string{}, nil); err != nil {
+		logrus.Warnf("Failed to renew the vault token: %v", err)
+	}
+}
+
+func (b *vaultBackend) request(ctx context.Context, method, path string, body, response interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimSuffix(b.config.Address, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	if b.token != "" {
+		req.Header.Set("X-Vault-Token", b.token)
+	}
+	if b.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", b.config.Namespace)
+	}
+
+	resp, err := b.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%s not found", strings.TrimPrefix(path, "/v1/"))
+	case resp.StatusCode >= 300:
+		var failure struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(io.LimitReader(resp.Body, 4096)).Decode(&failure)
+		return fmt.Errorf("vault returned %d: %s", resp.StatusCode, strings.Join(failure.Errors, "; "))
+	case response == nil:
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
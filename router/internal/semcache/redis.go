@@ -0,0 +1,232 @@
+package semcache
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RedisConfig points the cache at a Redis server shared by replicas
+type RedisConfig struct {
+	Addr         string        `yaml:"addr"` // host:port
+	Password     string        `yaml:"password"`
+	DB           int           `yaml:"db"`
+	Prefix       string        `yaml:"prefix"`       // key prefix, default "llm-router:semcache:"
+	SyncInterval time.Duration `yaml:"syncInterval"` // how often entries other replicas stored are picked up, default 5s
+}
+
+const redisTimeout = 2 * time.Second
+
+// redisStore keeps entries as keys expiring after the TTL, indexed by a
+// sorted set scored by when they were stored. A purge bumps a generation
+// counter, telling other replicas to drop what they mirror.
+type redisStore struct {
+	config     RedisConfig
+	ttl        time.Duration
+	maxEntries int
+
+	mu     sync.Mutex
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+// redisError is an error reply; the connection stays usable
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+
+func newRedisStore(config RedisConfig, ttl time.Duration, maxEntries int) *redisStore {
+	return &redisStore{config: config, ttl: ttl, maxEntries: maxEntries}
+}
+
+func (s *redisStore) ping() error {
+	_, err := s.do("PING")
+	return err
+}
+
+func (s *redisStore) put(entry *Entry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	stored := entry.Stored.UnixMilli()
+	index := s.config.Prefix + "index"
+	if _, err := s.do("SET", s.config.Prefix+"entry:"+entry.ID, string(data), "PX", strconv.FormatInt(s.ttl.Milliseconds(), 10)); err != nil {
+		return err
+	}
+	if _, err := s.do("ZADD", index, strconv.FormatInt(stored, 10), entry.ID); err != nil {
+		return err
+	}
+	if _, err := s.do("ZREMRANGEBYSCORE", index, "-inf", strconv.FormatInt(stored-s.ttl.Milliseconds(), 10)); err != nil {
+		return err
+	}
+	_, err = s.do("ZREMRANGEBYRANK", index, "0", strconv.Itoa(-s.maxEntries-1))
+	return err
+}
+
+// since returns the newest entries stored after t, up to the entry limit,
+// and the purge generation
+func (s *redisStore) since(t time.Time) ([]*Entry, string, error) {
+	reply, err := s.do("GET", s.config.Prefix+"generation")
+	if err != nil {
+		return nil, "", err
+	}
+	generation, _ := reply.(string)
+
+	reply, err = s.do("ZREVRANGEBYSCORE", s.config.Prefix+"index", "+inf", "("+strconv.FormatInt(t.UnixMilli(), 10),
+		"LIMIT", "0", strconv.Itoa(s.maxEntries))
+	if err != nil {
+		return nil, "", err
+	}
+	ids, _ := reply.([]interface{})
+	if len(ids) == 0 {
+		return nil, generation, nil
+	}
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[len(ids)-1-i] = s.config.Prefix + "entry:" + fmt.Sprint(id) // oldest first
+	}
+	reply, err = s.do(append([]string{"MGET"}, keys...)...)
+	if err != nil {
+		return nil, "", err
+	}
+	values, _ := reply.([]interface{})
+	entries := make([]*Entry, 0, len(values))
+	for _, value := range values {
+		data, ok := value.(string)
+		if !ok {
+			continue // expired
+		}
+		var entry Entry
+		if json.Unmarshal([]byte(data), &entry) == nil {
+			entries = append(entries, &entry)
+		}
+	}
+	return entries, generation, nil
+}
+
+// close drops the connection; a later command reconnects
+func (s *redisStore) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn != nil {
+		s.conn.Close()
+		s.conn = nil
+	}
+}
+
+func (s *redisStore) purge() error {
+	if _, err := s.do("DEL", s.config.Prefix+"index"); err != nil {
+		return err
+	}
+	_, err := s.do("INCR", s.config.Prefix+"generation")
+	return err
+}
+
+// do sends one command, connecting first if need be. Connection errors
+// drop the connection so the next command reconnects.
+func (s *redisStore) do(args ...string) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		if err := s.connect(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := s.roundTrip(args)
+	if _, ok := err.(redisError); err != nil && !ok {
+		s.conn.Close()
+		s.conn = nil
+	}
+	return reply, err
+}
+
+// connect dials and authenticates; callers hold s.mu
+func (s *redisStore) connect() error {
+	conn, err := net.DialTimeout("tcp", s.config.Addr, redisTimeout)
+	if err != nil {
+		return err
+	}
+	s.conn, s.reader = conn, bufio.NewReader(conn)
+	setup := [][]string{}
+	if s.config.Password != "" {
+		setup = append(setup, []string{"AUTH", s.config.Password})
+	}
+	if s.config.DB != 0 {
+		setup = append(setup, []string{"SELECT", strconv.Itoa(s.config.DB)})
+	}
+	for _, command := range setup {
+		if _, err := s.roundTrip(command); err != nil {
+			conn.Close()
+			s.conn = nil
+			return fmt.Errorf("%s: %w", command[0], err)
+		}
+	}
+	return nil
+}
+
+// roundTrip writes a command and reads its reply; callers hold s.mu
+func (s *redisStore) roundTrip(args []string) (interface{}, error) {
+	s.conn.SetDeadline(time.Now().Add(redisTimeout))
+	var command strings.Builder
+	fmt.Fprintf(&command, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&command, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := io.WriteString(s.conn, command.String()); err != nil {
+		return nil, err
+	}
+	return s.readReply()
+}
+
+// readReply reads one RESP reply: strings come back as string, integers
+// as int64, arrays as []interface{} and nil replies as nil
+func (s *redisStore) readReply() (interface{}, error) {
+	line, err := s.reader.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(s.reader, data); err != nil {
+			return nil, err
+		}
+		return string(data[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = s.readReply(); err != nil {
+				if _, ok := err.(redisError); !ok {
+					return nil, err
+				}
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("unexpected reply %q", line)
+}
@@ -0,0 +1,372 @@
+// Package semcache answers prompts that mean the same as one already
+// answered. Prompts are compared by the cosine similarity of their
+// embeddings, within a scope that holds everything else about the request
+// fixed.
+package semcache
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config sets up the cache and where its entries live
+type Config struct {
+	Enabled       bool          `yaml:"enabled"`
+	Target        string        `yaml:"target"`        // target embedding prompts
+	Model         string        `yaml:"model"`         // embeddings model
+	Threshold     float64       `yaml:"threshold"`     // cosine similarity a hit needs, default 0.95
+	TTL           time.Duration `yaml:"ttl"`           // default 1h
+	MaxEntries    int           `yaml:"maxEntries"`    // oldest evicted past this, default 1000
+	MaxBytes      int64         `yaml:"maxBytes"`      // or past this many bytes of responses and vectors, default 64MiB
+	MaxEntryBytes int           `yaml:"maxEntryBytes"` // larger responses aren't cached, default 1MiB
+	Timeout       time.Duration `yaml:"timeout"`       // per embedding call, default 2s
+	Shared        bool          `yaml:"shared"`        // tenants share entries; by default each tenant has its own
+	Store         string        `yaml:"store"`         // "memory" (default) or "redis"
+	Redis         RedisConfig   `yaml:"redis"`
+}
+
+// Entry is a cached response and the embedding of the prompt it answered
+type Entry struct {
+	ID          string    `json:"id"`
+	Scope       string    `json:"scope"`
+	Vector      []float32 `json:"vector"` // unit length
+	ContentType string    `json:"content_type,omitempty"`
+	Body        []byte    `json:"body"`
+	Stored      time.Time `json:"stored"`
+}
+
+// Stats reports the cache's size and effectiveness since start
+type Stats struct {
+	Store     string `json:"store"`
+	Entries   int    `json:"entries"`
+	Bytes     int64  `json:"bytes"`
+	Hits      int64  `json:"hits"`
+	Misses    int64  `json:"misses"`
+	Evictions int64  `json:"evictions"`
+}
+
+// Cache is an in-memory index of entries, mirrored to Redis when the store
+// is redis so replicas share what they cache. A nil *Cache caches nothing.
+type Cache struct {
+	config Config
+	redis  *redisStore
+
+	mu     sync.Mutex
+	scopes map[string]map[string]*Entry
+	order  []*Entry // oldest first, including entries since dropped
+	count  int
+	bytes  int64
+	stats  Stats
+}
+
+// New creates the cache, or returns nil when it is disabled
+func New(config Config) (*Cache, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	c := &Cache{config: config, scopes: make(map[string]map[string]*Entry)}
+	c.stats.Store = "memory"
+	if config.Store == "redis" {
+		c.stats.Store = "redis"
+		c.redis = newRedisStore(config.Redis, config.TTL, config.MaxEntries)
+		if err := c.redis.ping(); err != nil {
+			return nil, fmt.Errorf("redis %s: %w", config.Redis.Addr, err)
+		}
+	}
+	return c, nil
+}
+
+// Config returns the cache's configuration
+func (c *Cache) Config() Config {
+	return c.config
+}
+
+// Nearest returns the unexpired entry in scope most similar to vector, if
+// it meets the threshold, and the best similarity found
+func (c *Cache) Nearest(scope string, vector []float32) (*Entry, float64, bool) {
+	unit := normalize(vector)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var best *Entry
+	bestScore := -1.0
+	for _, entry := range c.scopes[scope] {
+		if time.Since(entry.Stored) > c.config.TTL {
+			c.remove(entry)
+			continue
+		}
+		if len(entry.Vector) != len(unit) {
+			continue // embedded by another model
+		}
+		if score := dot(entry.Vector, unit); score > bestScore {
+			best, bestScore = entry, score
+		}
+	}
+	if best == nil || bestScore < c.config.Threshold {
+		c.stats.Misses++
+		return nil, math.Max(bestScore, 0), false
+	}
+	c.stats.Hits++
+	return best, bestScore, true
+}
+
+// Fits reports whether a response of size bytes may be cached
+func (c *Cache) Fits(size int) bool {
+	return c != nil && size <= c.config.MaxEntryBytes
+}
+
+// Add caches a response to a prompt embedded as vector
+func (c *Cache) Add(scope string, vector []float32, contentType string, body []byte) {
+	if !c.Fits(len(body)) {
+		return
+	}
+	entry := &Entry{ID: newID(), Scope: scope, Vector: normalize(vector), ContentType: contentType, Body: body, Stored: time.Now()}
+	c.mu.Lock()
+	c.insert(entry)
+	c.mu.Unlock()
+	if c.redis != nil {
+		go func() {
+			if err := c.redis.put(entry); err != nil {
+				logrus.Warnf("Failed to store semantic cache entry in Redis: %v", err)
+			}
+		}()
+	}
+}
+
+// insert indexes an entry, evicting the oldest past MaxEntries; callers
+// hold c.mu
+func (c *Cache) insert(entry *Entry) {
+	entries := c.scopes[entry.Scope]
+	if entries == nil {
+		entries = make(map[string]*Entry)
+		c.scopes[entry.Scope] = entries
+	}
+	if _, ok := entries[entry.ID]; ok {
+		return
+	}
+	entries[entry.ID] = entry
+	c.order = append(c.order, entry)
+	c.count++
+	c.bytes += entry.size()
+
+	for len(c.order) > 0 {
+		oldest := c.order[0]
+		if _, ok := c.scopes[oldest.Scope][oldest.ID]; ok && c.count <= c.config.MaxEntries && c.bytes <= c.config.MaxBytes {
+			break
+		}
+		c.order = c.order[1:]
+		if c.remove(oldest) {
+			c.stats.Evictions++
+		}
+	}
+}
+
+// remove drops an entry, reporting whether it was indexed; callers hold
+// c.mu
+func (c *Cache) remove(entry *Entry) bool {
+	entries := c.scopes[entry.Scope]
+	if _, ok := entries[entry.ID]; !ok {
+		return false
+	}
+	delete(entries, entry.ID)
+	if len(entries) == 0 {
+		delete(c.scopes, entry.Scope)
+	}
+	c.count--
+	c.bytes -= entry.size()
+	return true
+}
+
+// size is roughly the memory an entry holds
+func (e *Entry) size() int64 {
+	return int64(len(e.Body) + 4*len(e.Vector) + len(e.Scope) + len(e.ContentType))
+}
+
+// Purge empties the cache, on every replica when the store is redis, and
+// returns how many entries it held
+func (c *Cache) Purge() (int, error) {
+	if c == nil {
+		return 0, nil
+	}
+	c.mu.Lock()
+	n := c.count
+	c.clear()
+	c.mu.Unlock()
+	if c.redis != nil {
+		return n, c.redis.purge()
+	}
+	return n, nil
+}
+
+// clear drops every entry; callers hold c.mu
+func (c *Cache) clear() {
+	c.scopes = make(map[string]map[string]*Entry)
+	c.order = nil
+	c.count = 0
+	c.bytes = 0
+}
+
+// Stats returns the cache's counters
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = c.count
+	stats.Bytes = c.bytes
+	return stats
+}
+
+// Interval is how often Start syncs from Redis
+func (c *Cache) Interval() time.Duration {
+	return c.config.Redis.SyncInterval
+}
+
+// Start keeps the index in step with the entries other replicas store in
+// Redis until ctx is done. It only runs for the redis store.
+func (c *Cache) Start(ctx context.Context, beat func()) {
+	ticker := time.NewTicker(c.config.Redis.SyncInterval)
+	defer ticker.Stop()
+	defer c.redis.close()
+
+	since := time.Now().Add(-c.config.TTL)
+	generation, synced := "", false
+	for {
+		entries, current, err := c.redis.since(since)
+		if err != nil {
+			logrus.Warnf("Failed to sync the semantic cache from Redis: %v", err)
+		} else {
+			c.mu.Lock()
+			if synced && current != generation {
+				c.clear() // purged elsewhere
+			}
+			generation, synced = current, true
+			for _, entry := range entries {
+				c.insert(entry)
+				if entry.Stored.After(since) {
+					since = entry.Stored
+				}
+			}
+			c.mu.Unlock()
+		}
+		beat()
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Prompt returns the text of a chat or completion request's prompt. It
+// returns false for requests with content other than text, such as images,
+// whose meaning their text alone doesn't capture.
+func Prompt(body []byte) (string, bool) {
+	var request struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+		Prompt json.RawMessage `json:"prompt"`
+	}
+	if json.Unmarshal(body, &request) != nil {
+		return "", false
+	}
+	if request.Messages == nil {
+		var prompt string
+		if json.Unmarshal(request.Prompt, &prompt) != nil {
+			return "", false
+		}
+		return prompt, prompt != ""
+	}
+
+	var text strings.Builder
+	for _, message := range request.Messages {
+		content, ok := textContent(message.Content)
+		if !ok {
+			return "", false
+		}
+		fmt.Fprintf(&text, "%s: %s\n", message.Role, content)
+	}
+	return text.String(), text.Len() > 0
+}
+
+// textContent reads message content that is a string or text parts
+func textContent(raw json.RawMessage) (string, bool) {
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", true
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return text, true
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if json.Unmarshal(raw, &parts) != nil {
+		return "", false
+	}
+	texts := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part.Type != "text" {
+			return "", false
+		}
+		texts = append(texts, part.Text)
+	}
+	return strings.Join(texts, "\n"), true
+}
+
+// Embedding reads the first vector of an OpenAI-format embeddings response
+func Embedding(body []byte) ([]float32, error) {
+	var response struct {
+		Data []struct {
+			Embedding []float32 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, err
+	}
+	if len(response.Data) == 0 || len(response.Data[0].Embedding) == 0 {
+		return nil, fmt.Errorf("no embedding in response")
+	}
+	return response.Data[0].Embedding, nil
+}
+
+func normalize(vector []float32) []float32 {
+	var sum float64
+	for _, v := range vector {
+		sum += float64(v) * float64(v)
+	}
+	norm := math.Sqrt(sum)
+	unit := make([]float32, len(vector))
+	if norm == 0 {
+		return unit
+	}
+	for i, v := range vector {
+		unit[i] = float32(float64(v) / norm)
+	}
+	return unit
+}
+
+func dot(a, b []float32) float64 {
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
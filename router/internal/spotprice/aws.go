@@ -0,0 +1,109 @@
+package spotprice
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/sigv4"
+)
+
+// awsFeed reads EC2's spot price history, whose newest entry per zone is
+// the price in effect
+type awsFeed struct {
+	config Config
+	client *http.Client
+	creds  sigv4.Credentials
+}
+
+func newAWSFeed(config Config, client *http.Client) *awsFeed {
+	if config.ProductDescription == "" {
+		config.ProductDescription = "Linux/UNIX"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://ec2." + config.Region + ".amazonaws.com"
+	}
+	return &awsFeed{config: config, client: client, creds: sigv4.FromEnv()}
+}
+
+type spotPriceHistory struct {
+	Items []struct {
+		SpotPrice        string    `xml:"spotPrice"`
+		AvailabilityZone string    `xml:"availabilityZone"`
+		Timestamp        time.Time `xml:"timestamp"`
+	} `xml:"spotPriceHistorySet>item"`
+	Errors []struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	} `xml:"Errors>Error"`
+}
+
+// Price returns the current spot price, averaged over zones unless the
+// config names one
+func (f *awsFeed) Price(ctx context.Context) (float64, error) {
+	query := url.Values{
+		"Action":               {"DescribeSpotPriceHistory"},
+		"Version":              {"2016-11-15"},
+		"InstanceType.1":       {f.config.InstanceType},
+		"ProductDescription.1": {f.config.ProductDescription},
+		"StartTime":            {time.Now().UTC().Format(time.RFC3339)},
+	}
+	if f.config.AvailabilityZone != "" {
+		query.Set("AvailabilityZone", f.config.AvailabilityZone)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.config.Endpoint+"/?"+query.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	sigv4.Sign(req, nil, f.creds, f.config.Region, "ec2", time.Now())
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return 0, err
+	}
+
+	var history spotPriceHistory
+	if err := xml.Unmarshal(body, &history); err != nil {
+		return 0, fmt.Errorf("unexpected DescribeSpotPriceHistory response (status %d): %w", resp.StatusCode, err)
+	}
+	if len(history.Errors) > 0 {
+		return 0, fmt.Errorf("DescribeSpotPriceHistory: %s: %s", history.Errors[0].Code, history.Errors[0].Message)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("DescribeSpotPriceHistory returned status %d", resp.StatusCode)
+	}
+
+	// Entries are newest first, but keep the newest per zone regardless
+	type entry struct {
+		price float64
+		at    time.Time
+	}
+	latest := make(map[string]entry)
+	for _, item := range history.Items {
+		price, err := strconv.ParseFloat(item.SpotPrice, 64)
+		if err != nil {
+			continue
+		}
+		if current, ok := latest[item.AvailabilityZone]; !ok || item.Timestamp.After(current.at) {
+			latest[item.AvailabilityZone] = entry{price: price, at: item.Timestamp}
+		}
+	}
+	if len(latest) == 0 {
+		return 0, fmt.Errorf("no spot price for %s in %s", f.config.InstanceType, f.config.Region)
+	}
+	sum := 0.0
+	for _, e := range latest {
+		sum += e.price
+	}
+	return sum / float64(len(latest)), nil
+}
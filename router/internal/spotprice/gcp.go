@@ -0,0 +1,132 @@
+package spotprice
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// computeEngineService is Compute Engine's Cloud Billing service ID
+const computeEngineService = "6F81-5844-456A"
+
+// gcpFeed prices a machine from Compute Engine's public SKU catalog. SKUs
+// are matched by description and region, and summed by quantity.
+type gcpFeed struct {
+	config Config
+	client *http.Client
+}
+
+func newGCPFeed(config Config, client *http.Client) *gcpFeed {
+	if config.Endpoint == "" {
+		config.Endpoint = "https://cloudbilling.googleapis.com"
+	}
+	return &gcpFeed{config: config, client: client}
+}
+
+type skuPage struct {
+	SKUs []struct {
+		Description    string   `json:"description"`
+		ServiceRegions []string `json:"serviceRegions"`
+		PricingInfo    []struct {
+			PricingExpression struct {
+				TieredRates []struct {
+					UnitPrice struct {
+						Units string `json:"units"`
+						Nanos int64  `json:"nanos"`
+					} `json:"unitPrice"`
+				} `json:"tieredRates"`
+			} `json:"pricingExpression"`
+		} `json:"pricingInfo"`
+	} `json:"skus"`
+	NextPageToken string `json:"nextPageToken"`
+}
+
+// Price returns the hourly price of one machine's SKUs
+func (f *gcpFeed) Price(ctx context.Context) (float64, error) {
+	wanted := make(map[string]float64, len(f.config.SKUs))
+	for description, quantity := range f.config.SKUs {
+		wanted[strings.ToLower(description)] = quantity
+	}
+
+	total := 0.0
+	found := make(map[string]bool)
+	pageToken := ""
+	for {
+		page, err := f.page(ctx, pageToken)
+		if err != nil {
+			return 0, err
+		}
+		for _, sku := range page.SKUs {
+			description := strings.ToLower(sku.Description)
+			quantity, ok := wanted[description]
+			if !ok || found[description] || !containsRegion(sku.ServiceRegions, f.config.Region) || len(sku.PricingInfo) == 0 {
+				continue
+			}
+			rates := sku.PricingInfo[0].PricingExpression.TieredRates
+			if len(rates) == 0 {
+				continue
+			}
+			// The last tier is the rate past any free usage
+			unitPrice := rates[len(rates)-1].UnitPrice
+			units, _ := strconv.ParseFloat(unitPrice.Units, 64)
+			total += quantity * (units + float64(unitPrice.Nanos)/1e9)
+			found[description] = true
+		}
+		if page.NextPageToken == "" || len(found) == len(wanted) {
+			break
+		}
+		pageToken = page.NextPageToken
+	}
+
+	if len(found) < len(wanted) {
+		var missing []string
+		for description := range f.config.SKUs {
+			if !found[strings.ToLower(description)] {
+				missing = append(missing, description)
+			}
+		}
+		sort.Strings(missing)
+		return 0, fmt.Errorf("no SKU in %s matches %s", f.config.Region, strings.Join(missing, ", "))
+	}
+	return total, nil
+}
+
+func (f *gcpFeed) page(ctx context.Context, pageToken string) (*skuPage, error) {
+	query := url.Values{"key": {f.config.APIKey}, "pageSize": {"5000"}}
+	if pageToken != "" {
+		query.Set("pageToken", pageToken)
+	}
+	endpoint := f.config.Endpoint + "/v1/services/" + computeEngineService + "/skus?" + query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Cloud Billing catalog returned status %d", resp.StatusCode)
+	}
+
+	var page skuPage
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, fmt.Errorf("unexpected Cloud Billing catalog response: %w", err)
+	}
+	return &page, nil
+}
+
+func containsRegion(regions []string, region string) bool {
+	for _, r := range regions {
+		if r == region {
+			return true
+		}
+	}
+	return false
+}
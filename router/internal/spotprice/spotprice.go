@@ -0,0 +1,184 @@
+// Package spotprice polls cloud spot prices, so clusters running on spot
+// capacity are costed at what their nodes cost now rather than at a fixed
+// hourly rate
+package spotprice
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config prices one cluster's nodes from a spot price feed. The cluster
+// costs baseCostPerHour plus nodes times the current spot price.
+type Config struct {
+	Source          string        `yaml:"source"`          // "aws" or "gcp"
+	Region          string        `yaml:"region"`          // e.g. us-west-2 or us-central1
+	Nodes           float64       `yaml:"nodes"`           // spot instances the cluster runs, default 1
+	BaseCostPerHour float64       `yaml:"baseCostPerHour"` // on-demand share such as the control plane
+	Interval        time.Duration `yaml:"interval"`        // how often the price is fetched, default 10m
+	Endpoint        string        `yaml:"endpoint"`        // API base URL, default the cloud's public endpoint
+
+	// AWS
+	InstanceType       string `yaml:"instanceType"`
+	AvailabilityZone   string `yaml:"availabilityZone"`   // default every zone in the region, averaged
+	ProductDescription string `yaml:"productDescription"` // default Linux/UNIX
+
+	// GCP prices a machine from its parts, by Cloud Billing SKU description
+	// and quantity, e.g. "Spot Preemptible G2 Instance Core": 4
+	SKUs   map[string]float64 `yaml:"skus"`
+	APIKey string             `yaml:"apiKey"` // Cloud Billing Catalog API key
+}
+
+// Feed fetches the current hourly price of one node
+type Feed interface {
+	Price(ctx context.Context) (float64, error)
+}
+
+// newFeed builds the feed for config.Source
+func newFeed(config Config, client *http.Client) (Feed, error) {
+	switch config.Source {
+	case "aws":
+		if config.InstanceType == "" || config.Region == "" {
+			return nil, fmt.Errorf("aws spot prices need region and instanceType")
+		}
+		return newAWSFeed(config, client), nil
+	case "gcp":
+		if len(config.SKUs) == 0 || config.Region == "" || config.APIKey == "" {
+			return nil, fmt.Errorf("gcp spot prices need region, apiKey and skus")
+		}
+		return newGCPFeed(config, client), nil
+	default:
+		return nil, fmt.Errorf("unknown spot price source %q", config.Source)
+	}
+}
+
+// Status is the last price seen for a cluster
+type Status struct {
+	Source      string    `json:"source"`
+	SpotPrice   float64   `json:"spot_price"`    // per node hour, 0 until fetched
+	CostPerHour float64   `json:"cost_per_hour"` // what the cluster is costed at
+	Updated     time.Time `json:"updated"`
+	Error       string    `json:"error,omitempty"` // last fetch error; the previous price stays in effect
+}
+
+type tracked struct {
+	config Config
+	feed   Feed
+	next   time.Time
+	status Status
+}
+
+// Monitor polls the feed of every spot-priced cluster, reporting each new
+// hourly cost through apply
+type Monitor struct {
+	mu       sync.Mutex
+	clusters map[string]*tracked
+	interval time.Duration
+	apply    func(cluster string, costPerHour float64)
+}
+
+// New creates a monitor for the clusters with a spot price config. It
+// returns nil when there are none.
+func New(configs map[string]Config, apply func(cluster string, costPerHour float64)) (*Monitor, error) {
+	if len(configs) == 0 {
+		return nil, nil
+	}
+	client := &http.Client{Timeout: 30 * time.Second}
+	m := &Monitor{clusters: make(map[string]*tracked), apply: apply}
+	for cluster, config := range configs {
+		if config.Nodes == 0 {
+			config.Nodes = 1
+		}
+		if config.Interval == 0 {
+			config.Interval = 10 * time.Minute
+		}
+		feed, err := newFeed(config, client)
+		if err != nil {
+			return nil, fmt.Errorf("cluster %s: %w", cluster, err)
+		}
+		m.clusters[cluster] = &tracked{config: config, feed: feed, status: Status{Source: config.Source}}
+		if m.interval == 0 || config.Interval < m.interval {
+			m.interval = config.Interval
+		}
+	}
+	return m, nil
+}
+
+// Interval is how often Start checks for feeds due a fetch
+func (m *Monitor) Interval() time.Duration {
+	return m.interval
+}
+
+// Start fetches prices until ctx is done, each feed at its own interval
+func (m *Monitor) Start(ctx context.Context, beat func()) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.poll(ctx, false)
+		beat()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh fetches every feed now, whether or not it is due
+func (m *Monitor) Refresh(ctx context.Context) {
+	m.poll(ctx, true)
+}
+
+// poll fetches every feed that is due, or every feed with all
+func (m *Monitor) poll(ctx context.Context, all bool) {
+	now := time.Now()
+	m.mu.Lock()
+	var due []string
+	for cluster, t := range m.clusters {
+		if all || !now.Before(t.next) {
+			due = append(due, cluster)
+			t.next = now.Add(t.config.Interval)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, cluster := range due {
+		m.mu.Lock()
+		t := m.clusters[cluster]
+		m.mu.Unlock()
+
+		fetchCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		price, err := t.feed.Price(fetchCtx)
+		cancel()
+
+		m.mu.Lock()
+		if err != nil {
+			logrus.Warnf("Failed to fetch spot price for cluster %s, keeping the previous cost: %v", cluster, err)
+			t.status.Error = err.Error()
+			m.mu.Unlock()
+			continue
+		}
+		cost := t.config.BaseCostPerHour + t.config.Nodes*price
+		t.status = Status{Source: t.config.Source, SpotPrice: price, CostPerHour: cost, Updated: time.Now()}
+		m.mu.Unlock()
+		m.apply(cluster, cost)
+	}
+}
+
+// Status returns the last price seen for each cluster
+func (m *Monitor) Status() map[string]Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	status := make(map[string]Status, len(m.clusters))
+	for cluster, t := range m.clusters {
+		status[cluster] = t.status
+	}
+	return status
+}
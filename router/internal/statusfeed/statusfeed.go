@@ -0,0 +1,357 @@
+package statusfeed
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Feed formats
+const (
+	FormatStatuspage = "statuspage" // Atlassian Statuspage /api/v2/summary.json
+	FormatRSS        = "rss"        // RSS 2.0 incident history
+	FormatGCloud     = "gcloud"     // Google Cloud incidents.json
+)
+
+// Config configures status feed polling
+type Config struct {
+	Enabled  bool          `yaml:"enabled"`
+	Interval time.Duration `yaml:"interval"` // default 2m
+	Lookback time.Duration `yaml:"lookback"` // RSS items newer than this count as active, default 6h
+	Penalty  PenaltyConfig `yaml:"penalty"`
+	Feeds    []FeedConfig  `yaml:"feeds"` // defaults to DefaultFeeds when empty
+}
+
+// PenaltyConfig sets the cost multiplier applied to providers by incident impact
+type PenaltyConfig struct {
+	Minor    float64 `yaml:"minor"`    // default 2
+	Major    float64 `yaml:"major"`    // default 5
+	Critical float64 `yaml:"critical"` // default 20
+}
+
+// FeedConfig describes one provider status feed
+type FeedConfig struct {
+	ProviderType string `yaml:"providerType"` // provider type the feed covers: openai, claude, gemini
+	URL          string `yaml:"url"`
+	Format       string `yaml:"format"`
+	Match        string `yaml:"match,omitempty"` // only incidents mentioning this (case-insensitive) count
+}
+
+// DefaultFeeds are the public status feeds of the built-in provider types
+var DefaultFeeds = []FeedConfig{
+	{ProviderType: "openai", URL: "https://status.openai.com/api/v2/summary.json", Format: FormatStatuspage},
+	{ProviderType: "claude", URL: "https://status.anthropic.com/api/v2/summary.json", Format: FormatStatuspage},
+	{ProviderType: "gemini", URL: "https://status.cloud.google.com/incidents.json", Format: FormatGCloud, Match: "Gemini"},
+}
+
+// Incident is an active incident reported by a feed
+type Incident struct {
+	Name      string    `json:"name"`
+	Impact    string    `json:"impact"` // minor, major or critical
+	Status    string    `json:"status,omitempty"`
+	URL       string    `json:"url,omitempty"`
+	StartedAt time.Time `json:"started_at,omitempty"`
+}
+
+// FeedStatus is a feed's latest poll result
+type FeedStatus struct {
+	ProviderType string     `json:"provider_type"`
+	URL          string     `json:"url"`
+	Incidents    []Incident `json:"incidents"`
+	LastChecked  time.Time  `json:"last_checked"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// Monitor polls status feeds and tracks active incidents per provider type
+type Monitor struct {
+	config     Config
+	httpClient *http.Client
+
+	mu       sync.RWMutex
+	statuses []FeedStatus
+}
+
+// NewMonitor creates a monitor, filling unset config values with defaults
+func NewMonitor(config Config) *Monitor {
+	if config.Interval == 0 {
+		config.Interval = 2 * time.Minute
+	}
+	if config.Lookback == 0 {
+		config.Lookback = 6 * time.Hour
+	}
+	if config.Penalty.Minor == 0 {
+		config.Penalty.Minor = 2
+	}
+	if config.Penalty.Major == 0 {
+		config.Penalty.Major = 5
+	}
+	if config.Penalty.Critical == 0 {
+		config.Penalty.Critical = 20
+	}
+	if len(config.Feeds) == 0 {
+		config.Feeds = DefaultFeeds
+	}
+
+	m := &Monitor{
+		config:     config,
+		httpClient: &http.Client{Timeout: 15 * time.Second},
+		statuses:   make([]FeedStatus, len(config.Feeds)),
+	}
+	for i, feed := range config.Feeds {
+		m.statuses[i] = FeedStatus{ProviderType: feed.ProviderType, URL: feed.URL}
+	}
+	return m
+}
+
+// Interval returns the polling interval
+func (m *Monitor) Interval() time.Duration {
+	return m.config.Interval
+}
+
+// Start polls every feed until ctx is cancelled, calling beat after each round
+func (m *Monitor) Start(ctx context.Context, beat func()) {
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+
+	m.pollAll(ctx)
+	beat()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.pollAll(ctx)
+			beat()
+		}
+	}
+}
+
+func (m *Monitor) pollAll(ctx context.Context) {
+	for i, feed := range m.config.Feeds {
+		incidents, err := m.poll(ctx, feed)
+
+		m.mu.Lock()
+		status := &m.statuses[i]
+		status.LastChecked = time.Now()
+		if err != nil {
+			// Keep the last known incidents; a flaky status page is not an all-clear
+			status.Error = err.Error()
+			logrus.Debugf("Status feed %s failed: %v", feed.URL, err)
+		} else {
+			if len(incidents) > 0 && len(status.Incidents) == 0 {
+				logrus.Warnf("Status feed reports %d active incident(s) for %s: %s",
+					len(incidents), feed.ProviderType, incidents[0].Name)
+			}
+			status.Error = ""
+			status.Incidents = incidents
+		}
+		m.mu.Unlock()
+	}
+}
+
+func (m *Monitor) poll(ctx context.Context, feed FeedConfig) ([]Incident, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", feed.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := m.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("status %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return nil, err
+	}
+
+	var incidents []Incident
+	switch feed.Format {
+	case FormatStatuspage, "":
+		incidents, err = parseStatuspage(body)
+	case FormatRSS:
+		incidents, err = parseRSS(body, m.config.Lookback)
+	case FormatGCloud:
+		incidents, err = parseGCloud(body)
+	default:
+		return nil, fmt.Errorf("unknown feed format %q", feed.Format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if feed.Match == "" {
+		return incidents, nil
+	}
+	matched := incidents[:0]
+	for _, incident := range incidents {
+		if strings.Contains(strings.ToLower(incident.Name), strings.ToLower(feed.Match)) {
+			matched = append(matched, incident)
+		}
+	}
+	return matched, nil
+}
+
+func parseStatuspage(body []byte) ([]Incident, error) {
+	var summary struct {
+		Incidents []struct {
+			Name      string    `json:"name"`
+			Status    string    `json:"status"`
+			Impact    string    `json:"impact"`
+			Shortlink string    `json:"shortlink"`
+			StartedAt time.Time `json:"started_at"`
+		} `json:"incidents"`
+	}
+	if err := json.Unmarshal(body, &summary); err != nil {
+		return nil, err
+	}
+
+	var incidents []Incident
+	for _, incident := range summary.Incidents {
+		if incident.Status == "resolved" || incident.Status == "postmortem" {
+			continue
+		}
+		incidents = append(incidents, Incident{
+			Name:      incident.Name,
+			Impact:    normalizeImpact(incident.Impact),
+			Status:    incident.Status,
+			URL:       incident.Shortlink,
+			StartedAt: incident.StartedAt,
+		})
+	}
+	return incidents, nil
+}
+
+func parseRSS(body []byte, lookback time.Duration) ([]Incident, error) {
+	var feed struct {
+		Items []struct {
+			Title       string `xml:"title"`
+			Link        string `xml:"link"`
+			Description string `xml:"description"`
+			PubDate     string `xml:"pubDate"`
+		} `xml:"channel>item"`
+	}
+	if err := xml.Unmarshal(body, &feed); err != nil {
+		return nil, err
+	}
+
+	// RSS carries no machine-readable state: recent items whose latest
+	// update isn't a resolution are treated as active minor incidents
+	cutoff := time.Now().Add(-lookback)
+	var incidents []Incident
+	for _, item := range feed.Items {
+		published, err := time.Parse(time.RFC1123Z, item.PubDate)
+		if err != nil {
+			published, err = time.Parse(time.RFC1123, item.PubDate)
+		}
+		if err != nil || published.Before(cutoff) {
+			continue
+		}
+		text := strings.ToLower(item.Title + " " + item.Description)
+		if strings.Contains(text, "resolved") || strings.Contains(text, "completed") {
+			continue
+		}
+		incidents = append(incidents, Incident{
+			Name:      item.Title,
+			Impact:    "minor",
+			URL:       item.Link,
+			StartedAt: published,
+		})
+	}
+	return incidents, nil
+}
+
+func parseGCloud(body []byte) ([]Incident, error) {
+	var entries []struct {
+		ExternalDesc string    `json:"external_desc"`
+		ServiceName  string    `json:"service_name"`
+		Severity     string    `json:"severity"`
+		Begin        time.Time `json:"begin"`
+		End          string    `json:"end"`
+		URI          string    `json:"uri"`
+		Products     []struct {
+			Title string `json:"title"`
+		} `json:"affected_products"`
+	}
+	if err := json.Unmarshal(body, &entries); err != nil {
+		return nil, err
+	}
+
+	var incidents []Incident
+	for _, entry := range entries {
+		if entry.End != "" {
+			continue
+		}
+		name := entry.ServiceName + ": " + entry.ExternalDesc
+		for _, product := range entry.Products {
+			name += " [" + product.Title + "]"
+		}
+		incidents = append(incidents, Incident{
+			Name:      name,
+			Impact:    normalizeImpact(entry.Severity),
+			URL:       "https://status.cloud.google.com/" + strings.TrimPrefix(entry.URI, "/"),
+			StartedAt: entry.Begin,
+		})
+	}
+	return incidents, nil
+}
+
+// normalizeImpact maps feed-specific severities onto minor, major and critical
+func normalizeImpact(impact string) string {
+	switch strings.ToLower(impact) {
+	case "critical", "high":
+		return "critical"
+	case "major", "medium":
+		return "major"
+	default:
+		return "minor"
+	}
+}
+
+// Penalty returns the routing cost multiplier for a provider type, driven by
+// its most severe active incident, and that incident's name. 1 means no incident.
+func (m *Monitor) Penalty(providerType string) (float64, string) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	penalty, reason := 1.0, ""
+	for _, status := range m.statuses {
+		if status.ProviderType != providerType {
+			continue
+		}
+		for _, incident := range status.Incidents {
+			factor := m.config.Penalty.Minor
+			switch incident.Impact {
+			case "major":
+				factor = m.config.Penalty.Major
+			case "critical":
+				factor = m.config.Penalty.Critical
+			}
+			if factor > penalty {
+				penalty, reason = factor, incident.Name
+			}
+		}
+	}
+	return penalty, reason
+}
+
+// Status returns every feed's latest poll result
+func (m *Monitor) Status() []FeedStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	statuses := make([]FeedStatus, len(m.statuses))
+	copy(statuses, m.statuses)
+	return statuses
+}
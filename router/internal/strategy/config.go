@@ -0,0 +1,260 @@
+package strategy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config holds per-strategy settings, one block per strategy so new
+// strategies don't add fields to the global router config
+type Config struct {
+	Hybrid   HybridConfig   `yaml:"hybrid" json:"hybrid"`
+	Score    ScoreConfig    `yaml:"score" json:"score"`
+	Weighted WeightedConfig `yaml:"weighted" json:"weighted"`
+	Hedging  HedgingConfig  `yaml:"hedging" json:"hedging"`
+	Latency  LatencyConfig  `yaml:"latency" json:"latency"`
+	Bandit   BanditConfig   `yaml:"bandit" json:"bandit"`
+}
+
+// HybridConfig tunes the hybrid strategy
+type HybridConfig struct {
+	ClusterCostThreshold float64 `yaml:"clusterCostThreshold" json:"clusterCostThreshold"` // $/1K tokens under which clusters win
+}
+
+// ScoreConfig weighs normalized cost, latency and queue depth; the lowest
+// weighted sum wins
+type ScoreConfig struct {
+	CostWeight    float64 `yaml:"costWeight" json:"costWeight"`
+	LatencyWeight float64 `yaml:"latencyWeight" json:"latencyWeight"`
+	QueueWeight   float64 `yaml:"queueWeight" json:"queueWeight"`
+}
+
+// WeightedConfig overrides target weights with explicit traffic percentages
+type WeightedConfig struct {
+	Percentages map[string]float64 `yaml:"percentages" json:"percentages"` // target name -> percent, summing to 100
+}
+
+// HedgingConfig controls speculative duplicate requests
+type HedgingConfig struct {
+	Enabled      bool     `yaml:"enabled" json:"enabled"`
+	Delay        Duration `yaml:"delay" json:"delay"`               // wait before sending a hedge
+	DelayFromP95 bool     `yaml:"delayFromP95" json:"delayFromP95"` // wait the target's p95 latency instead, when known
+	MaxHedges    int      `yaml:"maxHedges" json:"maxHedges"`
+}
+
+// LatencyConfig tunes the live latency estimate used by latency-aware strategies
+type LatencyConfig struct {
+	EWMAAlpha float64 `yaml:"ewmaAlpha" json:"ewmaAlpha"` // weight of the newest observation, (0, 1]
+}
+
+// BanditConfig prices what the bandit strategy learns from. A response's
+// reward is -(cost + latencyWeight × latency seconds + errorPenalty if it
+// failed), all in dollars, so the weights say what a second of waiting and
+// a failure are worth.
+type BanditConfig struct {
+	LatencyWeight float64 `yaml:"latencyWeight" json:"latencyWeight"` // $ per second of latency
+	ErrorPenalty  float64 `yaml:"errorPenalty" json:"errorPenalty"`   // $ per failed request
+	Discount      float64 `yaml:"discount" json:"discount"`           // weight kept by earlier observations at each new one, (0, 1]
+}
+
+// Duration is a time.Duration written as a string ("250ms") in YAML and JSON
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string like \"250ms\"")
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return time.Duration(d).String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(node *yaml.Node) error {
+	parsed, err := time.ParseDuration(node.Value)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// UnmarshalYAML rejects unknown keys so typos in strategy blocks surface at
+// startup instead of silently falling back to defaults
+func (c *Config) UnmarshalYAML(node *yaml.Node) error {
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return err
+	}
+
+	type plain Config
+	var decoded plain
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&decoded); err != nil {
+		return fmt.Errorf("strategies: %w", err)
+	}
+	*c = Config(decoded)
+	return nil
+}
+
+// Validate checks value ranges across all strategy blocks
+func (c Config) Validate() error {
+	if c.Hybrid.ClusterCostThreshold < 0 {
+		return fmt.Errorf("hybrid.clusterCostThreshold must not be negative")
+	}
+
+	s := c.Score
+	if s.CostWeight < 0 || s.LatencyWeight < 0 || s.QueueWeight < 0 {
+		return fmt.Errorf("score weights must not be negative")
+	}
+	if s.CostWeight+s.LatencyWeight+s.QueueWeight == 0 {
+		return fmt.Errorf("score weights must not all be zero")
+	}
+
+	if len(c.Weighted.Percentages) > 0 {
+		total := 0.0
+		for name, pct := range c.Weighted.Percentages {
+			if pct < 0 || pct > 100 {
+				return fmt.Errorf("weighted.percentages[%s] must be between 0 and 100", name)
+			}
+			total += pct
+		}
+		if math.Abs(total-100) > 0.01 {
+			return fmt.Errorf("weighted.percentages must sum to 100, got %.2f", total)
+		}
+	}
+
+	if c.Hedging.Delay < 0 {
+		return fmt.Errorf("hedging.delay must not be negative")
+	}
+	if c.Hedging.MaxHedges < 0 {
+		return fmt.Errorf("hedging.maxHedges must not be negative")
+	}
+	if c.Latency.EWMAAlpha <= 0 || c.Latency.EWMAAlpha > 1 {
+		return fmt.Errorf("latency.ewmaAlpha must be in (0, 1]")
+	}
+	if c.Bandit.LatencyWeight < 0 || c.Bandit.ErrorPenalty < 0 {
+		return fmt.Errorf("bandit weights must not be negative")
+	}
+	if c.Bandit.Discount <= 0 || c.Bandit.Discount > 1 {
+		return fmt.Errorf("bandit.discount must be in (0, 1]")
+	}
+	return nil
+}
+
+// SetDefaults fills unset values. legacyThreshold is the flat
+// router.clusterCostThreshold, still honored when the hybrid block is unset.
+func (c *Config) SetDefaults(legacyThreshold float64) {
+	if c.Hybrid.ClusterCostThreshold == 0 {
+		c.Hybrid.ClusterCostThreshold = legacyThreshold
+	}
+	if c.Score.CostWeight == 0 && c.Score.LatencyWeight == 0 && c.Score.QueueWeight == 0 {
+		c.Score = ScoreConfig{CostWeight: 0.5, LatencyWeight: 0.3, QueueWeight: 0.2}
+	}
+	if c.Hedging.Delay == 0 {
+		c.Hedging.Delay = Duration(500 * time.Millisecond)
+	}
+	if c.Hedging.MaxHedges == 0 {
+		c.Hedging.MaxHedges = 1
+	}
+	if c.Latency.EWMAAlpha == 0 {
+		c.Latency.EWMAAlpha = 0.3
+	}
+	if c.Bandit.LatencyWeight == 0 {
+		c.Bandit.LatencyWeight = 0.001
+	}
+	if c.Bandit.ErrorPenalty == 0 {
+		c.Bandit.ErrorPenalty = 0.01
+	}
+	if c.Bandit.Discount == 0 {
+		c.Bandit.Discount = 0.995
+	}
+}
+
+// Store holds the live strategy config, which the admin API may patch at runtime
+type Store struct {
+	mu     sync.RWMutex
+	config Config
+}
+
+// NewStore validates config and wraps it in a store
+func NewStore(config Config) (*Store, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &Store{config: config}, nil
+}
+
+// Get returns the current config
+func (s *Store) Get() Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.config
+}
+
+// Set replaces the current config if it validates
+func (s *Store) Set(config Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.config = config
+	return nil
+}
+
+// Patch merges a JSON document into the current config, replacing it only
+// if the result validates. Maps such as weighted.percentages are replaced
+// whole rather than merged.
+func (s *Store) Patch(patch []byte) (Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Copy the percentages map unless the patch replaces it, so a
+	// rejected patch can't leave a half-merged map behind
+	var fields struct {
+		Weighted struct {
+			Percentages json.RawMessage `json:"percentages"`
+		} `json:"weighted"`
+	}
+	json.Unmarshal(patch, &fields)
+
+	updated := s.config
+	updated.Weighted.Percentages = nil
+	if fields.Weighted.Percentages == nil && s.config.Weighted.Percentages != nil {
+		updated.Weighted.Percentages = make(map[string]float64, len(s.config.Weighted.Percentages))
+		for name, pct := range s.config.Weighted.Percentages {
+			updated.Weighted.Percentages[name] = pct
+		}
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(patch))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&updated); err != nil {
+		return s.config, fmt.Errorf("invalid patch: %w", err)
+	}
+	if err := updated.Validate(); err != nil {
+		return s.config, err
+	}
+
+	s.config = updated
+	return updated, nil
+}
@@ -0,0 +1,171 @@
+// Package tokenizer counts tokens with the BPE encodings OpenAI models use.
+// The encodings are embedded in the binary, so counting never needs the
+// network. Other model families are counted with cl100k_base, which is
+// much closer to their tokenizers than a characters-per-token ratio.
+package tokenizer
+
+import (
+	"encoding/json"
+	"strings"
+	"sync"
+
+	"github.com/pkoukk/tiktoken-go"
+	tiktoken_loader "github.com/pkoukk/tiktoken-go-loader"
+	"github.com/sirupsen/logrus"
+)
+
+func init() {
+	tiktoken.SetBpeLoader(tiktoken_loader.NewOfflineLoader())
+}
+
+// defaultEncoding counts models whose encoding isn't known
+const defaultEncoding = "cl100k_base"
+
+// o200kPrefixes are newer OpenAI model families tiktoken-go doesn't map yet
+var o200kPrefixes = []string{"o1", "o3", "o4", "gpt-5", "chatgpt-4o"}
+
+// Chat formatting overhead, as OpenAI documents for its chat models
+const (
+	tokensPerMessage = 3 // role and separators around each message
+	tokensPerName    = 1 // a message's name field
+	tokensPerReply   = 3 // priming of the assistant reply
+)
+
+var (
+	mu        sync.Mutex
+	encodings = make(map[string]*tiktoken.Tiktoken)
+	failed    = make(map[string]bool)
+)
+
+// encodingName returns the encoding model uses, matching exact names
+// before prefixes such as "gpt-4o-"
+func encodingName(model string) string {
+	model = strings.TrimPrefix(model, "openai/")
+	if name, ok := tiktoken.MODEL_TO_ENCODING[model]; ok {
+		return name
+	}
+	for _, prefix := range o200kPrefixes {
+		if strings.HasPrefix(model, prefix) {
+			return "o200k_base"
+		}
+	}
+	longest, name := 0, defaultEncoding
+	for prefix, encodingName := range tiktoken.MODEL_PREFIX_TO_ENCODING {
+		if strings.HasPrefix(model, prefix) && len(prefix) > longest {
+			longest, name = len(prefix), encodingName
+		}
+	}
+	return name
+}
+
+// encoding returns the encoder for model, building it on first use. Nil is
+// returned when it can't be built.
+func encoding(model string) *tiktoken.Tiktoken {
+	name := encodingName(model)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if encoder, ok := encodings[name]; ok {
+		return encoder
+	}
+	if failed[name] {
+		return nil
+	}
+	encoder, err := tiktoken.GetEncoding(name)
+	if err != nil {
+		logrus.Warnf("Failed to load %s token encoding, estimating from length: %v", name, err)
+		failed[name] = true
+		return nil
+	}
+	encodings[name] = encoder
+	return encoder
+}
+
+// Count returns the number of tokens in text for model
+func Count(model, text string) int {
+	if text == "" {
+		return 0
+	}
+	encoder := encoding(model)
+	if encoder == nil {
+		return len(text) / 4
+	}
+	return len(encoder.EncodeOrdinary(text))
+}
+
+// CountRequest returns the prompt tokens of an OpenAI-style chat,
+// completion or embedding request body. Bodies of other shapes are
+// counted whole.
+func CountRequest(model string, body []byte) int {
+	var request struct {
+		Messages []struct {
+			Role    string          `json:"role"`
+			Name    string          `json:"name"`
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+		Prompt json.RawMessage `json:"prompt"`
+		Input  json.RawMessage `json:"input"`
+		Tools  json.RawMessage `json:"tools"`
+	}
+	if json.Unmarshal(body, &request) != nil {
+		return Count(model, string(body))
+	}
+
+	switch {
+	case request.Messages != nil:
+		tokens := tokensPerReply
+		for _, message := range request.Messages {
+			tokens += tokensPerMessage + Count(model, message.Role) + countContent(model, message.Content)
+			if message.Name != "" {
+				tokens += tokensPerName + Count(model, message.Name)
+			}
+		}
+		// Tool definitions reach the model as text; their JSON is a close
+		// enough stand-in for the provider's rendering
+		if len(request.Tools) > 0 && string(request.Tools) != "null" {
+			tokens += Count(model, string(request.Tools))
+		}
+		return tokens
+	case request.Prompt != nil:
+		return countContent(model, request.Prompt)
+	case request.Input != nil:
+		return countContent(model, request.Input)
+	}
+	return Count(model, string(body))
+}
+
+// countContent counts a string, an array of strings or token IDs, or an
+// array of content parts, of which only text parts are counted
+func countContent(model string, raw json.RawMessage) int {
+	if len(raw) == 0 {
+		return 0
+	}
+	var text string
+	if json.Unmarshal(raw, &text) == nil {
+		return Count(model, text)
+	}
+	var items []json.RawMessage
+	if json.Unmarshal(raw, &items) != nil {
+		return Count(model, string(raw))
+	}
+
+	tokens := 0
+	for _, item := range items {
+		var part struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		}
+		var number float64
+		switch {
+		case json.Unmarshal(item, &text) == nil:
+			tokens += Count(model, text)
+		case json.Unmarshal(item, &number) == nil:
+			tokens++ // a pre-tokenized prompt
+		case json.Unmarshal(item, &part) == nil && part.Type != "":
+			tokens += Count(model, part.Text)
+		default:
+			tokens += countContent(model, item) // nested arrays of token IDs
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,263 @@
+// Package usageexport copies usage-store records to object storage on a
+// schedule, one object per interval, for billing pipelines that load them
+// into a warehouse
+package usageexport
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/objstore"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/parquet"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/usagestore"
+	"github.com/sirupsen/logrus"
+)
+
+// Config schedules exports. Each destination has its own bucket and
+// credentials, so one router can feed an S3 and a GCS pipeline at once.
+type Config struct {
+	Enabled      bool              `yaml:"enabled"`
+	Interval     time.Duration     `yaml:"interval"` // records per object, aligned to UTC, default 1h
+	Delay        time.Duration     `yaml:"delay"`    // wait after an interval ends before exporting it, default 2m
+	Format       string            `yaml:"format"`   // "csv" (default) or "parquet"
+	Destinations []objstore.Config `yaml:"destinations"`
+	MaxCatchUp   int               `yaml:"maxCatchUp"` // missed intervals exported after downtime, default 168
+}
+
+// Exporter writes every interval once to each destination, remembering
+// the last one exported in the state dir so downtime is caught up on.
+// Object keys are fixed by the interval, so rewriting one after a crash
+// replaces it rather than duplicating records.
+type Exporter struct {
+	config    Config
+	source    *usagestore.Recorder
+	stores    []objstore.Store
+	statePath string
+
+	mu       sync.Mutex
+	exported map[string]time.Time // destination -> end of the last interval written
+}
+
+// New creates an exporter, or returns nil when disabled
+func New(config Config, source *usagestore.Recorder, stateDir string) (*Exporter, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	if source == nil {
+		return nil, fmt.Errorf("usage export needs usageStore enabled")
+	}
+	if len(config.Destinations) == 0 {
+		return nil, fmt.Errorf("usage export needs at least one destination")
+	}
+	if config.Interval == 0 {
+		config.Interval = time.Hour
+	}
+	if config.Interval < time.Minute || (24*time.Hour)%config.Interval != 0 {
+		return nil, fmt.Errorf("interval %s must be at least 1m and divide a day evenly", config.Interval)
+	}
+	if config.Delay == 0 {
+		config.Delay = 2 * time.Minute
+	}
+	if config.Format == "" {
+		config.Format = "csv"
+	}
+	if config.Format != "csv" && config.Format != "parquet" {
+		return nil, fmt.Errorf("unknown format %q, expected csv or parquet", config.Format)
+	}
+	if config.MaxCatchUp == 0 {
+		config.MaxCatchUp = 168
+	}
+
+	e := &Exporter{
+		config:    config,
+		source:    source,
+		statePath: filepath.Join(stateDir, "usage-export.json"),
+		exported:  make(map[string]time.Time),
+	}
+	for i, destination := range config.Destinations {
+		store, err := objstore.New(destination)
+		if err != nil {
+			return nil, fmt.Errorf("destinations[%d]: %w", i, err)
+		}
+		e.stores = append(e.stores, store)
+	}
+	if data, err := os.ReadFile(e.statePath); err == nil {
+		if err := json.Unmarshal(data, &e.exported); err != nil {
+			logrus.Warnf("Ignoring unreadable usage export state: %v", err)
+		}
+	}
+	return e, nil
+}
+
+// Interval is how often the exporter checks for finished intervals
+func (e *Exporter) Interval() time.Duration {
+	if e.config.Interval < 5*time.Minute {
+		return e.config.Interval
+	}
+	return 5 * time.Minute
+}
+
+// Start exports finished intervals until ctx is done
+func (e *Exporter) Start(ctx context.Context, beat func()) {
+	ticker := time.NewTicker(e.Interval())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.Export(ctx, time.Now())
+			beat()
+		}
+	}
+}
+
+// Export writes every interval that ended at least Delay before now and
+// hasn't been written to a destination yet. A failed interval is retried
+// on the next run before later ones are attempted.
+func (e *Exporter) Export(ctx context.Context, now time.Time) {
+	due := now.Add(-e.config.Delay).UTC().Truncate(e.config.Interval)
+	attempted := false
+	for _, store := range e.stores {
+		name := store.String()
+		e.mu.Lock()
+		from, ok := e.exported[name]
+		e.mu.Unlock()
+		if !ok {
+			// Start with the interval that just ended
+			from = due.Add(-e.config.Interval)
+		}
+		if earliest := due.Add(-time.Duration(e.config.MaxCatchUp) * e.config.Interval); from.Before(earliest) {
+			logrus.Warnf("Usage export to %s skips %s of records older than the catch-up limit", name, earliest.Sub(from))
+			from = earliest
+		}
+
+		for ; from.Before(due); from = from.Add(e.config.Interval) {
+			to := from.Add(e.config.Interval)
+			err := e.exportInterval(ctx, store, from, to)
+			attempted = true
+			if err != nil {
+				logrus.Warnf("Failed to export usage from %s to %s: %v", from.Format(time.RFC3339), name, err)
+				break
+			}
+			e.mu.Lock()
+			e.exported[name] = to
+			e.mu.Unlock()
+		}
+	}
+	if attempted {
+		e.saveState()
+	}
+}
+
+// exportInterval writes the records of [from, to) to store. Intervals
+// without records write nothing.
+func (e *Exporter) exportInterval(ctx context.Context, store objstore.Store, from, to time.Time) error {
+	records, err := e.source.Records(ctx, from, to)
+	if err != nil {
+		return err
+	}
+	if len(records) == 0 {
+		return nil
+	}
+
+	var body []byte
+	contentType := "text/csv"
+	if e.config.Format == "parquet" {
+		body, err = encodeParquet(records)
+		contentType = "application/vnd.apache.parquet"
+	} else {
+		body, err = encodeCSV(records)
+	}
+	if err != nil {
+		return err
+	}
+	// Hive-style date partitions, which Athena, BigQuery and Spark read as a column
+	key := fmt.Sprintf("dt=%s/usage-%s.%s", from.Format("2006-01-02"), from.Format("20060102T150405Z"), e.config.Format)
+	if err := store.Put(ctx, key, body, contentType); err != nil {
+		return err
+	}
+	logrus.Infof("Exported %d usage records to %s/%s", len(records), store, key)
+	return nil
+}
+
+// Status reports the end of the last exported interval per destination
+func (e *Exporter) Status() map[string]time.Time {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	status := make(map[string]time.Time, len(e.exported))
+	for name, at := range e.exported {
+		status[name] = at
+	}
+	return status
+}
+
+func (e *Exporter) saveState() {
+	data, err := json.MarshalIndent(e.Status(), "", "  ")
+	if err == nil {
+		if err = os.MkdirAll(filepath.Dir(e.statePath), 0o755); err == nil {
+			if err = os.WriteFile(e.statePath+".tmp", data, 0o600); err == nil {
+				err = os.Rename(e.statePath+".tmp", e.statePath)
+			}
+		}
+	}
+	if err != nil {
+		logrus.Warnf("Failed to save usage export state: %v", err)
+	}
+}
+
+// columns are the exported fields, named as in the usage store schema
+var columns = []parquet.Column{
+	{Name: "time", Type: parquet.Timestamp},
+	{Name: "tenant", Type: parquet.String},
+	{Name: "target", Type: parquet.String},
+	{Name: "target_type", Type: parquet.String},
+	{Name: "provider", Type: parquet.String},
+	{Name: "model", Type: parquet.String},
+	{Name: "endpoint", Type: parquet.String},
+	{Name: "prompt_tokens", Type: parquet.Int64},
+	{Name: "completion_tokens", Type: parquet.Int64},
+	{Name: "estimated", Type: parquet.Boolean},
+	{Name: "cost_usd", Type: parquet.Double},
+	{Name: "status", Type: parquet.String},
+	{Name: "duration_ms", Type: parquet.Int64},
+}
+
+func encodeParquet(records []usagestore.Record) ([]byte, error) {
+	writer := parquet.NewWriter(columns...)
+	for _, rec := range records {
+		if err := writer.Append(rec.Time, rec.Tenant, rec.Target, rec.TargetType, rec.Provider, rec.Model, rec.Endpoint,
+			rec.PromptTokens, rec.CompletionTokens, rec.Estimated, rec.Cost, rec.Status, rec.DurationMs); err != nil {
+			return nil, err
+		}
+	}
+	return writer.Bytes(), nil
+}
+
+func encodeCSV(records []usagestore.Record) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	header := make([]string, len(columns))
+	for i, column := range columns {
+		header[i] = column.Name
+	}
+	writer.Write(header)
+	for _, rec := range records {
+		writer.Write([]string{
+			rec.Time.UTC().Format(time.RFC3339Nano), rec.Tenant, rec.Target, rec.TargetType, rec.Provider, rec.Model, rec.Endpoint,
+			strconv.Itoa(rec.PromptTokens), strconv.Itoa(rec.CompletionTokens), strconv.FormatBool(rec.Estimated),
+			strconv.FormatFloat(rec.Cost, 'f', -1, 64), rec.Status, strconv.FormatInt(rec.DurationMs, 10),
+		})
+	}
+	writer.Flush()
+	return buf.Bytes(), writer.Error()
+}
@@ -0,0 +1,255 @@
+package usagestore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"  // registers "postgres"
+	_ "modernc.org/sqlite" // registers "sqlite", pure Go so CGO_ENABLED=0 builds keep working
+)
+
+// dialect holds what differs between the SQL databases
+type dialect struct {
+	schema      []string
+	placeholder func(n int) string
+}
+
+var sqliteDialect = dialect{
+	schema: []string{
+		`PRAGMA journal_mode=WAL`,
+		`CREATE TABLE IF NOT EXISTS usage_records (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			ts_ms INTEGER NOT NULL,
+			tenant TEXT NOT NULL,
+			target TEXT NOT NULL,
+			target_type TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			model TEXT NOT NULL,
+			endpoint TEXT NOT NULL,
+			prompt_tokens INTEGER NOT NULL,
+			completion_tokens INTEGER NOT NULL,
+			estimated INTEGER NOT NULL,
+			cost_usd REAL NOT NULL,
+			status TEXT NOT NULL,
+			duration_ms INTEGER NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS usage_records_ts ON usage_records (ts_ms)`,
+		`CREATE INDEX IF NOT EXISTS usage_records_tenant_ts ON usage_records (tenant, ts_ms)`,
+	},
+	placeholder: func(int) string { return "?" },
+}
+
+var postgresDialect = dialect{
+	schema: []string{
+		`CREATE TABLE IF NOT EXISTS usage_records (
+			id BIGSERIAL PRIMARY KEY,
+			ts_ms BIGINT NOT NULL,
+			tenant TEXT NOT NULL,
+			target TEXT NOT NULL,
+			target_type TEXT NOT NULL,
+			provider TEXT NOT NULL,
+			model TEXT NOT NULL,
+			endpoint TEXT NOT NULL,
+			prompt_tokens INTEGER NOT NULL,
+			completion_tokens INTEGER NOT NULL,
+			estimated BOOLEAN NOT NULL,
+			cost_usd DOUBLE PRECISION NOT NULL,
+			status TEXT NOT NULL,
+			duration_ms BIGINT NOT NULL
+		)`,
+		`CREATE INDEX IF NOT EXISTS usage_records_ts ON usage_records (ts_ms)`,
+		`CREATE INDEX IF NOT EXISTS usage_records_tenant_ts ON usage_records (tenant, ts_ms)`,
+	},
+	placeholder: func(n int) string { return fmt.Sprintf("$%d", n) },
+}
+
+const recordColumns = "ts_ms, tenant, target, target_type, provider, model, endpoint, prompt_tokens, completion_tokens, estimated, cost_usd, status, duration_ms"
+
+// sqlStore keeps records in a database/sql database
+type sqlStore struct {
+	db      *sql.DB
+	dialect dialect
+	insert  string
+}
+
+func openSQL(driver, dsn string, d dialect) (*sqlStore, error) {
+	db, err := sql.Open(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
+	if driver == "sqlite" {
+		// One writer avoids SQLITE_BUSY between concurrent connections
+		db.SetMaxOpenConns(1)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	for _, statement := range d.schema {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("creating schema: %w", err)
+		}
+	}
+
+	placeholders := make([]string, strings.Count(recordColumns, ",")+1)
+	for i := range placeholders {
+		placeholders[i] = d.placeholder(i + 1)
+	}
+	return &sqlStore{
+		db:      db,
+		dialect: d,
+		insert:  fmt.Sprintf("INSERT INTO usage_records (%s) VALUES (%s)", recordColumns, strings.Join(placeholders, ", ")),
+	}, nil
+}
+
+// Insert writes records in one transaction
+func (s *sqlStore) Insert(ctx context.Context, records []Record) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.PrepareContext(ctx, s.insert)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, rec := range records {
+		if _, err := stmt.ExecContext(ctx,
+			rec.Time.UnixMilli(), rec.Tenant, rec.Target, rec.TargetType, rec.Provider, rec.Model, rec.Endpoint,
+			rec.PromptTokens, rec.CompletionTokens, rec.Estimated, rec.Cost, rec.Status, rec.DurationMs,
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Prune deletes records from before the cutoff
+func (s *sqlStore) Prune(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM usage_records WHERE ts_ms < "+s.dialect.placeholder(1), before.UnixMilli())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// groupColumns maps group keys to the SQL expressions they group on
+var groupColumns = map[string]string{
+	"tenant":      "tenant",
+	"provider":    "provider",
+	"target":      "target",
+	"target_type": "target_type",
+	"model":       "model",
+	"endpoint":    "endpoint",
+	"status":      "status",
+	"day":         "ts_ms / 86400000",
+}
+
+// Aggregate sums matching records per group in the database
+func (s *sqlStore) Aggregate(ctx context.Context, query Query) ([]Summary, error) {
+	var where []string
+	var args []interface{}
+	filter := func(condition string, value interface{}) {
+		args = append(args, value)
+		where = append(where, condition+" "+s.dialect.placeholder(len(args)))
+	}
+	if !query.From.IsZero() {
+		filter("ts_ms >=", query.From.UnixMilli())
+	}
+	if !query.To.IsZero() {
+		filter("ts_ms <", query.To.UnixMilli())
+	}
+	for column, value := range map[string]string{"tenant": query.Tenant, "provider": query.Provider, "target": query.Target, "model": query.Model} {
+		if value != "" {
+			filter(column+" =", value)
+		}
+	}
+
+	var groups []string
+	for _, key := range query.GroupBy {
+		groups = append(groups, groupColumns[key])
+	}
+	columns := append(append([]string(nil), groups...),
+		"COUNT(*)",
+		"COALESCE(SUM(CASE WHEN status = 'error' THEN 1 ELSE 0 END), 0)",
+		"COALESCE(SUM(prompt_tokens), 0)",
+		"COALESCE(SUM(completion_tokens), 0)",
+		"COALESCE(SUM(CASE WHEN estimated THEN 1 ELSE 0 END), 0)",
+		"COALESCE(SUM(cost_usd), 0)",
+	)
+	statement := "SELECT " + strings.Join(columns, ", ") + " FROM usage_records"
+	if len(where) > 0 {
+		statement += " WHERE " + strings.Join(where, " AND ")
+	}
+	if len(groups) > 0 {
+		statement += " GROUP BY " + strings.Join(groups, ", ") + " ORDER BY " + strings.Join(groups, ", ")
+	}
+
+	rows, err := s.db.QueryContext(ctx, statement, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var summaries []Summary
+	for rows.Next() {
+		var summary Summary
+		values := make([]string, len(groups))
+		dest := make([]interface{}, 0, len(columns))
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		dest = append(dest, &summary.Requests, &summary.Errors, &summary.PromptTokens, &summary.CompletionTokens, &summary.Estimated, &summary.Cost)
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		summary.TotalTokens = summary.PromptTokens + summary.CompletionTokens
+		if len(groups) > 0 {
+			summary.Group = make(map[string]string, len(groups))
+			for i, key := range query.GroupBy {
+				summary.Group[key] = values[i]
+				if key == "day" {
+					if day, err := strconv.ParseInt(values[i], 10, 64); err == nil {
+						summary.Group[key] = time.UnixMilli(day * 86400000).UTC().Format("2006-01-02")
+					}
+				}
+			}
+		}
+		summaries = append(summaries, summary)
+	}
+	return summaries, rows.Err()
+}
+
+// Records reads the records in a time range in insertion order
+func (s *sqlStore) Records(ctx context.Context, from, to time.Time) ([]Record, error) {
+	statement := fmt.Sprintf("SELECT %s FROM usage_records WHERE ts_ms >= %s AND ts_ms < %s ORDER BY ts_ms, id",
+		recordColumns, s.dialect.placeholder(1), s.dialect.placeholder(2))
+	rows, err := s.db.QueryContext(ctx, statement, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		var rec Record
+		var ts int64
+		if err := rows.Scan(&ts, &rec.Tenant, &rec.Target, &rec.TargetType, &rec.Provider, &rec.Model, &rec.Endpoint,
+			&rec.PromptTokens, &rec.CompletionTokens, &rec.Estimated, &rec.Cost, &rec.Status, &rec.DurationMs); err != nil {
+			return nil, err
+		}
+		rec.Time = time.UnixMilli(ts).UTC()
+		records = append(records, rec)
+	}
+	return records, rows.Err()
+}
+
+func (s *sqlStore) Close() error {
+	return s.db.Close()
+}
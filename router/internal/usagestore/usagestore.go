@@ -0,0 +1,270 @@
+// Package usagestore durably records per-request tokens and cost, so
+// accounting survives restarts rather than living only in Prometheus
+package usagestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Config selects where usage records are kept
+type Config struct {
+	Enabled       bool          `yaml:"enabled"`
+	Driver        string        `yaml:"driver"`        // "sqlite" (default) or "postgres"
+	DSN           string        `yaml:"dsn"`           // sqlite file, default <stateDir>/usage.db, or a postgres connection URL
+	Retention     time.Duration `yaml:"retention"`     // older records are deleted, 0 keeps them forever
+	FlushInterval time.Duration `yaml:"flushInterval"` // queued records are written this often, default 5s
+	QueueSize     int           `yaml:"queueSize"`     // records held while the database is slow or down, default 10000
+}
+
+// Record is one forwarded request
+type Record struct {
+	Time             time.Time `json:"time"`
+	Tenant           string    `json:"tenant,omitempty"`
+	Target           string    `json:"target"`
+	TargetType       string    `json:"target_type"` // "cluster" or "provider"
+	Provider         string    `json:"provider"`    // cloud for clusters, provider type for external providers
+	Model            string    `json:"model,omitempty"`
+	Endpoint         string    `json:"endpoint"`
+	PromptTokens     int       `json:"prompt_tokens"`
+	CompletionTokens int       `json:"completion_tokens"`
+	Estimated        bool      `json:"estimated"` // tokens estimated from lengths, not reported by the target
+	Cost             float64   `json:"cost_usd"`
+	Status           string    `json:"status"` // "success", "error" or "cancelled"
+	DurationMs       int64     `json:"duration_ms"`
+}
+
+// Query selects records to aggregate. Empty filters match everything.
+type Query struct {
+	From     time.Time // inclusive
+	To       time.Time // exclusive
+	Tenant   string
+	Provider string
+	Target   string
+	Model    string
+	GroupBy  []string // any of GroupKeys
+}
+
+// GroupKeys are the dimensions a Query may group by; "day" is the UTC date
+var GroupKeys = []string{"tenant", "provider", "target", "target_type", "model", "endpoint", "status", "day"}
+
+// ErrInvalidQuery is returned for queries that can't be run as asked
+var ErrInvalidQuery = errors.New("invalid usage query")
+
+// Summary totals the records of one group
+type Summary struct {
+	Group            map[string]string `json:"group,omitempty"`
+	Requests         int64             `json:"requests"`
+	Errors           int64             `json:"errors"`
+	PromptTokens     int64             `json:"prompt_tokens"`
+	CompletionTokens int64             `json:"completion_tokens"`
+	TotalTokens      int64             `json:"total_tokens"`
+	Estimated        int64             `json:"estimated_requests"` // requests whose tokens were estimated
+	Cost             float64           `json:"cost_usd"`
+}
+
+// Add folds other's totals into s
+func (s *Summary) Add(other Summary) {
+	s.Requests += other.Requests
+	s.Errors += other.Errors
+	s.PromptTokens += other.PromptTokens
+	s.CompletionTokens += other.CompletionTokens
+	s.TotalTokens += other.TotalTokens
+	s.Estimated += other.Estimated
+	s.Cost += other.Cost
+}
+
+// Store persists records. Implementations must be safe for concurrent use.
+type Store interface {
+	Insert(ctx context.Context, records []Record) error
+	Prune(ctx context.Context, before time.Time) (int64, error)
+	Aggregate(ctx context.Context, query Query) ([]Summary, error)
+	Records(ctx context.Context, from, to time.Time) ([]Record, error)
+	Close() error
+}
+
+// Recorder queues records and writes them to a Store in batches, keeping
+// the request path off the database
+type Recorder struct {
+	config Config
+	store  Store
+
+	mu      sync.Mutex
+	queue   []Record
+	dropped int
+	pruned  time.Time
+}
+
+// Open connects to the configured store, creating its schema, or returns
+// nil when disabled
+func Open(config Config, stateDir string) (*Recorder, error) {
+	if !config.Enabled {
+		return nil, nil
+	}
+	if config.Driver == "" {
+		config.Driver = "sqlite"
+	}
+	if config.FlushInterval == 0 {
+		config.FlushInterval = 5 * time.Second
+	}
+	if config.QueueSize == 0 {
+		config.QueueSize = 10000
+	}
+
+	var store Store
+	var err error
+	switch config.Driver {
+	case "sqlite":
+		dsn := config.DSN
+		if dsn == "" {
+			if err := os.MkdirAll(stateDir, 0o755); err != nil {
+				return nil, err
+			}
+			dsn = filepath.Join(stateDir, "usage.db")
+		}
+		store, err = openSQL("sqlite", dsn, sqliteDialect)
+	case "postgres":
+		if config.DSN == "" {
+			return nil, fmt.Errorf("postgres needs a dsn")
+		}
+		store, err = openSQL("postgres", config.DSN, postgresDialect)
+	default:
+		return nil, fmt.Errorf("unknown driver %q", config.Driver)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &Recorder{config: config, store: store}, nil
+}
+
+// Interval is how often queued records are written
+func (r *Recorder) Interval() time.Duration {
+	return r.config.FlushInterval
+}
+
+// Add queues a record, reporting false when the queue is full and it was
+// dropped
+func (r *Recorder) Add(rec Record) bool {
+	if r == nil {
+		return false
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.queue) >= r.config.QueueSize {
+		r.dropped++
+		return false
+	}
+	r.queue = append(r.queue, rec)
+	return true
+}
+
+// Start writes queued records every flush interval until ctx is done
+func (r *Recorder) Start(ctx context.Context, beat func()) {
+	ticker := time.NewTicker(r.config.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Flush(ctx); err != nil {
+				logrus.Warnf("Failed to write usage records: %v", err)
+			}
+			r.prune(ctx)
+			beat()
+		}
+	}
+}
+
+// Flush writes every queued record, requeueing them if the write fails
+func (r *Recorder) Flush(ctx context.Context) error {
+	r.mu.Lock()
+	batch := r.queue
+	r.queue = nil
+	dropped := r.dropped
+	r.dropped = 0
+	r.mu.Unlock()
+
+	if dropped > 0 {
+		logrus.Warnf("Dropped %d usage records while the queue was full", dropped)
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+	if err := r.store.Insert(ctx, batch); err != nil {
+		r.mu.Lock()
+		if room := r.config.QueueSize - len(r.queue); len(batch) > room {
+			r.dropped += len(batch) - room
+			batch = batch[len(batch)-room:]
+		}
+		r.queue = append(batch, r.queue...)
+		r.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// Aggregate totals the stored records matching query, one Summary per
+// group. Queued records are written first so recent requests are counted.
+func (r *Recorder) Aggregate(ctx context.Context, query Query) ([]Summary, error) {
+	for _, key := range query.GroupBy {
+		known := false
+		for _, groupKey := range GroupKeys {
+			known = known || key == groupKey
+		}
+		if !known {
+			return nil, fmt.Errorf("%w: cannot group by %q", ErrInvalidQuery, key)
+		}
+	}
+	if !query.To.IsZero() && !query.To.After(query.From) {
+		return nil, fmt.Errorf("%w: the range must end after it starts", ErrInvalidQuery)
+	}
+	if err := r.Flush(ctx); err != nil {
+		logrus.Warnf("Failed to write usage records before a query: %v", err)
+	}
+	return r.store.Aggregate(ctx, query)
+}
+
+// Records returns the stored records from from (inclusive) to to
+// (exclusive), oldest first. Queued records are written first.
+func (r *Recorder) Records(ctx context.Context, from, to time.Time) ([]Record, error) {
+	if err := r.Flush(ctx); err != nil {
+		logrus.Warnf("Failed to write usage records before reading them: %v", err)
+	}
+	return r.store.Records(ctx, from, to)
+}
+
+// prune deletes records past the retention, at most hourly
+func (r *Recorder) prune(ctx context.Context) {
+	if r.config.Retention <= 0 || time.Since(r.pruned) < time.Hour {
+		return
+	}
+	r.pruned = time.Now()
+	deleted, err := r.store.Prune(ctx, time.Now().Add(-r.config.Retention))
+	if err != nil {
+		logrus.Warnf("Failed to prune usage records: %v", err)
+		return
+	}
+	if deleted > 0 {
+		logrus.Infof("Pruned %d usage records older than %s", deleted, r.config.Retention)
+	}
+}
+
+// Close flushes what is queued and closes the store
+func (r *Recorder) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	flushErr := r.Flush(ctx)
+	if err := r.store.Close(); err != nil {
+		return err
+	}
+	return flushErr
+}
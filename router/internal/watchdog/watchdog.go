@@ -0,0 +1,167 @@
+package watchdog
+
+import (
+	"context"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// minStallThreshold keeps very fast loops from being restarted on a single slow tick
+const minStallThreshold = 30 * time.Second
+
+// maxStackDump bounds the goroutine dump logged when a loop stalls
+const maxStackDump = 64 * 1024
+
+// RunFunc is a supervised background loop. It must call beat once per
+// iteration and return when ctx is cancelled.
+type RunFunc func(ctx context.Context, beat func())
+
+// LoopStatus reports the state of a supervised loop
+type LoopStatus struct {
+	Name        string    `json:"name"`
+	Interval    string    `json:"interval"`
+	LastBeat    time.Time `json:"last_beat"`
+	Stalled     bool      `json:"stalled"`
+	Restarts    int       `json:"restarts"`
+	LastRestart time.Time `json:"last_restart,omitempty"`
+}
+
+type loop struct {
+	name        string
+	interval    time.Duration
+	run         RunFunc
+	cancel      context.CancelFunc
+	generation  int
+	lastBeat    time.Time
+	stalled     bool
+	restarts    int
+	lastRestart time.Time
+}
+
+// Watchdog supervises background loops and restarts those that stop beating
+type Watchdog struct {
+	mu            sync.Mutex
+	loops         map[string]*loop
+	checkInterval time.Duration
+	parent        context.Context
+}
+
+// New creates a watchdog that checks loops every checkInterval
+func New(ctx context.Context, checkInterval time.Duration) *Watchdog {
+	return &Watchdog{
+		loops:         make(map[string]*loop),
+		checkInterval: checkInterval,
+		parent:        ctx,
+	}
+}
+
+// Supervise starts run in a goroutine and watches it. interval is how often
+// the loop is expected to beat.
+func (w *Watchdog) Supervise(name string, interval time.Duration, run RunFunc) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	l := &loop{
+		name:     name,
+		interval: interval,
+		run:      run,
+		lastBeat: time.Now(),
+	}
+	w.loops[name] = l
+	w.startLocked(l)
+}
+
+func (w *Watchdog) startLocked(l *loop) {
+	ctx, cancel := context.WithCancel(w.parent)
+	l.cancel = cancel
+	l.generation++
+	generation := l.generation
+
+	beat := func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		// Ignore beats from a superseded instance that eventually unstuck
+		if l.generation == generation {
+			l.lastBeat = time.Now()
+			l.stalled = false
+		}
+	}
+
+	go l.run(ctx, beat)
+}
+
+// Start runs the supervision loop until ctx is cancelled
+func (w *Watchdog) Start(ctx context.Context) {
+	ticker := time.NewTicker(w.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			w.check()
+		}
+	}
+}
+
+func (w *Watchdog) check() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	now := time.Now()
+	for _, l := range w.loops {
+		threshold := 3 * l.interval
+		if threshold < minStallThreshold {
+			threshold = minStallThreshold
+		}
+
+		silence := now.Sub(l.lastBeat)
+		if silence <= threshold {
+			continue
+		}
+
+		l.stalled = true
+		l.restarts++
+		l.lastRestart = now
+
+		stack := make([]byte, maxStackDump)
+		stack = stack[:runtime.Stack(stack, true)]
+		logrus.WithFields(logrus.Fields{
+			"loop":       l.name,
+			"silence":    silence.String(),
+			"restarts":   l.restarts,
+			"goroutines": runtime.NumGoroutine(),
+			"stack":      string(stack),
+		}).Errorf("Background loop %s stalled for %s, restarting", l.name, silence.Round(time.Second))
+
+		// The stuck goroutine cannot be killed; cancel it and start a fresh instance
+		l.cancel()
+		l.lastBeat = now
+		w.startLocked(l)
+	}
+}
+
+// Status returns the state of all supervised loops, sorted by name
+func (w *Watchdog) Status() []LoopStatus {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	statuses := make([]LoopStatus, 0, len(w.loops))
+	for _, l := range w.loops {
+		statuses = append(statuses, LoopStatus{
+			Name:        l.name,
+			Interval:    l.interval.String(),
+			LastBeat:    l.lastBeat,
+			Stalled:     l.stalled,
+			Restarts:    l.restarts,
+			LastRestart: l.lastRestart,
+		})
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
@@ -0,0 +1,190 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/egress"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// SignatureHeader carries "sha256=<hex>", an HMAC of "<timestamp>.<body>"
+	SignatureHeader = "X-LLM-Router-Signature"
+	// TimestampHeader carries the Unix time the delivery was signed at
+	TimestampHeader = "X-LLM-Router-Timestamp"
+)
+
+// Config configures callback delivery
+type Config struct {
+	Secret         string        `yaml:"secret"` // HMAC signing key; deliveries are unsigned when empty
+	MaxAttempts    int           `yaml:"maxAttempts"`
+	InitialBackoff time.Duration `yaml:"initialBackoff"` // doubled after each failed attempt
+	Timeout        time.Duration `yaml:"timeout"`        // per attempt
+	JobTimeout     time.Duration `yaml:"jobTimeout"`     // upper bound on running an async request
+	AllowedHosts   []string      `yaml:"allowedHosts"`   // callback hosts permitted, any public host when empty
+	AllowPrivate   bool          `yaml:"allowPrivate"`   // lets callbacks reach loopback, private and link-local addresses
+	MaxJobs        int           `yaml:"maxJobs"`        // async requests running at once
+}
+
+// Deliverer POSTs signed payloads to callback URLs with retry and backoff
+type Deliverer struct {
+	config     Config
+	secret     []byte
+	httpClient *http.Client // for the router's own configured URLs
+	callbacks  *http.Client // for client-supplied callback URLs
+}
+
+// New creates a deliverer, filling unset config values with defaults
+func New(config Config) *Deliverer {
+	if config.MaxAttempts == 0 {
+		config.MaxAttempts = 5
+	}
+	if config.InitialBackoff == 0 {
+		config.InitialBackoff = time.Second
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 10 * time.Second
+	}
+	if config.JobTimeout == 0 {
+		config.JobTimeout = 10 * time.Minute
+	}
+	if config.MaxJobs == 0 {
+		config.MaxJobs = 100
+	}
+
+	d := &Deliverer{
+		config:     config,
+		secret:     []byte(config.Secret),
+		httpClient: &http.Client{Timeout: config.Timeout},
+		callbacks:  &http.Client{Timeout: config.Timeout},
+	}
+	// Clients choose callback URLs, so unless the operator has named the
+	// hosts they may only reach the internet, not the router's network
+	if d.guarded() {
+		d.callbacks.Transport = egress.Transport()
+	}
+	return d
+}
+
+// guarded reports whether callbacks are kept to public addresses
+func (d *Deliverer) guarded() bool {
+	return len(d.config.AllowedHosts) == 0 && !d.config.AllowPrivate
+}
+
+// JobTimeout bounds how long an async request may run before delivery
+func (d *Deliverer) JobTimeout() time.Duration {
+	return d.config.JobTimeout
+}
+
+// MaxJobs is how many async requests may run at once
+func (d *Deliverer) MaxJobs() int {
+	return d.config.MaxJobs
+}
+
+// ValidateURL checks that a callback URL is absolute http(s) and targets a
+// permitted host: one on the allowlist when it is configured, otherwise
+// any host that isn't plainly private
+func (d *Deliverer) ValidateURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return fmt.Errorf("callback URL must be an absolute http(s) URL")
+	}
+	if len(d.config.AllowedHosts) == 0 {
+		if d.guarded() {
+			if egress.CheckHost(parsed.Hostname()) != nil {
+				return fmt.Errorf("callback host %s is not a public address", parsed.Hostname())
+			}
+		}
+		return nil
+	}
+	for _, host := range d.config.AllowedHosts {
+		if parsed.Hostname() == host {
+			return nil
+		}
+	}
+	return fmt.Errorf("callback host %s is not allowed", parsed.Hostname())
+}
+
+// Sign computes the signature header value for body signed at timestamp
+func Sign(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Deliver POSTs body to a client's callbackURL, retrying network errors,
+// 429s and 5xx responses with exponential backoff. It blocks until
+// delivery succeeds or attempts run out.
+func (d *Deliverer) Deliver(callbackURL string, headers map[string]string, body []byte) error {
+	return d.deliver(d.callbacks, callbackURL, headers, body)
+}
+
+// Notify delivers like Deliver to a URL from the router's own config,
+// which may be on a private network
+func (d *Deliverer) Notify(url string, headers map[string]string, body []byte) error {
+	return d.deliver(d.httpClient, url, headers, body)
+}
+
+func (d *Deliverer) deliver(client *http.Client, callbackURL string, headers map[string]string, body []byte) error {
+	backoff := d.config.InitialBackoff
+	var lastErr error
+
+	for attempt := 1; attempt <= d.config.MaxAttempts; attempt++ {
+		retry, err := d.attempt(client, callbackURL, headers, body)
+		if err == nil {
+			return nil
+		}
+		lastErr = err
+		if !retry {
+			break
+		}
+
+		if attempt < d.config.MaxAttempts {
+			logrus.Debugf("Webhook delivery to %s failed (attempt %d/%d): %v", callbackURL, attempt, d.config.MaxAttempts, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	return fmt.Errorf("webhook delivery to %s failed: %w", callbackURL, lastErr)
+}
+
+func (d *Deliverer) attempt(client *http.Client, callbackURL string, headers map[string]string, body []byte) (retry bool, err error) {
+	req, err := http.NewRequest("POST", callbackURL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	// Re-sign each attempt so receivers can reject stale timestamps
+	if len(d.secret) > 0 {
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		req.Header.Set(TimestampHeader, timestamp)
+		req.Header.Set(SignatureHeader, Sign(d.secret, timestamp, body))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+	return retry, fmt.Errorf("callback returned status %d", resp.StatusCode)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// KillSwitchState is the persisted incident-response state
+type KillSwitchState struct {
+	Engaged       bool      `json:"engaged"`
+	BlockExternal bool      `json:"block_external"`        // stop routing to paid external providers
+	SafeTarget    string    `json:"safe_target,omitempty"` // when set, route only to this target
+	ReadOnly      bool      `json:"read_only"`             // reject state-changing control and admin calls
+	Reason        string    `json:"reason,omitempty"`
+	EngagedAt     time.Time `json:"engaged_at"`
+}
+
+// killSwitch holds the kill switch state, persisting every change to path
+// so an engaged switch survives restarts
+type killSwitch struct {
+	mu    sync.RWMutex
+	path  string
+	state KillSwitchState
+}
+
+func newKillSwitch(stateDir string) *killSwitch {
+	ks := &killSwitch{path: filepath.Join(stateDir, "killswitch.json")}
+
+	data, err := os.ReadFile(ks.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logrus.Warnf("Failed to read kill switch state: %v", err)
+		}
+		return ks
+	}
+	if err := json.Unmarshal(data, &ks.state); err != nil {
+		logrus.Warnf("Failed to parse kill switch state %s: %v", ks.path, err)
+		return ks
+	}
+	if ks.state.Engaged {
+		logrus.Warnf("Kill switch is engaged (%s) since %s", ks.state.Reason, ks.state.EngagedAt.Format(time.RFC3339))
+	}
+	return ks
+}
+
+func (ks *killSwitch) State() KillSwitchState {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return ks.state
+}
+
+func (ks *killSwitch) set(state KillSwitchState) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ks.path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state dir: %w", err)
+	}
+	tmp := ks.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write kill switch state: %w", err)
+	}
+	if err := os.Rename(tmp, ks.path); err != nil {
+		return fmt.Errorf("failed to write kill switch state: %w", err)
+	}
+
+	ks.state = state
+	return nil
+}
+
+// filter drops targets the kill switch forbids
+func (ks *killSwitch) filter(targets []*RouteTarget) []*RouteTarget {
+	state := ks.State()
+	if !state.Engaged {
+		return targets
+	}
+
+	allowed := targets[:0]
+	for _, target := range targets {
+		if state.SafeTarget != "" && target.Name != state.SafeTarget {
+			continue
+		}
+		if state.BlockExternal && target.Type == "provider" {
+			continue
+		}
+		allowed = append(allowed, target)
+	}
+	return allowed
+}
+
+// killSwitchHandler reports the kill switch state
+func (r *Router) killSwitchHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.killSwitch.State())
+}
+
+// engageKillSwitchHandler engages the kill switch. With no restriction given,
+// routing to external providers is stopped.
+func (r *Router) engageKillSwitchHandler(w http.ResponseWriter, req *http.Request) {
+	var engageReq struct {
+		BlockExternal *bool  `json:"block_external"`
+		SafeTarget    string `json:"safe_target"`
+		ReadOnly      bool   `json:"read_only"`
+		Reason        string `json:"reason"`
+	}
+	if req.ContentLength != 0 {
+		if err := json.NewDecoder(req.Body).Decode(&engageReq); err != nil {
+			writeBodyError(w, err, "Invalid request")
+			return
+		}
+	}
+
+	state := KillSwitchState{
+		Engaged:       true,
+		BlockExternal: engageReq.SafeTarget == "",
+		SafeTarget:    engageReq.SafeTarget,
+		ReadOnly:      engageReq.ReadOnly,
+		Reason:        engageReq.Reason,
+		EngagedAt:     time.Now().UTC(),
+	}
+	if engageReq.BlockExternal != nil {
+		state.BlockExternal = *engageReq.BlockExternal
+	}
+
+	if err := r.killSwitch.set(state); err != nil {
+		logrus.Errorf("Failed to engage kill switch: %v", err)
+		http.Error(w, "Failed to persist kill switch", http.StatusInternalServerError)
+		return
+	}
+	logrus.Warnf("Kill switch engaged: block_external=%t safe_target=%q read_only=%t reason=%q",
+		state.BlockExternal, state.SafeTarget, state.ReadOnly, state.Reason)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(state)
+}
+
+// releaseKillSwitchHandler restores normal routing
+func (r *Router) releaseKillSwitchHandler(w http.ResponseWriter, req *http.Request) {
+	if err := r.killSwitch.set(KillSwitchState{}); err != nil {
+		logrus.Errorf("Failed to release kill switch: %v", err)
+		http.Error(w, "Failed to persist kill switch", http.StatusInternalServerError)
+		return
+	}
+	logrus.Warnf("Kill switch released")
+	w.WriteHeader(http.StatusNoContent)
+}
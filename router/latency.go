@@ -0,0 +1,68 @@
+package main
+
+import (
+	"sync"
+)
+
+// latencyTracker keeps an exponentially weighted moving average of observed
+// forward latencies per target, reacting within a few requests rather than
+// waiting for the next health check
+type latencyTracker struct {
+	mu   sync.Mutex
+	ewma map[string]float64 // target name -> milliseconds
+}
+
+func newLatencyTracker() *latencyTracker {
+	return &latencyTracker{ewma: make(map[string]float64)}
+}
+
+func (t *latencyTracker) observe(target string, ms, alpha float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if current, exists := t.ewma[target]; exists {
+		t.ewma[target] = alpha*ms + (1-alpha)*current
+	} else {
+		t.ewma[target] = ms
+	}
+}
+
+func (t *latencyTracker) get(target string) (float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	ms, exists := t.ewma[target]
+	return ms, exists
+}
+
+// snapshot returns every target's current average
+func (t *latencyTracker) snapshot() map[string]float64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snapshot := make(map[string]float64, len(t.ewma))
+	for target, ms := range t.ewma {
+		snapshot[target] = ms
+	}
+	return snapshot
+}
+
+// restore reloads averages saved by snapshot
+func (t *latencyTracker) restore(ewma map[string]float64) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for target, ms := range ewma {
+		if ms > 0 {
+			t.ewma[target] = ms
+		}
+	}
+}
+
+// latency returns the target's live latency estimate, falling back to the
+// health checker's p95 until requests have been observed
+func (t *RouteTarget) latency() float64 {
+	if t.LatencyEWMA > 0 {
+		return t.LatencyEWMA
+	}
+	return t.LatencyP95
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+// LintConfig tunes the sanity checks run over the configuration at startup.
+// Findings are warnings: the router still starts.
+type LintConfig struct {
+	PricingMaxAge          time.Duration `yaml:"pricingMaxAge"`          // pricing checked longer ago is flagged, default 90 days
+	ClusterTokensPerSecond float64       `yaml:"clusterTokensPerSecond"` // optimistic cluster throughput for cost checks, default 100
+	Ignore                 []string      `yaml:"ignore"`                 // checks not to report
+	Strict                 bool          `yaml:"strict"`                 // refuse to start on config errors instead of logging them
+}
+
+// lintFinding is one suspicious configuration value
+type lintFinding struct {
+	Check   string `json:"check"` // cluster_cost, pricing_stale, hybrid_threshold or unreachable_strategy
+	Message string `json:"message"`
+}
+
+// lintConfig flags values that are valid but probably not what the
+// operator meant, given the registered providers' pricing
+func lintConfig(config *Config, providerSet map[string]providers.Provider) []lintFinding {
+	lint := config.Router.Lint
+	var findings []lintFinding
+	add := func(check, format string, args ...interface{}) {
+		for _, ignored := range lint.Ignore {
+			if ignored == check {
+				return
+			}
+		}
+		findings = append(findings, lintFinding{Check: check, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Shadow providers never serve, so their prices don't compete
+	shadows := make(map[string]bool)
+	for _, providerConfig := range config.ExternalProviders {
+		shadows[providerConfig.Name] = providerConfig.Shadow
+	}
+	names := make([]string, 0, len(providerSet))
+	for name := range providerSet {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// The cheapest provider price, averaged like provider targets' cost
+	cheapestProvider, cheapestModel, cheapestCost := "", "", 0.0
+	now := time.Now()
+	for _, name := range names {
+		var stale []string
+		checked := time.Time{}
+		for model, pricing := range providerSet[name].GetModelPricing() {
+			if cost := (pricing.InputPricePer1K + pricing.OutputPricePer1K) / 2; !shadows[name] && pricing.PricePerMinute == 0 && (cheapestProvider == "" || cost < cheapestCost) {
+				cheapestProvider, cheapestModel, cheapestCost = name, model, cost
+			}
+			updated := pricing.UpdatedAt
+			if updated.IsZero() {
+				updated = providers.BuiltinPricingDate
+			}
+			if now.Sub(updated) > lint.PricingMaxAge {
+				stale = append(stale, model)
+				if checked.IsZero() || updated.Before(checked) {
+					checked = updated
+				}
+			}
+		}
+		if len(stale) > 0 {
+			sort.Strings(stale)
+			add("pricing_stale", "%s pricing for %s was last checked %s, over %.0f days ago; verify it against the published prices",
+				name, strings.Join(stale, ", "), checked.Format("2006-01-02"), lint.PricingMaxAge.Hours()/24)
+		}
+	}
+
+	// Clusters are judged at an optimistic throughput: one that loses even
+	// then never wins on cost
+	threshold := config.Router.Strategies.Hybrid.ClusterCostThreshold
+	clustersUnderThreshold := 0
+	for _, cluster := range config.Clusters {
+		if cluster.Shadow {
+			continue
+		}
+		best := cluster.CostPerHour / (lint.ClusterTokensPerSecond * 3600) * config.Router.OverheadFactor * 1000
+		if cheapestProvider != "" && best > cheapestCost {
+			add("cluster_cost", "cluster %s costs at least $%.4f/1K tokens even at %.0f tokens/s, more than %s %s at $%.4f/1K; cost-based strategies will never pick it",
+				cluster.Name, best, lint.ClusterTokensPerSecond, cheapestProvider, cheapestModel, cheapestCost)
+		}
+		if best <= threshold {
+			clustersUnderThreshold++
+		}
+	}
+
+	// Enabled providers, as only those can be routed to
+	enabledProviders := 0
+	for _, providerConfig := range config.ExternalProviders {
+		if providerConfig.Enabled && !providerConfig.Shadow {
+			enabledProviders++
+		}
+	}
+	servingClusters := 0
+	for _, cluster := range config.Clusters {
+		if !cluster.Shadow {
+			servingClusters++
+		}
+	}
+
+	strategyName := config.Router.RoutingStrategy
+	if strategyName == "hybrid" {
+		if servingClusters > 0 && clustersUnderThreshold == 0 {
+			add("hybrid_threshold", "no cluster can get under strategies.hybrid.clusterCostThreshold of $%.4f/1K tokens even at %.0f tokens/s, so hybrid routing only ever picks the cheapest target",
+				threshold, lint.ClusterTokensPerSecond)
+		}
+		if servingClusters > 0 && enabledProviders > 0 && cheapestProvider != "" && threshold >= cheapestCost*10 {
+			add("hybrid_threshold", "strategies.hybrid.clusterCostThreshold of $%.4f/1K tokens is over ten times the cheapest provider price ($%.4f/1K), so hybrid routing behaves like cluster_first",
+				threshold, cheapestCost)
+		}
+	}
+
+	switch {
+	case strategyName == "external_first" && enabledProviders == 0:
+		add("unreachable_strategy", "routingStrategy is external_first but no external providers are enabled")
+	case strategyName == "cluster_first" && servingClusters == 0:
+		add("unreachable_strategy", "routingStrategy is cluster_first but no clusters are configured")
+	case (strategyName == "hybrid" || strategyName == "cost") && servingClusters == 0 && enabledProviders > 0:
+		add("unreachable_strategy", "routingStrategy is %s but no clusters are configured, so external providers are weighed only against each other", strategyName)
+	case (strategyName == "hybrid" || strategyName == "cost") && enabledProviders == 0 && servingClusters > 0:
+		add("unreachable_strategy", "routingStrategy is %s but no external providers are enabled, so clusters are weighed only against each other", strategyName)
+	case strategyName == "weighted" && len(config.Router.Strategies.Weighted.Percentages) > 0:
+		var unknown []string
+		for target := range config.Router.Strategies.Weighted.Percentages {
+			if !configuredTarget(config, target) {
+				unknown = append(unknown, target)
+			}
+		}
+		sort.Strings(unknown)
+		for _, target := range unknown {
+			add("unreachable_strategy", "strategies.weighted.percentages names %s, which is not a configured cluster or provider", target)
+		}
+	case strategyName == "extension" && len(config.Extensions) == 0:
+		add("unreachable_strategy", "routingStrategy is extension but no extensions are loaded, so targets are picked as by hybrid")
+	}
+	if servingClusters+enabledProviders == 0 {
+		add("unreachable_strategy", "no clusters or enabled external providers are configured, so every request will fail")
+	}
+	return findings
+}
+
+// configuredTarget reports whether name is a configured cluster or provider
+func configuredTarget(config *Config, name string) bool {
+	for _, cluster := range config.Clusters {
+		if cluster.Name == name {
+			return true
+		}
+	}
+	for _, providerConfig := range config.ExternalProviders {
+		if providerConfig.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// logLintFindings reports findings as startup warnings
+func logLintFindings(findings []lintFinding) {
+	for _, finding := range findings {
+		logrus.Warnf("Config lint (%s): %s", finding.Check, finding.Message)
+	}
+}
@@ -1,22 +1,58 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	"crypto/subtle"
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math"
+	"math/rand"
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"strconv"
+	"sync"
 	"syscall"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/accesslog"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/auth"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/bandit"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/breaker"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/budget"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/capability"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/compress"
 	"github.com/navillasa/multi-cloud-llm-router/router/internal/cost"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/discovery"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/embedding"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/extension"
 	"github.com/navillasa/multi-cloud-llm-router/router/internal/forward"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/glossary"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/groups"
 	"github.com/navillasa/multi-cloud-llm-router/router/internal/health"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/history"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/httpcache"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/mirror"
 	"github.com/navillasa/multi-cloud-llm-router/router/internal/providers"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/quota"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/ratelimit"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/respcache"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/secrets"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/semcache"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/spotprice"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/statusfeed"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/strategy"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/usageexport"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/usagestore"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/watchdog"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/webhook"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
@@ -27,24 +63,51 @@ import (
 type Config struct {
 	Server            ServerConfig                   `yaml:"server"`
 	Clusters          []ClusterConfig                `yaml:"clusters"`
+	ClusterGroups     []groups.Config                `yaml:"clusterGroups,omitempty"`
 	ExternalProviders []providers.ProviderConfig     `yaml:"externalProviders"`
 	Router            RouterConfig                   `yaml:"router"`
 	Demo              DemoConfig                     `yaml:"demo"`
+	Admin             AdminConfig                    `yaml:"admin"`
+	Auth              auth.Config                    `yaml:"auth"` // caller authentication for /v1
+	Tenants           map[string]quota.Limits        `yaml:"tenants"` // per-tenant budgets and request quotas
+	Webhooks          webhook.Config                 `yaml:"webhooks"`
+	StatusFeeds       statusfeed.Config              `yaml:"statusFeeds"` // provider status pages as an advisory health signal
+	Glossary          glossary.Config                `yaml:"glossary"`    // term substitution in requests and responses
+	Mirroring         mirror.Config                  `yaml:"mirroring"`   // sampled self-hosted traffic as a training dataset
+	UsageStore        usagestore.Config              `yaml:"usageStore"`  // durable per-request tokens and cost
+	UsageExport       usageexport.Config             `yaml:"usageExport"` // usage records as CSV or Parquet in object storage
+	EmbeddingDims     embedding.Config               `yaml:"embeddingDimensions"` // server-side `dimensions` for backends lacking it
+	ProviderPlugins   []string                       `yaml:"providerPlugins,omitempty"` // Go plugin paths registering extra provider types
+	Extensions        []extension.Config             `yaml:"extensions,omitempty"`      // WASM request/response filters and scorers
+	Pricing           PricingConfig                  `yaml:"pricing"`             // overrides of the built-in provider pricing tables
+	AccessLog         accesslog.Config               `yaml:"accessLog"`           // one structured line per request
+	Discovery         DiscoveryConfig                `yaml:"discovery"`           // clusters read from Consul or etcd
+	Secrets           secrets.Config                 `yaml:"secrets"`             // stores that vault:, awssm:// and gcpsm:// values are read from
+
+	secretReferences int // distinct secret references resolved when loaded
 }
 
 // DemoConfig holds demo-specific configuration
 type DemoConfig struct {
 	Enabled        bool          `yaml:"enabled"`
 	Password       string        `yaml:"password"`
-	SessionTimeout time.Duration `yaml:"sessionTimeout"`
-	RateLimitPerIP int           `yaml:"rateLimitPerIP"`
+	SessionTimeout time.Duration `yaml:"sessionTimeout"` // how long a session token is valid, default 1h; refresh before it runs out
+	SigningKey     string        `yaml:"signingKey"`     // HMAC key for session tokens, default one kept in stateDir; set it to share sessions across replicas
+	RateLimitPerIP int           `yaml:"rateLimitPerIP"` // demo requests per minute per client IP, 0 for no limit
+	Tenant         string        `yaml:"tenant"`         // tenant demo sessions are attributed to, default "demo"
+	Sandbox        SandboxConfig `yaml:"sandbox"`
 }
 
 type ServerConfig struct {
-	Port         int           `yaml:"port"`
-	ReadTimeout  time.Duration `yaml:"readTimeout"`
-	WriteTimeout time.Duration `yaml:"writeTimeout"`
-	IdleTimeout  time.Duration `yaml:"idleTimeout"`
+	Port            int               `yaml:"port"`
+	ReadTimeout     time.Duration     `yaml:"readTimeout"`
+	WriteTimeout    time.Duration     `yaml:"writeTimeout"`
+	IdleTimeout     time.Duration     `yaml:"idleTimeout"`
+	TLS             TLSConfig         `yaml:"tls"`
+	Concurrency     ConcurrencyConfig `yaml:"concurrency"`     // in-flight LLM request cap and load shedding
+	MaxRequestBytes int64             `yaml:"maxRequestBytes"` // larger request bodies get a 413, default 10MiB, negative disables
+	MaxUploadBytes  int64             `yaml:"maxUploadBytes"`  // the same for audio transcription uploads, default 25MiB as OpenAI's
+	TrustedProxies  []string          `yaml:"trustedProxies"`  // proxies, addresses or CIDR ranges, whose X-Forwarded-For is believed
 }
 
 type ClusterConfig struct {
@@ -53,26 +116,76 @@ type ClusterConfig struct {
 	Region       string  `yaml:"region"`
 	Provider     string  `yaml:"provider"`
 	CostPerHour  float64 `yaml:"costPerHour"`
-	AuthType     string  `yaml:"authType"` // "hmac" or "mtls"
+	Weight       float64 `yaml:"weight,omitempty"` // Share of traffic in weighted routing (default 1)
+	Engine       string  `yaml:"engine,omitempty"` // "llamacpp" (default), "vllm", "litellm", "localai", "ollama"
+	AuthType     string  `yaml:"authType"`         // "hmac" or "mtls"
+	APIKey       string  `yaml:"apiKey,omitempty"` // sent using the engine's auth header convention
 	SharedSecret string  `yaml:"sharedSecret,omitempty"`
 	CertFile     string  `yaml:"certFile,omitempty"`
 	KeyFile      string  `yaml:"keyFile,omitempty"`
+	ModelAliases map[string]string `yaml:"modelAliases,omitempty"` // requested model -> model sent to this cluster
+	HealthTimeout time.Duration    `yaml:"healthTimeout,omitempty"` // per-request health check timeout (default 10s)
+	Shadow       bool              `yaml:"shadow,omitempty"`        // receives copies of live traffic but never serves clients
+	ContextWindow int              `yaml:"contextWindow,omitempty"` // tokens the served model accepts, prompt plus output (0 = unknown)
+	Reasoning    bool              `yaml:"reasoning,omitempty"`     // serves a reasoning model, whatever its name
+	Vision       bool              `yaml:"vision,omitempty"`        // serves a model that accepts images, whatever its name
+	SpotPrice    *spotprice.Config `yaml:"spotPrice,omitempty"`     // cost the cluster at current spot prices instead of costPerHour
+	Endpoints    []string          `yaml:"endpoints,omitempty"`     // API paths served, default chat, completions and embeddings
 }
 
 type RouterConfig struct {
 	StickinessWindow         time.Duration `yaml:"stickinessWindow"`
 	HealthCheckInterval      time.Duration `yaml:"healthCheckInterval"`
+	MaxConsecutiveErrors     int           `yaml:"maxConsecutiveErrors"` // failed checks before a target is unhealthy, default 3
+	RecoveryThreshold        int           `yaml:"recoveryThreshold"`    // successful checks before an unhealthy cluster returns, default 1
+	ProviderHealthTTL        time.Duration `yaml:"providerHealthTTL"` // cached provider health lifetime, default 2x healthCheckInterval
 	MaxLatencyMs             int           `yaml:"maxLatencyMs"`
 	MaxQueueDepth            int           `yaml:"maxQueueDepth"`
 	OverheadFactor           float64       `yaml:"overheadFactor"`
 	MetricsUpdateInterval    time.Duration `yaml:"metricsUpdateInterval"`
 	RoutingStrategy          string        `yaml:"routingStrategy"`
 	EnableExternalFallback   bool          `yaml:"enableExternalFallback"`
-	ClusterCostThreshold     float64       `yaml:"clusterCostThreshold"`
+	ClusterCostThreshold     float64       `yaml:"clusterCostThreshold"` // deprecated: use strategies.hybrid
 	EnableSmartMocking       bool          `yaml:"enableSmartMocking"`
 	MonthlyAPIBudget         float64       `yaml:"monthlyAPIBudget"`
+	BudgetPacing             budget.PacingConfig `yaml:"budgetPacing"` // spread monthlyAPIBudget over days or hours
+	History                  history.Config      `yaml:"history"`      // per-target series behind /admin/targets/{name}/history
+	Lint                     LintConfig          `yaml:"lint"`         // startup warnings for suspicious values
+	BudgetAlerts             BudgetAlertConfig   `yaml:"budgetAlerts"`
 	MockClusterLatency       int           `yaml:"mockClusterLatency"`
 	MockClusterCost          float64       `yaml:"mockClusterCost"`
+	ModelMapping             map[string][]string `yaml:"modelMapping"`       // requested model -> fallbacks when no target serves it
+	ModelSubstitution        ModelSubstitutionConfig `yaml:"modelSubstitution"` // quality tiers tried after modelMapping
+	ModelAliases             map[string]string   `yaml:"modelAliases"`       // requested model -> model routed and forwarded
+	TokenTiers               []TokenTier         `yaml:"tokenTiers"`         // first tier matching the prompt's size picks the targets
+	Embeddings               EmbeddingsPoolConfig `yaml:"embeddings"`        // targets and strategy of /v1/embeddings
+	StrictModelRouting       bool                `yaml:"strictModelRouting"` // reject unservable models instead of routing anywhere
+	FallbackOrder            []string            `yaml:"fallbackOrder"`      // target names tried in turn when a target fails
+	MaxAttempts              int                 `yaml:"maxAttempts"`        // re-selection stops after this many attempts, chain hops included
+	RateLimitWait            time.Duration       `yaml:"rateLimitWait"`      // longest a request waits for provider rate limit quota when nothing else serves, default 10s, negative fails at once
+	RateLimitCooldown        CooldownConfig      `yaml:"rateLimitCooldown"`  // providers answering 429 are skipped for as long as they ask
+	WatchdogInterval         time.Duration `yaml:"watchdogInterval"`
+	SchemaValidation         SchemaValidationConfig `yaml:"schemaValidation"`
+	PromptCompression        compress.Config        `yaml:"promptCompression"`
+	UserAffinity             UserAffinityConfig     `yaml:"userAffinity"`
+	CostCeiling              CostCeilingConfig      `yaml:"costCeiling"`
+	Strategies               strategy.Config        `yaml:"strategies"`
+	CircuitBreaker           breaker.Config         `yaml:"circuitBreaker"`
+	Calibration              cost.CalibrationConfig `yaml:"calibration"`
+	ProviderProbes           ProviderProbeConfig    `yaml:"providerProbes"`
+	CapabilityProbes         capability.Config      `yaml:"capabilityProbes"`
+	Canary                   CanaryConfig           `yaml:"canary"`
+	Shadow                   ShadowConfig           `yaml:"shadow"`
+	Batches                  BatchConfig            `yaml:"batches"`         // /v1/batches run in the background
+	Reasoning                ReasoningConfig        `yaml:"reasoning"`
+	Vision                   VisionConfig           `yaml:"vision"`
+	TenantRouting            map[string]TenantRoutingConfig `yaml:"tenantRouting"` // per-tenant target restrictions
+	Streaming                StreamingConfig        `yaml:"streaming"`
+	ResponseCost             ResponseCostConfig     `yaml:"responseCost"`
+	ResponseCache            respcache.Config       `yaml:"responseCache"` // identical non-streaming requests answered from memory
+	SemanticCache            semcache.Config        `yaml:"semanticCache"`  // requests whose prompts mean the same answered from memory
+	DecisionHeader           bool                   `yaml:"decisionHeader"` // send X-LLM-Router-Decision with every response
+	MetricLabels             MetricLabelsConfig     `yaml:"metricLabels"`
 }
 
 // Router holds the main application state
@@ -83,6 +196,56 @@ type Router struct {
 	forwarder       *forward.Forwarder
 	providerManager *providers.ProviderManager
 	metrics         *Metrics
+	routingLocks    *routingLocks
+	watchdog        *watchdog.Watchdog
+	groups          *groups.Manager
+	killSwitch      *killSwitch
+	cordons         *clusterCordons
+	targets         *targetConfigs
+	limits          *routingLimits
+	catalogCache    *httpcache.Cache
+	stickiness      *stickyTable
+	strategies      *strategy.Store
+	policy          *policyStore
+	webhooks        *webhook.Deliverer
+	latency         *latencyTracker
+	extensions      *extension.Manager
+	statusFeeds     *statusfeed.Monitor
+	drain           *drainState
+	breakers        *breaker.Set
+	rateLimits      *ratelimit.Set
+	admission       *admission
+	auth            *auth.Authenticator
+	apiKeys         *apiKeyStore
+	glossary        *glossary.Glossary
+	canary          *canary
+	mirror          *mirror.Mirror
+	shadowSlots     chan struct{}
+	budget          *budget.Ledger
+	capabilities    *capabilityStore
+	reducer         *embedding.Reducer
+	quotas          *quota.Tracker
+	history         *history.Store
+	usageStore      *usagestore.Recorder
+	usageExport     *usageexport.Exporter
+	accessLog       *accesslog.Logger
+	responseCache   *respcache.Cache
+	semanticCache   *semcache.Cache
+	modelLabels     *modelLabels
+	bandit          *bandit.Bandit
+	demoLimiter     *demoLimiter
+	demoSessions    *demoSessions // nil unless demo mode is on
+	pricing         *pricingWatcher
+	spotPrices      *spotprice.Monitor
+	discovery       *discovery.Watcher
+	discovered      *discoveredClusters
+	batches         *batchStore
+	batchSlots      chan struct{} // bounds batch requests in flight
+	asyncSlots      chan struct{} // bounds async jobs in flight
+
+	configFile string  // reloaded on SIGHUP; empty disables reloads
+	fileConfig *Config // as last loaded from configFile
+	reloadMu   sync.Mutex
 }
 
 // Metrics holds Prometheus metrics
@@ -91,11 +254,50 @@ type Metrics struct {
 	requestDuration     *prometheus.HistogramVec
 	clusterHealth       *prometheus.GaugeVec
 	clusterCost         *prometheus.GaugeVec
+	overheadFactor      *prometheus.GaugeVec
+	calibrationDrift    *prometheus.GaugeVec
 	providerHealth      *prometheus.GaugeVec
 	providerCost        *prometheus.GaugeVec
 	routingDecisions    *prometheus.CounterVec
 	externalAPIRequests *prometheus.CounterVec
 	tokenUsage          *prometheus.CounterVec
+	schemaValidations   *prometheus.CounterVec
+	costCeilings        *prometheus.CounterVec
+	hedges              *prometheus.CounterVec
+	circuitTransitions  *prometheus.CounterVec
+	webhookDeliveries   *prometheus.CounterVec
+	tenantRequests      *prometheus.CounterVec
+	demoRequests        *prometheus.CounterVec
+	quotaRejections     *prometheus.CounterVec
+	tenantSpend         *prometheus.GaugeVec
+	canaryRequests      *prometheus.CounterVec
+	mirroredExamples    *prometheus.CounterVec
+	modelSubstitutions  *prometheus.CounterVec
+	shadowRequests      *prometheus.CounterVec
+	tokenTiers          *prometheus.CounterVec
+	targetCapabilities  *prometheus.GaugeVec
+	externalBudget      *prometheus.GaugeVec
+	budgetRestricted    prometheus.Gauge
+	budgetExhausted     prometheus.Gauge
+	shadowDuration      *prometheus.HistogramVec
+	embeddingReductions *prometheus.CounterVec
+	usageRecords        *prometheus.CounterVec
+	banditReward        *prometheus.GaugeVec
+	clusterHourlyCost   *prometheus.GaugeVec
+	extensionCalls      *prometheus.CounterVec
+	streamAborts        *prometheus.CounterVec
+	rateLimited         *prometheus.CounterVec
+	shedRequests        *prometheus.CounterVec
+	inFlightRequests    prometheus.Gauge
+	queuedRequests      prometheus.Gauge
+	queueWait           *prometheus.HistogramVec
+	providerCooldowns   *prometheus.CounterVec
+	responseCache       *prometheus.CounterVec
+	semanticCache       *prometheus.CounterVec
+	semanticSimilarity  prometheus.Histogram
+
+	promptCompressions     *prometheus.CounterVec
+	compressionTokensSaved prometheus.Counter
 }
 
 func newMetrics() *Metrics {
@@ -105,7 +307,7 @@ func newMetrics() *Metrics {
 				Name: "llm_router_requests_total",
 				Help: "Total number of requests processed",
 			},
-			[]string{"cluster", "status"},
+			[]string{"cluster", "status", "model", "endpoint"},
 		),
 		requestDuration: prometheus.NewHistogramVec(
 			prometheus.HistogramOpts{
@@ -113,7 +315,7 @@ func newMetrics() *Metrics {
 				Help:    "Request duration in seconds",
 				Buckets: prometheus.DefBuckets,
 			},
-			[]string{"cluster"},
+			[]string{"cluster", "model", "endpoint"},
 		),
 		clusterHealth: prometheus.NewGaugeVec(
 			prometheus.GaugeOpts{
@@ -129,6 +331,20 @@ func newMetrics() *Metrics {
 			},
 			[]string{"cluster", "provider", "region"},
 		),
+		overheadFactor: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "llm_router_cluster_overhead_factor",
+				Help: "Overhead factor applied to each cluster's cost, calibrated from observed throughput",
+			},
+			[]string{"cluster"},
+		),
+		calibrationDrift: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "llm_router_cost_calibration_drift",
+				Help: "Observed over predicted cost per 1K tokens minus 1 at the last calibration",
+			},
+			[]string{"cluster"},
+		),
 		routingDecisions: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "llm_router_routing_decisions_total",
@@ -162,7 +378,256 @@ func newMetrics() *Metrics {
 				Name: "llm_router_tokens_total",
 				Help: "Total tokens processed",
 			},
-			[]string{"provider", "type"}, // type: input, output
+			[]string{"provider", "model", "type"}, // type: input, output, reasoning
+		),
+		schemaValidations: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_schema_validations_total",
+				Help: "Structured output validations by outcome (valid, repaired, retried, escalated, invalid, failed)",
+			},
+			[]string{"target", "outcome"},
+		),
+		costCeilings: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_cost_ceiling_total",
+				Help: "Requests hitting their max_cost ceiling by outcome (rejected, stream_stopped)",
+			},
+			[]string{"outcome"},
+		),
+		hedges: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_hedges_total",
+				Help: "Hedged requests by outcome (sent, primary_won, hedge_won)",
+			},
+			[]string{"outcome"},
+		),
+		circuitTransitions: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_circuit_transitions_total",
+				Help: "Circuit breaker state changes by target and new state (open, half_open, closed)",
+			},
+			[]string{"target", "state"},
+		),
+		webhookDeliveries: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_webhook_deliveries_total",
+				Help: "Async result deliveries to callback URLs by outcome (delivered, failed)",
+			},
+			[]string{"outcome"},
+		),
+		tenantRequests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_tenant_requests_total",
+				Help: "Authenticated /v1 requests by tenant and method (oidc, mtls, apikey, demo)",
+			},
+			[]string{"tenant", "method"},
+		),
+		demoRequests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_demo_requests_total",
+				Help: "Demo session requests by outcome (admitted, rate_limited, expired)",
+			},
+			[]string{"outcome"},
+		),
+		quotaRejections: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_tenant_quota_rejections_total",
+				Help: "Requests rejected with 429 by tenant and exhausted limit (monthly_budget, daily_requests)",
+			},
+			[]string{"tenant", "limit"},
+		),
+		tenantSpend: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "llm_router_tenant_spend_usd",
+				Help: "Month-to-date spend of tenants with limits",
+			},
+			[]string{"tenant"},
+		),
+		canaryRequests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_canary_requests_total",
+				Help: "Requests compared during a canary by cohort (canary, baseline) and status",
+			},
+			[]string{"cohort", "status"},
+		),
+		mirroredExamples: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_mirrored_examples_total",
+				Help: "Sampled cluster exchanges by outcome (queued, skipped)",
+			},
+			[]string{"cluster", "outcome"},
+		),
+		modelSubstitutions: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_model_substitutions_total",
+				Help: "Requests served with a mapped model because the requested one was unavailable",
+			},
+			[]string{"requested", "served"},
+		),
+		externalBudget: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "llm_router_external_budget_usd",
+				Help: "External provider budget state (monthly_budget, month_spend, slice_allowance, slice_spend)",
+			},
+			[]string{"kind"},
+		),
+		budgetRestricted: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "llm_router_budget_pacing_restricted",
+				Help: "1 while external routing waits for the next budget slice",
+			},
+		),
+		targetCapabilities: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "llm_router_target_capability",
+				Help: "Probed target capabilities: 1/0 per endpoint, streaming and tools, and the context window in tokens",
+			},
+			[]string{"target", "capability"},
+		),
+		tokenTiers: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_token_tier_requests_total",
+				Help: "Requests matched to a token tier by outcome (routed, fallback, rejected)",
+			},
+			[]string{"tier", "outcome"},
+		),
+		budgetExhausted: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "llm_router_external_budget_exhausted",
+				Help: "1 once external spend reaches monthlyAPIBudget and providers are no longer routed to",
+			},
+		),
+		shadowRequests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_shadow_requests_total",
+				Help: "Copies of live requests sent to shadow targets by status code (error, dropped without a response)",
+			},
+			[]string{"target", "status"},
+		),
+		shadowDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "llm_router_shadow_request_duration_seconds",
+				Help:    "Shadow request duration",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"target"},
+		),
+		embeddingReductions: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_embedding_reductions_total",
+				Help: "Embeddings responses reduced to the requested dimensions by the router, by method and outcome (reduced, error)",
+			},
+			[]string{"method", "outcome"},
+		),
+		usageRecords: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_usage_records_total",
+				Help: "Per-request usage records for the usage store by outcome (queued, dropped)",
+			},
+			[]string{"outcome"},
+		),
+		banditReward: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "llm_router_bandit_reward_estimate",
+				Help: "Mean reward the bandit strategy has learned per target, in dollars (higher is better)",
+			},
+			[]string{"target"},
+		),
+		clusterHourlyCost: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "llm_router_cluster_cost_per_hour",
+				Help: "Hourly cost clusters are priced at, following spot prices where configured",
+			},
+			[]string{"cluster"},
+		),
+		extensionCalls: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_extension_calls_total",
+				Help: "Extension hook calls by hook and outcome (ok, rejected, error)",
+			},
+			[]string{"hook", "outcome"},
+		),
+		streamAborts: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_stream_aborts_total",
+				Help: "Streams ended before completion by target and reason (idle_timeout, upstream_error, cost_ceiling, cancelled)",
+			},
+			[]string{"target", "reason"},
+		),
+		rateLimited: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_rate_limited_total",
+				Help: "Times a provider was passed over for having spent its requests or tokens per minute",
+			},
+			[]string{"provider"},
+		),
+		shedRequests: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_shed_requests_total",
+				Help: "LLM requests turned away by the concurrency limit by reason (queue_full, queue_timeout, cancelled)",
+			},
+			[]string{"reason"},
+		),
+		inFlightRequests: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "llm_router_in_flight_requests",
+				Help: "LLM requests holding a concurrency slot",
+			},
+		),
+		queuedRequests: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "llm_router_queued_requests",
+				Help: "LLM requests waiting for a concurrency slot",
+			},
+		),
+		queueWait: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "llm_router_queue_wait_seconds",
+				Help:    "Time admitted LLM requests waited for a concurrency slot by priority class",
+				Buckets: []float64{0.001, 0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10},
+			},
+			[]string{"priority"},
+		),
+		providerCooldowns: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_provider_cooldowns_total",
+				Help: "429 responses that put a provider in rate limit cool-down",
+			},
+			[]string{"provider"},
+		),
+		responseCache: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_response_cache_requests_total",
+				Help: "Cacheable LLM requests by response cache result (hit, miss, bypass)",
+			},
+			[]string{"result"},
+		),
+		semanticCache: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_semantic_cache_requests_total",
+				Help: "Cacheable LLM requests by semantic cache result (hit, miss, bypass, error)",
+			},
+			[]string{"result"},
+		),
+		semanticSimilarity: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "llm_router_semantic_cache_similarity",
+				Help:    "Similarity of the closest cached prompt found by semantic cache lookups",
+				Buckets: []float64{0.5, 0.7, 0.8, 0.85, 0.9, 0.925, 0.95, 0.975, 0.99, 1},
+			},
+		),
+		promptCompressions: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "llm_router_prompt_compressions_total",
+				Help: "Prompts over the compression threshold by decision (applied, skipped)",
+			},
+			[]string{"decision"},
+		),
+		compressionTokensSaved: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Name: "llm_router_prompt_compression_tokens_saved_total",
+				Help: "Estimated prompt tokens removed by compression",
+			},
 		),
 	}
 
@@ -171,39 +636,185 @@ func newMetrics() *Metrics {
 		m.requestDuration,
 		m.clusterHealth,
 		m.clusterCost,
+		m.overheadFactor,
+		m.calibrationDrift,
 		m.providerHealth,
 		m.providerCost,
 		m.routingDecisions,
 		m.externalAPIRequests,
 		m.tokenUsage,
+		m.schemaValidations,
+		m.costCeilings,
+		m.hedges,
+		m.circuitTransitions,
+		m.webhookDeliveries,
+		m.tenantRequests,
+		m.demoRequests,
+		m.quotaRejections,
+		m.tenantSpend,
+		m.canaryRequests,
+		m.mirroredExamples,
+		m.modelSubstitutions,
+		m.shadowRequests,
+		m.tokenTiers,
+		m.targetCapabilities,
+		m.externalBudget,
+		m.budgetRestricted,
+		m.budgetExhausted,
+		m.shadowDuration,
+		m.embeddingReductions,
+		m.usageRecords,
+		m.banditReward,
+		m.clusterHourlyCost,
+		m.extensionCalls,
+		m.streamAborts,
+		m.rateLimited,
+		m.shedRequests,
+		m.inFlightRequests,
+		m.queuedRequests,
+		m.queueWait,
+		m.providerCooldowns,
+		m.responseCache,
+		m.semanticCache,
+		m.semanticSimilarity,
+		m.promptCompressions,
+		m.compressionTokensSaved,
 	)
 
 	return m
 }
 
 // NewRouter creates a new router instance
-func NewRouter(config *Config) *Router {
+func NewRouter(config *Config) (*Router, error) {
+	groupManager, err := groups.NewManager(config.ClusterGroups)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster groups: %w", err)
+	}
+
+	strategies, err := strategy.NewStore(config.Router.Strategies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid strategies: %w", err)
+	}
+
+	extensions, err := extension.Load(context.Background(), config.Extensions)
+	if err != nil {
+		return nil, err
+	}
+
+	terms, err := glossary.New(config.Glossary)
+	if err != nil {
+		return nil, fmt.Errorf("invalid glossary: %w", err)
+	}
+
+	reducer, err := embedding.New(config.EmbeddingDims)
+	if err != nil {
+		return nil, fmt.Errorf("invalid embeddingDimensions: %w", err)
+	}
+
+	semanticCache, err := semcache.New(config.Router.SemanticCache)
+	if err != nil {
+		return nil, fmt.Errorf("invalid router.semanticCache: %w", err)
+	}
+
+	usageRecorder, err := usagestore.Open(config.UsageStore, config.Admin.StateDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid usageStore: %w", err)
+	}
+
+	usageExporter, err := usageexport.New(config.UsageExport, usageRecorder, config.Admin.StateDir)
+	if err != nil {
+		return nil, fmt.Errorf("invalid usageExport: %w", err)
+	}
+
+	accessLogger, err := accesslog.New(config.AccessLog)
+	if err != nil {
+		return nil, fmt.Errorf("invalid accessLog: %w", err)
+	}
+
+	discoverer, err := discovery.New(config.Discovery.Config)
+	if err != nil {
+		return nil, fmt.Errorf("invalid discovery: %w", err)
+	}
+
+	var sessions *demoSessions
+	if config.Demo.Enabled {
+		if sessions, err = newDemoSessions(config.Demo, config.Admin.StateDir); err != nil {
+			return nil, err
+		}
+	}
+
+	datasetMirror, err := mirror.New(config.Mirroring)
+	if err != nil {
+		return nil, fmt.Errorf("invalid mirroring: %w", err)
+	}
+
+	if err := validateTokenTiers(config.Router.TokenTiers); err != nil {
+		return nil, err
+	}
+
+	ledger, err := budget.New(config.Router.MonthlyAPIBudget, config.Router.BudgetPacing, config.Router.BudgetAlerts.Thresholds)
+	if err != nil {
+		return nil, fmt.Errorf("invalid external budget: %w", err)
+	}
+
+	quotas, err := quota.New(config.Tenants)
+	if err != nil {
+		return nil, fmt.Errorf("invalid tenants: %w", err)
+	}
+
 	metrics := newMetrics()
 
+	catalogCache := httpcache.New(filepath.Join(config.Admin.StateDir, "catalog-cache"))
+
 	healthChecker := health.NewChecker(config.Router.HealthCheckInterval)
+	healthChecker.SetCatalogCache(catalogCache)
+	healthChecker.SetThresholds(config.Router.MaxConsecutiveErrors, config.Router.RecoveryThreshold)
+	if config.Router.ProviderHealthTTL > 0 {
+		healthChecker.SetProviderHealthTTL(config.Router.ProviderHealthTTL)
+	}
 	costEngine := cost.NewEngine(config.Router.OverheadFactor)
 	forwarder := forward.NewForwarder()
 	providerManager := providers.NewProviderManager()
 
 	// Register clusters
 	for _, cluster := range config.Clusters {
-		healthChecker.AddCluster(cluster.Name, cluster.Endpoint)
-		costEngine.AddCluster(cluster.Name, cluster.CostPerHour)
-
-		// Configure authentication
-		switch cluster.AuthType {
-		case "hmac":
-			forwarder.SetHMACAuth(cluster.Name, cluster.SharedSecret)
-		case "mtls":
-			if cluster.CertFile != "" && cluster.KeyFile != "" {
-				forwarder.SetMTLSAuth(cluster.Name, cluster.CertFile, cluster.KeyFile)
-			}
+		if err := registerCluster(cluster, healthChecker, costEngine, forwarder); err != nil {
+			logrus.Warnf("Cluster %s: %v", cluster.Name, err)
+		}
+	}
+
+	// Spot-priced clusters start at costPerHour until the first price arrives
+	spotConfigs := make(map[string]spotprice.Config)
+	for _, cluster := range config.Clusters {
+		if cluster.SpotPrice != nil {
+			spotConfig := *cluster.SpotPrice
+			spotConfigs[cluster.Name] = spotConfig
+		}
+	}
+	spotPrices, err := spotprice.New(spotConfigs, func(cluster string, costPerHour float64) {
+		logrus.Debugf("Cluster %s now costs $%.4f/hour at spot prices", cluster, costPerHour)
+		costEngine.UpdateClusterCost(cluster, costPerHour)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid spot price config: %w", err)
+	}
+
+	// Load provider plugins before resolving provider types
+	for _, path := range config.ProviderPlugins {
+		if err := providers.LoadPlugin(path); err != nil {
+			logrus.Errorf("%v", err)
+			continue
 		}
+		logrus.Infof("Loaded provider plugin: %s", path)
+	}
+	if err := checkConfig(config); err != nil {
+		return nil, err
+	}
+
+	// Price overrides apply before anything reads the pricing tables
+	pricing := &pricingWatcher{config: config.Pricing, loadedAt: time.Now()}
+	if err := pricing.load(); err != nil {
+		return nil, fmt.Errorf("invalid pricing: %w", err)
 	}
 
 	// Register external providers
@@ -211,28 +822,86 @@ func NewRouter(config *Config) *Router {
 		if !providerConfig.Enabled {
 			continue
 		}
-
-		// Expand environment variables in API key
-		apiKey := os.ExpandEnv(providerConfig.APIKey)
-		providerConfig.APIKey = apiKey
-
-		var provider providers.Provider
-		switch providerConfig.Type {
-		case "openai":
-			provider = providers.NewOpenAIProvider(providerConfig)
-		case "claude":
-			provider = providers.NewClaudeProvider(providerConfig)
-		case "gemini":
-			provider = providers.NewGeminiProvider(providerConfig)
-		default:
-			logrus.Warnf("Unknown provider type: %s", providerConfig.Type)
+		if _, err := registerProvider(providerConfig, config, catalogCache, providerManager, healthChecker); err != nil {
+			logrus.Warnf("Skipping provider %s: %v", providerConfig.Name, err)
 			continue
 		}
-
-		providerManager.RegisterProvider(provider)
 		logrus.Infof("Registered external provider: %s (%s)", providerConfig.Name, providerConfig.Type)
 	}
 
+	pricing.warnUnknown(providerManager.GetAllProviders())
+	logLintFindings(lintConfig(config, providerManager.GetAllProviders()))
+
+	if config.Auth.MTLS.Enabled && config.Server.TLS.ClientCAFile == "" {
+		logrus.Warnf("auth.mtls is enabled but server.tls.clientCAFile is not set; no client certificates will be verified")
+	}
+
+	// Group spend survives deploys so monthly budgets aren't reset
+	spendPath := filepath.Join(config.Admin.StateDir, "group-spend.json")
+	var spend map[string]groups.Spend
+	if err := readStateFile(spendPath, &spend); err != nil {
+		logrus.Warnf("Failed to read cluster group spend: %v", err)
+	}
+	groupManager.RestoreSpend(spend)
+	drain := &drainState{}
+	drain.onFlush("cluster_group_spend", func() error {
+		return writeStateFile(spendPath, groupManager.Spend())
+	})
+
+	// So is external spend, along with the current pacing slice
+	externalSpendPath := filepath.Join(config.Admin.StateDir, externalSpendFile)
+	var externalSpend budget.State
+	if err := readStateFile(externalSpendPath, &externalSpend); err != nil {
+		logrus.Warnf("Failed to read external spend: %v", err)
+	}
+	ledger.Restore(externalSpend)
+	drain.onFlush("external_spend", func() error {
+		return writeStateFile(externalSpendPath, ledger.State())
+	})
+	tenantUsagePath := filepath.Join(config.Admin.StateDir, tenantUsageFile)
+	var tenantUsage map[string]quota.Usage
+	if err := readStateFile(tenantUsagePath, &tenantUsage); err != nil {
+		logrus.Warnf("Failed to read tenant usage: %v", err)
+	}
+	quotas.Restore(tenantUsage)
+	drain.onFlush("tenant_usage", func() error {
+		return writeStateFile(tenantUsagePath, quotas.State())
+	})
+	targetHistory := history.New(config.Router.History)
+	historyPath := filepath.Join(config.Admin.StateDir, targetHistoryFile)
+	var historyState history.State
+	if err := readStateFile(historyPath, &historyState); err != nil {
+		logrus.Warnf("Failed to read target history: %v", err)
+	}
+	targetHistory.Restore(historyState)
+	drain.onFlush("target_history", func() error {
+		return writeStateFile(historyPath, targetHistory.State())
+	})
+	learned := bandit.New()
+	banditPath := filepath.Join(config.Admin.StateDir, banditStateFile)
+	var banditState map[string]bandit.Arm
+	if err := readStateFile(banditPath, &banditState); err != nil {
+		logrus.Warnf("Failed to read bandit state: %v", err)
+	}
+	learned.Restore(banditState)
+	drain.onFlush("bandit", func() error {
+		return writeStateFile(banditPath, learned.State())
+	})
+	batches := newBatchStore(config.Admin.StateDir, config.Router.Batches)
+	drain.onFlush("batches", batches.flush)
+	if usageRecorder != nil {
+		drain.onFlush("usage_store", func() error {
+			return usageRecorder.Flush(context.Background())
+		})
+	}
+	if datasetMirror != nil {
+		drain.onFlush("dataset_mirror", func() error {
+			return datasetMirror.Flush(context.Background())
+		})
+	}
+
+	authenticator := auth.New(config.Auth)
+	webhooks := webhook.New(config.Webhooks)
 	return &Router{
 		config:          config,
 		healthChecker:   healthChecker,
@@ -240,51 +909,239 @@ func NewRouter(config *Config) *Router {
 		forwarder:       forwarder,
 		providerManager: providerManager,
 		metrics:         metrics,
-	}
+		routingLocks:    newRoutingLocks(),
+		groups:          groupManager,
+		killSwitch:      newKillSwitch(config.Admin.StateDir),
+		cordons:         newClusterCordons(config.Admin.StateDir, healthChecker),
+		targets:         &targetConfigs{clusters: config.Clusters, providers: config.ExternalProviders},
+		limits:          newRoutingLimits(config.Router),
+		discovery:       discoverer,
+		discovered:      &discoveredClusters{clusters: make(map[string]ClusterConfig), clashes: make(map[string]bool)},
+		fileConfig:      config,
+		catalogCache:    catalogCache,
+		stickiness:      newStickyTable(config.Router.StickinessWindow),
+		strategies:      strategies,
+		policy:          newPolicyStore(config),
+		webhooks:        webhooks,
+		asyncSlots:      make(chan struct{}, webhooks.MaxJobs()),
+		latency:         newLatencyTracker(),
+		extensions:      extensions,
+		statusFeeds:     statusfeed.NewMonitor(config.StatusFeeds),
+		drain:           drain,
+		auth:            authenticator,
+		apiKeys:         newAPIKeyStore(config.Admin.StateDir, authenticator),
+		glossary:        terms,
+		mirror:          datasetMirror,
+		shadowSlots:     make(chan struct{}, config.Router.Shadow.Concurrency),
+		batches:         batches,
+		batchSlots:      make(chan struct{}, config.Router.Batches.Concurrency),
+		budget:          ledger,
+		capabilities:    newCapabilityStore(config.Admin.StateDir, config.Router.CapabilityProbes.Enabled),
+		reducer:         reducer,
+		quotas:          quotas,
+		history:         targetHistory,
+		usageStore:      usageRecorder,
+		usageExport:     usageExporter,
+		accessLog:       accessLogger,
+		responseCache:   respcache.New(config.Router.ResponseCache),
+		semanticCache:   semanticCache,
+		modelLabels:     newModelLabels(config.Router.MetricLabels),
+		bandit:          learned,
+		demoLimiter:     newDemoLimiter(config.Demo.RateLimitPerIP),
+		demoSessions:    sessions,
+		pricing:         pricing,
+		spotPrices:      spotPrices,
+		rateLimits:      newRateLimits(config.ExternalProviders),
+		admission:       newAdmission(config.Server.Concurrency),
+		canary: newCanary(config.Router.Canary, config.Admin.StateDir, func(group, status string) {
+			metrics.canaryRequests.WithLabelValues(group, status).Inc()
+		}),
+		breakers: breaker.New(config.Router.CircuitBreaker, func(target, state string) {
+			metrics.circuitTransitions.WithLabelValues(target, state).Inc()
+			targetHistory.Circuit(target, state)
+		}),
+	}, nil
 }
 
 // Start starts the router server
 func (r *Router) Start(ctx context.Context) error {
-	// Start background services
-	go r.healthChecker.Start(ctx)
-	go r.updateMetrics(ctx)
+	// Start background services under the watchdog
+	r.watchdog = watchdog.New(ctx, r.config.Router.WatchdogInterval)
+	r.watchdog.Supervise("health_checker", r.healthChecker.Interval(), r.healthChecker.Start)
+	r.watchdog.Supervise("metrics_updater", r.config.Router.MetricsUpdateInterval, r.updateMetrics)
+	r.watchdog.Supervise("batches", batchPollInterval, r.processBatches)
+	if r.config.Router.Calibration.Enabled {
+		r.watchdog.Supervise("cost_calibration", r.config.Router.Calibration.Interval, r.calibrateCosts)
+	}
+	if r.mirror != nil {
+		r.watchdog.Supervise("dataset_mirror", r.mirror.Interval(), r.mirror.Start)
+	}
+	if r.semanticCache != nil && r.semanticCache.Config().Store == "redis" {
+		r.watchdog.Supervise("semantic_cache_sync", r.semanticCache.Interval(), r.semanticCache.Start)
+	}
+	if r.usageStore != nil {
+		r.watchdog.Supervise("usage_store", r.usageStore.Interval(), r.usageStore.Start)
+	}
+	if r.usageExport != nil {
+		r.watchdog.Supervise("usage_export", r.usageExport.Interval(), r.usageExport.Start)
+	}
+	if r.config.Router.CapabilityProbes.Enabled {
+		r.watchdog.Supervise("capability_probes", r.healthChecker.Interval(), r.probeCapabilities)
+	}
+	if r.config.StatusFeeds.Enabled {
+		r.watchdog.Supervise("status_feeds", r.statusFeeds.Interval(), r.statusFeeds.Start)
+	}
+	if r.spotPrices != nil {
+		r.watchdog.Supervise("spot_prices", r.spotPrices.Interval(), r.spotPrices.Start)
+	}
+	if r.config.Pricing.File != "" {
+		r.watchdog.Supervise("pricing_reload", r.config.Pricing.ReloadInterval, r.pricing.watch)
+	}
+	if r.discovery != nil {
+		r.watchdog.Supervise("discovery", r.discovery.Interval(), r.watchDiscovery)
+	}
+	if r.configFile != "" {
+		r.watchdog.Supervise("config_reload", r.config.Admin.ConfigReload.Interval, r.watchConfig)
+		if r.config.secretReferences > 0 {
+			r.watchdog.Supervise("secrets_refresh", r.config.Secrets.RefreshInterval, r.refreshSecrets)
+		}
+	}
+	go r.watchdog.Start(ctx)
 
 	// Setup HTTP server
 	router := mux.NewRouter()
 
 	// Health endpoint
 	router.HandleFunc("/health", r.healthHandler).Methods("GET")
+	router.HandleFunc("/ready", r.readyHandler).Methods("GET")
 
 	// Metrics endpoint
-	router.Handle("/metrics", promhttp.Handler()).Methods("GET")
+	// OpenMetrics carries the request ID exemplars
+	router.Handle("/metrics", promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true})).Methods("GET")
+
+	// Router internals status
+	router.HandleFunc("/api/status", r.statusHandler).Methods("GET")
 
-	// Demo authentication endpoint
+	// Demo authentication endpoint; sessions are confined to demo.sandbox
 	if r.config.Demo.Enabled {
 		router.HandleFunc("/api/auth", r.authHandler).Methods("POST")
+		router.HandleFunc("/api/auth/refresh", r.refreshSessionHandler).Methods("POST")
 	}
 
 	// LLM API endpoints
 	api := router.PathPrefix("/v1").Subrouter()
-	api.HandleFunc("/chat/completions", r.chatCompletionsHandler).Methods("POST")
-	api.HandleFunc("/completions", r.completionsHandler).Methods("POST")
-	api.HandleFunc("/embeddings", r.embeddingsHandler).Methods("POST")
+	api.Use(r.logAccess)
+	api.Use(openAIErrors) // every failure in OpenAI's error schema
+	api.Use(r.authenticate)
+	api.HandleFunc("/chat/completions", r.limitConcurrency(r.chatCompletionsHandler)).Methods("POST")
+	api.HandleFunc("/completions", r.limitConcurrency(r.completionsHandler)).Methods("POST")
+	api.HandleFunc("/embeddings", r.limitConcurrency(r.embeddingsHandler)).Methods("POST")
+	api.HandleFunc("/audio/transcriptions", r.limitConcurrency(r.transcriptionsHandler)).Methods("POST")
+	api.HandleFunc("/audio/speech", r.limitConcurrency(r.speechHandler)).Methods("POST")
+	api.HandleFunc("/models", r.modelsHandler).Methods("GET")
+
+	// Batches: JSONL files of requests run in the background
+	api.HandleFunc("/files", requireTenant(r.uploadFileHandler)).Methods("POST")
+	api.HandleFunc("/files", requireTenant(r.listFilesHandler)).Methods("GET")
+	api.HandleFunc("/files/{id}", requireTenant(r.fileHandler)).Methods("GET")
+	api.HandleFunc("/files/{id}", requireTenant(r.deleteFileHandler)).Methods("DELETE")
+	api.HandleFunc("/files/{id}/content", requireTenant(r.fileContentHandler)).Methods("GET")
+	api.HandleFunc("/batches", requireTenant(r.createBatchHandler)).Methods("POST")
+	api.HandleFunc("/batches", requireTenant(r.listBatchesHandler)).Methods("GET")
+	api.HandleFunc("/batches/{id}", requireTenant(r.batchHandler)).Methods("GET")
+	api.HandleFunc("/batches/{id}/cancel", requireTenant(r.cancelBatchHandler)).Methods("POST")
+
+	// Anthropic's Messages API, for clients on the Anthropic SDK
+	messages := router.PathPrefix("/anthropic/v1").Subrouter()
+	messages.Use(r.logAccess)
+	messages.Use(anthropicErrors) // every failure in Anthropic's error schema
+	messages.Use(anthropicCredentials)
+	messages.Use(r.authenticate)
+	messages.HandleFunc("/messages", r.limitConcurrency(r.messagesHandler)).Methods("POST")
+
+	// Router control endpoints for API clients. Explaining changes
+	// nothing, so it stays available in read-only mode.
+	api.HandleFunc("/router/explain", r.explainHandler).Methods("POST")
+	control := api.PathPrefix("/router").Subrouter()
+	control.Use(r.readOnlyGuard)
+	control.HandleFunc("/refresh", r.refreshHandler).Methods("POST")
+	control.HandleFunc("/refresh/{id}", r.releaseLockHandler).Methods("DELETE")
+	control.HandleFunc("/usage", requireTenant(r.usageReportHandler)).Methods("GET")
+	control.HandleFunc("/forecast", requireTenant(r.forecastHandler)).Methods("GET")
+
+	// Operator endpoints, enabled by setting an admin token
+	if r.config.Admin.Token != "" {
+		admin := router.PathPrefix("/admin").Subrouter()
+		admin.Use(r.requireAdmin, r.readOnlyGuard)
+		admin.HandleFunc("/killswitch", r.killSwitchHandler).Methods("GET")
+		admin.HandleFunc("/killswitch", r.engageKillSwitchHandler).Methods("POST")
+		admin.HandleFunc("/killswitch", r.releaseKillSwitchHandler).Methods("DELETE")
+		admin.HandleFunc("/clusters", r.addClusterHandler).Methods("POST")
+		admin.HandleFunc("/providers", r.addProviderHandler).Methods("POST")
+		admin.HandleFunc("/providers/{name}", r.removeProviderHandler).Methods("DELETE")
+		admin.HandleFunc("/clusters/{name}/cordon", r.cordonClusterHandler).Methods("POST")
+		admin.HandleFunc("/clusters/{name}/uncordon", r.uncordonClusterHandler).Methods("POST")
+		admin.HandleFunc("/clusters/{name}/drain", r.drainClusterHandler).Methods("POST")
+		admin.HandleFunc("/clusters/{name}", r.removeClusterHandler).Methods("DELETE")
+		admin.HandleFunc("/strategies", r.strategiesHandler).Methods("GET")
+		admin.HandleFunc("/strategies", r.patchStrategiesHandler).Methods("PATCH")
+		admin.HandleFunc("/policy", r.policyHandler).Methods("GET")
+		admin.HandleFunc("/policy", r.importPolicyHandler).Methods("PUT")
+		admin.HandleFunc("/prestop", r.prestopHandler).Methods("GET", "POST")
+		admin.HandleFunc("/snapshot", r.snapshotHandler).Methods("GET")
+		admin.HandleFunc("/budget", r.budgetHandler).Methods("GET")
+		admin.HandleFunc("/quotas", r.quotasHandler).Methods("GET")
+		admin.HandleFunc("/targets/{name}/history", r.targetHistoryHandler).Methods("GET")
+		admin.HandleFunc("/usage", r.usageReportHandler).Methods("GET")
+		admin.HandleFunc("/forecast", r.forecastHandler).Methods("GET")
+		admin.HandleFunc("/response-cache", r.purgeResponseCacheHandler).Methods("DELETE")
+		admin.HandleFunc("/semantic-cache", r.purgeSemanticCacheHandler).Methods("DELETE")
+		admin.HandleFunc("/api-keys", r.apiKeysHandler).Methods("GET")
+		admin.HandleFunc("/api-keys", r.createAPIKeyHandler).Methods("POST")
+		admin.HandleFunc("/api-keys/{id}", r.updateAPIKeyHandler).Methods("PATCH")
+		admin.HandleFunc("/api-keys/{id}", r.deleteAPIKeyHandler).Methods("DELETE")
+		admin.HandleFunc("/bandit", r.banditHandler).Methods("GET")
+		admin.HandleFunc("/capabilities", r.capabilitiesHandler).Methods("GET")
+		admin.HandleFunc("/canary", r.canaryHandler).Methods("GET")
+		admin.HandleFunc("/canary", r.resumeCanaryHandler).Methods("POST")
+		admin.HandleFunc("/canary", r.rollbackCanaryHandler).Methods("DELETE")
+
+		debug := router.PathPrefix("/debug").Subrouter()
+		debug.Use(r.requireAdmin)
+		debug.HandleFunc("/compare", r.compareHandler).Methods("POST")
+	}
 
 	srv := &http.Server{
 		Addr:         fmt.Sprintf(":%d", r.config.Server.Port),
-		Handler:      router,
+		Handler:      assignRequestIDs(r.resolveClientIPs(r.limitRequestBodies(router))),
 		ReadTimeout:  r.config.Server.ReadTimeout,
 		WriteTimeout: r.config.Server.WriteTimeout,
 		IdleTimeout:  r.config.Server.IdleTimeout,
 	}
+	tlsConfig := r.config.Server.TLS
+	if tlsConfig.CertFile != "" {
+		var err error
+		if srv.TLSConfig, err = serverTLSConfig(tlsConfig); err != nil {
+			return err
+		}
+	}
 
 	// Start server in goroutine
 	go func() {
 		logrus.Infof("Starting router on port %d", r.config.Server.Port)
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		var err error
+		if srv.TLSConfig != nil {
+			err = srv.ListenAndServeTLS(tlsConfig.CertFile, tlsConfig.KeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
 			logrus.Fatalf("Server failed to start: %v", err)
 		}
 	}()
 
+	debugSrv := r.debugServer()
+
 	// Wait for context cancellation
 	<-ctx.Done()
 
@@ -292,7 +1149,13 @@ func (r *Router) Start(ctx context.Context) error {
 	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	return srv.Shutdown(shutdownCtx)
+	if debugSrv != nil {
+		debugSrv.Close()
+	}
+	err := srv.Shutdown(shutdownCtx)
+	r.drain.flush()
+	r.extensions.Close(shutdownCtx)
+	return err
 }
 
 // RouteTarget represents a routing target (cluster or external provider)
@@ -303,19 +1166,174 @@ type RouteTarget struct {
 	Cost         float64
 	IsHealthy    bool
 	LatencyP95   float64
+	LatencyEWMA  float64 // observed forward latency in ms, 0 until measured
 	QueueDepth   int
+	Weight       float64            // share of traffic in weighted routing
+	Models       []string           // models served; nil if a cluster's inventory is unknown
+	Aliases      map[string]string  // per-target model rewrites
+	Model        string             // model the request will be sent with, set by model-aware routing
+	Substitute   string             // model served in place of an unavailable requested one
+	Shadow       bool               // only receives copies of live traffic
+	Endpoints    []string           // API paths a cluster serves, see clusterServes
+	Reason       string             // routing decision that chose the target, see decide
 	Provider     providers.Provider // only for external providers
 }
 
-func (r *Router) selectTarget(ctx context.Context) (*RouteTarget, error) {
+// decide records the routing decision that chose target
+func (r *Router) decide(target *RouteTarget, decision string) *RouteTarget {
+	target.Reason = decision
+	r.metrics.routingDecisions.WithLabelValues(target.Name, target.Type, decision).Inc()
+	return target
+}
+
+// selectTarget chooses a target for llmReq and records the decision.
+// Explained requests only leave their reasoning in llmReq.trace.
+func (r *Router) selectTarget(ctx context.Context, llmReq *llmRequest) (*RouteTarget, error) {
+	if llmReq.trace != nil {
+		ctx = withRouteTrace(ctx, llmReq.trace)
+	}
+	target, err := r.chooseTarget(ctx, llmReq)
+	if err != nil || target == nil {
+		return target, err
+	}
+	if llmReq.trace != nil {
+		llmReq.trace.chosen = target
+		return target, nil
+	}
+	return r.decide(target, target.Reason), nil
+}
+
+// chooseTarget narrows the live targets down to those able to serve
+// llmReq, then applies affinity, stickiness and the routing strategy
+func (r *Router) chooseTarget(ctx context.Context, llmReq *llmRequest) (*RouteTarget, error) {
+	trace := llmReq.trace
 	targets := r.getAllTargets(ctx)
-	
+	trace.start(targets)
+	if llmReq.LockID != "" && len(targets) > 0 {
+		targets = r.lockedTargets(llmReq, targets)
+		trace.keep("refresh_lock", targets)
+	}
+	if len(llmReq.Exclude) > 0 {
+		remaining := targets[:0]
+		for _, target := range targets {
+			if !llmReq.Exclude[target.Name] {
+				remaining = append(remaining, target)
+			}
+		}
+		targets = remaining
+	}
+
+	// Demo sessions never reach targets outside the sandbox
+	if llmReq.Demo {
+		targets = r.sandboxTargets(targets)
+		trace.keep("demo_sandbox", targets)
+		if len(targets) == 0 && r.config.Demo.Sandbox.Mock {
+			mock := mockTarget()
+			mock.Reason = "sandbox"
+			return mock, nil
+		}
+	}
+
+	// Nor do tenants reach targets their routing policy rules out
+	targets, err := r.filterByTenant(targets, llmReq)
+	if err != nil {
+		return nil, err
+	}
+	trace.keep("tenant_policy", targets)
+
+	// Embeddings have their own pool, which other requests may be kept off
+	if targets, err = r.filterByEndpointPool(targets, llmReq); err != nil {
+		return nil, err
+	}
+	trace.keep("embeddings_pool", targets)
+
+	// Providers are only sent endpoints they have an API for
+	if targets, err = r.filterByEndpoint(targets, llmReq); err != nil {
+		return nil, err
+	}
+	trace.keep("endpoint", targets)
+
 	if len(targets) == 0 {
 		return nil, fmt.Errorf("no healthy targets available")
 	}
 
+	// Only consider targets serving the requested model
+	if served, ok := r.filterByModel(targets, llmReq.Model); ok {
+		if served[0].Substitute != "" && !r.substitutionAllowed(llmReq) {
+			return nil, fmt.Errorf("%w: %s is not served and substitution is disabled for tenant %q", errModelUnavailable, llmReq.Model, llmReq.Tenant)
+		}
+		targets = served
+		trace.keep("model", targets)
+	} else if r.config.Router.StrictModelRouting {
+		return nil, fmt.Errorf("no healthy target serves model %s", llmReq.Model)
+	} else {
+		logrus.Debugf("No target serves model %s, routing without model filter", llmReq.Model)
+	}
+
+	// Audio is priced by the minute, once the model it's sent as is known
+	r.priceAudio(targets, llmReq)
+
+	targets = r.filterByCapabilities(targets, llmReq)
+	trace.keep("capabilities", targets)
+
+	// Reasoning models are slow and costly, so clients choose whether they want one
+	if targets, err = r.filterByReasoning(targets, llmReq); err != nil {
+		return nil, err
+	}
+	trace.keep("reasoning", targets)
+
+	// Images only reach models that can see them
+	if targets, err = r.filterByVision(targets, llmReq); err != nil {
+		return nil, err
+	}
+	trace.keep("vision", targets)
+
+	// Providers that would ignore a sampling parameter aren't chosen
+	if targets, err = r.filterByParameters(targets, llmReq); err != nil {
+		return nil, err
+	}
+	trace.keep("parameters", targets)
+
+	// Requests too long for a target are rerouted rather than failed upstream
+	if targets, err = r.filterByContextWindow(targets, llmReq); err != nil {
+		return nil, err
+	}
+	trace.keep("context_window", targets)
+
+	if targets, err = r.filterByCostCeiling(targets, llmReq); err != nil {
+		return nil, err
+	}
+	trace.keep("cost_ceiling", targets)
+
+	// Long prompts go where they fit and short ones where they're cheap
+	if targets, err = r.filterByTokenTier(targets, llmReq); err != nil {
+		return nil, err
+	}
+	trace.keep("token_tier", targets)
+
+	// Tenants limited to external fallback only reach providers once no
+	// cluster is left
+	targets = r.filterExternalFallback(targets, llmReq)
+	trace.keep("tenant_external", targets)
+
+	// A canary gets its share before affinity and stickiness apply
+	targets = r.canary.split(targets)
+	trace.keep("canary", targets)
+
+	// Keep an end user's conversation on one cluster
+	if affine := r.userAffinityTarget(llmReq.User, targets); affine != nil {
+		affine.Reason = "user_affinity"
+		return affine, nil
+	}
+
+	// Keep clients on their previous target within the stickiness window
+	if sticky := r.stickyTarget(llmReq.Client, targets); sticky != nil {
+		sticky.Reason = "sticky"
+		return sticky, nil
+	}
+
 	// Apply routing strategy
-	switch r.config.Router.RoutingStrategy {
+	switch r.routingStrategy(llmReq) {
 	case "cost":
 		return r.selectByCost(targets), nil
 	case "latency":
@@ -324,6 +1342,14 @@ func (r *Router) selectTarget(ctx context.Context) (*RouteTarget, error) {
 		return r.selectExternalFirst(targets), nil
 	case "cluster_first":
 		return r.selectClusterFirst(targets), nil
+	case "weighted":
+		return r.selectWeighted(targets), nil
+	case "score":
+		return r.selectByScore(targets), nil
+	case "extension":
+		return r.selectByExtension(ctx, llmReq.Model, targets), nil
+	case "bandit":
+		return r.selectByBandit(targets), nil
 	case "hybrid":
 		fallthrough
 	default:
@@ -332,22 +1358,57 @@ func (r *Router) selectTarget(ctx context.Context) (*RouteTarget, error) {
 }
 
 func (r *Router) getAllTargets(ctx context.Context) []*RouteTarget {
+	targets := r.liveTargets(ctx)
+	serving := targets[:0]
+	for _, target := range targets {
+		if !target.Shadow {
+			serving = append(serving, target)
+		}
+	}
+	return serving
+}
+
+// liveTargets returns every available target, shadow targets included
+func (r *Router) liveTargets(ctx context.Context) []*RouteTarget {
 	var targets []*RouteTarget
+	policy := r.policy.get()
+	trace := routeTraceFrom(ctx)
+	maxLatencyMs, maxQueueDepth := r.limits.get()
 
 	// Add healthy clusters
 	healthyMetrics := r.healthChecker.GetHealthyMetrics()
 	for name, metrics := range healthyMetrics {
-		if metrics.LatencyP95 <= float64(r.config.Router.MaxLatencyMs) &&
-			metrics.QueueDepth <= r.config.Router.MaxQueueDepth {
+		if metrics.LatencyP95 <= float64(maxLatencyMs) &&
+			metrics.QueueDepth <= maxQueueDepth {
+
+			// Skip clusters whose group is at its concurrency or budget limit
+			if allowed, reason := r.groups.Allowed(name); !allowed {
+				logrus.Debugf("Skipping cluster %s: %s", name, reason)
+				trace.skip(name, "cluster_group: "+reason)
+				continue
+			}
 			
 			cost := r.costEngine.CalculateCostPer1KTokens(name, metrics.TokensPerSecond)
 			endpoint := ""
-			for _, cluster := range r.config.Clusters {
+			weight := 1.0
+			var aliases map[string]string
+			var endpoints []string
+			shadow := false
+			for _, cluster := range r.clusterConfigs() {
 				if cluster.Name == name {
 					endpoint = cluster.Endpoint
+					aliases = cluster.ModelAliases
+					endpoints = cluster.Endpoints
+					shadow = cluster.Shadow
 					break
 				}
 			}
+			if policyWeight, ok := policy.Weights[name]; ok && policyWeight > 0 {
+				weight = policyWeight
+			}
+			if groupWeight, ok := r.groups.Weight(name); ok {
+				weight = groupWeight
+			}
 
 			targets = append(targets, &RouteTarget{
 				Name:       name,
@@ -357,37 +1418,112 @@ func (r *Router) getAllTargets(ctx context.Context) []*RouteTarget {
 				IsHealthy:  true,
 				LatencyP95: metrics.LatencyP95,
 				QueueDepth: metrics.QueueDepth,
+				Weight:     weight,
+				Models:     metrics.Models,
+				Aliases:    aliases,
+				Shadow:     shadow,
+				Endpoints:  endpoints,
 			})
+		} else {
+			trace.skip(name, fmt.Sprintf("latency_or_queue: p95 %.0fms, queue depth %d", metrics.LatencyP95, metrics.QueueDepth))
 		}
 	}
 
-	// Add healthy external providers
+	// Add healthy external providers, unless the budget slice is spent
+	externalAllowed, reason := r.budget.Allowed()
+	if !externalAllowed {
+		logrus.Debugf("Skipping external providers: %s", reason)
+	}
 	for _, provider := range r.providerManager.GetAllProviders() {
-		if err := provider.Health(ctx); err == nil {
+		if !externalAllowed {
+			trace.skip(provider.Name(), "budget: "+reason)
+		} else if !r.healthChecker.ProviderHealthy(ctx, provider.Name()) {
+			trace.skip(provider.Name(), "unhealthy")
+		} else if until, cooling := r.providerManager.CoolingDown(provider.Name()); cooling {
+			trace.skip(provider.Name(), "rate_limited: cooling down until "+until.Format(time.RFC3339))
+		} else {
 			// Use estimated cost based on default model
 			pricing := provider.GetModelPricing()
 			cost := float64(999999) // fallback high cost
 			
 			// Get cost from default model or cheapest model
-			for _, modelPricing := range pricing {
+			models := make([]string, 0, len(pricing))
+			for model, modelPricing := range pricing {
+				models = append(models, model)
+				if modelPricing.PricePerMinute > 0 {
+					continue // audio models aren't priced by the token
+				}
 				avgCost := (modelPricing.InputPricePer1K + modelPricing.OutputPricePer1K) / 2
 				if avgCost < cost {
 					cost = avgCost
 				}
 			}
 
+			var aliases map[string]string
+			providerType := ""
+			shadow := false
+			for _, providerConfig := range r.providerConfigs() {
+				if providerConfig.Name == provider.Name() {
+					aliases = providerConfig.ModelAliases
+					providerType = providerConfig.Type
+					shadow = providerConfig.Shadow
+					break
+				}
+			}
+
+			// Reported incidents make a provider look costlier and rarer
+			// rather than removing it, so it still serves if nothing else can
+			weight := 1.0
+			penalty, incident := r.statusFeeds.Penalty(providerType)
+			if penalty > 1 {
+				logrus.Debugf("Deprioritizing provider %s (x%.0f): %s", provider.Name(), penalty, incident)
+				cost *= penalty
+				weight /= penalty
+			}
+
+			// Probed providers are held to the same latency bound as clusters
+			latencyP95, probed := r.healthChecker.ProviderLatencyP95(provider.Name())
+			if probed && latencyP95 > float64(maxLatencyMs) {
+				logrus.Debugf("Skipping provider %s: probe p95 %.0fms", provider.Name(), latencyP95)
+				trace.skip(provider.Name(), fmt.Sprintf("latency: probe p95 %.0fms", latencyP95))
+				continue
+			}
+
 			targets = append(targets, &RouteTarget{
-				Name:      provider.Name(),
-				Type:      "provider",
-				Endpoint:  "", // providers handle their own endpoints
-				Cost:      cost,
-				IsHealthy: true,
-				Provider:  provider,
+				Name:       provider.Name(),
+				Type:       "provider",
+				Endpoint:   "", // providers handle their own endpoints
+				Cost:       cost,
+				IsHealthy:  true,
+				LatencyP95: latencyP95,
+				Weight:     weight,
+				Models:     models,
+				Aliases:    aliases,
+				Provider:   provider,
+				Shadow:     shadow,
 			})
 		}
 	}
 
-	return targets
+	// Targets behind an open circuit breaker sit out their cool-down
+	available := targets[:0]
+	for _, target := range targets {
+		if r.breakers.Available(target.Name) {
+			target.LatencyEWMA, _ = r.latency.get(target.Name)
+			available = append(available, target)
+		} else {
+			trace.skip(target.Name, "circuit_open")
+		}
+	}
+
+	if trace == nil {
+		return r.killSwitch.filter(available)
+	}
+	// The kill switch filters in place, so the trace compares against a copy
+	before := append([]*RouteTarget(nil), available...)
+	allowed := r.killSwitch.filter(available)
+	trace.skipMissing(before, allowed, "kill_switch")
+	return allowed
 }
 
 func (r *Router) selectByCost(targets []*RouteTarget) *RouteTarget {
@@ -402,7 +1538,7 @@ func (r *Router) selectByCost(targets []*RouteTarget) *RouteTarget {
 		}
 	}
 
-	r.metrics.routingDecisions.WithLabelValues(cheapest.Name, cheapest.Type, "lowest_cost").Inc()
+	cheapest.Reason = "lowest_cost"
 	return cheapest
 }
 
@@ -412,14 +1548,21 @@ func (r *Router) selectByLatency(targets []*RouteTarget) *RouteTarget {
 	}
 
 	// Prefer clusters for latency (external providers have network overhead)
-	fastest := targets[0]
-	for _, target := range targets[1:] {
-		if target.Type == "cluster" && target.LatencyP95 < fastest.LatencyP95 {
+	// unless a provider's observed or probed latency proves otherwise
+	var fastest *RouteTarget
+	for _, target := range targets {
+		if target.Type != "cluster" && target.latency() == 0 {
+			continue
+		}
+		if fastest == nil || target.latency() < fastest.latency() {
 			fastest = target
 		}
 	}
+	if fastest == nil {
+		fastest = targets[0]
+	}
 
-	r.metrics.routingDecisions.WithLabelValues(fastest.Name, fastest.Type, "lowest_latency").Inc()
+	fastest.Reason = "lowest_latency"
 	return fastest
 }
 
@@ -427,7 +1570,7 @@ func (r *Router) selectExternalFirst(targets []*RouteTarget) *RouteTarget {
 	// Prefer external providers
 	for _, target := range targets {
 		if target.Type == "provider" {
-			r.metrics.routingDecisions.WithLabelValues(target.Name, target.Type, "external_first").Inc()
+			target.Reason = "external_first"
 			return target
 		}
 	}
@@ -435,7 +1578,7 @@ func (r *Router) selectExternalFirst(targets []*RouteTarget) *RouteTarget {
 	// Fall back to clusters
 	if len(targets) > 0 {
 		target := targets[0]
-		r.metrics.routingDecisions.WithLabelValues(target.Name, target.Type, "cluster_fallback").Inc()
+		target.Reason = "cluster_fallback"
 		return target
 	}
 
@@ -446,7 +1589,7 @@ func (r *Router) selectClusterFirst(targets []*RouteTarget) *RouteTarget {
 	// Prefer clusters
 	for _, target := range targets {
 		if target.Type == "cluster" {
-			r.metrics.routingDecisions.WithLabelValues(target.Name, target.Type, "cluster_first").Inc()
+			target.Reason = "cluster_first"
 			return target
 		}
 	}
@@ -454,7 +1597,7 @@ func (r *Router) selectClusterFirst(targets []*RouteTarget) *RouteTarget {
 	// Fall back to external providers
 	if len(targets) > 0 {
 		target := targets[0]
-		r.metrics.routingDecisions.WithLabelValues(target.Name, target.Type, "external_fallback").Inc()
+		target.Reason = "external_fallback"
 		return target
 	}
 
@@ -467,9 +1610,10 @@ func (r *Router) selectHybrid(targets []*RouteTarget) *RouteTarget {
 	}
 
 	// Find cheapest cluster under threshold
+	threshold := r.strategies.Get().Hybrid.ClusterCostThreshold
 	var cheapestCluster *RouteTarget
 	for _, target := range targets {
-		if target.Type == "cluster" && target.Cost <= r.config.Router.ClusterCostThreshold {
+		if target.Type == "cluster" && target.Cost <= threshold {
 			if cheapestCluster == nil || target.Cost < cheapestCluster.Cost {
 				cheapestCluster = target
 			}
@@ -478,7 +1622,7 @@ func (r *Router) selectHybrid(targets []*RouteTarget) *RouteTarget {
 
 	// Use cluster if found and cost-effective
 	if cheapestCluster != nil {
-		r.metrics.routingDecisions.WithLabelValues(cheapestCluster.Name, cheapestCluster.Type, "hybrid_cluster").Inc()
+		cheapestCluster.Reason = "hybrid_cluster"
 		return cheapestCluster
 	}
 
@@ -490,10 +1634,89 @@ func (r *Router) selectHybrid(targets []*RouteTarget) *RouteTarget {
 		}
 	}
 
-	r.metrics.routingDecisions.WithLabelValues(cheapest.Name, cheapest.Type, "hybrid_cheapest").Inc()
+	cheapest.Reason = "hybrid_cheapest"
 	return cheapest
 }
 
+func (r *Router) selectWeighted(targets []*RouteTarget) *RouteTarget {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	// Configured percentages replace target weights; unlisted targets get none
+	percentages := r.strategies.Get().Weighted.Percentages
+	weights := make([]float64, len(targets))
+	total := 0.0
+	for i, target := range targets {
+		weights[i] = target.Weight
+		if len(percentages) > 0 {
+			weights[i] = percentages[target.Name]
+		}
+		total += weights[i]
+	}
+
+	// Weighted random choice; fall back to uniform if every weight is zero
+	chosen := targets[rand.Intn(len(targets))]
+	if total > 0 {
+		pick := rand.Float64() * total
+		for i, target := range targets {
+			pick -= weights[i]
+			if pick < 0 {
+				chosen = target
+				break
+			}
+		}
+	}
+
+	chosen.Reason = "weighted"
+	return chosen
+}
+
+// selectByScore picks the target with the lowest score, see targetScores
+func (r *Router) selectByScore(targets []*RouteTarget) *RouteTarget {
+	if len(targets) == 0 {
+		return nil
+	}
+
+	var chosen *RouteTarget
+	bestScore := math.Inf(1)
+	for i, score := range r.targetScores(targets) {
+		if score < bestScore {
+			bestScore = score
+			chosen = targets[i]
+		}
+	}
+
+	chosen.Reason = "score"
+	return chosen
+}
+
+// targetScores weighs each target's cost, latency and queue depth, each
+// normalized across the candidates; lower is better
+func (r *Router) targetScores(targets []*RouteTarget) []float64 {
+	weights := r.strategies.Get().Score
+	maxCost, maxLatency, maxQueue := 0.0, 0.0, 0.0
+	for _, target := range targets {
+		maxCost = math.Max(maxCost, target.Cost)
+		maxLatency = math.Max(maxLatency, target.latency())
+		maxQueue = math.Max(maxQueue, float64(target.QueueDepth))
+	}
+	normalize := func(value, max float64) float64 {
+		if max == 0 {
+			return 0
+		}
+		return value / max
+	}
+
+	scores := make([]float64, len(targets))
+	for i, target := range targets {
+		scores[i] = weights.CostWeight*normalize(target.Cost, maxCost) +
+			weights.LatencyWeight*normalize(target.latency(), maxLatency) +
+			weights.QueueWeight*normalize(float64(target.QueueDepth), maxQueue)
+	}
+	return scores
+}
+
 func (r *Router) chatCompletionsHandler(w http.ResponseWriter, req *http.Request) {
 	r.handleLLMRequest(w, req, "/v1/chat/completions")
 }
@@ -508,42 +1731,456 @@ func (r *Router) embeddingsHandler(w http.ResponseWriter, req *http.Request) {
 
 func (r *Router) handleLLMRequest(w http.ResponseWriter, req *http.Request, endpoint string) {
 	start := time.Now()
+	defer r.drain.begin()()
+
+	// Buffer the body so it can be replayed against more than one target
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		status := writeBodyError(w, err, "Failed to read request body")
+		countRequest(req.Context(), r.unparsedRequestCounter(strconv.Itoa(status), req))
+		return
+	}
+	req.Body.Close()
+
+	llmReq := parseLLMRequest(req, endpoint, body)
+	r.applyModelAliases(llmReq)
+	accessRecordFrom(req.Context()).setRequest(llmReq)
+	parseMaxCost(req, llmReq)
+	r.applyPromptCompression(w, req, llmReq)
+	if !r.applyRequestFilters(w, req, llmReq) {
+		return
+	}
+	if !r.admitTenant(w, llmReq) {
+		return
+	}
+
+	respond := func(w http.ResponseWriter) {
+		r.shadowRequest(req, llmReq)
+
+		// Async requests are acknowledged now and delivered to the callback
+		if callbackURL := req.Header.Get(callbackHeader); callbackURL != "" {
+			r.acceptAsync(w, req, llmReq, callbackURL)
+			return
+		}
+
+		r.serveLLMRequest(w, req, llmReq, start)
+	}
+
+	// Repeated requests are answered from the response caches, identical
+	// ones before those that only mean the same
+	r.serveCached(w, req, llmReq, func(w http.ResponseWriter) {
+		r.serveSemanticCached(w, req, llmReq, respond)
+	})
+}
+
+// routeLLMRequest selects a target for a parsed request, forwards it and
+// records the outcome. Connection errors and 5xx responses that haven't
+// reached the client yet fail over along router.fallbackOrder, then to
+// freshly selected targets until router.maxAttempts is reached. Hedgeable
+// requests race duplicate copies within each attempt.
+func (r *Router) routeLLMRequest(w http.ResponseWriter, req *http.Request, llmReq *llmRequest, start time.Time) {
 	ctx := req.Context()
 
-	// Select target (cluster or external provider)
-	target, err := r.selectTarget(ctx)
+	target, release, err := r.acquireTarget(ctx, llmReq)
+	if errors.Is(err, errCostCeilingExceeded) {
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+		countRequest(ctx, r.requestCounter("none", "402", llmReq))
+		return
+	}
+	if errors.Is(err, errModelUnavailable) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		countRequest(ctx, r.requestCounter("none", "404", llmReq))
+		return
+	}
+	var windowErr *contextWindowError
+	if errors.As(err, &windowErr) {
+		writeContextWindowError(w, windowErr)
+		countRequest(ctx, r.requestCounter("none", "400", llmReq))
+		return
+	}
+	var paramErr *unsupportedParameterError
+	if errors.As(err, &paramErr) {
+		writeUnsupportedParameterError(w, paramErr)
+		countRequest(ctx, r.requestCounter("none", "400", llmReq))
+		return
+	}
+	var limitErr *rateLimitError
+	if errors.As(err, &limitErr) {
+		writeRateLimitError(w, limitErr)
+		countRequest(ctx, r.requestCounter("none", "429", llmReq))
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("No available targets: %v", err), http.StatusServiceUnavailable)
-		r.metrics.requestsTotal.WithLabelValues("none", "503").Inc()
+		countRequest(ctx, r.requestCounter("none", "503", llmReq))
 		return
 	}
 
-	// Forward request based on target type
-	if target.Type == "cluster" {
-		// Forward to cluster
-		err = r.forwarder.Forward(w, req, target.Name, target.Endpoint+endpoint)
-	} else if target.Type == "provider" {
-		// Forward to external provider
-		err = target.Provider.Forward(ctx, w, req, endpoint)
-		
-		// Record external API request
-		status := "success"
+	// Committed streams are kept alive through idle-cutting proxies
+	if llmReq.Stream && r.config.Router.Streaming.KeepAliveInterval > 0 {
+		keeper := newStreamKeeper(w, r.config.Router.Streaming.KeepAliveInterval)
+		defer keeper.Close()
+		w = keeper
+	}
+
+	for attempt := 1; ; attempt++ {
+		fw := newFailoverWriter(w)
+		if r.hedgeable(llmReq) {
+			target, err = r.forwardHedged(ctx, fw, req, target, release, llmReq, start)
+		} else {
+			err = r.forwardAttempt(ctx, fw, req, target, llmReq, start)
+			release()
+		}
+		if (err == nil && !fw.failed) || fw.committed {
+			return
+		}
+
+		llmReq.Exclude[target.Name] = true
+		decision := "failover"
+		next, nextRelease, ok := r.nextFallback(ctx, llmReq, target.Name)
+		if !ok && attempt < r.policy.get().MaxAttempts {
+			decision = "retry"
+			next, nextRelease, err = r.acquireTarget(ctx, llmReq)
+			ok = err == nil
+		}
+		if !ok {
+			// Out of fallbacks: pass on the last upstream failure
+			if fw.failed {
+				fw.failure.writeTo(w)
+			} else {
+				http.Error(w, "Upstream request failed", http.StatusBadGateway)
+			}
+			return
+		}
+
+		logRequest(ctx, logrus.WarnLevel, "Attempt %d on %s failed, %s to %s", attempt, target.Name, decision, next.Name)
+		r.decide(next, decision)
+		target, release = next, nextRelease
+	}
+}
+
+// acquireTarget selects a target (cluster or external provider), claiming it
+// with claimTarget. When only providers out of rate limit quota could serve,
+// it waits for the soonest of them, up to router.rateLimitWait.
+func (r *Router) acquireTarget(ctx context.Context, llmReq *llmRequest) (*RouteTarget, func(), error) {
+	var queued time.Duration
+	for {
+		target, release, err := r.selectAndClaim(ctx, llmReq)
+		if err == nil || len(llmReq.rateLimited) == 0 {
+			return target, release, err
+		}
+		if err := r.waitForRateLimit(ctx, llmReq, &queued); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// selectAndClaim selects a target and claims it with claimTarget. Losing
+// the race for the last group slot or a half-open probe, or finding the
+// provider out of quota, excludes the target and selects again.
+func (r *Router) selectAndClaim(ctx context.Context, llmReq *llmRequest) (*RouteTarget, func(), error) {
+	for {
+		target, err := r.selectTarget(ctx, llmReq)
 		if err != nil {
-			status = "error"
+			return nil, nil, err
+		}
+		if release, ok := r.claimTarget(target, llmReq); ok {
+			return target, release, nil
+		}
+		llmReq.Exclude[target.Name] = true
+	}
+}
+
+// claimTarget takes the target's circuit breaker permit and, for clusters,
+// a slot in its cluster groups, for providers their rate limit quota. The
+// release func frees the group slot.
+func (r *Router) claimTarget(target *RouteTarget, llmReq *llmRequest) (func(), bool) {
+	if !r.breakers.Acquire(target.Name) {
+		return nil, false
+	}
+	if target.Type != "cluster" {
+		if !r.takeRateLimit(target, llmReq) {
+			r.breakers.Release(target.Name)
+			return nil, false
+		}
+		return func() {}, true
+	}
+	if release, ok := r.groups.TryAcquire(target.Name); ok {
+		return release, true
+	}
+	r.breakers.Release(target.Name)
+	return nil, false
+}
+
+// forwardAttempt sends the request to one target and records the outcome
+func (r *Router) forwardAttempt(ctx context.Context, w http.ResponseWriter, req *http.Request, target *RouteTarget, llmReq *llmRequest, start time.Time) error {
+	var err error
+	forwardStart := time.Now()
+	r.modelLabels.admit(llmReq.Model)
+	if target.Type == "cluster" {
+		defer r.cordons.begin(target.Name)()
+	}
+
+	if r.config.Router.DecisionHeader {
+		w.Header().Set(decisionHeader, decisionSummary(target))
+	}
+	if target.Substitute != "" {
+		w.Header().Set(substitutedHeader, target.Substitute)
+		r.metrics.modelSubstitutions.WithLabelValues(llmReq.Model, target.Substitute).Inc()
+	}
+
+	// Callers can be told what the response cost
+	reported := w
+	var reporter *costReporter
+	if r.config.Router.ResponseCost.Enabled {
+		w.Header().Set(targetHeader, target.Name)
+		reporter = newCostReporter(w, llmReq.Stream, r.config.Router.ResponseCost.BodyField)
+		reported = reporter
+	}
+
+	// Every response's usage is counted. Whole cluster responses also
+	// measure real throughput for overhead calibration, and provider usage
+	// is charged to the budget.
+	// Reasoning traces are stripped outside the tap, so they are still counted
+	stripped := reported
+	if r.stripsReasoning(llmReq.Tenant) {
+		stripper := newReasoningStripper(reported, llmReq.Stream)
+		defer stripper.Close()
+		stripped = stripper
+	}
+	tap := newUsageTap(stripped, llmReq.Model)
+	var out http.ResponseWriter = tap
+	measured := target.Type == "cluster" && !llmReq.Stream
+	if measured {
+		r.costEngine.BeginRequest(target.Name)
+	}
+
+	// Sampled cluster exchanges are mirrored into the training dataset
+	var capture *captureWriter
+	if target.Type == "cluster" && r.mirror.Sample(target.Name) {
+		capture = newCaptureWriter(out, r.mirror.MaxRecordBytes())
+		out = capture
+	}
+
+	// Upstreams that go quiet mid-stream are aborted. Before anything has
+	// reached the client that fails over like any other error.
+	attemptCtx, attemptReq := ctx, req
+	idleTimeout := r.config.Router.Streaming.IdleTimeout
+	var idle *idleWatch
+	if llmReq.Stream && idleTimeout > 0 {
+		var cancel context.CancelFunc
+		attemptCtx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		attemptReq = req.WithContext(attemptCtx)
+		idle = newIdleWatch(out, idleTimeout, cancel)
+		out = idle
+	}
+	abortReason := ""
+
+	// Structured output from clusters is validated before it reaches the client
+	var escalation *schemaEscalation
+	responseSchema, validated := responseSchema(llmReq.Body)
+	if validated && target.Type == "cluster" && r.config.Router.SchemaValidation.Enabled {
+		escalation, err = r.forwardWithSchemaValidation(attemptCtx, out, attemptReq, target, llmReq, responseSchema)
+		if escalation != nil {
+			// The cluster's rejected response is accounted to the cluster
+			// but never reaches the client, and the exchange isn't mirrored:
+			// the stronger target's response isn't cluster output
+			tap = newUsageTap(newResponseBuffer(), llmReq.Model)
+			escalation.last.writeTo(tap)
+			capture = nil
+		}
+	} else if llmReq.MaxCost > 0 && llmReq.Stream {
+		// Streams are cut off gracefully as they near the cost ceiling
+		streamCtx, cancel := context.WithCancel(attemptCtx)
+		defer cancel()
+		ceilingWriter := r.newCeilingWriter(out, target, llmReq, cancel)
+		err = r.forwardToTarget(streamCtx, ceilingWriter, attemptReq.WithContext(streamCtx), target, llmReq)
+		if ceilingWriter.stopped {
+			r.metrics.costCeilings.WithLabelValues("stream_stopped").Inc()
+			abortReason = "cost_ceiling"
+			err = nil
+		}
+	} else {
+		err = r.forwardToTarget(attemptCtx, out, attemptReq, target, llmReq)
+	}
+	if idle != nil {
+		idle.stop()
+		if idle.fired.Load() && ctx.Err() == nil {
+			abortReason = "idle_timeout"
+			err = fmt.Errorf("upstream stream idle for %v", idleTimeout)
+			if fw, ok := w.(*failoverWriter); ok && fw.committed {
+				abortIdleStream(idle.w, idleTimeout)
+			}
+		}
+	}
+	if llmReq.Stream && abortReason == "" && err != nil {
+		abortReason = "upstream_error"
+		if ctx.Err() != nil {
+			abortReason = "cancelled"
+		}
+	}
+	if abortReason != "" {
+		r.metrics.streamAborts.WithLabelValues(target.Name, abortReason).Inc()
+	}
+
+	if measured {
+		usage, _ := tap.usage()
+		r.costEngine.EndRequest(target.Name, usage.CompletionTokens)
+	}
+	// Failed attempts are charged only for usage the upstream reports; an
+	// estimate of an error body or a cut-off stream is no spend. Audio is
+	// priced by the minute whatever usage says, so only success is.
+	usage, estimated := measuredUsage(llmReq, tap)
+	billable := (err == nil && tap.succeeded()) || (!estimated && llmReq.Audio == nil)
+	if !billable {
+		usage = tokenUsage{}
+	}
+	var spend float64
+	if target.Type == "provider" {
+		if billable {
+			spend = r.recordExternalSpend(target, llmReq, usage)
 		}
-		r.metrics.externalAPIRequests.WithLabelValues(target.Name, "unknown", status).Inc()
+		r.rateLimits.Settle(target.Name, r.rateLimitTokens(llmReq), usage.PromptTokens+usage.CompletionTokens)
+	}
+
+	// Streams are open-ended, so only whole responses feed the latency
+	// average, and failures are quick without saying the target is
+	if !llmReq.Stream && err == nil && tap.succeeded() {
+		forwardMs := float64(time.Since(forwardStart).Milliseconds())
+		r.latency.observe(target.Name, forwardMs, r.strategies.Get().Latency.EWMAAlpha)
 	}
 
 	// Record metrics
 	duration := time.Since(start).Seconds()
-	r.metrics.requestDuration.WithLabelValues(target.Name).Observe(duration)
+	observeRequest(ctx, r.metrics.requestDuration.WithLabelValues(target.Name, r.modelLabels.label(llmReq.Model), llmReq.Endpoint), duration)
 
-	if err != nil {
-		logrus.Errorf("Failed to forward request to %s (%s): %v", target.Name, target.Type, err)
-		r.metrics.requestsTotal.WithLabelValues(target.Name, "error").Inc()
+	// Cluster spend is attributed by the compute time the request occupied.
+	// Demo traffic is priced but kept out of production budgets.
+	if target.Type == "cluster" {
+		spend = r.costEngine.ComputeCost(target.Name, time.Since(forwardStart))
+		if !llmReq.Demo {
+			r.groups.RecordSpend(target.Name, spend)
+		}
+	}
+	// Tenants aren't charged for attempts that failed them
+	if billable {
+		r.quotas.Charge(llmReq.Tenant, spend)
+	}
+	if reporter != nil {
+		reporter.finish(responseCost{
+			Target:           target.Name,
+			Cost:             spend,
+			PromptTokens:     usage.PromptTokens,
+			CompletionTokens: usage.CompletionTokens,
+			ReasoningTokens:  usage.CompletionTokensDetails.ReasoningTokens,
+			Estimated:        estimated,
+		})
+	}
+
+	rateLimited := false
+	if fw, ok := w.(*failoverWriter); ok && err == nil && fw.failed {
+		err = fmt.Errorf("upstream returned status %d", fw.failure.StatusCode())
+		// A provider out of quota isn't broken; it is left alone until it
+		// says it has quota again
+		if fw.failure.StatusCode() == http.StatusTooManyRequests && target.Type == "provider" {
+			rateLimited = true
+			r.coolDown(ctx, target, fw.failure.Header())
+		}
+	}
+	if err != nil && ctx.Err() != nil {
+		// Cancelled hedges and departed clients say nothing about the target
+		logrus.WithContext(ctx).Debugf("Request to %s (%s) cancelled: %v", target.Name, target.Type, err)
+		countRequest(ctx, r.requestCounter(target.Name, "cancelled", llmReq))
+		r.breakers.Release(target.Name)
+		r.recordUsage(target, llmReq, usage, estimated, spend, "cancelled", forwardStart)
+	} else if err != nil {
+		logRequest(ctx, logrus.ErrorLevel, "Failed to forward request to %s (%s): %v", target.Name, target.Type, err)
+		countRequest(ctx, r.requestCounter(target.Name, "error", llmReq))
+		if rateLimited {
+			r.breakers.Release(target.Name)
+		} else {
+			r.breakers.Record(target.Name, false)
+		}
+		r.canary.record(target.Name, false, time.Since(forwardStart))
+		r.history.Record(target.Name, false, time.Since(forwardStart), spend)
+		r.learnReward(target, llmReq, false, forwardStart, spend)
+		r.recordUsage(target, llmReq, usage, estimated, spend, "error", forwardStart)
+	} else {
+		countRequest(ctx, r.requestCounter(target.Name, "success", llmReq))
+		model := servedModel(target, llmReq, tap)
+		r.metrics.tokenUsage.WithLabelValues(target.Name, model, "input").Add(float64(usage.PromptTokens))
+		r.metrics.tokenUsage.WithLabelValues(target.Name, model, "output").Add(float64(usage.CompletionTokens))
+		if reasoning := usage.CompletionTokensDetails.ReasoningTokens; reasoning > 0 {
+			r.metrics.tokenUsage.WithLabelValues(target.Name, model, "reasoning").Add(float64(reasoning))
+		}
+		r.stickiness.set(llmReq.Client, target.Name)
+		r.breakers.Record(target.Name, true)
+		r.canary.record(target.Name, true, time.Since(forwardStart))
+		r.history.Record(target.Name, true, time.Since(forwardStart), spend)
+		r.learnReward(target, llmReq, true, forwardStart, spend)
+		r.recordUsage(target, llmReq, usage, estimated, spend, "success", forwardStart)
+		if capture != nil {
+			r.mirrorExchange(target, llmReq, capture)
+		}
+	}
+	accessRecordFrom(ctx).attempt(target, usage, estimated, spend, err)
+	if escalation != nil {
+		return r.escalate(ctx, w, req, escalation, llmReq, responseSchema, start)
+	}
+	return err
+}
+
+// forwardToTarget sends the buffered request body to a cluster or external provider
+func (r *Router) forwardToTarget(ctx context.Context, w http.ResponseWriter, req *http.Request, target *RouteTarget, llmReq *llmRequest) error {
+	if target.Type == "mock" {
+		return serveMock(w, llmReq)
+	}
+	body := llmReq.bodyForTarget(target)
+	forwarder, native := r.nativeMessages(target, llmReq)
+	if forwarder != nil {
+		body = native
+	}
+
+	// Glossary terms are substituted per target, so codenames can be kept
+	// from external providers while reaching self-hosted clusters intact.
+	// Uploads aren't text and are left alone.
+	if sub := r.glossary.For(llmReq.Tenant, target.Type == "provider"); sub != nil && (llmReq.Audio == nil || llmReq.Audio.Boundary == "") {
+		var substituted int
+		if body, substituted = sub.Rewrite(body); substituted > 0 {
+			logrus.WithContext(ctx).Debugf("Substituted %d glossary terms for %s", substituted, target.Name)
+			if sub.Restores() {
+				gw := newGlossaryWriter(w, sub, llmReq.Stream)
+				defer gw.Close()
+				w = gw
+			}
+		}
+	}
+	if rw := r.reduceDimensions(w, target, llmReq, &body); rw != nil {
+		defer rw.Close()
+		w = rw
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	if target.Type == "cluster" {
+		return r.forwarder.Forward(w, req, target.Name, target.Endpoint+llmReq.Endpoint)
+	}
+
+	var err error
+	if forwarder != nil {
+		err = forwarder.ForwardMessages(ctx, w, req)
 	} else {
-		r.metrics.requestsTotal.WithLabelValues(target.Name, "success").Inc()
+		err = target.Provider.Forward(ctx, w, req, llmReq.Endpoint)
+	}
+
+	// Record external API request
+	status := "success"
+	if err != nil {
+		status = "error"
 	}
+	r.metrics.externalAPIRequests.WithLabelValues(target.Name, "unknown", status).Inc()
+
+	return err
 }
 
 func (r *Router) authHandler(w http.ResponseWriter, req *http.Request) {
@@ -557,19 +2194,16 @@ func (r *Router) authHandler(w http.ResponseWriter, req *http.Request) {
 	}
 
 	if err := json.NewDecoder(req.Body).Decode(&authReq); err != nil {
-		http.Error(w, "Invalid request", http.StatusBadRequest)
+		writeBodyError(w, err, "Invalid request")
 		return
 	}
 
-	if authReq.Password == r.config.Demo.Password {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]interface{}{
-			"success": true,
-			"token":   "demo-session", // In production, use proper JWT
-		})
-	} else {
+	// An empty password would let anyone in, so none is accepted
+	if r.config.Demo.Password == "" || subtle.ConstantTimeCompare([]byte(authReq.Password), []byte(r.config.Demo.Password)) != 1 {
 		http.Error(w, "Invalid password", http.StatusUnauthorized)
+		return
 	}
+	r.writeDemoSession(w, newDemoSessionID())
 }
 
 func (r *Router) healthHandler(w http.ResponseWriter, req *http.Request) {
@@ -579,7 +2213,7 @@ func (r *Router) healthHandler(w http.ResponseWriter, req *http.Request) {
 	ctx := req.Context()
 	healthyProviders := 0
 	for _, provider := range r.providerManager.GetAllProviders() {
-		if err := provider.Health(ctx); err == nil {
+		if r.healthChecker.ProviderHealthy(ctx, provider.Name()) {
 			healthyProviders++
 		}
 	}
@@ -587,9 +2221,9 @@ func (r *Router) healthHandler(w http.ResponseWriter, req *http.Request) {
 	status := map[string]interface{}{
 		"status":            "healthy",
 		"healthy_clusters":  healthyCount,
-		"total_clusters":    len(r.config.Clusters),
+		"total_clusters":    len(r.clusterConfigs()),
 		"healthy_providers": healthyProviders,
-		"total_providers":   len(r.config.ExternalProviders),
+		"total_providers":   len(r.providerConfigs()),
 		"timestamp":         time.Now().Format(time.RFC3339),
 	}
 
@@ -597,7 +2231,7 @@ func (r *Router) healthHandler(w http.ResponseWriter, req *http.Request) {
 	json.NewEncoder(w).Encode(status)
 }
 
-func (r *Router) updateMetrics(ctx context.Context) {
+func (r *Router) updateMetrics(ctx context.Context, beat func()) {
 	ticker := time.NewTicker(r.config.Router.MetricsUpdateInterval)
 	defer ticker.Stop()
 
@@ -607,6 +2241,30 @@ func (r *Router) updateMetrics(ctx context.Context) {
 			return
 		case <-ticker.C:
 			r.refreshMetrics()
+			beat()
+		}
+	}
+}
+
+// calibrateCosts periodically recalibrates cluster overhead factors against
+// observed throughput
+func (r *Router) calibrateCosts(ctx context.Context, beat func()) {
+	ticker := time.NewTicker(r.config.Router.Calibration.Interval)
+	defer ticker.Stop()
+
+	beat()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			for name, calibration := range r.costEngine.Calibrate(r.config.Router.Calibration) {
+				logrus.Infof("Calibrated %s overhead factor to %.2f (reported %.1f tok/s, observed %.1f tok/s)",
+					name, calibration.OverheadFactor, calibration.PredictedTPS, calibration.ObservedTPS)
+				r.metrics.overheadFactor.WithLabelValues(name).Set(calibration.OverheadFactor)
+				r.metrics.calibrationDrift.WithLabelValues(name).Set(calibration.Drift)
+			}
+			beat()
 		}
 	}
 }
@@ -616,10 +2274,11 @@ func (r *Router) refreshMetrics() {
 	allMetrics := r.healthChecker.GetAllMetrics()
 
 	// Update cluster metrics
-	for _, cluster := range r.config.Clusters {
+	for _, cluster := range r.clusterConfigs() {
 		metrics, exists := allMetrics[cluster.Name]
 
 		// Update health metric
+		r.history.Health(cluster.Name, exists && metrics.Healthy)
 		if exists && metrics.Healthy {
 			r.metrics.clusterHealth.WithLabelValues(cluster.Name, cluster.Provider, cluster.Region).Set(1)
 		} else {
@@ -632,11 +2291,16 @@ func (r *Router) refreshMetrics() {
 			r.metrics.clusterCost.WithLabelValues(cluster.Name, cluster.Provider, cluster.Region).Set(cost)
 		}
 	}
+	for name, info := range r.costEngine.GetAllClusterCosts() {
+		r.metrics.clusterHourlyCost.WithLabelValues(name).Set(info.CostPerHour)
+	}
 
 	// Update external provider metrics
 	for _, provider := range r.providerManager.GetAllProviders() {
 		// Update health metric
-		if err := provider.Health(ctx); err == nil {
+		healthy := r.healthChecker.ProviderHealthy(ctx, provider.Name())
+		r.history.Health(provider.Name(), healthy)
+		if healthy {
 			r.metrics.providerHealth.WithLabelValues(provider.Name(), "external").Set(1)
 		} else {
 			r.metrics.providerHealth.WithLabelValues(provider.Name(), "external").Set(0)
@@ -645,10 +2309,29 @@ func (r *Router) refreshMetrics() {
 		// Update cost metrics for each model
 		pricing := provider.GetModelPricing()
 		for model, modelPricing := range pricing {
+			if modelPricing.PricePerMinute > 0 {
+				continue
+			}
 			avgCost := (modelPricing.InputPricePer1K + modelPricing.OutputPricePer1K) / 2
 			r.metrics.providerCost.WithLabelValues(provider.Name(), model).Set(avgCost)
 		}
 	}
+
+	budgetStatus := r.budget.Status()
+	r.metrics.externalBudget.WithLabelValues("monthly_budget").Set(budgetStatus.MonthlyBudget)
+	r.metrics.externalBudget.WithLabelValues("month_spend").Set(budgetStatus.MonthSpend)
+	r.metrics.budgetExhausted.Set(boolGauge(budgetStatus.Exhausted))
+	if pacing := budgetStatus.Pacing; pacing != nil {
+		r.metrics.externalBudget.WithLabelValues("slice_allowance").Set(pacing.Allowance)
+		r.metrics.externalBudget.WithLabelValues("slice_spend").Set(pacing.Spend)
+		r.metrics.budgetRestricted.Set(boolGauge(pacing.Restricted))
+	}
+	for tenant, status := range r.quotas.Status() {
+		r.metrics.tenantSpend.WithLabelValues(tenant).Set(status.Spend)
+	}
+	for target, estimate := range r.bandit.Estimates(r.strategies.Get().Bandit.ErrorPenalty) {
+		r.metrics.banditReward.WithLabelValues(target).Set(estimate.Mean)
+	}
 }
 
 func loadConfig(filename string) (*Config, error) {
@@ -657,10 +2340,24 @@ func loadConfig(filename string) (*Config, error) {
 		return nil, fmt.Errorf("failed to read config file: %w", err)
 	}
 
+	// ${VAR}s expand before decoding so any field can take one, and
+	// ROUTER_* variables override whatever the file says
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return nil, fmt.Errorf("failed to parse config: %w", err)
+	}
+	referenced := expandEnv(&document)
 	var config Config
-	if err := yaml.Unmarshal(data, &config); err != nil {
+	if err := document.Decode(&config); err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
+	unknown, err := applyEnvOverrides(&config, referenced)
+	if err != nil {
+		return nil, fmt.Errorf("failed to apply environment overrides: %w", err)
+	}
+	for _, name := range unknown {
+		logrus.Warnf("Environment variable %s names no config field", name)
+	}
 
 	// Set defaults
 	if config.Server.Port == 0 {
@@ -699,17 +2396,223 @@ func loadConfig(filename string) (*Config, error) {
 	if config.Router.ClusterCostThreshold == 0 {
 		config.Router.ClusterCostThreshold = 0.01
 	}
+	config.Router.Strategies.SetDefaults(config.Router.ClusterCostThreshold)
+	if config.Router.Streaming.KeepAliveInterval == 0 {
+		config.Router.Streaming.KeepAliveInterval = 15 * time.Second
+	}
+	if config.Demo.SessionTimeout == 0 {
+		config.Demo.SessionTimeout = time.Hour
+	}
+	if config.Demo.Tenant == "" {
+		config.Demo.Tenant = "demo"
+	}
+	if len(config.Demo.Sandbox.Targets) == 0 {
+		config.Demo.Sandbox.Mock = true
+	}
+	if config.Admin.ConfigReload.Interval == 0 {
+		config.Admin.ConfigReload.Interval = 30 * time.Second
+	}
+	if config.Pricing.ReloadInterval == 0 {
+		config.Pricing.ReloadInterval = 30 * time.Second
+	}
+	if config.Router.Lint.PricingMaxAge == 0 {
+		config.Router.Lint.PricingMaxAge = 90 * 24 * time.Hour
+	}
+	if config.Router.Lint.ClusterTokensPerSecond == 0 {
+		config.Router.Lint.ClusterTokensPerSecond = 100
+	}
+	if config.Router.CostCeiling.DefaultMaxTokens == 0 {
+		config.Router.CostCeiling.DefaultMaxTokens = 512
+	}
+	if config.Router.CostCeiling.StreamStopRatio == 0 {
+		config.Router.CostCeiling.StreamStopRatio = 0.95
+	}
+	if config.Router.MetricLabels.MaxModels == 0 {
+		config.Router.MetricLabels.MaxModels = 50
+	}
+	if config.Router.MaxAttempts == 0 {
+		config.Router.MaxAttempts = 3
+	}
+	if config.Server.MaxRequestBytes == 0 {
+		config.Server.MaxRequestBytes = 10 << 20
+	}
+	if config.Server.MaxUploadBytes == 0 {
+		config.Server.MaxUploadBytes = 25 << 20
+	}
+	if config.Server.Concurrency.MaxQueue == 0 {
+		config.Server.Concurrency.MaxQueue = config.Server.Concurrency.MaxInFlight
+	}
+	if config.Server.Concurrency.QueueTimeout == 0 {
+		config.Server.Concurrency.QueueTimeout = 5 * time.Second
+	}
+	priorities := &config.Server.Concurrency.Priorities
+	if priorities.Weights == nil {
+		priorities.Weights = make(map[string]float64)
+	}
+	for class, weight := range defaultPriorityWeights {
+		if priorities.Weights[class] == 0 {
+			priorities.Weights[class] = weight
+		}
+	}
+	if priorities.Default == "" {
+		priorities.Default = "standard"
+	}
+	if config.Router.RateLimitWait == 0 {
+		config.Router.RateLimitWait = 10 * time.Second
+	}
+	if config.Router.RateLimitCooldown.Default == 0 {
+		config.Router.RateLimitCooldown.Default = 10 * time.Second
+	}
+	if config.Router.RateLimitCooldown.Max == 0 {
+		config.Router.RateLimitCooldown.Max = 5 * time.Minute
+	}
+	if config.Router.ResponseCache.TTL == 0 {
+		config.Router.ResponseCache.TTL = time.Hour
+	}
+	if config.Router.ResponseCache.MaxEntries == 0 {
+		config.Router.ResponseCache.MaxEntries = 1000
+	}
+	if config.Router.ResponseCache.MaxBytes == 0 {
+		config.Router.ResponseCache.MaxBytes = 64 << 20
+	}
+	if config.Router.ResponseCache.MaxEntryBytes == 0 {
+		config.Router.ResponseCache.MaxEntryBytes = 1 << 20
+	}
+	if config.Router.SemanticCache.Threshold == 0 {
+		config.Router.SemanticCache.Threshold = 0.95
+	}
+	if config.Router.SemanticCache.TTL == 0 {
+		config.Router.SemanticCache.TTL = time.Hour
+	}
+	if config.Router.SemanticCache.MaxEntries == 0 {
+		config.Router.SemanticCache.MaxEntries = 1000
+	}
+	if config.Router.SemanticCache.MaxBytes == 0 {
+		config.Router.SemanticCache.MaxBytes = 64 << 20
+	}
+	if config.Router.SemanticCache.MaxEntryBytes == 0 {
+		config.Router.SemanticCache.MaxEntryBytes = 1 << 20
+	}
+	if config.Router.SemanticCache.Timeout == 0 {
+		config.Router.SemanticCache.Timeout = 2 * time.Second
+	}
+	if config.Router.SemanticCache.Store == "" {
+		config.Router.SemanticCache.Store = "memory"
+	}
+	if config.Router.SemanticCache.Redis.Prefix == "" {
+		config.Router.SemanticCache.Redis.Prefix = "llm-router:semcache:"
+	}
+	if config.Router.SemanticCache.Redis.SyncInterval == 0 {
+		config.Router.SemanticCache.Redis.SyncInterval = 5 * time.Second
+	}
+	if config.Router.WatchdogInterval == 0 {
+		config.Router.WatchdogInterval = 10 * time.Second
+	}
+	if config.Router.PromptCompression.ThresholdTokens == 0 {
+		config.Router.PromptCompression.ThresholdTokens = 8000
+	}
+	if config.Admin.StateDir == "" {
+		config.Admin.StateDir = "state"
+	}
+	if config.Admin.PrestopTimeout == 0 {
+		config.Admin.PrestopTimeout = 25 * time.Second
+	}
+	if config.Router.ProviderProbes.Prompt == "" {
+		config.Router.ProviderProbes.Prompt = "ping"
+	}
+	if config.Router.ProviderProbes.MaxTokens == 0 {
+		config.Router.ProviderProbes.MaxTokens = 1
+	}
+	if config.Router.Calibration.Interval == 0 {
+		config.Router.Calibration.Interval = 10 * time.Minute
+	}
+	if config.Router.Calibration.MinFactor == 0 {
+		config.Router.Calibration.MinFactor = 1.0
+	}
+	if config.Router.Calibration.MaxFactor == 0 {
+		config.Router.Calibration.MaxFactor = 3.0
+	}
+	if config.Router.Calibration.MinTokens == 0 {
+		config.Router.Calibration.MinTokens = 10000
+	}
+	if len(config.Router.BudgetAlerts.Thresholds) == 0 {
+		config.Router.BudgetAlerts.Thresholds = []float64{1.0}
+	}
+	if config.Router.Shadow.Concurrency == 0 {
+		config.Router.Shadow.Concurrency = 16
+	}
+	if config.Router.Shadow.Timeout == 0 {
+		config.Router.Shadow.Timeout = 60 * time.Second
+	}
+	if config.Router.Batches.Concurrency <= 0 {
+		config.Router.Batches.Concurrency = 4
+	}
+	if config.Router.Batches.RoutingStrategy == "" {
+		config.Router.Batches.RoutingStrategy = "cost"
+	}
+	if config.Router.Batches.MaxRequests == 0 {
+		config.Router.Batches.MaxRequests = 50000
+	}
+	if config.Router.Batches.Retention == 0 {
+		config.Router.Batches.Retention = 720 * time.Hour
+	}
+	if config.Router.Batches.MaxFiles == 0 {
+		config.Router.Batches.MaxFiles = 100
+	}
+	if config.Router.Batches.MaxFileBytes == 0 {
+		config.Router.Batches.MaxFileBytes = 1 << 30
+	}
+	if config.Router.CapabilityProbes.MaxContextTokens == 0 {
+		config.Router.CapabilityProbes.MaxContextTokens = 32768
+	}
+	if config.Router.CapabilityProbes.Resolution == 0 {
+		config.Router.CapabilityProbes.Resolution = 512
+	}
+	if config.Router.CapabilityProbes.Timeout == 0 {
+		config.Router.CapabilityProbes.Timeout = 60 * time.Second
+	}
+	if config.Router.CapabilityProbes.RefreshInterval == 0 {
+		config.Router.CapabilityProbes.RefreshInterval = 24 * time.Hour
+	}
+	if config.Router.Canary.MinRequests == 0 {
+		config.Router.Canary.MinRequests = 20
+	}
+	if config.Router.Canary.MaxErrorRate == 0 {
+		config.Router.Canary.MaxErrorRate = 0.05
+	}
+	if config.Router.CircuitBreaker.FailureThreshold == 0 {
+		config.Router.CircuitBreaker.FailureThreshold = 5
+	}
+	if config.Router.CircuitBreaker.Cooldown == 0 {
+		config.Router.CircuitBreaker.Cooldown = 30 * time.Second
+	}
+	if config.Router.PromptCompression.PreserveRecent == 0 {
+		config.Router.PromptCompression.PreserveRecent = 2
+	}
+	if config.Secrets.RefreshInterval == 0 {
+		config.Secrets.RefreshInterval = 5 * time.Minute
+	}
 
+	if err := resolveSecrets(&config); err != nil {
+		return nil, err
+	}
 	return &config, nil
 }
 
 func main() {
 	var configFile = flag.String("config", "config.yaml", "Path to configuration file")
+	var restoreFile = flag.String("restore", "", "Load runtime state from a snapshot taken with /admin/snapshot")
+	var validate = flag.Bool("validate-config", false, "Check the configuration file, print any problems and exit")
 	flag.Parse()
 
+	if *validate {
+		os.Exit(runValidateConfig(*configFile, os.Stdout))
+	}
+
 	// Setup logging
 	logrus.SetFormatter(&logrus.JSONFormatter{})
 	logrus.SetLevel(logrus.InfoLevel)
+	logrus.AddHook(requestIDHook{})
 
 	// Load configuration
 	config, err := loadConfig(*configFile)
@@ -718,7 +2621,16 @@ func main() {
 	}
 
 	// Create router
-	router := NewRouter(config)
+	router, err := NewRouter(config)
+	if err != nil {
+		log.Fatalf("Failed to create router: %v", err)
+	}
+	router.configFile = *configFile
+	if *restoreFile != "" {
+		if err := router.restoreFile(*restoreFile); err != nil {
+			log.Fatalf("Failed to restore snapshot: %v", err)
+		}
+	}
 
 	// Setup signal handling
 	ctx, cancel := context.WithCancel(context.Background())
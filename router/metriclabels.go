@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// MetricLabelsConfig bounds the model label of request metrics. Clients
+// choose the model, so labelling every value they send would let them
+// grow the series without limit.
+type MetricLabelsConfig struct {
+	MaxModels int `yaml:"maxModels"` // distinct models labelled, default 50, negative labels none
+}
+
+// Model label values for requests without a labelled model
+const (
+	modelLabelNone  = "none"  // no model in the request
+	modelLabelOther = "other" // past maxModels, or never forwarded
+	modelLabelAll   = "all"   // model labels disabled
+)
+
+// modelLabels admits a model as a label value once a request for it is
+// forwarded, so models no target accepted never become series
+type modelLabels struct {
+	max    int
+	mu     sync.Mutex
+	models map[string]bool
+}
+
+func newModelLabels(config MetricLabelsConfig) *modelLabels {
+	return &modelLabels{max: config.MaxModels, models: make(map[string]bool)}
+}
+
+// admit makes model a label value while there is room for it
+func (m *modelLabels) admit(model string) {
+	if model == "" || m.max < 0 {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.models) < m.max {
+		m.models[model] = true
+	}
+}
+
+// label returns the label value model is counted under
+func (m *modelLabels) label(model string) string {
+	if m.max < 0 {
+		return modelLabelAll
+	}
+	if model == "" {
+		return modelLabelNone
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.models[model] {
+		return model
+	}
+	return modelLabelOther
+}
+
+// requestCounter is llm_router_requests_total for llmReq's outcome on target
+func (r *Router) requestCounter(target, status string, llmReq *llmRequest) prometheus.Counter {
+	return r.metrics.requestsTotal.WithLabelValues(target, status, r.modelLabels.label(llmReq.Model), llmReq.Endpoint)
+}
+
+// unparsedRequestCounter counts a request turned away before its body was
+// parsed, so without a model
+func (r *Router) unparsedRequestCounter(status string, req *http.Request) prometheus.Counter {
+	return r.metrics.requestsTotal.WithLabelValues("none", status, modelLabelNone, req.URL.Path)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/mirror"
+)
+
+// captureWriter keeps a copy of a response for dataset mirroring, giving
+// up once it exceeds the record size limit
+type captureWriter struct {
+	w        http.ResponseWriter
+	body     []byte
+	limit    int
+	overflow bool
+	status   int
+}
+
+func newCaptureWriter(w http.ResponseWriter, limit int) *captureWriter {
+	return &captureWriter{w: w, limit: limit, status: http.StatusOK}
+}
+
+func (c *captureWriter) Header() http.Header {
+	return c.w.Header()
+}
+
+func (c *captureWriter) WriteHeader(status int) {
+	c.status = status
+	c.w.WriteHeader(status)
+}
+
+func (c *captureWriter) Write(p []byte) (int, error) {
+	if !c.overflow {
+		if len(c.body)+len(p) > c.limit {
+			c.overflow, c.body = true, nil
+		} else {
+			c.body = append(c.body, p...)
+		}
+	}
+	return c.w.Write(p)
+}
+
+func (c *captureWriter) Flush() {
+	if flusher, ok := c.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// mirrorExchange queues a successful cluster exchange for the dataset
+func (r *Router) mirrorExchange(target *RouteTarget, llmReq *llmRequest, capture *captureWriter) {
+	outcome := "skipped"
+	if !capture.overflow && capture.status < 400 && r.mirror.Add(mirror.Record{
+		Cluster:  target.Name,
+		Endpoint: llmReq.Endpoint,
+		Tenant:   llmReq.Tenant,
+		Request:  llmReq.Body,
+		Response: capture.body,
+		Stream:   llmReq.Stream,
+	}) {
+		outcome = "queued"
+	}
+	r.metrics.mirroredExamples.WithLabelValues(target.Name, outcome).Inc()
+}
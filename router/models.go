@@ -0,0 +1,60 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// modelEntry is an OpenAI model object extended with the targets serving it
+type modelEntry struct {
+	ID      string   `json:"id"`
+	Object  string   `json:"object"`
+	Created int64    `json:"created"`
+	OwnedBy string   `json:"owned_by"`
+	Targets []string `json:"targets"`
+}
+
+// modelsHandler lists every model servable by a healthy cluster or provider
+// in OpenAI list format
+func (r *Router) modelsHandler(w http.ResponseWriter, req *http.Request) {
+	entries := make(map[string]*modelEntry)
+	add := func(model, target string) {
+		entry, exists := entries[model]
+		if !exists {
+			entry = &modelEntry{ID: model, Object: "model", OwnedBy: target}
+			entries[model] = entry
+		}
+		entry.Targets = append(entry.Targets, target)
+	}
+
+	// Clusters advertise their inventory through the health checker's model listing
+	for name, metrics := range r.healthChecker.GetHealthyMetrics() {
+		for _, model := range metrics.Models {
+			add(model, name)
+		}
+	}
+
+	for name, provider := range r.providerManager.GetAllProviders() {
+		if !r.healthChecker.ProviderHealthy(req.Context(), name) {
+			continue
+		}
+		for model := range provider.GetModelPricing() {
+			add(model, name)
+		}
+	}
+
+	data := make([]*modelEntry, 0, len(entries))
+	for _, entry := range entries {
+		sort.Strings(entry.Targets)
+		entry.OwnedBy = entry.Targets[0]
+		data = append(data, entry)
+	}
+	sort.Slice(data, func(i, j int) bool { return data[i].ID < data[j].ID })
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"object": "list",
+		"data":   data,
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/providers"
+)
+
+// unsupportedParameterError rejects a request setting a parameter no
+// available target can honor
+type unsupportedParameterError struct {
+	param string
+}
+
+func (e *unsupportedParameterError) Error() string {
+	return fmt.Sprintf("Unsupported parameter: '%s' is not supported by any available target.", e.param)
+}
+
+// filterByParameters drops providers that can't honor a parameter the
+// request sets, such as seed on Claude, rather than let them ignore it.
+// Clusters speak OpenAI's API and are kept.
+func (r *Router) filterByParameters(targets []*RouteTarget, llmReq *llmRequest) ([]*RouteTarget, error) {
+	var requestData map[string]interface{}
+	parsed := false
+	kept := targets[:0:0]
+	param := ""
+	for _, target := range targets {
+		checker, ok := target.Provider.(providers.ParameterChecker)
+		if !ok {
+			kept = append(kept, target)
+			continue
+		}
+		if !parsed {
+			parsed = true
+			if json.Unmarshal(llmReq.Body, &requestData) != nil {
+				return targets, nil
+			}
+		}
+		if unsupported := checker.UnsupportedParameter(requestData); unsupported != "" {
+			param = unsupported
+			continue
+		}
+		kept = append(kept, target)
+	}
+	if len(kept) == 0 && param != "" {
+		return nil, &unsupportedParameterError{param: param}
+	}
+	return kept, nil
+}
+
+// writeUnsupportedParameterError answers like OpenAI does for a parameter
+// the model doesn't take
+func writeUnsupportedParameterError(w http.ResponseWriter, err *unsupportedParameterError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message": err.Error(),
+			"type":    "invalid_request_error",
+			"param":   err.param,
+			"code":    "unsupported_parameter",
+		},
+	})
+}
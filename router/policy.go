@@ -0,0 +1,310 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/strategy"
+	"github.com/sirupsen/logrus"
+)
+
+// policyVersion is the routing policy document format
+const policyVersion = 1
+
+// routingStrategies are the accepted values of routingStrategy
+var routingStrategies = map[string]bool{
+	"hybrid": true, "cost": true, "latency": true, "external_first": true, "cluster_first": true,
+	"weighted": true, "score": true, "extension": true, "bandit": true,
+}
+
+// RoutingPolicy is everything that decides where requests go, as one
+// document that can be moved between routers. Fields mirror their config
+// names; the router starts from config and imports replace it whole.
+type RoutingPolicy struct {
+	Version           int                     `json:"version"`
+	RoutingStrategy   string                  `json:"routingStrategy"`
+	Strategies        strategy.Config         `json:"strategies"`
+	Weights           map[string]float64      `json:"weights"` // cluster -> weighted routing share, clusters[].weight
+	ModelAliases      map[string]string       `json:"modelAliases"`
+	ModelMapping      map[string][]string     `json:"modelMapping"`
+	ModelSubstitution ModelSubstitutionConfig `json:"modelSubstitution"`
+	FallbackOrder     []string                `json:"fallbackOrder"`
+	MaxAttempts       int                     `json:"maxAttempts"`
+	Tenants           map[string]TenantPolicy `json:"tenants"`
+	Embeddings        EmbeddingsPoolConfig    `json:"embeddings"`
+}
+
+// TenantPolicy overrides router-wide routing behavior for one tenant
+type TenantPolicy struct {
+	StripReasoning *bool    `json:"stripReasoning,omitempty"` // reasoning.stripTenants (true) or keepTenants (false)
+	Substitution   *bool    `json:"substitution,omitempty"`   // false: modelSubstitution.disabledTenants
+	Targets        []string `json:"targets,omitempty"`        // tenantRouting.<tenant>.targets
+	ExcludeTargets []string `json:"excludeTargets,omitempty"` // tenantRouting.<tenant>.excludeTargets
+	External       string   `json:"external,omitempty"`       // tenantRouting.<tenant>.external
+}
+
+// policyStore holds the live routing policy. Strategies stay in the
+// strategy store, which the policy is imported into as well. Stored maps
+// and slices are never modified, only replaced.
+type policyStore struct {
+	mu     sync.RWMutex
+	policy RoutingPolicy
+}
+
+// newPolicyStore takes the routing policy from config
+func newPolicyStore(config *Config) *policyStore {
+	routerConfig := config.Router
+	policy := RoutingPolicy{
+		Version:           policyVersion,
+		RoutingStrategy:   routerConfig.RoutingStrategy,
+		Weights:           make(map[string]float64),
+		ModelAliases:      routerConfig.ModelAliases,
+		ModelMapping:      routerConfig.ModelMapping,
+		ModelSubstitution: routerConfig.ModelSubstitution,
+		FallbackOrder:     routerConfig.FallbackOrder,
+		MaxAttempts:       routerConfig.MaxAttempts,
+		Tenants:           make(map[string]TenantPolicy),
+		Embeddings:        routerConfig.Embeddings,
+	}
+	for _, cluster := range config.Clusters {
+		if cluster.Weight > 0 {
+			policy.Weights[cluster.Name] = cluster.Weight
+		}
+	}
+
+	yes, no := true, false
+	for _, tenant := range routerConfig.Reasoning.KeepTenants {
+		tenantPolicy := policy.Tenants[tenant]
+		tenantPolicy.StripReasoning = &no
+		policy.Tenants[tenant] = tenantPolicy
+	}
+	// Stripping wins, as in stripsReasoning
+	for _, tenant := range routerConfig.Reasoning.StripTenants {
+		tenantPolicy := policy.Tenants[tenant]
+		tenantPolicy.StripReasoning = &yes
+		policy.Tenants[tenant] = tenantPolicy
+	}
+	for _, tenant := range routerConfig.ModelSubstitution.DisabledTenants {
+		tenantPolicy := policy.Tenants[tenant]
+		tenantPolicy.Substitution = &no
+		policy.Tenants[tenant] = tenantPolicy
+	}
+	for tenant, routing := range routerConfig.TenantRouting {
+		tenantPolicy := policy.Tenants[tenant]
+		tenantPolicy.Targets = routing.Targets
+		tenantPolicy.ExcludeTargets = routing.ExcludeTargets
+		tenantPolicy.External = routing.External
+		policy.Tenants[tenant] = tenantPolicy
+	}
+	return &policyStore{policy: policy}
+}
+
+// get returns the live policy, without strategies
+func (p *policyStore) get() RoutingPolicy {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.policy
+}
+
+// setWeight sets a cluster's weight, removing it when not positive. Readers
+// share the weights map, so it is replaced rather than modified.
+func (p *policyStore) setWeight(cluster string, weight float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	weights := make(map[string]float64, len(p.policy.Weights)+1)
+	for name, w := range p.policy.Weights {
+		weights[name] = w
+	}
+	if weight > 0 {
+		weights[cluster] = weight
+	} else {
+		delete(weights, cluster)
+	}
+	p.policy.Weights = weights
+}
+
+// tenant returns the overrides for tenant, if any
+func (p *policyStore) tenant(tenant string) TenantPolicy {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.policy.Tenants[tenant]
+}
+
+// exportPolicy returns the complete live policy
+func (r *Router) exportPolicy() RoutingPolicy {
+	r.policy.mu.RLock()
+	defer r.policy.mu.RUnlock()
+	policy := r.policy.policy
+	policy.Strategies = r.strategies.Get()
+	return policy
+}
+
+// policyETag identifies a policy's content, for conditional imports
+func policyETag(policy RoutingPolicy) string {
+	data, _ := json.Marshal(policy)
+	sum := sha256.Sum256(data)
+	return `"` + hex.EncodeToString(sum[:12]) + `"`
+}
+
+// validatePolicy checks an imported policy against the configured targets
+func (r *Router) validatePolicy(policy *RoutingPolicy) error {
+	if policy.Version != policyVersion {
+		return fmt.Errorf("unsupported policy version %d, expected %d", policy.Version, policyVersion)
+	}
+	if !routingStrategies[policy.RoutingStrategy] {
+		return fmt.Errorf("unknown routingStrategy %q", policy.RoutingStrategy)
+	}
+	if err := policy.Strategies.Validate(); err != nil {
+		return fmt.Errorf("strategies: %w", err)
+	}
+	clusters := make(map[string]bool, len(r.clusterConfigs()))
+	for _, cluster := range r.clusterConfigs() {
+		clusters[cluster.Name] = true
+	}
+	for name, weight := range policy.Weights {
+		if !clusters[name] {
+			return fmt.Errorf("weights names %s, which is not a configured cluster", name)
+		}
+		if weight < 0 {
+			return fmt.Errorf("weights[%s] must not be negative", name)
+		}
+	}
+	for target := range policy.Strategies.Weighted.Percentages {
+		if !r.configuredTarget(target) {
+			return fmt.Errorf("strategies.weighted.percentages names %s, which is not a configured target", target)
+		}
+	}
+	for _, name := range policy.FallbackOrder {
+		if !r.configuredTarget(name) {
+			return fmt.Errorf("fallbackOrder names %s, which is not a configured target", name)
+		}
+	}
+	for model, alias := range policy.ModelAliases {
+		if model == "" || alias == "" {
+			return fmt.Errorf("modelAliases entries need a model and an alias")
+		}
+	}
+	if policy.MaxAttempts < 1 {
+		return fmt.Errorf("maxAttempts must be at least 1")
+	}
+	if err := validateTenantPolicies(policy.Tenants, r.configuredTarget); err != nil {
+		return err
+	}
+	if err := validateEmbeddingsPool(policy.Embeddings, r.configuredTarget); err != nil {
+		return err
+	}
+	if policy.Weights == nil {
+		policy.Weights = map[string]float64{}
+	}
+	if policy.Tenants == nil {
+		policy.Tenants = map[string]TenantPolicy{}
+	}
+	return nil
+}
+
+// importPolicy validates policy and makes it live, all or nothing. A
+// non-empty ifMatch must be the live policy's ETag.
+func (r *Router) importPolicy(policy RoutingPolicy, ifMatch string) error {
+	if err := r.validatePolicy(&policy); err != nil {
+		return err
+	}
+
+	r.policy.mu.Lock()
+	defer r.policy.mu.Unlock()
+	current := r.policy.policy
+	current.Strategies = r.strategies.Get()
+	if ifMatch != "" && ifMatch != policyETag(current) {
+		return errPolicyChanged
+	}
+	if err := r.strategies.Set(policy.Strategies); err != nil {
+		return err
+	}
+	policy.Strategies = strategy.Config{}
+	r.policy.policy = policy
+	return nil
+}
+
+// errPolicyChanged rejects an import made against a policy that has since
+// been replaced
+var errPolicyChanged = fmt.Errorf("the routing policy has changed since it was exported")
+
+// policyHandler exports the live routing policy
+func (r *Router) policyHandler(w http.ResponseWriter, req *http.Request) {
+	policy := r.exportPolicy()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", policyETag(policy))
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(policy)
+}
+
+// importPolicyHandler replaces the routing policy with the document in the
+// body. Unknown fields and invalid values reject it whole. With If-Match
+// the import only applies over the policy that ETag was exported from;
+// ?dry_run=true only validates. Imports last until restart.
+func (r *Router) importPolicyHandler(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeBodyError(w, err, "Failed to read request body")
+		return
+	}
+	var policy RoutingPolicy
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&policy); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid policy: %v", err), http.StatusBadRequest)
+		return
+	}
+
+	if req.URL.Query().Get("dry_run") == "true" {
+		if err := r.validatePolicy(&policy); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{"valid": true, "changes": policyChanges(r.exportPolicy(), policy)})
+		return
+	}
+
+	previous := r.exportPolicy()
+	if err := r.importPolicy(policy, req.Header.Get("If-Match")); err != nil {
+		code := http.StatusBadRequest
+		if err == errPolicyChanged {
+			code = http.StatusPreconditionFailed
+		}
+		http.Error(w, err.Error(), code)
+		return
+	}
+	changes := policyChanges(previous, policy)
+	logrus.Infof("Routing policy imported, changed: %v", changes)
+
+	imported := r.exportPolicy()
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("ETag", policyETag(imported))
+	json.NewEncoder(w).Encode(map[string]interface{}{"changes": changes, "policy": imported})
+}
+
+// policyChanges lists the top-level fields that differ between two policies
+func policyChanges(from, to RoutingPolicy) []string {
+	var before, after map[string]json.RawMessage
+	fromJSON, _ := json.Marshal(from)
+	toJSON, _ := json.Marshal(to)
+	json.Unmarshal(fromJSON, &before)
+	json.Unmarshal(toJSON, &after)
+
+	changes := []string{}
+	for field, value := range after {
+		if !bytes.Equal(before[field], value) {
+			changes = append(changes, field)
+		}
+	}
+	sort.Strings(changes)
+	return changes
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// drainState tracks in-flight work and readiness so a router being replaced
+// can stop taking traffic and finish what it has before it exits
+type drainState struct {
+	draining atomic.Bool
+	inFlight atomic.Int64
+
+	mu       sync.Mutex
+	flushers []stateFlusher
+}
+
+// stateFlusher persists a piece of in-memory state before shutdown
+type stateFlusher struct {
+	name  string
+	flush func() error
+}
+
+// begin marks a unit of work in flight; the returned func marks it done
+func (d *drainState) begin() func() {
+	d.inFlight.Add(1)
+	var once sync.Once
+	return func() {
+		once.Do(func() { d.inFlight.Add(-1) })
+	}
+}
+
+// onFlush registers state to persist when the router drains or shuts down
+func (d *drainState) onFlush(name string, flush func() error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.flushers = append(d.flushers, stateFlusher{name: name, flush: flush})
+}
+
+// flush runs every flusher, returning the names flushed and any failures
+func (d *drainState) flush() ([]string, map[string]string) {
+	d.mu.Lock()
+	flushers := append([]stateFlusher(nil), d.flushers...)
+	d.mu.Unlock()
+
+	flushed := []string{}
+	failures := map[string]string{}
+	for _, f := range flushers {
+		if err := f.flush(); err != nil {
+			logrus.Errorf("Failed to flush %s: %v", f.name, err)
+			failures[f.name] = err.Error()
+			continue
+		}
+		flushed = append(flushed, f.name)
+	}
+	return flushed, failures
+}
+
+// wait blocks until nothing is in flight or the deadline passes
+func (d *drainState) wait(deadline time.Time) bool {
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for d.inFlight.Load() > 0 {
+		if time.Now().After(deadline) {
+			return false
+		}
+		<-ticker.C
+	}
+	return true
+}
+
+// writeStateFile atomically replaces path under the state dir with v as JSON
+func writeStateFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("failed to create state dir: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// readStateFile loads JSON written by writeStateFile, treating a missing
+// file as empty state
+func readStateFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// readyHandler is the readiness probe: 503 once the router is draining
+func (r *Router) readyHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.drain.draining.Load() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "draining"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ready"})
+}
+
+// prestopHandler prepares the router for termination, for Kubernetes
+// preStop hooks (GET, as httpGet hooks send) or scripted deploys (POST). It
+// fails readiness, waits for in-flight requests, streams and async jobs up
+// to the deadline (?timeout=, default admin.prestopTimeout), flushes state
+// to the state dir and reports the outcome. Draining is not undone.
+func (r *Router) prestopHandler(w http.ResponseWriter, req *http.Request) {
+	timeout := r.config.Admin.PrestopTimeout
+	if raw := req.URL.Query().Get("timeout"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed < 0 {
+			http.Error(w, "Invalid timeout", http.StatusBadRequest)
+			return
+		}
+		timeout = parsed
+	}
+
+	if !r.drain.draining.Swap(true) {
+		logrus.Infof("Draining: readiness failed, waiting up to %v for %d in-flight requests", timeout, r.drain.inFlight.Load())
+	}
+
+	started := time.Now()
+	drained := r.drain.wait(started.Add(timeout))
+	flushed, failures := r.drain.flush()
+
+	status := "complete"
+	code := http.StatusOK
+	if !drained {
+		status = "deadline_exceeded"
+		code = http.StatusGatewayTimeout
+		logrus.Warnf("Drain deadline passed with %d requests in flight", r.drain.inFlight.Load())
+	} else if len(failures) > 0 {
+		status = "flush_failed"
+		code = http.StatusInternalServerError
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    status,
+		"in_flight": r.drain.inFlight.Load(),
+		"waited_ms": time.Since(started).Milliseconds(),
+		"flushed":   flushed,
+		"errors":    failures,
+	})
+}
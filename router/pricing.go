@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/providers"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// PricingConfig overrides or extends the built-in provider pricing tables,
+// so published price changes don't need a new build
+type PricingConfig struct {
+	Overrides      map[string]map[string]providers.PriceOverride `yaml:"overrides"`      // provider name -> model -> prices
+	File           string                                        `yaml:"file"`           // more overrides in the same shape, reloaded when the file changes
+	ReloadInterval time.Duration                                 `yaml:"reloadInterval"` // how often file is checked for changes, default 30s
+}
+
+// pricingWatcher tracks the pricing file so changes are picked up
+type pricingWatcher struct {
+	mu       sync.Mutex // serializes reloads
+	config   PricingConfig
+	loadedAt time.Time
+	modTime  time.Time
+}
+
+// load applies the configured overrides and the pricing file on top
+// of them. Overrides that don't say when they were checked count as checked
+// when written: the config when it was loaded, the file when it changed.
+func (p *pricingWatcher) load() error {
+	merged := make(map[string]map[string]providers.PriceOverride)
+	add := func(byProvider map[string]map[string]providers.PriceOverride, checked time.Time) error {
+		for provider, models := range byProvider {
+			if merged[provider] == nil {
+				merged[provider] = make(map[string]providers.PriceOverride)
+			}
+			for model, override := range models {
+				for _, price := range []*float64{override.InputPricePer1K, override.OutputPricePer1K, override.ReasoningPricePer1K, override.PricePerMinute} {
+					if price != nil && *price < 0 {
+						return fmt.Errorf("%s %s: prices must not be negative", provider, model)
+					}
+				}
+				if override.UpdatedAt.IsZero() {
+					override.UpdatedAt = checked
+				}
+				merged[provider][model] = override
+			}
+		}
+		return nil
+	}
+
+	if err := add(p.config.Overrides, p.loadedAt); err != nil {
+		return err
+	}
+	if p.config.File != "" {
+		info, err := os.Stat(p.config.File)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p.config.File)
+		if err != nil {
+			return err
+		}
+		var fromFile map[string]map[string]providers.PriceOverride
+		if err := yaml.Unmarshal(data, &fromFile); err != nil {
+			return fmt.Errorf("invalid pricing file %s: %w", p.config.File, err)
+		}
+		if err := add(fromFile, info.ModTime()); err != nil {
+			return fmt.Errorf("%s: %w", p.config.File, err)
+		}
+		p.modTime = info.ModTime()
+	}
+
+	providers.SetPricingOverrides(merged)
+	return nil
+}
+
+// warnUnknown flags overrides for providers that aren't registered, which
+// are otherwise silently unused
+func (p *pricingWatcher) warnUnknown(registered map[string]providers.Provider) {
+	for provider := range p.config.Overrides {
+		if _, ok := registered[provider]; !ok {
+			logrus.Warnf("pricing.overrides names unknown provider %s", provider)
+		}
+	}
+}
+
+// watch reloads the pricing file whenever its modification time changes
+func (p *pricingWatcher) watch(ctx context.Context, beat func()) {
+	ticker := time.NewTicker(p.config.ReloadInterval)
+	defer ticker.Stop()
+
+	beat()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			p.reload()
+			beat()
+		}
+	}
+}
+
+// reload reloads the pricing file if its modification time changed since
+// it was last loaded. A file that fails to load leaves the previous prices
+// in place.
+func (p *pricingWatcher) reload() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	info, err := os.Stat(p.config.File)
+	if err != nil || info.ModTime().Equal(p.modTime) {
+		return
+	}
+	if err := p.load(); err != nil {
+		logrus.Warnf("Failed to reload pricing, keeping previous prices: %v", err)
+		p.modTime = info.ModTime() // don't retry until it changes again
+	} else {
+		logrus.Infof("Reloaded pricing overrides from %s", p.config.File)
+	}
+}
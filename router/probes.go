@@ -0,0 +1,59 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/providers"
+)
+
+// ProviderProbeConfig configures synthetic completions sent to external
+// providers on the health check interval. Each probe is a billed request.
+type ProviderProbeConfig struct {
+	Enabled   bool   `yaml:"enabled"`
+	Prompt    string `yaml:"prompt"`    // default "ping"
+	MaxTokens int    `yaml:"maxTokens"` // default 1
+}
+
+// newProviderProbe returns a probe sending a tiny chat completion to the
+// provider's default model, or its cheapest priced one
+func newProviderProbe(provider providers.Provider, model string, config ProviderProbeConfig) func(context.Context) error {
+	if model == "" {
+		cheapest := -1.0
+		for name, pricing := range provider.GetModelPricing() {
+			price := pricing.InputPricePer1K + pricing.OutputPricePer1K
+			if pricing.PricePerMinute > 0 {
+				continue // audio models don't chat
+			}
+			if cheapest < 0 || price < cheapest {
+				model, cheapest = name, price
+			}
+		}
+	}
+
+	body, _ := json.Marshal(map[string]interface{}{
+		"model":      model,
+		"messages":   []map[string]string{{"role": "user", "content": config.Prompt}},
+		"max_tokens": config.MaxTokens,
+	})
+
+	return func(ctx context.Context) error {
+		req, err := http.NewRequestWithContext(ctx, "POST", "/v1/chat/completions", bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		buf := newResponseBuffer()
+		if err := provider.Forward(ctx, buf, req, "/v1/chat/completions"); err != nil {
+			return err
+		}
+		if status := buf.StatusCode(); status >= 400 {
+			return fmt.Errorf("probe returned status %d", status)
+		}
+		return nil
+	}
+}
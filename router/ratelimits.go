@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/providers"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/ratelimit"
+)
+
+// rateLimitError rejects a request every target for which is out of quota
+// for longer than router.rateLimitWait allows
+type rateLimitError struct {
+	wait time.Duration // until the soonest rate-limited target has quota again
+}
+
+func (e *rateLimitError) Error() string {
+	return fmt.Sprintf("provider rate limits reached, retry in %s", e.wait.Round(time.Second))
+}
+
+// newRateLimits builds the limiters of providers' rateLimit settings
+func newRateLimits(configs []providers.ProviderConfig) *ratelimit.Set {
+	limits := make(map[string]ratelimit.Limits)
+	for _, providerConfig := range configs {
+		limits[providerConfig.Name] = ratelimit.Limits{
+			RequestsPerMinute: providerConfig.RateLimit.RequestsPerMinute,
+			TokensPerMinute:   providerConfig.RateLimit.TokensPerMinute,
+			Burst:             providerConfig.RateLimit.BurstMultiplier,
+		}
+	}
+	return ratelimit.New(limits)
+}
+
+// rateLimitTokens is what a request reserves of a tokens-per-minute quota
+// before its usage is known: its prompt and the output it may produce
+func (r *Router) rateLimitTokens(llmReq *llmRequest) int {
+	outputTokens := llmReq.MaxTokens
+	if outputTokens == 0 {
+		outputTokens = r.config.Router.CostCeiling.DefaultMaxTokens
+	}
+	return llmReq.promptTokens() + outputTokens
+}
+
+// takeRateLimit reserves quota on a provider target. A provider out of
+// quota is remembered on the request, with how long until it has quota
+// again, so acquireTarget can wait for it if nothing else serves.
+func (r *Router) takeRateLimit(target *RouteTarget, llmReq *llmRequest) bool {
+	if target.Type != "provider" {
+		return true
+	}
+	wait, ok := r.rateLimits.Take(target.Name, r.rateLimitTokens(llmReq))
+	if ok {
+		return true
+	}
+	r.metrics.rateLimited.WithLabelValues(target.Name).Inc()
+	if llmReq.rateLimited == nil {
+		llmReq.rateLimited = make(map[string]bool)
+	}
+	llmReq.rateLimited[target.Name] = true
+	if llmReq.rateLimitWait == 0 || wait < llmReq.rateLimitWait {
+		llmReq.rateLimitWait = wait
+	}
+	return false
+}
+
+// waitForRateLimit sleeps until a rate-limited target has quota again and
+// makes those targets eligible once more. It fails when the wait would
+// take the request past router.rateLimitWait in total.
+func (r *Router) waitForRateLimit(ctx context.Context, llmReq *llmRequest, queued *time.Duration) error {
+	wait := llmReq.rateLimitWait
+	if *queued+wait > r.config.Router.RateLimitWait {
+		return &rateLimitError{wait: wait}
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+	}
+	*queued += wait
+	for name := range llmReq.rateLimited {
+		delete(llmReq.Exclude, name)
+	}
+	llmReq.rateLimited = nil
+	llmReq.rateLimitWait = 0
+	return nil
+}
+
+// writeRateLimitError answers 429 with when to retry
+func writeRateLimitError(w http.ResponseWriter, err *rateLimitError) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(err.wait.Seconds()))))
+	http.Error(w, err.Error(), http.StatusTooManyRequests)
+}
@@ -0,0 +1,218 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/providers"
+)
+
+// reasoningHeader lets a client prefer, avoid or require reasoning models
+const reasoningHeader = "X-LLM-Router-Reasoning"
+
+// ReasoningConfig covers models that think before they answer
+type ReasoningConfig struct {
+	Models       []string `yaml:"models"`       // model name prefixes to treat as reasoning models besides the known families
+	StripTraces  bool     `yaml:"stripTraces"`  // remove reasoning traces from responses unless the tenant keeps them
+	StripTenants []string `yaml:"stripTenants"` // tenants whose responses are always stripped
+	KeepTenants  []string `yaml:"keepTenants"`  // tenants that see traces even with stripTraces set
+}
+
+// reasoningPreference reads the request's reasoning preference from the
+// header, inferring "prefer" when the body asks for reasoning effort
+func reasoningPreference(req *http.Request, effort bool) string {
+	switch preference := strings.ToLower(req.Header.Get(reasoningHeader)); preference {
+	case "prefer", "avoid", "require":
+		return preference
+	}
+	if effort {
+		return "prefer"
+	}
+	return ""
+}
+
+// isReasoningModel reports whether model is a known or configured
+// reasoning model
+func (r *Router) isReasoningModel(model string) bool {
+	if providers.IsReasoningModel(model) {
+		return true
+	}
+	for _, prefix := range r.config.Router.Reasoning.Models {
+		if prefix != "" && strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// reasoningTarget reports whether target would answer model with a
+// reasoning model, by the model sent or the cluster's reasoning flag
+func (r *Router) reasoningTarget(target *RouteTarget, model string) bool {
+	if target.Model != "" {
+		model = target.Model
+	}
+	if target.Type == "cluster" {
+		for _, cluster := range r.clusterConfigs() {
+			if cluster.Name == target.Name && cluster.Reasoning {
+				return true
+			}
+		}
+	}
+	if defaulter, ok := target.Provider.(providers.DefaultModeler); ok && model == "" {
+		model = defaulter.DefaultModel()
+	}
+	return r.isReasoningModel(model)
+}
+
+// filterByReasoning applies the request's reasoning preference. Preferring
+// or avoiding reasoning models falls back to every target when none
+// matches; requiring them fails instead.
+func (r *Router) filterByReasoning(targets []*RouteTarget, llmReq *llmRequest) ([]*RouteTarget, error) {
+	if llmReq.Reasoning == "" {
+		return targets, nil
+	}
+	want := llmReq.Reasoning != "avoid"
+	matched := targets[:0:0]
+	for _, target := range targets {
+		if r.reasoningTarget(target, llmReq.Model) == want {
+			matched = append(matched, target)
+		}
+	}
+	if len(matched) > 0 {
+		return matched, nil
+	}
+	if llmReq.Reasoning == "require" {
+		return nil, fmt.Errorf("no healthy target serves a reasoning model")
+	}
+	return targets, nil
+}
+
+// stripsReasoning reports whether tenant's responses have their reasoning
+// traces removed
+func (r *Router) stripsReasoning(tenant string) bool {
+	if strip := r.policy.tenant(tenant).StripReasoning; strip != nil {
+		return *strip
+	}
+	return r.config.Router.Reasoning.StripTraces
+}
+
+// reasoningFields are where OpenAI-compatible backends put reasoning traces
+var reasoningFields = []string{"reasoning_content", "reasoning"}
+
+// reasoningStripper removes reasoning traces from a response. Whole bodies
+// are rewritten once complete; streams are rewritten per SSE line. Token
+// usage is left alone, so stripped reasoning is still accounted for.
+type reasoningStripper struct {
+	w      http.ResponseWriter
+	stream bool
+	buf    []byte
+}
+
+func newReasoningStripper(w http.ResponseWriter, stream bool) *reasoningStripper {
+	return &reasoningStripper{w: w, stream: stream}
+}
+
+func (s *reasoningStripper) Header() http.Header {
+	return s.w.Header()
+}
+
+func (s *reasoningStripper) WriteHeader(status int) {
+	// Some providers answer stream requests with a whole body
+	s.stream = s.stream && strings.HasPrefix(s.w.Header().Get("Content-Type"), "text/event-stream")
+	// Stripping changes the body length
+	s.w.Header().Del("Content-Length")
+	s.w.WriteHeader(status)
+}
+
+func (s *reasoningStripper) Write(p []byte) (int, error) {
+	s.buf = append(s.buf, p...)
+	if !s.stream {
+		return len(p), nil
+	}
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			break
+		}
+		s.w.Write(append(stripReasoningLine(s.buf[:i]), '\n'))
+		s.buf = s.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (s *reasoningStripper) Flush() {
+	if flusher, ok := s.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Close writes whatever is still buffered
+func (s *reasoningStripper) Close() {
+	if len(s.buf) == 0 {
+		return
+	}
+	if s.stream {
+		s.w.Write(stripReasoningLine(s.buf))
+	} else {
+		body, _ := stripReasoning(s.buf)
+		s.w.Write(body)
+	}
+	s.buf = nil
+}
+
+// stripReasoningLine strips an SSE data line, passing other lines through
+func stripReasoningLine(line []byte) []byte {
+	payload, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return line
+	}
+	payload = bytes.TrimSpace(payload)
+	stripped, ok := stripReasoning(payload)
+	if !ok {
+		return line
+	}
+	return append([]byte("data: "), stripped...)
+}
+
+// stripReasoning removes reasoning from each choice's message or delta,
+// reporting whether there was any to remove
+func stripReasoning(body []byte) ([]byte, bool) {
+	if !bytes.Contains(body, []byte(`"reasoning`)) {
+		return body, false
+	}
+	var response map[string]interface{}
+	if json.Unmarshal(body, &response) != nil {
+		return body, false
+	}
+	choices, _ := response["choices"].([]interface{})
+	removed := false
+	for _, item := range choices {
+		choice, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for _, key := range []string{"message", "delta"} {
+			field, ok := choice[key].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			for _, name := range reasoningFields {
+				if _, ok := field[name]; ok {
+					delete(field, name)
+					removed = true
+				}
+			}
+		}
+	}
+	if !removed {
+		return body, false
+	}
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		return body, false
+	}
+	return encoded, true
+}
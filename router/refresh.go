@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	defaultRoutingLockTTL = time.Hour
+	maxRoutingLockTTL     = 24 * time.Hour
+)
+
+// routingLock freezes the target set and costs seen at refresh time so a
+// batch job is not split across targets when prices move mid-job
+type routingLock struct {
+	ID        string
+	Tenant    string // the tenant that created it, the only one that can use or release it
+	Targets   []RouteTarget
+	ExpiresAt time.Time
+}
+
+// routingLocks holds active routing locks
+type routingLocks struct {
+	mu    sync.Mutex
+	locks map[string]*routingLock
+}
+
+func newRoutingLocks() *routingLocks {
+	return &routingLocks{locks: make(map[string]*routingLock)}
+}
+
+func (l *routingLocks) add(tenant string, targets []*RouteTarget, ttl time.Duration) *routingLock {
+	idBytes := make([]byte, 8)
+	rand.Read(idBytes)
+
+	lock := &routingLock{
+		ID:        "lock-" + hex.EncodeToString(idBytes),
+		Tenant:    tenant,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	for _, target := range targets {
+		lock.Targets = append(lock.Targets, *target)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expireLocked()
+	l.locks[lock.ID] = lock
+	return lock
+}
+
+// get returns the tenant's lock with the id. Other tenants' locks aren't
+// found.
+func (l *routingLocks) get(tenant, id string) (*routingLock, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.expireLocked()
+	lock, exists := l.locks[id]
+	if !exists || lock.Tenant != tenant {
+		return nil, false
+	}
+	return lock, true
+}
+
+func (l *routingLocks) remove(tenant, id string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	lock, exists := l.locks[id]
+	if !exists || lock.Tenant != tenant {
+		return false
+	}
+	delete(l.locks, id)
+	return true
+}
+
+func (l *routingLocks) expireLocked() {
+	now := time.Now()
+	for id, lock := range l.locks {
+		if now.After(lock.ExpiresAt) {
+			delete(l.locks, id)
+		}
+	}
+}
+
+// lockedTargets restricts live targets to a lock's snapshot, keeping the
+// frozen cost and latency figures. Targets that have since become unhealthy
+// are dropped; if none survive, the live targets are used instead. Locks
+// belong to the tenant that created them.
+func (r *Router) lockedTargets(llmReq *llmRequest, live []*RouteTarget) []*RouteTarget {
+	lockID := llmReq.LockID
+	lock, exists := r.routingLocks.get(llmReq.Tenant, lockID)
+	if !exists {
+		logrus.Warnf("Unknown or expired routing lock %s, using live targets", lockID)
+		return live
+	}
+
+	healthy := make(map[string]bool, len(live))
+	for _, target := range live {
+		healthy[target.Name] = true
+	}
+
+	var targets []*RouteTarget
+	for i := range lock.Targets {
+		if healthy[lock.Targets[i].Name] {
+			target := lock.Targets[i]
+			targets = append(targets, &target)
+		}
+	}
+
+	if len(targets) == 0 {
+		logrus.Warnf("No target in routing lock %s is healthy, using live targets", lockID)
+		return live
+	}
+	return targets
+}
+
+// refreshHandler synchronously refreshes cluster and provider health,
+// provider model lists, spot prices and the pricing file, optionally
+// returning a routing lock for the caller's batch job
+func (r *Router) refreshHandler(w http.ResponseWriter, req *http.Request) {
+	var refreshReq struct {
+		Lock bool   `json:"lock"`
+		TTL  string `json:"ttl"`
+	}
+	if req.ContentLength != 0 {
+		if err := json.NewDecoder(req.Body).Decode(&refreshReq); err != nil {
+			writeBodyError(w, err, "Invalid request")
+			return
+		}
+	}
+
+	ttl := defaultRoutingLockTTL
+	if refreshReq.TTL != "" {
+		parsed, err := time.ParseDuration(refreshReq.TTL)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid ttl", http.StatusBadRequest)
+			return
+		}
+		ttl = parsed
+	}
+	if ttl > maxRoutingLockTTL {
+		ttl = maxRoutingLockTTL
+	}
+
+	ctx := req.Context()
+
+	// Refresh clusters, providers and prices concurrently
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		r.healthChecker.CheckNow(ctx)
+	}()
+	if r.spotPrices != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r.spotPrices.Refresh(ctx)
+		}()
+	}
+	for _, provider := range r.providerManager.GetAllProviders() {
+		wg.Add(1)
+		go func(p providers.Provider) {
+			defer wg.Done()
+			if lister, ok := p.(providers.ModelLister); ok {
+				lister.ListModels(ctx)
+			}
+		}(provider)
+	}
+	wg.Wait()
+	r.pricing.reload()
+
+	r.refreshMetrics()
+	targets := r.getAllTargets(ctx)
+
+	type targetInfo struct {
+		Name       string  `json:"name"`
+		Type       string  `json:"type"`
+		Cost       float64 `json:"cost_per_1k_tokens"`
+		LatencyP95 float64 `json:"latency_p95_ms"`
+		LatencyAvg float64 `json:"latency_ewma_ms,omitempty"`
+		QueueDepth int     `json:"queue_depth"`
+	}
+	infos := make([]targetInfo, 0, len(targets))
+	for _, target := range targets {
+		infos = append(infos, targetInfo{
+			Name:       target.Name,
+			Type:       target.Type,
+			Cost:       target.Cost,
+			LatencyP95: target.LatencyP95,
+			LatencyAvg: target.LatencyEWMA,
+			QueueDepth: target.QueueDepth,
+		})
+	}
+
+	response := map[string]interface{}{
+		"refreshed_at": time.Now().Format(time.RFC3339),
+		"targets":      infos,
+	}
+
+	if refreshReq.Lock {
+		lock := r.routingLocks.add(requestTenant(req), targets, ttl)
+		response["lock"] = map[string]interface{}{
+			"id":         lock.ID,
+			"header":     routingLockHeader,
+			"expires_at": lock.ExpiresAt.Format(time.RFC3339),
+		}
+		logrus.Infof("Created routing lock %s over %d targets (ttl %s)", lock.ID, len(targets), ttl)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// releaseLockHandler deletes one of the caller's routing locks before it
+// expires
+func (r *Router) releaseLockHandler(w http.ResponseWriter, req *http.Request) {
+	id := mux.Vars(req)["id"]
+	if !r.routingLocks.remove(requestTenant(req), id) {
+		http.Error(w, "Routing lock not found", http.StatusNotFound)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
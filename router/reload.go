@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/providers"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/strategy"
+	"github.com/sirupsen/logrus"
+)
+
+// ConfigReloadConfig controls re-reading the config file while running.
+// SIGHUP always reloads it.
+type ConfigReloadConfig struct {
+	Watch    bool          `yaml:"watch"`    // also reload when the file's modification time changes
+	Interval time.Duration `yaml:"interval"` // how often the file is checked, default 30s
+}
+
+// routingLimits holds the latency and queue depth targets are held to,
+// which a reload can change
+type routingLimits struct {
+	mu            sync.RWMutex
+	maxLatencyMs  int
+	maxQueueDepth int
+}
+
+func newRoutingLimits(config RouterConfig) *routingLimits {
+	return &routingLimits{maxLatencyMs: config.MaxLatencyMs, maxQueueDepth: config.MaxQueueDepth}
+}
+
+func (l *routingLimits) get() (maxLatencyMs, maxQueueDepth int) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.maxLatencyMs, l.maxQueueDepth
+}
+
+func (l *routingLimits) set(maxLatencyMs, maxQueueDepth int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.maxLatencyMs, l.maxQueueDepth = maxLatencyMs, maxQueueDepth
+}
+
+// watchConfig reloads the config file on SIGHUP and, with watch set,
+// whenever its modification time changes
+func (r *Router) watchConfig(ctx context.Context, beat func()) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+	ticker := time.NewTicker(r.config.Admin.ConfigReload.Interval)
+	defer ticker.Stop()
+
+	modTime := r.configModTime()
+	beat()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			logrus.Infof("Received SIGHUP, reloading %s", r.configFile)
+			r.reloadLogged()
+			modTime = r.configModTime()
+		case <-ticker.C:
+			if current := r.configModTime(); r.config.Admin.ConfigReload.Watch && !current.Equal(modTime) {
+				logrus.Infof("%s changed, reloading it", r.configFile)
+				r.reloadLogged()
+				modTime = current // don't retry a failed reload until it changes again
+			}
+		}
+		beat()
+	}
+}
+
+func (r *Router) configModTime() time.Time {
+	info, err := os.Stat(r.configFile)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func (r *Router) reloadLogged() {
+	if err := r.reloadConfig(); err != nil {
+		logrus.Errorf("Config reload incomplete: %v", err)
+	}
+}
+
+// reloadConfig re-reads the config file and applies what changed since it
+// was last loaded: targets added, removed or changed, thresholds and the
+// routing policy. Requests in flight keep the targets they were routed
+// to. A change that fails to apply keeps the previous setting without
+// holding up the others. Other settings need a restart and are only
+// logged. A file startup would reject, by router.lint.strict too, is not
+// applied at all.
+func (r *Router) reloadConfig() error {
+	r.reloadMu.Lock()
+	defer r.reloadMu.Unlock()
+
+	next, err := loadConfig(r.configFile)
+	if err != nil {
+		return err
+	}
+	if err := checkConfig(next); err != nil {
+		return fmt.Errorf("keeping the running config: %w", err)
+	}
+	previous := r.fileConfig
+
+	var failed []error
+	fail := func(format string, args ...interface{}) {
+		err := fmt.Errorf(format, args...)
+		logrus.Warnf("Config reload: %v", err)
+		failed = append(failed, err)
+	}
+	r.reloadClusters(previous.Clusters, next.Clusters, fail)
+	r.reloadProviders(previous.ExternalProviders, next.ExternalProviders, fail)
+
+	if next.Router.MaxLatencyMs != previous.Router.MaxLatencyMs || next.Router.MaxQueueDepth != previous.Router.MaxQueueDepth {
+		r.limits.set(next.Router.MaxLatencyMs, next.Router.MaxQueueDepth)
+		logrus.Infof("Config reload: maxLatencyMs %d, maxQueueDepth %d", next.Router.MaxLatencyMs, next.Router.MaxQueueDepth)
+	}
+	if next.Router.MaxConsecutiveErrors != previous.Router.MaxConsecutiveErrors || next.Router.RecoveryThreshold != previous.Router.RecoveryThreshold {
+		r.healthChecker.SetThresholds(next.Router.MaxConsecutiveErrors, next.Router.RecoveryThreshold)
+		logrus.Infof("Config reload: maxConsecutiveErrors %d, recoveryThreshold %d", next.Router.MaxConsecutiveErrors, next.Router.RecoveryThreshold)
+	}
+
+	// The policy is only replaced when the file's changed, so an import
+	// through PUT /admin/policy outlasts unrelated edits
+	previousPolicy, nextPolicy := filePolicy(previous), filePolicy(next)
+	if policyETag(previousPolicy) != policyETag(nextPolicy) {
+		if err := r.importPolicy(nextPolicy, ""); err != nil {
+			fail("routing policy: %v", err)
+		} else {
+			logrus.Infof("Config reload: applied routing policy (strategy %s)", nextPolicy.RoutingStrategy)
+		}
+	}
+
+	if !reflect.DeepEqual(withoutReloadable(previous), withoutReloadable(next)) {
+		logrus.Warnf("Config reload: settings other than targets, thresholds and the routing policy changed and need a restart")
+	}
+
+	r.fileConfig = next
+	if len(failed) > 0 {
+		return fmt.Errorf("%d changes not applied, first: %w", len(failed), failed[0])
+	}
+	return nil
+}
+
+// reloadClusters applies the difference between two config files'
+// clusters. A cluster that failed to register is tried again.
+func (r *Router) reloadClusters(previous, next []ClusterConfig, fail func(string, ...interface{})) {
+	before := make(map[string]ClusterConfig, len(previous))
+	for _, cluster := range previous {
+		before[cluster.Name] = cluster
+	}
+	after := make(map[string]bool, len(next))
+	for _, cluster := range next {
+		after[cluster.Name] = true
+		old, existed := before[cluster.Name]
+		_, live := r.healthChecker.GetClusterMetrics(cluster.Name)
+		switch {
+		case existed && live && reflect.DeepEqual(old, cluster):
+		case live:
+			if err := r.replaceCluster(cluster); err != nil {
+				fail("cluster %s: %v", cluster.Name, err)
+				continue
+			}
+			logrus.Infof("Config reload: updated cluster %s", cluster.Name)
+		default:
+			if cluster.SpotPrice != nil {
+				logrus.Warnf("Config reload: cluster %s is costed at costPerHour until restart; spotPrice is only read at startup", cluster.Name)
+			}
+			if err := r.addCluster(cluster); err != nil {
+				fail("cluster %s: %v", cluster.Name, err)
+				continue
+			}
+			logrus.Infof("Config reload: added cluster %s", cluster.Name)
+		}
+	}
+	for name := range before {
+		if !after[name] && r.removeCluster(name) {
+			logrus.Infof("Config reload: removed cluster %s", name)
+		}
+	}
+}
+
+// reloadProviders applies the difference between two config files'
+// providers. Changed providers, and those that failed to register, are
+// registered afresh.
+func (r *Router) reloadProviders(previous, next []providers.ProviderConfig, fail func(string, ...interface{})) {
+	before := make(map[string]providers.ProviderConfig, len(previous))
+	for _, providerConfig := range previous {
+		before[providerConfig.Name] = providerConfig
+	}
+	after := make(map[string]bool, len(next))
+	for _, providerConfig := range next {
+		after[providerConfig.Name] = true
+		old, existed := before[providerConfig.Name]
+		_, live := r.providerManager.GetProvider(providerConfig.Name)
+		if existed && reflect.DeepEqual(old, providerConfig) && live == providerConfig.Enabled {
+			continue
+		}
+		r.removeProvider(providerConfig.Name)
+		r.dropProviderConfig(providerConfig.Name)
+		if !providerConfig.Enabled {
+			// Listed like the config file's disabled providers
+			r.targets.mu.Lock()
+			r.targets.providers = append(r.targets.providers[:len(r.targets.providers):len(r.targets.providers)], providerConfig)
+			r.targets.mu.Unlock()
+			if live {
+				logrus.Infof("Config reload: disabled provider %s", providerConfig.Name)
+			}
+			continue
+		}
+		if err := r.addProvider(providerConfig); err != nil {
+			fail("provider %s: %v", providerConfig.Name, err)
+			continue
+		}
+		logrus.Infof("Config reload: registered provider %s (%s)", providerConfig.Name, providerConfig.Type)
+	}
+	for name := range before {
+		if !after[name] {
+			r.removeProvider(name)
+			r.dropProviderConfig(name)
+			logrus.Infof("Config reload: removed provider %s", name)
+		}
+	}
+}
+
+// dropProviderConfig removes a provider that isn't registered, such as a
+// disabled one, from the configured providers
+func (r *Router) dropProviderConfig(name string) {
+	r.targets.mu.Lock()
+	defer r.targets.mu.Unlock()
+	kept := make([]providers.ProviderConfig, 0, len(r.targets.providers))
+	for _, providerConfig := range r.targets.providers {
+		if providerConfig.Name != name {
+			kept = append(kept, providerConfig)
+		}
+	}
+	r.targets.providers = kept
+}
+
+// filePolicy is the routing policy a config file sets
+func filePolicy(config *Config) RoutingPolicy {
+	policy := newPolicyStore(config).get()
+	policy.Strategies = config.Router.Strategies
+	return policy
+}
+
+// withoutReloadable blanks the settings reloadConfig applies, leaving
+// those that need a restart
+func withoutReloadable(config *Config) Config {
+	rest := *config
+	rest.Clusters = nil
+	rest.ExternalProviders = nil
+	rest.Router.MaxLatencyMs = 0
+	rest.Router.MaxQueueDepth = 0
+	rest.Router.MaxConsecutiveErrors = 0
+	rest.Router.RecoveryThreshold = 0
+	rest.Router.RoutingStrategy = ""
+	rest.Router.Strategies = strategy.Config{}
+	rest.Router.ClusterCostThreshold = 0
+	rest.Router.ModelAliases = nil
+	rest.Router.ModelMapping = nil
+	rest.Router.ModelSubstitution = ModelSubstitutionConfig{}
+	rest.Router.FallbackOrder = nil
+	rest.Router.MaxAttempts = 0
+	rest.Router.Reasoning.KeepTenants = nil
+	rest.Router.Reasoning.StripTenants = nil
+	rest.Router.TenantRouting = nil
+	rest.Router.Embeddings = EmbeddingsPoolConfig{}
+	rest.secretReferences = 0
+	return rest
+}
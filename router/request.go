@@ -0,0 +1,297 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/auth"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/tokenizer"
+)
+
+// routingLockHeader pins a request to a routing lock created by /v1/router/refresh
+const routingLockHeader = "X-Routing-Lock"
+
+// llmRequest carries what routing needs to know about an incoming request.
+// The body is parsed once here rather than by every routing stage.
+type llmRequest struct {
+	Endpoint  string
+	Body      []byte
+	Model     string // model used for routing after global aliases, empty if unspecified
+	Stream    bool
+	User      string  // OpenAI `user` field, used for affinity
+	MaxCost   float64 // per-request cost ceiling in USD, 0 if none
+	MaxTokens int     // requested max_tokens, 0 if unset
+	Choices   int     // completions asked for with `n`, at least 1
+	LockID    string
+	Client    string           // stickiness key, see clientKey
+	Exclude   map[string]bool  // targets already tried for this request
+	Tenant    string           // authenticated tenant, empty for anonymous callers
+	Tools     bool             // the request declares tools
+	Dims      int              // embedding `dimensions` requested, 0 if unset
+	Demo      bool             // sent with a demo session, confined to demo.sandbox
+	Reasoning string           // "prefer", "avoid" or "require" reasoning models, empty if indifferent
+	Images    bool             // chat messages carry image_url parts
+	Batch     bool             // sent by a batch, see runBatch
+	Audio     *audioRequest    // set for /v1/audio endpoints
+	Messages  *messagesRequest // set for Anthropic Messages API requests
+
+	RequestedModel string // model named in the request body
+
+	prompt        *promptCount    // memoized prompt token count, see promptTokens
+	rateLimited   map[string]bool // providers excluded for being out of quota, see takeRateLimit
+	rateLimitWait time.Duration   // until the soonest of them has quota again
+	trace         *routeTrace     // set when the request is only explained, see explainHandler
+}
+
+// promptCount caches a body's token count; several routing stages need it
+// and tokenizing is not free
+type promptCount struct {
+	mu      sync.Mutex
+	counted bool
+	body    []byte
+	model   string
+	tokens  int
+}
+
+// promptTokens returns the tokens of the request's prompt, counted again
+// only once the body or model has changed
+func (l *llmRequest) promptTokens() int {
+	if l.Audio != nil && l.Audio.Boundary != "" {
+		return 0 // an upload, not text
+	}
+	if l.prompt == nil {
+		return tokenizer.CountRequest(l.Model, l.Body)
+	}
+	c := l.prompt
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	same := c.counted && c.model == l.Model && len(c.body) == len(l.Body) &&
+		(len(l.Body) == 0 || &c.body[0] == &l.Body[0])
+	if !same {
+		c.tokens = tokenizer.CountRequest(l.Model, l.Body)
+		c.counted, c.body, c.model = true, l.Body, l.Model
+	}
+	return c.tokens
+}
+
+// parseLLMRequest extracts routing inputs from a buffered request body.
+// Bodies that aren't JSON are still routable, just without model awareness.
+func parseLLMRequest(req *http.Request, endpoint string, body []byte) *llmRequest {
+	llmReq := &llmRequest{
+		Endpoint: endpoint,
+		Body:     body,
+		LockID:   req.Header.Get(routingLockHeader),
+		Client:   clientKey(req),
+		Exclude:  make(map[string]bool),
+		prompt:   &promptCount{},
+	}
+	if id := auth.FromContext(req.Context()); id != nil {
+		llmReq.Tenant = id.Tenant
+		llmReq.Demo = id.Method == "demo"
+	}
+	llmReq.Batch = isBatchRequest(req.Context())
+	if native, ok := req.Context().Value(messagesBodyKey{}).([]byte); ok {
+		llmReq.Messages = &messagesRequest{body: native, converted: body}
+	}
+
+	var fields struct {
+		Model               string            `json:"model"`
+		Stream              bool              `json:"stream"`
+		User                string            `json:"user"`
+		MaxTokens           int               `json:"max_tokens"`
+		MaxCompletionTokens int               `json:"max_completion_tokens"`
+		Tools               []json.RawMessage `json:"tools"`
+		Dims                int               `json:"dimensions"`
+		Effort              string            `json:"reasoning_effort"`
+		N                   int               `json:"n"`
+		Thinking            *struct {
+			Type string `json:"type"`
+		} `json:"thinking"`
+		Messages []struct {
+			Content json.RawMessage `json:"content"`
+		} `json:"messages"`
+	}
+	effort := false
+	if err := json.Unmarshal(body, &fields); err == nil {
+		llmReq.Model = fields.Model
+		llmReq.RequestedModel = fields.Model
+		llmReq.Stream = fields.Stream
+		llmReq.User = fields.User
+		llmReq.MaxTokens = fields.MaxTokens
+		if fields.MaxCompletionTokens > 0 {
+			llmReq.MaxTokens = fields.MaxCompletionTokens // max_tokens' replacement
+		}
+		llmReq.Tools = len(fields.Tools) > 0
+		llmReq.Choices = fields.N
+		llmReq.Dims = fields.Dims
+		llmReq.Images = hasImages(fields.Messages)
+		effort = fields.Effort != "" || (fields.Thinking != nil && fields.Thinking.Type != "disabled")
+	}
+	if llmReq.Choices < 1 {
+		llmReq.Choices = 1
+	}
+	llmReq.Reasoning = reasoningPreference(req, effort)
+	if audioEndpoints[endpoint] {
+		parseAudioRequest(req, llmReq)
+	}
+
+	return llmReq
+}
+
+// applyModelAliases resolves the router-wide alias for the requested model
+func (r *Router) applyModelAliases(llmReq *llmRequest) {
+	if alias, ok := r.policy.get().ModelAliases[llmReq.Model]; ok {
+		llmReq.Model = alias
+	}
+}
+
+// bodyForTarget returns the request body to send to target, rewriting the
+// model when aliasing or routing mapped the request onto a different one
+func (lr *llmRequest) bodyForTarget(target *RouteTarget) []byte {
+	model := target.Model
+	if model == "" {
+		model = lr.Model
+	}
+	if model == "" || model == lr.RequestedModel {
+		return lr.Body
+	}
+	if lr.Audio != nil && lr.Audio.Boundary != "" {
+		rewritten, err := rewriteFormModel(lr.Body, lr.Audio.Boundary, model)
+		if err != nil {
+			return lr.Body
+		}
+		return rewritten
+	}
+
+	return withModel(lr.Body, model)
+}
+
+// withModel returns a JSON request body with model in place of the one it
+// names, or body itself if it isn't JSON
+func withModel(body []byte, model string) []byte {
+	var requestData map[string]interface{}
+	if err := json.Unmarshal(body, &requestData); err != nil {
+		return body
+	}
+	requestData["model"] = model
+
+	rewritten, err := json.Marshal(requestData)
+	if err != nil {
+		return body
+	}
+	return rewritten
+}
+
+// serves reports whether target can serve model and the model name it must
+// be sent as. A per-target alias counts as serving. Clusters whose inventory
+// couldn't be listed are assumed to serve anything, as before model-aware routing.
+func (t *RouteTarget) serves(model string) (string, bool) {
+	if alias, ok := t.Aliases[model]; ok {
+		return alias, true
+	}
+	if t.Type == "cluster" && t.Models == nil {
+		return model, true
+	}
+	for _, m := range t.Models {
+		if m == model {
+			return model, true
+		}
+	}
+	return "", false
+}
+
+// filterByModel keeps only targets serving the requested model, trying the
+// configured model mapping, then the model's quality tier, in order when no
+// target serves it directly. Matching targets are annotated with the model
+// they will be sent and, if it isn't the requested one, the substitute.
+func (r *Router) filterByModel(targets []*RouteTarget, model string) ([]*RouteTarget, bool) {
+	if model == "" {
+		return targets, true
+	}
+
+	for _, candidate := range r.modelCandidates(model) {
+		var matched []*RouteTarget
+		for _, target := range targets {
+			if sendAs, ok := target.serves(candidate); ok {
+				target.Model = sendAs
+				target.Substitute = ""
+				if candidate != model {
+					target.Substitute = candidate
+				}
+				matched = append(matched, target)
+			}
+		}
+		if len(matched) > 0 {
+			return matched, true
+		}
+	}
+
+	return nil, false
+}
+
+// ModelSubstitutionConfig groups interchangeable models into quality tiers,
+// listed best first, for when a requested model is served nowhere
+type ModelSubstitutionConfig struct {
+	Tiers           []ModelTier `yaml:"tiers" json:"tiers"`
+	AllowDowngrade  bool        `yaml:"allowDowngrade" json:"allowDowngrade"` // fall through to lower tiers after the model's own
+	DisabledTenants []string    `yaml:"disabledTenants" json:"-"`             // tenants rejected rather than served a substitute
+}
+
+// ModelTier is a set of models of equivalent quality, in preference order
+type ModelTier struct {
+	Name   string   `yaml:"name" json:"name"`
+	Models []string `yaml:"models" json:"models"`
+}
+
+// substitutedHeader names the model served in place of the requested one
+const substitutedHeader = "X-Model-Substituted"
+
+// errModelUnavailable rejects requests whose model is only servable by
+// substitution when the tenant disallows it
+var errModelUnavailable = errors.New("model unavailable")
+
+// modelCandidates lists the requested model, its explicit mapping, then its
+// tier peers and, if allowed, lower tiers, without repeats
+func (r *Router) modelCandidates(model string) []string {
+	candidates := []string{model}
+	seen := map[string]bool{model: true}
+	add := func(models []string) {
+		for _, m := range models {
+			if !seen[m] {
+				seen[m] = true
+				candidates = append(candidates, m)
+			}
+		}
+	}
+	policy := r.policy.get()
+	add(policy.ModelMapping[model])
+
+	tiers := policy.ModelSubstitution.Tiers
+	for i, tier := range tiers {
+		for _, m := range tier.Models {
+			if m != model {
+				continue
+			}
+			add(tier.Models)
+			if policy.ModelSubstitution.AllowDowngrade {
+				for _, lower := range tiers[i+1:] {
+					add(lower.Models)
+				}
+			}
+			return candidates
+		}
+	}
+	return candidates
+}
+
+// substitutionAllowed reports whether the caller may be served a substitute
+func (r *Router) substitutionAllowed(llmReq *llmRequest) bool {
+	if allowed := r.policy.tenant(llmReq.Tenant).Substitution; allowed != nil {
+		return *allowed
+	}
+	return true
+}
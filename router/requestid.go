@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/auth"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// Request IDs correlate a client's request with the router's logs, metric
+// exemplars and the upstream that served it. An upstream's own request ID
+// is passed back alongside the router's.
+const (
+	requestIDHeader         = "X-Request-ID"
+	upstreamRequestIDHeader = "X-Upstream-Request-ID"
+	maxRequestIDLength      = 128
+)
+
+type requestIDKey struct{}
+
+// withRequestID returns ctx carrying id
+func withRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// requestIDFrom returns the request ID ctx carries, if any
+func requestIDFrom(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// validRequestID accepts the printable ASCII IDs clients send, which are
+// then safe to log and forward as they are
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	idBytes := make([]byte, 16)
+	rand.Read(idBytes)
+	return hex.EncodeToString(idBytes)
+}
+
+// assignRequestIDs gives every request an ID, honoring a valid incoming
+// X-Request-ID. The ID is set on the request, so targets that are passed
+// the client's headers receive it, carried in the context and returned to
+// the client.
+func assignRequestIDs(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = newRequestID()
+		}
+		req.Header.Set(requestIDHeader, id)
+		w.Header().Set(requestIDHeader, id)
+		next.ServeHTTP(&requestIDWriter{ResponseWriter: w, id: id}, req.WithContext(withRequestID(req.Context(), id)))
+	})
+}
+
+// requestIDWriter keeps the router's request ID in the response when an
+// upstream's response headers, copied through, carry one of their own
+type requestIDWriter struct {
+	http.ResponseWriter
+	id          string
+	wroteHeader bool
+}
+
+func (rw *requestIDWriter) WriteHeader(status int) {
+	if !rw.wroteHeader {
+		rw.wroteHeader = true
+		header := rw.Header()
+		for _, value := range header.Values(requestIDHeader) {
+			if value != rw.id {
+				header.Add(upstreamRequestIDHeader, value)
+			}
+		}
+		header.Set(requestIDHeader, rw.id)
+	}
+	rw.ResponseWriter.WriteHeader(status)
+}
+
+func (rw *requestIDWriter) Write(p []byte) (int, error) {
+	if !rw.wroteHeader {
+		rw.WriteHeader(http.StatusOK)
+	}
+	return rw.ResponseWriter.Write(p)
+}
+
+func (rw *requestIDWriter) Flush() {
+	if flusher, ok := rw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (rw *requestIDWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// requestIDHook adds the request ID, and the caller's tenant once
+// authenticated, to entries logged with a request's context, as with
+// logrus.WithContext(ctx)
+type requestIDHook struct{}
+
+func (requestIDHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (requestIDHook) Fire(entry *logrus.Entry) error {
+	if id := requestIDFrom(entry.Context); id != "" {
+		entry.Data["request_id"] = id
+	}
+	if entry.Context != nil {
+		if id := auth.FromContext(entry.Context); id != nil {
+			entry.Data["tenant"] = id.Tenant
+		}
+	}
+	return nil
+}
+
+// observeRequest records v, exemplified by the request's ID
+func observeRequest(ctx context.Context, observer prometheus.Observer, v float64) {
+	if exemplar, ok := observer.(prometheus.ExemplarObserver); ok {
+		if id := requestIDFrom(ctx); id != "" {
+			exemplar.ObserveWithExemplar(v, prometheus.Labels{"request_id": id})
+			return
+		}
+	}
+	observer.Observe(v)
+}
+
+// countRequest increments counter, exemplified by the request's ID
+func countRequest(ctx context.Context, counter prometheus.Counter) {
+	if exemplar, ok := counter.(prometheus.ExemplarAdder); ok {
+		if id := requestIDFrom(ctx); id != "" {
+			exemplar.AddWithExemplar(1, prometheus.Labels{"request_id": id})
+			return
+		}
+	}
+	counter.Inc()
+}
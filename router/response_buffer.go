@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+)
+
+// responseBuffer captures an upstream response so it can be inspected before
+// anything reaches the client
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: make(http.Header)}
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// StatusCode returns the captured status, or 0 if nothing was written
+func (b *responseBuffer) StatusCode() int {
+	return b.status
+}
+
+// Bytes returns the captured response body
+func (b *responseBuffer) Bytes() []byte {
+	return b.body.Bytes()
+}
+
+// SetBody replaces the captured response body
+func (b *responseBuffer) SetBody(body []byte) {
+	b.body.Reset()
+	b.body.Write(body)
+}
+
+// writeTo replays the captured response onto w
+func (b *responseBuffer) writeTo(w http.ResponseWriter) error {
+	for name, values := range b.header {
+		for _, value := range values {
+			w.Header().Add(name, value)
+		}
+	}
+	// The body may have been rewritten, let net/http compute the length
+	w.Header().Del("Content-Length")
+
+	status := b.status
+	if status == 0 {
+		status = http.StatusBadGateway
+	}
+	w.WriteHeader(status)
+
+	_, err := w.Write(b.body.Bytes())
+	return err
+}
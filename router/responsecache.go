@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/respcache"
+	"github.com/sirupsen/logrus"
+)
+
+// cacheHeader tells callers whether their response came from a response
+// cache: "hit", "semantic_hit", "miss" or "bypass"
+const cacheHeader = "X-LLM-Router-Cache"
+
+// cacheIgnoredFields don't change what a model answers, so requests
+// differing only in them share an entry
+var cacheIgnoredFields = []string{"user"}
+
+// cacheKey returns the response cache key of llmReq, or false when it
+// can't be cached: streams, async requests and bodies that aren't JSON
+func (r *Router) cacheKey(req *http.Request, llmReq *llmRequest) (string, bool) {
+	if r.responseCache == nil || llmReq.Stream || req.Header.Get(callbackHeader) != "" {
+		return "", false
+	}
+	body, scope := llmReq.cacheRequest(r.responseCache.Shared())
+	return respcache.Key(body, cacheIgnoredFields, scope...)
+}
+
+// cacheRequest returns the body llmReq is cached by and the scope it is
+// cached in: the endpoint, the tenant unless the cache is shared, and
+// whether it is demo traffic, whose sandboxed answers aren't for anyone
+// else. Messages API requests are cached by their own body, which says
+// more than its conversion, and apart from chat completions: Claude
+// answers them in the Messages API's format.
+func (lr *llmRequest) cacheRequest(shared bool) ([]byte, []string) {
+	body, endpoint := lr.Body, lr.Endpoint
+	if lr.Messages != nil {
+		body, endpoint = lr.Messages.body, "/anthropic/v1/messages"
+	}
+	tenant := lr.Tenant
+	if shared {
+		tenant = ""
+	}
+	traffic := "live"
+	if lr.Demo {
+		traffic = "demo"
+	}
+	return body, []string{endpoint, tenant, traffic}
+}
+
+// cacheControl reads the request's Cache-Control: no-cache skips the
+// lookup, no-store also leaves the fresh response uncached
+func cacheControl(req *http.Request) (lookup, store bool) {
+	lookup, store = true, true
+	for _, directive := range strings.Split(req.Header.Get("Cache-Control"), ",") {
+		switch strings.ToLower(strings.TrimSpace(directive)) {
+		case "no-cache":
+			lookup = false
+		case "no-store":
+			lookup, store = false, false
+		}
+	}
+	return lookup, store
+}
+
+// serveCached answers llmReq from the response cache when it can. Otherwise
+// serve answers it, through a writer that stores a successful response.
+func (r *Router) serveCached(w http.ResponseWriter, req *http.Request, llmReq *llmRequest, serve func(http.ResponseWriter)) {
+	key, ok := r.cacheKey(req, llmReq)
+	if !ok {
+		serve(w)
+		return
+	}
+	lookup, store := cacheControl(req)
+	if lookup {
+		if cached, hit := r.responseCache.Get(key); hit {
+			r.metrics.responseCache.WithLabelValues("hit").Inc()
+			r.writeCached(w, req, llmReq, cached, "hit", "cache_hit")
+			return
+		}
+	}
+
+	result := "miss"
+	if !lookup {
+		result = "bypass"
+	}
+	r.metrics.responseCache.WithLabelValues(result).Inc()
+	w.Header().Set(cacheHeader, result)
+	if !store {
+		serve(w)
+		return
+	}
+
+	cw := &cacheWriter{ResponseWriter: w, fits: r.responseCache.Fits}
+	serve(cw)
+	if cw.status == http.StatusOK && !cw.overflow {
+		r.responseCache.Put(key, &respcache.Response{
+			ContentType: w.Header().Get("Content-Type"),
+			Body:        cw.body,
+			Stored:      time.Now(),
+		})
+	}
+}
+
+// writeCached answers with a cached response, result and reason telling
+// which cache hit. A hit costs nothing and doesn't count against any target.
+func (r *Router) writeCached(w http.ResponseWriter, req *http.Request, llmReq *llmRequest, cached *respcache.Response, result, reason string) {
+	countRequest(req.Context(), r.requestCounter("cache", "success", llmReq))
+	accessRecordFrom(req.Context()).cached(reason)
+
+	header := w.Header()
+	header.Set(cacheHeader, result)
+	header.Set("Age", strconv.Itoa(int(time.Since(cached.Stored).Seconds())))
+	if cached.ContentType != "" {
+		header.Set("Content-Type", cached.ContentType)
+	}
+	if r.config.Router.DecisionHeader {
+		header.Set(decisionHeader, "target=cache; type=cache; reason="+reason)
+	}
+	if !r.config.Router.ResponseCost.Enabled {
+		w.WriteHeader(http.StatusOK)
+		w.Write(cached.Body)
+		return
+	}
+	// The body keeps whatever cost field it was first served with; the
+	// headers report this response's
+	header.Set(targetHeader, "cache")
+	reporter := newCostReporter(w, false, false)
+	reporter.Write(cached.Body)
+	reporter.finish(responseCost{Target: "cache"})
+}
+
+// cacheWriter passes a response through, keeping a copy of the body for
+// the cache until it grows too large to store
+type cacheWriter struct {
+	http.ResponseWriter
+	fits     func(size int) bool
+	status   int
+	body     []byte
+	overflow bool
+}
+
+func (cw *cacheWriter) WriteHeader(status int) {
+	if cw.status == 0 {
+		cw.status = status
+	}
+	cw.ResponseWriter.WriteHeader(status)
+}
+
+func (cw *cacheWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.status = http.StatusOK
+	}
+	if !cw.overflow {
+		if cw.fits(len(cw.body) + len(p)) {
+			cw.body = append(cw.body, p...)
+		} else {
+			cw.overflow, cw.body = true, nil
+		}
+	}
+	return cw.ResponseWriter.Write(p)
+}
+
+func (cw *cacheWriter) Flush() {
+	if flusher, ok := cw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (cw *cacheWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// purgeResponseCacheHandler empties the response cache
+func (r *Router) purgeResponseCacheHandler(w http.ResponseWriter, req *http.Request) {
+	purged := r.responseCache.Purge()
+	logrus.Infof("Purged %d response cache entries", purged)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"purged": purged})
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/secrets"
+)
+
+// resolveSecrets replaces every secret reference in config with the secret
+// it names. Fields holding a file path (certFile, keyFile and the like)
+// get the path of a file under stateDir/secrets holding the secret, named
+// by its contents so a rotated secret reads as a changed path.
+func resolveSecrets(config *Config) error {
+	resolver, err := secrets.New(config.Secrets)
+	if err != nil {
+		return fmt.Errorf("invalid secrets config: %w", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	dir := filepath.Join(config.Admin.StateDir, "secrets")
+	written := make(map[string]bool)
+	resolve := func(field, key, reference string) (string, error) {
+		value, err := resolver.Resolve(ctx, reference)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", field, err)
+		}
+		if !strings.HasSuffix(key, "File") {
+			return value, nil
+		}
+		sum := sha256.Sum256([]byte(value))
+		path := filepath.Join(dir, hex.EncodeToString(sum[:8]))
+		if err := os.MkdirAll(dir, 0o700); err != nil {
+			return "", fmt.Errorf("%s: %w", field, err)
+		}
+		if err := os.WriteFile(path, []byte(value), 0o600); err != nil {
+			return "", fmt.Errorf("%s: %w", field, err)
+		}
+		written[filepath.Base(path)] = true
+		return path, nil
+	}
+
+	v := reflect.ValueOf(config).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Name == "Secrets" {
+			continue // the stores' own credentials can't be references
+		}
+		key, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("yaml"), ",")
+		if err := resolveFields(v.Field(i), key, key, resolve); err != nil {
+			return err
+		}
+	}
+
+	config.secretReferences = resolver.Resolved()
+
+	// Files of secrets since rotated out were loaded when their targets
+	// were registered, so only the current ones are kept
+	if entries, err := os.ReadDir(dir); err == nil {
+		for _, entry := range entries {
+			if !written[entry.Name()] {
+				os.Remove(filepath.Join(dir, entry.Name()))
+			}
+		}
+	}
+	return nil
+}
+
+// resolveFields resolves the references in v, field being its path in the
+// config and key its YAML key
+func resolveFields(v reflect.Value, field, key string, resolve func(field, key, reference string) (string, error)) error {
+	switch v.Kind() {
+	case reflect.String:
+		if secrets.IsReference(v.String()) {
+			value, err := resolve(field, key, v.String())
+			if err != nil {
+				return err
+			}
+			v.SetString(value)
+		}
+	case reflect.Ptr:
+		if !v.IsNil() {
+			return resolveFields(v.Elem(), field, key, resolve)
+		}
+	case reflect.Slice:
+		for i := 0; i < v.Len(); i++ {
+			if err := resolveFields(v.Index(i), field+"["+strconv.Itoa(i)+"]", key, resolve); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		// Only string values, e.g. headers, can be set in place
+		if v.Type().Elem().Kind() != reflect.String {
+			return nil
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			reference := iter.Value().String()
+			if !secrets.IsReference(reference) {
+				continue
+			}
+			value, err := resolve(field+"."+fmt.Sprint(iter.Key()), key, reference)
+			if err != nil {
+				return err
+			}
+			v.SetMapIndex(iter.Key(), reflect.ValueOf(value).Convert(v.Type().Elem()))
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			if !t.Field(i).IsExported() {
+				continue
+			}
+			name, options, _ := strings.Cut(t.Field(i).Tag.Get("yaml"), ",")
+			path := field + "." + name
+			switch {
+			case name == "-":
+				continue
+			case strings.Contains(options, "inline"):
+				name, path = key, field
+			case name == "":
+				name = strings.ToLower(t.Field(i).Name)
+				path = field + "." + name
+			}
+			if err := resolveFields(v.Field(i), path, name, resolve); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// refreshSecrets reloads the config every refreshInterval, fetching its
+// secrets again so rotated ones reach the targets using them
+func (r *Router) refreshSecrets(ctx context.Context, beat func()) {
+	ticker := time.NewTicker(r.config.Secrets.RefreshInterval)
+	defer ticker.Stop()
+	beat()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.reloadLogged()
+		}
+		beat()
+	}
+}
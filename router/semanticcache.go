@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/respcache"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/semcache"
+	"github.com/sirupsen/logrus"
+)
+
+// similarityHeader tells callers how close a semantic cache hit's prompt
+// was to theirs
+const similarityHeader = "X-LLM-Router-Cache-Similarity"
+
+// semanticCacheEndpoints are those whose prompts are compared by meaning
+var semanticCacheEndpoints = map[string]bool{
+	"/v1/chat/completions": true,
+	"/v1/completions":      true,
+}
+
+// semanticScopeIgnored are left out of a request's scope: the prompt is
+// compared by its embedding instead, and `user` doesn't change the answer.
+// system and metadata are their Messages API counterparts.
+var semanticScopeIgnored = []string{"user", "messages", "prompt", "system", "metadata"}
+
+// serveSemanticCached answers llmReq with the cached response to the most
+// similar prompt when one is within router.semanticCache.threshold.
+// Otherwise serve answers it, and a successful response is cached under
+// the prompt's embedding. Requests whose prompt can't be embedded are
+// served as if the cache were off.
+func (r *Router) serveSemanticCached(w http.ResponseWriter, req *http.Request, llmReq *llmRequest, serve func(http.ResponseWriter)) {
+	cache := r.semanticCache
+	lookup, store := cacheControl(req)
+	if cache == nil || !store || !semanticCacheEndpoints[llmReq.Endpoint] || llmReq.Stream || req.Header.Get(callbackHeader) != "" {
+		serve(w)
+		return
+	}
+	prompt, ok := semcache.Prompt(llmReq.Body)
+	if !ok {
+		serve(w)
+		return
+	}
+	body, parts := llmReq.cacheRequest(cache.Config().Shared)
+	scope, ok := respcache.Key(body, semanticScopeIgnored, parts...)
+	if !ok {
+		serve(w)
+		return
+	}
+
+	vector, err := r.embedPrompt(req.Context(), llmReq, prompt)
+	if err != nil {
+		logrus.WithContext(req.Context()).Debugf("Semantic cache skipped: %v", err)
+		r.metrics.semanticCache.WithLabelValues("error").Inc()
+		serve(w)
+		return
+	}
+
+	result := "bypass"
+	if lookup {
+		entry, similarity, hit := cache.Nearest(scope, vector)
+		r.metrics.semanticSimilarity.Observe(similarity)
+		if hit {
+			r.metrics.semanticCache.WithLabelValues("hit").Inc()
+			w.Header().Set(similarityHeader, strconv.FormatFloat(similarity, 'f', 4, 64))
+			r.writeCached(w, req, llmReq, &respcache.Response{ContentType: entry.ContentType, Body: entry.Body, Stored: entry.Stored}, "semantic_hit", "semantic_cache_hit")
+			return
+		}
+		result = "miss"
+	}
+	r.metrics.semanticCache.WithLabelValues(result).Inc()
+	w.Header().Set(cacheHeader, result)
+
+	cw := &cacheWriter{ResponseWriter: w, fits: cache.Fits}
+	serve(cw)
+	if cw.status == http.StatusOK && !cw.overflow {
+		cache.Add(scope, vector, w.Header().Get("Content-Type"), cw.body)
+	}
+}
+
+// embedPrompt embeds llmReq's prompt with router.semanticCache's target
+// and model. The target is fixed rather than routed to, but the embedding
+// is otherwise the tenant's request like any other: it is kept off targets
+// the tenant may not use, is claimed like a routed target, and is
+// accounted by forwardAttempt, so its spend reaches the budget and the
+// tenant's quota.
+func (r *Router) embedPrompt(ctx context.Context, llmReq *llmRequest, prompt string) ([]float32, error) {
+	config := r.semanticCache.Config()
+	var target *RouteTarget
+	for _, live := range r.liveTargets(ctx) {
+		if live.Name == config.Target {
+			target = live
+			break
+		}
+	}
+	if target == nil {
+		return nil, fmt.Errorf("embeddings target %s is not available", config.Target)
+	}
+	if !r.tenantAllows(llmReq, target.Name, target.Type) || (llmReq.Demo && !r.inSandbox(target.Name)) {
+		return nil, fmt.Errorf("tenant %q may not use embeddings target %s", llmReq.Tenant, target.Name)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.Timeout)
+	defer cancel()
+	body, _ := json.Marshal(map[string]interface{}{"model": config.Model, "input": prompt})
+	embedReq, err := http.NewRequestWithContext(ctx, "POST", "/v1/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	embedReq.Header.Set("Content-Type", "application/json")
+
+	embedLLMReq := parseLLMRequest(embedReq, "/v1/embeddings", body)
+	embedLLMReq.Client = "" // not to stick the caller to the embeddings target
+	release, ok := r.claimTarget(target, embedLLMReq)
+	if !ok {
+		return nil, fmt.Errorf("embeddings target %s is at capacity or rate limited", target.Name)
+	}
+	defer release()
+
+	// The caller's access log entry is for the request it made
+	attemptCtx := context.WithValue(ctx, accessRecordKey{}, (*accessRecord)(nil))
+	buf := newResponseBuffer()
+	if err := r.forwardAttempt(attemptCtx, newFailoverWriter(buf), embedReq, target, embedLLMReq, time.Now()); err != nil {
+		return nil, fmt.Errorf("embedding prompt with %s: %w", target.Name, err)
+	}
+	if status := buf.StatusCode(); status != http.StatusOK {
+		return nil, fmt.Errorf("embedding prompt with %s: status %d", target.Name, status)
+	}
+	return semcache.Embedding(buf.Bytes())
+}
+
+// purgeSemanticCacheHandler empties the semantic cache, on every replica
+// when it is kept in Redis
+func (r *Router) purgeSemanticCacheHandler(w http.ResponseWriter, req *http.Request) {
+	purged, err := r.semanticCache.Purge()
+	if err != nil {
+		logrus.Errorf("Failed to purge the semantic cache in Redis: %v", err)
+		http.Error(w, "Failed to purge the semantic cache in Redis", http.StatusBadGateway)
+		return
+	}
+	logrus.Infof("Purged %d semantic cache entries", purged)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"purged": purged})
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ShadowConfig bounds the copies of live traffic sent to targets marked
+// shadow: true. Shadow targets are never selected to serve a client.
+type ShadowConfig struct {
+	Concurrency int           `yaml:"concurrency"` // shadow requests in flight before copies are dropped, default 16
+	Timeout     time.Duration `yaml:"timeout"`     // per shadow request, default 60s
+}
+
+// shadowWriter discards a shadow response, keeping only its status
+type shadowWriter struct {
+	header http.Header
+	status int
+	bytes  int
+}
+
+func (s *shadowWriter) Header() http.Header {
+	return s.header
+}
+
+func (s *shadowWriter) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+}
+
+func (s *shadowWriter) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	s.bytes += len(p)
+	return len(p), nil
+}
+
+func (s *shadowWriter) Flush() {}
+
+// shadowTargets returns the available targets marked shadow
+func (r *Router) shadowTargets(ctx context.Context) []*RouteTarget {
+	var shadows []*RouteTarget
+	for _, target := range r.liveTargets(ctx) {
+		if target.Shadow {
+			shadows = append(shadows, target)
+		}
+	}
+	return shadows
+}
+
+// shadowRequest copies llmReq to every shadow target serving its model.
+// The copies run in the background on their own deadline, so they never
+// delay or fail the client's request; their responses are discarded and
+// only recorded in metrics.
+func (r *Router) shadowRequest(req *http.Request, llmReq *llmRequest) {
+	if llmReq.Demo {
+		return
+	}
+	for _, target := range r.shadowTargets(req.Context()) {
+		if !r.tenantAllows(llmReq, target.Name, target.Type) || !servesEndpoint(target, llmReq.Endpoint) {
+			continue
+		}
+		if _, ok := r.filterByModel([]*RouteTarget{target}, llmReq.Model); !ok {
+			continue
+		}
+		select {
+		case r.shadowSlots <- struct{}{}:
+		default:
+			r.metrics.shadowRequests.WithLabelValues(target.Name, "dropped").Inc()
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(withRequestID(context.Background(), requestIDFrom(req.Context())), r.config.Router.Shadow.Timeout)
+		shadowReq := req.Clone(ctx)
+		shadowLLMReq := *llmReq
+		done := r.drain.begin()
+		go func(target *RouteTarget, llmReq *llmRequest) {
+			defer done()
+			defer cancel()
+			defer func() { <-r.shadowSlots }()
+
+			sw := &shadowWriter{header: make(http.Header)}
+			start := time.Now()
+			err := r.forwardToTarget(ctx, sw, shadowReq, target, llmReq)
+			elapsed := time.Since(start)
+
+			status := strconv.Itoa(sw.status)
+			if err != nil {
+				status = "error"
+				logrus.WithContext(ctx).Debugf("Shadow request to %s failed: %v", target.Name, err)
+			}
+			r.metrics.shadowRequests.WithLabelValues(target.Name, status).Inc()
+			r.metrics.shadowDuration.WithLabelValues(target.Name).Observe(elapsed.Seconds())
+			logrus.WithContext(ctx).Debugf("Shadowed %s to %s: status %s, %d bytes in %s", llmReq.Endpoint, target.Name, status, sw.bytes, elapsed)
+		}(target, &shadowLLMReq)
+	}
+}
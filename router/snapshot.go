@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/bandit"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/budget"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/cost"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/groups"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/history"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/quota"
+	"github.com/sirupsen/logrus"
+)
+
+// snapshotVersion is bumped when the snapshot layout changes incompatibly
+const snapshotVersion = 1
+
+// routerSnapshot is the router's runtime state in one portable document,
+// for moving a router to another host or warming up a fresh one
+type routerSnapshot struct {
+	Version    int                          `json:"version"`
+	TakenAt    time.Time                    `json:"taken_at"`
+	History    history.State                `json:"history"`    // per-target series and health transitions
+	Throughput map[string]cost.ClusterState `json:"throughput"` // learned cluster throughput and calibration
+	Latency    map[string]float64           `json:"latency"`    // target -> latency EWMA in ms
+	Bandit     map[string]bandit.Arm        `json:"bandit"`
+	Sticky     map[string]stickyState       `json:"sticky"`      // client key -> sticky target
+	DemoLimits map[string]demoWindowState   `json:"demo_limits"` // demo rate limit windows by client
+	Quotas     map[string]quota.Usage       `json:"quotas"`      // tenant usage in the current period
+	Budget     budget.State                 `json:"budget"`      // external spend and pacing
+	GroupSpend map[string]groups.Spend      `json:"group_spend"`
+	KillSwitch KillSwitchState              `json:"kill_switch"`
+}
+
+// snapshot captures the router's current runtime state
+func (r *Router) snapshot() routerSnapshot {
+	return routerSnapshot{
+		Version:    snapshotVersion,
+		TakenAt:    time.Now(),
+		History:    r.history.State(),
+		Throughput: r.costEngine.State(),
+		Latency:    r.latency.snapshot(),
+		Bandit:     r.bandit.State(),
+		Sticky:     r.stickiness.state(),
+		DemoLimits: r.demoLimiter.state(),
+		Quotas:     r.quotas.State(),
+		Budget:     r.budget.State(),
+		GroupSpend: r.groups.Spend(),
+		KillSwitch: r.killSwitch.State(),
+	}
+}
+
+// restore loads a snapshot over the state read from the state dir, then
+// writes it back there so a restart before the next drain keeps it. Each
+// part is restored as its own Restore does on startup: spend from another
+// month, ended quota periods and lapsed sticky windows are dropped, and
+// state for targets that are no longer configured is ignored.
+func (r *Router) restore(snapshot routerSnapshot) error {
+	if snapshot.Version > snapshotVersion {
+		return fmt.Errorf("snapshot version %d is newer than this router supports (%d)", snapshot.Version, snapshotVersion)
+	}
+
+	r.history.Restore(snapshot.History)
+	r.costEngine.Restore(snapshot.Throughput)
+	r.latency.restore(snapshot.Latency)
+	r.bandit.Restore(snapshot.Bandit)
+	r.stickiness.restore(snapshot.Sticky)
+	r.demoLimiter.restore(snapshot.DemoLimits)
+	r.quotas.Restore(snapshot.Quotas)
+	r.budget.Restore(snapshot.Budget)
+	r.groups.RestoreSpend(snapshot.GroupSpend)
+	if err := r.killSwitch.set(snapshot.KillSwitch); err != nil {
+		return err
+	}
+
+	if _, failures := r.drain.flush(); len(failures) > 0 {
+		logrus.Warnf("Restored snapshot but failed to save it to the state dir: %v", failures)
+	}
+	logrus.Infof("Restored runtime state from a snapshot taken %s", snapshot.TakenAt.Format(time.RFC3339))
+	return nil
+}
+
+// restoreFile restores a snapshot written by /admin/snapshot, gzipped or not
+func (r *Router) restoreFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var reader io.Reader = bufio.NewReader(f)
+	if magic, _ := reader.(*bufio.Reader).Peek(2); bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		gz, err := gzip.NewReader(reader)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+
+	var snapshot routerSnapshot
+	if err := json.NewDecoder(reader).Decode(&snapshot); err != nil {
+		return fmt.Errorf("invalid snapshot %s: %w", path, err)
+	}
+	return r.restore(snapshot)
+}
+
+// snapshotHandler downloads the runtime state as gzipped JSON, to be loaded
+// on another host with --restore
+func (r *Router) snapshotHandler(w http.ResponseWriter, req *http.Request) {
+	snapshot := r.snapshot()
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf("attachment; filename=router-snapshot-%s.json.gz", snapshot.TakenAt.UTC().Format("20060102T150405Z")))
+
+	gz := gzip.NewWriter(w)
+	if err := json.NewEncoder(gz).Encode(snapshot); err != nil {
+		logrus.Warnf("Failed to write snapshot: %v", err)
+	}
+	gz.Close()
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// statusHandler reports the state of router internals for operators
+func (r *Router) statusHandler(w http.ResponseWriter, req *http.Request) {
+	status := map[string]interface{}{
+		"timestamp": time.Now().Format(time.RFC3339),
+		"watchdog": map[string]interface{}{
+			"loops": r.watchdog.Status(),
+		},
+		"cluster_groups":   r.groups.Status(),
+		"killswitch":       r.killSwitch.State(),
+		"latency_ewma_ms":  r.latency.snapshot(),
+		"circuit_breakers": r.breakers.Status(),
+		"provider_health":  r.healthChecker.GetProviderStatus(),
+	}
+	if r.config.Router.MonthlyAPIBudget > 0 {
+		status["external_budget"] = r.budget.Status()
+	}
+	if r.config.Router.Canary.Enabled {
+		status["canary"] = r.canary.status()
+	}
+	if r.policy.get().RoutingStrategy == "bandit" {
+		status["bandit"] = r.bandit.Estimates(r.strategies.Get().Bandit.ErrorPenalty)
+	}
+	if r.config.StatusFeeds.Enabled {
+		status["provider_incidents"] = r.statusFeeds.Status()
+	}
+	if limits := r.rateLimits.Status(); len(limits) > 0 {
+		status["provider_rate_limits"] = limits
+	}
+	if cooldowns := r.providerManager.Cooldowns(); len(cooldowns) > 0 {
+		status["provider_cooldowns"] = cooldowns
+	}
+	if r.responseCache != nil {
+		status["response_cache"] = r.responseCache.Stats()
+	}
+	if r.semanticCache != nil {
+		status["semantic_cache"] = r.semanticCache.Stats()
+	}
+	if r.spotPrices != nil {
+		status["spot_prices"] = r.spotPrices.Status()
+	}
+	if r.discovery != nil {
+		status["discovery"] = r.discovery.Status()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// stickyTable remembers the last target chosen for each client so repeat
+// requests within the stickiness window hit a warm KV cache
+type stickyTable struct {
+	mu        sync.Mutex
+	window    time.Duration
+	entries   map[string]stickyEntry
+	lastSweep time.Time
+}
+
+type stickyEntry struct {
+	target    string
+	expiresAt time.Time
+}
+
+func newStickyTable(window time.Duration) *stickyTable {
+	return &stickyTable{window: window, entries: make(map[string]stickyEntry)}
+}
+
+// get returns the client's current target, if its window hasn't lapsed
+func (s *stickyTable) get(client string) (string, bool) {
+	if s.window <= 0 || client == "" {
+		return "", false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	entry, exists := s.entries[client]
+	if !exists {
+		return "", false
+	}
+	if time.Now().After(entry.expiresAt) {
+		delete(s.entries, client)
+		return "", false
+	}
+	return entry.target, true
+}
+
+// set records target for client, restarting the window
+func (s *stickyTable) set(client, target string) {
+	if s.window <= 0 || client == "" {
+		return
+	}
+
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[client] = stickyEntry{target: target, expiresAt: now.Add(s.window)}
+
+	// Drop lapsed clients at most once per window
+	if now.Sub(s.lastSweep) > s.window {
+		for key, entry := range s.entries {
+			if now.After(entry.expiresAt) {
+				delete(s.entries, key)
+			}
+		}
+		s.lastSweep = now
+	}
+}
+
+// state returns the clients whose window is still open, by target, so a
+// snapshot can carry them to another router
+func (s *stickyTable) state() map[string]stickyState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	state := make(map[string]stickyState, len(s.entries))
+	for client, entry := range s.entries {
+		if now.Before(entry.expiresAt) {
+			state[client] = stickyState{Target: entry.target, ExpiresAt: entry.expiresAt}
+		}
+	}
+	return state
+}
+
+// restore reloads clients saved by state, keeping their original expiry
+func (s *stickyTable) restore(state map[string]stickyState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for client, saved := range state {
+		if now.Before(saved.ExpiresAt) {
+			s.entries[client] = stickyEntry{target: saved.Target, expiresAt: saved.ExpiresAt}
+		}
+	}
+}
+
+// stickyState is a sticky client as snapshotted
+type stickyState struct {
+	Target    string    `json:"target"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// clientKey identifies the caller by API key, falling back to client IP.
+// Keys are hashed so credentials aren't held in the table.
+func clientKey(req *http.Request) string {
+	if auth := req.Header.Get("Authorization"); auth != "" {
+		sum := sha256.Sum256([]byte(auth))
+		return "key:" + hex.EncodeToString(sum[:8])
+	}
+	return "ip:" + clientIP(req)
+}
+
+// clientIPKey carries the caller's address as resolved by resolveClientIPs
+type clientIPKey struct{}
+
+// resolveClientIPs records each caller's address for clientIP. Only
+// server.trustedProxies are believed about X-Forwarded-For: the client is
+// the last address in it that isn't one of them, so callers can't choose
+// their address by sending the header themselves.
+func (r *Router) resolveClientIPs(next http.Handler) http.Handler {
+	trusted, _ := parseTrustedProxies(r.config.Server.TrustedProxies) // checked by validateConfig
+	isTrusted := func(addr string) bool {
+		ip := net.ParseIP(addr)
+		for _, proxies := range trusted {
+			if ip != nil && proxies.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ip := remoteHost(req)
+		if isTrusted(ip) {
+			hops := strings.Split(req.Header.Get("X-Forwarded-For"), ",")
+			for i := len(hops) - 1; i >= 0; i-- {
+				hop := strings.TrimSpace(hops[i])
+				if hop == "" {
+					continue
+				}
+				ip = hop
+				if !isTrusted(hop) {
+					break
+				}
+			}
+		}
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), clientIPKey{}, ip)))
+	})
+}
+
+// parseTrustedProxies parses server.trustedProxies, addresses or CIDR ranges
+func parseTrustedProxies(proxies []string) ([]*net.IPNet, error) {
+	ranges := make([]*net.IPNet, 0, len(proxies))
+	for _, proxy := range proxies {
+		cidr := proxy
+		if ip := net.ParseIP(proxy); ip != nil && ip.To4() != nil {
+			cidr += "/32"
+		} else if ip != nil {
+			cidr += "/128"
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an IP address or CIDR range", proxy)
+		}
+		ranges = append(ranges, ipNet)
+	}
+	return ranges, nil
+}
+
+// clientIP is the caller's address, as forwarded by a trusted proxy when
+// one is in front
+func clientIP(req *http.Request) string {
+	if ip, ok := req.Context().Value(clientIPKey{}).(string); ok {
+		return ip
+	}
+	return remoteHost(req)
+}
+
+// remoteHost is the address the request's connection came from
+func remoteHost(req *http.Request) string {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return host
+}
+
+// stickyTarget returns the client's previous target if it is still a candidate
+func (r *Router) stickyTarget(client string, targets []*RouteTarget) *RouteTarget {
+	name, ok := r.stickiness.get(client)
+	if !ok {
+		return nil
+	}
+	for _, target := range targets {
+		if target.Name == name {
+			return target
+		}
+	}
+	return nil
+}
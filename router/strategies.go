@@ -0,0 +1,35 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+)
+
+// strategiesHandler reports the live per-strategy configuration
+func (r *Router) strategiesHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.strategies.Get())
+}
+
+// patchStrategiesHandler merges a JSON patch into the strategy configuration.
+// Invalid patches are rejected whole and leave the live config untouched.
+func (r *Router) patchStrategiesHandler(w http.ResponseWriter, req *http.Request) {
+	patch, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeBodyError(w, err, "Failed to read request body")
+		return
+	}
+
+	updated, err := r.strategies.Patch(patch)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	logrus.Infof("Strategy configuration patched: %s", patch)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
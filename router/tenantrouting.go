@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// TenantRoutingConfig limits where one tenant's requests may go. Tenants
+// come from auth; anonymous callers are never restricted.
+type TenantRoutingConfig struct {
+	Targets        []string `yaml:"targets"`        // only these targets, default all
+	ExcludeTargets []string `yaml:"excludeTargets"` // never these
+	External       string   `yaml:"external"`       // allow (default), deny, or fallback: providers only once no cluster can serve
+}
+
+// Values of TenantRoutingConfig.External
+const (
+	externalAllow    = "allow"
+	externalDeny     = "deny"
+	externalFallback = "fallback"
+)
+
+// restricted reports whether the policy limits the tenant's targets
+func (p TenantPolicy) restricted() bool {
+	return len(p.Targets) > 0 || len(p.ExcludeTargets) > 0 || (p.External != "" && p.External != externalAllow)
+}
+
+// allows reports whether the policy lets the tenant use target by name and
+// type. External fallback is applied separately, once the other filters
+// have run.
+func (p TenantPolicy) allows(name, targetType string) bool {
+	if targetType != "cluster" && p.External == externalDeny {
+		return false
+	}
+	for _, excluded := range p.ExcludeTargets {
+		if excluded == name {
+			return false
+		}
+	}
+	if len(p.Targets) == 0 {
+		return true
+	}
+	for _, allowed := range p.Targets {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// tenantAllows reports whether llmReq's tenant may use the target
+func (r *Router) tenantAllows(llmReq *llmRequest, name, targetType string) bool {
+	if llmReq.Tenant == "" {
+		return true
+	}
+	return r.policy.tenant(llmReq.Tenant).allows(name, targetType)
+}
+
+// filterByTenant keeps the targets llmReq's tenant may use
+func (r *Router) filterByTenant(targets []*RouteTarget, llmReq *llmRequest) ([]*RouteTarget, error) {
+	if llmReq.Tenant == "" {
+		return targets, nil
+	}
+	policy := r.policy.tenant(llmReq.Tenant)
+	if !policy.restricted() {
+		return targets, nil
+	}
+	var allowed []*RouteTarget
+	for _, target := range targets {
+		if policy.allows(target.Name, target.Type) {
+			allowed = append(allowed, target)
+		}
+	}
+	if len(allowed) == 0 && len(targets) > 0 {
+		return nil, fmt.Errorf("no healthy target tenant %q may use is available", llmReq.Tenant)
+	}
+	return allowed, nil
+}
+
+// filterExternalFallback drops providers while a cluster can still serve a
+// tenant whose policy keeps providers for fallback
+func (r *Router) filterExternalFallback(targets []*RouteTarget, llmReq *llmRequest) []*RouteTarget {
+	if llmReq.Tenant == "" || r.policy.tenant(llmReq.Tenant).External != externalFallback {
+		return targets
+	}
+	var clusters []*RouteTarget
+	for _, target := range targets {
+		if target.Type == "cluster" {
+			clusters = append(clusters, target)
+		}
+	}
+	if len(clusters) == 0 {
+		return targets
+	}
+	return clusters
+}
+
+// tenantRoutingErrors checks the tenants' target restrictions, known
+// reporting whether a target is configured. It serves both
+// router.tenantRouting and the routing policy's tenants, so fields are
+// relative to the map, e.g. acme.targets[0].
+func tenantRoutingErrors(tenants map[string]TenantRoutingConfig, known func(string) bool) []configError {
+	var errs []configError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, configError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+	names := make([]string, 0, len(tenants))
+	for tenant := range tenants {
+		names = append(names, tenant)
+	}
+	sort.Strings(names)
+	for _, tenant := range names {
+		routing := tenants[tenant]
+		switch routing.External {
+		case "", externalAllow, externalDeny, externalFallback:
+		default:
+			add(tenant+".external", "unknown value %q; use allow, deny or fallback", routing.External)
+		}
+		for i, name := range routing.Targets {
+			if !known(name) {
+				add(fmt.Sprintf("%s.targets[%d]", tenant, i), "names unknown target %s", name)
+			}
+		}
+		for i, name := range routing.ExcludeTargets {
+			if !known(name) {
+				add(fmt.Sprintf("%s.excludeTargets[%d]", tenant, i), "names unknown target %s", name)
+			}
+		}
+	}
+	return errs
+}
+
+// validateTenantPolicies checks the routing policy's tenants as
+// tenantRoutingErrors does, returning the first problem
+func validateTenantPolicies(tenants map[string]TenantPolicy, known func(string) bool) error {
+	routing := make(map[string]TenantRoutingConfig, len(tenants))
+	for tenant, policy := range tenants {
+		routing[tenant] = TenantRoutingConfig{Targets: policy.Targets, ExcludeTargets: policy.ExcludeTargets, External: policy.External}
+	}
+	if errs := tenantRoutingErrors(routing, known); len(errs) > 0 {
+		return fmt.Errorf("tenants.%v", errs[0])
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TokenTier routes prompts within a token range to a subset of targets,
+// e.g. short prompts to small clusters and long ones to providers with big
+// context windows. Bounds are inclusive; zero leaves a side open.
+type TokenTier struct {
+	Name            string   `yaml:"name"`
+	MinPromptTokens int      `yaml:"minPromptTokens"`
+	MaxPromptTokens int      `yaml:"maxPromptTokens"`
+	Targets         []string `yaml:"targets"` // target names
+	Type            string   `yaml:"type"`    // or every "cluster" or "provider"
+	Strict          bool     `yaml:"strict"`  // reject rather than use other targets when none in the tier is available
+}
+
+func (t TokenTier) matches(tokens int) bool {
+	return tokens >= t.MinPromptTokens && (t.MaxPromptTokens == 0 || tokens <= t.MaxPromptTokens)
+}
+
+func (t TokenTier) includes(target *RouteTarget) bool {
+	if t.Type != "" && target.Type == t.Type {
+		return true
+	}
+	for _, name := range t.Targets {
+		if name == target.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// validateTokenTiers rejects tiers that can't select anything
+func validateTokenTiers(tiers []TokenTier) error {
+	for _, tier := range tiers {
+		if tier.Type != "" && tier.Type != "cluster" && tier.Type != "provider" {
+			return fmt.Errorf("token tier %s: unknown type %q", tier.Name, tier.Type)
+		}
+		if tier.Type == "" && len(tier.Targets) == 0 {
+			return fmt.Errorf("token tier %s names no targets or type", tier.Name)
+		}
+		if tier.MaxPromptTokens > 0 && tier.MaxPromptTokens < tier.MinPromptTokens {
+			return fmt.Errorf("token tier %s: maxPromptTokens is below minPromptTokens", tier.Name)
+		}
+	}
+	return nil
+}
+
+// filterByTokenTier keeps the targets of the first tier the prompt's
+// estimated size falls in. Without an available target in the tier, the
+// request uses the others unless the tier is strict.
+func (r *Router) filterByTokenTier(targets []*RouteTarget, llmReq *llmRequest) ([]*RouteTarget, error) {
+	if len(r.config.Router.TokenTiers) == 0 {
+		return targets, nil
+	}
+
+	// Explained requests aren't routed, so they aren't counted
+	count := func(tier, outcome string) {
+		if llmReq.trace == nil {
+			r.metrics.tokenTiers.WithLabelValues(tier, outcome).Inc()
+		}
+	}
+
+	tokens := llmReq.promptTokens()
+	for _, tier := range r.config.Router.TokenTiers {
+		if !tier.matches(tokens) {
+			continue
+		}
+		var matched []*RouteTarget
+		for _, target := range targets {
+			if tier.includes(target) {
+				matched = append(matched, target)
+			}
+		}
+		switch {
+		case len(matched) > 0:
+			count(tier.Name, "routed")
+			return matched, nil
+		case tier.Strict:
+			count(tier.Name, "rejected")
+			return nil, fmt.Errorf("no target in token tier %s is available for a %d token prompt", tier.Name, tokens)
+		default:
+			logrus.Debugf("No target in token tier %s is available, routing a %d token prompt elsewhere", tier.Name, tokens)
+			count(tier.Name, "fallback")
+			return targets, nil
+		}
+	}
+	return targets, nil
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/tokenizer"
+)
+
+// usageTailBytes bounds how much of a response usageTap keeps. Usage is
+// reported at the end of JSON bodies; streams are read as they pass.
+const usageTailBytes = 64 << 10
+
+// streamTextBytes is how much streamed text is held before it is counted.
+// Text is counted up to a word boundary so few tokens straddle two counts.
+const streamTextBytes = 16 << 10
+
+// tokenUsage is an OpenAI usage block
+type tokenUsage struct {
+	PromptTokens            int               `json:"prompt_tokens"`
+	CompletionTokens        int               `json:"completion_tokens"`
+	CompletionTokensDetails completionDetails `json:"completion_tokens_details"`
+}
+
+// UnmarshalJSON reads an OpenAI usage block or Anthropic's, which Claude
+// answers Messages API requests forwarded to it unconverted with
+func (u *tokenUsage) UnmarshalJSON(data []byte) error {
+	type openAIUsage tokenUsage
+	var usage struct {
+		openAIUsage
+		InputTokens  *int `json:"input_tokens"`
+		OutputTokens *int `json:"output_tokens"`
+	}
+	if err := json.Unmarshal(data, &usage); err != nil {
+		return err
+	}
+	*u = tokenUsage(usage.openAIUsage)
+	if usage.InputTokens != nil {
+		u.PromptTokens = *usage.InputTokens
+	}
+	if usage.OutputTokens != nil {
+		u.CompletionTokens = *usage.OutputTokens
+	}
+	return nil
+}
+
+// completionDetails breaks down completion tokens; reasoning tokens are
+// included in the completion count
+type completionDetails struct {
+	ReasoningTokens int `json:"reasoning_tokens"`
+}
+
+// usageTap passes a response through while keeping its tail, so the
+// upstream-reported token usage can be read once the response is done.
+// SSE streams are parsed chunk by chunk instead, accumulating usage and
+// generated text however long they run.
+type usageTap struct {
+	w       http.ResponseWriter
+	model   string // counts streamed text when no usage is reported
+	tail    []byte
+	cut     bool // the start of the body was dropped
+	written int  // body bytes passed through
+	stream  *streamCount
+	checked bool // whether the response has been checked for SSE
+	status  int  // status the upstream answered, 0 until known
+}
+
+// streamCount accumulates what the chunks of an SSE stream report
+type streamCount struct {
+	line      []byte // incomplete line carried into the next write
+	usage     *tokenUsage
+	model     string
+	text      strings.Builder // generated text not yet counted
+	reasoning strings.Builder // reasoning text not yet counted
+	tokens    int             // generated tokens counted so far, reasoning included
+	reasoned  int             // reasoning tokens counted so far
+}
+
+func newUsageTap(w http.ResponseWriter, model string) *usageTap {
+	return &usageTap{w: w, model: model}
+}
+
+func (t *usageTap) Header() http.Header {
+	return t.w.Header()
+}
+
+func (t *usageTap) WriteHeader(status int) {
+	if t.status == 0 {
+		t.status = status
+	}
+	t.checkStream()
+	t.w.WriteHeader(status)
+}
+
+// checkStream decides once, from the content type, whether the response
+// is parsed as a stream
+func (t *usageTap) checkStream() {
+	if t.checked {
+		return
+	}
+	t.checked = true
+	if strings.HasPrefix(t.w.Header().Get("Content-Type"), "text/event-stream") {
+		t.stream = &streamCount{}
+	}
+}
+
+func (t *usageTap) Write(p []byte) (int, error) {
+	if t.status == 0 {
+		t.status = http.StatusOK
+	}
+	t.checkStream()
+	t.written += len(p)
+	if t.stream != nil {
+		t.stream.write(p, t.model)
+		return t.w.Write(p)
+	}
+	t.tail = append(t.tail, p...)
+	if len(t.tail) > usageTailBytes {
+		t.tail = append(t.tail[:0], t.tail[len(t.tail)-usageTailBytes:]...)
+		t.cut = true
+	}
+	return t.w.Write(p)
+}
+
+func (t *usageTap) Flush() {
+	if flusher, ok := t.w.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// write consumes the complete lines of p, keeping a partial last line
+func (s *streamCount) write(p []byte, model string) {
+	s.line = append(s.line, p...)
+	for {
+		i := bytes.IndexByte(s.line, '\n')
+		if i < 0 {
+			break
+		}
+		s.chunk(s.line[:i], model)
+		s.line = s.line[i+1:]
+	}
+	if len(s.line) > usageTailBytes {
+		s.line = nil // not SSE after all
+	}
+}
+
+// chunk reads one SSE line
+func (s *streamCount) chunk(line []byte, model string) {
+	data, ok := bytes.CutPrefix(line, []byte("data:"))
+	if !ok {
+		return
+	}
+	var chunk struct {
+		Type    string      `json:"type"`
+		Model   string      `json:"model"`
+		Usage   *tokenUsage `json:"usage"`
+		Choices []struct {
+			Text  string `json:"text"`
+			Delta struct {
+				Content          string `json:"content"`
+				ReasoningContent string `json:"reasoning_content"`
+				Reasoning        string `json:"reasoning"`
+			} `json:"delta"`
+		} `json:"choices"`
+
+		// Anthropic's events: message_start reports the prompt's usage,
+		// message_delta the output's, and content_block_delta the text
+		Message struct {
+			Model string      `json:"model"`
+			Usage *tokenUsage `json:"usage"`
+		} `json:"message"`
+		Delta struct {
+			Text     string `json:"text"`
+			Thinking string `json:"thinking"`
+		} `json:"delta"`
+	}
+	if json.Unmarshal(bytes.TrimSpace(data), &chunk) != nil {
+		return
+	}
+	if chunk.Message.Model != "" {
+		chunk.Model = chunk.Message.Model
+	}
+	if chunk.Model != "" {
+		s.model = chunk.Model
+	}
+	if chunk.Message.Usage != nil {
+		s.usage = chunk.Message.Usage
+	}
+	if chunk.Usage != nil {
+		if chunk.Type == "message_delta" && s.usage != nil {
+			s.usage.CompletionTokens = chunk.Usage.CompletionTokens
+		} else {
+			s.usage = chunk.Usage
+		}
+	}
+	for _, c := range chunk.Choices {
+		s.text.WriteString(c.Delta.Content + c.Text)
+		s.reasoning.WriteString(c.Delta.ReasoningContent + c.Delta.Reasoning)
+	}
+	s.text.WriteString(chunk.Delta.Text)
+	s.reasoning.WriteString(chunk.Delta.Thinking)
+	if s.text.Len()+s.reasoning.Len() > streamTextBytes {
+		s.count(model, false)
+	}
+}
+
+// count tokenizes the text held so far, all of it when final, otherwise
+// up to the last space
+func (s *streamCount) count(model string, final bool) {
+	for _, held := range []*strings.Builder{&s.text, &s.reasoning} {
+		text := held.String()
+		rest := ""
+		if !final {
+			if i := strings.LastIndexAny(text, " \n"); i > 0 {
+				text, rest = text[:i], text[i:]
+			}
+		}
+		tokens := tokenizer.Count(model, text)
+		s.tokens += tokens
+		if held == &s.reasoning {
+			s.reasoned += tokens
+		}
+		held.Reset()
+		held.WriteString(rest)
+	}
+}
+
+// succeeded reports whether the upstream answered with a 2xx status
+func (t *usageTap) succeeded() bool {
+	return t.status >= 200 && t.status < 300
+}
+
+// streamed returns the counts of a stream, reading the kept tail as SSE
+// when the response was a stream not labelled as one
+func (t *usageTap) streamed() *streamCount {
+	if t.stream == nil && !json.Valid(t.tail) && bytes.Contains(t.tail, []byte("data:")) {
+		t.stream = &streamCount{}
+		t.stream.write(append(t.tail, '\n'), t.model)
+	}
+	return t.stream
+}
+
+// usage returns the token usage reported in the response, from a JSON body
+// or the last SSE chunk carrying one
+func (t *usageTap) usage() (tokenUsage, bool) {
+	if stream := t.streamed(); stream != nil {
+		if stream.usage == nil {
+			return tokenUsage{}, false
+		}
+		return *stream.usage, true
+	}
+	var body struct {
+		Usage *tokenUsage `json:"usage"`
+	}
+	if !t.cut && json.Unmarshal(t.tail, &body) == nil && body.Usage != nil {
+		return *body.Usage, true
+	}
+	return tokenUsage{}, false
+}
+
+// responseModel returns the model the response says answered, if any
+func (t *usageTap) responseModel() string {
+	if stream := t.streamed(); stream != nil {
+		return stream.model
+	}
+	var body struct {
+		Model string `json:"model"`
+	}
+	if !t.cut {
+		json.Unmarshal(t.tail, &body)
+	}
+	return body.Model
+}
+
+// completionText returns the generated text of a JSON response kept whole
+func (t *usageTap) completionText() (string, bool) {
+	if t.cut || t.streamed() != nil {
+		return "", false
+	}
+	var body struct {
+		Choices []struct {
+			Text    string `json:"text"`
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	if json.Unmarshal(t.tail, &body) != nil {
+		return "", false
+	}
+	var text strings.Builder
+	for _, c := range body.Choices {
+		text.WriteString(c.Message.Content + c.Text)
+	}
+	return text.String(), true
+}
+
+// measuredUsage returns the usage a response reported, or counts the
+// tokens of the request and response when it reported none, such as
+// streams that didn't ask for it. Bodies too long to keep whole are
+// estimated from their length.
+func measuredUsage(llmReq *llmRequest, tap *usageTap) (tokenUsage, bool) {
+	if usage, ok := tap.usage(); ok {
+		return usage, false
+	}
+	if llmReq.Audio != nil {
+		return tokenUsage{}, true // priced by the minute, see audioCost
+	}
+	usage := tokenUsage{PromptTokens: llmReq.promptTokens()}
+	if stream := tap.streamed(); stream != nil {
+		stream.count(tap.model, true)
+		usage.CompletionTokens = stream.tokens
+		usage.CompletionTokensDetails.ReasoningTokens = stream.reasoned
+	} else if text, ok := tap.completionText(); ok {
+		usage.CompletionTokens = tokenizer.Count(llmReq.Model, text)
+	} else {
+		usage.CompletionTokens = tap.written / 4
+	}
+	return usage, true
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/auth"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/usagestore"
+	"github.com/sirupsen/logrus"
+)
+
+// usageReportHandler totals tokens and spend from the usage store, so
+// billing questions don't need PromQL. Filters are ?tenant, ?provider,
+// ?target and ?model; ?from and ?to (RFC 3339 or YYYY-MM-DD, to exclusive)
+// default to the current UTC month; ?group_by takes a comma-separated list
+// of usagestore.GroupKeys. Callers authenticated as a tenant only see
+// their own usage.
+func (r *Router) usageReportHandler(w http.ResponseWriter, req *http.Request) {
+	if r.usageStore == nil {
+		http.Error(w, "Usage store is not enabled", http.StatusNotFound)
+		return
+	}
+
+	params := req.URL.Query()
+	now := time.Now().UTC()
+	query := usagestore.Query{
+		From:     time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC),
+		To:       now,
+		Tenant:   params.Get("tenant"),
+		Provider: params.Get("provider"),
+		Target:   params.Get("target"),
+		Model:    params.Get("model"),
+	}
+	for param, into := range map[string]*time.Time{"from": &query.From, "to": &query.To} {
+		value := params.Get(param)
+		if value == "" {
+			continue
+		}
+		parsed, err := parseReportTime(value)
+		if err != nil {
+			http.Error(w, "Invalid "+param+": expected RFC 3339 or YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+		*into = parsed
+	}
+	if groupBy := params.Get("group_by"); groupBy != "" {
+		for _, key := range strings.Split(groupBy, ",") {
+			query.GroupBy = append(query.GroupBy, strings.TrimSpace(key))
+		}
+	}
+
+	if id := auth.FromContext(req.Context()); id != nil && id.Tenant != "" {
+		if query.Tenant != "" && query.Tenant != id.Tenant {
+			http.Error(w, "Usage of other tenants is not visible to this caller", http.StatusForbidden)
+			return
+		}
+		query.Tenant = id.Tenant
+	}
+
+	summaries, err := r.usageStore.Aggregate(req.Context(), query)
+	if errors.Is(err, usagestore.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		logrus.Errorf("Failed to query usage: %v", err)
+		http.Error(w, "Failed to query usage", http.StatusInternalServerError)
+		return
+	}
+
+	var totals usagestore.Summary
+	for _, summary := range summaries {
+		totals.Add(summary)
+	}
+	report := map[string]interface{}{
+		"from":   query.From,
+		"to":     query.To,
+		"totals": totals,
+	}
+	filters := map[string]string{}
+	for name, value := range map[string]string{"tenant": query.Tenant, "provider": query.Provider, "target": query.Target, "model": query.Model} {
+		if value != "" {
+			filters[name] = value
+		}
+	}
+	report["filters"] = filters
+	if len(query.GroupBy) > 0 {
+		if summaries == nil {
+			summaries = []usagestore.Summary{}
+		}
+		report["group_by"] = query.GroupBy
+		report["groups"] = summaries
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// parseReportTime accepts an RFC 3339 timestamp or a UTC date
+func parseReportTime(value string) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, value); err == nil {
+		return parsed, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
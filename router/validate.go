@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/engine"
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/providers"
+	"github.com/sirupsen/logrus"
+)
+
+// configError is a configuration value the router can't work with as
+// written. Unlike lint findings, these fail requests or whole targets.
+type configError struct {
+	Field   string `json:"field"` // config path, e.g. clusters[1].sharedSecret
+	Message string `json:"message"`
+}
+
+func (e configError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// keyedProviderTypes are the built-in provider types that need an API key
+// unless baseURL points them at a compatible server
+var keyedProviderTypes = map[string]bool{"openai": true, "claude": true, "gemini": true}
+
+// validateConfig checks config for values that would make targets
+// unreachable or requests fail. Provider plugins must be loaded first, so
+// their types are known.
+func validateConfig(config *Config) []configError {
+	var errs []configError
+	add := func(field, format string, args ...interface{}) {
+		errs = append(errs, configError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if port := config.Server.Port; port < 1 || port > 65535 {
+		add("server.port", "%d is not a TCP port", port)
+	}
+	if _, err := parseTrustedProxies(config.Server.TrustedProxies); err != nil {
+		add("server.trustedProxies", "%v", err)
+	}
+
+	seen := make(map[string]string)
+	claim := func(field, name string) {
+		if name == "" {
+			add(field, "name is required")
+			return
+		}
+		if first, ok := seen[name]; ok {
+			add(field, "name %q is already used by %s; target names must be unique", name, first)
+			return
+		}
+		seen[name] = field
+	}
+
+	for i, cluster := range config.Clusters {
+		field := fmt.Sprintf("clusters[%d]", i)
+		claim(field+".name", cluster.Name)
+		if endpoint, err := url.Parse(cluster.Endpoint); err != nil || endpoint.Host == "" || (endpoint.Scheme != "http" && endpoint.Scheme != "https") {
+			add(field+".endpoint", "%q must be an http or https URL", cluster.Endpoint)
+		}
+		if _, ok := engine.Lookup(cluster.Engine); !ok && cluster.Engine != "" {
+			names := engine.Names()
+			sort.Strings(names)
+			add(field+".engine", "unknown engine %q; known engines are %s", cluster.Engine, strings.Join(names, ", "))
+		}
+		switch cluster.AuthType {
+		case "":
+		case "hmac":
+			if cluster.SharedSecret == "" {
+				add(field+".sharedSecret", "authType hmac signs requests with sharedSecret; set it")
+			}
+		case "mtls":
+			for _, file := range []struct{ key, path string }{{"certFile", cluster.CertFile}, {"keyFile", cluster.KeyFile}} {
+				if file.path == "" {
+					add(field+"."+file.key, "authType mtls needs %s", file.key)
+				} else if _, err := os.Stat(file.path); err != nil {
+					add(field+"."+file.key, "can't read %s: %v", file.path, err)
+				}
+			}
+		default:
+			add(field+".authType", "unknown authType %q; use hmac or mtls, or leave it empty", cluster.AuthType)
+		}
+		if cluster.CostPerHour < 0 {
+			add(field+".costPerHour", "must not be negative")
+		}
+		if cluster.Weight < 0 {
+			add(field+".weight", "must not be negative")
+		}
+		for j, endpoint := range cluster.Endpoints {
+			if !apiEndpoints[strings.TrimSuffix(endpoint, "/")] {
+				add(fmt.Sprintf("%s.endpoints[%d]", field, j), "unknown endpoint %q", endpoint)
+			}
+		}
+	}
+
+	types := make(map[string]bool)
+	for _, providerType := range providers.RegisteredTypes() {
+		types[providerType] = true
+	}
+	for i, providerConfig := range config.ExternalProviders {
+		field := fmt.Sprintf("externalProviders[%d]", i)
+		claim(field+".name", providerConfig.Name)
+		if !providerConfig.Enabled {
+			continue
+		}
+		if !types[providerConfig.Type] {
+			add(field+".type", "unknown provider type %q; registered types are %s", providerConfig.Type, strings.Join(providers.RegisteredTypes(), ", "))
+		}
+		if keyedProviderTypes[providerConfig.Type] && providerConfig.BaseURL == "" {
+			// Keys are usually ${VAR}s, so an empty one is more often an
+			// unset variable than a missing value
+			if providerConfig.APIKey == "" {
+				add(field+".apiKey", "%s needs an API key, or baseURL for a compatible server; if apiKey names a ${VAR}, set the environment variable", providerConfig.Type)
+			}
+		}
+		if limit := providerConfig.RateLimit; limit.RequestsPerMinute < 0 || limit.TokensPerMinute < 0 || limit.BurstMultiplier < 0 {
+			add(field+".rateLimit", "limits must not be negative")
+		}
+	}
+
+	priorities := config.Server.Concurrency.Priorities
+	for class, weight := range priorities.Weights {
+		if priorityRank(class) < 0 {
+			add("server.concurrency.priorities.weights."+class, "unknown priority class; use %s", strings.Join(priorityClasses, ", "))
+		} else if weight <= 0 {
+			add("server.concurrency.priorities.weights."+class, "must be positive")
+		}
+	}
+	if priorityRank(priorities.Default) < 0 {
+		add("server.concurrency.priorities.default", "unknown priority class %q; use %s", priorities.Default, strings.Join(priorityClasses, ", "))
+	}
+	priorityTenants := make([]string, 0, len(priorities.Tenants))
+	for tenant := range priorities.Tenants {
+		priorityTenants = append(priorityTenants, tenant)
+	}
+	sort.Strings(priorityTenants)
+	for _, tenant := range priorityTenants {
+		if class := priorities.Tenants[tenant]; priorityRank(class) < 0 {
+			add("server.concurrency.priorities.tenants."+tenant, "unknown priority class %q; use %s", class, strings.Join(priorityClasses, ", "))
+		}
+	}
+
+	router := config.Router
+	if !routingStrategies[router.RoutingStrategy] {
+		add("router.routingStrategy", "unknown strategy %q", router.RoutingStrategy)
+	}
+	if err := router.Strategies.Validate(); err != nil {
+		add("router.strategies", "%v", err)
+	}
+	positive := []struct {
+		key   string
+		value float64
+	}{
+		{"maxLatencyMs", float64(router.MaxLatencyMs)},
+		{"maxAttempts", float64(router.MaxAttempts)},
+		{"overheadFactor", router.OverheadFactor},
+		{"healthCheckInterval", float64(router.HealthCheckInterval)},
+	}
+	for _, threshold := range positive {
+		if threshold.value <= 0 {
+			add("router."+threshold.key, "must be positive")
+		}
+	}
+	nonNegative := []struct {
+		key   string
+		value float64
+	}{
+		{"maxQueueDepth", float64(router.MaxQueueDepth)},
+		{"maxConsecutiveErrors", float64(router.MaxConsecutiveErrors)},
+		{"recoveryThreshold", float64(router.RecoveryThreshold)},
+		{"monthlyAPIBudget", router.MonthlyAPIBudget},
+	}
+	for _, threshold := range nonNegative {
+		if threshold.value < 0 {
+			add("router."+threshold.key, "must not be negative")
+		}
+	}
+	if router.OverheadFactor > 0 && router.OverheadFactor < 1 {
+		add("router.overheadFactor", "%.2f prices clusters below their cost; it multiplies the raw cost, so use 1 or more", router.OverheadFactor)
+	}
+	if cache := router.ResponseCache; cache.Enabled {
+		for _, limit := range []struct {
+			key   string
+			value float64
+		}{
+			{"ttl", float64(cache.TTL)},
+			{"maxEntries", float64(cache.MaxEntries)},
+			{"maxBytes", float64(cache.MaxBytes)},
+			{"maxEntryBytes", float64(cache.MaxEntryBytes)},
+		} {
+			if limit.value <= 0 {
+				add("router.responseCache."+limit.key, "must be positive")
+			}
+		}
+		if int64(cache.MaxEntryBytes) > cache.MaxBytes {
+			add("router.responseCache.maxEntryBytes", "%d is more than maxBytes %d", cache.MaxEntryBytes, cache.MaxBytes)
+		}
+	}
+	if cache := router.SemanticCache; cache.Enabled {
+		if cache.Target == "" {
+			add("router.semanticCache.target", "is required")
+		} else if !configuredTarget(config, cache.Target) {
+			add("router.semanticCache.target", "names unknown target %s", cache.Target)
+		}
+		if cache.Model == "" {
+			add("router.semanticCache.model", "is required")
+		}
+		if cache.Threshold <= 0 || cache.Threshold > 1 {
+			add("router.semanticCache.threshold", "%g is not a cosine similarity in (0, 1]", cache.Threshold)
+		}
+		for _, limit := range []struct {
+			key   string
+			value float64
+		}{
+			{"ttl", float64(cache.TTL)},
+			{"maxEntries", float64(cache.MaxEntries)},
+			{"maxBytes", float64(cache.MaxBytes)},
+			{"maxEntryBytes", float64(cache.MaxEntryBytes)},
+			{"timeout", float64(cache.Timeout)},
+		} {
+			if limit.value <= 0 {
+				add("router.semanticCache."+limit.key, "must be positive")
+			}
+		}
+		if int64(cache.MaxEntryBytes) > cache.MaxBytes {
+			add("router.semanticCache.maxEntryBytes", "%d is more than maxBytes %d", cache.MaxEntryBytes, cache.MaxBytes)
+		}
+		switch cache.Store {
+		case "memory":
+		case "redis":
+			if cache.Redis.Addr == "" {
+				add("router.semanticCache.redis.addr", "is required for the redis store")
+			}
+			if cache.Redis.SyncInterval <= 0 {
+				add("router.semanticCache.redis.syncInterval", "must be positive")
+			}
+		default:
+			add("router.semanticCache.store", "unknown store %q, want memory or redis", cache.Store)
+		}
+	}
+
+	// Lists of targets may only name configured ones
+	for i, name := range router.FallbackOrder {
+		if !configuredTarget(config, name) {
+			add(fmt.Sprintf("router.fallbackOrder[%d]", i), "names unknown target %s", name)
+		}
+	}
+	for i, name := range router.Embeddings.Targets {
+		if !configuredTarget(config, name) {
+			add(fmt.Sprintf("router.embeddings.targets[%d]", i), "names unknown target %s", name)
+		}
+	}
+	if strategy := router.Embeddings.RoutingStrategy; strategy != "" && !routingStrategies[strategy] {
+		add("router.embeddings.routingStrategy", "unknown strategy %q", strategy)
+	}
+	if strategy := router.Batches.RoutingStrategy; !routingStrategies[strategy] {
+		add("router.batches.routingStrategy", "unknown strategy %q", strategy)
+	}
+	if router.Batches.MaxFiles < 0 {
+		add("router.batches.maxFiles", "must not be negative")
+	}
+	if router.Batches.MaxFileBytes < 0 {
+		add("router.batches.maxFileBytes", "must not be negative")
+	}
+	if config.Webhooks.MaxJobs < 0 {
+		add("webhooks.maxJobs", "must not be negative")
+	}
+	if config.Demo.Enabled && config.Demo.Password == "" {
+		add("demo.password", "is required when demo is enabled; demo sessions are refused without one")
+	}
+	for i, name := range config.Demo.Sandbox.Targets {
+		if !configuredTarget(config, name) {
+			add(fmt.Sprintf("demo.sandbox.targets[%d]", i), "names unknown target %s", name)
+		}
+	}
+	known := func(name string) bool { return configuredTarget(config, name) }
+	for _, err := range tenantRoutingErrors(router.TenantRouting, known) {
+		add("router.tenantRouting."+err.Field, "%s", err.Message)
+	}
+
+	seenKeys := make(map[string]string)
+	for i, key := range config.Auth.APIKeys.Keys {
+		field := fmt.Sprintf("auth.apiKeys.keys[%d]", i)
+		if key.Key == "" {
+			add(field+".key", "is required; is its variable set?")
+		} else if previous, ok := seenKeys[key.Key]; ok {
+			add(field+".key", "is the same key as %s", previous)
+		} else {
+			seenKeys[key.Key] = field
+		}
+		if key.Tenant == "" {
+			add(field+".tenant", "is required")
+		}
+	}
+	return errs
+}
+
+// runValidateConfig implements --validate-config: it reports every error
+// and lint finding in the config file and returns the exit status, 1 if
+// there are errors
+func runValidateConfig(path string, out io.Writer) int {
+	config, err := loadConfig(path)
+	if err != nil {
+		fmt.Fprintf(out, "error: %v\n", err)
+		return 1
+	}
+	for _, plugin := range config.ProviderPlugins {
+		if err := providers.LoadPlugin(plugin); err != nil {
+			fmt.Fprintf(out, "error: providerPlugins: %v\n", err)
+		}
+	}
+
+	errs := validateConfig(config)
+	for _, err := range errs {
+		fmt.Fprintf(out, "error: %v\n", err)
+	}
+
+	// Lint weighs provider prices, so it needs the providers themselves
+	providerSet := make(map[string]providers.Provider)
+	for _, providerConfig := range config.ExternalProviders {
+		if !providerConfig.Enabled {
+			continue
+		}
+		if provider, err := providers.New(providerConfig); err == nil {
+			providerSet[provider.Name()] = provider
+		}
+	}
+	findings := lintConfig(config, providerSet)
+	for _, finding := range findings {
+		fmt.Fprintf(out, "warning (%s): %s\n", finding.Check, finding.Message)
+	}
+
+	fmt.Fprintf(out, "%s: %d errors, %d warnings\n", path, len(errs), len(findings))
+	if len(errs) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// checkConfig logs config errors at startup, or with router.lint.strict
+// refuses to start on them
+func checkConfig(config *Config) error {
+	errs := validateConfig(config)
+	if len(errs) == 0 {
+		return nil
+	}
+	if config.Router.Lint.Strict {
+		messages := make([]string, len(errs))
+		for i, err := range errs {
+			messages[i] = err.Error()
+		}
+		return fmt.Errorf("invalid config (router.lint.strict): %s", strings.Join(messages, "; "))
+	}
+	for _, err := range errs {
+		logrus.Warnf("Config error: %v", err)
+	}
+	return nil
+}
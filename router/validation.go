@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/schema"
+	"github.com/sirupsen/logrus"
+)
+
+// SchemaValidationConfig controls post-validation of structured output from clusters
+type SchemaValidationConfig struct {
+	Enabled    bool   `yaml:"enabled"`
+	MaxRetries int    `yaml:"maxRetries"` // Retries on the same cluster before escalating
+	EscalateTo string `yaml:"escalateTo"` // Target used after retries; empty picks the cheapest healthy provider
+}
+
+// responseSchema returns the JSON schema requested via response_format, if any
+func responseSchema(body []byte) (map[string]interface{}, bool) {
+	var request struct {
+		Stream         bool `json:"stream"`
+		ResponseFormat *struct {
+			Type       string `json:"type"`
+			JSONSchema struct {
+				Schema map[string]interface{} `json:"schema"`
+			} `json:"json_schema"`
+		} `json:"response_format"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil || request.ResponseFormat == nil || request.Stream {
+		return nil, false
+	}
+
+	switch request.ResponseFormat.Type {
+	case "json_schema":
+		return request.ResponseFormat.JSONSchema.Schema, true
+	case "json_object":
+		return map[string]interface{}{"type": "object"}, true
+	}
+	return nil, false
+}
+
+// schemaEscalation is a structured output request handed from a cluster
+// that kept producing invalid output to a stronger target, claimed for it
+type schemaEscalation struct {
+	from    *RouteTarget
+	target  *RouteTarget
+	release func()
+	last    *responseBuffer // the cluster's last invalid response
+}
+
+// forwardWithSchemaValidation forwards to a cluster and validates the structured
+// output, repairing it when possible and retrying the same cluster up to
+// MaxRetries times. When the retries are used up and a stronger target is
+// available an escalation is returned instead of a response; it is run with
+// escalate after the cluster's attempt is accounted for.
+func (r *Router) forwardWithSchemaValidation(ctx context.Context, w http.ResponseWriter, req *http.Request, target *RouteTarget, llmReq *llmRequest, responseSchema map[string]interface{}) (*schemaEscalation, error) {
+	cfg := r.config.Router.SchemaValidation
+
+	var last *responseBuffer
+	for attempt := 0; attempt <= cfg.MaxRetries; attempt++ {
+		buf := newResponseBuffer()
+		if err := r.forwardToTarget(ctx, buf, req, target, llmReq); err != nil {
+			logrus.Warnf("Schema validation attempt %d against %s failed: %v", attempt+1, target.Name, err)
+			break
+		}
+		last = buf
+
+		// Upstream errors are not a structured output problem
+		if buf.StatusCode() != http.StatusOK {
+			return nil, buf.writeTo(w)
+		}
+
+		outcome, ok := validateBufferedCompletion(buf, responseSchema)
+		if ok {
+			if attempt > 0 && outcome == "valid" {
+				outcome = "retried"
+			}
+			r.metrics.schemaValidations.WithLabelValues(target.Name, outcome).Inc()
+			return nil, buf.writeTo(w)
+		}
+
+		r.metrics.schemaValidations.WithLabelValues(target.Name, "invalid").Inc()
+	}
+
+	// Same target kept failing, escalate
+	if last != nil {
+		if stronger, release, ok := r.escalationTarget(ctx, llmReq, target.Name); ok {
+			return &schemaEscalation{from: target, target: stronger, release: release, last: last}, nil
+		}
+	}
+
+	r.metrics.schemaValidations.WithLabelValues(target.Name, "failed").Inc()
+	if last == nil {
+		return nil, fmt.Errorf("no response from %s for structured output request", target.Name)
+	}
+	return nil, last.writeTo(w)
+}
+
+// escalate runs an escalated structured output request as an attempt of
+// its own against the stronger target, so its spend, rate limits and quota
+// are the target's. If it fails the cluster's last response is served.
+func (r *Router) escalate(ctx context.Context, w http.ResponseWriter, req *http.Request, esc *schemaEscalation, llmReq *llmRequest, responseSchema map[string]interface{}, start time.Time) error {
+	defer esc.release()
+
+	buf := newResponseBuffer()
+	err := r.forwardAttempt(ctx, newFailoverWriter(buf), req, esc.target, llmReq, start)
+	if err == nil {
+		outcome, ok := validateBufferedCompletion(buf, responseSchema)
+		if !ok {
+			outcome = "invalid"
+		} else if outcome == "valid" {
+			outcome = "escalated"
+		}
+		r.metrics.schemaValidations.WithLabelValues(esc.target.Name, outcome).Inc()
+		logrus.Infof("Escalated structured output request from %s to %s", esc.from.Name, esc.target.Name)
+		// The stronger target's attempt set its own routing headers
+		for name := range buf.Header() {
+			w.Header().Del(name)
+		}
+		return buf.writeTo(w)
+	}
+	logrus.Warnf("Schema validation escalation to %s failed: %v", esc.target.Name, err)
+
+	r.metrics.schemaValidations.WithLabelValues(esc.from.Name, "failed").Inc()
+	return esc.last.writeTo(w)
+}
+
+// validateBufferedCompletion checks the first choice's content against the
+// schema, rewriting the buffered body if a repair was needed
+func validateBufferedCompletion(buf *responseBuffer, responseSchema map[string]interface{}) (string, bool) {
+	var completion map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &completion); err != nil {
+		return "invalid", false
+	}
+
+	choices, _ := completion["choices"].([]interface{})
+	if len(choices) == 0 {
+		return "invalid", false
+	}
+	choice, _ := choices[0].(map[string]interface{})
+	message, _ := choice["message"].(map[string]interface{})
+	content, _ := message["content"].(string)
+
+	if schema.Validate(content, responseSchema) == nil {
+		return "valid", true
+	}
+
+	repaired, changed := schema.Repair(content)
+	if !changed || schema.Validate(repaired, responseSchema) != nil {
+		return "invalid", false
+	}
+
+	message["content"] = repaired
+	if rewritten, err := json.Marshal(completion); err == nil {
+		buf.SetBody(rewritten)
+	}
+	return "repaired", true
+}
+
+// escalationTarget picks the target that takes over after a cluster keeps
+// producing invalid structured output, claimed with claimTarget. It must be
+// one the request could have been routed to; with none, there is no
+// escalation.
+func (r *Router) escalationTarget(ctx context.Context, llmReq *llmRequest, exclude string) (*RouteTarget, func(), bool) {
+	targets := r.getAllTargets(ctx)
+	if served, ok := r.filterByModel(targets, llmReq.Model); ok {
+		targets = served
+	}
+
+	name := r.config.Router.SchemaValidation.EscalateTo
+	var candidates []*RouteTarget
+	for _, target := range targets {
+		if target.Name == exclude || !r.canTakeOver(target, llmReq) {
+			continue
+		}
+		if (name != "" && target.Name == name) || (name == "" && target.Type == "provider") {
+			candidates = append(candidates, target)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Cost < candidates[j].Cost
+	})
+
+	for _, target := range candidates {
+		if release, ok := r.claimTarget(target, llmReq); ok {
+			return target, release, true
+		}
+		logrus.WithContext(ctx).Debugf("Skipping escalation to %s: cluster group at capacity, circuit open or rate limited", target.Name)
+	}
+	return nil, nil, false
+}
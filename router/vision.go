@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/navillasa/multi-cloud-llm-router/router/internal/providers"
+)
+
+// VisionConfig covers models that accept images
+type VisionConfig struct {
+	Models []string `yaml:"models"` // model name prefixes to treat as vision models besides the known families
+}
+
+// hasImages reports whether chat messages carry image_url content parts
+func hasImages(messages []struct {
+	Content json.RawMessage `json:"content"`
+}) bool {
+	for _, message := range messages {
+		var parts []struct {
+			Type string `json:"type"`
+		}
+		if json.Unmarshal(message.Content, &parts) != nil {
+			continue // plain text
+		}
+		for _, part := range parts {
+			if part.Type == "image_url" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isVisionModel reports whether model is a known or configured vision
+// model
+func (r *Router) isVisionModel(model string) bool {
+	if providers.IsVisionModel(model) {
+		return true
+	}
+	for _, prefix := range r.config.Router.Vision.Models {
+		if prefix != "" && strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// visionTarget reports whether target would answer model with a vision
+// model, by the model sent or the cluster's vision flag
+func (r *Router) visionTarget(target *RouteTarget, model string) bool {
+	if target.Model != "" {
+		model = target.Model
+	}
+	if target.Type == "cluster" {
+		for _, cluster := range r.clusterConfigs() {
+			if cluster.Name == target.Name && cluster.Vision {
+				return true
+			}
+		}
+	}
+	if defaulter, ok := target.Provider.(providers.DefaultModeler); ok && model == "" {
+		model = defaulter.DefaultModel()
+	}
+	return r.isVisionModel(model)
+}
+
+// filterByVision keeps requests with images on targets that accept them.
+// A model that can't see would answer as if the images weren't there, so
+// the request fails instead when none is left.
+func (r *Router) filterByVision(targets []*RouteTarget, llmReq *llmRequest) ([]*RouteTarget, error) {
+	if !llmReq.Images {
+		return targets, nil
+	}
+	kept := targets[:0:0]
+	for _, target := range targets {
+		if r.visionTarget(target, llmReq.Model) {
+			kept = append(kept, target)
+		}
+	}
+	if len(kept) == 0 {
+		return nil, fmt.Errorf("no healthy target accepts images")
+	}
+	return kept, nil
+}